@@ -10,6 +10,7 @@ import (
 
 	"github.com/babelcloud/gbox/packages/cli/internal/adb_expose"
 	client "github.com/babelcloud/gbox/packages/cli/internal/client"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +19,7 @@ type AdbExposeOptions struct {
 	BoxID      string
 	LocalPort  int // Optional local port to bind to
 	Foreground bool
+	AdbConnect bool // Run adb connect against the exposed port
 }
 
 type AdbExposeStopOptions struct {
@@ -25,7 +27,7 @@ type AdbExposeStopOptions struct {
 }
 
 type AdbExposeListOptions struct {
-	OutputFormat string
+	Output output.Options
 }
 
 // NewAdbExposeCommand creates the adb-expose command
@@ -47,6 +49,9 @@ Examples:
   # Start with specific options
   gbox adb-expose start <box_id> --port 6666 --foreground
 
+  # Start and connect the local adb server to the exposed port
+  gbox adb-expose start <box_id> --adb-connect
+
   # Stop ADB port exposure
   gbox adb-expose stop <box_id>
 
@@ -89,6 +94,7 @@ func NewAdbExposeStartCommand() *cobra.Command {
 
 	cmd.Flags().IntVarP(&opts.LocalPort, "port", "p", 0, "Local port to bind to (default: auto-find available port starting from 5555)")
 	cmd.Flags().BoolVarP(&opts.Foreground, "foreground", "f", false, "Run in foreground (default is background/daemon mode)")
+	cmd.Flags().BoolVar(&opts.AdbConnect, "adb-connect", false, "Connect the local adb server to the exposed port (disconnected on stop)")
 
 	return cmd
 }
@@ -124,7 +130,7 @@ func NewAdbExposeListCommand() *cobra.Command {
 		SilenceErrors: true, // Don't show errors (we handle them ourselves)
 	}
 
-	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "table", "Output format (table|json)")
+	addOutputFlags(cmd, &opts.Output, true)
 
 	return cmd
 }
@@ -151,7 +157,7 @@ func ExecuteAdbExposeInteractive(cmd *cobra.Command, opts *AdbExposeOptions) err
 	// Use the new client-server architecture to list current exposures
 	fmt.Println("Current ADB port exposures:")
 	fmt.Println("============================")
-	if err := adb_expose.ListCommand(""); err != nil {
+	if err := adb_expose.ListCommand(&output.Options{}); err != nil {
 		// If server is not running, just show a message
 		fmt.Println("ADB Expose server is not running")
 	}
@@ -263,6 +269,12 @@ func ExecuteAdbExposeInteractive(cmd *cobra.Command, opts *AdbExposeOptions) err
 	fmt.Scanln(&foregroundInput)
 	opts.Foreground = strings.ToLower(foregroundInput) == "y" || strings.ToLower(foregroundInput) == "yes"
 
+	// Ask whether to connect the local adb server
+	fmt.Print("Run 'adb connect' automatically? (y/N): ")
+	var adbConnectInput string
+	fmt.Scanln(&adbConnectInput)
+	opts.AdbConnect = strings.ToLower(adbConnectInput) == "y" || strings.ToLower(adbConnectInput) == "yes"
+
 	// Execute the actual port exposure
 	return ExecuteAdbExpose(cmd, opts, []string{})
 }
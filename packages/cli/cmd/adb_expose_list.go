@@ -8,5 +8,5 @@ import (
 // ExecuteAdbExposeList lists all exposed ADB ports using the new client-server architecture
 func ExecuteAdbExposeList(cmd *cobra.Command, opts *AdbExposeListOptions) error {
 	// Use the new client-server architecture
-	return adb_expose.ListCommand(opts.OutputFormat)
+	return adb_expose.ListCommand(&opts.Output)
 }
@@ -26,5 +26,5 @@ func ExecuteAdbExpose(cmd *cobra.Command, opts *AdbExposeOptions, args []string)
 	remotePort := 5555
 
 	// Use the new client-server architecture
-	return adb_expose.StartCommand(opts.BoxID, []int{localPort}, []int{remotePort}, opts.Foreground)
+	return adb_expose.StartCommand(opts.BoxID, []int{localPort}, []int{remotePort}, opts.Foreground, opts.AdbConnect)
 }
\ No newline at end of file
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sdk "github.com/babelcloud/gbox-sdk-go"
+	"github.com/babelcloud/gbox/packages/cli/internal/boxspec"
+	client "github.com/babelcloud/gbox/packages/cli/internal/client"
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/spf13/cobra"
+)
+
+type BoxApplyOptions struct {
+	File         string
+	DryRun       bool
+	OutputFormat string
+}
+
+// boxApplyResult is the JSON output for a single applied spec
+type boxApplyResult struct {
+	Name       string   `json:"name"`
+	Action     string   `json:"action"`
+	BoxID      string   `json:"boxId,omitempty"`
+	Diffs      []string `json:"diffs,omitempty"`
+	Duplicates []string `json:"duplicates,omitempty"`
+}
+
+func NewBoxApplyCommand() *cobra.Command {
+	opts := &BoxApplyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "apply -f FILE",
+		Short: "Create or update boxes from a spec file",
+		Long: `Create or reconcile boxes from a declarative YAML or JSON spec.
+
+Each spec is identified by its name, which is stored in the box label "gbox.name".
+If no live box carries the name a new box is created. If the existing box differs
+from the spec (type, device type, labels or env) it is terminated and recreated,
+otherwise it is left untouched. Files and setup commands are applied to new boxes
+only; ports are forwarded on every apply.
+
+Multiple specs can be placed in one file separated by '---'.
+
+Spec format:
+  name: my-env              # required, unique per file
+  type: android             # required: android or linux
+  deviceType: virtual       # android only (default: virtual)
+  expiresIn: 60m            # android only (default: 60m)
+  labels:
+    team: qa
+  env:
+    LOG_LEVEL: debug
+  files:                    # uploaded after creation, relative to the spec file
+    - src: ./fixtures
+      dest: /sdcard/
+  setup:                    # shell commands run after files are uploaded
+    - echo ready
+  ports:                    # android only, forwarded via adb-expose
+    - local: 5555
+      remote: 5555`,
+		Example: `  gbox box apply -f spec.yaml              # Create or reconcile boxes
+  gbox box apply -f spec.yaml --dry-run    # Show what would change
+  cat spec.json | gbox box apply -f -      # Read the spec from stdin`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBoxApply(opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.File, "file", "f", "", "Spec file (YAML or JSON), '-' for stdin")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "Show the planned changes without applying them")
+	flags.StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (json or text)")
+	cmd.MarkFlagRequired("file")
+
+	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"json", "text"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
+
+func runBoxApply(opts *BoxApplyOptions) error {
+	specs, err := boxspec.LoadFile(opts.File)
+	if err != nil {
+		return err
+	}
+
+	// Files in a spec are relative to the spec file
+	baseDir := "."
+	if opts.File != "-" {
+		baseDir = filepath.Dir(opts.File)
+	}
+
+	sdkClient, err := client.NewClientFromProfile()
+	if err != nil {
+		return fmt.Errorf("failed to initialize gbox client: %v", err)
+	}
+
+	var changes []boxspec.Change
+	for _, spec := range specs {
+		boxes, err := client.ListBoxesRawData(sdkClient, []string{spec.NameFilter()})
+		if err != nil {
+			return err
+		}
+		changes = append(changes, boxspec.Plan(spec, boxes))
+	}
+
+	jsonOutput := opts.OutputFormat == "json"
+	if !jsonOutput {
+		printApplyPlan(changes)
+	}
+
+	var results []boxApplyResult
+	for _, change := range changes {
+		if !opts.DryRun {
+			boxID, err := applyChange(sdkClient, change, baseDir, !jsonOutput)
+			if err != nil {
+				return fmt.Errorf("failed to apply %q: %v", change.Spec.Name, err)
+			}
+			change.BoxID = boxID
+		}
+		results = append(results, boxApplyResult{
+			Name:       change.Spec.Name,
+			Action:     string(change.Action),
+			BoxID:      change.BoxID,
+			Diffs:      change.Diffs,
+			Duplicates: change.Duplicates,
+		})
+	}
+
+	if jsonOutput {
+		resultJSON, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(resultJSON))
+	} else if opts.DryRun {
+		fmt.Println("Dry run, no changes applied.")
+	}
+	return nil
+}
+
+// printApplyPlan prints the planned changes as a diff
+func printApplyPlan(changes []boxspec.Change) {
+	for _, change := range changes {
+		spec := change.Spec
+		switch change.Action {
+		case boxspec.ActionCreate:
+			fmt.Printf("+ %s (%s): create\n", spec.Name, spec.Type)
+		case boxspec.ActionReplace:
+			fmt.Printf("~ %s (%s): replace box %s\n", spec.Name, spec.Type, change.BoxID)
+			for _, diff := range change.Diffs {
+				fmt.Printf("    %s\n", diff)
+			}
+		case boxspec.ActionUnchanged:
+			fmt.Printf("= %s (%s): unchanged box %s\n", spec.Name, spec.Type, change.BoxID)
+		}
+		for _, id := range change.Duplicates {
+			fmt.Printf("- %s: terminate duplicate box %s\n", spec.Name, id)
+		}
+	}
+}
+
+// applyChange carries out a planned change and returns the ID of the resulting box
+func applyChange(sdkClient *sdk.Client, change boxspec.Change, baseDir string, verbose bool) (string, error) {
+	spec := change.Spec
+	logf := func(format string, args ...interface{}) {
+		if verbose {
+			fmt.Printf(format, args...)
+		}
+	}
+
+	for _, id := range change.Duplicates {
+		if err := client.TerminateBox(sdkClient, id); err != nil {
+			return "", err
+		}
+		logf("Terminated duplicate box %s\n", id)
+	}
+
+	boxID := change.BoxID
+	if change.Action == boxspec.ActionReplace {
+		if err := client.TerminateBox(sdkClient, boxID); err != nil {
+			return "", err
+		}
+		logf("Terminated box %s\n", boxID)
+	}
+
+	if change.Action != boxspec.ActionUnchanged {
+		var err error
+		if boxID, err = createSpecBox(sdkClient, spec); err != nil {
+			return "", err
+		}
+		logf("Box %q created with ID \"%s\"\n", spec.Name, boxID)
+
+		if err := uploadSpecFiles(sdkClient, boxID, spec, baseDir); err != nil {
+			return boxID, err
+		}
+		if err := runSpecSetup(sdkClient, boxID, spec, verbose); err != nil {
+			return boxID, err
+		}
+	}
+
+	if len(spec.Ports) > 0 {
+		localPorts := make([]int, len(spec.Ports))
+		remotePorts := make([]int, len(spec.Ports))
+		for i, p := range spec.Ports {
+			localPorts[i], remotePorts[i] = p.Local, p.Remote
+		}
+		if err := forwardSpecPorts(boxID, localPorts, remotePorts); err != nil {
+			return boxID, fmt.Errorf("failed to forward ports: %v", err)
+		}
+		logf("Forwarding local ports %v to box %s\n", localPorts, boxID)
+	}
+
+	return boxID, nil
+}
+
+// forwardSpecPorts exposes ports of a box through the local server, quietly
+// so -o json output stays a single document. Ports already forwarded are
+// left as they are.
+func forwardSpecPorts(boxID string, localPorts, remotePorts []int) error {
+	server, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return err
+	}
+	_, err = server.StartADBExpose(serverclient.ExposeStartRequest{
+		BoxID:       boxID,
+		LocalPorts:  localPorts,
+		RemotePorts: remotePorts,
+	})
+	if serverclient.StatusCode(err) == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+func createSpecBox(sdkClient *sdk.Client, spec boxspec.Spec) (string, error) {
+	if spec.Type == "android" {
+		box, err := client.CreateAndroidBox(sdkClient, spec.DeviceType, spec.EnvPairs(), spec.LabelPairs(), spec.ExpiresIn)
+		if err != nil {
+			return "", err
+		}
+		return box.ID, nil
+	}
+
+	box, err := client.CreateLinuxBox(sdkClient, spec.EnvPairs(), spec.LabelPairs())
+	if err != nil {
+		return "", err
+	}
+	return box.ID, nil
+}
+
+// uploadSpecFiles copies the spec files into the box with `box cp` semantics
+func uploadSpecFiles(sdkClient *sdk.Client, boxID string, spec boxspec.Spec, baseDir string) error {
+	if len(spec.Files) == 0 {
+		return nil
+	}
+
+	copier := &boxCopier{
+		opts:      &BoxCpOptions{},
+		debug:     func(msg string) {},
+		sdkClient: sdkClient,
+	}
+	for _, f := range spec.Files {
+		src := f.Source
+		if !filepath.IsAbs(src) {
+			src = filepath.Join(baseDir, src)
+			if strings.HasSuffix(f.Source, string(os.PathSeparator)+".") {
+				// filepath.Join drops the contents-only suffix
+				src += string(os.PathSeparator) + "."
+			}
+		}
+		if err := copier.copyFromFileToBox(src, &BoxPath{BoxID: boxID, Path: f.Destination}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSpecSetup runs the setup commands in order and stops at the first failure
+func runSpecSetup(sdkClient *sdk.Client, boxID string, spec boxspec.Spec, verbose bool) error {
+	for _, command := range spec.Setup {
+		if verbose {
+			fmt.Printf("Running setup: %s\n", command)
+		}
+		resp, err := client.ExecCommand(sdkClient, boxID, []string{command}, spec.Env, "")
+		if err != nil {
+			return err
+		}
+		if verbose {
+			os.Stdout.WriteString(resp.Stdout)
+		}
+		os.Stderr.WriteString(resp.Stderr)
+		if resp.ExitCode != 0 {
+			return fmt.Errorf("setup command %q exited with code %d", command, int(resp.ExitCode))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/babelcloud/gbox-sdk-go"
+	client "github.com/babelcloud/gbox/packages/cli/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// defaultBatchParallel is the default number of boxes operated on concurrently
+const defaultBatchParallel = 8
+
+// BatchOptions holds the flags shared by commands that fan out over boxes
+// matched by a label selector
+type BatchOptions struct {
+	Selector    string
+	Parallel    int
+	Summary     string
+	SummaryFile string
+}
+
+// addBatchFlags registers the selector and fan-out flags on cmd
+func addBatchFlags(cmd *cobra.Command, opts *BatchOptions) {
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.Selector, "selector", "l", "", "Operate on all boxes matching a label selector (e.g. env=test)")
+	flags.IntVarP(&opts.Parallel, "parallel", "p", defaultBatchParallel, "Maximum number of boxes to operate on concurrently (with --selector)")
+	flags.StringVar(&opts.Summary, "summary", "", "Emit a summary of the results (json or junit, with --selector)")
+	flags.StringVar(&opts.SummaryFile, "summary-file", "", "Write the summary to a file instead of stdout")
+
+	cmd.RegisterFlagCompletionFunc("summary", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"json", "junit"}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+// validate checks the batch flags
+func (o *BatchOptions) validate() error {
+	if o.Parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	switch o.Summary {
+	case "", "json", "junit":
+	default:
+		return fmt.Errorf("invalid summary format: %s (must be json or junit)", o.Summary)
+	}
+	if o.SummaryFile != "" && o.Summary == "" {
+		return fmt.Errorf("--summary-file requires --summary")
+	}
+	return nil
+}
+
+// validateStructured checks the summary can be combined with structured
+// output, stdout must hold a single document so only a JSON summary embedded
+// by the command itself may go there
+func (o *BatchOptions) validateStructured(embeddable bool) error {
+	if o.Summary == "" || o.SummaryFile != "" {
+		return nil
+	}
+	if o.Summary == "json" && embeddable {
+		return nil
+	}
+	return fmt.Errorf("--summary %s with structured output requires --summary-file", o.Summary)
+}
+
+// embedsSummary reports whether the JSON summary goes into the command's own
+// JSON document instead of being written separately
+func (o *BatchOptions) embedsSummary() bool {
+	return o.Summary == "json" && o.SummaryFile == ""
+}
+
+// selectBoxes returns the IDs of boxes matching a label selector, skipping
+// terminated boxes. If statuses is not empty only boxes in one of those statuses
+// are returned.
+func selectBoxes(sdkClient *sdk.Client, selector string, statuses ...string) ([]string, error) {
+	filters := []string{"label=" + selector}
+	if len(statuses) > 0 {
+		filters = append(filters, "status="+strings.Join(statuses, ","))
+	}
+
+	boxes, err := client.ListBoxesData(sdkClient, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get box list: %v", err)
+	}
+
+	var ids []string
+	for _, box := range boxes {
+		if box.Status == "terminated" {
+			continue
+		}
+		ids = append(ids, box.ID)
+	}
+	return ids, nil
+}
+
+// boxResult is the outcome of an operation on a single box
+type boxResult struct {
+	BoxID    string  `json:"boxId"`
+	ExitCode int     `json:"exitCode"`
+	Stdout   string  `json:"stdout,omitempty"`
+	Stderr   string  `json:"stderr,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"durationSeconds"`
+}
+
+// failed reports whether the operation failed on the box
+func (r boxResult) failed() bool {
+	return r.Error != "" || r.ExitCode != 0
+}
+
+// forEachBox runs fn on every box with at most parallel concurrent calls.
+// done is called for each result as soon as it is available, one at a time.
+// Results are returned in the order of ids.
+func forEachBox(ids []string, parallel int, fn func(boxID string) boxResult, done func(boxResult)) []boxResult {
+	results := make([]boxResult, len(ids))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	var doneMu sync.Mutex
+
+	for i, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			result := fn(id)
+			result.BoxID = id
+			result.Duration = time.Since(start).Seconds()
+			results[i] = result
+
+			if done != nil {
+				doneMu.Lock()
+				done(result)
+				doneMu.Unlock()
+			}
+		}(i, id)
+	}
+	wg.Wait()
+	return results
+}
+
+// aggregateExitCode returns the highest exit code of the results, failures
+// without an exit code count as 1
+func aggregateExitCode(results []boxResult) int {
+	code := 0
+	for _, r := range results {
+		c := r.ExitCode
+		if c == 0 && r.Error != "" {
+			c = 1
+		}
+		if c > code {
+			code = c
+		}
+	}
+	return code
+}
+
+// shortBoxID shortens a box ID for output prefixes
+func shortBoxID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// writePrefixed writes every line of s to w prefixed with the box ID
+func writePrefixed(w io.Writer, boxID, s string) {
+	if s == "" {
+		return
+	}
+	prefix := fmt.Sprintf("[%s] ", shortBoxID(boxID))
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		io.WriteString(w, prefix+line)
+	}
+}
+
+// writeBatchSummary writes the results in the requested summary format
+func writeBatchSummary(opts *BatchOptions, name string, results []boxResult) error {
+	if opts.Summary == "" {
+		return nil
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.SummaryFile != "" {
+		f, err := os.Create(opts.SummaryFile)
+		if err != nil {
+			return fmt.Errorf("failed to create summary file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch opts.Summary {
+	case "junit":
+		return writeJUnitSummary(out, name, results)
+	default:
+		return writeJSONSummary(out, name, results)
+	}
+}
+
+// batchSummary builds the JSON summary of the results
+func batchSummary(name string, results []boxResult) map[string]interface{} {
+	failed := 0
+	for _, r := range results {
+		if r.failed() {
+			failed++
+		}
+	}
+	return map[string]interface{}{
+		"operation": name,
+		"total":     len(results),
+		"failed":    failed,
+		"exitCode":  aggregateExitCode(results),
+		"results":   results,
+	}
+}
+
+func writeJSONSummary(w io.Writer, name string, results []boxResult) error {
+	data, err := json.MarshalIndent(batchSummary(name, results), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+func writeJUnitSummary(w io.Writer, name string, results []boxResult) error {
+	suite := junitTestSuite{Name: name, Tests: len(results)}
+	for _, r := range results {
+		tc := junitTestCase{
+			Name:      r.BoxID,
+			ClassName: name,
+			Time:      r.Duration,
+			SystemOut: r.Stdout,
+			SystemErr: r.Stderr,
+		}
+		switch {
+		case r.Error != "":
+			tc.Error = &junitMessage{Message: r.Error}
+			suite.Errors++
+		case r.ExitCode != 0:
+			tc.Failure = &junitMessage{Message: fmt.Sprintf("exited with code %d", r.ExitCode)}
+			suite.Failures++
+		}
+		if r.Duration > suite.Time {
+			// Boxes run concurrently, the suite takes as long as the slowest box
+			suite.Time = r.Duration
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the worker pool bounds concurrency and keeps results in order
+func TestForEachBox(t *testing.T) {
+	ids := []string{"box-1", "box-2", "box-3", "box-4", "box-5", "box-6"}
+	var running, maxRunning int32
+	var done []string
+
+	results := forEachBox(ids, 2, func(boxID string) boxResult {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if boxID == "box-3" {
+			return boxResult{ExitCode: 2}
+		}
+		return boxResult{}
+	}, func(r boxResult) {
+		done = append(done, r.BoxID)
+	})
+
+	assert.LessOrEqual(t, maxRunning, int32(2))
+	assert.Len(t, done, len(ids))
+	for i, r := range results {
+		assert.Equal(t, ids[i], r.BoxID)
+	}
+	assert.Equal(t, 2, results[2].ExitCode)
+}
+
+// Test exit code aggregation
+func TestAggregateExitCode(t *testing.T) {
+	assert.Equal(t, 0, aggregateExitCode([]boxResult{{}, {}}))
+	assert.Equal(t, 1, aggregateExitCode([]boxResult{{}, {Error: "failed"}}))
+	assert.Equal(t, 3, aggregateExitCode([]boxResult{{ExitCode: 3}, {Error: "failed"}, {ExitCode: 2}}))
+}
+
+// Test per-box output prefixing
+func TestWritePrefixed(t *testing.T) {
+	var buf bytes.Buffer
+	writePrefixed(&buf, "550e8400-e29b-41d4-a716-446655440000", "line one\nline two")
+	assert.Equal(t, "[550e8400-e29] line one\n[550e8400-e29] line two\n", buf.String())
+}
+
+// Test the JSON and JUnit summaries
+func TestBatchSummaries(t *testing.T) {
+	results := []boxResult{
+		{BoxID: "box-1", Stdout: "ok\n"},
+		{BoxID: "box-2", ExitCode: 1},
+		{BoxID: "box-3", Error: "box not running"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeJSONSummary(&buf, "gbox box exec", results))
+	assert.Contains(t, buf.String(), `"failed": 2`)
+	assert.Contains(t, buf.String(), `"exitCode": 1`)
+
+	buf.Reset()
+	assert.NoError(t, writeJUnitSummary(&buf, "gbox box exec", results))
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "<?xml"))
+	assert.Contains(t, out, `<testsuite name="gbox box exec" tests="3" failures="1" errors="1"`)
+	assert.Contains(t, out, `<failure message="exited with code 1">`)
+	assert.Contains(t, out, `<error message="box not running">`)
+	assert.Contains(t, out, "<system-out>ok")
+}
+
+// Test batch flag validation
+func TestBatchOptionsValidate(t *testing.T) {
+	assert.NoError(t, (&BatchOptions{Parallel: 1}).validate())
+	assert.Error(t, (&BatchOptions{Parallel: 0}).validate())
+	assert.Error(t, (&BatchOptions{Parallel: 1, Summary: "xml"}).validate())
+	assert.Error(t, (&BatchOptions{Parallel: 1, SummaryFile: "out.json"}).validate())
+}
+
+// Test the summary checks for structured output
+func TestBatchSummaryStructured(t *testing.T) {
+	assert.NoError(t, (&BatchOptions{}).validateStructured(false))
+	assert.NoError(t, (&BatchOptions{Summary: "json"}).validateStructured(true))
+	assert.Error(t, (&BatchOptions{Summary: "json"}).validateStructured(false))
+	assert.Error(t, (&BatchOptions{Summary: "junit"}).validateStructured(true))
+	assert.NoError(t, (&BatchOptions{Summary: "junit", SummaryFile: "out.xml"}).validateStructured(true))
+
+	assert.True(t, (&BatchOptions{Summary: "json"}).embedsSummary())
+	assert.False(t, (&BatchOptions{Summary: "json", SummaryFile: "out.json"}).embedsSummary())
+
+	summary := batchSummary("gbox box terminate", []boxResult{{BoxID: "box-1"}, {BoxID: "box-2", Error: "not found"}})
+	assert.Equal(t, 2, summary["total"])
+	assert.Equal(t, 1, summary["failed"])
+}
@@ -1,17 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 
-	"github.com/babelcloud/gbox/packages/cli/internal/profile"
+	sdk "github.com/babelcloud/gbox-sdk-go"
+	client "github.com/babelcloud/gbox/packages/cli/internal/client"
+	"github.com/babelcloud/gbox/packages/cli/internal/util"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // BoxPath represents the structure of a box path
@@ -60,6 +63,9 @@ func getAbsolutePath(path string) string {
 type BoxCpOptions struct {
 	Source      string
 	Destination string
+	FollowLink  bool
+	Archive     bool
+	Quiet       bool
 }
 
 func NewBoxCpCommand() *cobra.Command {
@@ -68,18 +74,26 @@ func NewBoxCpCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cp <src> <dst>",
 		Short: "Copy files/folders between a box and the local filesystem",
-		Long: `usage: gbox-box-cp [-h] src dst
+		Long: `usage: gbox-box-cp [-h] [-L] [-a] [-q] src dst
 
-Copy files/folders between a box and the local filesystem
+Copy files/folders between a box and the local filesystem, or between two boxes
 
 positional arguments:
   src                Source path
   dst                Destination path
 
 options:
-  -h, --help         show this help message and exit`,
+  -h, --help         show this help message and exit
+  -L, --follow-link  Always follow symbolic link in a local source path
+  -a, --archive      Archive mode (copy all uid/gid information)
+  -q, --quiet        Suppress progress output
+
+Paths follow the same rules as docker cp: copying to an existing directory
+places the source inside it, otherwise the source is renamed to the destination.
+A source path ending in "/." copies the directory contents only.`,
 		Example: `    gbox box cp ./local_file 550e8400-e29b-41d4-a716-446655440000:/work     # Copy local file to box
     gbox box cp 550e8400-e29b-41d4-a716-446655440000:/var/logs/ /tmp/app_logs     # Copy from box to local
+    gbox box cp 550e8400-e29b-41d4-a716-446655440000:/work 6ba7b810-9dad-11d1-80b4-00c04fd430c8:/work     # Copy between boxes
     gbox box cp - 550e8400-e29b-41d4-a716-446655440000:/work     # Copy tar stream from stdin to box
     gbox box cp 550e8400-e29b-41d4-a716-446655440000:/etc/hosts -     # Copy from box to stdout as tar stream`,
 		Args: cobra.ExactArgs(2),
@@ -90,6 +104,10 @@ options:
 		},
 	}
 
+	cmd.Flags().BoolVarP(&opts.FollowLink, "follow-link", "L", false, "Always follow symbolic link in a local source path")
+	cmd.Flags().BoolVarP(&opts.Archive, "archive", "a", false, "Archive mode (copy all uid/gid information)")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Suppress progress output")
+
 	return cmd
 }
 
@@ -98,9 +116,6 @@ func runCopyCommand(opts *BoxCpOptions) error {
 	dst := opts.Destination
 	debugEnabled := os.Getenv("DEBUG") == "true"
 
-	// Get effective base URL for API calls
-	apiURL := profile.Default.GetEffectiveBaseURL()
-
 	// Debug log
 	debug := func(msg string) {
 		if debugEnabled {
@@ -108,52 +123,107 @@ func runCopyCommand(opts *BoxCpOptions) error {
 		}
 	}
 
+	c := &boxCopier{
+		opts:     opts,
+		tarOpts:  tarOptions{FollowLink: opts.FollowLink, Archive: opts.Archive},
+		progress: !opts.Quiet && term.IsTerminal(int(os.Stderr.Fd())),
+		debug:    debug,
+	}
+
 	// Determine copy direction and process
-	if isBoxPath(src) && !isBoxPath(dst) {
-		return copyFromBoxToLocal(src, dst, apiURL, debug)
-	} else if !isBoxPath(src) && isBoxPath(dst) {
-		return copyFromLocalToBox(src, dst, apiURL, debug)
-	} else {
-		return fmt.Errorf("invalid path format. One path must be a box path (BOX_ID:PATH) and the other must be a local path")
+	switch {
+	case isBoxPath(src) && isBoxPath(dst):
+		return c.copyFromBoxToBox(src, dst)
+	case isBoxPath(src) && !isBoxPath(dst):
+		return c.copyFromBoxToLocal(src, dst)
+	case !isBoxPath(src) && isBoxPath(dst):
+		return c.copyFromLocalToBox(src, dst)
+	default:
+		return fmt.Errorf("invalid path format. At least one path must be a box path (BOX_ID:PATH)")
+	}
+}
+
+// boxCopier holds the state shared by all copy directions
+type boxCopier struct {
+	opts      *BoxCpOptions
+	tarOpts   tarOptions
+	progress  bool
+	debug     func(string)
+	sdkClient *sdk.Client
+}
+
+// client returns the authenticated profile client, created on first use
+func (c *boxCopier) client() (*sdk.Client, error) {
+	if c.sdkClient == nil {
+		sdkClient, err := client.NewClientFromProfile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client: %v", err)
+		}
+		c.sdkClient = sdkClient
+	}
+	return c.sdkClient, nil
+}
+
+// withProgress wraps r in a progress bar when progress output is enabled
+func (c *boxCopier) withProgress(r io.Reader, label string, total int64) (io.Reader, func()) {
+	if !c.progress {
+		return r, func() {}
+	}
+	pr := util.NewProgressReader(r, os.Stderr, label, total)
+	return pr, pr.Finish
+}
+
+// boxUploadTarget works out the directory to extract into inside the box and the
+// name the top-level archive entry should get, following `docker cp` rules.
+func (c *boxCopier) boxUploadTarget(boxPath *BoxPath, srcName string) (dir, rename string) {
+	if srcName == "" || strings.HasSuffix(boxPath.Path, "/") {
+		return boxPath.Path, ""
+	}
+
+	sdkClient, err := c.client()
+	if err != nil {
+		c.debug(fmt.Sprintf("Cannot stat destination, uploading into it as a directory: %v", err))
+		return boxPath.Path, ""
+	}
+	info, err := client.StatBoxPath(sdkClient, boxPath.BoxID, boxPath.Path)
+	if err != nil {
+		c.debug(fmt.Sprintf("Cannot stat destination, uploading into it as a directory: %v", err))
+		return boxPath.Path, ""
 	}
+	if info.Exists && info.IsDir {
+		return boxPath.Path, ""
+	}
+	return path.Dir(boxPath.Path), path.Base(boxPath.Path)
 }
 
-func copyFromBoxToLocal(src, dst, apiURL string, debug func(string)) error {
+func (c *boxCopier) copyFromBoxToLocal(src, dst string) error {
 	boxPath, err := parseBoxPath(src)
 	if err != nil {
 		return err
 	}
 
-	debug(fmt.Sprintf("Box ID: %s", boxPath.BoxID))
-	debug(fmt.Sprintf("Source path: %s", boxPath.Path))
-	debug(fmt.Sprintf("Destination path: %s", dst))
+	c.debug(fmt.Sprintf("Box ID: %s", boxPath.BoxID))
+	c.debug(fmt.Sprintf("Source path: %s", boxPath.Path))
+	c.debug(fmt.Sprintf("Destination path: %s", dst))
 
 	if dst == "-" {
 		// Copy from box to stdout as tar stream
-		return copyFromBoxToStdout(boxPath, apiURL, debug)
-	} else {
-		// Copy from box to local file
-		return copyFromBoxToFile(boxPath, dst, apiURL, debug)
+		return c.copyFromBoxToStdout(boxPath)
 	}
+	// Copy from box to local file
+	return c.copyFromBoxToFile(boxPath, dst)
 }
 
-func copyFromBoxToStdout(boxPath *BoxPath, apiURL string, debug func(string)) error {
-	requestURL := fmt.Sprintf("%s/boxes/%s/archive?path=%s", apiURL, boxPath.BoxID, boxPath.Path)
-	debug(fmt.Sprintf("Sending GET request to: %s", requestURL))
-
-	resp, err := http.Get(requestURL)
+func (c *boxCopier) copyFromBoxToStdout(boxPath *BoxPath) error {
+	body, size, err := client.DownloadArchive(context.Background(), boxPath.BoxID, boxPath.Path)
 	if err != nil {
-		return fmt.Errorf("failed to download from box: %v", err)
-	}
-	defer resp.Body.Close()
-
-	debug(fmt.Sprintf("HTTP response status code: %d", resp.StatusCode))
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download from box, HTTP status code: %d", resp.StatusCode)
+		return err
 	}
+	defer body.Close()
 
-	_, err = io.Copy(os.Stdout, resp.Body)
+	reader, finish := c.withProgress(body, "Downloading", size)
+	_, err = io.Copy(os.Stdout, reader)
+	finish()
 	if err != nil {
 		return fmt.Errorf("failed to write to stdout: %v", err)
 	}
@@ -161,111 +231,57 @@ func copyFromBoxToStdout(boxPath *BoxPath, apiURL string, debug func(string)) er
 	return nil
 }
 
-func copyFromBoxToFile(boxPath *BoxPath, dst, apiURL string, debug func(string)) error {
-	// Convert local path to absolute path
+func (c *boxCopier) copyFromBoxToFile(boxPath *BoxPath, dst string) error {
+	// Convert local path to absolute path, keeping a trailing separator
+	trailingSep := strings.HasSuffix(dst, "/") || strings.HasSuffix(dst, string(os.PathSeparator))
 	dst = getAbsolutePath(dst)
-
-	// Create destination directory if it doesn't exist
-	err := os.MkdirAll(filepath.Dir(dst), 0755)
-	if err != nil {
-		return fmt.Errorf("failed to create destination directory: %v", err)
+	if trailingSep {
+		dst += string(os.PathSeparator)
 	}
 
-	// Download to temporary file
-	tempFile, err := os.CreateTemp("", "gbox-cp-")
+	srcBase := boxArchiveBaseName(boxPath.Path)
+	dstDir, rename, err := localExtractTarget(dst, srcBase)
 	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %v", err)
+		return err
 	}
-	tempFilePath := tempFile.Name()
-	defer os.Remove(tempFilePath)
-
-	requestURL := fmt.Sprintf("%s/boxes/%s/archive?path=%s", apiURL, boxPath.BoxID, boxPath.Path)
-	debug(fmt.Sprintf("Sending GET request to: %s", requestURL))
+	c.debug(fmt.Sprintf("Extracting into %s (rename %q -> %q)", dstDir, srcBase, rename))
 
-	resp, err := http.Get(requestURL)
+	body, size, err := client.DownloadArchive(context.Background(), boxPath.BoxID, boxPath.Path)
 	if err != nil {
-		return fmt.Errorf("failed to download from box: %v", err)
-	}
-	defer resp.Body.Close()
-
-	debug(fmt.Sprintf("HTTP response status code: %d", resp.StatusCode))
-
-	if resp.StatusCode != http.StatusOK {
-		// It's helpful to read the body even on error for more details
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		debug(fmt.Sprintf("Error response body: %s", string(bodyBytes)))
-		return fmt.Errorf("failed to download from box, HTTP status code: %d", resp.StatusCode)
-	}
-
-	bytesCopied, copyErr := io.Copy(tempFile, resp.Body)
-	debug(fmt.Sprintf("Bytes copied to temporary file: %d", bytesCopied))
-
-	// Ensure file is closed regardless of copy errors
-	defer tempFile.Close() // Close should happen after potential errors are checked
-
-	// Handle errors after attempting copy and close
-	if copyErr != nil {
-		// Check if the error is specifically UnexpectedEOF, likely from the reader (resp.Body)
-		if copyErr == io.ErrUnexpectedEOF {
-			return fmt.Errorf("failed to download complete file from box (unexpected EOF): %v", copyErr)
-		}
-		// Otherwise, report it as a failure to write to the temp file
-		return fmt.Errorf("failed to write to temporary file: %v", copyErr)
+		return err
 	}
+	defer body.Close()
 
-	// Check format and extract
-	dstDir := filepath.Dir(dst)
-	srcBaseName := filepath.Base(boxPath.Path)
-	dstBaseName := filepath.Base(dst)
-
-	// Try to extract as gzip tar
-	cmd := exec.Command("tar", "-xzf", tempFilePath, "-C", dstDir)
-	output, err := cmd.CombinedOutput()
+	// Extract while downloading, no temporary file
+	reader, finish := c.withProgress(body, "Downloading", size)
+	count, err := extractTarArchive(reader, dstDir, srcBase, rename, c.tarOpts)
+	finish()
 	if err != nil {
-		// Try to extract as regular tar
-		cmd = exec.Command("tar", "-xf", tempFilePath, "-C", dstDir)
-		output, err = cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("failed to extract archive: %v\nOutput:\n%s", err, string(output))
+		if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to download complete archive from box (unexpected EOF): %v", err)
 		}
+		return fmt.Errorf("failed to extract archive: %v", err)
 	}
+	c.debug(fmt.Sprintf("Extracted %d entries", count))
 
-	// After extraction, check if the destination path `dst` was intended to be a file or directory.
-	// If `dst` does not end with a separator, assume it was a file.
-	extractedPath := filepath.Join(dstDir, srcBaseName) // Default expected path after extraction
-	finalDstPath := dst
-
-	// Smarter check: Did the tar command create the exact dstBaseName in dstDir?
-	// Or did it potentially create srcBaseName or a path structure?
-	// Let's check if the srcBaseName exists first
-	if _, statErr := os.Stat(extractedPath); statErr == nil {
-		// If the original dst path didn't end with '/' and is different from the extracted path,
-		// it implies the user wanted to copy INTO a file named dstBaseName.
-		if !strings.HasSuffix(dst, string(os.PathSeparator)) && dstBaseName != srcBaseName {
-			if renameErr := os.Rename(extractedPath, finalDstPath); renameErr != nil {
-				return fmt.Errorf("failed to rename extracted file to destination: %v", renameErr)
-			}
-		} else if dstBaseName == srcBaseName {
-			// If dst and src base names match, extraction likely overwrote/created the correct file/dir.
-		} else {
-			// Destination was likely a directory, files extracted inside.
-			finalDstPath = extractedPath // The message should report the actual extracted path
-		}
-	} else {
-		// If srcBaseName doesn't exist directly, maybe tar extracted with full path?
-		// This case is harder to handle reliably without knowing archive structure.
-		// We will assume for now the extraction target was dstDir and tar placed files inside.
-		// The user might need to check dstDir content.
-		// We can try to list files extracted by tar output parsing, but it's complex.
-		// We cannot be sure what the final path is, report the directory
-		finalDstPath = dstDir
+	finalDstPath := filepath.Join(dstDir, srcBase)
+	if rename != "" {
+		finalDstPath = filepath.Join(dstDir, rename)
 	}
-
 	fmt.Fprintf(os.Stderr, "Copied from box %s:%s to %s\n", boxPath.BoxID, boxPath.Path, finalDstPath)
 	return nil
 }
 
-func copyFromLocalToBox(src, dst, apiURL string, debug func(string)) error {
+// boxArchiveBaseName returns the name of the top-level entry the archive endpoint
+// produces for a box path, or empty string for a contents-only ("/.") copy
+func boxArchiveBaseName(boxPath string) string {
+	if strings.HasSuffix(boxPath, "/.") {
+		return ""
+	}
+	return path.Base(path.Clean(boxPath))
+}
+
+func (c *boxCopier) copyFromLocalToBox(src, dst string) error {
 	boxPath, err := parseBoxPath(dst)
 	if err != nil {
 		return err
@@ -273,99 +289,96 @@ func copyFromLocalToBox(src, dst, apiURL string, debug func(string)) error {
 
 	if src == "-" {
 		// Copy tar stream from stdin to box
-		return copyFromStdinToBox(boxPath, apiURL, debug)
-	} else {
-		// Copy from local file to box
-		return copyFromFileToBox(src, boxPath, apiURL, debug)
+		return c.copyFromStdinToBox(boxPath)
 	}
+	// Copy from local file to box
+	return c.copyFromFileToBox(src, boxPath)
 }
 
-func copyFromStdinToBox(boxPath *BoxPath, apiURL string, debug func(string)) error {
-	requestURL := fmt.Sprintf("%s/boxes/%s/archive?path=%s", apiURL, boxPath.BoxID, boxPath.Path)
-	debug(fmt.Sprintf("Sending PUT request to: %s", requestURL))
-
-	req, err := http.NewRequest("PUT", requestURL, os.Stdin)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/x-tar")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (c *boxCopier) copyFromStdinToBox(boxPath *BoxPath) error {
+	reader, finish := c.withProgress(os.Stdin, "Uploading", -1)
+	err := client.UploadArchive(context.Background(), boxPath.BoxID, boxPath.Path, reader)
+	finish()
 	if err != nil {
-		return fmt.Errorf("failed to upload to box: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to upload to box, HTTP status code: %d", resp.StatusCode)
+		return err
 	}
 
 	fmt.Fprintf(os.Stderr, "Copied from stdin to box %s:%s\n", boxPath.BoxID, boxPath.Path)
 	return nil
 }
 
-func copyFromFileToBox(src string, boxPath *BoxPath, apiURL string, _ func(string)) error {
-	// Convert local path to absolute path
+func (c *boxCopier) copyFromFileToBox(src string, boxPath *BoxPath) error {
+	// Convert local path to absolute path, keeping a "/." contents-only suffix
+	contentsOnly := strings.HasSuffix(src, string(os.PathSeparator)+".")
 	src = getAbsolutePath(src)
+	if contentsOnly {
+		src += string(os.PathSeparator) + "."
+	}
 
 	// Check if source file exists
-	if _, err := os.Stat(src); os.IsNotExist(err) {
+	if _, err := os.Lstat(src); os.IsNotExist(err) {
 		return fmt.Errorf("source file or directory does not exist: %s", src)
 	}
 
-	// Create temporary file for the tar
-	tempFile, err := os.CreateTemp("", "gbox-cp-")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %v", err)
-	}
-	tempFilePath := tempFile.Name()
-	tempFile.Close()
-	defer os.Remove(tempFilePath)
+	_, srcName := splitSourcePath(src)
+	dstDir, rename := c.boxUploadTarget(boxPath, srcName)
+	c.debug(fmt.Sprintf("Uploading into %s (rename %q -> %q)", dstDir, srcName, rename))
 
-	// Create tar archive
-	cmd := exec.Command("tar", "--no-xattrs", "-czf", tempFilePath, "-C", filepath.Dir(src), filepath.Base(src))
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("failed to create tar archive: %v", err)
-	}
+	// Stream the archive straight into the request body
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTarArchive(pw, src, rename, c.tarOpts))
+	}()
 
-	// Get file size
-	fileInfo, err := os.Stat(tempFilePath)
+	reader, finish := c.withProgress(pr, "Uploading", localArchiveSize(src, c.tarOpts))
+	err := client.UploadArchive(context.Background(), boxPath.BoxID, dstDir, reader)
+	finish()
+	pr.Close()
 	if err != nil {
-		return fmt.Errorf("failed to get temporary file info: %v", err)
+		return err
 	}
-	fileSize := fileInfo.Size()
 
-	// Upload archive to box
-	file, err := os.Open(tempFilePath)
+	fmt.Fprintf(os.Stderr, "Copied from %s to box %s:%s\n", src, boxPath.BoxID, boxPath.Path)
+	return nil
+}
+
+func (c *boxCopier) copyFromBoxToBox(src, dst string) error {
+	srcPath, err := parseBoxPath(src)
 	if err != nil {
-		return fmt.Errorf("failed to open temporary file: %v", err)
+		return err
 	}
-	defer file.Close()
-
-	requestURL := fmt.Sprintf("%s/boxes/%s/archive?path=%s", apiURL, boxPath.BoxID, boxPath.Path)
-
-	req, err := http.NewRequest("PUT", requestURL, file)
+	dstPath, err := parseBoxPath(dst)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/x-tar")
-	req.Header.Set("Content-Length", fmt.Sprintf("%d", fileSize))
+	srcBase := boxArchiveBaseName(srcPath.Path)
+	dstDir, rename := c.boxUploadTarget(dstPath, srcBase)
+	c.debug(fmt.Sprintf("Copying %s:%s into %s:%s (rename %q -> %q)", srcPath.BoxID, srcPath.Path, dstPath.BoxID, dstDir, srcBase, rename))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	body, size, err := client.DownloadArchive(context.Background(), srcPath.BoxID, srcPath.Path)
 	if err != nil {
-		return fmt.Errorf("failed to upload to box: %v", err)
+		return err
+	}
+	defer body.Close()
+
+	reader, finish := c.withProgress(body, "Copying", size)
+	var archive io.Reader = reader
+	if rename != "" {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(renameTarStream(pw, reader, srcBase, rename))
+		}()
+		defer pr.Close()
+		archive = pr
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to upload to box, HTTP status code: %d", resp.StatusCode)
+	err = client.UploadArchive(context.Background(), dstPath.BoxID, dstDir, archive)
+	finish()
+	if err != nil {
+		return err
 	}
 
-	fmt.Fprintf(os.Stderr, "Copied from %s to box %s:%s\n", src, boxPath.BoxID, boxPath.Path)
+	fmt.Fprintf(os.Stderr, "Copied from box %s:%s to box %s:%s\n", srcPath.BoxID, srcPath.Path, dstPath.BoxID, dstPath.Path)
 	return nil
 }
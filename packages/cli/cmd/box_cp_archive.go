@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// tarOptions controls how archives are created and extracted, mirroring `docker cp`
+type tarOptions struct {
+	FollowLink bool // Follow a symlink given as the source path
+	Archive    bool // Preserve uid/gid ownership
+}
+
+// splitSourcePath returns the directory to archive and the name of the top-level
+// entry in the archive. A source ending in "/." copies the directory contents
+// only, which is reported as an empty name.
+func splitSourcePath(src string) (dir, name string) {
+	if strings.HasSuffix(src, string(os.PathSeparator)+".") || src == "." {
+		return filepath.Clean(src), ""
+	}
+	cleaned := filepath.Clean(src)
+	return cleaned, filepath.Base(cleaned)
+}
+
+// localArchiveSize returns the total size of regular files under src, used for progress
+func localArchiveSize(src string, opts tarOptions) int64 {
+	root, err := resolveSourceRoot(src, opts)
+	if err != nil {
+		return -1
+	}
+	var total int64
+	filepath.Walk(root, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// resolveSourceRoot resolves the source path, following a symlink root if requested
+func resolveSourceRoot(src string, opts tarOptions) (string, error) {
+	root, _ := splitSourcePath(src)
+	if opts.FollowLink {
+		resolved, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return "", fmt.Errorf("failed to follow link %s: %v", src, err)
+		}
+		return resolved, nil
+	}
+	return root, nil
+}
+
+// writeTarArchive streams src (file or directory) as a tar archive to w.
+// Entries are rooted at rename if set, otherwise at the base name of src.
+func writeTarArchive(w io.Writer, src, rename string, opts tarOptions) error {
+	root, err := resolveSourceRoot(src, opts)
+	if err != nil {
+		return err
+	}
+	_, name := splitSourcePath(src)
+	if rename != "" && name != "" {
+		name = rename
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entryName := path.Join(name, filepath.ToSlash(rel))
+		if entryName == "." || entryName == "" {
+			// Contents-only copy: the root directory itself is not archived
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = entryName
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if !opts.Archive {
+			hdr.Uid, hdr.Gid = 0, 0
+			hdr.Uname, hdr.Gname = "", ""
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tar archive: %v", err)
+	}
+	return tw.Close()
+}
+
+// maybeGunzip transparently decompresses gzip-compressed archives
+func maybeGunzip(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// localExtractTarget works out where an archive whose top-level entry is srcBase
+// should be extracted for a local destination, following `docker cp` rules:
+// an existing directory (or a path ending in a separator) receives the entry
+// as-is, otherwise the entry is renamed to the destination's base name.
+func localExtractTarget(dst, srcBase string) (dir, rename string, err error) {
+	info, statErr := os.Stat(dst)
+	switch {
+	case statErr == nil && info.IsDir():
+		return dst, "", nil
+	case statErr == nil:
+		return filepath.Dir(dst), filepath.Base(dst), nil
+	case !os.IsNotExist(statErr):
+		return "", "", statErr
+	case strings.HasSuffix(dst, string(os.PathSeparator)):
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return "", "", fmt.Errorf("failed to create destination directory: %v", err)
+		}
+		return dst, "", nil
+	default:
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return "", "", fmt.Errorf("failed to create destination directory: %v", err)
+		}
+		if srcBase == "" {
+			// Contents-only copy into a new directory
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return "", "", fmt.Errorf("failed to create destination directory: %v", err)
+			}
+			return dst, "", nil
+		}
+		return filepath.Dir(dst), filepath.Base(dst), nil
+	}
+}
+
+// renameTopLevel replaces the first path component of name if it equals from
+func renameTopLevel(name, from, to string) string {
+	if to == "" || from == "" {
+		return name
+	}
+	name = strings.TrimPrefix(name, "./")
+	first, rest, hasRest := strings.Cut(name, "/")
+	if first != from {
+		return name
+	}
+	if !hasRest {
+		return to
+	}
+	return to + "/" + rest
+}
+
+// extractTarArchive extracts a (possibly gzipped) tar stream into dir, renaming
+// the top-level entry srcBase to rename when set. Returns the number of entries.
+func extractTarArchive(r io.Reader, dir, srcBase, rename string, opts tarOptions) (int, error) {
+	r, err := maybeGunzip(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read archive: %v", err)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	// Entries are checked against the real destination, dir may be a symlink
+	if resolved, err := filepath.EvalSymlinks(absDir); err == nil {
+		absDir = resolved
+	}
+
+	tr := tar.NewReader(r)
+	count := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read archive: %v", err)
+		}
+
+		name := renameTopLevel(hdr.Name, srcBase, rename)
+		target, err := safeJoin(absDir, name)
+		if err != nil {
+			return count, err
+		}
+
+		// An earlier symlink entry at target is replaced, not written through
+		if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return count, err
+			}
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return count, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return count, err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return count, err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return count, err
+			}
+			if err := f.Close(); err != nil {
+				return count, err
+			}
+		case tar.TypeSymlink:
+			// Links are kept as they are like docker cp does, even absolute
+			// ones; safeJoin refuses entries written through them
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return count, err
+			}
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return count, err
+			}
+		case tar.TypeLink:
+			linkTarget, err := safeJoin(absDir, renameTopLevel(hdr.Linkname, srcBase, rename))
+			if err != nil {
+				return count, err
+			}
+			os.Remove(target)
+			if err := os.Link(linkTarget, target); err != nil {
+				return count, err
+			}
+		default:
+			// Devices, fifos etc. are skipped like a non-root docker cp would
+			continue
+		}
+
+		if opts.Archive {
+			// Best effort: only root can give files away
+			if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil && !os.IsPermission(err) {
+				return count, err
+			}
+		}
+		if hdr.Typeflag != tar.TypeSymlink {
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+		count++
+	}
+}
+
+// safeJoin joins name onto dir and rejects entries escaping dir, by name or
+// through a symlink extracted earlier. dir must not contain symlinks.
+func safeJoin(dir, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !pathInside(dir, target) {
+		return "", fmt.Errorf("archive entry %q escapes destination directory", name)
+	}
+
+	// The nearest existing parent is where the entry really lands
+	for parent := filepath.Dir(target); ; parent = filepath.Dir(parent) {
+		resolved, err := filepath.EvalSymlinks(parent)
+		if err == nil {
+			if !pathInside(dir, resolved) {
+				return "", fmt.Errorf("archive entry %q escapes destination directory through a symlink", name)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if parent == dir {
+			break
+		}
+	}
+	return target, nil
+}
+
+// pathInside reports whether the clean path p is dir or below it
+func pathInside(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(os.PathSeparator))
+}
+
+// renameTarStream copies a (possibly gzipped) tar stream from r to w as a plain
+// tar stream, renaming the top-level entry from to to
+func renameTarStream(w io.Writer, r io.Reader, from, to string) error {
+	r, err := maybeGunzip(r)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %v", err)
+	}
+
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return tw.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %v", err)
+		}
+		hdr.Name = renameTopLevel(hdr.Name, from, to)
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = renameTopLevel(hdr.Linkname, from, to)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"archive/tar"
 	"bytes"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Test parsing box path functionality
@@ -447,3 +449,157 @@ func TestBoxCpInvalidPathCombination(t *testing.T) {
 	assert.True(t, strings.Contains(combined, "Error") || strings.Contains(combined, "Invalid path format"),
 		"Should display error message")
 }
+
+// Test tar archive round trip with docker cp style renaming
+func TestTarArchiveRoundTrip(t *testing.T) {
+	srcRoot := t.TempDir()
+	srcDir := filepath.Join(srcRoot, "logs")
+	assert.NoError(t, os.MkdirAll(filepath.Join(srcDir, "nested"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(srcDir, "nested", "b.txt"), []byte("bb"), 0600))
+	assert.NoError(t, os.Symlink("a.txt", filepath.Join(srcDir, "link")))
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeTarArchive(&buf, srcDir, "", tarOptions{}))
+	assert.Equal(t, int64(3), localArchiveSize(srcDir, tarOptions{}))
+
+	// Destination does not exist: the directory is renamed
+	dstRoot := t.TempDir()
+	dst := filepath.Join(dstRoot, "copy")
+	dir, rename, err := localExtractTarget(dst, "logs")
+	assert.NoError(t, err)
+	assert.Equal(t, dstRoot, dir)
+	assert.Equal(t, "copy", rename)
+
+	_, err = extractTarArchive(bytes.NewReader(buf.Bytes()), dir, "logs", rename, tarOptions{})
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(dst, "nested", "b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "bb", string(content))
+	info, err := os.Stat(filepath.Join(dst, "nested", "b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	link, err := os.Readlink(filepath.Join(dst, "link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a.txt", link)
+
+	// Destination is an existing directory: the source is placed inside it
+	dir, rename, err = localExtractTarget(dstRoot, "logs")
+	assert.NoError(t, err)
+	assert.Equal(t, dstRoot, dir)
+	assert.Equal(t, "", rename)
+}
+
+// Test copying directory contents only with a "/." suffix
+func TestTarArchiveContentsOnly(t *testing.T) {
+	srcDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0644))
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeTarArchive(&buf, srcDir+string(os.PathSeparator)+".", "", tarOptions{}))
+
+	dst := t.TempDir()
+	_, err := extractTarArchive(&buf, dst, "", "", tarOptions{})
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dst, "a.txt"))
+	assert.NoError(t, err)
+}
+
+// Test that archive entries cannot escape the destination directory
+func TestExtractTarArchiveRejectsTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: 1, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("x"))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+
+	_, err = extractTarArchive(&buf, t.TempDir(), "", "", tarOptions{})
+	assert.Error(t, err)
+}
+
+// Test that symlink entries cannot be used to write outside the destination
+func TestExtractTarArchiveRejectsSymlinkTraversal(t *testing.T) {
+	archive := func(headers ...*tar.Header) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range headers {
+			require.NoError(t, tw.WriteHeader(hdr))
+			if hdr.Typeflag == tar.TypeReg {
+				_, err := tw.Write([]byte("x"))
+				require.NoError(t, err)
+			}
+		}
+		require.NoError(t, tw.Close())
+		return &buf
+	}
+	evil := &tar.Header{Name: "link/evil", Mode: 0644, Size: 1, Typeflag: tar.TypeReg}
+
+	for _, linkname := range []string{"../outside", "", "/"} {
+		root := t.TempDir()
+		dst, outside := filepath.Join(root, "dst"), filepath.Join(root, "outside")
+		require.NoError(t, os.Mkdir(dst, 0755))
+		require.NoError(t, os.Mkdir(outside, 0755))
+		if linkname == "" {
+			linkname = outside
+		}
+
+		// The symlink is kept as it is, writing through it is refused
+		_, err := extractTarArchive(archive(
+			&tar.Header{Name: "link", Linkname: linkname, Typeflag: tar.TypeSymlink},
+			evil,
+		), dst, "", "", tarOptions{})
+		assert.ErrorContains(t, err, "escapes destination directory", linkname)
+		_, err = os.Stat(filepath.Join(outside, "evil"))
+		assert.True(t, os.IsNotExist(err), linkname)
+		got, err := os.Readlink(filepath.Join(dst, "link"))
+		require.NoError(t, err)
+		assert.Equal(t, linkname, got)
+	}
+
+	// Absolute links of a root filesystem are kept like docker cp does
+	dst := t.TempDir()
+	_, err := extractTarArchive(archive(
+		&tar.Header{Name: "rootfs/bin", Linkname: "/usr/bin", Typeflag: tar.TypeSymlink},
+		&tar.Header{Name: "rootfs/usr/bin/sh", Mode: 0755, Size: 1, Typeflag: tar.TypeReg},
+	), dst, "", "", tarOptions{})
+	require.NoError(t, err)
+	got, err := os.Readlink(filepath.Join(dst, "rootfs", "bin"))
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin", got)
+
+	// Each link stays inside on its own, together they point above dst
+	root := t.TempDir()
+	dst = filepath.Join(root, "dst")
+	require.NoError(t, os.Mkdir(dst, 0755))
+	_, err = extractTarArchive(archive(
+		&tar.Header{Name: "self", Linkname: ".", Typeflag: tar.TypeSymlink},
+		&tar.Header{Name: "link", Linkname: "self/..", Typeflag: tar.TypeSymlink},
+		evil,
+	), dst, "", "", tarOptions{})
+	assert.ErrorContains(t, err, "escapes destination directory")
+	_, err = os.Stat(filepath.Join(root, "evil"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Links inside the destination are kept
+	dst = t.TempDir()
+	_, err = extractTarArchive(archive(
+		&tar.Header{Name: "dir/", Mode: 0755, Typeflag: tar.TypeDir},
+		&tar.Header{Name: "link", Linkname: "dir", Typeflag: tar.TypeSymlink},
+		evil,
+	), dst, "", "", tarOptions{})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dst, "dir", "evil"))
+	assert.NoError(t, err)
+}
+
+// Test renaming of the top-level archive entry
+func TestRenameTopLevel(t *testing.T) {
+	assert.Equal(t, "dst", renameTopLevel("src", "src", "dst"))
+	assert.Equal(t, "dst/a/b", renameTopLevel("./src/a/b", "src", "dst"))
+	assert.Equal(t, "other/a", renameTopLevel("other/a", "src", "dst"))
+	assert.Equal(t, "src/a", renameTopLevel("src/a", "src", ""))
+	assert.Equal(t, "logs", boxArchiveBaseName("/var/logs/"))
+	assert.Equal(t, "", boxArchiveBaseName("/var/logs/."))
+}
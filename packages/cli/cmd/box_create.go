@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
 	"github.com/spf13/cobra"
 )
 
@@ -51,3 +53,22 @@ Use 'gbox box create <type> --help' for more information about each type.`,
 	)
 	return cmd
 }
+
+// defaultBoxLabels returns the label defaults of the current profile and project
+// as KEY=VALUE pairs placed before labels, so labels given by flags win
+func defaultBoxLabels(defaults profile.BoxDefaults, labels []string) []string {
+	if len(defaults.Labels) == 0 {
+		return labels
+	}
+	keys := make([]string, 0, len(defaults.Labels))
+	for k := range defaults.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	merged := make([]string, 0, len(keys)+len(labels))
+	for _, k := range keys {
+		merged = append(merged, k+"="+defaults.Labels[k])
+	}
+	return append(merged, labels...)
+}
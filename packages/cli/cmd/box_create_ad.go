@@ -6,6 +6,7 @@ import (
 	"time"
 
 	client "github.com/babelcloud/gbox/packages/cli/internal/client"
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
 	"github.com/spf13/cobra"
 )
 
@@ -26,13 +27,25 @@ func NewBoxCreateAndroidCommand() *cobra.Command {
 		Long: `Create a new Android box with various options for device type, environment, and labels.
 
 You can specify Android box configurations through various flags, including device type (virtual or physical),
-setting environment variables, adding labels, and setting expiration time.`,
+setting environment variables, adding labels, and setting expiration time.
+
+Defaults for device type, expiration time and labels can be set per profile with
+'gbox profile defaults' and per project in the [box] section of .gbox.toml.`,
 		Example: `  gbox box create android --device-type virtual
   gbox box create android --device-type physical --expires-in 2h
   gbox box create android --env DEBUG=true --label project=myapp
   gbox box create android --device-type virtual --expires-in 30m --label env=test`,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// Apply defaults of the current profile and project file unless set by flags
+			defaults := profile.Default.GetBoxDefaults()
+			if defaults.DeviceType != "" && !cmd.Flags().Changed("device-type") {
+				opts.DeviceType = defaults.DeviceType
+			}
+			if defaults.ExpiresIn != "" && !cmd.Flags().Changed("expires-in") {
+				opts.ExpiresIn = defaults.ExpiresIn
+			}
+			opts.Labels = defaultBoxLabels(defaults, opts.Labels)
 			return runAndroidCreate(opts)
 		},
 		DisableFlagsInUseLine: true,
@@ -10,6 +10,7 @@ import (
 
 type BoxCreateFromDeviceOptions struct {
 	DeviceID     string
+	Selector     string
 	Force        bool
 	OutputFormat string
 }
@@ -30,6 +31,9 @@ If force is true, any existing box using the device will be terminated.`,
   # Create a box and force terminate any existing box
   gbox box create from-device <device-id> --force
 
+  # Create a box from any free registered device labeled team=qa
+  gbox box create from-device --selector team=qa
+
   # Output in JSON format
   gbox box create from-device <device-id> --output json`,
 		Args: cobra.MaximumNArgs(1),
@@ -43,6 +47,7 @@ If force is true, any existing box using the device will be terminated.`,
 
 	flags := cmd.Flags()
 	flags.StringVarP(&opts.DeviceID, "device-id", "d", "", "Device ID to create box from")
+	addSelectorFlag(cmd, &opts.Selector, "Create the box from any free registered device matching a label selector such as team=qa")
 	flags.BoolVarP(&opts.Force, "force", "f", true, "Force create box even if device is occupied")
 	flags.StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (json or text)")
 
@@ -54,8 +59,15 @@ If force is true, any existing box using the device will be terminated.`,
 }
 
 func ExecuteBoxCreateFromDevice(cmd *cobra.Command, opts *BoxCreateFromDeviceOptions) error {
+	if opts.DeviceID == "" && opts.Selector != "" {
+		picked, err := pickDevice(opts.Selector, func(d DeviceDTO) bool { return d.IsRegistered && d.ID != "" })
+		if err != nil {
+			return err
+		}
+		opts.DeviceID = picked.ID
+	}
 	if opts.DeviceID == "" {
-		return fmt.Errorf("device ID is required. Use --device-id or provide as argument")
+		return fmt.Errorf("device ID is required. Use --device-id, --selector or provide as argument")
 	}
 
 	deviceAPI := cloud.NewDeviceAPI()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	client "github.com/babelcloud/gbox/packages/cli/internal/client"
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +31,8 @@ Command arguments can be specified directly in the command line or added after t
   gbox box create linux --label project=myapp --label env=prod`,
 		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// Apply label defaults of the current profile and project file
+			opts.Labels = defaultBoxLabels(profile.Default.GetBoxDefaults(), opts.Labels)
 			return runLinuxCreate(opts)
 		},
 		DisableFlagsInUseLine: true,
@@ -7,8 +7,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 
+	client "github.com/babelcloud/gbox/packages/cli/internal/client"
 	"github.com/babelcloud/gbox/packages/cli/internal/profile"
 	"github.com/gorilla/websocket"
 	"github.com/spf13/cobra"
@@ -22,6 +26,24 @@ type BoxExecOptions struct {
 	BoxID       string
 	Command     []string
 	WorkingDir  string
+	Env         []string
+	Batch       BatchOptions
+}
+
+// ExitError is returned when a remote command exits with a non-zero code.
+// main uses it to exit the CLI with the same code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.Code)
+}
+
+// terminalSize is sent in the init payload and in resize events
+type terminalSize struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
 }
 
 // NewBoxExecCommand creates a new box exec command
@@ -29,9 +51,9 @@ func NewBoxExecCommand() *cobra.Command {
 	opts := &BoxExecOptions{}
 
 	cmd := &cobra.Command{
-		Use:   "exec [box-id] -- [command] [args...]",
+		Use:   "exec [box-id | --selector KEY=VALUE] -- [command] [args...]",
 		Short: "Execute a command in a box",
-		Long: `usage: gbox-box-exec [-h] [-i] [-t] box_id
+		Long: `usage: gbox-box-exec [-h] [-i] [-t] [-e KEY=VALUE] [-l SELECTOR] box_id
 
 Execute a command in a box
 
@@ -41,16 +63,43 @@ positional arguments:
 options:
   -h, --help         show this help message and exit
   -i, --interactive  Enable interactive mode (with stdin)
-  -t, --tty          Force TTY allocation`,
+  -t, --tty          Force TTY allocation
+  -e, --env          Set environment variables (KEY=VALUE, or KEY to pass the local value)
+  -l, --selector     Run the command on all running boxes matching a label selector
+  -p, --parallel     Maximum number of boxes to run on concurrently (default 8)
+      --summary      Emit a json or junit summary of the results
+      --summary-file Write the summary to a file instead of stdout
+
+The exit code of the remote command is used as the exit code of gbox. With
+--selector the output of each box is prefixed with its ID and the highest exit
+code of all boxes is used.`,
 		Example: `    gbox box exec 550e8400-e29b-41d4-a716-446655440000 -- ls -l     # List files in box
     gbox box exec 550e8400-e29b-41d4-a716-446655440000 -t -- bash     # Run interactive bash
-    gbox box exec 550e8400-e29b-41d4-a716-446655440000 -i -- cat       # Run cat with stdin`,
+    gbox box exec 550e8400-e29b-41d4-a716-446655440000 -i -- cat       # Run cat with stdin
+    gbox box exec 550e8400-e29b-41d4-a716-446655440000 -e DEBUG=1 -- env     # Run with environment variables
+    gbox box exec --selector env=test -- uname -a                     # Run on all boxes labeled env=test
+    gbox box exec -l env=test --summary junit --summary-file report.xml -- ./run-tests.sh`,
+		// A non-zero exit of the remote command becomes the exit code of
+		// gbox, it is not an error to report with usage
+		SilenceUsage:  true,
+		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			argsLenAtDash := cmd.ArgsLenAtDash()
 			if argsLenAtDash == -1 {
 				return fmt.Errorf("command must be specified after '--'")
 			}
 
+			if opts.Batch.Selector != "" {
+				if argsLenAtDash > 0 {
+					return fmt.Errorf("cannot specify both --selector and a box ID")
+				}
+				if argsLenAtDash >= len(args) {
+					return fmt.Errorf("command must be specified after '--'")
+				}
+				opts.Command = args[argsLenAtDash:]
+				return runExecSelector(opts)
+			}
+
 			if len(args) == 0 || argsLenAtDash == 0 {
 				cmd.Help()
 				return fmt.Errorf("box ID is required")
@@ -82,6 +131,8 @@ options:
 	cmd.Flags().BoolVarP(&opts.Interactive, "interactive", "i", false, "Enable interactive mode (with stdin)")
 	cmd.Flags().BoolVarP(&opts.Tty, "tty", "t", false, "Force TTY allocation")
 	cmd.Flags().StringVarP(&opts.WorkingDir, "workdir", "w", "", "Working directory inside the container")
+	cmd.Flags().StringArrayVarP(&opts.Env, "env", "e", nil, "Set environment variables (KEY=VALUE, or KEY to pass the local value)")
+	addBatchFlags(cmd, &opts.Batch)
 
 	return cmd
 }
@@ -97,6 +148,58 @@ func runExec(opts *BoxExecOptions) error {
 	return runExecWebSocket(opts, resolvedBoxID)
 }
 
+// runExecSelector runs a non-interactive command on all running boxes matching
+// the selector, prefixing the output of each box with its ID
+func runExecSelector(opts *BoxExecOptions) error {
+	if err := opts.Batch.validate(); err != nil {
+		return err
+	}
+	if opts.Interactive || opts.Tty {
+		return fmt.Errorf("--interactive and --tty cannot be used with --selector")
+	}
+	envs, err := parseExecEnv(opts.Env)
+	if err != nil {
+		return err
+	}
+
+	sdkClient, err := client.NewClientFromProfile()
+	if err != nil {
+		return fmt.Errorf("failed to initialize gbox client: %v", err)
+	}
+
+	ids, err := selectBoxes(sdkClient, opts.Batch.Selector, "running")
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		fmt.Fprintf(os.Stderr, "No running boxes match selector %s\n", opts.Batch.Selector)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Running on %d boxes\n", len(ids))
+
+	results := forEachBox(ids, opts.Batch.Parallel, func(boxID string) boxResult {
+		resp, err := client.ExecCommand(sdkClient, boxID, opts.Command, envs, opts.WorkingDir)
+		if err != nil {
+			return boxResult{Error: err.Error()}
+		}
+		return boxResult{ExitCode: int(resp.ExitCode), Stdout: resp.Stdout, Stderr: resp.Stderr}
+	}, func(r boxResult) {
+		writePrefixed(os.Stdout, r.BoxID, r.Stdout)
+		writePrefixed(os.Stderr, r.BoxID, r.Stderr)
+		if r.Error != "" {
+			writePrefixed(os.Stderr, r.BoxID, "Error: "+r.Error)
+		}
+	})
+
+	if err := writeBatchSummary(&opts.Batch, "gbox box exec", results); err != nil {
+		return err
+	}
+	if code := aggregateExitCode(results); code != 0 {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
 // runExecWebSocket executes interactive commands through new WebSocket API
 func runExecWebSocket(opts *BoxExecOptions, resolvedBoxID string) error {
 	pm := profile.NewProfileManager()
@@ -136,20 +239,51 @@ func runExecWebSocket(opts *BoxExecOptions, resolvedBoxID string) error {
 		headers.Set("X-API-Key", apiKey)
 	}
 
+	envs, err := parseExecEnv(opts.Env)
+	if err != nil {
+		return err
+	}
+
 	conn, _, err := websocket.DefaultDialer.Dial(parsedURL.String(), headers)
 	if err != nil {
 		return fmt.Errorf("failed to connect websocket: %v", err)
 	}
 	defer conn.Close()
 
+	// gorilla/websocket supports a single concurrent writer; stdin, resize and
+	// signal forwarding all write, so serialize them
+	var writeMu sync.Mutex
+	writeMessage := func(msgType int, data []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteMessage(msgType, data)
+	}
+	writeEvent := func(evt map[string]interface{}) error {
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		return writeMessage(websocket.TextMessage, data)
+	}
+
 	// send initialization command
 	interactive := opts.Interactive || opts.Tty
+	command := map[string]interface{}{
+		"commands":    opts.Command,
+		"interactive": interactive,
+		"workingDir":  opts.WorkingDir,
+		"tty":         opts.Tty,
+	}
+	if len(envs) > 0 {
+		command["envs"] = envs
+	}
+	if opts.Tty {
+		if size, ok := getTerminalSize(); ok {
+			command["terminalSize"] = size
+		}
+	}
 	initPayload := map[string]interface{}{
-		"command": map[string]interface{}{
-			"commands":    opts.Command,
-			"interactive": interactive,
-			"workingDir":  opts.WorkingDir,
-		},
+		"command": command,
 	}
 	// TODO If workingDir is not exists, it should be created by the server.
 	if err := conn.WriteJSON(initPayload); err != nil {
@@ -165,9 +299,44 @@ func runExecWebSocket(opts *BoxExecOptions, resolvedBoxID string) error {
 		}
 		oldState = state
 		defer term.Restore(int(os.Stdin.Fd()), oldState)
+
+		// Keep the remote terminal size in sync with the local one
+		stopResize := watchTerminalResize(func(size terminalSize) {
+			writeEvent(map[string]interface{}{
+				"event": "resize",
+				"cols":  size.Cols,
+				"rows":  size.Rows,
+			})
+		})
+		defer stopResize()
+	} else {
+		// Without a TTY Ctrl-C does not reach the remote process as a byte, forward it as a signal.
+		// A second Ctrl-C gives up on the remote process and exits locally.
+		sigChan := make(chan os.Signal, 2)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigChan)
+		go func() {
+			forwarded := false
+			for sig := range sigChan {
+				if forwarded {
+					conn.Close()
+					return
+				}
+				name := "SIGINT"
+				if sig == syscall.SIGTERM {
+					name = "SIGTERM"
+				}
+				writeEvent(map[string]interface{}{
+					"event":  "signal",
+					"signal": name,
+				})
+				forwarded = true
+			}
+		}()
 	}
 
 	errChan := make(chan error, 2)
+	exitCode := 0
 	// read remote output
 	go func() {
 		for {
@@ -191,9 +360,10 @@ func runExecWebSocket(opts *BoxExecOptions, resolvedBoxID string) error {
 			case websocket.TextMessage:
 				// try to parse as JSON event
 				var evt struct {
-					Event   string `json:"event"`
-					Data    string `json:"data"`
-					Message string `json:"message"`
+					Event    string `json:"event"`
+					Data     string `json:"data"`
+					Message  string `json:"message"`
+					ExitCode *int   `json:"exitCode"`
 				}
 				if jsonErr := json.Unmarshal(data, &evt); jsonErr == nil && evt.Event != "" {
 					switch evt.Event {
@@ -202,6 +372,9 @@ func runExecWebSocket(opts *BoxExecOptions, resolvedBoxID string) error {
 					case "stderr":
 						os.Stderr.Write([]byte(evt.Data))
 					case "end":
+						if evt.ExitCode != nil {
+							exitCode = *evt.ExitCode
+						}
 						errChan <- io.EOF
 						return
 					case "error":
@@ -227,7 +400,7 @@ func runExecWebSocket(opts *BoxExecOptions, resolvedBoxID string) error {
 			for {
 				n, err := os.Stdin.Read(buffer)
 				if n > 0 {
-					if writeErr := conn.WriteMessage(websocket.BinaryMessage, buffer[:n]); writeErr != nil {
+					if writeErr := writeMessage(websocket.BinaryMessage, buffer[:n]); writeErr != nil {
 						if websocket.IsCloseError(writeErr,
 							websocket.CloseNormalClosure,
 							websocket.CloseGoingAway,
@@ -246,7 +419,7 @@ func runExecWebSocket(opts *BoxExecOptions, resolvedBoxID string) error {
 						errChan <- err
 					} else {
 						// normal EOF, send close frame
-						conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+						writeMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 					}
 					return
 				}
@@ -257,7 +430,43 @@ func runExecWebSocket(opts *BoxExecOptions, resolvedBoxID string) error {
 	// wait for any goroutine to finish
 	err = <-errChan
 	if err == io.EOF {
+		if exitCode != 0 {
+			return &ExitError{Code: exitCode}
+		}
 		return nil
 	}
 	return err
 }
+
+// parseExecEnv parses -e flags into a map. A bare KEY takes its value from the
+// local environment and is skipped when unset, like docker exec.
+func parseExecEnv(env []string) (map[string]string, error) {
+	if len(env) == 0 {
+		return nil, nil
+	}
+	envs := make(map[string]string, len(env))
+	for _, e := range env {
+		key, value, hasValue := strings.Cut(e, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid environment variable format: %s (must be KEY=VALUE or KEY)", e)
+		}
+		if !hasValue {
+			localValue, ok := os.LookupEnv(key)
+			if !ok {
+				continue
+			}
+			value = localValue
+		}
+		envs[key] = value
+	}
+	return envs, nil
+}
+
+// getTerminalSize returns the size of the local terminal attached to stdout
+func getTerminalSize() (terminalSize, bool) {
+	cols, rows, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return terminalSize{}, false
+	}
+	return terminalSize{Cols: cols, Rows: rows}, true
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test parsing -e flags
+func TestParseExecEnv(t *testing.T) {
+	t.Setenv("GBOX_TEST_LOCAL", "from-local")
+
+	envs, err := parseExecEnv([]string{"FOO=bar", "EMPTY=", "WITH=equals=sign", "GBOX_TEST_LOCAL", "GBOX_TEST_UNSET"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"FOO":             "bar",
+		"EMPTY":           "",
+		"WITH":            "equals=sign",
+		"GBOX_TEST_LOCAL": "from-local",
+	}, envs)
+
+	// No flags, no env map
+	envs, err = parseExecEnv(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, envs)
+
+	// Missing key
+	_, err = parseExecEnv([]string{"=value"})
+	assert.Error(t, err)
+}
+
+// Test exit code error formatting
+func TestExitError(t *testing.T) {
+	err := &ExitError{Code: 3}
+	assert.Equal(t, "command exited with code 3", err.Error())
+}
+
+// Test that a remote exit code is left to main instead of printed with usage
+func TestBoxExecSilencesExitError(t *testing.T) {
+	cmd := NewBoxExecCommand()
+	assert.True(t, cmd.SilenceUsage)
+	assert.True(t, cmd.SilenceErrors)
+	assert.True(t, rootCmd.SilenceErrors)
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchTerminalResize calls onResize whenever the local terminal receives SIGWINCH.
+// The returned function stops watching.
+func watchTerminalResize(onResize func(terminalSize)) func() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGWINCH)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sigChan:
+				if size, ok := getTerminalSize(); ok {
+					onResize(size)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package cmd
+
+import (
+	"time"
+)
+
+// watchTerminalResize polls the console size since Windows has no SIGWINCH.
+// The returned function stops watching.
+func watchTerminalResize(onResize func(terminalSize)) func() {
+	done := make(chan struct{})
+
+	go func() {
+		last, _ := getTerminalSize()
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if size, ok := getTerminalSize(); ok && size != last {
+					last = size
+					onResize(size)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -3,14 +3,20 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"sync"
 
+	sdk "github.com/babelcloud/gbox-sdk-go"
 	client "github.com/babelcloud/gbox/packages/cli/internal/client"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
 	"github.com/spf13/cobra"
 )
 
 type BoxInspectOptions struct {
-	OutputFormat string
+	Output output.Options
+	Batch  BatchOptions
 }
 
 func NewBoxInspectCommand() *cobra.Command {
@@ -19,27 +25,41 @@ func NewBoxInspectCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "inspect [box-id]",
 		Short: "Get detailed information about a box",
-		Long:  "Get detailed information about a box by its ID",
+		Long:  "Get detailed information about a box by its ID, or about all boxes matching a label selector",
 		Example: `  gbox box inspect 550e8400-e29b-41d4-a716-446655440000              # Get box details
-  gbox box inspect 550e8400-e29b-41d4-a716-446655440000 --output json  # Get box details in JSON format`,
-		Args: cobra.ExactArgs(1),
+  gbox box inspect 550e8400-e29b-41d4-a716-446655440000 --output json  # Get box details in JSON format
+  gbox box inspect 550e8400-e29b-41d4-a716-446655440000 -o yaml        # Get box details in YAML format
+  gbox box inspect 550e8400 -o go-template='{{.status}}'              # Print only the status
+  gbox box inspect --selector env=test --output json                   # Get details of all boxes labeled env=test`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if opts.Batch.Selector != "" {
+				if len(args) > 0 {
+					return fmt.Errorf("cannot specify both --selector and a box ID")
+				}
+				return nil
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Batch.Selector != "" {
+				return runInspectSelector(opts)
+			}
 			return runInspect(args[0], opts)
 		},
 		ValidArgsFunction: completeBoxIDs,
 	}
 
-	flags := cmd.Flags()
-	flags.StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (json or text)")
-
-	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"json", "text"}, cobra.ShellCompDirectiveNoFileComp
-	})
+	addOutputFlags(cmd, &opts.Output, false)
+	addBatchFlags(cmd, &opts.Batch)
 
 	return cmd
 }
 
 func runInspect(boxIDPrefix string, opts *BoxInspectOptions) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+
 	resolvedBoxID, _, err := ResolveBoxIDPrefix(boxIDPrefix) // Use the new helper
 	if err != nil {
 		return fmt.Errorf("failed to resolve box ID: %w", err) // Return error if resolution fails
@@ -62,71 +82,149 @@ func runInspect(boxIDPrefix string, opts *BoxInspectOptions) error {
 		return fmt.Errorf("failed to get box details: %v", err)
 	}
 
-	// output result
-	if opts.OutputFormat == "json" {
-		boxJSON, _ := json.MarshalIndent(box, "", "  ")
-		fmt.Println(string(boxJSON))
-	} else {
-		// output text format
-		fmt.Println("Box details:")
-		fmt.Println("------------")
-
-		// convert box to map for formatted output
-		boxBytes, _ := json.Marshal(box)
-		var data map[string]interface{}
-		if err := json.Unmarshal(boxBytes, &data); err != nil {
-			return fmt.Errorf("failed to parse box data: %v", err)
+	return opts.Output.PrintObject(os.Stdout, box, func(w io.Writer) error {
+		return printBoxDetails(w, box)
+	})
+}
+
+// runInspectSelector inspects all boxes matching the label selector concurrently
+func runInspectSelector(opts *BoxInspectOptions) error {
+	if err := opts.Batch.validate(); err != nil {
+		return err
+	}
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+	if opts.Output.IsStructured() {
+		if err := opts.Batch.validateStructured(false); err != nil {
+			return err
 		}
+	}
 
-		// define expected key order
-		orderedKeys := []string{"id", "image", "status", "createdAt", "extra_labels"}
-		printedKeys := make(map[string]bool)
+	// create SDK client
+	sdkClient, err := client.NewClientFromProfile()
+	if err != nil {
+		return fmt.Errorf("failed to initialize gbox client: %v", err)
+	}
 
-		// print keys in expected order
-		for _, key := range orderedKeys {
-			if value, exists := data[key]; exists {
-				printKeyValue(key, value, opts.OutputFormat)
-				printedKeys[key] = true
-			}
+	ids, err := selectBoxes(sdkClient, opts.Batch.Selector)
+	if err != nil {
+		return err
+	}
+
+	boxes := make(map[string]*sdk.V1BoxGetResponseUnion, len(ids))
+	var boxesMu sync.Mutex
+	results := forEachBox(ids, opts.Batch.Parallel, func(boxID string) boxResult {
+		box, err := client.GetBox(sdkClient, boxID)
+		if err != nil {
+			return boxResult{Error: err.Error()}
+		}
+		boxesMu.Lock()
+		boxes[boxID] = box
+		boxesMu.Unlock()
+		return boxResult{}
+	}, nil)
+
+	// output in selection order
+	var list []*sdk.V1BoxGetResponseUnion
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(os.Stderr, "Error: failed to get details of box %s: %s\n", r.BoxID, r.Error)
+			continue
 		}
+		list = append(list, boxes[r.BoxID])
+	}
 
-		// print any remaining keys
-		for key, value := range data {
-			if !printedKeys[key] {
-				printKeyValue(key, value, opts.OutputFormat)
+	if list == nil {
+		list = []*sdk.V1BoxGetResponseUnion{}
+	}
+	err = opts.Output.PrintObject(os.Stdout, list, func(w io.Writer) error {
+		if len(ids) == 0 {
+			fmt.Fprintf(w, "No boxes match selector %s\n", opts.Batch.Selector)
+		}
+		for i, box := range list {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			if err := printBoxDetails(w, box); err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeBatchSummary(&opts.Batch, "gbox box inspect", results); err != nil {
+		return err
+	}
+	if aggregateExitCode(results) != 0 {
+		return fmt.Errorf("failed to get details of some boxes")
+	}
+	return nil
+}
+
+// printBoxDetails prints the details of a box as text
+func printBoxDetails(w io.Writer, box *sdk.V1BoxGetResponseUnion) error {
+	fmt.Fprintln(w, "Box details:")
+	fmt.Fprintln(w, "------------")
+
+	// convert box to map for formatted output
+	boxBytes, _ := json.Marshal(box)
+	var data map[string]interface{}
+	if err := json.Unmarshal(boxBytes, &data); err != nil {
+		return fmt.Errorf("failed to parse box data: %v", err)
+	}
+
+	// define expected key order
+	orderedKeys := []string{"id", "image", "status", "createdAt", "extra_labels"}
+	printedKeys := make(map[string]bool)
+
+	// print keys in expected order
+	for _, key := range orderedKeys {
+		if value, exists := data[key]; exists {
+			printKeyValue(w, key, value)
+			printedKeys[key] = true
+		}
+	}
+
+	// print any remaining keys
+	for key, value := range data {
+		if !printedKeys[key] {
+			printKeyValue(w, key, value)
+		}
 	}
 
 	return nil
 }
 
 // Helper function to print key-value pairs with special formatting for extra_labels
-func printKeyValue(key string, value interface{}, outputFormat string) {
-	// Special handling for extra_labels when output is text
-	if key == "extra_labels" && outputFormat == "text" {
+func printKeyValue(w io.Writer, key string, value interface{}) {
+	// Special handling for extra_labels
+	if key == "extra_labels" {
 		if labelsMap, ok := value.(map[string]interface{}); ok {
-			fmt.Printf("%-15s:", key)
+			fmt.Fprintf(w, "%-15s:", key)
 			if len(labelsMap) > 0 {
-				// Need to sort the labels for consistent output within extra_labels as well
+				// Sort the labels for consistent output within extra_labels as well
 				labelKeys := make([]string, 0, len(labelsMap))
 				for k := range labelsMap {
 					labelKeys = append(labelKeys, k)
 				}
-				// sort.Strings(labelKeys) // Requires importing "sort"
+				sort.Strings(labelKeys)
 				// Iterate and print labels with the new format
-				for i, labelKey := range labelKeys { // Iterate using sorted keys if sort was imported
+				for i, labelKey := range labelKeys {
 					labelValue := labelsMap[labelKey]
 					if i == 0 {
 						// Print first label on the same line
-						fmt.Printf(" %s: %v\n", labelKey, labelValue)
+						fmt.Fprintf(w, " %s: %v\n", labelKey, labelValue)
 					} else {
 						// Print subsequent labels on new lines, aligned
-						fmt.Printf("%-15s  %s: %v\n", "", labelKey, labelValue)
+						fmt.Fprintf(w, "%-15s  %s: %v\n", "", labelKey, labelValue)
 					}
 				}
 			} else {
-				fmt.Println() // Still print a newline even if empty, for consistent spacing
+				fmt.Fprintln(w) // Still print a newline even if empty, for consistent spacing
 			}
 			return // Handled extra_labels, exit function for this key
 		}
@@ -146,5 +244,5 @@ func printKeyValue(key string, value interface{}, outputFormat string) {
 			valueStr = string(jsonBytes)
 		}
 	}
-	fmt.Printf("%-15s: %s\n", key, valueStr)
+	fmt.Fprintf(w, "%-15s: %s\n", key, valueStr)
 }
@@ -3,15 +3,18 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 
 	client "github.com/babelcloud/gbox/packages/cli/internal/client"
-	"github.com/babelcloud/gbox/packages/cli/internal/util"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
 	"github.com/spf13/cobra"
 )
 
 type BoxListOptions struct {
-	OutputFormat string
-	Filters      []string
+	Output  output.Options
+	Filters []string
 }
 
 type BoxResponse struct {
@@ -31,6 +34,8 @@ func NewBoxListCommand() *cobra.Command {
 		Long:  "List all available boxes with various filtering options",
 		Example: `  gbox box list
   gbox box list --output json
+  gbox box list -o wide --sort-by created_at
+  gbox box list -o jsonpath='{.data[*].id}'
   gbox box list --filter 'label=project=myapp'
   gbox box list --filter 'ancestor=ubuntu:latest'`,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -39,17 +44,17 @@ func NewBoxListCommand() *cobra.Command {
 	}
 
 	flags := cmd.Flags()
-	flags.StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (json or text)")
+	addOutputFlags(cmd, &opts.Output, true)
 	flags.StringArrayVarP(&opts.Filters, "filter", "f", []string{}, "Filter boxes (format: field=value)")
 
-	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"json", "text"}, cobra.ShellCompDirectiveNoFileComp
-	})
-
 	return cmd
 }
 
 func runList(opts *BoxListOptions) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+
 	// create SDK client
 	sdkClient, err := client.NewClientFromProfile()
 	if err != nil {
@@ -63,80 +68,79 @@ func runList(opts *BoxListOptions) error {
 	}
 
 	// output result
-	return printResponse(resp, opts.OutputFormat)
+	return printResponse(resp, &opts.Output)
 }
 
 // printResponse handles output based on the selected format
-func printResponse(resp interface{}, outputFormat string) error {
+func printResponse(resp interface{}, opts *output.Options) error {
 	if resp == nil {
 		return fmt.Errorf("empty response")
 	}
 
-	if outputFormat == "json" {
-		// construct simplified fields expected by tests
-		type simpleBox struct {
-			ID     string `json:"id"`
-			Image  string `json:"image"`
-			Status string `json:"status"`
-			Type   string `json:"type"`
-		}
-		var out struct {
-			Data []simpleBox `json:"data"`
-		}
-		// convert SDK response to generic structure to extract expected fields
-		var raw struct {
-			Data []map[string]interface{} `json:"data"`
-		}
-		if rawBytes, _ := json.Marshal(resp); rawBytes != nil {
-			_ = json.Unmarshal(rawBytes, &raw)
-		}
-		for _, m := range raw.Data {
-			sb := simpleBox{}
-			if v, ok := m["id"].(string); ok {
-				sb.ID = v
-			}
-			if v, ok := m["image"].(string); ok {
-				sb.Image = v
-			}
-			if v, ok := m["status"].(string); ok {
-				sb.Status = v
-			}
-			if v, ok := m["type"].(string); ok {
-				sb.Type = v
-			}
-			out.Data = append(out.Data, sb)
-		}
-
-		jsonBytes, err := json.MarshalIndent(out, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal response: %v", err)
-		}
-		fmt.Println(string(jsonBytes))
-		return nil
+	// convert SDK response to generic structure to extract the fields
+	var raw struct {
+		Data []map[string]interface{} `json:"data"`
 	}
-
-	// For text output, we need to extract data from the response
-	var data []map[string]interface{}
 	if rawBytes, _ := json.Marshal(resp); rawBytes != nil {
-		var raw struct {
-			Data []map[string]interface{} `json:"data"`
-		}
 		_ = json.Unmarshal(rawBytes, &raw)
-		data = raw.Data
 	}
 
-	if len(data) == 0 {
-		fmt.Println("No boxes found")
-		return nil
+	// structured output keeps the simplified fields expected by tests
+	type simpleBox struct {
+		ID     string `json:"id"`
+		Image  string `json:"image"`
+		Status string `json:"status"`
+		Type   string `json:"type"`
 	}
 
-	// Define table columns
-	columns := []util.TableColumn{
-		{Header: "ID", Key: "id"},
-		{Header: "TYPE", Key: "type"},
-		{Header: "STATUS", Key: "status"},
+	table := &output.Table{
+		Columns: []output.Column{
+			{Header: "ID", Key: "id"},
+			{Header: "TYPE", Key: "type"},
+			{Header: "STATUS", Key: "status"},
+			{Header: "CREATED AT", Key: "created_at", Wide: true},
+			{Header: "EXPIRES AT", Key: "expires_at", Wide: true},
+			{Header: "LABELS", Key: "labels", Wide: true},
+		},
+		Empty: "No boxes found",
+		Wrap: func(items []interface{}) interface{} {
+			return map[string]interface{}{"data": items}
+		},
 	}
+	for _, m := range raw.Data {
+		sb := simpleBox{}
+		sb.ID, _ = m["id"].(string)
+		sb.Image, _ = m["image"].(string)
+		sb.Status, _ = m["status"].(string)
+		sb.Type, _ = m["type"].(string)
+
+		var labels map[string]interface{}
+		if cfg, ok := m["config"].(map[string]interface{}); ok {
+			labels, _ = cfg["labels"].(map[string]interface{})
+		}
 
-	util.RenderTable(columns, data)
-	return nil
+		table.Rows = append(table.Rows, output.Row{
+			Cells: map[string]interface{}{
+				"id":         sb.ID,
+				"type":       sb.Type,
+				"status":     sb.Status,
+				"created_at": m["createdAt"],
+				"expires_at": m["expiresAt"],
+				"labels":     formatLabels(labels),
+			},
+			Item: sb,
+		})
+	}
+
+	return opts.PrintTable(os.Stdout, table)
+}
+
+// formatLabels formats labels as sorted key=value pairs
+func formatLabels(labels map[string]interface{}) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
 }
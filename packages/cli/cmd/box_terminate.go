@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -14,6 +16,7 @@ type BoxTerminateOptions struct {
 	OutputFormat string
 	TerminateAll bool
 	Force        bool
+	Batch        BatchOptions
 }
 
 func NewBoxTerminateCommand() *cobra.Command {
@@ -22,10 +25,11 @@ func NewBoxTerminateCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "terminate [box-id]",
 		Short: "Terminate a box by its ID",
-		Long:  "Terminate a box by its ID or terminate all boxes",
+		Long:  "Terminate a box by its ID, all boxes matching a label selector, or all boxes",
 		Example: `  gbox box terminate 550e8400-e29b-41d4-a716-446655440000
   gbox box terminate --all --force
   gbox box terminate --all
+  gbox box terminate --selector env=test --force
   gbox box terminate 550e8400-e29b-41d4-a716-446655440000 --output json`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runTerminate(opts, args)
@@ -37,6 +41,7 @@ func NewBoxTerminateCommand() *cobra.Command {
 	flags.StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (json or text)")
 	flags.BoolVarP(&opts.TerminateAll, "all", "a", false, "Terminate all boxes")
 	flags.BoolVarP(&opts.Force, "force", "f", false, "Force termination without confirmation")
+	addBatchFlags(cmd, &opts.Batch)
 
 	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{"json", "text"}, cobra.ShellCompDirectiveNoFileComp
@@ -46,8 +51,15 @@ func NewBoxTerminateCommand() *cobra.Command {
 }
 
 func runTerminate(opts *BoxTerminateOptions, args []string) error {
+	if opts.Batch.Selector != "" {
+		if opts.TerminateAll || len(args) > 0 {
+			return fmt.Errorf("cannot specify --selector together with --all or a box ID")
+		}
+		return terminateSelectedBoxes(opts)
+	}
+
 	if !opts.TerminateAll && len(args) == 0 {
-		return fmt.Errorf("must specify either --all or a box ID")
+		return fmt.Errorf("must specify either --all, --selector or a box ID")
 	}
 
 	if opts.TerminateAll && len(args) > 0 {
@@ -92,15 +104,11 @@ func terminateAllBoxes(opts *BoxTerminateOptions) error {
 	fmt.Println()
 
 	if !opts.Force {
-		fmt.Print("Are you sure you want to terminate all boxes? [y/N] ")
-		reader := bufio.NewReader(os.Stdin)
-		reply, err := reader.ReadString('\n')
+		confirmed, err := confirmTermination(os.Stdout, "Are you sure you want to terminate all boxes? [y/N] ")
 		if err != nil {
-			return fmt.Errorf("failed to read input: %v", err)
+			return err
 		}
-
-		reply = strings.TrimSpace(strings.ToLower(reply))
-		if reply != "y" && reply != "yes" {
+		if !confirmed {
 			if opts.OutputFormat == "json" {
 				fmt.Println(`{"status":"cancelled","message":"Operation cancelled by user"}`)
 			} else {
@@ -137,6 +145,120 @@ func terminateAllBoxes(opts *BoxTerminateOptions) error {
 	return nil
 }
 
+// confirmTermination prints prompt to out and asks the user for confirmation
+// on stdin
+func confirmTermination(out io.Writer, prompt string) (bool, error) {
+	fmt.Fprint(out, prompt)
+	reader := bufio.NewReader(os.Stdin)
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read input: %v", err)
+	}
+
+	reply = strings.TrimSpace(strings.ToLower(reply))
+	return reply == "y" || reply == "yes", nil
+}
+
+// terminateSelectedBoxes terminates all boxes matching the label selector concurrently
+func terminateSelectedBoxes(opts *BoxTerminateOptions) error {
+	if err := opts.Batch.validate(); err != nil {
+		return err
+	}
+	if opts.OutputFormat == "json" {
+		if err := opts.Batch.validateStructured(true); err != nil {
+			return err
+		}
+	}
+
+	// create SDK client
+	sdkClient, err := client.NewClientFromProfile()
+	if err != nil {
+		return fmt.Errorf("failed to initialize gbox client: %v", err)
+	}
+
+	ids, err := selectBoxes(sdkClient, opts.Batch.Selector)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		if opts.OutputFormat == "json" {
+			fmt.Println(`{"status":"success","message":"No boxes to terminate"}`)
+		} else {
+			fmt.Printf("No boxes match selector %s\n", opts.Batch.Selector)
+		}
+		return nil
+	}
+
+	if !opts.Force {
+		// keep stdout a single document in JSON mode
+		var out io.Writer = os.Stdout
+		if opts.OutputFormat == "json" {
+			out = os.Stderr
+		}
+		fmt.Fprintln(out, "The following boxes will be terminated:")
+		for _, id := range ids {
+			fmt.Fprintf(out, "  - %s\n", id)
+		}
+		fmt.Fprintln(out)
+
+		confirmed, err := confirmTermination(out, fmt.Sprintf("Are you sure you want to terminate %d boxes? [y/N] ", len(ids)))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			if opts.OutputFormat == "json" {
+				fmt.Println(`{"status":"cancelled","message":"Operation cancelled by user"}`)
+			} else {
+				fmt.Println("Operation cancelled")
+			}
+			return nil
+		}
+	}
+
+	results := forEachBox(ids, opts.Batch.Parallel, func(boxID string) boxResult {
+		if err := client.TerminateBox(sdkClient, boxID); err != nil {
+			return boxResult{Error: err.Error()}
+		}
+		return boxResult{}
+	}, func(r boxResult) {
+		if opts.OutputFormat == "json" {
+			return
+		}
+		if r.Error != "" {
+			fmt.Printf("Error: Failed to terminate box %s: %s\n", r.BoxID, r.Error)
+		} else {
+			fmt.Printf("Box %s terminated successfully\n", r.BoxID)
+		}
+	})
+
+	failed := aggregateExitCode(results) != 0
+	if opts.OutputFormat == "json" {
+		doc := map[string]interface{}{
+			"status":  "success",
+			"message": fmt.Sprintf("%d boxes terminated successfully", len(ids)),
+		}
+		if failed {
+			doc["status"], doc["message"] = "error", "Some boxes failed to terminate"
+		}
+		if opts.Batch.embedsSummary() {
+			doc["summary"] = batchSummary("gbox box terminate", results)
+		} else if err := writeBatchSummary(&opts.Batch, "gbox box terminate", results); err != nil {
+			return err
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else if err := writeBatchSummary(&opts.Batch, "gbox box terminate", results); err != nil {
+		return err
+	}
+	if failed {
+		return fmt.Errorf("some boxes failed to terminate")
+	}
+	return nil
+}
+
 func terminateBox(boxIDPrefix string, opts *BoxTerminateOptions) error {
 	resolvedBoxID, _, err := ResolveBoxIDPrefix(boxIDPrefix)
 	if err != nil {
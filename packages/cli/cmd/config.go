@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+func NewConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "View and edit CLI settings",
+		Long: `View and edit CLI settings.
+
+Each setting is taken from, in order of precedence: a command line flag, its
+environment variable, the first config.yaml found in the search paths (see
+'gbox config path'), and the built-in default. 'gbox config set' and
+'gbox config unset' edit the user config file.`,
+		Example: `  gbox config list
+  gbox config get api.base_url
+  gbox config set appium.install false
+  gbox config unset appium.install
+  gbox config path`,
+	}
+
+	cmd.AddCommand(
+		newConfigListCommand(),
+		newConfigGetCommand(),
+		newConfigSetCommand(),
+		newConfigUnsetCommand(),
+		newConfigPathCommand(),
+	)
+
+	return cmd
+}
+
+func newConfigListCommand() *cobra.Command {
+	var opts output.Options
+	var showSecrets bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all settings with their effective values and sources",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			table := &output.Table{
+				Columns: []output.Column{
+					{Header: "KEY", Key: "key"},
+					{Header: "VALUE", Key: "value"},
+					{Header: "SOURCE", Key: "source"},
+					{Header: "TYPE", Key: "type", Wide: true},
+					{Header: "DESCRIPTION", Key: "description", Wide: true},
+				},
+			}
+			for _, s := range config.Settings() {
+				value, err := config.Resolve(s.Key)
+				if err != nil {
+					return err
+				}
+				if s.Secret && !showSecrets && value.Value != "" {
+					value.Value = "********"
+				}
+				table.Rows = append(table.Rows, output.Row{
+					Cells: map[string]interface{}{
+						"key":         value.Key,
+						"value":       value.Value,
+						"source":      describeConfigSource(value),
+						"type":        value.Type,
+						"description": value.Description,
+					},
+					Item: value,
+				})
+			}
+			return opts.PrintTable(os.Stdout, table)
+		},
+	}
+
+	addOutputFlags(cmd, &opts, true)
+	cmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Show secret values instead of masking them")
+
+	return cmd
+}
+
+func newConfigGetCommand() *cobra.Command {
+	var opts output.Options
+
+	cmd := &cobra.Command{
+		Use:               "get <key>",
+		Short:             "Print the effective value of a setting",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeConfigKeys,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			value, err := config.Resolve(args[0])
+			if err != nil {
+				return err
+			}
+
+			return opts.PrintObject(os.Stdout, value, func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, value.Value)
+				return err
+			})
+		},
+	}
+
+	addOutputFlags(cmd, &opts, false)
+
+	return cmd
+}
+
+func newConfigSetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "set <key> <value>",
+		Short:             "Set a setting in the user config file",
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeConfigKeys,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := config.SetValue(args[0], args[1]); err != nil {
+				return err
+			}
+			s, _ := config.Lookup(args[0])
+			fmt.Printf("Set %s in %s\n", s.Key, config.UserConfigFile())
+			warnConfigOverride(s)
+			return nil
+		},
+	}
+}
+
+func newConfigUnsetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "unset <key>",
+		Short:             "Remove a setting from the user config file",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeConfigKeys,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			removed, err := config.UnsetValue(args[0])
+			if err != nil {
+				return err
+			}
+			s, _ := config.Lookup(args[0])
+			if !removed {
+				fmt.Printf("%s is not set in %s\n", s.Key, config.UserConfigFile())
+				return nil
+			}
+			fmt.Printf("Removed %s from %s\n", s.Key, config.UserConfigFile())
+			warnConfigOverride(s)
+			return nil
+		},
+	}
+}
+
+func newConfigPathCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Show the config file locations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			used := config.ConfigFileUsed()
+			if used == "" {
+				used = "none"
+			}
+			fmt.Printf("User config file: %s\n", config.UserConfigFile())
+			fmt.Printf("Config file in use: %s\n", used)
+			fmt.Println("Search paths (the first config.yaml found is used):")
+			for _, path := range config.SearchPaths() {
+				fmt.Printf("  %s\n", path)
+			}
+			return nil
+		},
+	}
+}
+
+// describeConfigSource formats where a value came from for display
+func describeConfigSource(value config.Value) string {
+	if value.Origin == "" {
+		return value.Source
+	}
+	return fmt.Sprintf("%s (%s)", value.Source, value.Origin)
+}
+
+// warnConfigOverride tells the user when the user config file does not decide
+// the effective value of a setting
+func warnConfigOverride(s config.Setting) {
+	if s.Env != "" && os.Getenv(s.Env) != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s is set and overrides the config file\n", s.Env)
+	}
+	if used := config.ConfigFileUsed(); used != "" && used != config.UserConfigFile() {
+		fmt.Fprintf(os.Stderr, "Warning: %s is read instead of the user config file\n", used)
+	}
+}
+
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var keys []string
+	for _, s := range config.Settings() {
+		if strings.HasPrefix(s.Key, toComplete) {
+			keys = append(keys, s.Key+"\t"+s.Description)
+		}
+	}
+	return keys, cobra.ShellCompDirectiveNoFileComp
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
@@ -16,6 +15,7 @@ import (
 	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect"
 	"github.com/babelcloud/gbox/packages/cli/internal/profile"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 )
 
 // Note: Device client functionality has been moved to daemon.DefaultManager
@@ -24,6 +24,7 @@ import (
 type DeviceConnectOptions struct {
 	DeviceID   string
 	Background bool
+	Selector   string
 }
 
 func NewDeviceConnectCommand() *cobra.Command {
@@ -36,7 +37,11 @@ func NewDeviceConnectCommand() *cobra.Command {
 This command allows you to securely connect Android devices (emulators or physical devices)
 to remote cloud services for remote access and debugging.
 
-If no device ID is provided, an interactive device selection will be shown.`,
+If no device ID is provided, an interactive device selection will be shown.
+
+When the server runs in local-only mode (server.local_only, or GBOX_LOCAL_ONLY=true),
+devices are served through the local live view and API only: they are neither
+registered nor connected to the cloud, and no gbox profile is needed.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return ExecuteDeviceConnect(cmd, opts, args)
 		},
@@ -49,9 +54,18 @@ If no device ID is provided, an interactive device selection will be shown.`,
   # Connect in background mode
   gbox device-connect --background
 
+  # Connect any free Android device labeled team=qa
+  gbox device-connect --selector team=qa
+
   # List all available devices
   gbox device-connect ls
 
+  # Pair an Android 11+ device over wireless debugging
+  gbox device-connect pair
+
+  # Boot a local emulator and register it
+  gbox device-connect emulator start Pixel_7_API_34
+
   # Register and connect this Linux machine to AP
   gbox device-connect register local`,
 	}
@@ -59,11 +73,19 @@ If no device ID is provided, an interactive device selection will be shown.`,
 	flags := cmd.Flags()
 	flags.StringVarP(&opts.DeviceID, "device", "d", "", "Specify the Android device ID to connect")
 	flags.BoolVarP(&opts.Background, "background", "b", false, "Run in background mode")
+	addSelectorFlag(cmd, &opts.Selector, "Connect any free Android device matching a label selector such as team=qa,!busy")
 
 	cmd.AddCommand(
 		NewDeviceConnectRegisterCommand(),
 		NewDeviceConnectListCommand(),
 		NewDeviceConnectUnregisterCommand(),
+		NewDeviceConnectReconnectCommand(),
+		NewDeviceConnectPairCommand(),
+		NewDeviceConnectDiscoverCommand(),
+		NewDeviceConnectEmulatorCommand(),
+		NewDeviceConnectLabelCommand(),
+		NewDeviceConnectLeaseCommand(),
+		NewDeviceConnectReleaseCommand(),
 	)
 
 	return cmd
@@ -93,8 +115,15 @@ func ExecuteDeviceConnect(cmd *cobra.Command, opts *DeviceConnectOptions, args [
 		sp.Success("ADB installed")
 	}
 
+	// A local-only server registers nothing and opens no tunnel, it needs
+	// neither a profile nor frpc
+	localOnly, err := serverLocalOnly()
+	if err != nil {
+		return err
+	}
+
 	// Check and auto-install frpc if missing
-	if !checkFrpcInstalled() {
+	if !localOnly && !checkFrpcInstalled() {
 		if !debug {
 			fmt.Println("→ Missing frpc, installing automatically...")
 		}
@@ -144,12 +173,62 @@ func ExecuteDeviceConnect(cmd *cobra.Command, opts *DeviceConnectOptions, args [
 		deviceID = opts.DeviceID
 	}
 
+	if deviceID == "" && opts.Selector != "" {
+		picked, err := pickDevice(opts.Selector, func(d DeviceDTO) bool { return d.OS == "android" })
+		if err != nil {
+			return err
+		}
+		deviceID = selectedDeviceKey(*picked)
+	}
+
 	if deviceID == "" {
-		return runInteractiveDeviceSelection(opts)
+		return runInteractiveDeviceSelection(opts, localOnly)
+	}
+	if localOnly {
+		return serveLocalDevice(deviceID)
 	}
 	return connectToDevice(deviceID, opts)
 }
 
+// serverLocalOnly reports whether the local server runs in local-only mode,
+// starting the server if needed
+func serverLocalOnly() (bool, error) {
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return false, err
+	}
+	info, err := client.ServerInfo()
+	if err != nil {
+		return false, fmt.Errorf("failed to get server info: %v", err)
+	}
+	return info.LocalOnly, nil
+}
+
+// serveLocalDevice shows where a local-only server serves a device, which is
+// all there is to connecting it without the cloud
+func serveLocalDevice(deviceID string) error {
+	devices, err := listServerDevices()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, d := range devices {
+		if d.TransportID == deviceID || d.Serialno == deviceID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+
+	url := daemon.DefaultManager.URL()
+	fmt.Printf("Server runs in local-only mode, device %s is served locally without registration.\n", deviceID)
+	fmt.Printf("\n📱 View and control your device at: %s\n", color.CyanString(url))
+	fmt.Printf("   Its stream, control, exec and file APIs are under %s/api/devices/%s\n", url, deviceID)
+	return nil
+}
+
 // checkAndInstallPrerequisites checks and installs Node.js, npm, Appium and related components
 func checkAndInstallPrerequisites() error {
 	debug := os.Getenv("DEBUG") == "true"
@@ -183,8 +262,7 @@ func checkAndInstallPrerequisites() error {
 	}
 
 	// Check if Appium is already installed
-	deviceProxyHome := config.GetDeviceProxyHome()
-	appiumHome := filepath.Join(deviceProxyHome, "appium")
+	appiumHome := config.GetAppiumHome()
 
 	if device_connect.IsAppiumInstalled(appiumHome) {
 		if debug {
@@ -224,22 +302,13 @@ func checkAndInstallPrerequisites() error {
 	return nil
 }
 
-func runInteractiveDeviceSelection(opts *DeviceConnectOptions) error {
+func runInteractiveDeviceSelection(opts *DeviceConnectOptions, localOnly bool) error {
 	// Use daemon manager to call API
-	var response struct {
-		Success bool        `json:"success"`
-		Devices []DeviceDTO `json:"devices"`
-	}
-
-	if err := daemon.DefaultManager.CallAPI("GET", "/api/devices", nil, &response); err != nil {
-		return fmt.Errorf("failed to get available devices: %v", err)
-	}
-
-	if !response.Success {
-		return fmt.Errorf("failed to get devices from server")
+	devices, err := listServerDevices()
+	if err != nil {
+		return err
 	}
 
-	devices := response.Devices
 	if len(devices) == 0 {
 		fmt.Println("No devices found.")
 		fmt.Println()
@@ -248,7 +317,11 @@ func runInteractiveDeviceSelection(opts *DeviceConnectOptions) error {
 	}
 
 	fmt.Println()
-	fmt.Println("Select a device to register for remote access:")
+	if localOnly {
+		fmt.Println("Select a device to control locally:")
+	} else {
+		fmt.Println("Select a device to register for remote access:")
+	}
 	fmt.Println()
 	printDeveloperModeHint()
 	fmt.Println()
@@ -286,6 +359,9 @@ func runInteractiveDeviceSelection(opts *DeviceConnectOptions) error {
 	}
 
 	selectedDevice := devices[choice-1]
+	if localOnly {
+		return serveLocalDevice(selectedDeviceKey(selectedDevice))
+	}
 
 	// Handle local device registration
 	if selectedDevice.IsLocal {
@@ -429,19 +505,13 @@ func formatDeviceOption(index int, device DeviceDTO) {
 func connectToDevice(deviceID string, opts *DeviceConnectOptions) error {
 	// Register device via daemon API
 	// For Android devices
-	req := map[string]string{
-		"deviceId":   deviceID,
-		"deviceType": "mobile",
-		"osType":     "android",
-	}
-	var resp map[string]interface{}
-
-	if err := daemon.DefaultManager.CallAPI("POST", "/api/devices/register", req, &resp); err != nil {
-		return fmt.Errorf("failed to register device: %v", err)
+	req := serverclient.RegisterDeviceRequest{
+		DeviceID:   deviceID,
+		DeviceType: "mobile",
+		OsType:     "android",
 	}
-
-	if success, ok := resp["success"].(bool); !ok || !success {
-		return fmt.Errorf("failed to register device: %v", resp["error"])
+	if _, err := registerServerDevice(req); err != nil {
+		return err
 	}
 
 	fmt.Printf("Establishing remote connection for device %s...\n", deviceID)
@@ -475,110 +545,105 @@ func connectToDevice(deviceID string, opts *DeviceConnectOptions) error {
 	fmt.Printf("Disconnecting device %s...\n", deviceID)
 
 	// Unregister the device via daemon API
-	req = map[string]string{"deviceId": deviceID}
-	if err := daemon.DefaultManager.CallAPI("POST", "/api/devices/unregister", req, nil); err != nil {
+	if err := unregisterServerDevice(deviceID); err != nil {
 		fmt.Printf("Warning: failed to unregister device: %v\n", err)
 	}
 
 	return nil
 }
 
+// registerServerDevice registers a device through the local server
+func registerServerDevice(req serverclient.RegisterDeviceRequest) (*serverclient.RegisteredDevice, error) {
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return nil, err
+	}
+	created, err := client.RegisterDevice(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register device: %v", err)
+	}
+	return created, nil
+}
+
 // registerDevice registers a device for remote access
 // If deviceID is empty and deviceType is empty, register as desktop with auto-detected OS
 // If deviceID is provided, register as mobile (Android) device
 // If deviceType is provided (for backward compatibility), use it to determine type
 func registerDevice(deviceID string, deviceType string) error {
 	// Register device via daemon API
-	req := make(map[string]string)
+	var req serverclient.RegisterDeviceRequest
 	isDesktop := false
 
 	// Determine device type based on parameters
 	if deviceID == "" && deviceType == "" {
 		// Empty deviceID and deviceType means register local machine as desktop
-		req["deviceType"] = "desktop"
+		req.DeviceType = "desktop"
 		isDesktop = true
 		// Auto-detect OS type
 		switch runtime.GOOS {
 		case "linux":
-			req["osType"] = "linux"
+			req.OsType = "linux"
 		case "darwin":
-			req["osType"] = "macos"
+			req.OsType = "macos"
 		case "windows":
-			req["osType"] = "windows"
+			req.OsType = "windows"
 		default:
-			req["osType"] = "linux" // Default fallback
+			req.OsType = "linux" // Default fallback
 		}
 	} else if deviceType != "" {
 		// Backward compatibility: use provided deviceType
 		oldType := strings.ToLower(deviceType)
 		if oldType == "android" {
-			req["deviceType"] = "mobile"
-			req["osType"] = "android"
+			req.DeviceType = "mobile"
+			req.OsType = "android"
 		} else if oldType == "linux" {
-			req["deviceType"] = "desktop"
-			req["osType"] = "linux"
+			req.DeviceType = "desktop"
+			req.OsType = "linux"
 			isDesktop = true
 		} else {
 			// Default: treat as desktop and try to detect OS
-			req["deviceType"] = "desktop"
+			req.DeviceType = "desktop"
 			isDesktop = true
 			switch runtime.GOOS {
 			case "linux":
-				req["osType"] = "linux"
+				req.OsType = "linux"
 			case "darwin":
-				req["osType"] = "macos"
+				req.OsType = "macos"
 			case "windows":
-				req["osType"] = "windows"
+				req.OsType = "windows"
 			default:
-				req["osType"] = "linux" // Default fallback
+				req.OsType = "linux" // Default fallback
 			}
 		}
 	} else {
 		// deviceID is provided, register as mobile (Android) device
-		req["deviceType"] = "mobile"
-		req["osType"] = "android"
+		req.DeviceType = "mobile"
+		req.OsType = "android"
 	}
 
 	// For desktop devices, try to reuse regId if deviceID is empty
 	if isDesktop && deviceID == "" {
 		if regId, _ := readLocalRegId(); regId != "" {
-			req["regId"] = regId
+			req.RegID = regId
 		}
 	}
 
 	if deviceID != "" {
-		req["deviceId"] = deviceID
+		req.DeviceID = deviceID
 	}
-	var resp map[string]interface{}
-
-	if err := daemon.DefaultManager.CallAPI("POST", "/api/devices/register", req, &resp); err != nil {
-		return fmt.Errorf("failed to register device: %v", err)
-	}
-
-	if success, ok := resp["success"].(bool); !ok || !success {
-		return fmt.Errorf("failed to register device: %v", resp["error"])
+	created, err := registerServerDevice(req)
+	if err != nil {
+		return err
 	}
 
 	// Resolve actual device ID and regId from response
 	actualID := deviceID
-	regIdStr := ""
-	if data, ok := resp["data"].(map[string]interface{}); ok {
-		if id, ok2 := data["id"].(string); ok2 && id != "" {
-			actualID = id
-		}
-		if rid, ok2 := data["regId"].(string); ok2 && rid != "" {
-			regIdStr = rid
-		} else if actualID != "" {
-			regIdStr = actualID
-		}
+	if created.ID != "" {
+		actualID = created.ID
 	}
-	// Also check top-level fields
+	regIdStr := created.RegID
 	if regIdStr == "" {
-		if v, ok := resp["regId"]; ok {
-			if rid, ok2 := v.(string); ok2 && rid != "" {
-				regIdStr = rid
-			}
-		}
+		regIdStr = actualID
 	}
 	if actualID != "" && deviceID == "" {
 		deviceID = actualID
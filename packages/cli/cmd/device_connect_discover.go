@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+type DeviceConnectDiscoverOptions struct {
+	Output output.Options
+}
+
+func NewDeviceConnectDiscoverCommand() *cobra.Command {
+	opts := &DeviceConnectDiscoverOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "discover [flags]",
+		Short: "List Android 11+ devices advertising wireless debugging on the LAN",
+		Long: `List Android 11+ devices advertising wireless debugging on the LAN, found
+with mDNS by the adb server.
+
+Devices accepting connections are listed as connect, devices with a pairing
+dialog open as pairing. Devices that are not paired yet cannot be connected,
+pair them with 'gbox device-connect pair'.`,
+		Example: `  # List the wireless debugging devices on the LAN
+  gbox device-connect discover
+
+  # List the pairing addresses only
+  gbox device-connect discover -o jsonpath='{range [?(@.service=="pairing")]}{.address}{"\n"}{end}'`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ExecuteDeviceConnectDiscover(cmd, opts)
+		},
+	}
+
+	addOutputFlags(cmd, &opts.Output, true)
+
+	return cmd
+}
+
+func ExecuteDeviceConnectDiscover(cmd *cobra.Command, opts *DeviceConnectDiscoverOptions) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return err
+	}
+	devices, err := client.WirelessDevices()
+	if err != nil {
+		return fmt.Errorf("failed to discover devices: %v", err)
+	}
+
+	table := &output.Table{
+		Columns: []output.Column{
+			{Header: "NAME", Key: "name"},
+			{Header: "SERVICE", Key: "service"},
+			{Header: "ADDRESS", Key: "address"},
+			{Header: "STATUS", Key: "status"},
+			{Header: "SERIAL NO", Key: "serialno", Wide: true},
+			{Header: "ADB SERIAL", Key: "serial", Wide: true},
+		},
+		Empty: "No wireless debugging devices found on the LAN",
+	}
+	for _, d := range devices {
+		status := "-"
+		switch {
+		case d.Connected:
+			status = "Connected"
+		case d.Error != "":
+			status = "Connect failed"
+		case d.Service == "connect":
+			status = "Not connected"
+		}
+		table.Rows = append(table.Rows, output.Row{
+			Cells: map[string]interface{}{
+				"name":     d.Name,
+				"service":  d.Service,
+				"address":  d.Address,
+				"status":   status,
+				"serialno": d.SerialNo,
+				"serial":   d.Serial,
+			},
+			Item: d,
+		})
+	}
+	return opts.Output.PrintTable(os.Stdout, table)
+}
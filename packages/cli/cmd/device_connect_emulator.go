@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type DeviceConnectEmulatorListOptions struct {
+	Output output.Options
+}
+
+type DeviceConnectEmulatorStartOptions struct {
+	Window         bool
+	Snapshot       string
+	ColdBoot       bool
+	NoSnapshotSave bool
+	WipeData       bool
+	Port           int
+	Timeout        time.Duration
+	NoRegister     bool
+}
+
+type DeviceConnectEmulatorStopOptions struct {
+	Timeout time.Duration
+}
+
+func NewDeviceConnectEmulatorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "emulator",
+		Short: "Start, stop and wipe local Android emulators",
+		Long: `Start, stop and wipe the Android Virtual Devices (AVDs) of the local Android
+SDK, with its emulator and avdmanager tools.
+
+The SDK is found from the android.sdk_root setting of 'gbox config', or from
+ANDROID_HOME and ANDROID_SDK_ROOT; the tools are looked up in PATH otherwise.
+Started emulators are registered like other devices, and unregistered when
+stopped. The server forgets emulators that exit on their own.`,
+		Example: `  # List the AVDs
+  gbox device-connect emulator list
+
+  # Boot an AVD headless and register it
+  gbox device-connect emulator start Pixel_7_API_34
+
+  # Stop it
+  gbox device-connect emulator stop Pixel_7_API_34`,
+	}
+
+	cmd.AddCommand(
+		NewDeviceConnectEmulatorListCommand(),
+		NewDeviceConnectEmulatorStartCommand(),
+		NewDeviceConnectEmulatorStopCommand(),
+		NewDeviceConnectEmulatorWipeCommand(),
+	)
+
+	return cmd
+}
+
+func NewDeviceConnectEmulatorListCommand() *cobra.Command {
+	opts := &DeviceConnectEmulatorListOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "list [flags]",
+		Aliases:      []string{"ls"},
+		Short:        "List the AVDs and the adb serials of the running ones",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ExecuteDeviceConnectEmulatorList(cmd, opts)
+		},
+	}
+
+	addOutputFlags(cmd, &opts.Output, true)
+
+	return cmd
+}
+
+func NewDeviceConnectEmulatorStartCommand() *cobra.Command {
+	opts := &DeviceConnectEmulatorStartOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "start <avd> [flags]",
+		Short: "Boot an AVD, wait for Android to finish booting and register it",
+		Long: `Boot an AVD, wait for Android to finish booting and register it.
+
+The emulator runs headless unless --window is given, and keeps running after
+this command returns. Its output is written to the emulators directory of the
+gbox home. When the server runs in local-only mode the emulator is served
+locally without registration.`,
+		Example: `  # Boot from the quick boot snapshot
+  gbox device-connect emulator start Pixel_7_API_34
+
+  # Boot from a named snapshot and discard the changes on exit
+  gbox device-connect emulator start Pixel_7_API_34 --snapshot clean --no-snapshot-save
+
+  # Cold boot with a window, without registering
+  gbox device-connect emulator start Pixel_7_API_34 --cold-boot --window --no-register`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ExecuteDeviceConnectEmulatorStart(cmd, opts, args[0])
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&opts.Window, "window", false, "Show the emulator window instead of running headless")
+	flags.StringVar(&opts.Snapshot, "snapshot", "", "Boot from the named snapshot instead of the quick boot one")
+	flags.BoolVar(&opts.ColdBoot, "cold-boot", false, "Boot without loading a snapshot")
+	flags.BoolVar(&opts.NoSnapshotSave, "no-snapshot-save", false, "Do not save the state of the emulator on exit")
+	flags.BoolVar(&opts.WipeData, "wipe-data", false, "Reset the user data before booting")
+	flags.IntVar(&opts.Port, "port", 0, "Console port, an even number from 5554 to 5682; a free one by default")
+	flags.DurationVar(&opts.Timeout, "timeout", 5*time.Minute, "How long to wait for Android to finish booting before killing the emulator")
+	flags.BoolVar(&opts.NoRegister, "no-register", false, "Do not register the emulator once booted")
+
+	return cmd
+}
+
+func NewDeviceConnectEmulatorStopCommand() *cobra.Command {
+	opts := &DeviceConnectEmulatorStopOptions{}
+
+	cmd := &cobra.Command{
+		Use:          "stop <avd_or_serial> [flags]",
+		Short:        "Unregister a running emulator and kill it",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ExecuteDeviceConnectEmulatorStop(cmd, opts, args[0])
+		},
+	}
+
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", time.Minute, "How long to wait for the emulator to shut down")
+
+	return cmd
+}
+
+func NewDeviceConnectEmulatorWipeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "wipe <avd>",
+		Short:        "Reset the user data and snapshots of a stopped AVD",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := newEmulators().Wipe(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "AVD %s wiped.\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newEmulators() *device.Emulators {
+	return device.NewEmulators(config.GetAndroidSDKRoot(), adbserver.DefaultClient())
+}
+
+func ExecuteDeviceConnectEmulatorList(cmd *cobra.Command, opts *DeviceConnectEmulatorListOptions) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+
+	avds, err := newEmulators().List(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	table := &output.Table{
+		Columns: []output.Column{
+			{Header: "NAME", Key: "name"},
+			{Header: "STATUS", Key: "status"},
+			{Header: "SERIAL", Key: "serial"},
+			{Header: "DEVICE", Key: "device", Wide: true},
+			{Header: "TARGET", Key: "target", Wide: true},
+			{Header: "ABI", Key: "abi", Wide: true},
+		},
+		Empty: "No AVDs found, create one with avdmanager or Android Studio",
+	}
+	for _, avd := range avds {
+		status, serial := "Stopped", "-"
+		if avd.Serial != "" {
+			status, serial = "Running", avd.Serial
+		}
+		table.Rows = append(table.Rows, output.Row{
+			Cells: map[string]interface{}{
+				"name":   avd.Name,
+				"status": status,
+				"serial": serial,
+				"device": avd.Device,
+				"target": avd.Target,
+				"abi":    avd.ABI,
+			},
+			Item: avd,
+		})
+	}
+	return opts.Output.PrintTable(os.Stdout, table)
+}
+
+func ExecuteDeviceConnectEmulatorStart(cmd *cobra.Command, opts *DeviceConnectEmulatorStartOptions, name string) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), opts.Timeout)
+	defer cancel()
+
+	logFile := filepath.Join(config.GetGboxHome(), "cli", "emulators", name+".log")
+	fmt.Fprintf(cmd.OutOrStdout(), "Starting emulator %s...\n", name)
+	serial, err := newEmulators().Start(ctx, name, device.EmulatorStartOptions{
+		Headless:       !opts.Window,
+		Snapshot:       opts.Snapshot,
+		ColdBoot:       opts.ColdBoot,
+		NoSnapshotSave: opts.NoSnapshotSave,
+		WipeData:       opts.WipeData,
+		Port:           opts.Port,
+		LogFile:        logFile,
+	})
+	switch {
+	case errors.Is(err, device.ErrEmulatorRunning):
+		fmt.Fprintf(cmd.OutOrStdout(), "Emulator %s is already running as %s.\n", name, serial)
+	case err != nil:
+		return err
+	default:
+		fmt.Fprintf(cmd.OutOrStdout(), "Emulator %s booted as %s.\n", name, serial)
+	}
+
+	if opts.NoRegister {
+		return nil
+	}
+	// A local-only server refuses registration, the emulator is served as it is
+	localOnly, err := serverLocalOnly()
+	if err != nil {
+		return err
+	}
+	if localOnly {
+		return serveLocalDevice(serial)
+	}
+	return registerDevice(serial, "android")
+}
+
+func ExecuteDeviceConnectEmulatorStop(cmd *cobra.Command, opts *DeviceConnectEmulatorStopOptions, nameOrSerial string) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), opts.Timeout)
+	defer cancel()
+
+	emulators := newEmulators()
+	avd, err := emulators.Find(ctx, nameOrSerial)
+	if err != nil {
+		return err
+	}
+	if avd.Serial == "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "Emulator %s is not running.\n", avd.Name)
+		return nil
+	}
+
+	// Unregister first, so the access point does not see the device drop
+	if devices, err := listServerDevices(); err != nil {
+		fmt.Printf("Warning: could not list registered devices: %v\n", err)
+	} else {
+		for _, d := range devices {
+			if d.IsRegistered && (d.TransportID == avd.Serial || d.Serialno == avd.Serial) {
+				if err := unregisterDevice(avd.Serial); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+				break
+			}
+		}
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Stopping emulator %s (%s)...\n", avd.Name, avd.Serial)
+	if err := emulators.Stop(ctx, avd.Serial); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Emulator %s stopped.\n", avd.Name)
+	return nil
+}
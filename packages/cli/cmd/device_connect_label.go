@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/spf13/cobra"
+)
+
+type DeviceConnectLabelOptions struct {
+	Selector string
+	Output   output.Options
+}
+
+func NewDeviceConnectLabelCommand() *cobra.Command {
+	opts := &DeviceConnectLabelOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "label <device> [key=value ...] [key- ...] [flags]",
+		Short: "Show, set and remove the labels of a device",
+		Long: `Show, set and remove the labels of a device. The device is a serial, a transport
+ID, or 'local' for this machine.
+
+Labels are kept by the local server with the device registry, by serialno, so
+they follow a device over USB and Wi-Fi. Labels of registered devices are also
+saved in the device metadata in the cloud.
+
+Device commands take a label selector with --selector instead of a device:
+  team=qa     label team is qa, also written team==qa
+  os!=14      label os is missing or not 14
+  gpu         label gpu is set
+  !busy       label busy is missing
+Requirements are separated by commas and must all match. Commands acting on a
+single device pick any free device that matches: attached, not quarantined, not
+leased and not in use by a box.`,
+		Example: `  # Label a device
+  gbox device-connect label emulator-5554 team=qa os=14
+
+  # Remove a label
+  gbox device-connect label emulator-5554 os-
+
+  # Show the labels of a device
+  gbox device-connect label emulator-5554
+
+  # Label every device of a team
+  gbox device-connect label --selector team=qa rack=2
+
+  # Register any free device of the QA team
+  gbox device-connect register --selector team=qa`,
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ExecuteDeviceConnectLabel(cmd, opts, args)
+		},
+	}
+
+	addSelectorFlag(cmd, &opts.Selector, "Label the devices matching a label selector instead of one device")
+	addOutputFlags(cmd, &opts.Output, false)
+
+	return cmd
+}
+
+func ExecuteDeviceConnectLabel(cmd *cobra.Command, opts *DeviceConnectLabelOptions, args []string) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+
+	var keys []string
+	if opts.Selector != "" {
+		devices, err := selectServerDevices(opts.Selector, false)
+		if err != nil {
+			return err
+		}
+		if len(devices) == 0 {
+			return fmt.Errorf("no device matches selector %q", opts.Selector)
+		}
+		for _, d := range devices {
+			keys = append(keys, selectedDeviceKey(d))
+		}
+	} else {
+		if len(args) == 0 {
+			return fmt.Errorf("a device or --selector is required")
+		}
+		keys, args = args[:1], args[1:]
+	}
+
+	set, remove, err := device.ParseLabelArgs(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return err
+	}
+
+	table := &output.Table{
+		Columns: []output.Column{
+			{Header: "DEVICE", Key: "device"},
+			{Header: "SERIAL NO", Key: "serialno"},
+			{Header: "LABELS", Key: "labels"},
+		},
+	}
+	for _, key := range keys {
+		var labels *serverclient.DeviceLabels
+		if len(set) == 0 && len(remove) == 0 {
+			labels, err = client.DeviceLabels(key)
+		} else {
+			labels, err = client.UpdateDeviceLabels(key, serverclient.DeviceLabelsRequest{Labels: set, Remove: remove})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to label device %s: %v", key, err)
+		}
+		if labels.Warning != "" {
+			fmt.Fprintf(os.Stderr, "Warning: device %s: %s\n", key, labels.Warning)
+		}
+		formatted := device.FormatLabels(labels.Labels)
+		if formatted == "" {
+			formatted = "-"
+		}
+		table.Rows = append(table.Rows, output.Row{
+			Cells: map[string]interface{}{
+				"device":   key,
+				"serialno": labels.Serialno,
+				"labels":   formatted,
+			},
+			Item: labels,
+		})
+	}
+	return opts.Output.PrintTable(os.Stdout, table)
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/spf13/cobra"
+)
+
+// leaseEnv holds the lease ID commands renew and release by default
+const leaseEnv = "GBOX_LEASE"
+
+type DeviceConnectLeaseOptions struct {
+	Owner    string
+	TTL      time.Duration
+	Cleanup  bool
+	Hold     bool
+	Renew    bool
+	LeaseID  string
+	Selector string
+	Output   output.Options
+}
+
+type DeviceConnectReleaseOptions struct {
+	LeaseID string
+	Force   bool
+	Output  output.Options
+}
+
+func NewDeviceConnectLeaseCommand() *cobra.Command {
+	opts := &DeviceConnectLeaseOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "lease [device] [flags]",
+		Short: "Lease a device so no one else drives it",
+		Long: `Lease a device to one owner, e.g. a CI job, when several users share the
+devices of one gbox server. The device is an adb serial, a serialno, or 'local'
+for this machine; with --selector any free device matching the label selector
+is leased.
+
+While a device is leased, the routes that drive it or read its screen refuse
+requests without the lease ID in the X-Gbox-Lease header: the device actions
+(POST and DELETE /api/devices/{serial}) and its video, audio, stream, control,
+adb, exec, appium, screenshot and files routes. The lease ends when it is
+released or not renewed within its TTL. With --cleanup the apps installed
+during the lease are uninstalled when it ends.
+
+--hold keeps renewing the lease until interrupted and releases it then. Without
+it, renew the lease with --renew, which takes the lease ID from --lease or
+$GBOX_LEASE.`,
+		Example: `  # Lease a device for 30 minutes and keep its ID
+  export GBOX_LEASE=$(gbox device-connect lease emulator-5554 --ttl 30m -o jsonpath={.id})
+
+  # Renew the lease before it expires
+  gbox device-connect lease emulator-5554 --renew
+
+  # Lease any free device of the QA team and hold it until Ctrl+C
+  gbox device-connect lease --selector team=qa --owner ci-1234 --hold
+
+  # Uninstall the apps a test run installs when the lease ends
+  gbox device-connect lease emulator-5554 --cleanup`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			device := ""
+			if len(args) == 1 {
+				device = args[0]
+			}
+			return ExecuteDeviceConnectLease(cmd, opts, device)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.Owner, "owner", "", "Who holds the lease (default user@hostname)")
+	flags.DurationVar(&opts.TTL, "ttl", 0, "How long the lease lasts unless renewed (default device.lease.ttl of the server)")
+	flags.BoolVar(&opts.Cleanup, "cleanup", false, "Uninstall the apps installed during the lease when it ends, Android only")
+	flags.BoolVar(&opts.Hold, "hold", false, "Renew the lease until interrupted, then release it")
+	flags.BoolVar(&opts.Renew, "renew", false, "Renew the lease with --lease instead of taking a new one")
+	flags.StringVar(&opts.LeaseID, "lease", "", "Lease ID to renew (default $"+leaseEnv+")")
+	addSelectorFlag(cmd, &opts.Selector, "Lease any free device matching a label selector")
+	addOutputFlags(cmd, &opts.Output, false)
+	cmd.MarkFlagsMutuallyExclusive("renew", "selector")
+	cmd.MarkFlagsMutuallyExclusive("renew", "hold")
+
+	return cmd
+}
+
+func NewDeviceConnectReleaseCommand() *cobra.Command {
+	opts := &DeviceConnectReleaseOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "release <device> [flags]",
+		Short: "Release the lease of a device",
+		Long: `Release the lease of a device so others can drive it. The lease ID is taken
+from --lease or $GBOX_LEASE; --force releases a lease held by someone else,
+e.g. a crashed job that left a long TTL.`,
+		Example: `  # Release the lease in $GBOX_LEASE
+  gbox device-connect release emulator-5554
+
+  # Take a device back from its holder
+  gbox device-connect release emulator-5554 --force`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ExecuteDeviceConnectRelease(cmd, opts, args[0])
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.LeaseID, "lease", "", "Lease ID to release (default $"+leaseEnv+")")
+	flags.BoolVar(&opts.Force, "force", false, "Release the lease without its ID")
+	addOutputFlags(cmd, &opts.Output, false)
+
+	return cmd
+}
+
+func ExecuteDeviceConnectLease(cmd *cobra.Command, opts *DeviceConnectLeaseOptions, device string) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+	if device == "" && (opts.Selector == "" || opts.Renew) {
+		return fmt.Errorf("a device or --selector is required")
+	}
+	if device != "" && opts.Selector != "" {
+		return fmt.Errorf("a device and --selector cannot be used together")
+	}
+
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return err
+	}
+
+	if opts.Renew {
+		if opts.LeaseID == "" {
+			opts.LeaseID = os.Getenv(leaseEnv)
+		}
+		if opts.LeaseID == "" {
+			return fmt.Errorf("--renew needs the lease ID in --lease or $%s", leaseEnv)
+		}
+		lease, err := client.RenewLease(device, opts.LeaseID)
+		if err != nil {
+			return fmt.Errorf("failed to renew the lease of device %s: %v", device, err)
+		}
+		return printLease(opts.Output, lease)
+	}
+
+	owner := opts.Owner
+	if owner == "" {
+		owner = defaultLeaseOwner()
+	}
+	req := serverclient.LeaseRequest{Owner: owner, Cleanup: opts.Cleanup, Selector: opts.Selector}
+	if opts.TTL > 0 {
+		req.TTL = opts.TTL.String()
+	}
+	lease, err := client.AcquireLease(device, req)
+	if err != nil {
+		if device == "" {
+			return fmt.Errorf("failed to lease a device matching %q: %v", opts.Selector, err)
+		}
+		return fmt.Errorf("failed to lease device %s: %v", device, err)
+	}
+	if err := printLease(opts.Output, lease); err != nil {
+		return err
+	}
+	if !opts.Hold {
+		return nil
+	}
+	return holdLease(client, lease)
+}
+
+// holdLease renews a lease at a third of its TTL until interrupted, then
+// releases it
+func holdLease(client *serverclient.Client, lease *serverclient.DeviceLease) error {
+	ttl, err := time.ParseDuration(lease.TTL)
+	if err != nil || ttl <= 0 {
+		return fmt.Errorf("invalid TTL %q of lease", lease.TTL)
+	}
+	fmt.Fprintf(os.Stderr, "Holding device %s, press Ctrl+C to release it\n", lease.Serial)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := client.RenewLease(lease.Serial, lease.ID); err != nil {
+				return fmt.Errorf("failed to renew the lease of device %s: %v", lease.Serial, err)
+			}
+		case <-sigCh:
+			if _, err := client.ReleaseLease(lease.Serial, lease.ID, false); err != nil {
+				return fmt.Errorf("failed to release device %s: %v", lease.Serial, err)
+			}
+			fmt.Fprintf(os.Stderr, "Released device %s\n", lease.Serial)
+			return nil
+		}
+	}
+}
+
+func ExecuteDeviceConnectRelease(cmd *cobra.Command, opts *DeviceConnectReleaseOptions, device string) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+	if opts.LeaseID == "" {
+		opts.LeaseID = os.Getenv(leaseEnv)
+	}
+	if opts.LeaseID == "" && !opts.Force {
+		return fmt.Errorf("the lease ID is required in --lease or $%s, or release with --force", leaseEnv)
+	}
+
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return err
+	}
+	lease, err := client.ReleaseLease(device, opts.LeaseID, opts.Force)
+	if err != nil {
+		return fmt.Errorf("failed to release device %s: %v", device, err)
+	}
+	return printLease(opts.Output, lease)
+}
+
+// printLease prints a lease as a one-row table
+func printLease(opts output.Options, lease *serverclient.DeviceLease) error {
+	id := lease.ID
+	if id == "" {
+		id = "-"
+	}
+	table := &output.Table{
+		Columns: []output.Column{
+			{Header: "DEVICE", Key: "device"},
+			{Header: "OWNER", Key: "owner"},
+			{Header: "EXPIRES", Key: "expires"},
+			{Header: "LEASE ID", Key: "id"},
+		},
+		Rows: []output.Row{{
+			Cells: map[string]interface{}{
+				"device":  lease.Serial,
+				"owner":   lease.Owner,
+				"expires": lease.ExpiresAt.Local().Format(time.RFC3339),
+				"id":      id,
+			},
+			Item: lease,
+		}},
+	}
+	return opts.PrintTable(os.Stdout, table)
+}
+
+// defaultLeaseOwner returns user@hostname of this machine
+func defaultLeaseOwner() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = os.Getenv("USERNAME")
+	}
+	host, _ := os.Hostname()
+	switch {
+	case user != "" && host != "":
+		return user + "@" + host
+	case host != "":
+		return host
+	default:
+		return "gbox"
+	}
+}
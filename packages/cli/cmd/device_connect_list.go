@@ -1,13 +1,15 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
 	"strings"
 
 	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
-	"github.com/babelcloud/gbox/packages/cli/internal/util"
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 	"github.com/spf13/cobra"
 )
 
@@ -15,32 +17,20 @@ const (
 	statusConnected     = "Connected"
 	statusReconnecting  = "Reconnecting"
 	statusDisconnected  = "Disconnected"
+	statusOffline       = "Offline"
+	statusQuarantined   = "Quarantined"
 	statusRegistered    = "Registered"
 	statusNotRegistered = "Not Registered"
 )
 
 type DeviceConnectListOptions struct {
-	OutputFormat string
+	Output   output.Options
+	Selector string
+	Free     bool
 }
 
 // DeviceDTO is the API response structure for devices
-type DeviceDTO struct {
-	ID                string                 `json:"id"`
-	TransportID       string                 `json:"transportId"`
-	Serialno          string                 `json:"serialno"`
-	AndroidID         string                 `json:"androidId"`
-	Platform          string                 `json:"platform"`   // mobile, desktop
-	OS                string                 `json:"os"`         // android, linux, windows, macos
-	DeviceType        string                 `json:"deviceType"` // physical, emulator, vm
-	IsRegistered      bool                   `json:"isRegistered"`
-	IsConnected       bool                   `json:"isConnected"`       // true if device is currently connected to AP
-	IsReconnecting    bool                   `json:"isReconnecting"`    // true if device is attempting to reconnect
-	ReconnectAttempt  int                    `json:"reconnectAttempt"`  // Current reconnection attempt count
-	ReconnectMaxRetry int                    `json:"reconnectMaxRetry"` // Maximum reconnection attempts
-	RegId             string                 `json:"regId"`
-	IsLocal           bool                   `json:"isLocal"`  // true if this is the local desktop device
-	Metadata          map[string]interface{} `json:"metadata"` // Device-specific metadata
-}
+type DeviceDTO = serverclient.Device
 
 func NewDeviceConnectListCommand() *cobra.Command {
 	opts := &DeviceConnectListOptions{}
@@ -49,7 +39,20 @@ func NewDeviceConnectListCommand() *cobra.Command {
 		Use:     "ls [flags]",
 		Aliases: []string{"list"},
 		Short:   "List all detectable local Android devices and their registration status",
-		Long:    "List all detectable local Android devices and their registration status.",
+		Long: `List all detectable local Android devices and their registration status.
+
+Registered devices that are not attached right now are listed as Offline. The
+server remembers them in ~/.gbox/cli/devices.json, so they are listed even when
+the cloud cannot be reached.
+
+HEALTH shows the battery level (+ while charging), battery temperature and free
+storage of the last health check. Devices breaching the device.health.*
+thresholds of 'gbox config' are Quarantined: disconnected and marked unavailable
+until they recover.
+
+LABELS, in wide output, shows the labels set with 'gbox device-connect label';
+--selector lists the devices matching a label selector only. LEASE shows who
+holds the lease of a device taken with 'gbox device-connect lease' and until when.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return ExecuteDeviceConnectList(cmd, opts)
 		},
@@ -57,20 +60,30 @@ func NewDeviceConnectListCommand() *cobra.Command {
   gbox device-connect ls
 
   # List devices in JSON format for scripting:
-  gbox device-connect ls --format json`,
+  gbox device-connect ls -o json
+
+  # List only the IDs of connected devices:
+  gbox device-connect ls -o jsonpath='{range [?(@.isConnected==true)]}{.id}{"\n"}{end}'
+
+  # List the free devices of the QA team:
+  gbox device-connect ls --selector team=qa --free`,
 	}
 
 	flags := cmd.Flags()
-	flags.StringVarP(&opts.OutputFormat, "format", "", "text", "Output format: text (default) or json")
-
-	cmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"text", "json"}, cobra.ShellCompDirectiveNoFileComp
-	})
+	addOutputFlags(cmd, &opts.Output, true)
+	flags.StringVar(&opts.Output.Format, "format", output.FormatTable, "Output format")
+	flags.MarkDeprecated("format", "use --output instead")
+	addSelectorFlag(cmd, &opts.Selector, "List the devices matching a label selector such as team=qa,os!=14,gpu,!busy")
+	flags.BoolVar(&opts.Free, "free", false, "List the devices that are attached, not quarantined, not leased and not in use by a box only")
 
 	return cmd
 }
 
 func ExecuteDeviceConnectList(cmd *cobra.Command, opts *DeviceConnectListOptions) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+
 	if !checkAdbInstalled() {
 		printAdbInstallationHint()
 		return fmt.Errorf("ADB is not installed or not in your PATH; please install ADB and try again")
@@ -81,45 +94,32 @@ func ExecuteDeviceConnectList(cmd *cobra.Command, opts *DeviceConnectListOptions
 		return fmt.Errorf("frpc is not installed or not in your PATH; please install frpc and try again")
 	}
 
-	// Use daemon manager to call unified server API
-	var response struct {
-		Success bool        `json:"success"`
-		Devices []DeviceDTO `json:"devices"`
-	}
-
-	if err := daemon.DefaultManager.CallAPI("GET", "/api/devices", nil, &response); err != nil {
-		return fmt.Errorf("failed to get available devices: %v", err)
-	}
-
-	if !response.Success {
-		return fmt.Errorf("failed to get devices from server")
-	}
-
-	if opts.OutputFormat == "json" {
-		return outputDevicesJSONFromAPI(response.Devices)
+	devices, err := selectServerDevices(opts.Selector, opts.Free)
+	if err != nil {
+		return err
 	}
 
-	return outputDevicesTextFromAPI(response.Devices)
+	return outputDevicesFromAPI(devices, &opts.Output)
 }
 
-func outputDevicesJSONFromAPI(devices []DeviceDTO) error {
-	// Output full DeviceDTO with all fields
-	jsonBytes, err := json.MarshalIndent(devices, "", "  ")
+// listServerDevices lists devices through the local server, starting it if needed
+func listServerDevices() ([]DeviceDTO, error) {
+	client, err := daemon.DefaultManager.Client()
 	if err != nil {
-		return fmt.Errorf("failed to marshal devices to JSON: %v", err)
+		return nil, err
 	}
-	fmt.Println(string(jsonBytes))
-	return nil
-}
-
-func outputDevicesTextFromAPI(devices []DeviceDTO) error {
-	if len(devices) == 0 {
-		fmt.Println("No devices found.")
-		return nil
+	devices, err := client.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get available devices: %v", err)
 	}
+	return devices, nil
+}
 
+// outputDevicesFromAPI prints the devices, structured formats output the full DeviceDTO
+func outputDevicesFromAPI(devices []DeviceDTO, opts *output.Options) error {
 	// Build rows for sorting
 	type row struct {
+		device            DeviceDTO
 		serial            string
 		deviceID          string
 		serialOrTransport string
@@ -140,13 +140,23 @@ func outputDevicesTextFromAPI(devices []DeviceDTO) error {
 
 		// Determine status based on connection state
 		var status string
-		if isConnected {
+		if device.Health != nil && device.Health.Quarantined {
+			// Magenta for devices held back by the health checks
+			status = "\x1b[35m" + statusQuarantined + "\x1b[0m"
+		} else if isConnected {
 			// Green for Connected
 			status = "\x1b[32m" + statusConnected + "\x1b[0m"
 		} else if isReconnecting {
 			// Cyan for Reconnecting (with attempt info)
 			reconnectInfo := fmt.Sprintf("%s (%d/%d)", statusReconnecting, reconnectAttempt, maxRetry)
+			if maxRetry == 0 {
+				// The reconnect policy retries forever
+				reconnectInfo = fmt.Sprintf("%s (%d)", statusReconnecting, reconnectAttempt)
+			}
 			status = "\x1b[36m" + reconnectInfo + "\x1b[0m"
+		} else if device.IsOffline {
+			// Gray for registered devices that are not attached
+			status = "\x1b[90m" + statusOffline + "\x1b[0m"
 		} else if isRegistered && reconnectAttempt >= maxRetry && maxRetry > 0 {
 			// Red for Disconnected (max retries reached)
 			status = "\x1b[31m" + statusDisconnected + "\x1b[0m"
@@ -217,12 +227,17 @@ func outputDevicesTextFromAPI(devices []DeviceDTO) error {
 		}
 
 		// DEVICE ID should be the remote cloud device ID. Fallback to "-" when empty
+		// Boxes connected through adb-expose are shown with their box ID
 		uniqueDeviceID := deviceID
+		if strings.TrimSpace(uniqueDeviceID) == "" && device.BoxID != "" {
+			uniqueDeviceID = device.BoxID + " (adb-expose)"
+		}
 		if strings.TrimSpace(uniqueDeviceID) == "" {
 			uniqueDeviceID = "-"
 		}
 
 		rows = append(rows, row{
+			device:            device,
 			serial:            device.Serialno,
 			deviceID:          uniqueDeviceID,
 			serialOrTransport: serialOrTransport,
@@ -243,27 +258,79 @@ func outputDevicesTextFromAPI(devices []DeviceDTO) error {
 		return rows[i].serialOrTransport < rows[j].serialOrTransport
 	})
 
-	// Prepare data for RenderTable in sorted order
-	tableData := make([]map[string]interface{}, len(rows))
-	for i, r := range rows {
-		tableData[i] = map[string]interface{}{
-			"device_id":           r.deviceID,
-			"serial_or_transport": r.serialOrTransport,
-			"os":                  r.os,
-			"device_type":         r.deviceType,
-			"status":              r.status,
+	table := &output.Table{
+		Columns: []output.Column{
+			{Header: "DEVICE ID", Key: "device_id"},
+			{Header: "SERIAL NO/TRANSPORT ID", Key: "serial_or_transport"},
+			{Header: "OS", Key: "os"},
+			{Header: "DEVICE TYPE", Key: "device_type"},
+			{Header: "STATUS", Key: "status"},
+			{Header: "HEALTH", Key: "health"},
+			{Header: "SERIAL NO", Key: "serialno", Wide: true},
+			{Header: "TRANSPORT ID", Key: "transport_id", Wide: true},
+			{Header: "PLATFORM", Key: "platform", Wide: true},
+			{Header: "REG ID", Key: "reg_id", Wide: true},
+			{Header: "LAST SEEN", Key: "last_seen", Wide: true},
+			{Header: "CPU LOAD", Key: "cpu_load", Wide: true},
+			{Header: "SCREEN", Key: "screen", Wide: true},
+			{Header: "LABELS", Key: "labels", Wide: true},
+			{Header: "LEASE", Key: "lease", Wide: true},
+		},
+		Empty: "No devices found.",
+	}
+	for _, r := range rows {
+		lastSeen := "-"
+		if r.device.LastSeen != nil {
+			lastSeen = r.device.LastSeen.Local().Format("2006-01-02 15:04")
 		}
+		health, cpuLoad, screen := "-", "-", "-"
+		labels := device.FormatLabels(r.device.Labels)
+		if labels == "" {
+			labels = "-"
+		}
+		lease := "-"
+		if l := r.device.Lease; l != nil {
+			lease = fmt.Sprintf("%s until %s", l.Owner, l.ExpiresAt.Local().Format("15:04"))
+		}
+		if h := r.device.Health; h != nil && h.CheckedAt != nil {
+			health = formatDeviceHealth(h)
+			cpuLoad = fmt.Sprintf("%.2f", h.CPULoad)
+			screen = "off"
+			if h.ScreenOn {
+				screen = "on"
+			}
+		}
+		table.Rows = append(table.Rows, output.Row{
+			Cells: map[string]interface{}{
+				"device_id":           r.deviceID,
+				"serial_or_transport": r.serialOrTransport,
+				"os":                  r.os,
+				"device_type":         r.deviceType,
+				"status":              r.status,
+				"serialno":            r.device.Serialno,
+				"transport_id":        r.device.TransportID,
+				"platform":            r.device.Platform,
+				"reg_id":              r.device.RegId,
+				"last_seen":           lastSeen,
+				"health":              health,
+				"cpu_load":            cpuLoad,
+				"screen":              screen,
+				"labels":              labels,
+				"lease":               lease,
+			},
+			Item: r.device,
+		})
 	}
 
-	// Define table columns
-	columns := []util.TableColumn{
-		{Header: "DEVICE ID", Key: "device_id"},
-		{Header: "SERIAL NO/TRANSPORT ID", Key: "serial_or_transport"},
-		{Header: "OS", Key: "os"},
-		{Header: "DEVICE TYPE", Key: "device_type"},
-		{Header: "STATUS", Key: "status"},
-	}
+	return opts.PrintTable(os.Stdout, table)
+}
 
-	util.RenderTable(columns, tableData)
-	return nil
+// formatDeviceHealth summarizes battery, temperature and free storage, e.g.
+// "85%+ 31°C 11.8G free", where + marks a charging device
+func formatDeviceHealth(h *serverclient.DeviceHealth) string {
+	charging := ""
+	if h.Charging {
+		charging = "+"
+	}
+	return fmt.Sprintf("%d%%%s %.0f°C %.1fG free", h.BatteryLevel, charging, h.BatteryTemperature, float64(h.StorageFree)/(1<<30))
 }
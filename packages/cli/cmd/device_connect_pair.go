@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/internal/util"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/spf13/cobra"
+)
+
+type DeviceConnectPairOptions struct {
+	Connect string
+	Timeout time.Duration
+}
+
+func NewDeviceConnectPairCommand() *cobra.Command {
+	opts := &DeviceConnectPairOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "pair [pairing_address [code]] [flags]",
+		Short: "Pair an Android 11+ device over wireless debugging and connect to it",
+		Long: `Pair an Android 11+ device over wireless debugging and connect to it.
+
+Without arguments a QR code is shown. On the device, open Developer options >
+Wireless debugging > Pair device with QR code and scan it.
+
+With a pairing address, open Pair device with pairing code instead and give
+the IP address & port and the code it shows. The code is asked for when left
+out.
+
+Once paired the device is connected, and registered like a USB device. Paired
+devices found on the LAN are connected again automatically, also after
+wireless debugging restarts on another port; see the device.wireless.*
+settings of 'gbox config'.`,
+		Example: `  # Pair by scanning a QR code
+  gbox device-connect pair
+
+  # Pair with the code shown by the device
+  gbox device-connect pair 192.168.1.20:37099 482913
+
+  # List the wireless debugging devices on the LAN
+  gbox device-connect discover`,
+		Args:         cobra.MaximumNArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ExecuteDeviceConnectPair(cmd, opts, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.Connect, "connect", "", "Address to connect to after pairing, found with mDNS by default")
+	flags.DurationVar(&opts.Timeout, "timeout", 2*time.Minute, "How long to wait for the QR code to be scanned")
+
+	return cmd
+}
+
+func ExecuteDeviceConnectPair(cmd *cobra.Command, opts *DeviceConnectPairOptions, args []string) error {
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return err
+	}
+	// Pairing and connecting take longer than other requests
+	client.HTTPClient = &http.Client{Timeout: time.Minute}
+
+	req := serverclient.PairRequest{ConnectAddress: opts.Connect}
+	if len(args) == 0 {
+		req.Address, req.Code, err = waitForQRPairing(cmd, client, opts.Timeout)
+		if err != nil {
+			return err
+		}
+	} else {
+		req.Address = args[0]
+		if _, _, err := net.SplitHostPort(req.Address); err != nil {
+			return fmt.Errorf("invalid pairing address %q, expected host:port", req.Address)
+		}
+		if len(args) == 2 {
+			req.Code = args[1]
+		} else {
+			fmt.Fprint(cmd.OutOrStdout(), "Pairing code: ")
+			code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read pairing code: %v", err)
+			}
+			req.Code = strings.TrimSpace(code)
+		}
+	}
+
+	resp, err := client.PairDevice(req)
+	if err != nil {
+		return fmt.Errorf("failed to pair with %s: %v", req.Address, err)
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), resp.Message)
+	if resp.Serial != "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "Device %s is connected, see 'gbox device-connect ls'\n", resp.Serial)
+	}
+	return nil
+}
+
+// waitForQRPairing shows a pairing QR code and waits for a device to scan it,
+// returning the pairing address the device advertises and the password
+func waitForQRPairing(cmd *cobra.Command, client *serverclient.Client, timeout time.Duration) (string, string, error) {
+	name := "gbox-" + util.GenerateRandomString(8)
+	password := util.GenerateRandomString(10)
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintln(out, "On the device, open Developer options > Wireless debugging > Pair device with QR code and scan:")
+	fmt.Fprintln(out)
+	if err := util.WriteQRCode(out, adbserver.PairingQR(name, password)); err != nil {
+		return "", "", err
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Waiting for the device...")
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		devices, err := client.WirelessDevices()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to discover devices: %v", err)
+		}
+		for _, d := range devices {
+			if d.Service == "pairing" && d.Name == name {
+				return d.Address, password, nil
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return "", "", fmt.Errorf("no device scanned the QR code within %s, make sure it is on the same network", timeout)
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/spf13/cobra"
+)
+
+type DeviceConnectReconnectOptions struct {
+	MaxAttempts      int
+	Forever          bool
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	BreakerThreshold int
+	Cooldown         time.Duration
+	CancelOnOffline  bool
+	ResetPolicy      bool
+	Selector         string
+}
+
+func NewDeviceConnectReconnectCommand() *cobra.Command {
+	opts := &DeviceConnectReconnectOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "reconnect [serial_or_device_id] [flags]",
+		Short: "Reconnect a registered device now and set its reconnect policy",
+		Long: `Reconnect a registered device to the access point now, without waiting for the
+next backoff delay. A device that gave up reconnecting starts over.
+
+Policy flags change how the server retries this device when its connection is
+lost; the device keeps them across server restarts. Devices without their own
+policy use the device.reconnect.* settings of 'gbox config'.`,
+		Example: `  # Reconnect a device now
+  gbox device-connect reconnect emulator-5554
+
+  # Keep retrying a device on a flaky network forever, pausing 10 minutes
+  # after 20 failures in a row
+  gbox device-connect reconnect emulator-5554 --forever --breaker-threshold 20 --cooldown 10m
+
+  # Go back to the global reconnect policy
+  gbox device-connect reconnect emulator-5554 --reset-policy
+
+  # Reconnect every registered device labeled team=qa
+  gbox device-connect reconnect --selector team=qa`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				return ExecuteDeviceConnectReconnect(cmd, opts, args[0])
+			}
+			if opts.Selector == "" {
+				return fmt.Errorf("a device or --selector is required")
+			}
+			devices, err := selectServerDevices(opts.Selector, false)
+			if err != nil {
+				return err
+			}
+			reconnected := 0
+			for _, d := range devices {
+				if !d.IsRegistered {
+					continue
+				}
+				if err := ExecuteDeviceConnectReconnect(cmd, opts, selectedDeviceKey(d)); err != nil {
+					return err
+				}
+				reconnected++
+			}
+			if reconnected == 0 {
+				return fmt.Errorf("no registered device matches selector %q", opts.Selector)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.IntVar(&opts.MaxAttempts, "max-attempts", 0, "Attempts before giving up")
+	flags.BoolVar(&opts.Forever, "forever", false, "Never give up reconnecting")
+	flags.DurationVar(&opts.BaseDelay, "base-delay", 0, "Backoff delay of the first attempt")
+	flags.DurationVar(&opts.MaxDelay, "max-delay", 0, "Longest backoff delay between attempts")
+	flags.IntVar(&opts.BreakerThreshold, "breaker-threshold", 0, "Failures in a row before pausing for the cooldown, 0 never pauses")
+	flags.DurationVar(&opts.Cooldown, "cooldown", 0, "Pause after breaker-threshold failures in a row")
+	flags.BoolVar(&opts.CancelOnOffline, "cancel-on-offline", true, "Stop reconnecting when adb reports the device offline")
+	flags.BoolVar(&opts.ResetPolicy, "reset-policy", false, "Use the global reconnect policy again")
+	addSelectorFlag(cmd, &opts.Selector, "Reconnect the registered devices matching a label selector such as team=qa")
+	cmd.MarkFlagsMutuallyExclusive("max-attempts", "forever")
+
+	return cmd
+}
+
+func ExecuteDeviceConnectReconnect(cmd *cobra.Command, opts *DeviceConnectReconnectOptions, deviceID string) error {
+	req := &serverclient.ReconnectRequest{ResetPolicy: opts.ResetPolicy}
+
+	// Send only the policy fields given on the command line
+	policy := map[string]interface{}{}
+	flags := cmd.Flags()
+	if flags.Changed("max-attempts") {
+		if opts.MaxAttempts <= 0 {
+			return fmt.Errorf("--max-attempts must be positive, use --forever to never give up")
+		}
+		policy["max_attempts"] = opts.MaxAttempts
+	}
+	if opts.Forever {
+		policy["max_attempts"] = 0
+	}
+	if flags.Changed("base-delay") {
+		policy["base_delay"] = opts.BaseDelay.String()
+	}
+	if flags.Changed("max-delay") {
+		policy["max_delay"] = opts.MaxDelay.String()
+	}
+	if flags.Changed("breaker-threshold") {
+		policy["breaker_threshold"] = opts.BreakerThreshold
+	}
+	if flags.Changed("cooldown") {
+		policy["cooldown"] = opts.Cooldown.String()
+	}
+	if flags.Changed("cancel-on-offline") {
+		policy["cancel_on_offline"] = opts.CancelOnOffline
+	}
+	if len(policy) > 0 {
+		req.Policy = policy
+	}
+
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.ReconnectDevice(deviceID, req)
+	if serverclient.StatusCode(err) == http.StatusNotFound {
+		return fmt.Errorf("device %s is not registered, register it with 'gbox device-connect register %s'", deviceID, deviceID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reconnect device %s: %v", deviceID, err)
+	}
+
+	attempts := "forever"
+	if resp.Policy.MaxAttempts > 0 {
+		attempts = fmt.Sprintf("up to %d attempts", resp.Policy.MaxAttempts)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Reconnecting device %s (%s, backoff %s to %s", deviceID, attempts, resp.Policy.BaseDelay, resp.Policy.MaxDelay)
+	if resp.Policy.BreakerThreshold > 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), ", pausing %s after %d failures in a row", resp.Policy.Cooldown, resp.Policy.BreakerThreshold)
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), ")")
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 
 type DeviceConnectRegisterOptions struct {
 	DeviceID string
+	Selector string
 }
 
 func NewDeviceConnectRegisterCommand() *cobra.Command {
@@ -26,13 +27,16 @@ func NewDeviceConnectRegisterCommand() *cobra.Command {
   gbox device-connect register abc123xyz456
 
   # Register and connect this machine as desktop
-  gbox device-connect register local`,
+  gbox device-connect register local
+
+  # Register any free device labeled team=qa that is not registered yet
+  gbox device-connect register --selector team=qa`,
 		Args:          cobra.MaximumNArgs(1),
 		SilenceUsage:  false,
 		SilenceErrors: true, // Don't show errors twice (we handle them in RunE)
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// No interactive mode - require device ID
-			if len(args) == 0 && opts.DeviceID == "" {
+			if len(args) == 0 && opts.DeviceID == "" && opts.Selector == "" {
 				return fmt.Errorf("device ID is required. Use 'gbox device-connect' for interactive selection")
 			}
 			err := ExecuteDeviceConnectRegister(cmd, opts, args)
@@ -45,6 +49,7 @@ func NewDeviceConnectRegisterCommand() *cobra.Command {
 
 	flags := cmd.Flags()
 	flags.StringVarP(&opts.DeviceID, "device", "d", "", "Specify the device ID to register")
+	addSelectorFlag(cmd, &opts.Selector, "Register any free, unregistered device matching a label selector such as team=qa,!busy")
 
 	return cmd
 }
@@ -56,6 +61,12 @@ func ExecuteDeviceConnectRegister(cmd *cobra.Command, opts *DeviceConnectRegiste
 		deviceID = args[0]
 	} else if opts.DeviceID != "" {
 		deviceID = opts.DeviceID
+	} else if opts.Selector != "" {
+		picked, err := pickDevice(opts.Selector, func(d DeviceDTO) bool { return !d.IsRegistered })
+		if err != nil {
+			return err
+		}
+		deviceID = selectedDeviceKey(*picked)
 	}
 
 	// Determine device type based on deviceID
@@ -87,8 +98,7 @@ type DeviceConnectLinuxConnectOptions struct {
 // This function is kept for backward compatibility but now calls registerDevice
 func ExecuteDeviceConnectLinuxConnect(cmd *cobra.Command, opts *DeviceConnectLinuxConnectOptions, args []string) error {
 	// Force restart local server on each execution of this command
-	_ = daemon.DefaultManager.StopServer()
-	if err := daemon.DefaultManager.StartServer(); err != nil {
+	if err := daemon.DefaultManager.Restart(daemon.DefaultDrainTimeout); err != nil {
 		return fmt.Errorf("failed to restart local server: %v", err)
 	}
 
@@ -2,14 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 	"github.com/spf13/cobra"
 )
 
 type DeviceConnectUnregisterOptions struct {
-	All bool
+	All      bool
+	Selector string
 }
 
 func NewDeviceConnectUnregisterCommand() *cobra.Command {
@@ -28,7 +31,10 @@ func NewDeviceConnectUnregisterCommand() *cobra.Command {
   gbox device-connect unregister local
 
   # Unregister all active device connections:
-  gbox device-connect unregister --all`,
+  gbox device-connect unregister --all
+
+  # Unregister the registered devices labeled team=qa:
+  gbox device-connect unregister --selector team=qa`,
 		Args:          cobra.MaximumNArgs(1),
 		SilenceUsage:  true, // Don't show usage on errors (e.g., device not found)
 		SilenceErrors: true, // Don't show errors twice (we handle them in RunE)
@@ -43,6 +49,8 @@ func NewDeviceConnectUnregisterCommand() *cobra.Command {
 
 	flags := cmd.Flags()
 	flags.BoolVarP(&opts.All, "all", "a", false, "Disconnect all active device connections")
+	addSelectorFlag(cmd, &opts.Selector, "Unregister the registered devices matching a label selector such as team=qa")
+	cmd.MarkFlagsMutuallyExclusive("all", "selector")
 
 	return cmd
 }
@@ -51,6 +59,9 @@ func ExecuteDeviceConnectUnregister(cmd *cobra.Command, opts *DeviceConnectUnreg
 	if opts.All {
 		return unregisterAllDevices()
 	}
+	if opts.Selector != "" {
+		return unregisterSelectedDevices(opts.Selector)
+	}
 
 	if len(args) == 0 {
 		return runInteractiveUnregisterSelection()
@@ -76,21 +87,13 @@ func ExecuteDeviceConnectUnregister(cmd *cobra.Command, opts *DeviceConnectUnreg
 
 func unregisterAllDevices() error {
 	// Get devices from daemon manager
-	var response struct {
-		Success bool        `json:"success"`
-		Devices []DeviceDTO `json:"devices"`
-	}
-
-	if err := daemon.DefaultManager.CallAPI("GET", "/api/devices", nil, &response); err != nil {
-		return fmt.Errorf("failed to get available devices: %v", err)
-	}
-
-	if !response.Success {
-		return fmt.Errorf("failed to get devices from server")
+	devices, err := listServerDevices()
+	if err != nil {
+		return err
 	}
 
 	unregisteredCount := 0
-	for _, device := range response.Devices {
+	for _, device := range devices {
 		if device.IsRegistered {
 			// Prefer transport id for API
 			deviceKey := device.TransportID
@@ -115,8 +118,7 @@ func unregisterAllDevices() error {
 			}
 
 			fmt.Printf("Unregistering %s (%s, %s)...\n", deviceKey, name, connectionType)
-			req := map[string]string{"deviceId": deviceKey}
-			if err := daemon.DefaultManager.CallAPI("POST", "/api/devices/unregister", req, nil); err != nil {
+			if err := unregisterServerDevice(deviceKey); err != nil {
 				fmt.Printf("Failed to unregister %s: %v\n", deviceKey, err)
 				continue
 			}
@@ -139,6 +141,40 @@ func unregisterAllDevices() error {
 	return nil
 }
 
+// unregisterSelectedDevices unregisters the registered devices whose labels
+// match selector
+func unregisterSelectedDevices(selector string) error {
+	devices, err := selectServerDevices(selector, false)
+	if err != nil {
+		return err
+	}
+
+	unregistered := 0
+	for _, d := range devices {
+		if !d.IsRegistered {
+			continue
+		}
+		var err error
+		if d.IsLocal {
+			err = unregisterLocalDevice()
+		} else {
+			err = unregisterDevice(selectedDeviceKey(d))
+		}
+		if err != nil {
+			fmt.Printf("Failed to unregister %s: %v\n", selectedDeviceKey(d), err)
+			continue
+		}
+		unregistered++
+	}
+
+	if unregistered == 0 {
+		fmt.Printf("No registered device matches selector %q.\n", selector)
+	} else {
+		fmt.Printf("Unregistered %d device(s).\n", unregistered)
+	}
+	return nil
+}
+
 // unregisterLocalDevice unregisters the local desktop device using saved regId
 func unregisterLocalDevice() error {
 	// Read regId from local file
@@ -150,10 +186,8 @@ func unregisterLocalDevice() error {
 	fmt.Printf("Unregistering local device (regId: %s)...\n", regId)
 
 	// Use regId as deviceId - the server will resolve it to actual device ID
-	req := map[string]string{"deviceId": regId}
-	if err := daemon.DefaultManager.CallAPI("POST", "/api/devices/unregister", req, nil); err != nil {
-		errMsg := err.Error()
-		if strings.Contains(errMsg, "failed to resolve device identifiers") || strings.Contains(errMsg, "status 404") {
+	if err := unregisterServerDevice(regId); err != nil {
+		if strings.Contains(err.Error(), "failed to resolve device identifiers") || serverclient.StatusCode(err) == http.StatusNotFound {
 			fmt.Println("Local device is not currently registered.")
 			_ = writeLocalRegId("")
 			return nil
@@ -170,23 +204,15 @@ func unregisterLocalDevice() error {
 
 func unregisterDevice(deviceKey string) error {
 	// Get device info first to show details
-	var response struct {
-		Success bool        `json:"success"`
-		Devices []DeviceDTO `json:"devices"`
-	}
-
-	if err := daemon.DefaultManager.CallAPI("GET", "/api/devices", nil, &response); err != nil {
-		return fmt.Errorf("failed to get available devices: %v", err)
-	}
-
-	if !response.Success {
-		return fmt.Errorf("failed to get devices from server")
+	devices, err := listServerDevices()
+	if err != nil {
+		return err
 	}
 
 	// Find the device to get its details
 	var target *DeviceDTO
-	for i := range response.Devices {
-		d := &response.Devices[i]
+	for i := range devices {
+		d := &devices[i]
 		if deviceKey == d.TransportID || deviceKey == d.Serialno {
 			target = d
 			break
@@ -216,8 +242,7 @@ func unregisterDevice(deviceKey string) error {
 
 	fmt.Printf("Unregistering %s (%s, %s)...\n", deviceKey, model, connectionType)
 
-	req := map[string]string{"deviceId": deviceKey}
-	if err := daemon.DefaultManager.CallAPI("POST", "/api/devices/unregister", req, nil); err != nil {
+	if err := unregisterServerDevice(deviceKey); err != nil {
 		return fmt.Errorf("failed to unregister device: %v", err)
 	}
 
@@ -230,24 +255,25 @@ func unregisterDevice(deviceKey string) error {
 	return nil
 }
 
-func runInteractiveUnregisterSelection() error {
-	// Get devices from daemon manager
-	var response struct {
-		Success bool        `json:"success"`
-		Devices []DeviceDTO `json:"devices"`
-	}
-
-	if err := daemon.DefaultManager.CallAPI("GET", "/api/devices", nil, &response); err != nil {
-		return fmt.Errorf("failed to get available devices: %v", err)
+// unregisterServerDevice unregisters a device through the local server
+func unregisterServerDevice(deviceID string) error {
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return err
 	}
+	return client.UnregisterDevice(deviceID)
+}
 
-	if !response.Success {
-		return fmt.Errorf("failed to get devices from server")
+func runInteractiveUnregisterSelection() error {
+	// Get devices from daemon manager
+	devices, err := listServerDevices()
+	if err != nil {
+		return err
 	}
 
 	// Filter only registered devices
 	var registeredDevices []DeviceDTO
-	for _, device := range response.Devices {
+	for _, device := range devices {
 		if device.IsRegistered {
 			registeredDevices = append(registeredDevices, device)
 		}
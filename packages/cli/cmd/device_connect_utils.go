@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
 	"github.com/fatih/color"
 )
 
@@ -22,8 +23,7 @@ func printDeveloperModeHint() {
 }
 
 func checkAdbInstalled() bool {
-	_, err := exec.LookPath("adb")
-	return err == nil
+	return adbserver.Default().Installed()
 }
 
 func checkFrpcInstalled() bool {
@@ -93,7 +93,7 @@ func ensureADBKeyboardAPK() (string, error) {
 // isADBKeyboardInstalled reports whether the ADB Keyboard package is installed on the device.
 // Uses: adb -s deviceID shell pm list packages and checks for package:com.android.adbkeyboard.
 func isADBKeyboardInstalled(deviceID string) (bool, error) {
-	cmd := exec.Command("adb", "-s", deviceID, "shell", "pm", "list", "packages")
+	cmd := adbserver.Default().Command("-s", deviceID, "shell", "pm", "list", "packages")
 	output, err := cmd.Output()
 	if err != nil {
 		return false, fmt.Errorf("pm list packages: %w", err)
@@ -116,7 +116,7 @@ func ensureADBKeyboardOnDevice(deviceID string) error {
 	if installed {
 		return nil
 	}
-	cmd := exec.Command("adb", "-s", deviceID, "install", "-r", apkPath)
+	cmd := adbserver.Default().Command("-s", deviceID, "install", "-r", apkPath)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("install ADBKeyboard.apk: %v: %s", err, strings.TrimSpace(string(out)))
 	}
@@ -135,7 +135,7 @@ func uninstallADBKeyboardFromDevice(deviceID string) error {
 	if !installed {
 		return nil
 	}
-	cmd := exec.Command("adb", "-s", deviceID, "uninstall", adbKeyboardPkg)
+	cmd := adbserver.Default().Command("-s", deviceID, "uninstall", adbKeyboardPkg)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("uninstall ADB Keyboard: %v: %s", err, strings.TrimSpace(string(out)))
 	}
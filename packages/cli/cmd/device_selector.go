@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/spf13/cobra"
+)
+
+// addSelectorFlag adds the --selector flag of commands that find devices by label
+func addSelectorFlag(cmd *cobra.Command, selector *string, usage string) {
+	cmd.Flags().StringVarP(selector, "selector", "l", "", usage)
+}
+
+// selectServerDevices lists the devices whose labels match selector through
+// the local server, only the free ones when free is set
+func selectServerDevices(selector string, free bool) ([]DeviceDTO, error) {
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := client.SelectDevices(selector, free)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get available devices: %v", err)
+	}
+	return devices, nil
+}
+
+// pickDevice returns any free device matching selector that accept takes,
+// accept may be nil
+func pickDevice(selector string, accept func(DeviceDTO) bool) (*DeviceDTO, error) {
+	devices, err := selectServerDevices(selector, true)
+	if err != nil {
+		return nil, err
+	}
+	for i := range devices {
+		if accept == nil || accept(devices[i]) {
+			return &devices[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no free device matches selector %q", selector)
+}
+
+// selectedDeviceKey returns how device commands address a device: its
+// transport ID, else its serialno
+func selectedDeviceKey(d DeviceDTO) string {
+	if d.TransportID != "" {
+		return d.TransportID
+	}
+	return d.Serialno
+}
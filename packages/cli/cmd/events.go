@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// EventsOptions holds the flags of gbox events
+type EventsOptions struct {
+	Types   []string
+	Subject string
+	Since   uint64
+	Output  output.Options
+}
+
+func NewEventsCommand() *cobra.Command {
+	opts := &EventsOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Stream device and tunnel events from the local gbox server",
+		Long: `Stream device and tunnel events from the local gbox server until interrupted.
+
+Events cover adb device state changes, devices quarantined by health checks and
+released again, access point connects and disconnects, reconnect attempts, cooldowns and give-ups, stream subscribers joining and leaving, and
+adb-expose port forward status. Select types with --type, either a full type
+such as reconnect.gave_up or a group such as reconnect.
+
+Every event has an ID. If the connection drops, gbox events resumes after the
+last event it printed; pass --since to resume a previous run.
+
+Available types:
+  ` + strings.Join(eventTypeNames(), "\n  "),
+		Example: `  gbox events
+  gbox events --type device,ap --device emulator-5554
+  gbox events --type reconnect.gave_up -o json
+  gbox events -o jsonpath='{.type} {.subject}'
+  gbox events --since 42`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEvents(cmd.Context(), opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVarP(&opts.Types, "type", "t", nil, "Event types or groups to show (comma separated)")
+	flags.StringVarP(&opts.Subject, "device", "d", "", "Only show events about this device serial or box ID")
+	flags.Uint64Var(&opts.Since, "since", 0, "Resume after this event ID, replaying the events the server still retains")
+
+	cmd.RegisterFlagCompletionFunc("type", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return eventTypeNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	addOutputFlags(cmd, &opts.Output, false)
+
+	return cmd
+}
+
+func runEvents(ctx context.Context, opts *EventsOptions) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	query := url.Values{}
+	if len(opts.Types) > 0 {
+		query.Set("type", strings.Join(opts.Types, ","))
+	}
+	if opts.Subject != "" {
+		query.Set("subject", opts.Subject)
+	}
+
+	lastID := opts.Since
+	retry := time.Second
+	for {
+		received, err := streamEvents(ctx, query, lastID, func(e events.Event) error {
+			lastID = e.ID
+			return printEvent(os.Stdout, e, &opts.Output)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if received {
+			retry = time.Second
+		}
+		if err == nil {
+			err = errors.New("server closed the stream")
+		}
+		fmt.Fprintf(os.Stderr, "Event stream interrupted: %v, reconnecting in %s\n", err, retry)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retry):
+		}
+		if retry < 30*time.Second {
+			retry *= 2
+		}
+	}
+}
+
+// streamEvents reads events after lastID until the stream ends, reporting
+// whether any event was received
+func streamEvents(ctx context.Context, query url.Values, lastID uint64, fn func(events.Event) error) (bool, error) {
+	client, err := daemon.DefaultManager.Client()
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.Events(ctx, query, lastID)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	received := false
+	err = events.ReadSSE(resp.Body, func(e events.Event) error {
+		received = true
+		return fn(e)
+	})
+	return received, err
+}
+
+// printEvent writes an event in the selected format, JSON one event per line
+func printEvent(w io.Writer, e events.Event, opts *output.Options) error {
+	return opts.PrintStreamItem(w, e, func(w io.Writer) error {
+		return printEventText(w, e)
+	})
+}
+
+func printEventText(w io.Writer, e events.Event) error {
+
+	keys := make([]string, 0, len(e.Data))
+	for k := range e.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%v", k, e.Data[k]))
+	}
+
+	subject := e.Subject
+	if subject == "" {
+		subject = "-"
+	}
+	_, err := fmt.Fprintf(w, "%s  %-6d %-26s %-20s %s\n",
+		e.Time.Local().Format("15:04:05.000"), e.ID, e.Type, subject, strings.Join(fields, " "))
+	return err
+}
+
+func eventTypeNames() []string {
+	names := make([]string, len(events.Types))
+	for i, t := range events.Types {
+		names[i] = string(t)
+	}
+	return names
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
+	"golang.org/x/term"
 )
 
 const (
@@ -48,6 +49,16 @@ var (
 	}
 )
 
+// LoginOptions holds the flags of gbox login
+type LoginOptions struct {
+	WithToken    bool
+	Org          string
+	KeyName      string
+	KeyExpiresIn time.Duration
+}
+
+var loginOpts LoginOptions
+
 type TokenResponse struct {
 	Token string `json:"token"`
 }
@@ -121,12 +132,36 @@ func startLocalServer(codeChan chan string, errorChan chan error) {
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Login using GitHub OAuth",
-	Long:  `Authenticate using GitHub OAuth. This will detect your environment and use the appropriate authentication method.`,
+	Long: `Authenticate using GitHub OAuth. This will detect your environment and use the appropriate authentication method.
+
+For scripts and CI, pass a GitHub token on stdin with --with-token and choose
+the organization with --org. Each login creates an API key for the selected
+organization; name it with --key-name and limit its lifetime with
+--key-expires-in. Once the key expires, commands ask you to log in again.`,
+	Example: `  gbox login
+  echo "$GITHUB_TOKEN" | gbox login --with-token --org my-team
+  gbox login --with-token --org my-team --key-name ci-runner --key-expires-in 24h < token.txt`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
 
 		logger := clilog.New()
 
+		if loginOpts.KeyExpiresIn < 0 {
+			return fmt.Errorf("--key-expires-in must not be negative")
+		}
+
+		if loginOpts.WithToken {
+			accessToken, err := readTokenFromStdin()
+			if err != nil {
+				return err
+			}
+			if _, err := getLocalToken(accessToken); err != nil {
+				return fmt.Errorf("failed to get local token: %v", err)
+			}
+			return nil
+		}
+
 		// Check if GitHub client secret is available
 		hasClientSecret := config.GetGithubClientSecret() != ""
 
@@ -161,6 +196,22 @@ var loginCmd = &cobra.Command{
 	},
 }
 
+// readTokenFromStdin reads the GitHub token passed with --with-token
+func readTokenFromStdin() (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("--with-token reads the token from stdin, e.g. echo \"$GITHUB_TOKEN\" | gbox login --with-token")
+	}
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token from stdin: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("no token found on stdin")
+	}
+	return token, nil
+}
+
 // authenticateWithBrowser uses OAuth authorization code flow
 func authenticateWithBrowser(ctx context.Context) (string, error) {
 	// Start local server to handle callback
@@ -287,13 +338,27 @@ func getLocalToken(githubToken string) (string, error) {
 			return "", fmt.Errorf("failed to create cloud client: %v", err)
 		}
 
-		// Generate API key name
-		apiKeyName := fmt.Sprintf("gbox-cli-%s", selectedOrg.Name)
-		apiKeyInfo, err = client.CreateAPIKey(apiKeyName, selectedOrg.ID)
+		apiKeyName := loginOpts.KeyName
+		if apiKeyName == "" {
+			apiKeyName = fmt.Sprintf("gbox-cli-%s", selectedOrg.Name)
+		}
+		request := cloud.CreateAPIKeyRequest{KeyName: apiKeyName, OrgID: selectedOrg.ID}
+		if loginOpts.KeyExpiresIn > 0 {
+			request.ExpiresAt = time.Now().Add(loginOpts.KeyExpiresIn).UTC().Format(time.RFC3339)
+		}
+		apiKeyInfo, err = client.CreateAPIKey(request)
 		if err != nil {
 			return "", fmt.Errorf("failed to create API key: %v", err)
 		}
-		fmt.Printf("Created API key: %s.\n", apiKeyInfo.KeyName)
+		if apiKeyInfo.ExpiresAt == "" {
+			// Older servers do not echo the expiry back
+			apiKeyInfo.ExpiresAt = request.ExpiresAt
+		}
+		if apiKeyInfo.ExpiresAt != "" {
+			fmt.Printf("Created API key: %s, expires at %s.\n", apiKeyInfo.KeyName, apiKeyInfo.ExpiresAt)
+		} else {
+			fmt.Printf("Created API key: %s.\n", apiKeyInfo.KeyName)
+		}
 		fmt.Println("Login process successfully.")
 	}
 
@@ -332,6 +397,16 @@ func getLocalToken(githubToken string) (string, error) {
 			return "", fmt.Errorf("failed to add profile: %v", err)
 		}
 
+		var expiresAt time.Time
+		if apiKeyInfo.ExpiresAt != "" {
+			if expiresAt, err = time.Parse(time.RFC3339, apiKeyInfo.ExpiresAt); err != nil {
+				return "", fmt.Errorf("invalid API key expiry %q: %v", apiKeyInfo.ExpiresAt, err)
+			}
+		}
+		if _, err := pm.RecordAPIKey(apiKeyInfo.APIKey, apiKeyInfo.ID, expiresAt); err != nil {
+			return "", fmt.Errorf("failed to save API key details: %v", err)
+		}
+
 		// Print success message with current profile info
 		currentProfile := pm.GetCurrent()
 		if currentProfile != nil {
@@ -390,7 +465,7 @@ func selectOrganization(token string) (*cloud.Organization, error) {
 
 		// init API Key for this organization
 		keyName := fmt.Sprintf("gbox-cli-%s", created.Name)
-		apiKeyInfo, err := client.CreateAPIKey(keyName, created.ID)
+		apiKeyInfo, err := client.CreateAPIKey(cloud.CreateAPIKeyRequest{KeyName: keyName, OrgID: created.ID})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create API key for default organization: %v", err)
 		}
@@ -399,12 +474,25 @@ func selectOrganization(token string) (*cloud.Organization, error) {
 		return created, nil
 	}
 
+	if loginOpts.Org != "" {
+		org, err := findOrganization(organizations, loginOpts.Org)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Selected organization: %s (%s)\n", org.Name, org.ID)
+		return org, nil
+	}
+
 	if len(organizations) == 1 {
 		org := organizations[0]
 		fmt.Printf("Automatically selected organization: %s (%s)\n", org.Name, org.ID)
 		return &org, nil
 	}
 
+	if loginOpts.WithToken || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("you belong to %d organizations, choose one with --org (%s)", len(organizations), organizationSlugs(organizations))
+	}
+
 	fmt.Println("Available organizations:")
 	for i, org := range organizations {
 		fmt.Printf("%d. %s (%s)\n", i+1, org.Name, org.ID)
@@ -436,6 +524,39 @@ func selectOrganization(token string) (*cloud.Organization, error) {
 	}
 }
 
+// findOrganization looks up an organization by slug, ID or name
+func findOrganization(organizations []cloud.Organization, ref string) (*cloud.Organization, error) {
+	for i, org := range organizations {
+		if org.Slug == ref || org.ID == ref {
+			return &organizations[i], nil
+		}
+	}
+	for i, org := range organizations {
+		if strings.EqualFold(org.Name, ref) {
+			return &organizations[i], nil
+		}
+	}
+	return nil, fmt.Errorf("organization '%s' not found (available: %s)", ref, organizationSlugs(organizations))
+}
+
+// organizationSlugs lists the organizations by slug, or ID when they have none
+func organizationSlugs(organizations []cloud.Organization) string {
+	refs := make([]string, len(organizations))
+	for i, org := range organizations {
+		refs[i] = org.Slug
+		if refs[i] == "" {
+			refs[i] = org.ID
+		}
+	}
+	return strings.Join(refs, ", ")
+}
+
 func init() {
+	flags := loginCmd.Flags()
+	flags.BoolVar(&loginOpts.WithToken, "with-token", false, "Read a GitHub token from stdin instead of opening a browser")
+	flags.StringVar(&loginOpts.Org, "org", "", "Organization to log in to, by slug, ID or name")
+	flags.StringVar(&loginOpts.KeyName, "key-name", "", "Name of the API key created for this login (default gbox-cli-<organization>)")
+	flags.DurationVar(&loginOpts.KeyExpiresIn, "key-expires-in", 0, "Lifetime of the API key created for this login, e.g. 720h (default no expiry)")
+
 	rootCmd.AddCommand(loginCmd)
 }
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindOrganization(t *testing.T) {
+	orgs := []cloud.Organization{
+		{ID: "org_1", Name: "Acme", Slug: "acme"},
+		{ID: "org_2", Name: "Acme QA", Slug: "acme-qa"},
+		{ID: "org_3", Name: "Legacy"},
+	}
+
+	for ref, want := range map[string]string{"acme-qa": "org_2", "org_1": "org_1", "legacy": "org_3", "ACME": "org_1"} {
+		org, err := findOrganization(orgs, ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, want, org.ID, ref)
+	}
+
+	_, err := findOrganization(orgs, "missing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "acme, acme-qa, org_3")
+}
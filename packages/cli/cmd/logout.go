@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/cloud"
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+type LogoutOptions struct {
+	All bool
+}
+
+func NewLogoutCommand() *cobra.Command {
+	opts := &LogoutOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "logout [profile-id]",
+		Short: "Revoke the API key of a profile and remove its credentials",
+		Long: `Revoke the API key of a profile and remove the profile.
+
+Without arguments the current profile is logged out. API keys created by
+'gbox login' are revoked on the server while the login session is valid;
+keys added with 'gbox profile add' are only removed locally. The login
+session itself is removed once no profiles are left, or with --all.`,
+		Example: `  gbox logout
+  gbox logout my-team
+  gbox logout --all`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.All && len(args) > 0 {
+				return fmt.Errorf("--all cannot be combined with a profile ID")
+			}
+			return runLogout(opts, args)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.All, "all", false, "Log out of all profiles and remove the login session")
+
+	return cmd
+}
+
+func runLogout(opts *LogoutOptions, args []string) error {
+	pm := profile.NewProfileManager()
+	if err := pm.Load(); err != nil {
+		return err
+	}
+
+	var ids []string
+	switch {
+	case opts.All:
+		ids = pm.GetProfileIDs()
+		sort.Strings(ids)
+	case len(args) > 0:
+		if !pm.ProfileExists(args[0]) {
+			return fmt.Errorf(profile.ErrProfileNotFound, args[0])
+		}
+		ids = []string{args[0]}
+	default:
+		if id := pm.GetCurrentProfileID(); id != "" && pm.ProfileExists(id) {
+			ids = []string{id}
+		}
+	}
+
+	sessionToken := readSessionToken()
+	if len(ids) == 0 && sessionToken == "" {
+		fmt.Println("Not logged in")
+		return nil
+	}
+
+	// revokeErr is set once keys can no longer be revoked
+	var client *cloud.Client
+	var revokeErr error
+	if sessionToken != "" {
+		client, revokeErr = cloud.NewClient(sessionToken)
+	} else {
+		revokeErr = errors.New("no login session found")
+	}
+
+	for _, id := range ids {
+		if p := pm.GetProfile(id); p != nil && p.KeyID != "" {
+			err := revokeErr
+			if err == nil {
+				err = client.DeleteAPIKey(p.KeyID)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not revoke the API key of profile '%s': %v. Revoke it in the GBOX dashboard.\n", id, err)
+				if errors.Is(err, cloud.ErrSessionExpired) {
+					revokeErr = err
+				}
+			} else {
+				fmt.Printf("Revoked API key of profile '%s'\n", id)
+			}
+		}
+
+		if err := pm.RemoveAndSwitch(id); err != nil {
+			return err
+		}
+		fmt.Printf("Logged out of profile '%s'\n", id)
+	}
+
+	if opts.All || pm.GetProfileCount() == 0 {
+		if err := os.Remove(credentialsPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove login session: %v", err)
+		}
+	} else if current := pm.GetCurrentProfileID(); current != "" {
+		fmt.Printf("Current profile: \033[32m%s\033[0m\n", current)
+	}
+
+	return nil
+}
+
+// readSessionToken returns the login session token saved by gbox login
+func readSessionToken() string {
+	data, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return ""
+	}
+	var credentials map[string]string
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return ""
+	}
+	return credentials["token"]
+}
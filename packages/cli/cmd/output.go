@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// outputFormatHelp describes the values of -o
+const outputFormatHelp = "Output format: table, wide, json, yaml, jsonpath=TEMPLATE or go-template=TEMPLATE"
+
+// addOutputFlags registers -o on cmd, and for list commands the column
+// selection, sorting and header flags
+func addOutputFlags(cmd *cobra.Command, opts *output.Options, list bool) {
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.Format, "output", "o", output.FormatTable, outputFormatHelp)
+	if list {
+		flags.StringSliceVar(&opts.Columns, "columns", nil, "Comma separated columns to show in table output (e.g. id,status)")
+		flags.StringVar(&opts.SortBy, "sort-by", "", "Sort the list by a column")
+		flags.BoolVar(&opts.NoHeaders, "no-headers", false, "Omit the table header")
+	}
+
+	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var formats []string
+		directive := cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+		for _, f := range output.Formats {
+			if strings.HasPrefix(f, toComplete) {
+				formats = append(formats, f)
+				if !strings.HasSuffix(f, "=") {
+					// Only templates continue after the completed word
+					directive = cobra.ShellCompDirectiveNoFileComp
+				}
+			}
+		}
+		return formats, directive
+	})
+}
@@ -3,7 +3,11 @@ package cmd
 import (
 	"encoding/base64"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
 	"github.com/babelcloud/gbox/packages/cli/internal/profile"
 	"github.com/spf13/cobra"
 )
@@ -11,7 +15,29 @@ import (
 var profileCmd = &cobra.Command{
 	Use:   "profile",
 	Short: "Manage configuration profiles",
-	Long:  `Manage configuration information in profile file, including API key, organization name, etc.`,
+	Long: `Manage configuration information in profile file, including API key, organization name, etc.
+
+API keys are not kept in the profile file. They are stored in the system keyring
+(Secret Service on Linux, Keychain on macOS) when available, and otherwise in an
+encrypted credentials file next to the profile file. Existing keys are moved there
+automatically.
+
+The profile in effect is selected by, in order of precedence: the GBOX_PROFILE
+environment variable, the 'profile' key of the nearest .gbox.toml in the working
+directory or its parents, and the current profile set by 'gbox profile use'.
+
+A .gbox.toml can also override box defaults for the project:
+  profile = "staging"
+
+  [box]
+  expires_in = "2h"
+  labels = { project = "myapp" }
+
+Environment variables:
+  GBOX_PROFILE                 Profile to use, overriding .gbox.toml and 'gbox profile use'
+  GBOX_CREDENTIAL_STORE        Where to store API keys: keyring, file or plain
+  GBOX_CREDENTIALS_PASSPHRASE  Encrypt the credentials file with a passphrase
+                               instead of a key derived from this machine`,
 }
 
 var profileListCmd = &cobra.Command{
@@ -23,14 +49,16 @@ var profileListCmd = &cobra.Command{
 			return err
 		}
 
-		format, _ := cmd.Flags().GetString("format")
-		pm.List(format)
-		return nil
+		return pm.List(&profileListOutput)
 	},
 }
 
+var profileListOutput output.Options
+
 func init() {
-	profileListCmd.Flags().StringP("format", "f", "table", "Output format (table|json)")
+	addOutputFlags(profileListCmd, &profileListOutput, true)
+	profileListCmd.Flags().StringVarP(&profileListOutput.Format, "format", "f", output.FormatTable, "Output format")
+	profileListCmd.Flags().MarkDeprecated("format", "use --output instead")
 }
 
 // addManually manually input profile information
@@ -126,6 +154,9 @@ var profileUseCmd = &cobra.Command{
 		}
 
 		fmt.Printf("Switched to profile '%s'\n", profileID)
+		if sel := pm.Selection(); sel.Source != profile.SourceCurrent && sel.ID != profileID {
+			fmt.Printf("Note: profile '%s' is still in effect here, selected by %s\n", sel.ID, sel.Describe())
+		}
 		return nil
 	},
 }
@@ -160,14 +191,19 @@ var profileCurrentCmd = &cobra.Command{
 			return err
 		}
 
+		sel := pm.Selection()
 		current := pm.GetCurrent()
 		if current == nil {
+			if sel.ID != "" {
+				return fmt.Errorf("profile '%s' selected by %s not found", sel.ID, sel.Describe())
+			}
 			fmt.Println("No current profile set")
 			return nil
 		}
 
 		fmt.Println("Current Profile:")
-		fmt.Printf("  Profile ID: %s\n", pm.GetCurrentProfileID())
+		fmt.Printf("  Profile ID: %s\n", sel.ID)
+		fmt.Printf("  Selected by: %s\n", sel.Describe())
 		fmt.Printf("  Organization: %s\n", current.GetOrgName())
 		// Decode API key for display
 		decodedBytes, err := base64.StdEncoding.DecodeString(current.APIKey)
@@ -182,6 +218,7 @@ var profileCurrentCmd = &cobra.Command{
 		if current.BaseURL != "" && current.BaseURL != pm.GetDefaultBaseURL() {
 			fmt.Printf("  Base URL: %s\n", current.BaseURL)
 		}
+		printBoxDefaults(pm.GetBoxDefaults())
 		return nil
 	},
 }
@@ -221,16 +258,135 @@ var profileGetCmd = &cobra.Command{
 	},
 }
 
+var profileDefaultsCmd = &cobra.Command{
+	Use:   "defaults [profile-id]",
+	Short: "Show or set box defaults of a profile",
+	Long: `Show or set the defaults 'gbox box create' uses with a profile.
+
+Without flags the defaults are shown. Flags given on 'gbox box create' and the
+[box] section of a project's .gbox.toml take precedence over these defaults.`,
+	Example: `  gbox profile defaults                                   # Show defaults of the current profile
+  gbox profile defaults staging --expires-in 2h --label team=qa
+  gbox profile defaults staging --device-type physical
+  gbox profile defaults staging --clear`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pm := profile.NewProfileManager()
+		if err := pm.Load(); err != nil {
+			return err
+		}
+
+		profileID := pm.GetCurrentProfileID()
+		if len(args) > 0 {
+			profileID = args[0]
+		}
+		p := pm.GetProfile(profileID)
+		if p == nil {
+			return fmt.Errorf("profile '%s' not found", profileID)
+		}
+
+		flags := cmd.Flags()
+		clear, _ := flags.GetBool("clear")
+		if !clear && !flags.Changed("label") && !flags.Changed("expires-in") && !flags.Changed("device-type") {
+			fmt.Printf("Profile '%s':\n", profileID)
+			if p.Box.IsEmpty() {
+				fmt.Println("  No box defaults set")
+			}
+			printBoxDefaults(p.Box)
+			return nil
+		}
+
+		defaults := p.Box
+		if clear {
+			defaults = profile.BoxDefaults{}
+		}
+		if flags.Changed("expires-in") {
+			defaults.ExpiresIn, _ = flags.GetString("expires-in")
+			if defaults.ExpiresIn != "" {
+				if _, err := time.ParseDuration(defaults.ExpiresIn); err != nil {
+					return fmt.Errorf("invalid expires-in format: %s (must be duration like '30s', '5m', '1h')", defaults.ExpiresIn)
+				}
+			}
+		}
+		if flags.Changed("device-type") {
+			defaults.DeviceType, _ = flags.GetString("device-type")
+			if defaults.DeviceType != "" && defaults.DeviceType != "virtual" && defaults.DeviceType != "physical" {
+				return fmt.Errorf("invalid device type: %s (must be 'virtual' or 'physical')", defaults.DeviceType)
+			}
+		}
+		if flags.Changed("label") {
+			labels, _ := flags.GetStringArray("label")
+			merged := make(map[string]string, len(defaults.Labels)+len(labels))
+			for k, v := range defaults.Labels {
+				merged[k] = v
+			}
+			for _, label := range labels {
+				key, value, ok := strings.Cut(label, "=")
+				if !ok || key == "" {
+					return fmt.Errorf("invalid label format: %s (must be KEY=VALUE, or KEY= to remove)", label)
+				}
+				if value == "" {
+					delete(merged, key)
+				} else {
+					merged[key] = value
+				}
+			}
+			defaults.Labels = merged
+			if len(merged) == 0 {
+				defaults.Labels = nil
+			}
+		}
+
+		if err := pm.SetBoxDefaults(profileID, defaults); err != nil {
+			return err
+		}
+		fmt.Printf("Updated box defaults of profile '%s'\n", profileID)
+		printBoxDefaults(defaults)
+		return nil
+	},
+}
+
+// printBoxDefaults prints the box defaults that are set
+func printBoxDefaults(defaults profile.BoxDefaults) {
+	if defaults.IsEmpty() {
+		return
+	}
+	fmt.Println("  Box defaults:")
+	if defaults.DeviceType != "" {
+		fmt.Printf("    Device type: %s\n", defaults.DeviceType)
+	}
+	if defaults.ExpiresIn != "" {
+		fmt.Printf("    Expires in: %s\n", defaults.ExpiresIn)
+	}
+	if len(defaults.Labels) > 0 {
+		keys := make([]string, 0, len(defaults.Labels))
+		for k := range defaults.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Println("    Labels:")
+		for _, k := range keys {
+			fmt.Printf("      %s=%s\n", k, defaults.Labels[k])
+		}
+	}
+}
+
 func init() {
 	// Add command line arguments for profileAddCmd
 	profileAddCmd.Flags().StringP("key", "k", "", "API key")
 
+	profileDefaultsCmd.Flags().StringArrayP("label", "l", nil, "Default label in KEY=VALUE format (KEY= removes it)")
+	profileDefaultsCmd.Flags().String("expires-in", "", "Default box expiration time (e.g., 30m, 2h), empty to unset")
+	profileDefaultsCmd.Flags().StringP("device-type", "d", "", "Default device type (virtual or physical), empty to unset")
+	profileDefaultsCmd.Flags().Bool("clear", false, "Remove all box defaults before applying the other flags")
+
 	profileCmd.AddCommand(profileListCmd)
 	profileCmd.AddCommand(profileAddCmd)
 	profileCmd.AddCommand(profileUseCmd)
 	profileCmd.AddCommand(profileDeleteCmd)
 	profileCmd.AddCommand(profileCurrentCmd)
 	profileCmd.AddCommand(profileGetCmd)
+	profileCmd.AddCommand(profileDefaultsCmd)
 	rootCmd.AddCommand(profileCmd)
 }
 
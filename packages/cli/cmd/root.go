@@ -25,8 +25,11 @@ var (
 		Use:   "gbox",
 		Short: "GBOX CLI Tool",
 		Long: `GBOX CLI is a command-line tool for managing and operating box and mcp resources. It provides a set of commands to create, manage, and operate these resources.`,
+		// main reports errors, and exits with the code of an ExitError silently
+		SilenceErrors: true,
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			// Initialize logger based on verbose flag
+			// Initialize logger based on verbose flag or the log.verbose setting
+			verbose = config.GetVerbose()
 			util.InitLogger(verbose)
 			// Setup global logger for existing log.Printf calls
 			util.SetupGlobalLogger()
@@ -74,6 +77,7 @@ func init() {
 	}
 
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Enable verbose logging")
+	config.BindFlag("log.verbose", rootCmd.PersistentFlags().Lookup("verbose"))
 	rootCmd.Flags().BoolP("version", "v", false, "Print version information and exit")
 
 	for alias, cmd := range aliasMap {
@@ -86,6 +90,9 @@ func init() {
 	rootCmd.AddCommand(NewAdbExposeCommand())
 	rootCmd.AddCommand(NewDeviceConnectCommand())
 	rootCmd.AddCommand(NewPruneCommand())
+	rootCmd.AddCommand(NewConfigCommand())
+	rootCmd.AddCommand(NewLogoutCommand())
+	rootCmd.AddCommand(NewEventsCommand())
 
 	// Add unified server command with subcommands
 	rootCmd.AddCommand(NewServerCmd())
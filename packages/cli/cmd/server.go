@@ -1,23 +1,18 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
-	"path/filepath"
-	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
-	procgroup "github.com/babelcloud/gbox/packages/cli/internal/proc_group"
 	"github.com/babelcloud/gbox/packages/cli/internal/server"
-	"github.com/google/uuid"
+	"github.com/babelcloud/gbox/packages/cli/internal/version"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -34,6 +29,8 @@ func NewServerCmd() *cobra.Command {
 	cmd.AddCommand(newServerStopCmd())
 	cmd.AddCommand(newServerStatusCmd())
 	cmd.AddCommand(newServerRestartCmd())
+	cmd.AddCommand(newServerInstallServiceCmd())
+	cmd.AddCommand(newServerUninstallServiceCmd())
 
 	return cmd
 }
@@ -48,9 +45,14 @@ func newServerStartCmd() *cobra.Command {
 	)
 
 	cmd := &cobra.Command{
-		Use:           "start",
-		Short:         "Start the server",
-		Long:          `Start the gbox server if it's not already running.`,
+		Use:   "start",
+		Short: "Start the server",
+		Long: `Start the gbox server if it's not already running.
+
+With server.local_only set, or GBOX_LOCAL_ONLY=true, the server serves the
+attached devices without a gbox profile: devices are neither registered nor
+connected to the cloud, e.g. on air-gapped lab machines. A running server in
+the other mode is restarted in the mode asked for.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -72,11 +74,14 @@ func newServerStartCmd() *cobra.Command {
   gbox server start -f
 
   # Start server on specific port
-  gbox server start -p 8080`,
+  gbox server start -p 8080
+
+  # Serve the attached devices without the cloud
+  GBOX_LOCAL_ONLY=true gbox server start`,
 	}
 
 	flags := cmd.Flags()
-	flags.IntVarP(&port, "port", "p", 29888, "Server port")
+	flags.IntVarP(&port, "port", "p", daemon.DefaultPort, "Server port")
 	flags.BoolVarP(&foreground, "foreground", "f", false, "Run server in foreground (show logs)")
 
 	// Flag --internal-daemon is hidden in help message for internal use.
@@ -93,71 +98,102 @@ func newServerStopCmd() *cobra.Command {
 	var (
 		port  int
 		force bool
+		drain time.Duration
 	)
 
 	cmd := &cobra.Command{
-		Use:           "stop",
-		Short:         "Stop the server",
-		Long:          `Stop the gbox server if it's running.`,
+		Use:   "stop",
+		Short: "Stop the server",
+		Long: `Stop the gbox server if it's running.
+
+Active device streams and control sessions get up to --drain to finish before
+the server exits.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return stopServer(port, force)
+			return stopServer(port, force, drain)
 		},
 		Example: `  # Stop the server
   gbox server stop
 
+  # Stop right away, cutting active streams
+  gbox server stop --drain 0
+
   # Stop server running on specified port
   gbox server stop --port 29888
   gbox server stop -p 29888`,
 	}
 
 	flags := cmd.Flags()
-	flags.IntVarP(&port, "port", "p", 29888, "Server port")
-	flags.BoolVarP(&force, "force", "f", false, "Force stop all server processes")
+	flags.IntVarP(&port, "port", "p", daemon.DefaultPort, "Server port")
+	flags.BoolVarP(&force, "force", "f", false, "Do not fail if the server is not running")
+	flags.DurationVar(&drain, "drain", daemon.DefaultDrainTimeout, "How long active streams may finish before the server exits")
 
 	return cmd
 }
 
 // newServerStatusCmd creates the 'server status' subcommand
 func newServerStatusCmd() *cobra.Command {
+	var port int
+
 	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Check server status",
 		Long:  `Check if the gbox server is running and display its status.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			dm := daemon.NewManager()
-
-			if dm.IsServerRunning() {
-				fmt.Println("✅ Server is running")
-				fmt.Printf("   Web UI: http://localhost:29888\n")
-				fmt.Printf("   API endpoint: http://localhost:29888/api/status\n")
-
-				// Try to get more info from API
-				client := &http.Client{Timeout: 2 * time.Second}
-				if resp, err := client.Get("http://localhost:29888/api/status"); err == nil {
-					defer resp.Body.Close()
-					var status map[string]interface{}
-					if json.NewDecoder(resp.Body).Decode(&status) == nil {
-						if services, ok := status["services"].(map[string]interface{}); ok {
-							fmt.Println("   Services:")
-							for name, active := range services {
-								if active.(bool) {
-									fmt.Printf("     - %s: active\n", name)
-								}
-							}
-						}
+			dm := daemon.NewManagerForPort(port)
+
+			info, err := dm.Info()
+			if err != nil {
+				if errors.Is(err, daemon.ErrServerNotRunning) {
+					fmt.Println("❌ Server is not running")
+					if dm.ServiceInstalled() {
+						fmt.Printf("   Service %s is installed, see 'systemctl --user status %s'\n", dm.ServiceName(), dm.ServiceName())
 					}
+					fmt.Println("   Use 'gbox server start' to start the server")
+					return nil
+				}
+				return err
+			}
+
+			fmt.Println("✅ Server is running")
+			fmt.Printf("   Web UI: %s\n", dm.URL())
+			fmt.Printf("   Version: %s (build %s)\n", info.Version, info.BuildID)
+			if info.PID > 0 {
+				fmt.Printf("   PID: %d\n", info.PID)
+			}
+			fmt.Printf("   Managed by: %s\n", describeSupervisor(dm, info.Supervisor))
+			fmt.Printf("   Uptime: %s\n", info.Uptime)
+			fmt.Printf("   Active streams: %d\n", info.ActiveStreams)
+			if info.LocalOnly {
+				fmt.Println("   Mode: local-only, devices are not registered in the cloud")
+			}
+			if info.Draining {
+				fmt.Println("   Shutting down, waiting for active streams")
+			}
+			if info.BuildID != version.BuildID() {
+				fmt.Printf("   Note: started by a different gbox binary, this one is %s (build %s)\n", version.Version, version.BuildID())
+			}
+
+			// Try to get more info from API
+			client := serverclient.New(dm.URL())
+			client.HTTPClient.Timeout = 2 * time.Second
+			if status, err := client.Status(); err == nil {
+				fmt.Println("   Services:")
+				if status.Services.DeviceConnect {
+					fmt.Println("     - device_connect: active")
+				}
+				if status.Services.ADBExpose {
+					fmt.Println("     - adb_expose: active")
 				}
-			} else {
-				fmt.Println("❌ Server is not running")
-				fmt.Println("   Use 'gbox server start' to start the server")
 			}
 
 			return nil
 		},
 	}
 
+	cmd.Flags().IntVarP(&port, "port", "p", daemon.DefaultPort, "Server port")
+
 	return cmd
 }
 
@@ -166,6 +202,7 @@ func newServerRestartCmd() *cobra.Command {
 	var (
 		port       int
 		foreground bool
+		drain      time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -175,14 +212,18 @@ func newServerRestartCmd() *cobra.Command {
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := stopServer(port, true); err != nil {
-				return err
-			}
 			if foreground {
+				if err := stopServer(port, true, drain); err != nil {
+					return err
+				}
 				// Run in foreground mode
 				return runServerInForeground(port)
 			}
-			return runServerInDaemon(port)
+			if err := daemon.NewManagerForPort(port).Restart(drain); err != nil {
+				return err
+			}
+			fmt.Printf("server has been restarted on port %d\n", port)
+			return nil
 		},
 		Example: `  # Restart the server
   gbox server restart
@@ -196,64 +237,56 @@ func newServerRestartCmd() *cobra.Command {
 	}
 
 	flags := cmd.Flags()
-	flags.IntVarP(&port, "port", "p", 29888, "Server port")
+	flags.IntVarP(&port, "port", "p", daemon.DefaultPort, "Server port")
 	flags.BoolVarP(&foreground, "foreground", "f", false, "Run server in foreground after restart (show logs)")
+	flags.DurationVar(&drain, "drain", daemon.DefaultDrainTimeout, "How long active streams may finish before the server exits")
 
 	return cmd
 }
 
 // Helper functions
 
-// runServerInDaemon runs the server in daemon mode with IPC communication
-func runServerInDaemon(port int) error {
-	if err := checkServerStatus(port); err != nil {
-		if err == ServerMismatchedError {
-			return errors.Wrapf(err, "port %d is already been used", port)
+// describeSupervisor explains what started the server for 'server status'
+func describeSupervisor(dm *daemon.Manager, supervisor string) string {
+	switch supervisor {
+	case daemon.SupervisorSystemd:
+		return fmt.Sprintf("systemd (%s)", dm.ServiceName())
+	case daemon.SupervisorDaemon:
+		if dm.ServiceInstalled() {
+			return fmt.Sprintf("self-daemonized, %s is installed but not running it", dm.ServiceName())
 		}
-	} else {
-		fmt.Printf("server has been already started on port %d\n", port)
-		return nil
+		return "self-daemonized (gbox server start)"
+	case daemon.SupervisorForeground:
+		return "foreground process (gbox server start --foreground)"
+	default:
+		// Servers of older releases do not report a supervisor
+		return "unknown"
 	}
+}
 
-	executable, err := os.Executable()
-	if err != nil {
-		return errors.Wrap(err, "failed to get exectuable")
-	}
-
-	runId := uuid.New()
-	daemonStartLogFilename := filepath.Join(os.TempDir(), "gbox-server-"+runId.String())
-	defer os.RemoveAll(daemonStartLogFilename)
-
-	cmd := exec.Command(executable, "server", "start", "--port", strconv.Itoa(port), "--internal-daemon", "--daemon-start-log-filename", daemonStartLogFilename)
-	procgroup.SetProcGrp(cmd)
-	if err := cmd.Start(); err != nil {
-		return errors.Wrap(err, "failed to start server daemon")
+// runServerInDaemon starts the server in the background through the daemon
+// manager, which replaces a server started by another gbox build or running
+// in another mode than asked for
+func runServerInDaemon(port int) error {
+	dm := daemon.NewManagerForPort(port)
+	if info, err := dm.Info(); err == nil && info.BuildID == version.BuildID() && daemon.ModeMatches(info) {
+		fmt.Printf("server has been already started on port %d\n", port)
+		return nil
 	}
 
-	for range 3 {
-		time.Sleep(time.Second)
-		if err := checkServerStatus(port); err != nil {
-			startLog, err := os.ReadFile(daemonStartLogFilename)
-			if err != nil {
-				continue
-			}
-			return errors.Errorf("fail to start server on port %d: %s", port, string(startLog))
-		}
+	if err := dm.EnsureServerRunning(); err != nil {
+		return err
 	}
 
 	fmt.Printf("server has been started on port %d\n", port)
 	return nil
 }
 
+// runServerInBackground is the server process started by the daemon manager
 func runServerInBackground(port int, startLogFilename string) error {
-	userHome, err := os.UserHomeDir()
-	if err != nil {
-		err := errors.Wrapf(err, "failed to get user home directory")
-		os.WriteFile(startLogFilename, []byte(err.Error()), 0600)
-		return err
-	}
+	dm := daemon.NewManagerForPort(port)
 
-	logFile := filepath.Join(userHome, ".gbox/cli/server.log")
+	logFile := dm.LogFile()
 	logFd, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		err := errors.Wrapf(err, "failed to create log file: %s", logFile)
@@ -266,6 +299,7 @@ func runServerInBackground(port int, startLogFilename string) error {
 	log.SetFlags(log.LstdFlags)
 
 	server := server.NewGBoxServer(port)
+	server.SetPIDFile(dm.PIDFile())
 	if err := server.Start(); err != nil && err != http.ErrServerClosed {
 		err := errors.Wrapf(err, "failed to start server")
 		os.WriteFile(startLogFilename, []byte(err.Error()), 0600)
@@ -274,77 +308,60 @@ func runServerInBackground(port int, startLogFilename string) error {
 	return nil
 }
 
-func checkServerStatus(port int) error {
-	url := fmt.Sprintf("http://localhost:%d/api/health", port)
-	resp, err := http.Get(url)
-	if err != nil {
-		return ServerPortUnavailableError
-	}
-	defer resp.Body.Close()
-	decoder := json.NewDecoder(resp.Body)
-	var body struct {
-		Status  string `json:"status"`
-		Service string `json:"service"`
-	}
-	if err := decoder.Decode(&body); err != nil {
-		return ServerMismatchedError
-	}
-	if body.Service != "gbox-server" {
-		return ServerMismatchedError
-	}
-	return nil
-}
-
-func stopServer(port int, force bool) error {
-	if err := checkServerStatus(port); err != nil && !force {
-		if err == ServerPortUnavailableError {
-			return errors.Errorf("server is not running")
-		}
-		if err == ServerMismatchedError {
-			return errors.Wrapf(err, "port %d is already been used by other process", port)
-		}
-	}
-
-	url := fmt.Sprintf("http://localhost:%d/api/server/shutdown", port)
-	resp, err := http.Post(url, "application/json", nil)
-	if err != nil {
+func stopServer(port int, force bool, drain time.Duration) error {
+	err := daemon.NewManagerForPort(port).StopServer(drain)
+	if errors.Is(err, daemon.ErrServerNotRunning) {
 		if force {
 			return nil
 		}
-		return ServerPortUnavailableError
+		return errors.Errorf("server is not running")
 	}
-	defer resp.Body.Close()
-	io.ReadAll(resp.Body)
-	time.Sleep(1 * time.Second)
-	return nil
+	if errors.Is(err, daemon.ErrPortInUse) {
+		return errors.Wrapf(err, "port %d is already been used by other process", port)
+	}
+	return err
 }
 
+// foregroundStartTimeout is how long a foreground server may take to pass its
+// health check
+const foregroundStartTimeout = 10 * time.Second
+
 func runServerInForeground(port int) error {
-	if err := checkServerStatus(port); err != nil {
-		if err == ServerMismatchedError {
-			return errors.Wrapf(err, "port %d is already been used", port)
+	dm := daemon.NewManagerForPort(port)
+	if info, err := dm.Info(); err == nil {
+		if info.BuildID != version.BuildID() {
+			return errors.Errorf("a server of another gbox build (%s) is running on port %d, stop it with 'gbox server stop' first", info.Version, port)
 		}
-	} else {
 		fmt.Printf("server has been already started on port %d\n", port)
 		return nil
+	} else if errors.Is(err, daemon.ErrPortInUse) {
+		return errors.Wrapf(err, "port %d is already been used", port)
 	}
 
 	server := server.NewGBoxServer(port)
-	errChan := make(chan error)
+	server.SetPIDFile(dm.PIDFile())
+	errChan := make(chan error, 1)
 	go func() {
 		if err := server.Start(); err != nil && err != http.ErrServerClosed {
 			errChan <- err
 		}
 	}()
 
-	for range 3 {
-		time.Sleep(time.Second)
-		if err := checkServerStatus(port); err != nil {
-			select {
-			case startErr := <-errChan:
-				return errors.Wrapf(startErr, "fail to start server on port %d", port)
-			default:
-				continue
+	// Wait for the health check, a start error fails the command at any point
+	deadline := time.After(foregroundStartTimeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case startErr := <-errChan:
+			return errors.Wrapf(startErr, "fail to start server on port %d", port)
+		case <-deadline:
+			server.Stop()
+			return errors.Errorf("server on port %d did not pass its health check within %s", port, foregroundStartTimeout)
+		case <-ticker.C:
+			if _, err := dm.Info(); err == nil {
+				break wait
 			}
 		}
 	}
@@ -360,31 +377,25 @@ func runServerInForeground(port int) error {
 	fmt.Printf("%s🚀 GBOX Local Server%s %s➜ %shttp://localhost:%d%s\n", ColorGreen, ColorReset, ColorCyan, ColorBlue, port, ColorReset)
 	fmt.Printf("%sPress Ctrl+C to stop...%s\n", ColorCyan, ColorReset)
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal, or the server failing
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	select {
+	case <-sigChan:
+	case serveErr := <-errChan:
+		return errors.Wrapf(serveErr, "server on port %d stopped", port)
+	}
 
 	log.Println("Shutting down server...")
+	if daemon.Supervisor() == daemon.SupervisorSystemd {
+		// systemctl stop, let active streams finish like 'gbox server stop' does
+		if remaining := server.Drain(daemon.DefaultDrainTimeout); remaining > 0 {
+			log.Printf("Shutting down with %d active streams", remaining)
+		}
+	}
 	if err := server.Stop(); err != nil {
 		log.Printf("Error stopping server: %v", err)
 	}
 
 	return nil
 }
-
-var ServerPortUnavailableError = &serverPortUnavailableError{}
-
-type serverPortUnavailableError struct{}
-
-func (e *serverPortUnavailableError) Error() string {
-	return "server port unavailable"
-}
-
-var ServerMismatchedError = &serverMismatchedError{}
-
-type serverMismatchedError struct{}
-
-func (e *serverMismatchedError) Error() string {
-	return "server mismatched"
-}
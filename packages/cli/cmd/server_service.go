@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+// serviceEnvVars are passed from the installing shell to the service, so the
+// server finds the same gbox home, credentials and adb as the CLI and runs in
+// the same mode
+var serviceEnvVars = []string{
+	"GBOX_HOME",
+	"GBOX_PROFILE_PATH",
+	"GBOX_CREDENTIAL_STORE",
+	"GBOX_BASE_URL",
+	"GBOX_LOCAL_ONLY",
+	"ANDROID_HOME",
+	"ANDROID_SDK_ROOT",
+	"PATH",
+}
+
+// ServerInstallServiceOptions holds the flags of gbox server install-service
+type ServerInstallServiceOptions struct {
+	Port   int
+	DryRun bool
+}
+
+// newServerInstallServiceCmd creates the 'server install-service' subcommand
+func newServerInstallServiceCmd() *cobra.Command {
+	opts := &ServerInstallServiceOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "install-service",
+		Short: "Run the server as a systemd user service",
+		Long: `Install the gbox server as a systemd user service that starts at login,
+survives logout when lingering is enabled, and is restarted if it crashes.
+
+The unit runs this gbox binary and pins the current profile with GBOX_PROFILE;
+API keys stay in the credential store and are not written to the unit. It
+keeps GBOX_LOCAL_ONLY of the installing shell, so the service runs in the
+same mode. Output goes to the server log file. A server started by 'gbox
+server start' is stopped first. Reinstall after upgrading gbox, switching
+profiles or changing GBOX_LOCAL_ONLY.
+
+To keep the server running without an active login session, enable lingering:
+  loginctl enable-linger $USER`,
+		Example: `  gbox server install-service
+  gbox server install-service --dry-run`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServerInstallService(opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.IntVarP(&opts.Port, "port", "p", daemon.DefaultPort, "Server port")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "Print the unit without installing it")
+
+	return cmd
+}
+
+// newServerUninstallServiceCmd creates the 'server uninstall-service' subcommand
+func newServerUninstallServiceCmd() *cobra.Command {
+	var port int
+
+	cmd := &cobra.Command{
+		Use:           "uninstall-service",
+		Short:         "Stop and remove the systemd user service",
+		Long:          `Stop and disable the gbox server systemd user service and remove its unit file.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dm := daemon.NewManagerForPort(port)
+			if err := dm.UninstallService(); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s, start the server again with 'gbox server start'\n", dm.ServiceName())
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&port, "port", "p", daemon.DefaultPort, "Server port")
+
+	return cmd
+}
+
+func runServerInstallService(opts *ServerInstallServiceOptions) error {
+	dm := daemon.NewManagerForPort(opts.Port)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	serviceOpts := daemon.ServiceOptions{
+		Executable: exe,
+		Port:       opts.Port,
+		Env:        serviceEnv(),
+		LogFile:    dm.LogFile(),
+	}
+	if opts.DryRun {
+		fmt.Print(daemon.RenderUnit(serviceOpts))
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dm.LogFile()), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(dm.LogFile()), err)
+	}
+
+	// The service takes over the port from a self-daemonized server
+	if info, err := dm.Info(); err == nil && info.Supervisor != daemon.SupervisorSystemd {
+		fmt.Println("Stopping the running server so the service can take over")
+		if err := dm.StopServer(daemon.DefaultDrainTimeout); err != nil && !errors.Is(err, daemon.ErrServerNotRunning) {
+			return fmt.Errorf("failed to stop the running server: %v", err)
+		}
+	}
+
+	path, err := dm.InstallService(serviceOpts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s\n", path)
+	fmt.Printf("Server is running as %s, logs in %s\n", dm.ServiceName(), dm.LogFile())
+	return nil
+}
+
+// serviceEnv returns the environment written to the unit
+func serviceEnv() map[string]string {
+	env := map[string]string{}
+	for _, key := range serviceEnvVars {
+		if value := os.Getenv(key); value != "" {
+			env[key] = value
+		}
+	}
+	if env["GBOX_HOME"] == "" {
+		env["GBOX_HOME"] = config.GetGboxHome()
+	}
+	if id := profile.Default.GetCurrentProfileID(); id != "" {
+		env["GBOX_PROFILE"] = id
+	}
+	return env
+}
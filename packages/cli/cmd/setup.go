@@ -8,6 +8,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect"
 )
 
@@ -250,7 +251,7 @@ func getNpmVersion() string {
 
 // getAdbVersion returns the ADB version
 func getAdbVersion() string {
-	cmd := exec.Command("adb", "version")
+	cmd := adbserver.Default().Command("version")
 	output, err := cmd.Output()
 	if err != nil {
 		return ""
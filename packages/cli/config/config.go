@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -17,10 +19,21 @@ var (
 
 const (
 	DefaultBaseURL = "https://gbox.ai/api/v1"
+
+	// Appium components installed unless appium.drivers or appium.plugins
+	// name others
+	DefaultAppiumDrivers = "uiautomator2"
+	DefaultAppiumPlugins = "inspector"
 )
 
 func init() {
+	load()
+}
+
+// load initializes the settings from defaults, environment and config file
+func load() {
 	v = viper.New()
+	flags = map[string]*pflag.Flag{}
 
 	v.SetDefault("api.base_url", DefaultBaseURL)
 
@@ -36,6 +49,46 @@ func init() {
 	v.SetDefault("profile.path", "")
 
 	v.SetDefault("github.client_secret", "")
+	v.SetDefault("appium.install", true)
+	v.SetDefault("appium.drivers", DefaultAppiumDrivers)
+	v.SetDefault("appium.plugins", DefaultAppiumPlugins)
+	v.SetDefault("log.verbose", false)
+
+	// adb server devices are managed through, localhost:5037 by default
+	v.SetDefault("adb.path", "")
+	v.SetDefault("adb.host", "")
+	v.SetDefault("adb.port", 5037)
+	v.SetDefault("adb.server_socket", "")
+
+	// Android SDK the emulator and avdmanager tools are run from
+	v.SetDefault("android.sdk_root", "")
+
+	// Reconnect policy of access point sessions, see device.DefaultReconnectPolicy
+	v.SetDefault("device.reconnect.max_attempts", 0)
+	v.SetDefault("device.reconnect.base_delay", "2s")
+	v.SetDefault("device.reconnect.max_delay", "1m")
+	v.SetDefault("device.reconnect.breaker_threshold", 10)
+	v.SetDefault("device.reconnect.cooldown", "5m")
+	v.SetDefault("device.reconnect.cancel_on_offline", true)
+
+	// Health checks of Android devices, see device.DefaultHealthThresholds
+	v.SetDefault("device.health.interval", "1m")
+	v.SetDefault("device.health.quarantine", true)
+	v.SetDefault("device.health.min_battery", 10)
+	v.SetDefault("device.health.max_temperature", 50)
+	v.SetDefault("device.health.min_storage_mb", 200)
+	v.SetDefault("device.health.max_cpu_load", 0)
+
+	// Device leases, for devices shared by several users or CI jobs
+	v.SetDefault("device.lease.ttl", "10m")
+	v.SetDefault("device.lease.max_ttl", "8h")
+
+	// Wireless debugging devices found with mDNS are connected automatically
+	v.SetDefault("device.wireless.discovery", true)
+	v.SetDefault("device.wireless.interval", "10s")
+
+	// A local-only server serves the attached devices without a cloud profile
+	v.SetDefault("server.local_only", false)
 
 	// Environment variables
 	v.AutomaticEnv()
@@ -49,28 +102,40 @@ func init() {
 	v.BindEnv("appium.install", "GBOX_INSTALL_APPIUM")
 	v.BindEnv("appium.drivers", "GBOX_APPIUM_DRIVERS")
 	v.BindEnv("appium.plugins", "GBOX_APPIUM_PLUGINS")
+	v.BindEnv("log.verbose", "GBOX_VERBOSE")
+	v.BindEnv("adb.path", "GBOX_ADB_PATH")
+	v.BindEnv("adb.host", "GBOX_ADB_HOST")
+	v.BindEnv("adb.port", "GBOX_ADB_PORT")
+	v.BindEnv("adb.server_socket", "ADB_SERVER_SOCKET")
+	v.BindEnv("android.sdk_root", "ANDROID_HOME", "ANDROID_SDK_ROOT")
+	v.BindEnv("device.reconnect.max_attempts", "GBOX_RECONNECT_MAX_ATTEMPTS")
+	v.BindEnv("device.reconnect.base_delay", "GBOX_RECONNECT_BASE_DELAY")
+	v.BindEnv("device.reconnect.max_delay", "GBOX_RECONNECT_MAX_DELAY")
+	v.BindEnv("device.reconnect.breaker_threshold", "GBOX_RECONNECT_BREAKER_THRESHOLD")
+	v.BindEnv("device.reconnect.cooldown", "GBOX_RECONNECT_COOLDOWN")
+	v.BindEnv("device.reconnect.cancel_on_offline", "GBOX_RECONNECT_CANCEL_ON_OFFLINE")
+	v.BindEnv("device.health.interval", "GBOX_HEALTH_INTERVAL")
+	v.BindEnv("device.health.quarantine", "GBOX_HEALTH_QUARANTINE")
+	v.BindEnv("device.health.min_battery", "GBOX_HEALTH_MIN_BATTERY")
+	v.BindEnv("device.health.max_temperature", "GBOX_HEALTH_MAX_TEMPERATURE")
+	v.BindEnv("device.health.min_storage_mb", "GBOX_HEALTH_MIN_STORAGE_MB")
+	v.BindEnv("device.lease.ttl", "GBOX_LEASE_TTL")
+	v.BindEnv("device.lease.max_ttl", "GBOX_LEASE_MAX_TTL")
+	v.BindEnv("device.health.max_cpu_load", "GBOX_HEALTH_MAX_CPU_LOAD")
+	v.BindEnv("device.wireless.discovery", "GBOX_WIRELESS_DISCOVERY")
+	v.BindEnv("device.wireless.interval", "GBOX_WIRELESS_INTERVAL")
+	v.BindEnv("server.local_only", "GBOX_LOCAL_ONLY")
 
-	// Pre-process APPIUM_HOME: set default if not already set
-	if os.Getenv("APPIUM_HOME") == "" {
-		defaultAppiumHome := filepath.Join(GetDeviceProxyHome(), "appium")
-		os.Setenv("APPIUM_HOME", defaultAppiumHome)
-	}
+	// The default of appium.home derives from device_proxy.home, see GetAppiumHome
 	v.BindEnv("appium.home", "APPIUM_HOME")
 
 	// Config file
 	v.SetConfigName("config")
 	v.SetConfigType("yaml")
 
-	// Look for config in the following paths
-	configPaths := []string{
-		".",
-		"$HOME/.gbox",
-		"/etc/gbox",
-	}
-
-	for _, path := range configPaths {
-		expandedPath := os.ExpandEnv(path)
-		v.AddConfigPath(expandedPath)
+	// Look for config in the search paths, the first file found is used
+	for _, path := range SearchPaths() {
+		v.AddConfigPath(path)
 	}
 
 	// Read config file if it exists
@@ -83,6 +148,29 @@ func init() {
 	}
 }
 
+// SearchPaths returns the directories searched for config.yaml, in order
+func SearchPaths() []string {
+	return []string{
+		".",
+		userConfigDir(),
+		"/etc/gbox",
+	}
+}
+
+// userConfigDir returns the directory of the user config file
+func userConfigDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = xdg.Home
+	}
+	return filepath.Join(home, ".gbox")
+}
+
+// ConfigFileUsed returns the config file settings were read from, empty if none was found
+func ConfigFileUsed() string {
+	return v.ConfigFileUsed()
+}
+
 // GetBaseURL returns the base URL from config (environment variable or default)
 func GetBaseURL() string {
 	return v.GetString("api.base_url")
@@ -150,5 +238,125 @@ func GetAppiumPlugins() string {
 
 // GetAppiumHome returns the Appium home directory
 func GetAppiumHome() string {
-	return v.GetString("appium.home")
+	if appiumHome := v.GetString("appium.home"); appiumHome != "" {
+		return appiumHome
+	}
+	return filepath.Join(GetDeviceProxyHome(), "appium")
+}
+
+// GetVerbose returns whether verbose logging is enabled
+func GetVerbose() bool {
+	return v.GetBool("log.verbose")
+}
+
+// GetAdbPath returns the adb binary, empty to look it up in PATH
+func GetAdbPath() string {
+	return v.GetString("adb.path")
+}
+
+// GetAndroidSDKRoot returns the Android SDK, empty to look its tools up in PATH
+func GetAndroidSDKRoot() string {
+	return v.GetString("android.sdk_root")
+}
+
+// GetAdbHost returns the host of the adb server, empty for localhost
+func GetAdbHost() string {
+	return v.GetString("adb.host")
+}
+
+// GetAdbPort returns the port of the adb server
+func GetAdbPort() int {
+	return v.GetInt("adb.port")
+}
+
+// GetAdbServerSocket returns the adb server socket such as tcp:host:5037,
+// which overrides adb.host and adb.port when set
+func GetAdbServerSocket() string {
+	return v.GetString("adb.server_socket")
+}
+
+// GetReconnectMaxAttempts returns how often a lost device session is retried, 0 is forever
+func GetReconnectMaxAttempts() int {
+	return v.GetInt("device.reconnect.max_attempts")
+}
+
+// GetReconnectBaseDelay returns the backoff delay of the first reconnect attempt
+func GetReconnectBaseDelay() time.Duration {
+	return v.GetDuration("device.reconnect.base_delay")
+}
+
+// GetReconnectMaxDelay returns the longest backoff delay between reconnect attempts
+func GetReconnectMaxDelay() time.Duration {
+	return v.GetDuration("device.reconnect.max_delay")
+}
+
+// GetReconnectBreakerThreshold returns the consecutive failures that pause reconnecting
+func GetReconnectBreakerThreshold() int {
+	return v.GetInt("device.reconnect.breaker_threshold")
+}
+
+// GetReconnectCooldown returns how long reconnecting pauses once the breaker opens
+func GetReconnectCooldown() time.Duration {
+	return v.GetDuration("device.reconnect.cooldown")
+}
+
+// GetReconnectCancelOnOffline returns whether reconnecting stops when adb reports the device offline
+func GetReconnectCancelOnOffline() bool {
+	return v.GetBool("device.reconnect.cancel_on_offline")
+}
+
+// GetHealthInterval returns how often the vitals of Android devices are read
+func GetHealthInterval() time.Duration {
+	return v.GetDuration("device.health.interval")
+}
+
+// GetHealthQuarantine returns whether devices breaching the health thresholds are quarantined
+func GetHealthQuarantine() bool {
+	return v.GetBool("device.health.quarantine")
+}
+
+// GetHealthMinBattery returns the battery level in percent below which a device is quarantined
+func GetHealthMinBattery() int {
+	return v.GetInt("device.health.min_battery")
+}
+
+// GetHealthMaxTemperature returns the battery temperature in °C above which a device is quarantined
+func GetHealthMaxTemperature() int {
+	return v.GetInt("device.health.max_temperature")
+}
+
+// GetHealthMinStorageMB returns the free space of /data in MB below which a device is quarantined
+func GetHealthMinStorageMB() int {
+	return v.GetInt("device.health.min_storage_mb")
+}
+
+// GetHealthMaxCPULoad returns the load average above which a device is quarantined
+func GetHealthMaxCPULoad() float64 {
+	return v.GetFloat64("device.health.max_cpu_load")
+}
+
+// GetLeaseTTL returns how long a device lease lasts unless the request asks for another TTL
+func GetLeaseTTL() time.Duration {
+	return v.GetDuration("device.lease.ttl")
+}
+
+// GetLeaseMaxTTL returns the longest TTL a device lease may ask for
+func GetLeaseMaxTTL() time.Duration {
+	return v.GetDuration("device.lease.max_ttl")
+}
+
+// GetWirelessDiscovery returns whether paired wireless debugging devices found on the LAN are connected
+func GetWirelessDiscovery() bool {
+	return v.GetBool("device.wireless.discovery")
+}
+
+// GetWirelessInterval returns how often the LAN is searched for wireless debugging devices
+func GetWirelessInterval() time.Duration {
+	return v.GetDuration("device.wireless.interval")
+}
+
+// GetLocalOnly returns whether the server runs without the cloud, neither
+// registering devices nor connecting them to access points
+func GetLocalOnly() bool {
+	return v.GetBool("server.local_only")
 }
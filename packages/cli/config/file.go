@@ -0,0 +1,168 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UserConfigFile returns the config file 'gbox config set' writes to
+func UserConfigFile() string {
+	return filepath.Join(userConfigDir(), "config.yaml")
+}
+
+// SetValue validates a value and writes it to the user config file
+func SetValue(key, raw string) error {
+	s, err := Lookup(key)
+	if err != nil {
+		return err
+	}
+	value, err := s.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("failed to encode value: %v", err)
+	}
+
+	path := UserConfigFile()
+	doc, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	if err := setNode(doc.Content[0], strings.Split(s.Key, "."), &node); err != nil {
+		return fmt.Errorf("failed to set %s in %s: %v", s.Key, path, err)
+	}
+	return writeConfigDocument(path, doc)
+}
+
+// UnsetValue removes a key from the user config file. It reports whether the
+// key was set.
+func UnsetValue(key string) (bool, error) {
+	s, err := Lookup(key)
+	if err != nil {
+		return false, err
+	}
+
+	path := UserConfigFile()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+	doc, err := readConfigDocument(path)
+	if err != nil {
+		return false, err
+	}
+	if !unsetNode(doc.Content[0], strings.Split(s.Key, ".")) {
+		return false, nil
+	}
+	return true, writeConfigDocument(path, doc)
+}
+
+// readConfigDocument parses a config file, keeping comments and key order.
+// A missing or empty file yields an empty document.
+func readConfigDocument(path string) (*yaml.Node, error) {
+	doc := &yaml.Node{
+		Kind:    yaml.DocumentNode,
+		Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return doc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var parsed yaml.Node
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	if parsed.Kind == 0 {
+		return doc, nil
+	}
+	if len(parsed.Content) != 1 || parsed.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file %s must contain a mapping", path)
+	}
+	return &parsed, nil
+}
+
+func writeConfigDocument(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode config file: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to encode config file: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	// The file may hold secrets such as github.client_secret
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	return nil
+}
+
+// setNode sets the value at path in a mapping, creating sections as needed
+func setNode(m *yaml.Node, path []string, value *yaml.Node) error {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if !strings.EqualFold(m.Content[i].Value, path[0]) {
+			continue
+		}
+		if len(path) == 1 {
+			m.Content[i+1] = value
+			return nil
+		}
+		child := m.Content[i+1]
+		if child.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s is not a section", m.Content[i].Value)
+		}
+		return setNode(child, path[1:], value)
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[0]}
+	if len(path) == 1 {
+		m.Content = append(m.Content, key, value)
+		return nil
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	m.Content = append(m.Content, key, child)
+	return setNode(child, path[1:], value)
+}
+
+// unsetNode removes the value at path from a mapping, dropping sections left
+// empty. It reports whether anything was removed.
+func unsetNode(m *yaml.Node, path []string) bool {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if !strings.EqualFold(m.Content[i].Value, path[0]) {
+			continue
+		}
+		if len(path) > 1 {
+			child := m.Content[i+1]
+			if child.Kind != yaml.MappingNode || !unsetNode(child, path[1:]) {
+				return false
+			}
+			if len(child.Content) > 0 {
+				return true
+			}
+		}
+		m.Content = append(m.Content[:i], m.Content[i+2:]...)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Type is the type of a setting's value
+type Type string
+
+const (
+	TypeString Type = "string"
+	TypeBool   Type = "bool"
+	TypeURL    Type = "url"
+	TypePath   Type = "path"
+	TypeInt    Type = "int"
+	// TypeFloat is a non-negative decimal number such as 2.5
+	TypeFloat Type = "float"
+	// TypeDuration is a Go duration such as 30s or 5m
+	TypeDuration Type = "duration"
+	// TypeList is a comma separated list of names
+	TypeList Type = "list"
+)
+
+// Sources an effective value can come from, in increasing order of precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Setting describes a configuration key
+type Setting struct {
+	Key         string
+	Type        Type
+	Env         string
+	Description string
+	// Secret values are masked when listed
+	Secret bool
+	// get returns the effective value the CLI uses
+	get func() string
+}
+
+// Value is the effective value of a setting and where it came from
+type Value struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Type   Type   `json:"type"`
+	Source string `json:"source"`
+	// Origin names the environment variable, file or flag the value came from
+	Origin      string `json:"origin,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// flags holds the command line flags bound to settings
+var flags map[string]*pflag.Flag
+
+var settings = []Setting{
+	{Key: "api.base_url", Type: TypeURL, Env: "GBOX_BASE_URL", Description: "GBOX API base URL for profiles without one", get: GetBaseURL},
+	{Key: "gbox.home", Type: TypePath, Env: "GBOX_HOME", Description: "Directory gbox keeps its state in", get: GetGboxHome},
+	{Key: "profile.path", Type: TypePath, Env: "GBOX_PROFILE_PATH", Description: "Profile file, defaults to profiles.toml in gbox.home", get: GetProfilePath},
+	{Key: "device_proxy.home", Type: TypePath, Env: "DEVICE_PROXY_HOME", Description: "Device proxy directory, defaults to device-proxy in gbox.home", get: GetDeviceProxyHome},
+	{Key: "project.root", Type: TypePath, Env: "PROJECT_ROOT", Description: "Project root used to locate scripts and MCP config", get: GetProjectRoot},
+	{Key: "github.client_secret", Type: TypeString, Env: "GBOX_GITHUB_CLIENT_SECRET", Description: "GitHub OAuth client secret for gbox login", Secret: true, get: GetGithubClientSecret},
+	{Key: "appium.install", Type: TypeBool, Env: "GBOX_INSTALL_APPIUM", Description: "Install Appium with the device proxy", get: func() string { return strconv.FormatBool(GetAppiumInstall()) }},
+	{Key: "appium.drivers", Type: TypeList, Env: "GBOX_APPIUM_DRIVERS", Description: "Appium drivers to install", get: GetAppiumDrivers},
+	{Key: "appium.plugins", Type: TypeList, Env: "GBOX_APPIUM_PLUGINS", Description: "Appium plugins to install", get: GetAppiumPlugins},
+	{Key: "appium.home", Type: TypePath, Env: "APPIUM_HOME", Description: "Appium home, defaults to appium in device_proxy.home", get: GetAppiumHome},
+	{Key: "adb.path", Type: TypePath, Env: "GBOX_ADB_PATH", Description: "adb binary, looked up in PATH when unset", get: GetAdbPath},
+	{Key: "adb.host", Type: TypeString, Env: "GBOX_ADB_HOST", Description: "Host of the adb server devices are managed through, a remote server must be started with adb -a", get: GetAdbHost},
+	{Key: "adb.port", Type: TypeInt, Env: "GBOX_ADB_PORT", Description: "Port of the adb server", get: func() string { return strconv.Itoa(GetAdbPort()) }},
+	{Key: "adb.server_socket", Type: TypeString, Env: "ADB_SERVER_SOCKET", Description: "adb server socket as tcp:host:port, overrides adb.host and adb.port", get: GetAdbServerSocket},
+	{Key: "android.sdk_root", Type: TypePath, Env: "ANDROID_HOME", Description: "Android SDK to run emulator and avdmanager from, also read from ANDROID_SDK_ROOT; they are looked up in PATH when unset", get: GetAndroidSDKRoot},
+	{Key: "device.reconnect.max_attempts", Type: TypeInt, Env: "GBOX_RECONNECT_MAX_ATTEMPTS", Description: "Reconnect attempts before a lost device is given up, 0 retries forever", get: func() string { return strconv.Itoa(GetReconnectMaxAttempts()) }},
+	{Key: "device.reconnect.base_delay", Type: TypeDuration, Env: "GBOX_RECONNECT_BASE_DELAY", Description: "Backoff delay of the first reconnect attempt", get: func() string { return GetReconnectBaseDelay().String() }},
+	{Key: "device.reconnect.max_delay", Type: TypeDuration, Env: "GBOX_RECONNECT_MAX_DELAY", Description: "Longest backoff delay between reconnect attempts", get: func() string { return GetReconnectMaxDelay().String() }},
+	{Key: "device.reconnect.breaker_threshold", Type: TypeInt, Env: "GBOX_RECONNECT_BREAKER_THRESHOLD", Description: "Consecutive reconnect failures before pausing for the cooldown, 0 never pauses", get: func() string { return strconv.Itoa(GetReconnectBreakerThreshold()) }},
+	{Key: "device.reconnect.cooldown", Type: TypeDuration, Env: "GBOX_RECONNECT_COOLDOWN", Description: "Pause after breaker_threshold consecutive reconnect failures", get: func() string { return GetReconnectCooldown().String() }},
+	{Key: "device.reconnect.cancel_on_offline", Type: TypeBool, Env: "GBOX_RECONNECT_CANCEL_ON_OFFLINE", Description: "Stop reconnecting when adb reports the device offline", get: func() string { return strconv.FormatBool(GetReconnectCancelOnOffline()) }},
+	{Key: "device.health.interval", Type: TypeDuration, Env: "GBOX_HEALTH_INTERVAL", Description: "How often the battery, storage, CPU load and screen state of Android devices are read", get: func() string { return GetHealthInterval().String() }},
+	{Key: "device.health.quarantine", Type: TypeBool, Env: "GBOX_HEALTH_QUARANTINE", Description: "Disconnect devices breaching a health threshold and mark them unavailable until they recover", get: func() string { return strconv.FormatBool(GetHealthQuarantine()) }},
+	{Key: "device.health.min_battery", Type: TypeInt, Env: "GBOX_HEALTH_MIN_BATTERY", Description: "Battery percent below which a device that is not charging is quarantined, 0 disables", get: func() string { return strconv.Itoa(GetHealthMinBattery()) }},
+	{Key: "device.health.max_temperature", Type: TypeInt, Env: "GBOX_HEALTH_MAX_TEMPERATURE", Description: "Battery temperature in °C above which a device is quarantined, 0 disables", get: func() string { return strconv.Itoa(GetHealthMaxTemperature()) }},
+	{Key: "device.health.min_storage_mb", Type: TypeInt, Env: "GBOX_HEALTH_MIN_STORAGE_MB", Description: "Free MB on /data below which a device is quarantined, 0 disables", get: func() string { return strconv.Itoa(GetHealthMinStorageMB()) }},
+	{Key: "device.health.max_cpu_load", Type: TypeFloat, Env: "GBOX_HEALTH_MAX_CPU_LOAD", Description: "One minute load average above which a device is quarantined, 0 disables", get: func() string { return strconv.FormatFloat(GetHealthMaxCPULoad(), 'f', -1, 64) }},
+	{Key: "device.lease.ttl", Type: TypeDuration, Env: "GBOX_LEASE_TTL", Description: "How long a device lease lasts unless renewed, when the lease does not ask for a TTL", get: func() string { return GetLeaseTTL().String() }},
+	{Key: "device.lease.max_ttl", Type: TypeDuration, Env: "GBOX_LEASE_MAX_TTL", Description: "Longest TTL a device lease may ask for", get: func() string { return GetLeaseMaxTTL().String() }},
+	{Key: "device.wireless.discovery", Type: TypeBool, Env: "GBOX_WIRELESS_DISCOVERY", Description: "Connect paired Android 11+ devices advertising wireless debugging on the LAN, and follow their port changes", get: func() string { return strconv.FormatBool(GetWirelessDiscovery()) }},
+	{Key: "device.wireless.interval", Type: TypeDuration, Env: "GBOX_WIRELESS_INTERVAL", Description: "How often the LAN is searched for wireless debugging devices", get: func() string { return GetWirelessInterval().String() }},
+	{Key: "server.local_only", Type: TypeBool, Env: "GBOX_LOCAL_ONLY", Description: "Serve the attached devices without a cloud profile, devices are neither registered nor connected to access points", get: func() string { return strconv.FormatBool(GetLocalOnly()) }},
+	{Key: "log.verbose", Type: TypeBool, Env: "GBOX_VERBOSE", Description: "Enable verbose logging", get: func() string { return strconv.FormatBool(GetVerbose()) }},
+}
+
+// Settings returns all known settings sorted by key
+func Settings() []Setting {
+	sorted := make([]Setting, len(settings))
+	copy(sorted, settings)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	return sorted
+}
+
+// Lookup returns the setting with the given key
+func Lookup(key string) (Setting, error) {
+	key = strings.ToLower(key)
+	for _, s := range settings {
+		if s.Key == key {
+			return s, nil
+		}
+	}
+	return Setting{}, fmt.Errorf("unknown config key %q (run 'gbox config list' to see all keys)", key)
+}
+
+// BindFlag makes a command line flag override a setting when it is given
+func BindFlag(key string, flag *pflag.Flag) error {
+	if _, err := Lookup(key); err != nil {
+		return err
+	}
+	flags[key] = flag
+	return v.BindPFlag(key, flag)
+}
+
+// Resolve returns the effective value of a setting and its source
+func Resolve(key string) (Value, error) {
+	s, err := Lookup(key)
+	if err != nil {
+		return Value{}, err
+	}
+
+	value := Value{Key: s.Key, Type: s.Type, Value: s.get(), Source: SourceDefault, Description: s.Description}
+	switch {
+	case flags[s.Key] != nil && flags[s.Key].Changed:
+		value.Source = SourceFlag
+		value.Origin = "--" + flags[s.Key].Name
+	case s.Env != "" && os.Getenv(s.Env) != "":
+		value.Source = SourceEnv
+		value.Origin = s.Env
+	case v.InConfig(s.Key):
+		value.Source = SourceFile
+		value.Origin = v.ConfigFileUsed()
+	}
+	if s.Key == "github.client_secret" && githubClientSecret != "" {
+		// A secret compiled into the binary wins over everything else
+		value.Source = SourceDefault
+		value.Origin = "built in"
+	}
+	return value, nil
+}
+
+// Parse validates a value for the setting and converts it to the type stored
+// in the config file
+func (s Setting) Parse(raw string) (interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	switch s.Type {
+	case TypeBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %q is not a boolean (use true or false)", s.Key, raw)
+		}
+		return b, nil
+	case TypeInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid value for %s: %q is not a non-negative integer", s.Key, raw)
+		}
+		return n, nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid value for %s: %q is not a non-negative number", s.Key, raw)
+		}
+		return f, nil
+	case TypeDuration:
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid value for %s: %q is not a positive duration (e.g. 30s or 5m)", s.Key, raw)
+		}
+		return d.String(), nil
+	case TypeURL:
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid value for %s: %q is not an http(s) URL", s.Key, raw)
+		}
+		return raw, nil
+	case TypePath:
+		if raw == "~" || strings.HasPrefix(raw, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand %q: %v", raw, err)
+			}
+			raw = filepath.Join(home, strings.TrimPrefix(raw, "~"))
+		}
+		if !filepath.IsAbs(raw) {
+			return nil, fmt.Errorf("invalid value for %s: %q is not an absolute path", s.Key, raw)
+		}
+		return filepath.Clean(raw), nil
+	case TypeList:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, ","), nil
+	default:
+		if raw == "" {
+			return nil, fmt.Errorf("invalid value for %s: value is empty (use 'gbox config unset %s' instead)", s.Key, s.Key)
+		}
+		return raw, nil
+	}
+}
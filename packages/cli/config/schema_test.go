@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettingParse(t *testing.T) {
+	tests := []struct {
+		key     string
+		raw     string
+		want    interface{}
+		wantErr string
+	}{
+		{key: "appium.install", raw: "true", want: true},
+		{key: "appium.install", raw: "yes", wantErr: "not a boolean"},
+		{key: "api.base_url", raw: "https://example.com/api/v1", want: "https://example.com/api/v1"},
+		{key: "api.base_url", raw: "example.com", wantErr: "not an http(s) URL"},
+		{key: "gbox.home", raw: "/opt/gbox/", want: "/opt/gbox"},
+		{key: "gbox.home", raw: "relative/dir", wantErr: "not an absolute path"},
+		{key: "appium.drivers", raw: " uiautomator2, ,xcuitest ", want: "uiautomator2,xcuitest"},
+		{key: "github.client_secret", raw: "", wantErr: "value is empty"},
+		{key: "adb.port", raw: "5038", want: 5038},
+		{key: "adb.path", raw: "bin/adb", wantErr: "not an absolute path"},
+		{key: "device.reconnect.max_attempts", raw: "0", want: 0},
+		{key: "device.reconnect.max_attempts", raw: "-1", wantErr: "not a non-negative integer"},
+		{key: "device.reconnect.cooldown", raw: "300s", want: "5m0s"},
+		{key: "device.reconnect.cooldown", raw: "5", wantErr: "not a positive duration"},
+		{key: "device.health.max_cpu_load", raw: "3.5", want: 3.5},
+		{key: "device.health.max_cpu_load", raw: "-1", wantErr: "not a non-negative number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.raw, func(t *testing.T) {
+			s, err := Lookup(tt.key)
+			require.NoError(t, err)
+			got, err := s.Parse(tt.raw)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := Lookup("api.unknown")
+	assert.ErrorContains(t, err, "unknown config key")
+}
+
+func TestSetValueAndProvenance(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("GBOX_INSTALL_APPIUM", "")
+	t.Setenv("GBOX_BASE_URL", "")
+	t.Setenv("APPIUM_HOME", "")
+	t.Chdir(t.TempDir())
+	t.Cleanup(load)
+
+	path := UserConfigFile()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("# managed by hand\n\napi:\n  base_url: http://localhost:1234/api/v1\n"), 0644))
+
+	require.NoError(t, SetValue("appium.install", "true"))
+	require.NoError(t, SetValue("api.base_url", "http://localhost:28090/api/v1"))
+	assert.ErrorContains(t, SetValue("api.base_url", "localhost"), "not an http(s) URL")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "# managed by hand\n\napi:\n  base_url: http://localhost:28090/api/v1\nappium:\n  install: true\n", string(data))
+
+	load()
+	value, err := Resolve("appium.install")
+	require.NoError(t, err)
+	assert.Equal(t, Value{Key: "appium.install", Value: "true", Type: TypeBool, Source: SourceFile, Origin: path, Description: value.Description}, value)
+
+	t.Setenv("GBOX_INSTALL_APPIUM", "false")
+	load()
+	value, err = Resolve("appium.install")
+	require.NoError(t, err)
+	assert.Equal(t, "false", value.Value)
+	assert.Equal(t, SourceEnv, value.Source)
+	assert.Equal(t, "GBOX_INSTALL_APPIUM", value.Origin)
+
+	value, err = Resolve("log.verbose")
+	require.NoError(t, err)
+	assert.Equal(t, SourceDefault, value.Source)
+
+	// appium.home defaults from device_proxy.home without touching the
+	// environment, so a value set in the file takes effect
+	load()
+	value, err = Resolve("appium.home")
+	require.NoError(t, err)
+	assert.Equal(t, SourceDefault, value.Source)
+	assert.Equal(t, filepath.Join(GetDeviceProxyHome(), "appium"), value.Value)
+	assert.Empty(t, os.Getenv("APPIUM_HOME"))
+
+	require.NoError(t, SetValue("appium.home", filepath.Join(home, "appium")))
+	load()
+	value, err = Resolve("appium.home")
+	require.NoError(t, err)
+	assert.Equal(t, SourceFile, value.Source)
+	assert.Equal(t, filepath.Join(home, "appium"), value.Value)
+
+	// The file may hold secrets, so it is only readable by the user
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	_, err = UnsetValue("appium.home")
+	require.NoError(t, err)
+
+	removed, err := UnsetValue("api.base_url")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = UnsetValue("api.base_url")
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "# managed by hand\n\nappium:\n  install: true\n", string(data))
+}
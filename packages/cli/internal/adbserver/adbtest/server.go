@@ -0,0 +1,797 @@
+// Package adbtest runs an in-process adb server for tests. It speaks the host
+// protocol of a real adb server over TCP, with devices whose files, shell
+// commands and forwards live in memory, so code that manages devices can be
+// tested without a phone.
+package adbtest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+)
+
+// ShellFunc runs a shell command on a fake device and returns its exit code
+type ShellFunc func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// Server is a fake adb server listening on localhost
+type Server struct {
+	ln     net.Listener
+	binary string
+	done   chan struct{} // closed when the test ends
+
+	mu       sync.Mutex
+	devices  []*Device
+	forwards map[string]forward // by local
+	nextPort int
+	trackers map[chan struct{}]bool
+	wireless []*Device // devices with wireless debugging on
+}
+
+type forward struct {
+	serial string
+	remote string
+}
+
+// NewServer starts a fake adb server that stops when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("adbtest: %v", err)
+	}
+	s := &Server{
+		ln:       ln,
+		binary:   stubBinary(t),
+		forwards: make(map[string]forward),
+		nextPort: 27183,
+		trackers: make(map[chan struct{}]bool),
+		done:     make(chan struct{}),
+	}
+	go s.serve()
+	t.Cleanup(func() {
+		close(s.done)
+		ln.Close()
+	})
+	return s
+}
+
+// Addr returns host:port of the server
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Endpoint returns the endpoint of the server. Its adb binary is a stub that
+// succeeds without doing anything, so goadb, which insists on a binary to
+// start the server with, can be pointed at the fake.
+func (s *Server) Endpoint() adbserver.Endpoint {
+	return adbserver.Endpoint{Host: "127.0.0.1", Port: s.ln.Addr().(*net.TCPAddr).Port, Path: s.binary}
+}
+
+// Setenv points the adb configuration of gbox at the server for the rest of
+// the test, so code using adbserver.Default talks to it
+func (s *Server) Setenv(t testing.TB) {
+	t.Helper()
+	t.Setenv("ADB_SERVER_SOCKET", "tcp:"+s.Addr())
+	t.Setenv("GBOX_ADB_PATH", s.binary)
+}
+
+// stubBinary writes an executable that exits 0 to a temporary directory
+func stubBinary(t testing.TB) string {
+	name, script := "adb", "#!/bin/sh\nexit 0\n"
+	if runtime.GOOS == "windows" {
+		name, script = "adb.bat", "@exit /b 0\r\n"
+	}
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(script), 0o755); err != nil {
+		t.Fatalf("adbtest: %v", err)
+	}
+	return p
+}
+
+// Client returns a client of the server
+func (s *Server) Client() *adbserver.Client {
+	return adbserver.NewClient(s.Endpoint())
+}
+
+// AddDevice attaches an online device supporting shell v2
+func (s *Server) AddDevice(serial string) *Device {
+	d := s.newDevice(serial)
+	s.mu.Lock()
+	s.devices = append(s.devices, d)
+	s.mu.Unlock()
+	s.notify()
+	return d
+}
+
+func (s *Server) newDevice(serial string) *Device {
+	return &Device{
+		server:   s,
+		Serial:   serial,
+		State:    "device",
+		Model:    "gbox_fake",
+		Features: []string{"shell_v2", "cmd", "stat_v2"},
+		files:    make(map[string]*file),
+		dirs:     map[string]bool{"/": true},
+		denied:   make(map[string]bool),
+		shell:    make(map[string]ShellFunc),
+		reverses: make(map[string]string),
+	}
+}
+
+// RemoveDevice detaches a device
+func (s *Server) RemoveDevice(serial string) {
+	s.mu.Lock()
+	for i, d := range s.devices {
+		if d.Serial == serial {
+			s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// notify wakes the track-devices connections to send the device list
+func (s *Server) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.trackers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Forwards returns the forwards of the server as local to serial and remote
+func (s *Server) Forwards() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	forwards := make(map[string]string, len(s.forwards))
+	for local, f := range s.forwards {
+		forwards[local] = f.serial + " " + f.remote
+	}
+	return forwards
+}
+
+// online returns the device if it is attached and online
+func (s *Server) online(serial string) *Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.devices {
+		if d.Serial == serial && d.State == "device" {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *Server) device(serial string) *Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.devices {
+		if d.Serial == serial {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *Server) deviceList(long bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	for _, d := range s.devices {
+		fmt.Fprintf(&b, "%s\t%s", d.Serial, d.State)
+		if long {
+			fmt.Fprintf(&b, " product:%s model:%s device:%s transport_id:1", d.Model, d.Model, d.Model)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle serves one connection: host requests, or a transport switch
+// followed by one device service
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	req, err := readRequest(r)
+	if err != nil {
+		return
+	}
+	switch {
+	case req == "host:version":
+		okay(conn, "0029")
+	case req == "host:devices" || req == "host:devices-l":
+		okay(conn, s.deviceList(req == "host:devices-l"))
+	case req == "host:track-devices" || req == "host:track-devices-l":
+		s.track(conn, req == "host:track-devices-l")
+	case strings.HasPrefix(req, "host:transport:"):
+		d := s.online(strings.TrimPrefix(req, "host:transport:"))
+		if d == nil {
+			fail(conn, "device '"+strings.TrimPrefix(req, "host:transport:")+"' not found")
+			return
+		}
+		conn.Write([]byte("OKAY"))
+		service, err := readRequest(r)
+		if err != nil {
+			return
+		}
+		d.serve(service, r, conn)
+	case strings.HasPrefix(req, "host-serial:"):
+		s.handleSerial(req, conn)
+	case req == "host:mdns:services":
+		okay(conn, s.mdnsServices())
+	case strings.HasPrefix(req, "host:pair:"):
+		code, addr, _ := strings.Cut(strings.TrimPrefix(req, "host:pair:"), ":")
+		okay(conn, s.pair(addr, code))
+	case strings.HasPrefix(req, "host:connect:"):
+		okay(conn, s.connect(strings.TrimPrefix(req, "host:connect:")))
+	case strings.HasPrefix(req, "host:disconnect:"):
+		s.disconnect(strings.TrimPrefix(req, "host:disconnect:"), conn)
+	default:
+		fail(conn, "unknown host service")
+	}
+}
+
+// track sends the device list, then again whenever a device is added,
+// removed or changes state, until the client hangs up
+func (s *Server) track(conn net.Conn, long bool) {
+	changed := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.trackers[changed] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.trackers, changed)
+		s.mu.Unlock()
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	conn.Write([]byte("OKAY"))
+	for {
+		writeMessage(conn, s.deviceList(long))
+		select {
+		case <-changed:
+		case <-closed:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) handleSerial(req string, conn net.Conn) {
+	serial, cmd, _ := strings.Cut(strings.TrimPrefix(req, "host-serial:"), ":")
+	// Serials of network devices contain a colon
+	if d := s.device(serial); d == nil {
+		if i := strings.Index(cmd, ":"); i >= 0 && s.device(serial+":"+cmd[:i]) != nil {
+			serial, cmd = serial+":"+cmd[:i], cmd[i+1:]
+		}
+	}
+	d := s.device(serial)
+	if d == nil {
+		fail(conn, "device '"+serial+"' not found")
+		return
+	}
+
+	switch {
+	case cmd == "features":
+		okay(conn, strings.Join(d.Features, ","))
+	case strings.HasPrefix(cmd, "forward:"):
+		local, remote, _ := strings.Cut(strings.TrimPrefix(cmd, "forward:"), ";")
+		s.mu.Lock()
+		port := ""
+		if local == "tcp:0" {
+			port = strconv.Itoa(s.nextPort)
+			s.nextPort++
+			local = "tcp:" + port
+		}
+		s.forwards[local] = forward{serial: serial, remote: remote}
+		s.mu.Unlock()
+		conn.Write([]byte("OKAYOKAY"))
+		if port != "" {
+			writeMessage(conn, port)
+		}
+	case strings.HasPrefix(cmd, "killforward:"):
+		local := strings.TrimPrefix(cmd, "killforward:")
+		s.mu.Lock()
+		_, ok := s.forwards[local]
+		delete(s.forwards, local)
+		s.mu.Unlock()
+		if !ok {
+			conn.Write([]byte("OKAY"))
+			fail(conn, "listener '"+local+"' not found")
+			return
+		}
+		conn.Write([]byte("OKAYOKAY"))
+	default:
+		fail(conn, "unknown host service")
+	}
+}
+
+// Device is a fake device of the server. Its exported fields may be changed
+// before it is used, use SetState once it is.
+type Device struct {
+	server *Server
+
+	Serial   string
+	State    string
+	Model    string
+	Features []string
+
+	mu       sync.Mutex
+	files    map[string]*file
+	dirs     map[string]bool
+	denied   map[string]bool // directories that cannot be listed
+	shell    map[string]ShellFunc
+	reverses map[string]string // remote to local
+
+	// Wireless debugging, guarded by the server
+	name        string // mDNS instance name
+	connectAddr string
+	pairName    string
+	pairAddr    string
+	pairCode    string
+	paired      bool
+}
+
+type file struct {
+	data  []byte
+	mode  os.FileMode
+	mtime time.Time
+}
+
+// SetState changes the state of the device, such as "offline", and notifies
+// the clients tracking devices
+func (d *Device) SetState(state string) {
+	d.server.mu.Lock()
+	d.State = state
+	d.server.mu.Unlock()
+	d.server.notify()
+}
+
+// DialReverse connects to the socket remote of the device as a process on
+// the device would, reaching the host end of its reverse forward
+func (d *Device) DialReverse(remote string) (net.Conn, error) {
+	d.mu.Lock()
+	local, ok := d.reverses[remote]
+	d.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("adbtest: no reverse forward of %s on %s", remote, d.Serial)
+	}
+	port, ok := strings.CutPrefix(local, "tcp:")
+	if !ok {
+		return nil, fmt.Errorf("adbtest: unsupported reverse forward target %s", local)
+	}
+	return net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+}
+
+// HandleShell runs fn for the shell commands that are cmd or start with cmd
+// and a space. The longest matching cmd wins.
+func (d *Device) HandleShell(cmd string, fn ShellFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.shell[cmd] = fn
+}
+
+// ShellOutput answers cmd with stdout and exit code 0
+func (d *Device) ShellOutput(cmd, stdout string) {
+	d.HandleShell(cmd, func(_ string, _ io.Reader, out, _ io.Writer) int {
+		io.WriteString(out, stdout)
+		return 0
+	})
+}
+
+// WriteFile creates or replaces the file at p and its parent directories
+func (d *Device) WriteFile(p string, data []byte, mode os.FileMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.writeFileLocked(p, data, mode, time.Now())
+}
+
+func (d *Device) writeFileLocked(p string, data []byte, mode os.FileMode, mtime time.Time) {
+	for dir := path.Dir(p); !d.dirs[dir]; dir = path.Dir(dir) {
+		d.dirs[dir] = true
+	}
+	d.files[p] = &file{data: append([]byte(nil), data...), mode: mode.Perm(), mtime: mtime.Truncate(time.Second)}
+}
+
+// DenyList makes listing the directory dir fail like a permission error
+func (d *Device) DenyList(dir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dir = path.Clean(dir)
+	for p := dir; !d.dirs[p]; p = path.Dir(p) {
+		d.dirs[p] = true
+	}
+	d.denied[dir] = true
+}
+
+// ReadFile returns the content of the file at p
+func (d *Device) ReadFile(p string) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.files[p]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), f.data...), true
+}
+
+// Reverses returns the reverse forwards of the device as remote to local
+func (d *Device) Reverses() map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	reverses := make(map[string]string, len(d.reverses))
+	for remote, local := range d.reverses {
+		reverses[remote] = local
+	}
+	return reverses
+}
+
+func (d *Device) serve(service string, r *bufio.Reader, conn net.Conn) {
+	switch {
+	case strings.HasPrefix(service, "shell,v2,raw:"), strings.HasPrefix(service, "shell,v2:"):
+		if !d.hasFeature("shell_v2") {
+			fail(conn, "closed")
+			return
+		}
+		_, cmd, _ := strings.Cut(service, ":")
+		conn.Write([]byte("OKAY"))
+		d.shellV2(cmd, r, conn)
+	case strings.HasPrefix(service, "shell:"):
+		conn.Write([]byte("OKAY"))
+		d.shellV1(strings.TrimPrefix(service, "shell:"), conn)
+	case service == "sync:":
+		conn.Write([]byte("OKAY"))
+		d.sync(r, conn)
+	case strings.HasPrefix(service, "reverse:"):
+		conn.Write([]byte("OKAY"))
+		d.reverse(strings.TrimPrefix(service, "reverse:"), conn)
+	default:
+		fail(conn, "unknown service "+service)
+	}
+}
+
+func (d *Device) hasFeature(feature string) bool {
+	for _, f := range d.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// run runs cmd with the longest matching handler
+func (d *Device) run(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	d.mu.Lock()
+	var fn ShellFunc
+	match := ""
+	for prefix, handler := range d.shell {
+		if (cmd == prefix || strings.HasPrefix(cmd, prefix+" ")) && len(prefix) >= len(match) {
+			fn, match = handler, prefix
+		}
+	}
+	d.mu.Unlock()
+	if fn == nil {
+		fmt.Fprintf(stderr, "/system/bin/sh: %s: inaccessible or not found\n", strings.Fields(cmd + " x")[0])
+		return 127
+	}
+	return fn(cmd, stdin, stdout, stderr)
+}
+
+func (d *Device) shellV2(cmd string, r io.Reader, conn net.Conn) {
+	stdin, stdinW := io.Pipe()
+	go func() {
+		header := make([]byte, 5)
+		for {
+			if _, err := io.ReadFull(r, header); err != nil {
+				stdinW.CloseWithError(err)
+				return
+			}
+			data := make([]byte, binary.LittleEndian.Uint32(header[1:]))
+			if _, err := io.ReadFull(r, data); err != nil {
+				stdinW.CloseWithError(err)
+				return
+			}
+			switch header[0] {
+			case 0:
+				stdinW.Write(data)
+			case 4:
+				stdinW.Close()
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	stdout := &packetWriter{conn: conn, mu: &mu, id: 1}
+	stderr := &packetWriter{conn: conn, mu: &mu, id: 2}
+	code := d.run(cmd, stdin, stdout, stderr)
+	stdout.packet([]byte{byte(code)}, 3)
+}
+
+var shellV1Wrapper = regexp.MustCompile(`^\((.*)\); echo (\S+)\$\?$`)
+
+// shellV1 runs cmd like the legacy shell service. Like sh, it runs the
+// command and the echo of its exit code that adbserver wraps around it.
+func (d *Device) shellV1(cmd string, conn net.Conn) {
+	if m := shellV1Wrapper.FindStringSubmatch(cmd); m != nil {
+		code := d.run(m[1], strings.NewReader(""), conn, conn)
+		fmt.Fprintf(conn, "%s%d\n", m[2], code)
+		return
+	}
+	d.run(cmd, strings.NewReader(""), conn, conn)
+}
+
+type packetWriter struct {
+	conn net.Conn
+	mu   *sync.Mutex
+	id   byte
+}
+
+func (w *packetWriter) Write(p []byte) (int, error) {
+	if err := w.packet(p, w.id); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *packetWriter) packet(p []byte, id byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	header := make([]byte, 5)
+	header[0] = id
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(p)))
+	_, err := w.conn.Write(append(header, p...))
+	return err
+}
+
+func (d *Device) sync(r io.Reader, conn net.Conn) {
+	for {
+		id := make([]byte, 4)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return
+		}
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return
+		}
+		if string(id) == "QUIT" {
+			return
+		}
+		arg := make([]byte, n)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return
+		}
+
+		switch string(id) {
+		case "STAT":
+			mode, size, mtime := d.stat(string(arg))
+			conn.Write([]byte("STAT"))
+			binary.Write(conn, binary.LittleEndian, []uint32{mode, size, mtime})
+		case "LIST":
+			d.list(string(arg), conn)
+		case "RECV":
+			d.recv(string(arg), conn)
+		case "SEND":
+			if !d.send(string(arg), r, conn) {
+				return
+			}
+		default:
+			syncFail(conn, "unknown sync request "+string(id))
+			return
+		}
+	}
+}
+
+// stat returns the sync stat of p, all zeros when it does not exist
+func (d *Device) stat(p string) (mode, size, mtime uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if f, ok := d.files[p]; ok {
+		return 0o100000 | uint32(f.mode), uint32(len(f.data)), uint32(f.mtime.Unix())
+	}
+	if d.dirs[path.Clean(p)] {
+		return 0o040000 | 0o755, 4096, 0
+	}
+	return 0, 0, 0
+}
+
+func (d *Device) list(dir string, conn net.Conn) {
+	dir = path.Clean(dir)
+	d.mu.Lock()
+	if d.denied[dir] {
+		d.mu.Unlock()
+		syncFail(conn, "Permission denied")
+		return
+	}
+	names := map[string]bool{}
+	for p := range d.files {
+		if path.Dir(p) == dir {
+			names[path.Base(p)] = true
+		}
+	}
+	for p := range d.dirs {
+		if p != "/" && path.Dir(p) == dir {
+			names[path.Base(p)] = true
+		}
+	}
+	d.mu.Unlock()
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range append([]string{".", ".."}, sorted...) {
+		mode, size, mtime := d.stat(path.Join(dir, name))
+		conn.Write([]byte("DENT"))
+		binary.Write(conn, binary.LittleEndian, []uint32{mode, size, mtime, uint32(len(name))})
+		conn.Write([]byte(name))
+	}
+	conn.Write([]byte("DONE"))
+	binary.Write(conn, binary.LittleEndian, []uint32{0, 0, 0, 0})
+}
+
+func (d *Device) recv(p string, conn net.Conn) {
+	data, ok := d.ReadFile(p)
+	if !ok {
+		syncFail(conn, "No such file or directory")
+		return
+	}
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > 64*1024 {
+			chunk = chunk[:64*1024]
+		}
+		conn.Write([]byte("DATA"))
+		binary.Write(conn, binary.LittleEndian, uint32(len(chunk)))
+		conn.Write(chunk)
+		data = data[len(chunk):]
+	}
+	conn.Write([]byte("DONE"))
+	binary.Write(conn, binary.LittleEndian, uint32(0))
+}
+
+func (d *Device) send(arg string, r io.Reader, conn net.Conn) bool {
+	i := strings.LastIndex(arg, ",")
+	if i < 0 {
+		syncFail(conn, "missing mode")
+		return false
+	}
+	p := arg[:i]
+	mode, err := strconv.ParseUint(arg[i+1:], 10, 32)
+	if err != nil {
+		syncFail(conn, "invalid mode")
+		return false
+	}
+
+	var data []byte
+	for {
+		id := make([]byte, 4)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return false
+		}
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return false
+		}
+		switch string(id) {
+		case "DATA":
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return false
+			}
+			data = append(data, chunk...)
+		case "DONE":
+			d.mu.Lock()
+			d.writeFileLocked(p, data, os.FileMode(mode), time.Unix(int64(n), 0))
+			d.mu.Unlock()
+			conn.Write([]byte("OKAY"))
+			binary.Write(conn, binary.LittleEndian, uint32(0))
+			return true
+		default:
+			syncFail(conn, "unexpected "+string(id))
+			return false
+		}
+	}
+}
+
+func (d *Device) reverse(cmd string, conn net.Conn) {
+	switch {
+	case strings.HasPrefix(cmd, "forward:"):
+		remote, local, _ := strings.Cut(strings.TrimPrefix(cmd, "forward:"), ";")
+		d.mu.Lock()
+		d.reverses[remote] = local
+		d.mu.Unlock()
+		conn.Write([]byte("OKAY"))
+	case strings.HasPrefix(cmd, "killforward:"):
+		remote := strings.TrimPrefix(cmd, "killforward:")
+		d.mu.Lock()
+		_, ok := d.reverses[remote]
+		delete(d.reverses, remote)
+		d.mu.Unlock()
+		if !ok {
+			fail(conn, "listener '"+remote+"' not found")
+			return
+		}
+		conn.Write([]byte("OKAY"))
+	case cmd == "list-forward":
+		var b strings.Builder
+		for remote, local := range d.Reverses() {
+			fmt.Fprintf(&b, "%s %s %s\n", d.Serial, remote, local)
+		}
+		okay(conn, b.String())
+	default:
+		fail(conn, "unknown reverse command")
+	}
+}
+
+func readRequest(r io.Reader) (string, error) {
+	hex := make([]byte, 4)
+	if _, err := io.ReadFull(r, hex); err != nil {
+		return "", err
+	}
+	n, err := strconv.ParseUint(string(hex), 16, 16)
+	if err != nil {
+		return "", err
+	}
+	req := make([]byte, n)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return "", err
+	}
+	return string(req), nil
+}
+
+func writeMessage(w io.Writer, msg string) {
+	fmt.Fprintf(w, "%04x%s", len(msg), msg)
+}
+
+func okay(w io.Writer, msg string) {
+	w.Write([]byte("OKAY"))
+	writeMessage(w, msg)
+}
+
+func fail(w io.Writer, msg string) {
+	w.Write([]byte("FAIL"))
+	writeMessage(w, msg)
+}
+
+func syncFail(w io.Writer, msg string) {
+	w.Write([]byte("FAIL"))
+	binary.Write(w, binary.LittleEndian, uint32(len(msg)))
+	w.Write([]byte(msg))
+}
@@ -0,0 +1,160 @@
+package adbtest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+)
+
+// AddWirelessDevice adds a device with wireless debugging on, advertised as
+// name once it listens. It is attached when the server connects to it, which
+// only succeeds once it is paired.
+func (s *Server) AddWirelessDevice(name string) *Device {
+	d := s.newDevice("")
+	d.name = name
+	s.mu.Lock()
+	s.wireless = append(s.wireless, d)
+	s.mu.Unlock()
+	return d
+}
+
+// Listen advertises the device for connections on addr. Moving a connected
+// device to another port leaves its old connection offline, as when the
+// device restarts wireless debugging.
+func (d *Device) Listen(addr string) {
+	s := d.server
+	s.mu.Lock()
+	if d.connectAddr != "" && d.connectAddr != addr {
+		for i, attached := range s.devices {
+			if attached == d {
+				stale := s.newDevice(d.Serial)
+				stale.State = "offline"
+				s.devices[i] = stale
+			}
+		}
+	}
+	d.connectAddr = addr
+	s.mu.Unlock()
+	s.notify()
+}
+
+// StartPairing opens the "Pair device with pairing code" dialog of the
+// device, advertising it on addr until it is paired
+func (d *Device) StartPairing(addr, code string) {
+	d.server.mu.Lock()
+	defer d.server.mu.Unlock()
+	d.pairName, d.pairAddr, d.pairCode = d.name, addr, code
+}
+
+// ScanPairingQR scans the text of a pairing QR code, as "Pair device with QR
+// code" does, advertising the pairing service named in it on addr
+func (d *Device) ScanPairingQR(qr, addr string) error {
+	var name, password string
+	for _, field := range strings.Split(strings.TrimPrefix(qr, "WIFI:"), ";") {
+		k, v, _ := strings.Cut(field, ":")
+		switch k {
+		case "T":
+			if v != "ADB" {
+				return fmt.Errorf("adbtest: not an adb pairing code: %s", qr)
+			}
+		case "S":
+			name = v
+		case "P":
+			password = v
+		}
+	}
+	if name == "" || password == "" {
+		return fmt.Errorf("adbtest: not an adb pairing code: %s", qr)
+	}
+	d.server.mu.Lock()
+	defer d.server.mu.Unlock()
+	d.pairName, d.pairAddr, d.pairCode = name, addr, password
+	return nil
+}
+
+// Paired reports whether the server is paired with the device
+func (d *Device) Paired() bool {
+	d.server.mu.Lock()
+	defer d.server.mu.Unlock()
+	return d.paired
+}
+
+// mdnsServices lists the services the wireless devices advertise
+func (s *Server) mdnsServices() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	for _, d := range s.wireless {
+		if d.connectAddr != "" {
+			fmt.Fprintf(&b, "%s\t%s.\t%s\n", d.name, adbserver.ServiceTLSConnect, d.connectAddr)
+		}
+		if d.pairAddr != "" {
+			fmt.Fprintf(&b, "%s\t%s.\t%s\n", d.pairName, adbserver.ServiceTLSPairing, d.pairAddr)
+		}
+	}
+	return b.String()
+}
+
+func (s *Server) pair(addr, code string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.wireless {
+		if d.pairAddr != addr {
+			continue
+		}
+		if d.pairCode != code {
+			return "Failed: Wrong password or connection was dropped."
+		}
+		d.paired = true
+		d.pairName, d.pairAddr, d.pairCode = "", "", ""
+		return fmt.Sprintf("Successfully paired to %s [guid=%s]", addr, d.name)
+	}
+	return "Failed: Unable to start pairing client."
+}
+
+func (s *Server) connect(addr string) string {
+	s.mu.Lock()
+	msg, attached := s.connectLocked(addr)
+	s.mu.Unlock()
+	if attached {
+		s.notify()
+	}
+	return msg
+}
+
+func (s *Server) connectLocked(addr string) (string, bool) {
+	for _, d := range s.wireless {
+		if d.connectAddr != addr {
+			continue
+		}
+		if !d.paired {
+			return fmt.Sprintf("failed to connect to %s", addr), false
+		}
+		for _, attached := range s.devices {
+			if attached == d && d.Serial == addr {
+				return "already connected to " + addr, false
+			}
+		}
+		d.Serial, d.State = addr, "device"
+		s.devices = append(s.devices, d)
+		return "connected to " + addr, true
+	}
+	return fmt.Sprintf("failed to connect to '%s': Connection refused", addr), false
+}
+
+func (s *Server) disconnect(addr string, w io.Writer) {
+	s.mu.Lock()
+	for i, d := range s.devices {
+		if d.Serial == addr {
+			s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			s.mu.Unlock()
+			s.notify()
+			okay(w, "disconnected "+addr)
+			return
+		}
+	}
+	s.mu.Unlock()
+	fail(w, fmt.Sprintf("no such device '%s'", addr))
+}
@@ -0,0 +1,247 @@
+package adbserver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/basiooo/goadb/wire"
+)
+
+// Client talks the adb host protocol to the server of an Endpoint directly,
+// without starting an adb process per call. Like adb itself it opens a new
+// connection for every request.
+type Client struct {
+	endpoint Endpoint
+
+	featuresMu sync.Mutex
+	features   map[string]map[string]bool // by serial
+}
+
+// NewClient returns a client of the adb server at e
+func NewClient(e Endpoint) *Client {
+	return &Client{endpoint: e, features: make(map[string]map[string]bool)}
+}
+
+// DefaultClient returns a client of the Default endpoint
+func DefaultClient() *Client {
+	return NewClient(Default())
+}
+
+// Endpoint returns the adb server of the client
+func (c *Client) Endpoint() Endpoint {
+	return c.endpoint
+}
+
+// Device returns the device with serial, which is not checked to exist
+func (c *Client) Device(serial string) *Device {
+	return &Device{client: c, serial: serial}
+}
+
+// DeviceEntry is a device the adb server knows of
+type DeviceEntry struct {
+	Serial      string
+	State       string // device, offline, unauthorized...
+	Product     string
+	Model       string
+	Device      string
+	TransportID string
+}
+
+// Devices lists the devices of the server
+func (c *Client) Devices(ctx context.Context) ([]DeviceEntry, error) {
+	resp, err := c.hostQuery(ctx, "host:devices-l")
+	if err != nil {
+		return nil, err
+	}
+	return ParseDevices(string(resp)), nil
+}
+
+// ParseDevices parses the device list of host:devices-l, which is also the
+// output of adb devices -l
+func ParseDevices(list string) []DeviceEntry {
+	var devices []DeviceEntry
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(line, "List of devices") {
+			continue
+		}
+		d := DeviceEntry{Serial: fields[0], State: fields[1]}
+		for _, field := range fields[2:] {
+			key, value, ok := strings.Cut(field, ":")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "product":
+				d.Product = value
+			case "model":
+				d.Model = value
+			case "device":
+				d.Device = value
+			case "transport_id":
+				d.TransportID = value
+			}
+		}
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// hostQuery sends a host request and returns its response
+func (c *Client) hostQuery(ctx context.Context, req string) ([]byte, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.request(req); err != nil {
+		return nil, err
+	}
+	resp, err := readMessage(conn.nc)
+	if err != nil {
+		return nil, fmt.Errorf("adb %s: %w", req, err)
+	}
+	return resp, nil
+}
+
+// hostCommand sends a host request answered by a second status, such as a
+// forward, and returns the optional message after it
+func (c *Client) hostCommand(ctx context.Context, req string, reply bool) (string, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := conn.request(req); err != nil {
+		return "", err
+	}
+	return conn.result(req, reply)
+}
+
+// conn is a connection to the adb server. The goadb wire framing reads the
+// socket unbuffered, so shell packets can be read from it after a request.
+type conn struct {
+	*wire.Conn
+	nc   net.Conn
+	stop func() bool
+}
+
+// dial connects to the server. The connection is closed when ctx is done.
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", c.endpoint.Addr())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to adb server at %s: %w", c.endpoint.Addr(), err)
+	}
+	cn := &conn{Conn: wire.NewConn(wire.NewScanner(nc), wire.NewSender(nc)), nc: nc}
+	cn.stop = context.AfterFunc(ctx, func() { nc.Close() })
+	return cn, nil
+}
+
+func (cn *conn) Close() error {
+	cn.stop()
+	return cn.nc.Close()
+}
+
+// request sends req and reads its status
+func (cn *conn) request(req string) error {
+	if err := writeMessage(cn.nc, req); err != nil {
+		return fmt.Errorf("adb %s: %w", req, err)
+	}
+	if err := readOkay(cn.nc, false); err != nil {
+		return fmt.Errorf("adb %s: %w", req, err)
+	}
+	return nil
+}
+
+// result reads the second status of commands like forward and reverse, and
+// the message after it if reply is set
+func (cn *conn) result(req string, reply bool) (string, error) {
+	if err := readOkay(cn.nc, false); err != nil {
+		return "", fmt.Errorf("adb %s: %w", req, err)
+	}
+	if !reply {
+		return "", nil
+	}
+	msg, err := readMessage(cn.nc)
+	if err != nil {
+		return "", fmt.Errorf("adb %s: %w", req, err)
+	}
+	return string(msg), nil
+}
+
+// readStatus reads a status, returning the message of FAIL as the error.
+// The message length is binary in the sync service and hex elsewhere.
+func readStatus(r io.Reader, sync bool) (string, error) {
+	status := make([]byte, 4)
+	if _, err := io.ReadFull(r, status); err != nil {
+		return "", err
+	}
+	if string(status) != "FAIL" {
+		return string(status), nil
+	}
+
+	if !sync {
+		msg, err := readMessage(r)
+		if err != nil {
+			return "", err
+		}
+		return "", errors.New(string(msg))
+	}
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", err
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+	return "", errors.New(string(msg))
+}
+
+// The goadb wire framing caps messages at 255 bytes, less than device lists
+// and shell command lines need, so messages are framed here: a hex length of
+// 4 digits, then the message
+
+func writeMessage(w io.Writer, msg string) error {
+	if len(msg) > 0xffff {
+		return fmt.Errorf("message of %d bytes is too long", len(msg))
+	}
+	_, err := fmt.Fprintf(w, "%04x%s", len(msg), msg)
+	return err
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	hex := make([]byte, 4)
+	if _, err := io.ReadFull(r, hex); err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseUint(string(hex), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message length %q", hex)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// readOkay reads a status that must be OKAY
+func readOkay(r io.Reader, sync bool) error {
+	status, err := readStatus(r, sync)
+	if err != nil {
+		return err
+	}
+	if status != "OKAY" {
+		return fmt.Errorf("unexpected status %q", status)
+	}
+	return nil
+}
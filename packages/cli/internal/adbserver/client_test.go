@@ -0,0 +1,170 @@
+package adbserver_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDevices(t *testing.T) {
+	server := adbtest.NewServer(t)
+	server.AddDevice("emulator-5554")
+	offline := server.AddDevice("192.168.1.20:5555")
+	offline.State = "offline"
+
+	devices, err := server.Client().Devices(context.Background())
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	assert.Equal(t, adbserver.DeviceEntry{Serial: "emulator-5554", State: "device", Product: "gbox_fake", Model: "gbox_fake", Device: "gbox_fake", TransportID: "1"}, devices[0])
+	assert.Equal(t, "offline", devices[1].State)
+
+	features, err := server.Client().Device("192.168.1.20:5555").Features(context.Background())
+	require.NoError(t, err)
+	assert.True(t, features["shell_v2"])
+}
+
+func TestClientShell(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddDevice("emulator-5554")
+	d.ShellOutput("getprop ro.serialno", "EMULATOR35X1\n")
+	d.HandleShell("cat", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.Copy(stdout, stdin)
+		io.WriteString(stderr, "done")
+		return 3
+	})
+	ctx := context.Background()
+	dev := server.Client().Device("emulator-5554")
+
+	out, err := dev.Output(ctx, "getprop ro.serialno")
+	require.NoError(t, err)
+	assert.Equal(t, "EMULATOR35X1\n", string(out))
+
+	var stdout, stderr bytes.Buffer
+	code, err := dev.Shell(ctx, "cat", strings.NewReader("hello"), &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "hello", stdout.String())
+	assert.Equal(t, "done", stderr.String())
+
+	// Service requests may exceed the 255 bytes goadb allows, as the
+	// scrcpy command line does
+	stdout.Reset()
+	long := strings.Repeat("x", 400)
+	_, err = dev.Shell(ctx, "cat "+long, strings.NewReader(long), &stdout, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, long, stdout.String())
+
+	_, err = dev.Output(ctx, "missing --flag")
+	var exitErr *adbserver.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 127, exitErr.Code)
+	assert.Contains(t, exitErr.Error(), "missing: inaccessible or not found")
+
+	_, err = server.Client().Device("emulator-5556").Output(ctx, "id")
+	assert.ErrorContains(t, err, "device 'emulator-5556' not found")
+
+	// Devices without shell v2 report the exit code through the legacy shell
+	legacy := server.AddDevice("legacy")
+	legacy.Features = nil
+	legacy.HandleShell("false", func(string, io.Reader, io.Writer, io.Writer) int { return 1 })
+	legacy.ShellOutput("echo", "hi\n")
+	out, err = server.Client().Device("legacy").Output(ctx, "echo hi")
+	require.NoError(t, err)
+	assert.Equal(t, "hi\n", string(out))
+	_, err = server.Client().Device("legacy").Output(ctx, "false")
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.Code)
+
+	assert.Equal(t, `ls -la '/sdcard/My Files' 'it'\''s'`, adbserver.Quote("ls", "-la", "/sdcard/My Files", "it's"))
+}
+
+func TestClientSync(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddDevice("emulator-5554")
+	d.WriteFile("/sdcard/notes.txt", []byte("hello"), 0o644)
+	ctx := context.Background()
+	dev := server.Client().Device("emulator-5554")
+
+	// Push more than one sync chunk
+	content := bytes.Repeat([]byte("gbox"), 40*1024)
+	mtime := time.Unix(1700000000, 0)
+	require.NoError(t, dev.Push(ctx, bytes.NewReader(content), "/sdcard/Download/big.bin", 0o600, mtime))
+	got, ok := d.ReadFile("/sdcard/Download/big.bin")
+	require.True(t, ok)
+	assert.Equal(t, content, got)
+
+	var pulled bytes.Buffer
+	require.NoError(t, dev.Pull(ctx, "/sdcard/Download/big.bin", &pulled))
+	assert.Equal(t, content, pulled.Bytes())
+	assert.ErrorIs(t, dev.Pull(ctx, "/sdcard/missing", io.Discard), fs.ErrNotExist)
+
+	info, err := dev.Stat(ctx, "/sdcard/Download/big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "big.bin", info.Name)
+	assert.Equal(t, int64(len(content)), info.Size)
+	assert.Equal(t, os.FileMode(0o600), info.Mode)
+	assert.Equal(t, mtime.Unix(), info.ModTime.Unix())
+
+	info, err = dev.Stat(ctx, "/sdcard")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	_, err = dev.Stat(ctx, "/sdcard/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	entries, err := dev.List(ctx, "/sdcard")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Download", entries[0].Name)
+	assert.True(t, entries[0].IsDir())
+	assert.Equal(t, "notes.txt", entries[1].Name)
+	assert.Equal(t, int64(5), entries[1].Size)
+}
+
+func TestClientForwards(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddDevice("emulator-5554")
+	ctx := context.Background()
+	dev := server.Client().Device("emulator-5554")
+
+	_, err := dev.Reverse(ctx, "localabstract:scrcpy_00002710", "tcp:10000")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"localabstract:scrcpy_00002710": "tcp:10000"}, d.Reverses())
+	rules, err := dev.ReverseList(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []adbserver.ForwardRule{{Serial: "emulator-5554", Local: "localabstract:scrcpy_00002710", Remote: "tcp:10000"}}, rules)
+	require.NoError(t, dev.ReverseRemove(ctx, "localabstract:scrcpy_00002710"))
+	assert.ErrorContains(t, dev.ReverseRemove(ctx, "localabstract:scrcpy_00002710"), "not found")
+
+	port, err := dev.Forward(ctx, "tcp:0", "localabstract:scrcpy_00002710")
+	require.NoError(t, err)
+	assert.NotEmpty(t, port)
+	assert.Equal(t, map[string]string{"tcp:" + port: "emulator-5554 localabstract:scrcpy_00002710"}, server.Forwards())
+	require.NoError(t, dev.ForwardRemove(ctx, "tcp:"+port))
+	assert.Empty(t, server.Forwards())
+}
+
+func TestClientContext(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddDevice("emulator-5554")
+	d.HandleShell("sleep", func(_ string, stdin io.Reader, _, _ io.Writer) int {
+		io.Copy(io.Discard, stdin)
+		return 0
+	})
+
+	// Cancelling the context stops a running command
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	pr, _ := io.Pipe()
+	_, err := server.Client().Device("emulator-5554").Shell(ctx, "sleep 100", pr, nil, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
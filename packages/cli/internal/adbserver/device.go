@@ -0,0 +1,120 @@
+package adbserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Device runs services on one device of the adb server
+type Device struct {
+	client *Client
+	serial string
+}
+
+// Serial returns the serial of the device
+func (d *Device) Serial() string {
+	return d.serial
+}
+
+// open switches a new connection to the transport of the device and starts
+// service on it
+func (d *Device) open(ctx context.Context, service string) (*conn, error) {
+	conn, err := d.client.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.request("host:transport:" + d.serial); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.request(service); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Features returns the adb features of the device, such as shell_v2
+func (d *Device) Features(ctx context.Context) (map[string]bool, error) {
+	c := d.client
+	c.featuresMu.Lock()
+	features, ok := c.features[d.serial]
+	c.featuresMu.Unlock()
+	if ok {
+		return features, nil
+	}
+
+	resp, err := c.hostQuery(ctx, "host-serial:"+d.serial+":features")
+	if err != nil {
+		return nil, err
+	}
+	features = make(map[string]bool)
+	for _, f := range strings.Split(strings.TrimSpace(string(resp)), ",") {
+		if f != "" {
+			features[f] = true
+		}
+	}
+
+	c.featuresMu.Lock()
+	c.features[d.serial] = features
+	c.featuresMu.Unlock()
+	return features, nil
+}
+
+// ForwardRule is a forward or reverse forward of the adb server
+type ForwardRule struct {
+	Serial string
+	Local  string
+	Remote string
+}
+
+// Forward forwards local on the adb server host to remote on the device, as
+// adb forward. It returns the port allocated for local tcp:0.
+func (d *Device) Forward(ctx context.Context, local, remote string) (string, error) {
+	return d.client.hostCommand(ctx, fmt.Sprintf("host-serial:%s:forward:%s;%s", d.serial, local, remote), local == "tcp:0")
+}
+
+// ForwardRemove removes the forward of local
+func (d *Device) ForwardRemove(ctx context.Context, local string) error {
+	_, err := d.client.hostCommand(ctx, fmt.Sprintf("host-serial:%s:killforward:%s", d.serial, local), false)
+	return err
+}
+
+// Reverse forwards remote on the device to local on the adb server host, as
+// adb reverse. It returns the port allocated for remote tcp:0.
+func (d *Device) Reverse(ctx context.Context, remote, local string) (string, error) {
+	return d.reverseCommand(ctx, fmt.Sprintf("reverse:forward:%s;%s", remote, local), remote == "tcp:0")
+}
+
+// ReverseRemove removes the reverse forward of remote
+func (d *Device) ReverseRemove(ctx context.Context, remote string) error {
+	_, err := d.reverseCommand(ctx, "reverse:killforward:"+remote, false)
+	return err
+}
+
+// ReverseList lists the reverse forwards of the device
+func (d *Device) ReverseList(ctx context.Context) ([]ForwardRule, error) {
+	list, err := d.reverseCommand(ctx, "reverse:list-forward", true)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ForwardRule
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		rules = append(rules, ForwardRule{Serial: fields[0], Local: fields[1], Remote: fields[2]})
+	}
+	return rules, nil
+}
+
+func (d *Device) reverseCommand(ctx context.Context, service string, reply bool) (string, error) {
+	conn, err := d.open(ctx, service)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.result(service, reply)
+}
@@ -0,0 +1,158 @@
+// Package adbserver locates the adb server gbox manages devices through and
+// the adb binary that talks to it. The server may run on this machine, on a
+// separate adb host or in a container sidecar; every component that runs adb
+// or dials the server gets its endpoint from here.
+package adbserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/babelcloud/gbox/packages/cli/config"
+	adb "github.com/basiooo/goadb"
+)
+
+// DefaultPort is the port of an adb server started without -P
+const DefaultPort = adb.AdbPort
+
+// Endpoint is an adb server and the adb binary used to run commands against it
+type Endpoint struct {
+	Host string // empty is localhost
+	Port int    // 0 is DefaultPort
+	// Path is the adb binary, looked up in PATH when empty
+	Path string
+}
+
+var warnOnce sync.Once
+
+// Default returns the endpoint of the config: adb.server_socket (or
+// ADB_SERVER_SOCKET) if set, otherwise adb.host and adb.port
+func Default() Endpoint {
+	e := Endpoint{
+		Host: config.GetAdbHost(),
+		Port: config.GetAdbPort(),
+		Path: config.GetAdbPath(),
+	}
+	if socket := config.GetAdbServerSocket(); socket != "" {
+		host, port, err := ParseSocket(socket)
+		if err != nil {
+			warnOnce.Do(func() { log.Printf("Warning: ignoring adb server socket: %v", err) })
+		} else {
+			e.Host, e.Port = host, port
+		}
+	}
+	return e
+}
+
+// ParseSocket parses an adb server socket in the ADB_SERVER_SOCKET format,
+// tcp:port or tcp:host:port
+func ParseSocket(socket string) (host string, port int, err error) {
+	rest, ok := strings.CutPrefix(socket, "tcp:")
+	if !ok {
+		return "", 0, fmt.Errorf("unsupported adb server socket %q, only tcp:[host:]port is supported", socket)
+	}
+	portStr := rest
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		host, portStr = strings.Trim(rest[:i], "[]"), rest[i+1:]
+	}
+	port, err = strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in adb server socket %q", socket)
+	}
+	return host, port, nil
+}
+
+// HostOrLocal returns the host of the server, localhost when unset
+func (e Endpoint) HostOrLocal() string {
+	if e.Host == "" {
+		return "localhost"
+	}
+	return e.Host
+}
+
+// PortOrDefault returns the port of the server, DefaultPort when unset
+func (e Endpoint) PortOrDefault() int {
+	if e.Port == 0 {
+		return DefaultPort
+	}
+	return e.Port
+}
+
+// Addr returns host:port of the server
+func (e Endpoint) Addr() string {
+	return net.JoinHostPort(e.HostOrLocal(), strconv.Itoa(e.PortOrDefault()))
+}
+
+// IsLocal reports whether the server runs on this machine. adb reverse
+// forwards only reach gbox through a local server, and only a local server
+// can be started by gbox.
+func (e Endpoint) IsLocal() bool {
+	switch e.HostOrLocal() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// Binary returns the adb binary to run
+func (e Endpoint) Binary() string {
+	if e.Path != "" {
+		return e.Path
+	}
+	if path, err := exec.LookPath("adb"); err == nil {
+		return path
+	}
+	return "adb"
+}
+
+// Installed reports whether the adb binary exists
+func (e Endpoint) Installed() bool {
+	_, err := exec.LookPath(e.Binary())
+	return err == nil
+}
+
+// Args returns args preceded by the options that point adb at the server
+func (e Endpoint) Args(args ...string) []string {
+	var global []string
+	if e.Host != "" && e.Host != "localhost" {
+		global = append(global, "-H", e.Host)
+	}
+	if e.Port != 0 && e.Port != DefaultPort {
+		global = append(global, "-P", strconv.Itoa(e.Port))
+	}
+	return append(global, args...)
+}
+
+// Command returns a command running adb with args against the server
+func (e Endpoint) Command(args ...string) *exec.Cmd {
+	return exec.Command(e.Binary(), e.Args(args...)...)
+}
+
+// CommandContext is Command with a context that kills adb when done
+func (e Endpoint) CommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, e.Binary(), e.Args(args...)...)
+}
+
+// CommandLine returns adb with args as one line for sh -c. args are not quoted.
+func (e Endpoint) CommandLine(args ...string) string {
+	return strings.Join(append([]string{e.Binary()}, e.Args(args...)...), " ")
+}
+
+// ServerConfig returns the goadb configuration of the server
+func (e Endpoint) ServerConfig() adb.ServerConfig {
+	return adb.ServerConfig{
+		PathToAdb: e.Path,
+		Host:      e.HostOrLocal(),
+		Port:      e.PortOrDefault(),
+	}
+}
+
+func (e Endpoint) String() string {
+	return "tcp:" + e.Addr()
+}
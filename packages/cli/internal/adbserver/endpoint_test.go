@@ -0,0 +1,56 @@
+package adbserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSocket(t *testing.T) {
+	host, port, err := ParseSocket("tcp:5038")
+	require.NoError(t, err)
+	assert.Equal(t, "", host)
+	assert.Equal(t, 5038, port)
+
+	host, port, err = ParseSocket("tcp:adb-sidecar:5037")
+	require.NoError(t, err)
+	assert.Equal(t, "adb-sidecar", host)
+	assert.Equal(t, 5037, port)
+
+	host, _, err = ParseSocket("tcp:[::1]:5037")
+	require.NoError(t, err)
+	assert.Equal(t, "::1", host)
+
+	for _, socket := range []string{"localfilesystem:/tmp/adb", "tcp:host:port", "tcp:70000", "tcp:"} {
+		_, _, err := ParseSocket(socket)
+		assert.Error(t, err, socket)
+	}
+}
+
+func TestEndpointArgs(t *testing.T) {
+	assert.Equal(t, []string{"devices"}, Endpoint{}.Args("devices"))
+	assert.Equal(t, []string{"devices"}, Endpoint{Host: "localhost", Port: DefaultPort}.Args("devices"))
+	assert.Equal(t, []string{"-P", "5038", "devices"}, Endpoint{Port: 5038}.Args("devices"))
+	assert.Equal(t, []string{"-H", "10.0.0.2", "-P", "5038", "-s", "emulator-5554", "shell", "id"},
+		Endpoint{Host: "10.0.0.2", Port: 5038}.Args("-s", "emulator-5554", "shell", "id"))
+
+	e := Endpoint{Host: "10.0.0.2", Path: "/opt/android/adb"}
+	assert.Equal(t, "/opt/android/adb -H 10.0.0.2 -s emulator-5554 shell getprop", e.CommandLine("-s", "emulator-5554", "shell", "getprop"))
+	assert.Equal(t, "10.0.0.2:5037", e.Addr())
+	assert.Equal(t, "tcp:10.0.0.2:5037", e.String())
+	assert.False(t, e.IsLocal())
+	assert.True(t, Endpoint{Host: "127.0.0.1"}.IsLocal())
+}
+
+func TestDefault(t *testing.T) {
+	t.Setenv("GBOX_ADB_PATH", "/opt/android/adb")
+	t.Setenv("GBOX_ADB_HOST", "adb-host")
+	t.Setenv("GBOX_ADB_PORT", "5040")
+	t.Setenv("ADB_SERVER_SOCKET", "")
+	assert.Equal(t, Endpoint{Host: "adb-host", Port: 5040, Path: "/opt/android/adb"}, Default())
+
+	// The adb server socket wins over host and port
+	t.Setenv("ADB_SERVER_SOCKET", "tcp:adb-sidecar:5037")
+	assert.Equal(t, Endpoint{Host: "adb-sidecar", Port: 5037, Path: "/opt/android/adb"}, Default())
+}
@@ -0,0 +1,186 @@
+package adbserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Packet ids of the shell v2 protocol
+const (
+	shellStdin      = 0
+	shellStdout     = 1
+	shellStderr     = 2
+	shellExit       = 3
+	shellCloseStdin = 4
+)
+
+// shellV1Exit marks the exit code appended to the output of devices without
+// shell v2
+const shellV1Exit = ":gbox-exit:"
+
+// ExitError is the error of a shell command that exited non-zero
+type ExitError struct {
+	Code   int
+	Stderr []byte
+}
+
+func (e *ExitError) Error() string {
+	if msg := strings.TrimSpace(string(e.Stderr)); msg != "" {
+		return fmt.Sprintf("exit status %d: %s", e.Code, msg)
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Output runs cmd on the device and returns its stdout. A command that exits
+// non-zero returns an *ExitError with its stderr.
+func (d *Device) Output(ctx context.Context, cmd string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	code, err := d.Shell(ctx, cmd, nil, &stdout, &stderr)
+	if err != nil {
+		return nil, err
+	}
+	if code != 0 {
+		return stdout.Bytes(), &ExitError{Code: code, Stderr: stderr.Bytes()}
+	}
+	return stdout.Bytes(), nil
+}
+
+// Shell runs cmd on the device as adb shell does without a pty, copying stdin
+// to it until EOF and its output to stdout and stderr, and returns its exit
+// code. stdin may be nil.
+func (d *Device) Shell(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	features, err := d.Features(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !features["shell_v2"] {
+		if stdin != nil {
+			return 0, fmt.Errorf("device %s does not support shell input", d.serial)
+		}
+		return d.shellV1(ctx, cmd, stdout)
+	}
+
+	conn, err := d.open(ctx, "shell,v2,raw:"+cmd)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if stdin == nil {
+		if err := writeShellPacket(conn.nc, shellCloseStdin, nil); err != nil {
+			return 0, err
+		}
+	} else {
+		go copyShellInput(conn, stdin)
+	}
+
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(conn.nc, header); err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			return 0, fmt.Errorf("shell %q on %s: %w", cmd, d.serial, err)
+		}
+		payload := io.LimitReader(conn.nc, int64(binary.LittleEndian.Uint32(header[1:])))
+		switch header[0] {
+		case shellStdout:
+			_, err = io.Copy(writerOrDiscard(stdout), payload)
+		case shellStderr:
+			_, err = io.Copy(writerOrDiscard(stderr), payload)
+		case shellExit:
+			code := make([]byte, 1)
+			if _, err := io.ReadFull(payload, code); err != nil {
+				return 0, fmt.Errorf("shell %q on %s: %w", cmd, d.serial, err)
+			}
+			return int(code[0]), nil
+		default:
+			_, err = io.Copy(io.Discard, payload)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("shell %q on %s: %w", cmd, d.serial, err)
+		}
+	}
+}
+
+// shellV1 runs cmd through the legacy shell service, which merges stderr
+// into stdout and drops the exit code, so the code is echoed after the output
+func (d *Device) shellV1(ctx context.Context, cmd string, stdout io.Writer) (int, error) {
+	conn, err := d.open(ctx, fmt.Sprintf("shell:(%s); echo %s$?", cmd, shellV1Exit))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	output, err := io.ReadAll(conn.nc)
+	if err != nil && ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	i := bytes.LastIndex(output, []byte(shellV1Exit))
+	if i < 0 {
+		return 0, fmt.Errorf("shell %q on %s: connection closed before exit", cmd, d.serial)
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(output[i+len(shellV1Exit):])))
+	if err != nil {
+		return 0, fmt.Errorf("shell %q on %s: invalid exit code", cmd, d.serial)
+	}
+	if _, err := writerOrDiscard(stdout).Write(output[:i]); err != nil {
+		return 0, err
+	}
+	return code, nil
+}
+
+// copyShellInput sends stdin in shell packets, then closes the input
+func copyShellInput(conn *conn, stdin io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stdin.Read(buf)
+		if n > 0 {
+			if writeShellPacket(conn.nc, shellStdin, buf[:n]) != nil {
+				return
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	writeShellPacket(conn.nc, shellCloseStdin, nil)
+}
+
+func writeShellPacket(w io.Writer, id byte, data []byte) error {
+	packet := make([]byte, 5+len(data))
+	packet[0] = id
+	binary.LittleEndian.PutUint32(packet[1:], uint32(len(data)))
+	copy(packet[5:], data)
+	_, err := w.Write(packet)
+	return err
+}
+
+func writerOrDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Quote joins args into a command line for the device shell, quoting the
+// ones the shell would split or expand
+func Quote(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,232 @@
+package adbserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/basiooo/goadb/wire"
+)
+
+// FileInfo is a file on the device as reported by the sync service
+type FileInfo struct {
+	Name    string
+	Mode    os.FileMode
+	Size    int64
+	ModTime time.Time
+}
+
+// IsDir reports whether the file is a directory
+func (f FileInfo) IsDir() bool {
+	return f.Mode.IsDir()
+}
+
+// syncConn is a connection switched to the sync service
+type syncConn struct {
+	*conn
+	*wire.SyncConn
+}
+
+func (d *Device) openSync(ctx context.Context) (*syncConn, error) {
+	conn, err := d.open(ctx, "sync:")
+	if err != nil {
+		return nil, err
+	}
+	sc := conn.NewSyncConn()
+	return &syncConn{conn: conn, SyncConn: sc}, nil
+}
+
+func (sc *syncConn) Close() error {
+	return sc.conn.Close()
+}
+
+func (sc *syncConn) request(id, p string) error {
+	if err := sc.SendOctetString(id); err != nil {
+		return err
+	}
+	return sc.SendBytes([]byte(p))
+}
+
+// readStat reads the mode, size and modification time of STAT and DENT
+func (sc *syncConn) readStat(name string) (FileInfo, error) {
+	mode, err := sc.ReadFileMode()
+	if err != nil {
+		return FileInfo{}, err
+	}
+	size, err := sc.ReadInt32()
+	if err != nil {
+		return FileInfo{}, err
+	}
+	mtime, err := sc.ReadTime()
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Name: name, Mode: mode, Size: int64(uint32(size)), ModTime: mtime}, nil
+}
+
+// Stat returns the file at p. A file that does not exist returns an error
+// matching fs.ErrNotExist.
+func (d *Device) Stat(ctx context.Context, p string) (*FileInfo, error) {
+	sc, err := d.openSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sc.Close()
+
+	if err := sc.request("STAT", p); err != nil {
+		return nil, syncError("stat", p, err)
+	}
+	id, err := readStatus(sc.nc, true)
+	if err != nil {
+		return nil, syncError("stat", p, err)
+	}
+	if id != "STAT" {
+		return nil, fmt.Errorf("stat %s: unexpected sync response %q", p, id)
+	}
+	info, err := sc.readStat(path.Base(p))
+	if err != nil {
+		return nil, syncError("stat", p, err)
+	}
+	// The sync service reports a missing file as all zeros
+	if info.Mode == 0 && info.Size == 0 && info.ModTime.Unix() == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	return &info, nil
+}
+
+// List returns the entries of the directory p, without . and ..
+func (d *Device) List(ctx context.Context, p string) ([]FileInfo, error) {
+	sc, err := d.openSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sc.Close()
+
+	if err := sc.request("LIST", p); err != nil {
+		return nil, syncError("list", p, err)
+	}
+	var entries []FileInfo
+	for {
+		id, err := readStatus(sc.nc, true)
+		if err != nil {
+			return nil, syncError("list", p, err)
+		}
+		if id == "DONE" {
+			// DONE carries an empty entry
+			if _, err := sc.readStat(""); err != nil {
+				return nil, syncError("list", p, err)
+			}
+			if _, err := sc.ReadString(); err != nil {
+				return nil, syncError("list", p, err)
+			}
+			return entries, nil
+		}
+		if id != "DENT" {
+			return nil, fmt.Errorf("list %s: unexpected sync response %q", p, id)
+		}
+		info, err := sc.readStat("")
+		if err != nil {
+			return nil, syncError("list", p, err)
+		}
+		if info.Name, err = sc.ReadString(); err != nil {
+			return nil, syncError("list", p, err)
+		}
+		if info.Name != "." && info.Name != ".." {
+			entries = append(entries, info)
+		}
+	}
+}
+
+// Pull copies the file at p to w
+func (d *Device) Pull(ctx context.Context, p string, w io.Writer) error {
+	sc, err := d.openSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	if err := sc.request("RECV", p); err != nil {
+		return syncError("pull", p, err)
+	}
+	for {
+		id, err := readStatus(sc.nc, true)
+		if err != nil {
+			return syncError("pull", p, err)
+		}
+		switch id {
+		case "DONE":
+			return nil
+		case "DATA":
+			chunk, err := sc.ReadBytes()
+			if err != nil {
+				return syncError("pull", p, err)
+			}
+			if _, err := io.Copy(w, chunk); err != nil {
+				return syncError("pull", p, err)
+			}
+		default:
+			return fmt.Errorf("pull %s: unexpected sync response %q", p, id)
+		}
+	}
+}
+
+// Push writes r to the file at p with mode, creating its parent directories.
+// It returns once the device has written the file.
+func (d *Device) Push(ctx context.Context, r io.Reader, p string, mode os.FileMode, mtime time.Time) error {
+	sc, err := d.openSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	// The sync service takes the mode of a regular file in the st_mode format
+	if err := sc.request("SEND", fmt.Sprintf("%s,%d", p, 0o100000|uint32(mode.Perm()))); err != nil {
+		return syncError("push", p, err)
+	}
+	buf := make([]byte, wire.SyncMaxChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := sc.SendOctetString("DATA"); err != nil {
+				return syncError("push", p, err)
+			}
+			if err := sc.SendBytes(buf[:n]); err != nil {
+				return syncError("push", p, err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("push %s: %w", p, err)
+		}
+	}
+	if mtime.IsZero() {
+		mtime = time.Now()
+	}
+	if err := sc.SendOctetString("DONE"); err != nil {
+		return syncError("push", p, err)
+	}
+	if err := sc.SendTime(mtime); err != nil {
+		return syncError("push", p, err)
+	}
+	// The device answers OKAY, or FAIL with the reason, once the file is written
+	if err := readOkay(sc.nc, true); err != nil {
+		return syncError("push", p, err)
+	}
+	return nil
+}
+
+// syncError wraps an error of the sync service, mapping its missing file
+// message to fs.ErrNotExist
+func syncError(op, p string, err error) error {
+	if strings.Contains(err.Error(), "No such file or directory") {
+		return &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+	}
+	return fmt.Errorf("%s %s: %w", op, p, err)
+}
@@ -0,0 +1,127 @@
+package adbserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// mDNS services of Android 11+ wireless debugging
+const (
+	// ServiceTLSConnect is advertised by a device accepting wireless
+	// debugging connections from paired hosts
+	ServiceTLSConnect = "_adb-tls-connect._tcp"
+	// ServiceTLSPairing is advertised while the pairing dialog of a device
+	// is open
+	ServiceTLSPairing = "_adb-tls-pairing._tcp"
+)
+
+// MDNSService is a service the adb server discovered on the LAN
+type MDNSService struct {
+	// Name is the instance name, adb-<serialno>-<suffix> for devices
+	Name    string
+	Service string
+	Addr    string // host:port
+}
+
+// Serial returns the serial the adb server gives the device when it connects
+// to it on its own
+func (s MDNSService) Serial() string {
+	return s.Name + "." + s.Service
+}
+
+// SerialNo returns the serial number in the name of a device,
+// adb-<serialno>-<suffix>, or "" for other names
+func (s MDNSService) SerialNo() string {
+	name, ok := strings.CutPrefix(s.Name, "adb-")
+	i := strings.LastIndex(name, "-")
+	if !ok || i <= 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+// Host returns the host part of Addr
+func (s MDNSService) Host() string {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return s.Addr
+	}
+	return host
+}
+
+// MDNSServices lists the wireless debugging services the adb server found
+// on the LAN
+func (c *Client) MDNSServices(ctx context.Context) ([]MDNSService, error) {
+	resp, err := c.hostQuery(ctx, "host:mdns:services")
+	if err != nil {
+		return nil, err
+	}
+	return ParseMDNSServices(string(resp)), nil
+}
+
+// ParseMDNSServices parses the service list of host:mdns:services, which is
+// also the output of adb mdns services: name, service and address separated
+// by tabs
+func ParseMDNSServices(list string) []MDNSService {
+	var services []MDNSService
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		services = append(services, MDNSService{
+			Name: fields[0],
+			// Older servers print the fully qualified service name
+			Service: strings.TrimSuffix(fields[1], "."),
+			Addr:    fields[2],
+		})
+	}
+	return services
+}
+
+// Connect connects the adb server to a device debugged over the network and
+// returns the message of the server. adb answers OKAY even when connecting
+// fails, the reason is in the message.
+func (c *Client) Connect(ctx context.Context, addr string) (string, error) {
+	resp, err := c.hostQuery(ctx, "host:connect:"+addr)
+	if err != nil {
+		return "", err
+	}
+	msg := strings.TrimSpace(string(resp))
+	if !strings.HasPrefix(msg, "connected to") && !strings.HasPrefix(msg, "already connected to") {
+		return "", fmt.Errorf("failed to connect to %s: %s", addr, msg)
+	}
+	return msg, nil
+}
+
+// Disconnect disconnects the adb server from a device debugged over the
+// network
+func (c *Client) Disconnect(ctx context.Context, addr string) error {
+	_, err := c.hostQuery(ctx, "host:disconnect:"+addr)
+	return err
+}
+
+// Pair pairs the adb server with a device showing a wireless debugging
+// pairing code. addr is the pairing address of the device, not the one to
+// connect to.
+func (c *Client) Pair(ctx context.Context, addr, code string) (string, error) {
+	resp, err := c.hostQuery(ctx, "host:pair:"+code+":"+addr)
+	if err != nil {
+		return "", err
+	}
+	// Successfully paired to 192.168.1.20:37099 [guid=adb-R58N123ABC-vWgJpq]
+	msg := strings.TrimSpace(string(resp))
+	if !strings.HasPrefix(msg, "Successfully paired") {
+		return "", fmt.Errorf("failed to pair with %s: %s", addr, strings.TrimPrefix(msg, "Failed: "))
+	}
+	return msg, nil
+}
+
+// PairingQR returns the text of the QR code a device scans in "Pair device
+// with QR code" to pair with the adb server. The device then advertises
+// ServiceTLSPairing as name and expects password as its pairing code.
+func PairingQR(name, password string) string {
+	return fmt.Sprintf("WIFI:T:ADB;S:%s;P:%s;;", name, password)
+}
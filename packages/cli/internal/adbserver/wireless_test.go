@@ -0,0 +1,74 @@
+package adbserver_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMDNSServices(t *testing.T) {
+	services := adbserver.ParseMDNSServices("List of discovered mdns services\n" +
+		"adb-R58N123ABC-vWgJpq\t_adb-tls-connect._tcp.\t192.168.1.20:41235\n" +
+		"studio-Xk3\t_adb-tls-pairing._tcp\t192.168.1.21:37099\n")
+	require.Len(t, services, 2)
+	assert.Equal(t, adbserver.MDNSService{Name: "adb-R58N123ABC-vWgJpq", Service: adbserver.ServiceTLSConnect, Addr: "192.168.1.20:41235"}, services[0])
+	assert.Equal(t, "adb-R58N123ABC-vWgJpq._adb-tls-connect._tcp", services[0].Serial())
+	assert.Equal(t, "192.168.1.20", services[0].Host())
+	assert.Equal(t, "R58N123ABC", services[0].SerialNo())
+	assert.Empty(t, services[1].SerialNo())
+	assert.Equal(t, adbserver.ServiceTLSPairing, services[1].Service)
+}
+
+func TestClientPairAndConnect(t *testing.T) {
+	ctx := context.Background()
+	server := adbtest.NewServer(t)
+	client := server.Client()
+	d := server.AddWirelessDevice("adb-R58N123ABC-vWgJpq")
+	d.Listen("192.168.1.20:41235")
+	d.StartPairing("192.168.1.20:37099", "482913")
+
+	services, err := client.MDNSServices(ctx)
+	require.NoError(t, err)
+	assert.Len(t, services, 2)
+
+	// Connecting before pairing is refused
+	_, err = client.Connect(ctx, "192.168.1.20:41235")
+	assert.ErrorContains(t, err, "failed to connect to 192.168.1.20:41235")
+
+	_, err = client.Pair(ctx, "192.168.1.20:37099", "000000")
+	assert.ErrorContains(t, err, "Wrong password")
+	msg, err := client.Pair(ctx, "192.168.1.20:37099", "482913")
+	require.NoError(t, err)
+	assert.Contains(t, msg, "guid=adb-R58N123ABC-vWgJpq")
+
+	msg, err = client.Connect(ctx, "192.168.1.20:41235")
+	require.NoError(t, err)
+	assert.Equal(t, "connected to 192.168.1.20:41235", msg)
+	devices, err := client.Devices(ctx)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, "192.168.1.20:41235", devices[0].Serial)
+
+	require.NoError(t, client.Disconnect(ctx, "192.168.1.20:41235"))
+	assert.Error(t, client.Disconnect(ctx, "192.168.1.20:41235"))
+}
+
+func TestPairingQR(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddWirelessDevice("adb-R58N123ABC-vWgJpq")
+	qr := adbserver.PairingQR("gbox-7fk2", "ab12cd34")
+	assert.Equal(t, "WIFI:T:ADB;S:gbox-7fk2;P:ab12cd34;;", qr)
+	require.NoError(t, d.ScanPairingQR(qr, "192.168.1.20:37099"))
+
+	services, err := server.Client().MDNSServices(context.Background())
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "gbox-7fk2", services[0].Name)
+	_, err = server.Client().Pair(context.Background(), services[0].Addr, "ab12cd34")
+	require.NoError(t, err)
+	assert.True(t, d.Paired())
+}
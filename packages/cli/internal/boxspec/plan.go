@@ -0,0 +1,129 @@
+package boxspec
+
+import (
+	"fmt"
+)
+
+// Action is what applying a spec does to its box
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionReplace   Action = "replace"
+	ActionUnchanged Action = "unchanged"
+)
+
+// Change is the planned change for a single spec
+type Change struct {
+	Spec   Spec
+	Action Action
+	// BoxID of the existing box, empty when creating
+	BoxID string
+	// Diffs lists the differences that cause a replace
+	Diffs []string
+	// Duplicates are additional live boxes carrying the same name label;
+	// they are terminated on apply
+	Duplicates []string
+}
+
+// Plan compares a spec with the boxes currently carrying its name label, as
+// returned by the box list API, and decides what apply has to do. Boxes cannot
+// be updated in place, so any difference replaces the box.
+func Plan(spec Spec, boxes []map[string]interface{}) Change {
+	change := Change{Spec: spec, Action: ActionCreate}
+
+	var live []map[string]interface{}
+	for _, box := range boxes {
+		if status, _ := box["status"].(string); status == "terminated" {
+			continue
+		}
+		live = append(live, box)
+	}
+	if len(live) == 0 {
+		return change
+	}
+
+	current := live[0]
+	change.BoxID, _ = current["id"].(string)
+	for _, box := range live[1:] {
+		if id, ok := box["id"].(string); ok {
+			change.Duplicates = append(change.Duplicates, id)
+		}
+	}
+
+	change.Diffs = diffBox(spec, current)
+	if len(change.Diffs) > 0 {
+		change.Action = ActionReplace
+	} else {
+		change.Action = ActionUnchanged
+	}
+	return change
+}
+
+func diffBox(spec Spec, box map[string]interface{}) []string {
+	var diffs []string
+
+	boxType, _ := box["type"].(string)
+	if boxType != spec.Type {
+		diffs = append(diffs, fmt.Sprintf("type: %q -> %q", boxType, spec.Type))
+	}
+
+	config, _ := box["config"].(map[string]interface{})
+
+	expectedLabels := make(map[string]string, len(spec.Labels)+2)
+	for k, v := range spec.Labels {
+		expectedLabels[k] = v
+	}
+	expectedLabels[NameLabel] = spec.Name
+	if spec.Type == "android" {
+		deviceType, _ := config["deviceType"].(string)
+		if deviceType != spec.DeviceType {
+			diffs = append(diffs, fmt.Sprintf("deviceType: %q -> %q", deviceType, spec.DeviceType))
+		}
+		// CreateAndroidBox always records the device type as a label
+		expectedLabels["device_type"] = spec.DeviceType
+	}
+
+	diffs = append(diffs, diffMap("labels", stringMap(config["labels"]), expectedLabels)...)
+	diffs = append(diffs, diffMap("env", stringMap(config["envs"]), spec.Env)...)
+	return diffs
+}
+
+func diffMap(prefix string, current, expected map[string]string) []string {
+	keys := make(map[string]string, len(current)+len(expected))
+	for k := range current {
+		keys[k] = k
+	}
+	for k := range expected {
+		keys[k] = k
+	}
+
+	var diffs []string
+	for _, k := range sortedKeys(keys) {
+		cur, hasCur := current[k]
+		exp, hasExp := expected[k]
+		switch {
+		case hasCur && !hasExp:
+			diffs = append(diffs, fmt.Sprintf("%s.%s: %q -> (unset)", prefix, k, cur))
+		case !hasCur && hasExp:
+			diffs = append(diffs, fmt.Sprintf("%s.%s: (unset) -> %q", prefix, k, exp))
+		case cur != exp:
+			diffs = append(diffs, fmt.Sprintf("%s.%s: %q -> %q", prefix, k, cur, exp))
+		}
+	}
+	return diffs
+}
+
+// stringMap converts a decoded JSON object into a string map
+func stringMap(v interface{}) map[string]string {
+	raw, _ := v.(map[string]interface{})
+	m := make(map[string]string, len(raw))
+	for k, val := range raw {
+		if s, ok := val.(string); ok {
+			m[k] = s
+		} else {
+			m[k] = fmt.Sprint(val)
+		}
+	}
+	return m
+}
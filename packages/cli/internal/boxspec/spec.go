@@ -0,0 +1,187 @@
+package boxspec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NameLabel is the label used to find the box created for a spec
+const NameLabel = "gbox.name"
+
+// Spec describes a box declaratively. JSON specs are accepted as well since
+// JSON is a subset of YAML.
+type Spec struct {
+	Name       string            `yaml:"name" json:"name"`
+	Type       string            `yaml:"type" json:"type"`                                 // android or linux
+	DeviceType string            `yaml:"deviceType,omitempty" json:"deviceType,omitempty"` // android only: virtual or physical
+	ExpiresIn  string            `yaml:"expiresIn,omitempty" json:"expiresIn,omitempty"`   // android only
+	Labels     map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Env        map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Files      []File            `yaml:"files,omitempty" json:"files,omitempty"`
+	Setup      []string          `yaml:"setup,omitempty" json:"setup,omitempty"`
+	Ports      []Port            `yaml:"ports,omitempty" json:"ports,omitempty"`
+}
+
+// File is a local file or directory uploaded into the box after creation
+type File struct {
+	Source      string `yaml:"src" json:"src"`
+	Destination string `yaml:"dest" json:"dest"`
+}
+
+// Port is a box port forwarded to a local port (android only)
+type Port struct {
+	Local  int `yaml:"local" json:"local"`
+	Remote int `yaml:"remote" json:"remote"`
+}
+
+// LoadFile reads all specs from a file, "-" reads from stdin
+func LoadFile(path string) ([]Spec, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec file: %v", err)
+	}
+
+	specs, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return specs, nil
+}
+
+// Parse parses one or more specs separated by YAML document markers (---)
+// and validates them.
+func Parse(data []byte) ([]Spec, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var specs []Spec
+	names := make(map[string]bool)
+	for {
+		var spec Spec
+		if err := dec.Decode(&spec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("invalid spec: %v", err)
+		}
+		if spec.Name == "" && spec.Type == "" && len(spec.Labels) == 0 {
+			// Empty document, e.g. a trailing "---"
+			continue
+		}
+		spec.applyDefaults()
+		if err := spec.Validate(); err != nil {
+			return nil, err
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("duplicate spec name %q", spec.Name)
+		}
+		names[spec.Name] = true
+		specs = append(specs, spec)
+	}
+
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no box specs found")
+	}
+	return specs, nil
+}
+
+func (s *Spec) applyDefaults() {
+	s.Type = strings.ToLower(s.Type)
+	if s.Type == "android" {
+		if s.DeviceType == "" {
+			s.DeviceType = "virtual"
+		}
+		if s.ExpiresIn == "" {
+			s.ExpiresIn = "60m"
+		}
+	}
+}
+
+// Validate checks that the spec can be applied
+func (s *Spec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("spec is missing a name")
+	}
+	switch s.Type {
+	case "android":
+		if s.DeviceType != "virtual" && s.DeviceType != "physical" {
+			return fmt.Errorf("spec %q: invalid deviceType %q (must be virtual or physical)", s.Name, s.DeviceType)
+		}
+		if _, err := time.ParseDuration(s.ExpiresIn); err != nil {
+			return fmt.Errorf("spec %q: invalid expiresIn %q (must be duration like '30s', '5m', '1h')", s.Name, s.ExpiresIn)
+		}
+	case "linux":
+		if s.DeviceType != "" || s.ExpiresIn != "" {
+			return fmt.Errorf("spec %q: deviceType and expiresIn are only supported for android boxes", s.Name)
+		}
+		if len(s.Ports) > 0 {
+			return fmt.Errorf("spec %q: ports are only supported for android boxes", s.Name)
+		}
+	case "":
+		return fmt.Errorf("spec %q is missing a type (android or linux)", s.Name)
+	default:
+		return fmt.Errorf("spec %q: unsupported type %q (must be android or linux)", s.Name, s.Type)
+	}
+
+	if _, ok := s.Labels[NameLabel]; ok {
+		return fmt.Errorf("spec %q: label %s is reserved", s.Name, NameLabel)
+	}
+	for i, f := range s.Files {
+		if f.Source == "" || f.Destination == "" {
+			return fmt.Errorf("spec %q: files[%d] needs both src and dest", s.Name, i)
+		}
+	}
+	for i, p := range s.Ports {
+		if p.Local <= 0 || p.Local > 65535 || p.Remote <= 0 || p.Remote > 65535 {
+			return fmt.Errorf("spec %q: ports[%d] has an invalid port number", s.Name, i)
+		}
+	}
+	return nil
+}
+
+// LabelPairs returns the spec labels, including the name label, as KEY=VALUE pairs
+func (s *Spec) LabelPairs() []string {
+	pairs := toPairs(s.Labels)
+	return append(pairs, NameLabel+"="+s.Name)
+}
+
+// EnvPairs returns the spec environment as KEY=VALUE pairs
+func (s *Spec) EnvPairs() []string {
+	return toPairs(s.Env)
+}
+
+// NameFilter returns the `box list` filter matching boxes created for the spec
+func (s *Spec) NameFilter() string {
+	return fmt.Sprintf("label=%s=%s", NameLabel, s.Name)
+}
+
+func toPairs(m map[string]string) []string {
+	pairs := make([]string, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		pairs = append(pairs, k+"="+m[k])
+	}
+	return pairs
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+package boxspec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMultipleSpecs(t *testing.T) {
+	data := []byte(`
+name: phone
+type: android
+labels:
+  team: qa
+env:
+  LOG_LEVEL: debug
+files:
+  - src: ./fixtures
+    dest: /sdcard/
+setup:
+  - echo ready
+ports:
+  - local: 5555
+    remote: 5555
+---
+{"name": "worker", "type": "linux", "env": {"A": "1"}}
+---
+`)
+
+	specs, err := Parse(data)
+	require.NoError(t, err)
+	require.Len(t, specs, 2)
+
+	phone := specs[0]
+	assert.Equal(t, "android", phone.Type)
+	assert.Equal(t, "virtual", phone.DeviceType)
+	assert.Equal(t, "60m", phone.ExpiresIn)
+	assert.Equal(t, []string{"team=qa", "gbox.name=phone"}, phone.LabelPairs())
+	assert.Equal(t, []string{"LOG_LEVEL=debug"}, phone.EnvPairs())
+	assert.Equal(t, []Port{{Local: 5555, Remote: 5555}}, phone.Ports)
+	assert.Equal(t, "label=gbox.name=phone", phone.NameFilter())
+
+	assert.Equal(t, "linux", specs[1].Type)
+	assert.Equal(t, map[string]string{"A": "1"}, specs[1].Env)
+}
+
+func TestParseInvalidSpecs(t *testing.T) {
+	cases := map[string]string{
+		"missing name":   "type: linux",
+		"missing type":   "name: a",
+		"bad type":       "name: a\ntype: windows",
+		"unknown field":  "name: a\ntype: linux\nimage: x",
+		"linux ports":    "name: a\ntype: linux\nports: [{local: 1, remote: 2}]",
+		"bad expiry":     "name: a\ntype: android\nexpiresIn: soon",
+		"reserved label": "name: a\ntype: linux\nlabels: {gbox.name: b}",
+		"duplicate name": "name: a\ntype: linux\n---\nname: a\ntype: linux",
+		"empty":          "",
+	}
+	for name, data := range cases {
+		_, err := Parse([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	spec := Spec{Name: "phone", Type: "android", DeviceType: "virtual", Labels: map[string]string{"team": "qa"}}
+
+	// No box yet
+	change := Plan(spec, nil)
+	assert.Equal(t, ActionCreate, change.Action)
+
+	// Terminated boxes are ignored
+	change = Plan(spec, []map[string]interface{}{{"id": "old", "status": "terminated"}})
+	assert.Equal(t, ActionCreate, change.Action)
+
+	matching := map[string]interface{}{
+		"id":     "box-1",
+		"type":   "android",
+		"status": "running",
+		"config": map[string]interface{}{
+			"deviceType": "virtual",
+			"labels":     map[string]interface{}{"team": "qa", "gbox.name": "phone", "device_type": "virtual"},
+			"envs":       map[string]interface{}{},
+		},
+	}
+	change = Plan(spec, []map[string]interface{}{matching, {"id": "box-2", "status": "running"}})
+	assert.Equal(t, ActionUnchanged, change.Action)
+	assert.Equal(t, "box-1", change.BoxID)
+	assert.Equal(t, []string{"box-2"}, change.Duplicates)
+
+	spec.Labels["team"] = "dev"
+	spec.Env = map[string]string{"A": "1"}
+	change = Plan(spec, []map[string]interface{}{matching})
+	assert.Equal(t, ActionReplace, change.Action)
+	assert.Equal(t, []string{
+		`labels.team: "qa" -> "dev"`,
+		`env.A: (unset) -> "1"`,
+	}, change.Diffs)
+}
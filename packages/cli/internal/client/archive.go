@@ -0,0 +1,111 @@
+package gboxsdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	sdk "github.com/babelcloud/gbox-sdk-go"
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
+)
+
+// BoxPathInfo describes a path inside a box
+type BoxPathInfo struct {
+	Exists bool
+	IsDir  bool
+}
+
+// newArchiveRequest builds an authenticated request against the box archive endpoint
+// using the base URL and API key of the current profile.
+func newArchiveRequest(ctx context.Context, method, boxID, boxPath string, body io.Reader) (*http.Request, error) {
+	baseURL := strings.TrimSuffix(profile.Default.GetEffectiveBaseURL(), "/")
+	apiKey, err := profile.Default.GetEffectiveAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("path", boxPath)
+	requestURL := fmt.Sprintf("%s/boxes/%s/archive?%s", baseURL, url.PathEscape(boxID), query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if apiKey != "" {
+		// Same credentials the SDK and the exec websocket send
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	if os.Getenv("DEBUG") == "true" {
+		fmt.Fprintf(os.Stderr, "[DEBUG] %s %s\n", method, requestURL)
+	}
+	return req, nil
+}
+
+// DownloadArchive streams a tar archive of boxPath from the box.
+// The caller must close the returned reader. size is -1 when the server does not report it.
+func DownloadArchive(ctx context.Context, boxID, boxPath string) (body io.ReadCloser, size int64, err error) {
+	req, err := newArchiveRequest(ctx, http.MethodGet, boxID, boxPath, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to download from box: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, 0, fmt.Errorf("failed to download from box, HTTP status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// UploadArchive streams a tar archive into the directory boxPath inside the box
+func UploadArchive(ctx context.Context, boxID, boxPath string, archive io.Reader) error {
+	req, err := newArchiveRequest(ctx, http.MethodPut, boxID, boxPath, archive)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload to box: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to upload to box, HTTP status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// StatBoxPath reports whether a path exists inside a box and whether it is a directory
+func StatBoxPath(client *sdk.Client, boxID, boxPath string) (*BoxPathInfo, error) {
+	ctx := context.Background()
+	exists, err := client.V1.Boxes.Fs.Exists(ctx, boxID, sdk.V1BoxFExistsParams{Path: boxPath})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check path %s in box: %v", boxPath, err)
+	}
+	if !exists.Exists {
+		return &BoxPathInfo{}, nil
+	}
+
+	info, err := client.V1.Boxes.Fs.Info(ctx, boxID, sdk.V1BoxFInfoParams{Path: boxPath})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info of %s in box: %v", boxPath, err)
+	}
+
+	return &BoxPathInfo{Exists: true, IsDir: info.Type == "dir"}, nil
+}
@@ -302,3 +302,34 @@ func GetBox(client *sdk.Client, boxID string) (*sdk.V1BoxGetResponseUnion, error
 
 	return box, nil
 }
+
+// ExecCommand runs a command in a box and waits for it to finish. A single
+// element is run as a shell command line, multiple elements as an argument list.
+func ExecCommand(client *sdk.Client, boxID string, command []string, env map[string]string, workingDir string) (*sdk.V1BoxExecuteCommandsResponse, error) {
+	var params sdk.V1BoxExecuteCommandsParams
+	if len(command) == 1 {
+		params.Commands.OfString = sdk.String(command[0])
+	} else {
+		params.Commands.OfStringArray = command
+	}
+	if len(env) > 0 {
+		params.Envs = env
+	}
+	if workingDir != "" {
+		params.WorkingDir = sdk.String(workingDir)
+	}
+
+	// debug output
+	if os.Getenv("DEBUG") == "true" {
+		fmt.Fprintf(os.Stderr, "Executing in box %s: %s\n", boxID, strings.Join(command, " "))
+	}
+
+	// call SDK
+	ctx := context.Background()
+	resp, err := client.V1.Boxes.ExecuteCommands(ctx, boxID, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute command: %v", err)
+	}
+
+	return resp, nil
+}
@@ -2,11 +2,14 @@ package cloud
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/babelcloud/gbox/packages/cli/internal/profile"
 )
@@ -17,15 +20,22 @@ type Client struct {
 	baseEndpoint string
 }
 
+// ErrSessionExpired is returned when the login session token has expired or is
+// rejected by the server
+var ErrSessionExpired = errors.New("your login session has expired, run 'gbox login' to authenticate again")
+
 type Organization struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
+	Slug string `json:"slug"`
 	// Add other fields from the API response as needed
 }
 
 type CreateAPIKeyRequest struct {
 	KeyName string `json:"name"`
 	OrgID   string `json:"organizationId"`
+	// ExpiresAt is an RFC 3339 time after which the key stops working, empty for no expiry
+	ExpiresAt string `json:"expiresAt,omitempty"`
 }
 
 type CreateAPIKeyResponse struct {
@@ -34,6 +44,7 @@ type CreateAPIKeyResponse struct {
 	APIKey    string `json:"key"`
 	OrgID     string `json:"organizationId"`
 	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
 	// Add other fields from the API response as needed
 }
 
@@ -50,6 +61,9 @@ func NewClient(token string) (*Client, error) {
 	if token == "" {
 		return nil, fmt.Errorf("token cannot be empty")
 	}
+	if expiresAt, ok := TokenExpiry(token); ok && time.Now().After(expiresAt) {
+		return nil, ErrSessionExpired
+	}
 
 	// Get base URL with proper priority handling
 	baseURL := profile.Default.GetEffectiveBaseURL()
@@ -80,6 +94,9 @@ func (c *Client) GetMyOrganizationList() ([]Organization, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrSessionExpired
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("failed to get organization list: status code %d, body: %s", resp.StatusCode, string(body))
@@ -93,12 +110,7 @@ func (c *Client) GetMyOrganizationList() ([]Organization, error) {
 	return organizations, nil
 }
 
-func (c *Client) CreateAPIKey(keyName, orgID string) (*CreateAPIKeyResponse, error) {
-	requestBody := CreateAPIKeyRequest{
-		KeyName: keyName,
-		OrgID:   orgID,
-	}
-
+func (c *Client) CreateAPIKey(requestBody CreateAPIKeyRequest) (*CreateAPIKeyResponse, error) {
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, err
@@ -121,6 +133,9 @@ func (c *Client) CreateAPIKey(keyName, orgID string) (*CreateAPIKeyResponse, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrSessionExpired
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("failed to create API key: status code %d, body: %s", resp.StatusCode, string(body))
@@ -157,6 +172,9 @@ func (c *Client) CreateOrganization(reqBody CreateOrganizationRequest) (*Organiz
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrSessionExpired
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("failed to create organization: status code %d, body: %s", resp.StatusCode, string(body))
@@ -194,6 +212,9 @@ func (c *Client) GetCurrentUserInfo() (*UserInfo, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrSessionExpired
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("failed to get current user info: status code %d, body: %s", resp.StatusCode, string(body))
@@ -206,3 +227,66 @@ func (c *Client) GetCurrentUserInfo() (*UserInfo, error) {
 
 	return &info, nil
 }
+
+type DeleteAPIKeyRequest struct {
+	ID string `json:"id"`
+}
+
+// DeleteAPIKey revokes an API key
+func (c *Client) DeleteAPIKey(keyID string) error {
+	jsonData, err := json.Marshal(DeleteAPIKeyRequest{ID: keyID})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/dashboard/v1/api_key/delete_an_api_key", c.baseEndpoint), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	req.AddCookie(&http.Cookie{
+		Name:  "token",
+		Value: c.token,
+	})
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrSessionExpired
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		// Already revoked
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to delete API key: status code %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// TokenExpiry returns the expiry of a login session token. Session tokens are
+// JWTs, ok is false when the token carries no expiry.
+func TokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
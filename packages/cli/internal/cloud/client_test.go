@@ -0,0 +1,82 @@
+package cloud
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testJWT(claims string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".signature"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	expiresAt, ok := TokenExpiry(testJWT(fmt.Sprintf(`{"sub":"u1","exp":%d}`, exp)))
+	require.True(t, ok)
+	assert.Equal(t, exp, expiresAt.Unix())
+
+	_, ok = TokenExpiry(testJWT(`{"sub":"u1"}`))
+	assert.False(t, ok)
+	_, ok = TokenExpiry("opaque-session-token")
+	assert.False(t, ok)
+	_, ok = TokenExpiry("a.!!!.c")
+	assert.False(t, ok)
+}
+
+func TestNewClientExpiredSession(t *testing.T) {
+	_, err := NewClient(testJWT(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(-time.Minute).Unix())))
+	assert.ErrorIs(t, err, ErrSessionExpired)
+
+	_, err = NewClient(testJWT(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix())))
+	assert.NoError(t, err)
+}
+
+func TestAPIKeyExpiryAndRevocation(t *testing.T) {
+	deleted := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("token")
+		if err != nil || cookie.Value != "session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/dashboard/v1/api_key/create_an_api_key":
+			var req CreateAPIKeyRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			json.NewEncoder(w).Encode(CreateAPIKeyResponse{ID: "key-1", KeyName: req.KeyName, APIKey: "gbox-secret", OrgID: req.OrgID, ExpiresAt: req.ExpiresAt})
+		case "/api/dashboard/v1/api_key/delete_an_api_key":
+			var req DeleteAPIKeyRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if deleted[req.ID] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			deleted[req.ID] = true
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client := &Client{httpClient: srv.Client(), token: "session", baseEndpoint: srv.URL}
+
+	key, err := client.CreateAPIKey(CreateAPIKeyRequest{KeyName: "ci-runner", OrgID: "org-1", ExpiresAt: "2030-01-01T00:00:00Z"})
+	require.NoError(t, err)
+	assert.Equal(t, "ci-runner", key.KeyName)
+	assert.Equal(t, "2030-01-01T00:00:00Z", key.ExpiresAt)
+
+	require.NoError(t, client.DeleteAPIKey(key.ID))
+	assert.True(t, deleted["key-1"])
+	assert.NoError(t, client.DeleteAPIKey(key.ID), "revoking a revoked key succeeds")
+
+	expired := &Client{httpClient: srv.Client(), token: "expired", baseEndpoint: srv.URL}
+	assert.ErrorIs(t, expired.DeleteAPIKey("key-1"), ErrSessionExpired)
+}
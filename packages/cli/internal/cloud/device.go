@@ -35,6 +35,8 @@ type Device struct {
 		Model          string `json:"model,omitempty"`          // Android device model
 		Manufacturer   string `json:"manufacturer,omitempty"`   // Android device manufacturer
 		ConnectionType string `json:"connectionType,omitempty"` // Android connection type (usb, tcp, etc.)
+		// Labels are set with gbox device-connect label
+		Labels map[string]string `json:"labels,omitempty"`
 	} `json:"metadata,omitzero"`
 	Labels        map[string]string `json:"labels,omitempty"`
 	AccessPointId string            `json:"accessPointId,omitempty"`
@@ -63,6 +65,8 @@ type AccessPointToken struct {
 
 type DeviceAPI struct {
 	client *http.Client
+	// profile returns the profile to call the API with, replaced in tests
+	profile func() *profile.Profile
 }
 
 func NewDeviceAPI() *DeviceAPI {
@@ -73,6 +77,9 @@ func NewDeviceAPI() *DeviceAPI {
 
 // getCurrentProfile gets the current profile dynamically to support profile switching
 func (d *DeviceAPI) getCurrentProfile() *profile.Profile {
+	if d.profile != nil {
+		return d.profile()
+	}
 	return profile.Default.GetCurrent()
 }
 
@@ -236,6 +243,109 @@ func (d *DeviceAPI) Delete(deviceId string) error {
 	return nil
 }
 
+// SetAvailable marks a device available or not in its metadata, with the
+// reason it is unavailable
+func (d *DeviceAPI) SetAvailable(deviceId string, available bool, reason string) error {
+	fields := map[string]any{"available": available, "unavailableReason": nil}
+	if !available {
+		fields["unavailableReason"] = reason
+	}
+	return d.updateMetadata(deviceId, fields)
+}
+
+// SetLabels replaces the labels in the metadata of a device
+func (d *DeviceAPI) SetLabels(deviceId string, labels map[string]string) error {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return d.updateMetadata(deviceId, map[string]any{"labels": labels})
+}
+
+// updateMetadata changes fields of the metadata of a device, a nil value
+// removes the field. The whole metadata is read and written back, so the
+// serialno, types and other fields the server keeps are not lost.
+func (d *DeviceAPI) updateMetadata(deviceId string, fields map[string]any) error {
+	metadata, err := d.getMetadata(deviceId)
+	if err != nil {
+		return err
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(metadata, key)
+		} else {
+			metadata[key] = value
+		}
+	}
+
+	url, err := d.buildUrlFromEndpoint(path.Join("/api/v1/devices", deviceId))
+	if err != nil {
+		return errors.Wrapf(err, "failed to build url")
+	}
+
+	reqBody, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		return errors.Wrap(err, "fail to marshal device metadata to json")
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, url.String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request from url: %s", url.String())
+	}
+
+	d.setCommonRequestHeaders(req)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update device: %s", url.String())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return errors.Errorf("update device api respond %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// getMetadata returns the metadata of a device as the server keeps it,
+// including fields this client does not know
+func (d *DeviceAPI) getMetadata(deviceId string) (map[string]any, error) {
+	url, err := d.buildUrlFromEndpoint(path.Join("/api/v1/devices", deviceId))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build url")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request from url: %s", url.String())
+	}
+
+	d.setCommonRequestHeaders(req)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get device: %s", url.String())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.Errorf("get device api respond %d: %s", resp.StatusCode, string(body))
+	}
+
+	var device struct {
+		Metadata map[string]any `json:"metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&device); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse response from get device api")
+	}
+	if device.Metadata == nil {
+		device.Metadata = map[string]any{}
+	}
+	return device.Metadata, nil
+}
+
 func (d *DeviceAPI) GenerateAccessPointToken(deviceId, requestEndpoint string) (*AccessPointToken, error) {
 	url, err := d.buildUrlFromEndpoint(path.Join("/api/v1/devices", deviceId, "generate-access-point-token"))
 	if err != nil {
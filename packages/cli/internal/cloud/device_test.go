@@ -0,0 +1,83 @@
+package cloud
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeviceServer keeps the metadata of one device like the cloud does
+type fakeDeviceServer struct {
+	mu       sync.Mutex
+	metadata map[string]any
+}
+
+func (f *fakeDeviceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/api/v1/devices/dev-1" || r.Header.Get("x-api-key") != "gbox-key" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]any{"id": "dev-1", "metadata": f.metadata})
+	case http.MethodPatch:
+		var body struct {
+			Metadata map[string]any `json:"metadata"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// A PATCH replaces the metadata as a whole
+		f.metadata = body.Metadata
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func testDeviceAPI(t *testing.T, handler http.Handler) *DeviceAPI {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	p := &profile.Profile{BaseURL: srv.URL, APIKey: base64.StdEncoding.EncodeToString([]byte("gbox-key"))}
+	return &DeviceAPI{client: srv.Client(), profile: func() *profile.Profile { return p }}
+}
+
+func TestSetAvailableKeepsMetadata(t *testing.T) {
+	cloud := &fakeDeviceServer{metadata: map[string]any{"serialno": "R58N123ABC", "deviceType": "mobile", "osType": "android"}}
+	api := testDeviceAPI(t, cloud)
+
+	require.NoError(t, api.SetAvailable("dev-1", false, "battery 3% < 15%"))
+	assert.Equal(t, map[string]any{
+		"serialno":          "R58N123ABC",
+		"deviceType":        "mobile",
+		"osType":            "android",
+		"available":         false,
+		"unavailableReason": "battery 3% < 15%",
+	}, cloud.metadata)
+
+	require.NoError(t, api.SetAvailable("dev-1", true, ""))
+	assert.Equal(t, map[string]any{"serialno": "R58N123ABC", "deviceType": "mobile", "osType": "android", "available": true}, cloud.metadata)
+
+	assert.ErrorContains(t, api.SetAvailable("dev-2", false, "gone"), "get device api respond 404")
+}
+
+func TestSetLabelsKeepsMetadata(t *testing.T) {
+	cloud := &fakeDeviceServer{metadata: map[string]any{"serialno": "R58N123ABC", "available": true, "labels": map[string]any{"rack": "b"}}}
+	api := testDeviceAPI(t, cloud)
+
+	require.NoError(t, api.SetLabels("dev-1", map[string]string{"team": "qa"}))
+	assert.Equal(t, map[string]any{"serialno": "R58N123ABC", "available": true, "labels": map[string]any{"team": "qa"}}, cloud.metadata)
+
+	require.NoError(t, api.SetLabels("dev-1", nil))
+	assert.Equal(t, map[string]any{"serialno": "R58N123ABC", "available": true, "labels": map[string]any{}}, cloud.metadata)
+}
@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// staleLockAge is how long a lock may be held before it is considered
+// abandoned even if its owner still runs
+const staleLockAge = 2 * time.Minute
+
+// fileLock is an exclusive lock held by creating a file containing the
+// owner's PID. It serializes commands starting or stopping the server.
+type fileLock struct {
+	path string
+}
+
+// acquireLock waits up to timeout for the lock at path. Locks of processes
+// that have exited or that are older than staleLockAge are taken over.
+func acquireLock(path string, timeout time.Duration) (*fileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+			f.Close()
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file %s: %v", path, err)
+			}
+			return &fileLock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file %s: %v", path, err)
+		}
+
+		if lockIsStale(path) {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			owner, _ := readPID(path)
+			return nil, fmt.Errorf("timed out waiting for another gbox command (PID %d) to finish starting or stopping the server; remove %s if it is stuck", owner, path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func lockIsStale(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		// Removed in the meantime, retry right away
+		return false
+	}
+	if time.Since(info.ModTime()) > staleLockAge {
+		return true
+	}
+	pid, err := readPID(path)
+	if err != nil {
+		// Being written, or garbage left by a crash: go by age
+		return time.Since(info.ModTime()) > time.Second
+	}
+	return !isProcessAlive(pid)
+}
+
+// release removes the lock if it is still ours
+func (l *fileLock) release() {
+	if pid, err := readPID(l.path); err == nil && pid == os.Getpid() {
+		os.Remove(l.path)
+	}
+}
+
+// readPID reads a file containing a process ID
+func readPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", path)
+	}
+	return pid, nil
+}
+
+// WritePIDFile records the current process as the server in path
+func WritePIDFile(path string) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+		return fmt.Errorf("failed to write PID file: %v", err)
+	}
+	return nil
+}
+
+// RemovePIDFile removes path if it still names the current process
+func RemovePIDFile(path string) {
+	if pid, err := readPID(path); err == nil && pid == os.Getpid() {
+		os.Remove(path)
+	}
+}
@@ -2,318 +2,450 @@ package daemon
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/babelcloud/gbox/packages/cli/internal/server"
+	"github.com/babelcloud/gbox/packages/cli/config"
 	"github.com/babelcloud/gbox/packages/cli/internal/version"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 )
 
 const (
 	DefaultPort = 29888 // New port for unified gbox server
 	ServerURL   = "http://localhost:29888"
 
-	// Version headers returned by server
-	serverHeaderVersion = "X-GBOX-Version"
-	serverHeaderBuildID = "X-GBOX-Build-ID"
+	// DefaultDrainTimeout is how long an outdated server may finish its
+	// streams before a new binary replaces it
+	DefaultDrainTimeout = 15 * time.Second
+
+	startTimeout = 10 * time.Second
+	lockTimeout  = 45 * time.Second
+)
+
+var (
+	// ErrServerNotRunning is returned when no server listens on the port
+	ErrServerNotRunning = errors.New("server is not running")
+	// ErrPortInUse is returned when the port is taken by something other than a gbox server
+	ErrPortInUse = errors.New("port is used by another process")
 )
 
-// Manager handles the gbox server daemon lifecycle
+// ServerInfo is the response of /api/server/info
+type ServerInfo = serverclient.ServerInfo
+
+// Manager handles the gbox server daemon lifecycle. It is the only place
+// that starts, stops or replaces the server; every command that needs the
+// server goes through EnsureServerRunning.
 type Manager struct {
 	port int
 	url  string
+	dir  string
 }
 
-// NewManager creates a new daemon manager
+// NewManager creates a daemon manager for the default port
 func NewManager() *Manager {
+	return NewManagerForPort(DefaultPort)
+}
+
+// NewManagerForPort creates a daemon manager for a server on port
+func NewManagerForPort(port int) *Manager {
 	return &Manager{
-		port: DefaultPort,
-		url:  ServerURL,
+		port: port,
+		url:  fmt.Sprintf("http://localhost:%d", port),
+		dir:  filepath.Join(config.GetGboxHome(), "cli"),
 	}
 }
 
-// EnsureServerRunning ensures the gbox server is running
-// Similar to 'adb start-server' - starts server if not running
-func (m *Manager) EnsureServerRunning() error {
-	// Check if server is already running
-	if m.IsServerRunning() {
-		return nil
+// Port returns the server port
+func (m *Manager) Port() int {
+	return m.port
+}
+
+// URL returns the base URL of the server
+func (m *Manager) URL() string {
+	return m.url
+}
+
+// PIDFile returns the file the server records its PID in
+func (m *Manager) PIDFile() string {
+	return filepath.Join(m.dir, m.fileName("server", "pid"))
+}
+
+// LogFile returns the log file of the background server
+func (m *Manager) LogFile() string {
+	return filepath.Join(m.dir, "server.log")
+}
+
+func (m *Manager) lockFile() string {
+	return filepath.Join(m.dir, m.fileName("server", "lock"))
+}
+
+// fileName keeps the historic names for the default port
+func (m *Manager) fileName(base, ext string) string {
+	if m.port == DefaultPort {
+		return base + "." + ext
 	}
+	return fmt.Sprintf("%s-%d.%s", base, m.port, ext)
+}
 
-	// Start server in background
-	return m.StartServer()
+// Info asks the server for its version, build ID and activity. It returns
+// ErrServerNotRunning when nothing listens on the port and ErrPortInUse when
+// something other than a gbox server does.
+func (m *Manager) Info() (*ServerInfo, error) {
+	client := serverclient.New(m.url)
+	client.HTTPClient.Timeout = time.Second
+	info, err := client.ServerInfo()
+	if err != nil {
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("%w: port %d does not answer like a gbox server", ErrPortInUse, m.port)
+		}
+		if urlErr.Timeout() {
+			return nil, fmt.Errorf("server on port %d is not responding", m.port)
+		}
+		return nil, ErrServerNotRunning
+	}
+	if info.BuildID == "" {
+		return nil, fmt.Errorf("%w: port %d does not answer like a gbox server", ErrPortInUse, m.port)
+	}
+	return info, nil
 }
 
-// IsServerRunning checks if the server is running
+// IsServerRunning checks if a gbox server of any build is running
 func (m *Manager) IsServerRunning() bool {
-	// First check PID file
-	pidFile := m.getPIDFile()
-	if pidBytes, err := os.ReadFile(pidFile); err == nil {
-		var pid int
-		if _, err := fmt.Sscanf(string(pidBytes), "%d", &pid); err == nil {
-			// Check if process is still alive
-			if isProcessAlive(pid) {
-				// Process exists, now check if it's responding to HTTP
-				if m.checkHTTPHealth() {
-					return true
-				}
-			}
-		}
-		// PID file exists but process is dead or not responding
-		os.Remove(pidFile)
-		// Avoid a second health check log; treat as not running
+	_, err := m.Info()
+	return err == nil
+}
+
+// accepts reports whether a running server can serve this binary: it runs
+// in the mode asked for and is the same build, a newer release that another
+// installation started, or run by systemd, whose unit decides which binary
+// runs
+func (m *Manager) accepts(info *ServerInfo) bool {
+	if info.Draining || !ModeMatches(info) {
 		return false
 	}
+	if info.BuildID == version.BuildID() || info.Supervisor == SupervisorSystemd {
+		return true
+	}
+	return compareVersions(info.Version, version.Version) > 0
+}
+
+// ModeMatches reports whether a running server serves devices in the mode
+// that server.local_only or GBOX_LOCAL_ONLY asks for. When neither is set
+// any mode does, so commands use a server started with GBOX_LOCAL_ONLY=true
+// without replacing it.
+func ModeMatches(info *ServerInfo) bool {
+	value, err := config.Resolve("server.local_only")
+	if err != nil || value.Source == config.SourceDefault {
+		return true
+	}
+	return info.LocalOnly == config.GetLocalOnly()
+}
 
-	// Double-check with HTTP even without PID file
-	// (server might be running from another source)
-	return m.checkHTTPHealth()
+// modeName names the mode of a server in messages
+func modeName(localOnly bool) string {
+	if localOnly {
+		return "local-only"
+	}
+	return "cloud"
 }
 
-// checkHTTPHealth checks if server is responding to HTTP requests
-func (m *Manager) checkHTTPHealth() bool {
-	client := &http.Client{Timeout: 150 * time.Millisecond}
-	resp, err := client.Get(fmt.Sprintf("%s/api/server/info", m.url))
+// EnsureServerRunning starts the server if it is not running. A server of a
+// different build is drained and replaced, unless it is a newer release, and
+// so is a server running in another mode than asked for. A server run by
+// systemd in another mode is an error, its unit decides how it runs.
+func (m *Manager) EnsureServerRunning() error {
+	if info, err := m.Info(); err == nil && m.accepts(info) {
+		return nil
+	}
+
+	lock, err := m.lock()
 	if err != nil {
-		return false
+		return err
 	}
-	defer resp.Body.Close()
+	defer lock.release()
 
-	if resp.StatusCode != http.StatusOK {
-		return false
+	// Another command may have started the server while we waited for the lock
+	info, err := m.Info()
+	switch {
+	case err == nil && m.accepts(info):
+		return nil
+	case err == nil && info.Supervisor == SupervisorSystemd && !ModeMatches(info):
+		return fmt.Errorf("gbox server on port %d runs in %s mode as a systemd service, but %s mode is asked for; run gbox server install-service again to change its mode",
+			m.port, modeName(info.LocalOnly), modeName(config.GetLocalOnly()))
+	case err == nil:
+		if !ModeMatches(info) {
+			fmt.Fprintf(os.Stderr, "Restarting gbox server in %s mode, it runs in %s mode\n",
+				modeName(config.GetLocalOnly()), modeName(info.LocalOnly))
+		} else {
+			fmt.Fprintf(os.Stderr, "Replacing gbox server %s (build %s) with %s (build %s)\n",
+				info.Version, info.BuildID, version.Version, version.BuildID())
+		}
+		if info.ActiveStreams > 0 {
+			fmt.Fprintf(os.Stderr, "Waiting up to %s for %d active streams to finish\n", DefaultDrainTimeout, info.ActiveStreams)
+		}
+		if err := m.stopLocked(DefaultDrainTimeout); err != nil && err != ErrServerNotRunning {
+			return fmt.Errorf("failed to stop the outdated server: %v", err)
+		}
+	case errors.Is(err, ErrPortInUse):
+		return err
 	}
-	serverVersion := resp.Header.Get(serverHeaderVersion)
-	serverBuildID := resp.Header.Get(serverHeaderBuildID)
-	clientVersion := version.Version
-	clientBuildID := server.GetBuildID()
-	if (serverVersion != "" && clientVersion != "" && serverVersion != clientVersion) ||
-		(serverBuildID != "" && clientBuildID != "" && serverBuildID != clientBuildID) {
-		log.Printf("Detected binary change: server(version=%s, build=%s) != client(version=%s, build=%s). Will restart server.", serverVersion, serverBuildID, clientVersion, clientBuildID)
-		return false
+
+	return m.startLocked()
+}
+
+// StopServer stops the server, giving active streams up to drain to finish.
+// It returns ErrServerNotRunning if there was no server to stop.
+func (m *Manager) StopServer(drain time.Duration) error {
+	lock, err := m.lock()
+	if err != nil {
+		return err
 	}
-	return true
+	defer lock.release()
+
+	return m.stopLocked(drain)
 }
 
-// StartServer starts the gbox server daemon
-func (m *Manager) StartServer() error {
-	// Clean up any old servers first
-	m.CleanupOldServers()
+// Restart stops the server if it runs, giving active streams up to drain to
+// finish, and starts this binary as the server
+func (m *Manager) Restart(drain time.Duration) error {
+	lock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.release()
 
-	// Create daemon home directory
-	daemonHome := filepath.Join(getHomeDir(), ".gbox", "cli")
-	if err := os.MkdirAll(daemonHome, 0755); err != nil {
-		return fmt.Errorf("failed to create daemon home: %v", err)
+	if err := m.stopLocked(drain); err != nil && err != ErrServerNotRunning {
+		return err
 	}
+	return m.startLocked()
+}
 
-	// Create log file
-	logFile := filepath.Join(daemonHome, "server.log")
-	logFd, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+func (m *Manager) lock() (*fileLock, error) {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create daemon home: %v", err)
+	}
+	return acquireLock(m.lockFile(), lockTimeout)
+}
+
+// startLocked starts this binary as the server in the background and waits
+// until it answers with our build ID. An installed systemd unit is started
+// instead.
+func (m *Manager) startLocked() error {
+	m.cleanupLegacyServers()
+	if m.ServiceInstalled() {
+		return m.startService()
+	}
+
+	// A server that holds the port without answering must go first
+	if pid, err := readPID(m.PIDFile()); err == nil && isProcessAlive(pid) {
+		if _, err := m.Info(); err != nil && !errors.Is(err, ErrServerNotRunning) {
+			m.terminate(pid)
+		}
+	}
+
+	logFd, err := os.OpenFile(m.LogFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 	if err != nil {
 		return fmt.Errorf("failed to create log file: %v", err)
 	}
 	defer logFd.Close()
 
-	// Start server as subprocess
 	exePath, err := os.Executable()
 	if err != nil {
 		return fmt.Errorf("failed to get executable path: %v", err)
 	}
 
-	cmd := exec.Command(exePath, "server", "start", "--internal-daemon")
+	// The server writes startup errors here so they can be reported
+	startLog, err := os.CreateTemp("", "gbox-server-start-*")
+	if err != nil {
+		return fmt.Errorf("failed to create start log: %v", err)
+	}
+	startLog.Close()
+	defer os.Remove(startLog.Name())
+
+	cmd := exec.Command(exePath, "server", "start",
+		"--port", strconv.Itoa(m.port),
+		"--internal-daemon",
+		"--daemon-start-log-filename", startLog.Name())
 	cmd.Stdout = logFd
 	cmd.Stderr = logFd
-	cmd.Env = append(os.Environ(), "GBOX_SERVER_DAEMON=1")
+	cmd.Env = append(os.Environ(), SupervisorEnv+"="+SupervisorDaemon)
 	setSysProcAttr(cmd)
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start server daemon: %v", err)
 	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	buildID := version.BuildID()
+	deadline := time.Now().Add(startTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return m.startError(startLog.Name(), fmt.Errorf("server exited: %v", err))
+		case <-time.After(100 * time.Millisecond):
+		}
 
-	pid := cmd.Process.Pid
-
-	// Write PID file
-	pidFile := m.getPIDFile()
-	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0644); err != nil {
-		log.Printf("Warning: failed to write PID file: %v", err)
-	}
-
-	// Wait for server to be ready
-	for i := 0; i < 20; i++ {
-		time.Sleep(250 * time.Millisecond)
-		if m.checkHTTPHealth() {
-			log.Printf("GBox server started successfully (PID: %d)", pid)
-			log.Printf("Web UI available at: http://localhost:%d", m.port)
+		info, err := m.Info()
+		if err == nil && info.BuildID == buildID {
+			log.Printf("GBox server started successfully (PID: %d)", cmd.Process.Pid)
 			return nil
 		}
+		if errors.Is(err, ErrPortInUse) {
+			cmd.Process.Kill()
+			return err
+		}
 	}
 
-	// Server didn't start properly
-	return fmt.Errorf("server started but not responding on port %d", m.port)
+	cmd.Process.Kill()
+	return m.startError(startLog.Name(), fmt.Errorf("server started but not responding on port %d", m.port))
 }
 
-// StopServer stops the gbox server daemon
-func (m *Manager) StopServer() error {
-	// Try graceful shutdown via API first
-	client := &http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Post(fmt.Sprintf("%s/api/server/shutdown", m.url), "application/json", nil)
-	if err == nil {
-		resp.Body.Close()
-		time.Sleep(500 * time.Millisecond)
-		return nil
+func (m *Manager) startError(startLog string, fallback error) error {
+	if msg, err := os.ReadFile(startLog); err == nil && len(bytes.TrimSpace(msg)) > 0 {
+		return fmt.Errorf("failed to start server on port %d: %s", m.port, bytes.TrimSpace(msg))
 	}
+	return fmt.Errorf("%v, see %s", fallback, m.LogFile())
+}
 
-	// Fall back to PID-based termination
-	pidFile := m.getPIDFile()
-	pidBytes, err := os.ReadFile(pidFile)
-	if err != nil {
-		return fmt.Errorf("server not running")
+// stopLocked asks the server to shut down after draining, and terminates the
+// process recorded in the PID file if it does not exit in time
+func (m *Manager) stopLocked(drain time.Duration) error {
+	pid, pidErr := readPID(m.PIDFile())
+	info, err := m.Info()
+	if err == nil && info.PID > 0 {
+		pid = info.PID
+		pidErr = nil
+	}
+	if errors.Is(err, ErrPortInUse) {
+		return err
 	}
 
-	var pid int
-	if _, err := fmt.Sscanf(string(pidBytes), "%d", &pid); err != nil {
-		return fmt.Errorf("invalid PID file")
+	if err == nil {
+		client := serverclient.New(m.url)
+		client.HTTPClient.Timeout = 2 * time.Second
+		if _, err := client.Shutdown(drain); err == nil {
+			if m.waitForExit(pid, drain+5*time.Second) {
+				os.Remove(m.PIDFile())
+				return nil
+			}
+		}
 	}
 
-	// Send SIGTERM
-	if err := killProcess(pid, syscall.SIGTERM); err != nil {
-		os.Remove(pidFile)
-		return fmt.Errorf("failed to stop server: %v", err)
+	if pidErr != nil || !isProcessAlive(pid) {
+		os.Remove(m.PIDFile())
+		if err != nil {
+			return ErrServerNotRunning
+		}
+		return fmt.Errorf("server on port %d did not stop and its PID is unknown", m.port)
 	}
 
-	os.Remove(pidFile)
+	m.terminate(pid)
+	os.Remove(m.PIDFile())
 	log.Printf("GBox server stopped (PID: %d)", pid)
 	return nil
 }
 
-// CleanupOldServers cleans up any old server processes
-func (m *Manager) CleanupOldServers() {
-	// Clean up old PID files and processes
-	oldPidFiles := []string{
-		filepath.Join(getHomeDir(), ".gbox", "device-proxy", "gbox-server.pid"),
-		filepath.Join(getHomeDir(), ".gbox", "device-proxy", "device-proxy.pid"),
-	}
-
-	for _, pidFile := range oldPidFiles {
-		if pidBytes, err := os.ReadFile(pidFile); err == nil {
-			var pid int
-			if _, err := fmt.Sscanf(string(pidBytes), "%d", &pid); err == nil {
-				killProcess(pid, syscall.SIGTERM)
-			}
-			os.Remove(pidFile)
+// waitForExit waits until the server stops answering and its process exits
+func (m *Manager) waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		_, err := m.Info()
+		if errors.Is(err, ErrServerNotRunning) && (pid <= 0 || !isProcessAlive(pid)) {
+			return true
 		}
+		time.Sleep(100 * time.Millisecond)
 	}
-
-	// Kill any stray server processes
-	exec.Command("pkill", "-f", "gbox.*server.*--internal-daemon").Run()
-	exec.Command("pkill", "-f", "device-connect start-server").Run()
+	return false
 }
 
-// getPIDFile returns the path to the PID file
-func (m *Manager) getPIDFile() string {
-	return filepath.Join(getHomeDir(), ".gbox", "cli", "server.pid")
-}
-
-// CallAPI makes an API call to the server
-func (m *Manager) CallAPI(method, endpoint string, body interface{}, result interface{}) error {
-	// Ensure server is running
-	if err := m.EnsureServerRunning(); err != nil {
-		return fmt.Errorf("failed to start server: %v", err)
+// terminate sends SIGTERM and, if the process is still alive after a few
+// seconds, kills it
+func (m *Manager) terminate(pid int) {
+	if err := killProcess(pid, syscall.SIGTERM); err != nil {
+		return
 	}
-
-	url := fmt.Sprintf("%s%s", m.url, endpoint)
-
-	var bodyReader io.Reader
-	if body != nil {
-		jsonData, err := json.Marshal(body)
-		if err != nil {
-			return fmt.Errorf("failed to marshal request: %v", err)
+	for i := 0; i < 50; i++ {
+		if !isProcessAlive(pid) {
+			return
 		}
-		bodyReader = bytes.NewReader(jsonData)
-	}
-
-	req, err := http.NewRequest(method, url, bodyReader)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		time.Sleep(100 * time.Millisecond)
 	}
+	killProcess(pid, syscall.SIGKILL)
+}
 
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+// cleanupLegacyServers stops servers recorded in the PID files of earlier releases
+func (m *Manager) cleanupLegacyServers() {
+	home := config.GetGboxHome()
+	oldPidFiles := []string{
+		filepath.Join(home, "device-proxy", "gbox-server.pid"),
+		filepath.Join(home, "device-proxy", "device-proxy.pid"),
+		filepath.Join(m.dir, "gbox-server.pid"),
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	// perform is a small helper to execute the request
-	perform := func() (*http.Response, error) {
-		return client.Do(req)
+	for _, pidFile := range oldPidFiles {
+		if pid, err := readPID(pidFile); err == nil && isProcessAlive(pid) {
+			m.terminate(pid)
+		}
+		os.Remove(pidFile)
 	}
+}
 
-	resp, err := perform()
-	if err != nil {
-		return fmt.Errorf("API call failed: %v", err)
+// Client starts the server if needed and returns a client for its API
+func (m *Manager) Client() (*serverclient.Client, error) {
+	if err := m.EnsureServerRunning(); err != nil {
+		return nil, fmt.Errorf("failed to start server: %v", err)
 	}
-	defer resp.Body.Close()
-
-	// Version/build-id check: compare headers with client values.
-	serverVersion := resp.Header.Get(serverHeaderVersion)
-	serverBuildID := resp.Header.Get(serverHeaderBuildID)
-	clientVersion := version.Version
-	clientBuildID := server.GetBuildID()
+	return serverclient.New(m.url), nil
+}
 
-	mismatch := false
-	if serverVersion != "" && clientVersion != "" && serverVersion != clientVersion {
-		mismatch = true
+// compareVersions compares release versions such as v1.2.3, returning 0 when
+// either is not a release version
+func compareVersions(a, b string) int {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0
 	}
-	if serverBuildID != "" && clientBuildID != "" && serverBuildID != clientBuildID {
-		mismatch = true
-	}
-
-	if mismatch {
-		_ = m.StopServer()
-		if err := m.StartServer(); err != nil {
-			return fmt.Errorf("server mismatch (ver:%s!=%s or build:%s!=%s) and restart failed: %v", serverVersion, clientVersion, serverBuildID, clientBuildID, err)
-		}
-		// Retry once with a fresh request object (req body may have been consumed)
-		if body != nil {
-			jsonData, _ := json.Marshal(body)
-			req, err = http.NewRequest(method, url, bytes.NewReader(jsonData))
-			if err != nil {
-				return fmt.Errorf("failed to create retry request: %v", err)
-			}
-			req.Header.Set("Content-Type", "application/json")
-		} else {
-			req, err = http.NewRequest(method, url, nil)
-			if err != nil {
-				return fmt.Errorf("failed to create retry request: %v", err)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] > pb[i] {
+				return 1
 			}
+			return -1
 		}
-		resp, err = perform()
-		if err != nil {
-			return fmt.Errorf("API call after restart failed: %v", err)
-		}
-		defer resp.Body.Close()
 	}
+	return 0
+}
 
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
 	}
-
-	if result != nil {
-		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
-			return fmt.Errorf("failed to decode response: %v", err)
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, false
 		}
+		parts[i] = n
 	}
-
-	return nil
+	return parts, true
 }
 
 // Global instance for convenience
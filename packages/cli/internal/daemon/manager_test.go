@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testManager(t *testing.T, url string) *Manager {
+	return &Manager{port: DefaultPort, url: url, dir: t.TempDir()}
+}
+
+func TestInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ServerInfo{Version: "v1.2.3", BuildID: "build-1", PID: 42, ActiveStreams: 2})
+	}))
+	defer srv.Close()
+
+	info, err := testManager(t, srv.URL).Info()
+	require.NoError(t, err)
+	assert.Equal(t, "build-1", info.BuildID)
+	assert.Equal(t, 42, info.PID)
+	assert.Equal(t, 2, info.ActiveStreams)
+}
+
+func TestInfoErrors(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>not gbox</html>"))
+	}))
+	defer other.Close()
+
+	_, err := testManager(t, other.URL).Info()
+	assert.ErrorIs(t, err, ErrPortInUse)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	_, err = testManager(t, closed.URL).Info()
+	assert.ErrorIs(t, err, ErrServerNotRunning)
+}
+
+func TestAccepts(t *testing.T) {
+	m := testManager(t, "")
+	saved := version.Version
+	defer func() { version.Version = saved }()
+	version.Version = "v1.2.0"
+
+	assert.True(t, m.accepts(&ServerInfo{Version: "v0.0.1", BuildID: version.BuildID()}))
+	assert.True(t, m.accepts(&ServerInfo{Version: "v1.3.0", BuildID: "other"}))
+	assert.False(t, m.accepts(&ServerInfo{Version: "v1.1.9", BuildID: "other"}))
+	assert.False(t, m.accepts(&ServerInfo{Version: "dev", BuildID: "other"}))
+	assert.False(t, m.accepts(&ServerInfo{Version: "v1.3.0", BuildID: "other", Draining: true}))
+}
+
+func TestAcceptsMode(t *testing.T) {
+	m := testManager(t, "")
+	local := &ServerInfo{BuildID: version.BuildID(), LocalOnly: true}
+	cloud := &ServerInfo{BuildID: version.BuildID()}
+
+	// Without a mode asked for, a server in either mode is used
+	t.Setenv("GBOX_LOCAL_ONLY", "")
+	assert.True(t, m.accepts(local))
+	assert.True(t, m.accepts(cloud))
+
+	t.Setenv("GBOX_LOCAL_ONLY", "true")
+	assert.True(t, m.accepts(local))
+	assert.False(t, m.accepts(cloud))
+	assert.False(t, m.accepts(&ServerInfo{BuildID: "other", Supervisor: SupervisorSystemd}), "systemd servers in the other mode are not used either")
+
+	t.Setenv("GBOX_LOCAL_ONLY", "false")
+	assert.False(t, m.accepts(local))
+	assert.True(t, m.accepts(cloud))
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("v1.2.3", "1.2.3"))
+	assert.Equal(t, 1, compareVersions("v1.10.0", "v1.9.9"))
+	assert.Equal(t, -1, compareVersions("v1.2.3-rc.1", "v1.2.4"))
+	assert.Equal(t, 0, compareVersions("dev", "v1.0.0"))
+}
+
+func TestFileNames(t *testing.T) {
+	m := NewManager()
+	assert.Equal(t, "server.pid", filepath.Base(m.PIDFile()))
+
+	m = NewManagerForPort(8080)
+	assert.Equal(t, "server-8080.pid", filepath.Base(m.PIDFile()))
+	assert.Equal(t, "http://localhost:8080", m.URL())
+}
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.lock")
+
+	lock, err := acquireLock(path, time.Second)
+	require.NoError(t, err)
+
+	_, err = acquireLock(path, 200*time.Millisecond)
+	assert.Error(t, err, "lock held by a live process")
+
+	lock.release()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAcquireStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.lock")
+
+	// A PID far above any real one stands for an owner that has exited
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(1<<22-1)), 0o644))
+	lock, err := acquireLock(path, time.Second)
+	require.NoError(t, err)
+	lock.release()
+
+	// A lock older than staleLockAge is taken over even if its owner runs
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0o644))
+	old := time.Now().Add(-2 * staleLockAge)
+	require.NoError(t, os.Chtimes(path, old, old))
+	lock, err = acquireLock(path, time.Second)
+	require.NoError(t, err)
+	lock.release()
+}
+
+func TestPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.pid")
+
+	require.NoError(t, WritePIDFile(path))
+	pid, err := readPID(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+
+	RemovePIDFile(path)
+	_, err = readPID(path)
+	assert.Error(t, err)
+}
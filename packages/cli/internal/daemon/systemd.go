@@ -0,0 +1,221 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SupervisorEnv tells a server process what started it, so that status can
+// report whether the server is managed by systemd or self-daemonized
+const SupervisorEnv = "GBOX_SERVER_SUPERVISOR"
+
+// Values of SupervisorEnv and ServerInfo.Supervisor
+const (
+	SupervisorSystemd    = "systemd"
+	SupervisorDaemon     = "daemon"
+	SupervisorForeground = "foreground"
+)
+
+// Supervisor returns what started the current server process
+func Supervisor() string {
+	if s := os.Getenv(SupervisorEnv); s != "" {
+		return s
+	}
+	return SupervisorForeground
+}
+
+// ServiceOptions describes the systemd user unit of the server
+type ServiceOptions struct {
+	Executable string
+	Port       int
+	// Env is written to the unit, typically the selected profile and the
+	// variables locating gbox home, credentials and adb
+	Env     map[string]string
+	LogFile string
+}
+
+// systemctl runs systemctl on the user manager; replaced in tests
+var systemctl = func(args ...string) ([]byte, error) {
+	return exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+}
+
+// ServiceName returns the name of the systemd user unit
+func (m *Manager) ServiceName() string {
+	return m.fileName("gbox-server", "service")
+}
+
+// UnitFile returns where the systemd user unit is installed
+func (m *Manager) UnitFile() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get user home directory: %v", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "systemd", "user", m.ServiceName()), nil
+}
+
+// ServiceInstalled reports whether the systemd user unit is installed
+func (m *Manager) ServiceInstalled() bool {
+	path, err := m.UnitFile()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// ServiceActive reports whether systemd currently runs the unit
+func (m *Manager) ServiceActive() bool {
+	out, err := systemctl("is-active", m.ServiceName())
+	return err == nil && strings.TrimSpace(string(out)) == "active"
+}
+
+// InstallService writes the systemd user unit, enables it at login and
+// starts it. A self-daemonized server must be stopped first.
+func (m *Manager) InstallService(opts ServiceOptions) (string, error) {
+	if err := checkSystemd(); err != nil {
+		return "", err
+	}
+	path, err := m.UnitFile()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(RenderUnit(opts)), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write unit file: %v", err)
+	}
+
+	if out, err := systemctl("daemon-reload"); err != nil {
+		return path, fmt.Errorf("systemctl --user daemon-reload failed: %s", strings.TrimSpace(string(out)))
+	}
+	if out, err := systemctl("enable", "--now", m.ServiceName()); err != nil {
+		return path, fmt.Errorf("systemctl --user enable --now %s failed: %s", m.ServiceName(), strings.TrimSpace(string(out)))
+	}
+	if err := m.waitForService(); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// UninstallService stops and disables the systemd user unit and removes it
+func (m *Manager) UninstallService() error {
+	if err := checkSystemd(); err != nil {
+		return err
+	}
+	path, err := m.UnitFile()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %s is not installed", m.ServiceName())
+	}
+
+	// A unit that failed to load cannot be disabled, removing it is enough
+	systemctl("disable", "--now", m.ServiceName())
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove unit file: %v", err)
+	}
+	if out, err := systemctl("daemon-reload"); err != nil {
+		return fmt.Errorf("systemctl --user daemon-reload failed: %s", strings.TrimSpace(string(out)))
+	}
+	systemctl("reset-failed", m.ServiceName())
+	return nil
+}
+
+// startService starts the server through systemd. The unit decides which
+// binary runs, so any gbox server answering counts as started.
+func (m *Manager) startService() error {
+	if out, err := systemctl("start", m.ServiceName()); err != nil {
+		return fmt.Errorf("systemctl --user start %s failed: %s", m.ServiceName(), strings.TrimSpace(string(out)))
+	}
+	return m.waitForService()
+}
+
+func (m *Manager) waitForService() error {
+	deadline := time.Now().Add(startTimeout)
+	for time.Now().Before(deadline) {
+		info, err := m.Info()
+		if err == nil && !info.Draining {
+			return nil
+		}
+		if errors.Is(err, ErrPortInUse) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("service %s started but the server is not responding on port %d, see 'systemctl --user status %s' and %s",
+		m.ServiceName(), m.port, m.ServiceName(), m.LogFile())
+}
+
+func checkSystemd() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("systemd user services are only supported on Linux")
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return fmt.Errorf("systemctl not found, is systemd running on this machine?")
+	}
+	return nil
+}
+
+// RenderUnit returns the systemd user unit running the server in the foreground
+func RenderUnit(opts ServiceOptions) string {
+	var b strings.Builder
+	b.WriteString("# Generated by 'gbox server install-service', reinstall to update\n")
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=GBOX local server on port %d\n", opts.Port)
+	b.WriteString("After=network.target\n\n")
+
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s server start --foreground --port %d\n", quoteUnitValue(opts.Executable), opts.Port)
+
+	keys := make([]string, 0, len(opts.Env)+1)
+	for key := range opts.Env {
+		if key != SupervisorEnv {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(&b, "Environment=%s\n", quoteUnitValue(SupervisorEnv+"="+SupervisorSystemd))
+	for _, key := range keys {
+		fmt.Fprintf(&b, "Environment=%s\n", quoteUnitValue(key+"="+opts.Env[key]))
+	}
+
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=3\n")
+	// Leave active streams time to drain on stop
+	fmt.Fprintf(&b, "TimeoutStopSec=%d\n", int((DefaultDrainTimeout + 5*time.Second).Seconds()))
+	if opts.LogFile != "" {
+		fmt.Fprintf(&b, "StandardOutput=append:%s\n", escapeUnitSpecifiers(opts.LogFile))
+		fmt.Fprintf(&b, "StandardError=append:%s\n", escapeUnitSpecifiers(opts.LogFile))
+	}
+	b.WriteString("\n")
+
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+	return b.String()
+}
+
+// quoteUnitValue quotes a value for ExecStart or Environment
+func quoteUnitValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + escapeUnitSpecifiers(s) + `"`
+}
+
+// escapeUnitSpecifiers keeps systemd from expanding % specifiers
+func escapeUnitSpecifiers(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
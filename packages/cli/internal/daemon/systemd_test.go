@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderUnit(t *testing.T) {
+	unit := RenderUnit(ServiceOptions{
+		Executable: "/opt/my gbox/gbox",
+		Port:       8080,
+		Env: map[string]string{
+			"GBOX_PROFILE": "work",
+			"GBOX_HOME":    `/home/a "b"/100%`,
+			SupervisorEnv:  "daemon",
+		},
+		LogFile: "/home/a/.gbox/cli/server.log",
+	})
+
+	assert.Contains(t, unit, `ExecStart="/opt/my gbox/gbox" server start --foreground --port 8080`+"\n")
+	assert.Contains(t, unit, `Environment="GBOX_HOME=/home/a \"b\"/100%%"`+"\n")
+	assert.Contains(t, unit, `Environment="GBOX_PROFILE=work"`+"\n")
+	assert.Contains(t, unit, "StandardOutput=append:/home/a/.gbox/cli/server.log\n")
+	assert.Contains(t, unit, "Restart=on-failure\n")
+	assert.Contains(t, unit, "WantedBy=default.target\n")
+
+	// The supervisor is always systemd, whatever the installing shell had
+	assert.Equal(t, 1, strings.Count(unit, SupervisorEnv))
+	assert.Contains(t, unit, `Environment="GBOX_SERVER_SUPERVISOR=systemd"`)
+}
+
+func TestUnitFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+
+	path, err := NewManager().UnitFile()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/xdg", "systemd", "user", "gbox-server.service"), path)
+
+	path, err = NewManagerForPort(8080).UnitFile()
+	require.NoError(t, err)
+	assert.Equal(t, "gbox-server-8080.service", filepath.Base(path))
+}
+
+func TestAcceptsSystemdServer(t *testing.T) {
+	m := testManager(t, "")
+
+	assert.True(t, m.accepts(&ServerInfo{Version: "dev", BuildID: "other", Supervisor: SupervisorSystemd}))
+	assert.False(t, m.accepts(&ServerInfo{Version: "dev", BuildID: "other", Supervisor: SupervisorDaemon}))
+}
@@ -2,12 +2,15 @@ package device
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
 	"github.com/pkg/errors"
 )
 
@@ -19,33 +22,33 @@ const (
 
 // AndroidManager manages Android devices (implements DeviceManager)
 type AndroidManager struct {
-	adbPath string
+	adb *adbserver.Client
+}
+
+// shell runs a command on the device and returns its stdout
+func (m *AndroidManager) shell(deviceID string, args ...string) ([]byte, error) {
+	return m.adb.Device(deviceID).Output(context.Background(), adbserver.Quote(args...))
+}
+
+// readFile returns the content of a file on the device
+func (m *AndroidManager) readFile(deviceID, path string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := m.adb.Device(deviceID).Pull(context.Background(), path, &buf)
+	return buf.Bytes(), err
 }
 
 // GetDevices returns list of connected Android devices
 func (m *AndroidManager) GetDevices() ([]DeviceInfo, error) {
-	cmd := exec.Command(m.adbPath, "devices", "-l")
-	output, err := cmd.Output()
+	entries, err := m.adb.Devices(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("failed to run adb devices: %w", err)
+		return nil, fmt.Errorf("failed to list adb devices: %w", err)
 	}
 
-	lines := strings.Split(string(output), "\n")
 	var devices []DeviceInfo
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "List of devices") {
-			continue
-		}
-
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
-		}
-
-		deviceID := parts[0]
-		status := parts[1]
+	for _, entry := range entries {
+		deviceID := entry.Serial
+		status := entry.State
 
 		// Only include devices with "device" status
 		if status != "device" {
@@ -57,11 +60,14 @@ func (m *AndroidManager) GetDevices() ([]DeviceInfo, error) {
 			Status:         status,
 			ConnectionType: "usb", // Default to USB connection
 			IsRegistrable:  false, // Default to false, will be updated by caller if needed
+			Model:          entry.Model,
+			Manufacturer:   entry.Device,
 		}
 
 		// Check if device is connected via network
-		if strings.Contains(deviceID, "._adb._tcp") {
-			// mDNS service name (e.g., "adb-A4RYVB3A20008848._adb._tcp")
+		if strings.Contains(deviceID, "._adb._tcp") || strings.Contains(deviceID, "._adb-tls-connect._tcp") {
+			// mDNS service name (e.g., "adb-A4RYVB3A20008848._adb._tcp"), or
+			// of Android 11+ wireless debugging ("adb-A4RYVB3A20008848-vWgJpq._adb-tls-connect._tcp")
 			device.ConnectionType = "mdns"
 			// Keep the full mDNS name as device ID
 		} else if strings.Contains(deviceID, ":") {
@@ -69,24 +75,6 @@ func (m *AndroidManager) GetDevices() ([]DeviceInfo, error) {
 			device.ConnectionType = "ip"
 		}
 
-		// Parse additional device info if available
-		if len(parts) > 2 {
-			for _, part := range parts[2:] {
-				if strings.Contains(part, ":") {
-					kv := strings.SplitN(part, ":", 2)
-					if len(kv) == 2 {
-						// Map common fields to expected names
-						switch kv[0] {
-						case "model":
-							device.Model = kv[1]
-						case "device":
-							device.Manufacturer = kv[1]
-						}
-					}
-				}
-			}
-		}
-
 		// Get serial number and Android ID
 		serialNo, err := m.getSerialNo(deviceID)
 		if err != nil {
@@ -117,8 +105,7 @@ func (m *AndroidManager) GetDevices() ([]DeviceInfo, error) {
 
 // getSerialNo gets the device serial number
 func (m *AndroidManager) getSerialNo(deviceID string) (string, error) {
-	cmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "getprop", "ro.serialno")
-	output, err := cmd.Output()
+	output, err := m.shell(deviceID, "getprop", "ro.serialno")
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to get serialno of device %s", deviceID)
 	}
@@ -127,8 +114,7 @@ func (m *AndroidManager) getSerialNo(deviceID string) (string, error) {
 
 // getAndroidID gets the device Android ID
 func (m *AndroidManager) getAndroidID(deviceID string) (string, error) {
-	cmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "settings", "get", "secure", "android_id")
-	output, err := cmd.Output()
+	output, err := m.shell(deviceID, "settings", "get", "secure", "android_id")
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to get android id of device %s", deviceID)
 	}
@@ -160,17 +146,14 @@ func (m *AndroidManager) GetIdentifiers(deviceID string) (Identifiers, error) {
 // it falls back to writing a file on external storage.
 func (m *AndroidManager) SetRegId(deviceID string, regId string) error {
 	// Try settings put global first
-	putCmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "settings", "put", "global", gboxRegIdSettingKey, regId)
-	if err := putCmd.Run(); err == nil {
+	if _, err := m.shell(deviceID, "settings", "put", "global", gboxRegIdSettingKey, regId); err == nil {
 		// Verify from settings
-		getCmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "settings", "get", "global", gboxRegIdSettingKey)
-		out, verr := getCmd.Output()
+		out, verr := m.shell(deviceID, "settings", "get", "global", gboxRegIdSettingKey)
 		if verr == nil {
 			got := strings.TrimSpace(string(out))
 			if got != "" && got != "null" && got == strings.TrimSpace(regId) {
 				// Enforce single source of truth: delete file; if deletion fails, report error
-				rmCmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "rm", "-f", gboxRegIdFilePath)
-				if err := rmCmd.Run(); err != nil {
+				if _, err := m.shell(deviceID, "rm", "-f", gboxRegIdFilePath); err != nil {
 					return errors.Wrap(err, "failed to delete fallback reg_id file after successful settings write")
 				}
 				return nil
@@ -182,14 +165,12 @@ func (m *AndroidManager) SetRegId(deviceID string, regId string) error {
 	// Fallback: write to file only (do not attempt settings again)
 	shell := fmt.Sprintf("mkdir -p %s && printf %s %s > %s",
 		gboxDeviceIDFileDir, "%s", shellQuoteForSingle(regId), gboxRegIdFilePath)
-	fileCmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "sh", "-c", shell)
-	if err := fileCmd.Run(); err != nil {
+	if _, err := m.adb.Device(deviceID).Output(context.Background(), shell); err != nil {
 		return errors.Wrap(err, "failed to write reg id to file")
 	}
 
 	// Verify by reading the file
-	readCmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "cat", gboxRegIdFilePath)
-	out, err := readCmd.Output()
+	out, err := m.readFile(deviceID, gboxRegIdFilePath)
 	if err != nil {
 		return errors.Wrap(err, "failed to read back reg id from file")
 	}
@@ -203,8 +184,7 @@ func (m *AndroidManager) SetRegId(deviceID string, regId string) error {
 // GetRegId reads the registration ID from settings or fallback file.
 func (m *AndroidManager) GetRegId(deviceID string) (string, error) {
 	// Prefer file first
-	readCmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "cat", gboxRegIdFilePath)
-	out, err := readCmd.Output()
+	out, err := m.readFile(deviceID, gboxRegIdFilePath)
 	if err == nil {
 		v := strings.TrimSpace(string(out))
 		if v != "" {
@@ -213,8 +193,7 @@ func (m *AndroidManager) GetRegId(deviceID string) (string, error) {
 	}
 
 	// Then try settings
-	getCmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "settings", "get", "global", gboxRegIdSettingKey)
-	out, err = getCmd.Output()
+	out, err = m.shell(deviceID, "settings", "get", "global", gboxRegIdSettingKey)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to read reg id from settings")
 	}
@@ -241,7 +220,7 @@ type AdbCommandResult struct {
 }
 
 func (m *AndroidManager) ExecAdbCommand(deviceID, command string) (*AdbCommandResult, error) {
-	cmd := exec.Command("sh", "-c", strings.Join([]string{m.adbPath, "-s", deviceID, command}, " "))
+	cmd := exec.Command("sh", "-c", m.adb.Endpoint().CommandLine("-s", deviceID, command))
 
 	var stdoutBuf, stderrBuf bytes.Buffer
 	cmd.Stdout = &stdoutBuf
@@ -269,8 +248,7 @@ func (m *AndroidManager) ExecAdbCommand(deviceID, command string) (*AdbCommandRe
 // It prefers the "Override size" reported by `wm size` when present; otherwise it
 // falls back to the "Physical size".
 func (m *AndroidManager) GetDisplayResolution(deviceID string) (int, int, error) {
-	cmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "wm", "size")
-	output, err := cmd.Output()
+	output, err := m.shell(deviceID, "wm", "size")
 	if err != nil {
 		return 0, 0, errors.Wrapf(err, "failed to run wm size for device %s", deviceID)
 	}
@@ -314,11 +292,39 @@ func (m *AndroidManager) GetDisplayResolution(deviceID string) (int, int, error)
 	return width, height, nil
 }
 
+// GetHealth reads the battery, storage, CPU load and screen state of the
+// device. It fails only when none of them can be read.
+func (m *AndroidManager) GetHealth(deviceID string) (*Health, error) {
+	h := &Health{CheckedAt: time.Now()}
+	probes := []struct {
+		name  string
+		args  []string
+		parse func(string, *Health) error
+	}{
+		{"battery", []string{"dumpsys", "battery"}, parseBattery},
+		{"storage", []string{"df", "/data"}, parseStorage},
+		{"cpu", []string{"cat", "/proc/loadavg"}, parseLoad},
+		{"screen", []string{"dumpsys", "power"}, parseScreen},
+	}
+	for _, probe := range probes {
+		output, err := m.shell(deviceID, probe.args...)
+		if err == nil {
+			err = probe.parse(string(output), h)
+		}
+		if err != nil {
+			h.Errors = append(h.Errors, fmt.Sprintf("%s: %v", probe.name, err))
+		}
+	}
+	if len(h.Errors) == len(probes) {
+		return nil, errors.Errorf("failed to read health of device %s: %s", deviceID, strings.Join(h.Errors, "; "))
+	}
+	return h, nil
+}
+
 // GetOSVersion returns the Android OS version (e.g., "14", "13")
 func (m *AndroidManager) GetOSVersion(deviceID string) (string, error) {
 	// Try ro.build.version.release first (user-friendly version like "14", "13")
-	cmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "getprop", "ro.build.version.release")
-	output, err := cmd.Output()
+	output, err := m.shell(deviceID, "getprop", "ro.build.version.release")
 	if err == nil {
 		version := strings.TrimSpace(string(output))
 		if version != "" {
@@ -327,8 +333,7 @@ func (m *AndroidManager) GetOSVersion(deviceID string) (string, error) {
 	}
 
 	// Fallback to SDK version
-	cmd = exec.Command(m.adbPath, "-s", deviceID, "shell", "getprop", "ro.build.version.sdk")
-	output, err = cmd.Output()
+	output, err = m.shell(deviceID, "getprop", "ro.build.version.sdk")
 	if err == nil {
 		version := strings.TrimSpace(string(output))
 		if version != "" {
@@ -342,8 +347,7 @@ func (m *AndroidManager) GetOSVersion(deviceID string) (string, error) {
 // GetMemory returns the total memory in GB (e.g., "8 GB")
 func (m *AndroidManager) GetMemory(deviceID string) (string, error) {
 	// Read MemTotal from /proc/meminfo
-	cmd := exec.Command(m.adbPath, "-s", deviceID, "shell", "cat", "/proc/meminfo")
-	output, err := cmd.Output()
+	output, err := m.shell(deviceID, "cat", "/proc/meminfo")
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to read meminfo for device %s", deviceID)
 	}
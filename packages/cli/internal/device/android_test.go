@@ -0,0 +1,94 @@
+package device
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAndroidManagerGetDevices(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddDevice("192.168.1.20:5555")
+	d.ShellOutput("getprop ro.serialno", "R58N123ABC\n")
+	d.ShellOutput("settings get secure android_id", "a1b2c3d4e5f60718\n")
+	d.ShellOutput("settings get global gbox_reg_id", "null\n")
+	server.AddDevice("emulator-5554").State = "unauthorized"
+
+	m := &AndroidManager{adb: server.Client()}
+	devices, err := m.GetDevices()
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, "192.168.1.20:5555", devices[0].ID)
+	assert.Equal(t, "ip", devices[0].ConnectionType)
+	assert.Equal(t, "R58N123ABC", devices[0].SerialNo)
+	assert.Equal(t, "a1b2c3d4e5f60718", devices[0].AndroidID)
+	assert.Equal(t, "gbox_fake", devices[0].Model)
+	assert.Empty(t, devices[0].RegId)
+}
+
+func TestAndroidManagerRegId(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddDevice("emulator-5554")
+	m := &AndroidManager{adb: server.Client()}
+
+	// Settings are not writable, so the reg id falls back to the file
+	d.HandleShell("settings", func(cmd string, _ io.Reader, stdout, stderr io.Writer) int {
+		if strings.HasPrefix(cmd, "settings get") {
+			io.WriteString(stdout, "null\n")
+			return 0
+		}
+		io.WriteString(stderr, "Permission denial")
+		return 1
+	})
+	d.HandleShell("mkdir", func(cmd string, _ io.Reader, _, _ io.Writer) int {
+		d.WriteFile("/sdcard/.gbox/reg_id", []byte("reg-123"), 0o644)
+		return 0
+	})
+	require.NoError(t, m.SetRegId("emulator-5554", "reg-123"))
+
+	regId, err := m.GetRegId("emulator-5554")
+	require.NoError(t, err)
+	assert.Equal(t, "reg-123", regId)
+}
+
+func TestAndroidManagerGetDisplayResolution(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddDevice("emulator-5554")
+	d.ShellOutput("wm size", "Physical size: 1080x2400\nOverride size: 720x1600\n")
+	m := &AndroidManager{adb: server.Client()}
+
+	width, height, err := m.GetDisplayResolution("emulator-5554")
+	require.NoError(t, err)
+	assert.Equal(t, 720, width)
+	assert.Equal(t, 1600, height)
+
+	_, _, err = m.GetDisplayResolution("emulator-5556")
+	assert.Error(t, err)
+}
+
+func TestAndroidManagerGetHealth(t *testing.T) {
+	server := adbtest.NewServer(t)
+	d := server.AddDevice("emulator-5554")
+	d.ShellOutput("dumpsys battery", "  AC powered: false\n  level: 42\n  scale: 100\n  temperature: 355\n")
+	d.ShellOutput("df /data", "Filesystem 1K-blocks Used Available Use% Mounted on\n/dev/block/dm-5 2048 1024 1024 50% /data\n")
+	d.ShellOutput("cat /proc/loadavg", "0.50 0.40 0.30 1/512 4242\n")
+	m := &AndroidManager{adb: server.Client()}
+
+	// dumpsys power is not answered, the other vitals are still read
+	h, err := m.GetHealth("emulator-5554")
+	require.NoError(t, err)
+	assert.Equal(t, 42, h.BatteryLevel)
+	assert.Equal(t, 35.5, h.BatteryTemperature)
+	assert.False(t, h.Charging)
+	assert.Equal(t, int64(1<<20), h.StorageFree)
+	assert.Equal(t, 0.5, h.CPULoad)
+	require.Len(t, h.Errors, 1)
+	assert.Contains(t, h.Errors[0], "screen:")
+
+	_, err = m.GetHealth("emulator-5556")
+	assert.Error(t, err)
+}
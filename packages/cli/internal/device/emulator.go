@@ -0,0 +1,471 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	procgroup "github.com/babelcloud/gbox/packages/cli/internal/proc_group"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrAVDNotFound is returned for an Android Virtual Device that does not exist
+	ErrAVDNotFound = errors.New("avd not found")
+	// ErrEmulatorRunning is returned when starting or wiping a running emulator
+	ErrEmulatorRunning = errors.New("emulator is running")
+)
+
+// Emulator console ports, the adb serial of an emulator is emulator-<port>
+const (
+	firstEmulatorPort = 5554
+	lastEmulatorPort  = 5682
+)
+
+// emulatorKillTimeout is how long an emulator that failed to boot gets to
+// exit after adb emu kill before its process is killed
+const emulatorKillTimeout = 10 * time.Second
+
+// AVD is an Android Virtual Device
+type AVD struct {
+	Name   string `json:"name"`
+	Device string `json:"device,omitempty"` // Hardware profile, e.g. pixel_7 (Google)
+	Target string `json:"target,omitempty"`
+	ABI    string `json:"abi,omitempty"` // Tag/ABI, e.g. google_apis/x86_64
+	Path   string `json:"path,omitempty"`
+	// Serial is the adb serial of the running emulator, empty when stopped
+	Serial string `json:"serial,omitempty"`
+}
+
+// EmulatorStartOptions are how an emulator is booted
+type EmulatorStartOptions struct {
+	// Headless runs without a window, audio or boot animation
+	Headless bool
+	// Snapshot boots from the named snapshot instead of the quick boot one.
+	// ColdBoot ignores snapshots, NoSnapshotSave keeps the emulator from
+	// saving its state on exit.
+	Snapshot       string
+	ColdBoot       bool
+	NoSnapshotSave bool
+	// WipeData resets the user data before booting
+	WipeData bool
+	// Port is the console port, an even number from 5554 to 5682. 0 picks a
+	// free one.
+	Port int
+	// Args are passed to the emulator after the others
+	Args []string
+	// LogFile receives the output of the emulator, discarded when empty
+	LogFile string
+}
+
+// Emulators runs Android Virtual Devices with the emulator and avdmanager
+// tools of the Android SDK, and watches them boot through the adb server
+type Emulators struct {
+	sdkRoot string
+	adb     *adbserver.Client
+	// pollInterval is how often a booting or stopping emulator is checked
+	pollInterval time.Duration
+}
+
+// NewEmulators returns emulators run from the SDK at sdkRoot, or from PATH
+// when it is empty
+func NewEmulators(sdkRoot string, adb *adbserver.Client) *Emulators {
+	return &Emulators{sdkRoot: sdkRoot, adb: adb, pollInterval: time.Second}
+}
+
+// tool returns the path of an SDK tool, from the first of paths under the
+// SDK root that exists, otherwise looked up in PATH
+func (e *Emulators) tool(name string, paths ...string) string {
+	if runtime.GOOS == "windows" {
+		if name == "emulator" {
+			name += ".exe"
+		} else {
+			name += ".bat"
+		}
+	}
+	if e.sdkRoot != "" {
+		for _, p := range paths {
+			p = filepath.Join(e.sdkRoot, filepath.FromSlash(p), name)
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+	}
+	if p, err := exec.LookPath(name); err == nil {
+		return p
+	}
+	return name
+}
+
+func (e *Emulators) emulatorPath() string {
+	return e.tool("emulator", "emulator")
+}
+
+func (e *Emulators) avdmanagerPath() string {
+	return e.tool("avdmanager", "cmdline-tools/latest/bin", "tools/bin")
+}
+
+// List returns the AVDs and the serials of the running ones. The details
+// come from avdmanager, only the names from the emulator when it is missing.
+func (e *Emulators) List(ctx context.Context) ([]AVD, error) {
+	var avds []AVD
+	out, err := exec.CommandContext(ctx, e.avdmanagerPath(), "list", "avd").Output()
+	if err == nil {
+		avds = parseAVDList(string(out))
+	} else {
+		out, err := exec.CommandContext(ctx, e.emulatorPath(), "-list-avds").Output()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list avds, is the Android SDK emulator installed?")
+		}
+		for _, name := range parseAVDNames(string(out)) {
+			avds = append(avds, AVD{Name: name})
+		}
+	}
+
+	running, err := e.Running(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range avds {
+		avds[i].Serial = running[avds[i].Name]
+	}
+	return avds, nil
+}
+
+// Find returns the AVD with a name, or the one running as an adb serial
+func (e *Emulators) Find(ctx context.Context, nameOrSerial string) (*AVD, error) {
+	avds, err := e.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range avds {
+		if avds[i].Name == nameOrSerial || (avds[i].Serial != "" && avds[i].Serial == nameOrSerial) {
+			return &avds[i], nil
+		}
+	}
+	return nil, errors.Wrap(ErrAVDNotFound, nameOrSerial)
+}
+
+// Running returns the adb serials of the running emulators by AVD name
+func (e *Emulators) Running(ctx context.Context) (map[string]string, error) {
+	entries, err := e.adb.Devices(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list adb devices")
+	}
+	running := make(map[string]string)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Serial, "emulator-") || entry.State != "device" {
+			continue
+		}
+		if name := e.avdName(ctx, entry.Serial); name != "" {
+			running[name] = entry.Serial
+		}
+	}
+	return running, nil
+}
+
+// avdName returns the AVD an emulator runs, from the property of Android 11
+// and later or the kernel one before
+func (e *Emulators) avdName(ctx context.Context, serial string) string {
+	for _, prop := range []string{"ro.boot.qemu.avd_name", "ro.kernel.qemu.avd_name"} {
+		out, err := e.adb.Device(serial).Output(ctx, "getprop "+prop)
+		if name := strings.TrimSpace(string(out)); err == nil && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// Start boots an AVD and waits until Android finished booting, returning the
+// adb serial of the emulator. ctx bounds the wait; an emulator that did not
+// boot in time is killed, one that did keeps running.
+func (e *Emulators) Start(ctx context.Context, name string, opts EmulatorStartOptions) (string, error) {
+	avd, err := e.Find(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if avd.Serial != "" {
+		return avd.Serial, errors.Wrapf(ErrEmulatorRunning, "%s runs as %s", name, avd.Serial)
+	}
+
+	port := opts.Port
+	if port == 0 {
+		if port, err = e.freePort(ctx); err != nil {
+			return "", err
+		}
+	} else if port < firstEmulatorPort || port > lastEmulatorPort || port%2 != 0 {
+		return "", errors.Errorf("invalid emulator port %d, must be an even number from %d to %d", port, firstEmulatorPort, lastEmulatorPort)
+	}
+
+	cmd := exec.Command(e.emulatorPath(), emulatorArgs(name, port, opts)...)
+	if opts.LogFile != "" {
+		if err := os.MkdirAll(filepath.Dir(opts.LogFile), 0o755); err != nil {
+			return "", errors.Wrap(err, "failed to create emulator log directory")
+		}
+		logFile, err := os.OpenFile(opts.LogFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to open emulator log")
+		}
+		defer logFile.Close()
+		cmd.Stdout, cmd.Stderr = logFile, logFile
+	}
+	// The emulator outlives gbox, keep it out of the process group of the
+	// terminal so Ctrl-C does not stop it
+	procgroup.SetProcGrp(cmd)
+	if err := cmd.Start(); err != nil {
+		return "", errors.Wrapf(err, "failed to start emulator %s", name)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	serial := fmt.Sprintf("emulator-%d", port)
+	if err := e.waitForBoot(ctx, serial, exited); err != nil {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			e.kill(serial, cmd.Process, exited)
+		}
+		if opts.LogFile != "" {
+			err = errors.Wrapf(err, "see %s", opts.LogFile)
+		}
+		return serial, err
+	}
+	return serial, nil
+}
+
+// emulatorArgs returns the emulator command line of opts
+func emulatorArgs(name string, port int, opts EmulatorStartOptions) []string {
+	args := []string{"-avd", name, "-port", strconv.Itoa(port)}
+	if opts.Headless {
+		args = append(args, "-no-window", "-no-audio", "-no-boot-anim")
+	}
+	switch {
+	case opts.ColdBoot:
+		args = append(args, "-no-snapshot-load")
+	case opts.Snapshot != "":
+		args = append(args, "-snapshot", opts.Snapshot)
+	}
+	if opts.NoSnapshotSave {
+		args = append(args, "-no-snapshot-save")
+	}
+	if opts.WipeData {
+		args = append(args, "-wipe-data")
+	}
+	return append(args, opts.Args...)
+}
+
+// freePort returns the first console port no emulator uses. The emulator
+// also listens on the port after the console port, for adb.
+func (e *Emulators) freePort(ctx context.Context) (int, error) {
+	entries, err := e.adb.Devices(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list adb devices")
+	}
+	used := make(map[string]bool)
+	for _, entry := range entries {
+		used[entry.Serial] = true
+	}
+	for port := firstEmulatorPort; port <= lastEmulatorPort; port += 2 {
+		if used[fmt.Sprintf("emulator-%d", port)] || !portFree(port) || !portFree(port+1) {
+			continue
+		}
+		return port, nil
+	}
+	return 0, errors.New("no free emulator port")
+}
+
+func portFree(port int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+// waitForBoot waits until sys.boot_completed is set on the emulator, or
+// the emulator exits
+func (e *Emulators) waitForBoot(ctx context.Context, serial string, exited <-chan error) error {
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+	for {
+		out, err := e.adb.Device(serial).Output(ctx, "getprop sys.boot_completed")
+		if err == nil && strings.TrimSpace(string(out)) == "1" {
+			return nil
+		}
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("exit status 0")
+			}
+			return errors.Wrapf(err, "emulator %s exited before booting", serial)
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "emulator %s did not boot in time", serial)
+		case <-ticker.C:
+		}
+	}
+}
+
+// kill stops an emulator started by Start with adb emu kill, and kills its
+// process when it does not exit in time
+func (e *Emulators) kill(serial string, process *os.Process, exited <-chan error) {
+	ctx, cancel := context.WithTimeout(context.Background(), emulatorKillTimeout)
+	defer cancel()
+	e.emuKill(ctx, serial)
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		process.Kill()
+	}
+}
+
+// emuKill asks an emulator to exit through its console, with the adb
+// client as the console only listens on the host of the emulator
+func (e *Emulators) emuKill(ctx context.Context, serial string) error {
+	out, err := e.adb.Endpoint().CommandContext(ctx, "-s", serial, "emu", "kill").CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "failed to kill emulator %s: %s", serial, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Stop kills a running emulator as adb emu kill does and waits until adb no
+// longer lists it
+func (e *Emulators) Stop(ctx context.Context, serial string) error {
+	if err := e.emuKill(ctx, serial); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+	for {
+		entries, err := e.adb.Devices(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list adb devices")
+		}
+		gone := true
+		for _, entry := range entries {
+			if entry.Serial == serial && entry.State != "offline" {
+				gone = false
+			}
+		}
+		if gone {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("emulator %s did not shut down in time", serial)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Wipe resets the user data and snapshots of a stopped AVD, as Wipe Data of
+// the AVD manager of Android Studio does
+func (e *Emulators) Wipe(ctx context.Context, name string) error {
+	avd, err := e.Find(ctx, name)
+	if err != nil {
+		return err
+	}
+	if avd.Serial != "" {
+		return errors.Wrapf(ErrEmulatorRunning, "%s runs as %s, stop it first", name, avd.Serial)
+	}
+	dir := avd.Path
+	if dir == "" {
+		dir = filepath.Join(avdHome(), name+".avd")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return errors.Wrapf(err, "failed to find the files of avd %s", name)
+	}
+
+	for _, f := range []string{"userdata-qemu.img", "userdata-qemu.img.qcow2", "cache.img", "cache.img.qcow2", "snapshots"} {
+		if err := os.RemoveAll(filepath.Join(dir, f)); err != nil {
+			return errors.Wrapf(err, "failed to wipe avd %s", name)
+		}
+	}
+	return nil
+}
+
+// avdHome returns the directory of the AVDs, as the emulator finds it
+func avdHome() string {
+	if dir := os.Getenv("ANDROID_AVD_HOME"); dir != "" {
+		return dir
+	}
+	for _, env := range []string{"ANDROID_EMULATOR_HOME", "ANDROID_USER_HOME"} {
+		if dir := os.Getenv(env); dir != "" {
+			return filepath.Join(dir, "avd")
+		}
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".android", "avd")
+}
+
+// parseAVDList parses the output of avdmanager list avd:
+//
+//	    Name: Pixel_7_API_34
+//	  Device: pixel_7 (Google)
+//	    Path: /home/user/.android/avd/Pixel_7_API_34.avd
+//	  Target: Google APIs (Google Inc.)
+//	          Based on: Android 14.0 ("UpsideDownCake") Tag/ABI: google_apis/x86_64
+//	---------
+func parseAVDList(out string) []AVD {
+	var avds []AVD
+	var cur *AVD
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if based, ok := strings.CutPrefix(line, "Based on:"); ok && cur != nil {
+			if i := strings.Index(based, "Tag/ABI:"); i >= 0 {
+				cur.ABI = strings.TrimSpace(based[i+len("Tag/ABI:"):])
+			}
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch k {
+		case "Name":
+			avds = append(avds, AVD{Name: v})
+			cur = &avds[len(avds)-1]
+		case "Device":
+			if cur != nil {
+				cur.Device = v
+			}
+		case "Path":
+			if cur != nil {
+				cur.Path = v
+			}
+		case "Target":
+			if cur != nil {
+				cur.Target = v
+			}
+		}
+	}
+	sort.Slice(avds, func(i, j int) bool { return avds[i].Name < avds[j].Name })
+	return avds
+}
+
+// parseAVDNames parses the output of emulator -list-avds, skipping the log
+// lines some versions print
+func parseAVDNames(out string) []string {
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "INFO") || strings.HasPrefix(line, "WARNING") || strings.Contains(line, " ") {
+			continue
+		}
+		names = append(names, line)
+	}
+	sort.Strings(names)
+	return names
+}
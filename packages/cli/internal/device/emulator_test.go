@@ -0,0 +1,208 @@
+package device
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const avdmanagerOutput = `Available Android Virtual Devices:
+    Name: Pixel_7_API_34
+  Device: pixel_7 (Google)
+    Path: %AVD_HOME%/Pixel_7_API_34.avd
+  Target: Google APIs (Google Inc.)
+          Based on: Android 14.0 ("UpsideDownCake") Tag/ABI: google_apis/x86_64
+  Sdcard: 512 MB
+---------
+    Name: Nexus_5_API_28
+  Device: Nexus 5 (Google)
+    Path: %AVD_HOME%/Nexus_5_API_28.avd
+  Target: Default Android System Image
+          Based on: Android 9.0 ("Pie") Tag/ABI: default/x86
+`
+
+// stubSDK writes an Android SDK whose avdmanager lists the AVDs of
+// avdmanagerOutput and whose emulator records its arguments, then runs until
+// the stop file exists
+func stubSDK(t *testing.T) (sdk, avdHome string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub SDK tools are shell scripts")
+	}
+	sdk, avdHome = t.TempDir(), t.TempDir()
+	write := func(p, content string) {
+		p = filepath.Join(sdk, p)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o755))
+	}
+	list := strings.ReplaceAll(avdmanagerOutput, "%AVD_HOME%", avdHome)
+	write("cmdline-tools/latest/bin/avdmanager", "#!/bin/sh\ncat <<'EOF'\n"+list+"EOF\n")
+	write("emulator/emulator", `#!/bin/sh
+dir=$(dirname "$0")
+echo "$@" > "$dir/args"
+while [ ! -f "$dir/stop" ]; do sleep 0.05; done
+`)
+	t.Cleanup(func() { os.WriteFile(filepath.Join(sdk, "emulator", "stop"), nil, 0o644) })
+	return sdk, avdHome
+}
+
+// stubADB returns a client of server whose adb binary records its arguments
+// in the platform-tools directory of sdk, and stops the stub emulator for
+// emu kill
+func stubADB(t *testing.T, server *adbtest.Server, sdk string) *adbserver.Client {
+	dir := filepath.Join(sdk, "platform-tools")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	script := `#!/bin/sh
+echo "$@" >> "` + dir + `/args"
+case "$*" in *"emu kill") touch "` + filepath.Join(sdk, "emulator", "stop") + `" ;; esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "adb"), []byte(script), 0o755))
+	endpoint := server.Endpoint()
+	endpoint.Path = filepath.Join(dir, "adb")
+	return adbserver.NewClient(endpoint)
+}
+
+// waitFile waits up to 10s until the file at p exists
+func waitFile(p string) {
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(p); err == nil {
+			return
+		}
+	}
+}
+
+func TestParseAVDList(t *testing.T) {
+	avds := parseAVDList(strings.ReplaceAll(avdmanagerOutput, "%AVD_HOME%", "/avd"))
+	assert.Equal(t, []AVD{
+		{Name: "Nexus_5_API_28", Device: "Nexus 5 (Google)", Target: "Default Android System Image", ABI: "default/x86", Path: "/avd/Nexus_5_API_28.avd"},
+		{Name: "Pixel_7_API_34", Device: "pixel_7 (Google)", Target: "Google APIs (Google Inc.)", ABI: "google_apis/x86_64", Path: "/avd/Pixel_7_API_34.avd"},
+	}, avds)
+
+	assert.Equal(t, []string{"Nexus_5_API_28", "Pixel_7_API_34"},
+		parseAVDNames("INFO    | Storing crashdata in: /tmp/android/emu-crash.db\nPixel_7_API_34\nNexus_5_API_28\n"))
+}
+
+func TestEmulatorArgs(t *testing.T) {
+	assert.Equal(t, []string{"-avd", "Pixel", "-port", "5556", "-no-window", "-no-audio", "-no-boot-anim", "-snapshot", "clean", "-no-snapshot-save"},
+		emulatorArgs("Pixel", 5556, EmulatorStartOptions{Headless: true, Snapshot: "clean", NoSnapshotSave: true}))
+	assert.Equal(t, []string{"-avd", "Pixel", "-port", "5554", "-no-snapshot-load", "-wipe-data", "-gpu", "swiftshader_indirect"},
+		emulatorArgs("Pixel", 5554, EmulatorStartOptions{ColdBoot: true, Snapshot: "clean", WipeData: true, Args: []string{"-gpu", "swiftshader_indirect"}}))
+}
+
+func TestEmulatorsStartAndStop(t *testing.T) {
+	sdk, _ := stubSDK(t)
+	server := adbtest.NewServer(t)
+	e := NewEmulators(sdk, stubADB(t, server, sdk))
+	e.pollInterval = 10 * time.Millisecond
+
+	// The emulator comes up in adb once started, boots a little later and
+	// leaves adb once killed
+	go func() {
+		waitFile(filepath.Join(sdk, "emulator", "args"))
+		d := server.AddDevice("emulator-5556")
+		d.ShellOutput("getprop ro.boot.qemu.avd_name", "Pixel_7_API_34\n")
+		time.Sleep(50 * time.Millisecond)
+		d.ShellOutput("getprop sys.boot_completed", "1\n")
+		waitFile(filepath.Join(sdk, "emulator", "stop"))
+		server.RemoveDevice("emulator-5556")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	logFile := filepath.Join(t.TempDir(), "emulators", "Pixel_7_API_34.log")
+	serial, err := e.Start(ctx, "Pixel_7_API_34", EmulatorStartOptions{Headless: true, Port: 5556, LogFile: logFile})
+	require.NoError(t, err)
+	assert.Equal(t, "emulator-5556", serial)
+	args, err := os.ReadFile(filepath.Join(sdk, "emulator", "args"))
+	require.NoError(t, err)
+	assert.Equal(t, "-avd Pixel_7_API_34 -port 5556 -no-window -no-audio -no-boot-anim\n", string(args))
+	assert.FileExists(t, logFile)
+
+	avd, err := e.Find(ctx, "emulator-5556")
+	require.NoError(t, err)
+	assert.Equal(t, "Pixel_7_API_34", avd.Name)
+
+	// Starting it again gives the running one
+	serial, err = e.Start(ctx, "Pixel_7_API_34", EmulatorStartOptions{})
+	assert.True(t, errors.Is(err, ErrEmulatorRunning))
+	assert.Equal(t, "emulator-5556", serial)
+
+	require.NoError(t, e.Stop(ctx, "emulator-5556"))
+	avd, err = e.Find(ctx, "Pixel_7_API_34")
+	require.NoError(t, err)
+	assert.Empty(t, avd.Serial)
+	adbArgs, err := os.ReadFile(filepath.Join(sdk, "platform-tools", "args"))
+	require.NoError(t, err)
+	assert.Contains(t, string(adbArgs), "-s emulator-5556 emu kill\n")
+}
+
+func TestEmulatorsStartFailures(t *testing.T) {
+	sdk, _ := stubSDK(t)
+	server := adbtest.NewServer(t)
+	e := NewEmulators(sdk, server.Client())
+	e.pollInterval = 10 * time.Millisecond
+	ctx := context.Background()
+
+	_, err := e.Start(ctx, "Missing_AVD", EmulatorStartOptions{})
+	assert.True(t, errors.Is(err, ErrAVDNotFound))
+
+	_, err = e.Start(ctx, "Pixel_7_API_34", EmulatorStartOptions{Port: 5555})
+	assert.ErrorContains(t, err, "invalid emulator port 5555")
+
+	// An emulator that exits while booting fails the start at once
+	require.NoError(t, os.WriteFile(filepath.Join(sdk, "emulator", "emulator"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	_, err = e.Start(ctx, "Pixel_7_API_34", EmulatorStartOptions{Port: 5558})
+	assert.ErrorContains(t, err, "emulator emulator-5558 exited before booting")
+}
+
+func TestEmulatorsStartTimeout(t *testing.T) {
+	sdk, _ := stubSDK(t)
+	server := adbtest.NewServer(t)
+	e := NewEmulators(sdk, stubADB(t, server, sdk))
+	e.pollInterval = 10 * time.Millisecond
+
+	// An emulator that does not boot in time is killed rather than left
+	// running
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := e.Start(ctx, "Pixel_7_API_34", EmulatorStartOptions{Port: 5560})
+	assert.ErrorContains(t, err, "emulator emulator-5560 did not boot in time")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), emulatorKillTimeout, "the emulator exited after emu kill")
+	adbArgs, err := os.ReadFile(filepath.Join(sdk, "platform-tools", "args"))
+	require.NoError(t, err)
+	assert.Contains(t, string(adbArgs), "-s emulator-5560 emu kill\n")
+}
+
+func TestEmulatorsWipe(t *testing.T) {
+	sdk, avdHome := stubSDK(t)
+	server := adbtest.NewServer(t)
+	e := NewEmulators(sdk, server.Client())
+	ctx := context.Background()
+
+	dir := filepath.Join(avdHome, "Nexus_5_API_28.avd")
+	for _, f := range []string{"config.ini", "userdata-qemu.img", "userdata-qemu.img.qcow2", "cache.img", "snapshots/default_boot/ram.bin"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0o644))
+	}
+	require.NoError(t, e.Wipe(ctx, "Nexus_5_API_28"))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "config.ini", entries[0].Name())
+
+	// A running emulator is not wiped
+	d := server.AddDevice("emulator-5554")
+	d.ShellOutput("getprop ro.boot.qemu.avd_name", "Nexus_5_API_28\n")
+	assert.True(t, errors.Is(e.Wipe(ctx, "Nexus_5_API_28"), ErrEmulatorRunning))
+}
@@ -0,0 +1,211 @@
+package device
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrQuarantined is returned when connecting a device held back by the health checks
+var ErrQuarantined = errors.New("device is quarantined")
+
+// Health is a snapshot of the vitals of an Android device. Values a probe
+// could not read are left at their zero value and named in Errors.
+type Health struct {
+	// BatteryLevel is in percent, BatteryTemperature in degrees Celsius
+	BatteryLevel       int     `json:"battery_level"`
+	BatteryTemperature float64 `json:"battery_temperature"`
+	Charging           bool    `json:"charging"`
+	// StorageFree and StorageTotal are the bytes of the /data partition
+	StorageFree  int64 `json:"storage_free"`
+	StorageTotal int64 `json:"storage_total"`
+	// CPULoad is the one minute load average
+	CPULoad   float64   `json:"cpu_load"`
+	ScreenOn  bool      `json:"screen_on"`
+	CheckedAt time.Time `json:"checked_at"`
+	Errors    []string  `json:"errors,omitempty"`
+}
+
+// HealthThresholds decide when the server quarantines a device: it is
+// disconnected from the access point and marked unavailable until its
+// vitals recover. A zero threshold is not checked.
+type HealthThresholds struct {
+	// Quarantine enables quarantining, without it health is only reported
+	Quarantine bool
+	// MinBattery is the lowest battery level in percent, a charging device
+	// is not quarantined for its battery
+	MinBattery int
+	// MaxTemperature is the highest battery temperature in degrees Celsius
+	MaxTemperature int
+	// MinStorage is the least free space of /data in bytes
+	MinStorage int64
+	// MaxCPULoad is the highest one minute load average
+	MaxCPULoad float64
+}
+
+// A quarantined device is released only once its vitals are this far on the
+// healthy side of the thresholds, so a device hovering around a threshold
+// isn't connected and disconnected on every check
+const (
+	batteryHysteresis     = 5   // percent
+	temperatureHysteresis = 3   // degrees Celsius
+	storageHysteresis     = 0.1 // of MinStorage
+	cpuLoadHysteresis     = 0.1 // of MaxCPULoad
+)
+
+// DefaultHealthThresholds quarantines devices below 10% battery, above 50°C
+// or with less than 200 MB free. CPU load is not checked, what is too high
+// depends on the number of cores.
+func DefaultHealthThresholds() HealthThresholds {
+	return HealthThresholds{
+		Quarantine:     true,
+		MinBattery:     10,
+		MaxTemperature: 50,
+		MinStorage:     200 << 20,
+	}
+}
+
+// Validate reports thresholds that can never be met
+func (t HealthThresholds) Validate() error {
+	switch {
+	case t.MinBattery < 0 || t.MinBattery > 100:
+		return fmt.Errorf("min battery must be between 0 and 100, got %d", t.MinBattery)
+	case t.MaxTemperature < 0:
+		return fmt.Errorf("max temperature must not be negative, got %d", t.MaxTemperature)
+	case t.MinStorage < 0:
+		return fmt.Errorf("min storage must not be negative, got %d", t.MinStorage)
+	case t.MaxCPULoad < 0:
+		return fmt.Errorf("max cpu load must not be negative, got %v", t.MaxCPULoad)
+	}
+	return nil
+}
+
+// Violations returns why h breaches the thresholds, nothing for a healthy
+// device. A quarantined device is held to the stricter release thresholds.
+// Vitals that could not be read never count against a device.
+func (t HealthThresholds) Violations(h Health, quarantined bool) []string {
+	minBattery, maxTemperature := float64(t.MinBattery), float64(t.MaxTemperature)
+	minStorage, maxCPULoad := float64(t.MinStorage), t.MaxCPULoad
+	if quarantined {
+		minBattery += batteryHysteresis
+		maxTemperature -= temperatureHysteresis
+		minStorage *= 1 + storageHysteresis
+		maxCPULoad *= 1 - cpuLoadHysteresis
+	}
+
+	var violations []string
+	if t.MinBattery > 0 && !h.failed("battery") && float64(h.BatteryLevel) < minBattery && !h.Charging {
+		violations = append(violations, fmt.Sprintf("battery %d%% is below %.0f%%", h.BatteryLevel, minBattery))
+	}
+	if t.MaxTemperature > 0 && !h.failed("battery") && h.BatteryTemperature > maxTemperature {
+		violations = append(violations, fmt.Sprintf("temperature %.1f°C is above %.0f°C", h.BatteryTemperature, maxTemperature))
+	}
+	if t.MinStorage > 0 && !h.failed("storage") && float64(h.StorageFree) < minStorage {
+		violations = append(violations, fmt.Sprintf("free storage %d MB is below %.0f MB", h.StorageFree>>20, minStorage/(1<<20)))
+	}
+	if t.MaxCPULoad > 0 && !h.failed("cpu") && h.CPULoad > maxCPULoad {
+		violations = append(violations, fmt.Sprintf("cpu load %.2f is above %.2f", h.CPULoad, maxCPULoad))
+	}
+	return violations
+}
+
+// failed reports whether the probe named probe could not be read
+func (h Health) failed(probe string) bool {
+	for _, e := range h.Errors {
+		if strings.HasPrefix(e, probe+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBattery reads the output of dumpsys battery
+func parseBattery(out string, h *Health) error {
+	values := dumpsysValues(out)
+	level, err := strconv.Atoi(values["level"])
+	if err != nil {
+		return fmt.Errorf("no battery level in dumpsys battery")
+	}
+	if scale, err := strconv.Atoi(values["scale"]); err == nil && scale > 0 && scale != 100 {
+		level = level * 100 / scale
+	}
+	h.BatteryLevel = level
+	// The temperature is in tenths of a degree
+	if temperature, err := strconv.Atoi(values["temperature"]); err == nil {
+		h.BatteryTemperature = float64(temperature) / 10
+	}
+	for _, source := range []string{"AC powered", "USB powered", "Wireless powered", "Dock powered"} {
+		if values[source] == "true" {
+			h.Charging = true
+		}
+	}
+	return nil
+}
+
+// parseStorage reads the output of df /data, which is in 1K blocks
+func parseStorage(out string, h *Health) error {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 {
+		return fmt.Errorf("unexpected df output: %q", out)
+	}
+	// Long filesystem names wrap the values onto the next line
+	fields := strings.Fields(strings.Join(lines[1:], " "))
+	if len(fields) < 4 {
+		return fmt.Errorf("unexpected df output: %q", out)
+	}
+	total, err1 := strconv.ParseInt(fields[1], 10, 64)
+	free, err2 := strconv.ParseInt(fields[3], 10, 64)
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("unexpected df output: %q", out)
+	}
+	h.StorageTotal = total << 10
+	h.StorageFree = free << 10
+	return nil
+}
+
+// parseLoad reads /proc/loadavg
+func parseLoad(out string, h *Health) error {
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty /proc/loadavg")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return fmt.Errorf("unexpected /proc/loadavg: %q", out)
+	}
+	h.CPULoad = load
+	return nil
+}
+
+// parseScreen reads the output of dumpsys power
+func parseScreen(out string, h *Health) error {
+	values := dumpsysValues(out)
+	if state, ok := values["Display Power"]; ok {
+		// Display Power: state=ON
+		h.ScreenOn = strings.TrimPrefix(state, "state=") == "ON"
+		return nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		// Older releases only report mWakefulness=Awake
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok && k == "mWakefulness" {
+			h.ScreenOn = v == "Awake"
+			return nil
+		}
+	}
+	return fmt.Errorf("no display state in dumpsys power")
+}
+
+// dumpsysValues returns the "key: value" lines of dumpsys output
+func dumpsysValues(out string) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":"); ok {
+			values[k] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
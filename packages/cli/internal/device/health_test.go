@@ -0,0 +1,96 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dumpsysBattery = `Current Battery Service state:
+  AC powered: false
+  USB powered: true
+  Wireless powered: false
+  Max charging current: 500000
+  status: 2
+  health: 2
+  present: true
+  level: 85
+  scale: 100
+  voltage: 4171
+  temperature: 312
+  technology: Li-ion
+`
+
+const dfData = `Filesystem      1K-blocks    Used Available Use% Mounted on
+/dev/block/dm-5  116304032 103887200  12285760  90% /data
+`
+
+func TestParseHealth(t *testing.T) {
+	var h Health
+	require.NoError(t, parseBattery(dumpsysBattery, &h))
+	assert.Equal(t, 85, h.BatteryLevel)
+	assert.Equal(t, 31.2, h.BatteryTemperature)
+	assert.True(t, h.Charging)
+
+	require.NoError(t, parseStorage(dfData, &h))
+	assert.Equal(t, int64(116304032)<<10, h.StorageTotal)
+	assert.Equal(t, int64(12285760)<<10, h.StorageFree)
+
+	// Long filesystem names wrap the values onto the next line
+	h = Health{}
+	require.NoError(t, parseStorage("Filesystem 1K-blocks Used Available Use% Mounted on\n/dev/block/bootdevice/by-name/userdata\n 1000 600 400 60% /data\n", &h))
+	assert.Equal(t, int64(400)<<10, h.StorageFree)
+
+	require.NoError(t, parseLoad("2.35 1.80 1.52 3/1204 12345\n", &h))
+	assert.Equal(t, 2.35, h.CPULoad)
+
+	require.NoError(t, parseScreen("POWER MANAGER (dumpsys power)\n  mWakefulness=Asleep\nDisplay Power: state=ON\n", &h))
+	assert.True(t, h.ScreenOn)
+	require.NoError(t, parseScreen("  mWakefulness=Asleep\n", &h))
+	assert.False(t, h.ScreenOn)
+
+	assert.Error(t, parseBattery("Can't find service: battery\n", &h))
+	assert.Error(t, parseStorage("df: /data: Permission denied\n", &h))
+	assert.Error(t, parseScreen("", &h))
+}
+
+func TestHealthViolations(t *testing.T) {
+	thresholds := DefaultHealthThresholds()
+	healthy := Health{BatteryLevel: 80, BatteryTemperature: 30, StorageFree: 1 << 30, CPULoad: 12}
+	assert.Empty(t, thresholds.Violations(healthy, false))
+
+	sick := Health{BatteryLevel: 8, BatteryTemperature: 52.5, StorageFree: 100 << 20}
+	assert.Equal(t, []string{
+		"battery 8% is below 10%",
+		"temperature 52.5°C is above 50°C",
+		"free storage 100 MB is below 200 MB",
+	}, thresholds.Violations(sick, false))
+
+	// A charging device is not held back for its battery
+	sick.Charging = true
+	assert.Len(t, thresholds.Violations(sick, false), 2)
+
+	// Vitals that could not be read don't count
+	sick.Errors = []string{"battery: exit status 1", "storage: exit status 1"}
+	assert.Empty(t, thresholds.Violations(sick, false))
+
+	// A quarantined device must recover past the hysteresis
+	recovering := Health{BatteryLevel: 12, BatteryTemperature: 48, StorageFree: 210 << 20}
+	assert.Empty(t, thresholds.Violations(recovering, false))
+	assert.Equal(t, []string{
+		"battery 12% is below 15%",
+		"temperature 48.0°C is above 47°C",
+		"free storage 210 MB is below 220 MB",
+	}, thresholds.Violations(recovering, true))
+
+	thresholds.MaxCPULoad = 4
+	assert.Equal(t, []string{"cpu load 12.00 is above 4.00"}, thresholds.Violations(healthy, false))
+}
+
+func TestHealthThresholdsValidate(t *testing.T) {
+	assert.NoError(t, DefaultHealthThresholds().Validate())
+	assert.Error(t, HealthThresholds{MinBattery: 101}.Validate())
+	assert.Error(t, HealthThresholds{MinStorage: -1}.Validate())
+	assert.Error(t, HealthThresholds{MaxCPULoad: -0.5}.Validate())
+}
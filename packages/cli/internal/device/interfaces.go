@@ -1,8 +1,9 @@
 package device
 
 import (
-	"os/exec"
 	"strings"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
 )
 
 // DeviceManager is the interface for device management operations
@@ -47,12 +48,8 @@ func NewManager(osType string) DeviceManager {
 
 	switch strings.ToLower(osType) {
 	case "android":
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
-		}
 		return &AndroidManager{
-			adbPath: adbPath,
+			adb: adbserver.DefaultClient(),
 		}
 	case "linux", "windows", "macos":
 		return &DesktopManager{
@@ -60,12 +57,8 @@ func NewManager(osType string) DeviceManager {
 		}
 	default:
 		// Default to Android for backward compatibility
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
-		}
 		return &AndroidManager{
-			adbPath: adbPath,
+			adb: adbserver.DefaultClient(),
 		}
 	}
 }
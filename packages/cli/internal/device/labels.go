@@ -0,0 +1,173 @@
+package device
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Labels are key=value pairs users put on devices to find them by selector
+// instead of by serial. Keys and values follow the rules of Kubernetes labels
+// without the prefix: up to 63 characters, alphanumerics with -, _ and . in
+// between. Values may be empty.
+
+const maxLabelLength = 63
+
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// ValidateLabel checks a label key and value
+func ValidateLabel(key, value string) error {
+	if len(key) > maxLabelLength || !labelPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key %q: must be up to %d alphanumerics, '-', '_' or '.', starting and ending with an alphanumeric", key, maxLabelLength)
+	}
+	if value != "" && (len(value) > maxLabelLength || !labelPattern.MatchString(value)) {
+		return fmt.Errorf("invalid label value %q of %s: must be empty or up to %d alphanumerics, '-', '_' or '.', starting and ending with an alphanumeric", value, key, maxLabelLength)
+	}
+	return nil
+}
+
+// ParseLabelArgs parses key=value arguments that set labels and key-
+// arguments that remove them
+func ParseLabelArgs(args []string) (set map[string]string, remove []string, err error) {
+	set = make(map[string]string)
+	for _, arg := range args {
+		if key, ok := strings.CutSuffix(arg, "-"); ok && !strings.Contains(arg, "=") {
+			if err := ValidateLabel(key, ""); err != nil {
+				return nil, nil, err
+			}
+			remove = append(remove, key)
+			continue
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid label %q, expected key=value to set it or key- to remove it", arg)
+		}
+		if err := ValidateLabel(key, value); err != nil {
+			return nil, nil, err
+		}
+		set[key] = value
+	}
+	for _, key := range remove {
+		if _, ok := set[key]; ok {
+			return nil, nil, fmt.Errorf("label %s is both set and removed", key)
+		}
+	}
+	return set, remove, nil
+}
+
+// FormatLabels returns labels as sorted key=value pairs separated by commas
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Selector operators
+const (
+	opEquals    = "="
+	opNotEquals = "!="
+	opExists    = "exists"
+	opNotExists = "!exists"
+)
+
+type requirement struct {
+	key   string
+	op    string
+	value string
+}
+
+// Selector picks devices by their labels. All requirements must match.
+type Selector struct {
+	requirements []requirement
+}
+
+// ParseSelector parses a comma separated list of requirements:
+//
+//	team=qa     label team is qa, also written team==qa
+//	os!=14      label os is missing or not 14
+//	gpu         label gpu is set, to any value
+//	!busy       label busy is missing
+//
+// An empty selector matches every device.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var r requirement
+		switch {
+		case strings.Contains(part, "!="):
+			r.key, r.value, _ = strings.Cut(part, "!=")
+			r.op = opNotEquals
+		case strings.Contains(part, "=="):
+			r.key, r.value, _ = strings.Cut(part, "==")
+			r.op = opEquals
+		case strings.Contains(part, "="):
+			r.key, r.value, _ = strings.Cut(part, "=")
+			r.op = opEquals
+		case strings.HasPrefix(part, "!"):
+			r.key, r.op = strings.TrimPrefix(part, "!"), opNotExists
+		default:
+			r.key, r.op = part, opExists
+		}
+		r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+		if err := ValidateLabel(r.key, r.value); err != nil {
+			return Selector{}, fmt.Errorf("invalid selector %q: %v", s, err)
+		}
+		sel.requirements = append(sel.requirements, r)
+	}
+	return sel, nil
+}
+
+// Empty reports whether the selector matches every device
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Matches reports whether labels meet all requirements of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.requirements {
+		value, ok := labels[r.key]
+		switch r.op {
+		case opEquals:
+			if !ok || value != r.value {
+				return false
+			}
+		case opNotEquals:
+			if ok && value == r.value {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String returns the selector in the syntax ParseSelector reads
+func (s Selector) String() string {
+	parts := make([]string, 0, len(s.requirements))
+	for _, r := range s.requirements {
+		switch r.op {
+		case opExists:
+			parts = append(parts, r.key)
+		case opNotExists:
+			parts = append(parts, "!"+r.key)
+		default:
+			parts = append(parts, r.key+r.op+r.value)
+		}
+	}
+	return strings.Join(parts, ",")
+}
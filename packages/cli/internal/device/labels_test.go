@@ -0,0 +1,57 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabelArgs(t *testing.T) {
+	set, remove, err := ParseLabelArgs([]string{"team=qa", "os=14", "note=", "busy-"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "qa", "os": "14", "note": ""}, set)
+	assert.Equal(t, []string{"busy"}, remove)
+
+	for _, args := range [][]string{
+		{"team"},
+		{"=qa"},
+		{"team=q a"},
+		{"-team=qa"},
+		{"team=qa", "team-"},
+	} {
+		_, _, err := ParseLabelArgs(args)
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"team": "qa", "os": "14", "gpu": ""}
+	for selector, want := range map[string]bool{
+		"":                true,
+		"team=qa":         true,
+		"team==qa,os=14":  true,
+		"team=qa, os!=14": false,
+		"os!=13":          true,
+		"rack!=1":         true,
+		"gpu":             true,
+		"!gpu":            false,
+		"!busy,team=qa":   true,
+		"team=dev":        false,
+		"rack":            false,
+		"gpu=,team=qa":    true,
+	} {
+		sel, err := ParseSelector(selector)
+		require.NoError(t, err, selector)
+		assert.Equal(t, want, sel.Matches(labels), selector)
+	}
+
+	sel, err := ParseSelector("team==qa, !busy,gpu,os!=14")
+	require.NoError(t, err)
+	assert.Equal(t, "team=qa,!busy,gpu,os!=14", sel.String())
+
+	_, err = ParseSelector("team=q a")
+	assert.Error(t, err)
+	_, err = ParseSelector("!")
+	assert.Error(t, err)
+}
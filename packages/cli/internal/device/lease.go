@@ -0,0 +1,295 @@
+package device
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/util"
+)
+
+// Lease errors, the server answers them with 409, 404, 403 and 400
+var (
+	ErrLeased        = errors.New("device is leased")
+	ErrNotLeased     = errors.New("device is not leased")
+	ErrLeaseMismatch = errors.New("lease does not hold the device")
+	ErrInvalidLease  = errors.New("invalid lease")
+)
+
+// Lease reserves a device for one owner, e.g. a CI job, until it expires.
+// Owners renew it before it does, so a crashed job frees the device.
+type Lease struct {
+	ID string `json:"id"`
+	// Serial is the adb serial of the device, Serialno its serialno; either
+	// finds the lease
+	Serial     string        `json:"serial"`
+	Serialno   string        `json:"serialno,omitempty"`
+	Owner      string        `json:"owner"`
+	TTL        time.Duration `json:"ttl"`
+	AcquiredAt time.Time     `json:"acquired_at"`
+	RenewedAt  time.Time     `json:"renewed_at"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	// Cleanup uninstalls the apps installed during the lease when it ends,
+	// Packages are the third-party apps installed when it was taken
+	Cleanup  bool     `json:"cleanup,omitempty"`
+	Packages []string `json:"packages,omitempty"`
+}
+
+// holds reports whether the lease is for the device with key
+func (l *Lease) holds(key string) bool {
+	return key != "" && (l.Serial == key || l.Serialno == key)
+}
+
+// Leases is the lease table of the server. It is saved next to the device
+// registry on every change, so leases survive a restart of the server, e.g.
+// when a new build replaces it, and their holders keep renewing them.
+type Leases struct {
+	mu     sync.Mutex
+	path   string
+	now    func() time.Time
+	leases map[string]*Lease // key is ID
+}
+
+// leasesVersion is bumped when the file format changes incompatibly
+const leasesVersion = 1
+
+type leasesFile struct {
+	Version int      `json:"version"`
+	Leases  []*Lease `json:"leases"`
+}
+
+// NewLeases creates an empty lease table kept in memory only, reading the
+// time from now
+func NewLeases(now func() time.Time) *Leases {
+	if now == nil {
+		now = time.Now
+	}
+	return &Leases{now: now, leases: make(map[string]*Lease)}
+}
+
+// OpenLeases loads the lease table at path. A missing file is an empty
+// table; an unreadable one is moved aside so the server can start. Leases
+// that expired while the server was down are kept until they are swept, so
+// their cleanup still runs.
+func OpenLeases(path string, now func() time.Time) (*Leases, error) {
+	t := NewLeases(now)
+	t.path = path
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to read device leases: %v", err)
+	}
+
+	var file leasesFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version > leasesVersion {
+		backup := path + ".bad"
+		os.Rename(path, backup)
+		if err == nil {
+			err = fmt.Errorf("version %d is newer than %d", file.Version, leasesVersion)
+		}
+		return t, fmt.Errorf("device leases %s are unusable (%v), moved them to %s", path, err, backup)
+	}
+	for _, l := range file.Leases {
+		if l != nil && l.ID != "" && l.Serial != "" {
+			t.leases[l.ID] = l
+		}
+	}
+	return t, nil
+}
+
+// DefaultLeasesPath returns where the server keeps its device leases
+func DefaultLeasesPath(gboxHome string) string {
+	return filepath.Join(gboxHome, "cli", "leases.json")
+}
+
+// saveLocked writes the lease table atomically, readable by the user only
+// since lease IDs grant access to the devices
+func (t *Leases) saveLocked() {
+	if t.path == "" {
+		return
+	}
+	file := leasesFile{Version: leasesVersion, Leases: make([]*Lease, 0, len(t.leases))}
+	for _, l := range t.leases {
+		file.Leases = append(file.Leases, l)
+	}
+	sort.Slice(file.Leases, func(i, j int) bool { return file.Leases[i].ID < file.Leases[j].ID })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err == nil {
+		err = util.WriteFileAtomic(t.path, data)
+	}
+	if err != nil {
+		log.Printf("Failed to save device leases: %v", err)
+	}
+}
+
+// find returns the lease of the device with key, expired or not
+func (t *Leases) find(key string) *Lease {
+	for _, l := range t.leases {
+		if l.holds(key) {
+			return l
+		}
+	}
+	return nil
+}
+
+// Acquire leases a device to the owner of lease for its TTL and returns the
+// lease with its ID. A device leased to someone else gives ErrLeased. An
+// expired lease of the device that was not swept yet is replaced and
+// returned, so the caller cleans up after it.
+func (t *Leases) Acquire(lease Lease) (Lease, *Lease, error) {
+	if lease.Serial == "" {
+		return Lease{}, nil, fmt.Errorf("%w: no device serial", ErrInvalidLease)
+	}
+	if lease.Owner == "" {
+		return Lease{}, nil, fmt.Errorf("%w: no owner", ErrInvalidLease)
+	}
+	if lease.TTL <= 0 {
+		return Lease{}, nil, fmt.Errorf("%w: TTL %s is not positive", ErrInvalidLease, lease.TTL)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var expired *Lease
+	for _, key := range []string{lease.Serial, lease.Serialno} {
+		held := t.find(key)
+		if held == nil {
+			continue
+		}
+		if now.Before(held.ExpiresAt) {
+			return Lease{}, nil, fmt.Errorf("%w by %s until %s", ErrLeased, held.Owner, held.ExpiresAt.Format(time.RFC3339))
+		}
+		delete(t.leases, held.ID)
+		expired = held
+	}
+
+	lease.ID = newLeaseID()
+	lease.AcquiredAt, lease.RenewedAt = now, now
+	lease.ExpiresAt = now.Add(lease.TTL)
+	lease.Packages = append([]string(nil), lease.Packages...)
+	t.leases[lease.ID] = &lease
+	t.saveLocked()
+	return lease, expired, nil
+}
+
+// Renew extends the lease with id on the device with key by its TTL
+func (t *Leases) Renew(key, id string) (Lease, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	held, err := t.held(key, id)
+	if err != nil {
+		return Lease{}, err
+	}
+	held.RenewedAt = t.now()
+	held.ExpiresAt = held.RenewedAt.Add(held.TTL)
+	t.saveLocked()
+	return *held, nil
+}
+
+// Release ends the lease with id on the device with key, any lease of it
+// when force is set, and returns the lease that ended
+func (t *Leases) Release(key, id string, force bool) (Lease, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var held *Lease
+	if force {
+		if held = t.find(key); held == nil {
+			return Lease{}, ErrNotLeased
+		}
+	} else {
+		var err error
+		if held, err = t.held(key, id); err != nil {
+			return Lease{}, err
+		}
+	}
+	delete(t.leases, held.ID)
+	t.saveLocked()
+	return *held, nil
+}
+
+// held returns the unexpired lease with id on the device with key
+func (t *Leases) held(key, id string) (*Lease, error) {
+	held := t.find(key)
+	if held == nil || !t.now().Before(held.ExpiresAt) {
+		return nil, ErrNotLeased
+	}
+	if held.ID != id {
+		return nil, ErrLeaseMismatch
+	}
+	return held, nil
+}
+
+// Get returns the unexpired lease of the device with key
+func (t *Leases) Get(key string) (Lease, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	held := t.find(key)
+	if held == nil || !t.now().Before(held.ExpiresAt) {
+		return Lease{}, false
+	}
+	return *held, true
+}
+
+// Check returns nil when the device with key is not leased or id holds it,
+// else ErrLeased
+func (t *Leases) Check(key, id string) error {
+	held, ok := t.Get(key)
+	if !ok || held.ID == id {
+		return nil
+	}
+	return fmt.Errorf("%w by %s until %s", ErrLeased, held.Owner, held.ExpiresAt.Format(time.RFC3339))
+}
+
+// Expire removes the expired leases and returns them
+func (t *Leases) Expire() []Lease {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var expired []Lease
+	for id, l := range t.leases {
+		if !now.Before(l.ExpiresAt) {
+			expired = append(expired, *l)
+			delete(t.leases, id)
+		}
+	}
+	if len(expired) > 0 {
+		t.saveLocked()
+	}
+	return expired
+}
+
+// List returns the unexpired leases ordered by serial
+func (t *Leases) List() []Lease {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	leases := make([]Lease, 0, len(t.leases))
+	for _, l := range t.leases {
+		if now.Before(l.ExpiresAt) {
+			leases = append(leases, *l)
+		}
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Serial < leases[j].Serial })
+	return leases
+}
+
+func newLeaseID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,122 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeases(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	leases := NewLeases(func() time.Time { return now })
+
+	lease, expired, err := leases.Acquire(Lease{Serial: "emulator-5554", Serialno: "EMU1", Owner: "ci", TTL: time.Minute})
+	require.NoError(t, err)
+	assert.Nil(t, expired)
+	assert.NotEmpty(t, lease.ID)
+	assert.Equal(t, now.Add(time.Minute), lease.ExpiresAt)
+
+	// The device is found by serial and serialno and held for the lease only
+	_, _, err = leases.Acquire(Lease{Serial: "10.0.0.2:5555", Serialno: "EMU1", Owner: "dev", TTL: time.Minute})
+	assert.ErrorIs(t, err, ErrLeased)
+	assert.NoError(t, leases.Check("EMU1", lease.ID))
+	assert.ErrorIs(t, leases.Check("emulator-5554", ""), ErrLeased)
+	assert.NoError(t, leases.Check("emulator-5556", ""))
+
+	_, err = leases.Renew("emulator-5554", "other")
+	assert.ErrorIs(t, err, ErrLeaseMismatch)
+	_, err = leases.Release("emulator-5554", "other", false)
+	assert.ErrorIs(t, err, ErrLeaseMismatch)
+
+	now = now.Add(50 * time.Second)
+	renewed, err := leases.Renew("emulator-5554", lease.ID)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), renewed.ExpiresAt)
+	assert.Empty(t, leases.Expire())
+
+	// Expired leases no longer hold the device and are swept
+	now = now.Add(time.Minute)
+	_, ok := leases.Get("emulator-5554")
+	assert.False(t, ok)
+	assert.NoError(t, leases.Check("emulator-5554", ""))
+	_, err = leases.Renew("emulator-5554", lease.ID)
+	assert.ErrorIs(t, err, ErrNotLeased)
+	swept := leases.Expire()
+	require.Len(t, swept, 1)
+	assert.Equal(t, lease.ID, swept[0].ID)
+	assert.Empty(t, leases.List())
+}
+
+func TestLeasesReplaceExpired(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	leases := NewLeases(func() time.Time { return now })
+
+	first, _, err := leases.Acquire(Lease{Serial: "emulator-5554", Owner: "ci", TTL: time.Minute, Cleanup: true, Packages: []string{"com.example"}})
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	second, expired, err := leases.Acquire(Lease{Serial: "emulator-5554", Owner: "dev", TTL: time.Minute})
+	require.NoError(t, err)
+	require.NotNil(t, expired)
+	assert.Equal(t, first.ID, expired.ID)
+	assert.Equal(t, []string{"com.example"}, expired.Packages)
+	assert.Empty(t, leases.Expire())
+
+	_, err = leases.Release("emulator-5554", "", false)
+	assert.ErrorIs(t, err, ErrLeaseMismatch)
+	released, err := leases.Release("emulator-5554", "", true)
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, released.ID)
+	_, err = leases.Release("emulator-5554", "", true)
+	assert.ErrorIs(t, err, ErrNotLeased)
+}
+
+func TestLeasesSurviveRestart(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	path := filepath.Join(t.TempDir(), "leases.json")
+	leases, err := OpenLeases(path, clock)
+	require.NoError(t, err)
+
+	lease, _, err := leases.Acquire(Lease{Serial: "emulator-5554", Serialno: "EMU1", Owner: "ci", TTL: time.Minute, Cleanup: true, Packages: []string{"com.example"}})
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "lease IDs grant access to devices")
+	}
+
+	// The holder keeps renewing the lease with the server that replaced the
+	// old one
+	now = now.Add(30 * time.Second)
+	reopened, err := OpenLeases(path, clock)
+	require.NoError(t, err)
+	renewed, err := reopened.Renew("EMU1", lease.ID)
+	require.NoError(t, err)
+	assert.Equal(t, lease.AcquiredAt, renewed.AcquiredAt)
+	assert.Equal(t, []string{"com.example"}, renewed.Packages)
+	assert.ErrorIs(t, reopened.Check("emulator-5554", ""), ErrLeased)
+
+	// A lease that expired while the server was down is swept after it starts
+	now = now.Add(2 * time.Minute)
+	reopened, err = OpenLeases(path, clock)
+	require.NoError(t, err)
+	swept := reopened.Expire()
+	require.Len(t, swept, 1)
+	assert.True(t, swept[0].Cleanup)
+	reopened, err = OpenLeases(path, clock)
+	require.NoError(t, err)
+	assert.Empty(t, reopened.Expire())
+
+	// An unreadable file is moved aside
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	reopened, err = OpenLeases(path, clock)
+	assert.Error(t, err)
+	assert.NotNil(t, reopened)
+	assert.FileExists(t, path+".bad")
+}
@@ -0,0 +1,145 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ReconnectPolicy decides how the server retries a lost access point session
+type ReconnectPolicy struct {
+	// MaxAttempts is the number of attempts before giving up, 0 retries forever
+	MaxAttempts int
+	// BaseDelay is the delay cap of the first attempt, doubled on every
+	// failure up to MaxDelay. The actual delay is a random duration up to the
+	// cap ("full jitter"), so devices behind one network don't retry in step.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// After BreakerThreshold consecutive failures the breaker opens: the
+	// server waits Cooldown before trying again, starting over at BaseDelay.
+	// 0 never opens the breaker.
+	BreakerThreshold int
+	Cooldown         time.Duration
+	// CancelOnOffline stops retrying when adb reports the device offline or gone
+	CancelOnOffline bool
+}
+
+// DefaultReconnectPolicy retries forever, backing off to a minute between
+// attempts and pausing five minutes after ten failures in a row
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		MaxAttempts:      0,
+		BaseDelay:        2 * time.Second,
+		MaxDelay:         time.Minute,
+		BreakerThreshold: 10,
+		Cooldown:         5 * time.Minute,
+		CancelOnOffline:  true,
+	}
+}
+
+// Validate reports settings the reconnect loop cannot work with
+func (p ReconnectPolicy) Validate() error {
+	switch {
+	case p.MaxAttempts < 0:
+		return fmt.Errorf("max attempts must not be negative, got %d", p.MaxAttempts)
+	case p.BaseDelay <= 0:
+		return fmt.Errorf("base delay must be positive, got %v", p.BaseDelay)
+	case p.MaxDelay < p.BaseDelay:
+		return fmt.Errorf("max delay %v is shorter than base delay %v", p.MaxDelay, p.BaseDelay)
+	case p.BreakerThreshold < 0:
+		return fmt.Errorf("breaker threshold must not be negative, got %d", p.BreakerThreshold)
+	case p.BreakerThreshold > 0 && p.Cooldown <= 0:
+		return fmt.Errorf("cooldown must be positive when the breaker is enabled, got %v", p.Cooldown)
+	}
+	return nil
+}
+
+// Forever reports whether the policy never gives up
+func (p ReconnectPolicy) Forever() bool {
+	return p.MaxAttempts == 0
+}
+
+// Delay returns how long to wait before the attempt that follows failures
+// consecutive failures. random is a number in [0, 1) that picks the delay
+// between 0 and the exponential cap.
+func (p ReconnectPolicy) Delay(failures int, random float64) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 0; i < failures && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	return time.Duration(random * float64(ceiling))
+}
+
+// BreakerOpen reports whether failures consecutive failures open the breaker
+func (p ReconnectPolicy) BreakerOpen(failures int) bool {
+	return p.BreakerThreshold > 0 && failures >= p.BreakerThreshold
+}
+
+// reconnectPolicyJSON spells durations the way users write them, e.g. "30s"
+type reconnectPolicyJSON struct {
+	MaxAttempts      int    `json:"max_attempts"`
+	BaseDelay        string `json:"base_delay"`
+	MaxDelay         string `json:"max_delay"`
+	BreakerThreshold int    `json:"breaker_threshold"`
+	Cooldown         string `json:"cooldown"`
+	CancelOnOffline  bool   `json:"cancel_on_offline"`
+}
+
+func (p ReconnectPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(reconnectPolicyJSON{
+		MaxAttempts:      p.MaxAttempts,
+		BaseDelay:        p.BaseDelay.String(),
+		MaxDelay:         p.MaxDelay.String(),
+		BreakerThreshold: p.BreakerThreshold,
+		Cooldown:         p.Cooldown.String(),
+		CancelOnOffline:  p.CancelOnOffline,
+	})
+}
+
+// UnmarshalJSON sets the fields present in data and keeps the others, so a
+// partial policy can be decoded over a complete one
+func (p *ReconnectPolicy) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		MaxAttempts      *int   `json:"max_attempts"`
+		BaseDelay        string `json:"base_delay"`
+		MaxDelay         string `json:"max_delay"`
+		BreakerThreshold *int   `json:"breaker_threshold"`
+		Cooldown         string `json:"cooldown"`
+		CancelOnOffline  *bool  `json:"cancel_on_offline"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	policy := *p
+	if raw.MaxAttempts != nil {
+		policy.MaxAttempts = *raw.MaxAttempts
+	}
+	if raw.BreakerThreshold != nil {
+		policy.BreakerThreshold = *raw.BreakerThreshold
+	}
+	if raw.CancelOnOffline != nil {
+		policy.CancelOnOffline = *raw.CancelOnOffline
+	}
+	for _, d := range []struct {
+		dst *time.Duration
+		raw string
+	}{
+		{&policy.BaseDelay, raw.BaseDelay},
+		{&policy.MaxDelay, raw.MaxDelay},
+		{&policy.Cooldown, raw.Cooldown},
+	} {
+		if d.raw == "" {
+			continue
+		}
+		value, err := time.ParseDuration(d.raw)
+		if err != nil {
+			return fmt.Errorf("invalid reconnect policy: %v", err)
+		}
+		*d.dst = value
+	}
+	*p = policy
+	return nil
+}
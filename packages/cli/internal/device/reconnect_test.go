@@ -0,0 +1,58 @@
+package device
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	p := ReconnectPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	assert.Equal(t, time.Second, p.Delay(0, 1))
+	assert.Equal(t, 4*time.Second, p.Delay(2, 1))
+	assert.Equal(t, 10*time.Second, p.Delay(50, 1), "capped at MaxDelay")
+	assert.Equal(t, 2*time.Second, p.Delay(2, 0.5), "full jitter picks up to the cap")
+	assert.Equal(t, time.Duration(0), p.Delay(3, 0))
+
+	assert.False(t, p.BreakerOpen(100), "no threshold, no breaker")
+	p.BreakerThreshold = 3
+	assert.False(t, p.BreakerOpen(2))
+	assert.True(t, p.BreakerOpen(3))
+}
+
+func TestReconnectPolicyJSON(t *testing.T) {
+	data, err := json.Marshal(DefaultReconnectPolicy())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"max_attempts":0,"base_delay":"2s","max_delay":"1m0s","breaker_threshold":10,"cooldown":"5m0s","cancel_on_offline":true}`, string(data))
+
+	// Fields left out keep their values
+	p := DefaultReconnectPolicy()
+	require.NoError(t, json.Unmarshal([]byte(`{"max_attempts":20,"cooldown":"30s","cancel_on_offline":false}`), &p))
+	assert.Equal(t, 20, p.MaxAttempts)
+	assert.Equal(t, 30*time.Second, p.Cooldown)
+	assert.False(t, p.CancelOnOffline)
+	assert.Equal(t, 2*time.Second, p.BaseDelay)
+	require.NoError(t, p.Validate())
+
+	assert.ErrorContains(t, json.Unmarshal([]byte(`{"base_delay":"soon"}`), &p), "invalid reconnect policy")
+	assert.Error(t, ReconnectPolicy{BaseDelay: time.Second, MaxDelay: time.Second, BreakerThreshold: 1}.Validate(), "breaker without cooldown")
+
+	// Per-device policies are kept in the registry
+	path := filepath.Join(t.TempDir(), "devices.json")
+	r, err := OpenRegistry(path)
+	require.NoError(t, err)
+	r.Put(RegistryEntry{DeviceID: "dev-1", Serial: "emulator-5554"})
+	assert.True(t, r.SetReconnectPolicy("emulator-5554", &p))
+	assert.False(t, r.SetReconnectPolicy("emulator-5556", &p))
+
+	reopened, err := OpenRegistry(path)
+	require.NoError(t, err)
+	e, ok := reopened.Get("dev-1")
+	require.True(t, ok)
+	require.NotNil(t, e.Reconnect)
+	assert.Equal(t, p, *e.Reconnect)
+}
@@ -0,0 +1,354 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/util"
+)
+
+// Last-known states of registry entries
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateDisconnected = "disconnected" // lost, reconnect gave up, or device went offline
+)
+
+// ErrNotRegistered is returned for devices the server does not know
+var ErrNotRegistered = errors.New("device is not registered")
+
+// ErrLocalOnly is returned for registration and access point calls of a
+// server running in local-only mode
+var ErrLocalOnly = errors.New("server runs in local-only mode")
+
+// registryVersion is bumped when the file format changes incompatibly
+const registryVersion = 1
+
+// lastSeenSaveInterval throttles saving the registry when only the LastSeen
+// times of devices changed, devices are seen on every device list
+const lastSeenSaveInterval = time.Minute
+
+// RegistryEntry is what the server remembers about a registered device
+// across restarts
+type RegistryEntry struct {
+	DeviceID string `json:"device_id"` // GBOX device ID
+	RegID    string `json:"reg_id,omitempty"`
+	// Serial is the session key: the adb device id for Android, the serialno
+	// or regId for desktop devices
+	Serial     string `json:"serial"`
+	Serialno   string `json:"serialno,omitempty"`
+	DeviceType string `json:"device_type,omitempty"` // mobile, desktop
+	OsType     string `json:"os_type,omitempty"`     // android, linux, windows, macos
+	// Profile is the gbox profile the device was registered with
+	Profile       string                 `json:"profile,omitempty"`
+	State         string                 `json:"state"`
+	LastSeen      time.Time              `json:"last_seen"`
+	LastConnected time.Time              `json:"last_connected,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	// Reconnect overrides the global reconnect policy for this device
+	Reconnect *ReconnectPolicy `json:"reconnect,omitempty"`
+}
+
+// Registry is an on-disk record of registered devices, rewritten atomically
+// on every change and at most once a minute for LastSeen updates. It lets the
+// server restore sessions after a restart without asking the cloud, and list
+// registered devices that are offline. It also keeps the labels of devices,
+// registered or not.
+type Registry struct {
+	path    string
+	mu      sync.RWMutex
+	entries map[string]*RegistryEntry // key is DeviceID
+	// labels are keyed by serialno, which stays the same over USB and Wi-Fi
+	// and across registrations
+	labels map[string]map[string]string
+	// savedAt is when the registry was last written, dirty is set while
+	// LastSeen updates are waiting to be written
+	savedAt time.Time
+	dirty   bool
+}
+
+type registryFile struct {
+	Version int                          `json:"version"`
+	Devices []*RegistryEntry             `json:"devices"`
+	Labels  map[string]map[string]string `json:"labels,omitempty"`
+}
+
+// OpenRegistry loads the registry at path. A missing file is an empty
+// registry; an unreadable one is moved aside so the server can start. An
+// empty path keeps the registry in memory only.
+func OpenRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path, entries: make(map[string]*RegistryEntry), labels: make(map[string]map[string]string)}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to read device registry: %v", err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version > registryVersion {
+		backup := path + ".bad"
+		os.Rename(path, backup)
+		if err == nil {
+			err = fmt.Errorf("version %d is newer than %d", file.Version, registryVersion)
+		}
+		return r, fmt.Errorf("device registry %s is unusable (%v), moved it to %s", path, err, backup)
+	}
+	for _, e := range file.Devices {
+		if e != nil && e.DeviceID != "" {
+			r.entries[e.DeviceID] = e
+		}
+	}
+	for serialno, labels := range file.Labels {
+		if serialno != "" && len(labels) > 0 {
+			r.labels[serialno] = labels
+		}
+	}
+	return r, nil
+}
+
+// DefaultRegistryPath returns where the server keeps its device registry
+func DefaultRegistryPath(gboxHome string) string {
+	return filepath.Join(gboxHome, "cli", "devices.json")
+}
+
+// Put records a device as seen now, keeping fields already known when e leaves
+// them empty. The registry is saved when anything but LastSeen changed.
+func (r *Registry) Put(e RegistryEntry) {
+	if e.DeviceID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e.LastSeen.IsZero() {
+		e.LastSeen = time.Now()
+	}
+	old, known := r.entries[e.DeviceID]
+	if known {
+		merged := *old
+		mergeString(&merged.RegID, e.RegID)
+		mergeString(&merged.Serial, e.Serial)
+		mergeString(&merged.Serialno, e.Serialno)
+		mergeString(&merged.DeviceType, e.DeviceType)
+		mergeString(&merged.OsType, e.OsType)
+		mergeString(&merged.Profile, e.Profile)
+		mergeString(&merged.State, e.State)
+		if !e.LastConnected.IsZero() {
+			merged.LastConnected = e.LastConnected
+		}
+		if len(e.Metadata) > 0 {
+			merged.Metadata = e.Metadata
+		}
+		if e.Reconnect != nil {
+			merged.Reconnect = e.Reconnect
+		}
+		merged.LastSeen = e.LastSeen
+		e = merged
+	}
+	r.entries[e.DeviceID] = &e
+
+	if known {
+		unchanged := *old
+		unchanged.LastSeen = e.LastSeen
+		if reflect.DeepEqual(unchanged, e) {
+			r.touchLocked()
+			return
+		}
+	}
+	r.saveLocked()
+}
+
+// touchLocked notes a LastSeen update, saving it once the last save is old enough
+func (r *Registry) touchLocked() {
+	r.dirty = true
+	if time.Since(r.savedAt) >= lastSeenSaveInterval {
+		r.saveLocked()
+	}
+}
+
+// Flush writes LastSeen updates still waiting to be saved
+func (r *Registry) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.dirty {
+		r.saveLocked()
+	}
+}
+
+func mergeString(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+// SetState records the last-known state of the device with session key serial
+func (r *Registry) SetState(serial, state string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	for _, e := range r.entries {
+		if e.Serial != serial || e.State == state {
+			continue
+		}
+		e.State = state
+		e.LastSeen = time.Now()
+		if state == StateConnected {
+			e.LastConnected = e.LastSeen
+		}
+		changed = true
+	}
+	if changed {
+		r.saveLocked()
+	}
+}
+
+// SetReconnectPolicy overrides the reconnect policy of the device with a
+// device ID, regId or session key; nil goes back to the global policy.
+// It reports whether the device is in the registry.
+func (r *Registry) SetReconnectPolicy(key string, policy *ReconnectPolicy) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.lookupLocked(key)
+	if e == nil {
+		return false
+	}
+	e.Reconnect = policy
+	r.saveLocked()
+	return true
+}
+
+// Remove forgets a device by device ID, regId or session key
+func (r *Registry) Remove(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	for id, e := range r.entries {
+		if id == key || e.RegID == key || e.Serial == key {
+			delete(r.entries, id)
+			changed = true
+		}
+	}
+	if changed {
+		r.saveLocked()
+	}
+}
+
+// Get returns the device with a device ID, regId or session key
+func (r *Registry) Get(key string) (RegistryEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if e := r.lookupLocked(key); e != nil {
+		return *e, true
+	}
+	return RegistryEntry{}, false
+}
+
+func (r *Registry) lookupLocked(key string) *RegistryEntry {
+	if e, ok := r.entries[key]; ok {
+		return e
+	}
+	for _, e := range r.entries {
+		if e.RegID == key || e.Serial == key {
+			return e
+		}
+	}
+	return nil
+}
+
+// List returns all devices ordered by device ID
+func (r *Registry) List() []RegistryEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]RegistryEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// Labels returns the labels of the device with a serialno
+func (r *Registry) Labels(serialno string) map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	labels := make(map[string]string, len(r.labels[serialno]))
+	for k, v := range r.labels[serialno] {
+		labels[k] = v
+	}
+	return labels
+}
+
+// SetLabels sets and removes labels of the device with a serialno, returning
+// all its labels
+func (r *Registry) SetLabels(serialno string, set map[string]string, remove []string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	labels := r.labels[serialno]
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for k, v := range set {
+		labels[k] = v
+	}
+	for _, k := range remove {
+		delete(labels, k)
+	}
+	if len(labels) == 0 {
+		delete(r.labels, serialno)
+	} else {
+		r.labels[serialno] = labels
+	}
+	r.saveLocked()
+
+	result := make(map[string]string, len(labels))
+	for k, v := range labels {
+		result[k] = v
+	}
+	return result
+}
+
+// saveLocked writes the registry to a temporary file and renames it over the
+// old one, so a crash never leaves a truncated registry behind
+func (r *Registry) saveLocked() {
+	if r.path == "" {
+		return
+	}
+	file := registryFile{Version: registryVersion, Devices: make([]*RegistryEntry, 0, len(r.entries)), Labels: r.labels}
+	for _, e := range r.entries {
+		file.Devices = append(file.Devices, e)
+	}
+	sort.Slice(file.Devices, func(i, j int) bool { return file.Devices[i].DeviceID < file.Devices[j].DeviceID })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err == nil {
+		err = util.WriteFileAtomic(r.path, data)
+	}
+	if err != nil {
+		log.Printf("Failed to save device registry: %v", err)
+		return
+	}
+	r.savedAt = time.Now()
+	r.dirty = false
+}
@@ -0,0 +1,133 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cli", "devices.json")
+
+	r, err := OpenRegistry(path)
+	require.NoError(t, err)
+	r.Put(RegistryEntry{DeviceID: "dev-1", Serial: "emulator-5554", DeviceType: "mobile", OsType: "android", State: StateConnected})
+	r.Put(RegistryEntry{DeviceID: "dev-2", RegID: "reg-2", Serial: "reg-2", DeviceType: "desktop", OsType: "linux"})
+
+	// Later updates keep what they do not mention
+	r.Put(RegistryEntry{DeviceID: "dev-1", RegID: "reg-1", Metadata: map[string]interface{}{"model": "Pixel"}})
+	r.SetState("emulator-5554", StateReconnecting)
+
+	reopened, err := OpenRegistry(path)
+	require.NoError(t, err)
+	list := reopened.List()
+	require.Len(t, list, 2)
+
+	assert.Equal(t, "dev-1", list[0].DeviceID)
+	assert.Equal(t, "reg-1", list[0].RegID)
+	assert.Equal(t, "emulator-5554", list[0].Serial)
+	assert.Equal(t, "android", list[0].OsType)
+	assert.Equal(t, StateReconnecting, list[0].State)
+	assert.Equal(t, "Pixel", list[0].Metadata["model"])
+	assert.False(t, list[0].LastSeen.IsZero())
+
+	e, ok := reopened.Get("reg-2")
+	require.True(t, ok)
+	assert.Equal(t, "dev-2", e.DeviceID)
+
+	reopened.Remove("emulator-5554")
+	_, ok = reopened.Get("dev-1")
+	assert.False(t, ok)
+
+	// Nothing but the registry is left in its directory
+	files, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestRegistryUnusableFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0o644))
+
+	r, err := OpenRegistry(path)
+	assert.Error(t, err)
+	require.NotNil(t, r)
+	assert.Empty(t, r.List())
+	assert.FileExists(t, path+".bad")
+
+	// The registry stays usable
+	r.Put(RegistryEntry{DeviceID: "dev-1", Serial: "serial"})
+	reopened, err := OpenRegistry(path)
+	require.NoError(t, err)
+	assert.Len(t, reopened.List(), 1)
+}
+
+func TestRegistryInMemory(t *testing.T) {
+	r, err := OpenRegistry("")
+	require.NoError(t, err)
+	r.Put(RegistryEntry{DeviceID: "dev-1", Serial: "serial"})
+	r.Put(RegistryEntry{Serial: "no-id"})
+	assert.Len(t, r.List(), 1)
+}
+
+func TestRegistryLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	r, err := OpenRegistry(path)
+	require.NoError(t, err)
+
+	labels := r.SetLabels("R58N123ABC", map[string]string{"team": "qa", "os": "14"}, nil)
+	assert.Equal(t, map[string]string{"team": "qa", "os": "14"}, labels)
+	labels = r.SetLabels("R58N123ABC", map[string]string{"team": "dev"}, []string{"os"})
+	assert.Equal(t, map[string]string{"team": "dev"}, labels)
+
+	// Changing the result leaves the registry alone
+	labels["rack"] = "1"
+	reopened, err := OpenRegistry(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "dev"}, reopened.Labels("R58N123ABC"))
+	assert.Empty(t, reopened.Labels("unknown"))
+
+	// Removing the last label forgets the device
+	reopened.SetLabels("R58N123ABC", nil, []string{"team"})
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "R58N123ABC")
+}
+
+func TestRegistryLastSeenThrottled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	r, err := OpenRegistry(path)
+	require.NoError(t, err)
+
+	first := time.Now().Add(-time.Hour)
+	r.Put(RegistryEntry{DeviceID: "dev-1", Serial: "emulator-5554", LastSeen: first})
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Seeing the device again refreshes LastSeen without rewriting the file
+	r.Put(RegistryEntry{DeviceID: "dev-1", Serial: "emulator-5554"})
+	e, ok := r.Get("dev-1")
+	require.True(t, ok)
+	assert.True(t, e.LastSeen.After(first))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, saved, data)
+
+	// Other changes are saved at once, pending LastSeen updates on Flush
+	r.Put(RegistryEntry{DeviceID: "dev-1", OsType: "android"})
+	reopened, err := OpenRegistry(path)
+	require.NoError(t, err)
+	e, _ = reopened.Get("dev-1")
+	assert.Equal(t, "android", e.OsType)
+
+	r.Put(RegistryEntry{DeviceID: "dev-1", LastSeen: time.Now().Add(time.Second)})
+	r.Flush()
+	reopened, err = OpenRegistry(path)
+	require.NoError(t, err)
+	e, _ = reopened.Get("dev-1")
+	assert.True(t, e.LastSeen.After(time.Now()))
+}
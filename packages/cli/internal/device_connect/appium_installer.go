@@ -72,56 +72,33 @@ type AppiumConfig struct {
 	Plugins       []string
 }
 
-// GetAppiumConfig reads Appium installation configuration from environment variables
+// GetAppiumConfig reads the Appium installation configuration from the
+// appium.install, appium.drivers and appium.plugins settings
 func GetAppiumConfig() AppiumConfig {
-	cfg := AppiumConfig{
-		InstallAppium: true,
-		Drivers:       []string{"uiautomator2"},
-		Plugins:       []string{"inspector"},
-	}
-
-	// Check if Appium installation is enabled
-	if installAppium := os.Getenv("GBOX_INSTALL_APPIUM"); installAppium != "" {
-		cfg.InstallAppium = strings.ToLower(installAppium) == "true" || installAppium == "1"
-	}
-
-	// Get drivers list
-	if drivers, exists := os.LookupEnv("GBOX_APPIUM_DRIVERS"); exists {
-		drivers = strings.TrimSpace(drivers)
-		if drivers == "" {
-			// Empty string means: ignore and use default
-			// Keep the default value (uiautomator2)
-		} else if strings.ToLower(drivers) == "none" {
-			// Only "none" or "NONE" explicitly clears the list
-			cfg.Drivers = []string{}
-		} else {
-			cfg.Drivers = strings.Split(drivers, ",")
-			// Trim spaces
-			for i, d := range cfg.Drivers {
-				cfg.Drivers[i] = strings.TrimSpace(d)
-			}
-		}
+	return AppiumConfig{
+		InstallAppium: config.GetAppiumInstall(),
+		Drivers:       appiumComponents(config.GetAppiumDrivers(), config.DefaultAppiumDrivers),
+		Plugins:       appiumComponents(config.GetAppiumPlugins(), config.DefaultAppiumPlugins),
 	}
+}
 
-	// Get plugins list
-	if plugins, exists := os.LookupEnv("GBOX_APPIUM_PLUGINS"); exists {
-		plugins = strings.TrimSpace(plugins)
-		if plugins == "" {
-			// Empty string means: ignore and use default
-			// Keep the default value (inspector)
-		} else if strings.ToLower(plugins) == "none" {
-			// Only "none" or "NONE" explicitly clears the list
-			cfg.Plugins = []string{}
-		} else {
-			cfg.Plugins = strings.Split(plugins, ",")
-			// Trim spaces
-			for i, p := range cfg.Plugins {
-				cfg.Plugins[i] = strings.TrimSpace(p)
-			}
+// appiumComponents splits a comma separated list of Appium drivers or
+// plugins. An empty list keeps the defaults, only "none" clears them.
+func appiumComponents(list, defaults string) []string {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		list = defaults
+	}
+	if strings.ToLower(list) == "none" {
+		return []string{}
+	}
+	var components []string
+	for _, c := range strings.Split(list, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			components = append(components, c)
 		}
 	}
-
-	return cfg
+	return components
 }
 
 // CheckNodeInstalled checks if Node.js and npm are installed
@@ -166,8 +143,7 @@ func InstallAppium(cfg AppiumConfig) error {
 			"  • Windows:       Download from https://nodejs.org/", err)
 	}
 
-	deviceProxyHome := config.GetDeviceProxyHome()
-	appiumHome := filepath.Join(deviceProxyHome, "appium")
+	appiumHome := config.GetAppiumHome()
 
 	// Create appium home directory
 	if err := os.MkdirAll(appiumHome, 0755); err != nil {
@@ -531,8 +507,7 @@ func installAppiumComponents(appiumHome string, cfg AppiumConfig) error {
 
 // GetAppiumPath returns the path to the Appium binary
 func GetAppiumPath() string {
-	deviceProxyHome := config.GetDeviceProxyHome()
-	appiumHome := filepath.Join(deviceProxyHome, "appium")
+	appiumHome := config.GetAppiumHome()
 	appiumBinary := filepath.Join(appiumHome, "node_modules", ".bin", "appium")
 
 	// Check if local appium exists
@@ -2,16 +2,17 @@ package device
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"log"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
 	"github.com/babelcloud/gbox/packages/cli/internal/util"
 )
 
@@ -21,11 +22,12 @@ import (
 type ScrcpyConnection struct {
 	deviceSerial  string
 	scid          uint32
-	adbPath       string
+	adb           *adbserver.Client
+	forwardPort   int // adb forward port of a remote adb server, see forward.go
 	serverPath    string
 	conn          net.Conn
 	Listener      net.Listener // Made public to match scrcpy-proxy
-	serverCmd     *exec.Cmd
+	stopServer    context.CancelFunc
 	videoEncoder  string // Video encoder preference
 	streamingMode string // Streaming mode (h264, webrtc, mse)
 }
@@ -37,11 +39,7 @@ func NewScrcpyConnection(deviceSerial string, scid uint32) *ScrcpyConnection {
 
 // NewScrcpyConnectionWithMode creates a new scrcpy connection handler with specific streaming mode
 func NewScrcpyConnectionWithMode(deviceSerial string, scid uint32, streamingMode string) *ScrcpyConnection {
-	// Find adb path
-	adbPath, err := exec.LookPath("adb")
-	if err != nil {
-		adbPath = "adb" // Fallback to PATH
-	}
+	adbClient := adbserver.DefaultClient()
 
 	// Find scrcpy-server.jar
 	serverPath := findScrcpyServerJar()
@@ -51,12 +49,12 @@ func NewScrcpyConnectionWithMode(deviceSerial string, scid uint32, streamingMode
 	}
 
 	// Select optimal encoder based on streaming mode and device capabilities
-	videoEncoder := selectVideoEncoder(deviceSerial, adbPath, streamingMode)
+	videoEncoder := selectVideoEncoder(adbClient.Device(deviceSerial), streamingMode)
 
 	return &ScrcpyConnection{
 		deviceSerial:  deviceSerial,
 		scid:          scid,
-		adbPath:       adbPath,
+		adb:           adbClient,
 		serverPath:    serverPath,
 		videoEncoder:  videoEncoder,
 		streamingMode: streamingMode,
@@ -76,12 +74,10 @@ var preferredAvcEncoders = []string{
 
 const fallbackAvcEncoder = "c2.android.avc.encoder"
 
-// getAvailableEncoders runs adb to read device media_codecs*.xml and parses XML
+// getAvailableEncoders reads device media_codecs*.xml and parses XML
 // to collect all encoder names (elements with name attribute containing "encoder").
-func getAvailableEncoders(adbPath, deviceSerial string) map[string]bool {
-	cmd := exec.Command(adbPath, "-s", deviceSerial, "shell",
-		"cat /vendor/etc/media_codecs*.xml 2>/dev/null")
-	output, err := cmd.Output()
+func getAvailableEncoders(dev *adbserver.Device) map[string]bool {
+	output, err := dev.Output(context.Background(), "cat /vendor/etc/media_codecs*.xml 2>/dev/null")
 	if err != nil {
 		return nil
 	}
@@ -113,14 +109,14 @@ func parseEncoderNamesFromMediaCodecsXML(data []byte) map[string]bool {
 }
 
 // selectVideoEncoder chooses the optimal video encoder based on streaming mode and device.
-func selectVideoEncoder(deviceSerial, adbPath, streamingMode string) string {
+func selectVideoEncoder(dev *adbserver.Device, streamingMode string) string {
 	switch streamingMode {
 	case "h264":
 		// H.264 WebCodecs mode: Use software encoder for maximum compatibility
 		return "OMX.google.h264.encoder"
 	case "webrtc", "mse":
 		// Prefer vendor/hardware AVC encoders; fallback to c2.android.avc.encoder
-		available := getAvailableEncoders(adbPath, deviceSerial)
+		available := getAvailableEncoders(dev)
 		if available == nil {
 			log.Printf("Could not query device encoders, using fallback %s", fallbackAvcEncoder)
 			return fallbackAvcEncoder
@@ -134,7 +130,7 @@ func selectVideoEncoder(deviceSerial, adbPath, streamingMode string) string {
 		log.Printf("No preferred AVC encoder found on device, using %s", fallbackAvcEncoder)
 		return fallbackAvcEncoder
 	default:
-		available := getAvailableEncoders(adbPath, deviceSerial)
+		available := getAvailableEncoders(dev)
 		if available != nil {
 			for _, enc := range preferredAvcEncoders {
 				if available[enc] {
@@ -155,6 +151,11 @@ func (sc *ScrcpyConnection) Connect() (net.Conn, error) {
 		return nil, fmt.Errorf("failed to push server file: %w", err)
 	}
 
+	// A device behind a remote adb server is reached through adb forward
+	if !sc.adb.Endpoint().IsLocal() {
+		return sc.connectForward()
+	}
+
 	// 2. Setup reverse port forwarding
 	if err := sc.setupReversePortForward(); err != nil {
 		return nil, fmt.Errorf("failed to setup reverse port forward: %w", err)
@@ -214,14 +215,13 @@ func (sc *ScrcpyConnection) Connect() (net.Conn, error) {
 			log.Printf("Debug: Check if adb reverse port forward is working...")
 
 			// Debug: Check reverse port forward status
-			checkCmd := exec.Command(sc.adbPath, "-s", sc.deviceSerial, "reverse", "--list")
-			if output, err := checkCmd.Output(); err == nil {
-				log.Printf("Debug: Current reverse port forwards:\n%s", string(output))
+			dev := sc.device()
+			if rules, err := dev.ReverseList(context.Background()); err == nil {
+				log.Printf("Debug: Current reverse port forwards: %v", rules)
 			}
 
 			// Debug: Check if scrcpy server process is running
-			psCmd := exec.Command(sc.adbPath, "-s", sc.deviceSerial, "shell", "ps | grep scrcpy")
-			if output, err := psCmd.Output(); err == nil && len(output) > 0 {
+			if output, err := dev.Output(context.Background(), "ps | grep scrcpy"); err == nil && len(output) > 0 {
 				log.Printf("Debug: Scrcpy server processes found:\n%s", string(output))
 			} else {
 				log.Printf("Debug: No scrcpy server processes found - server may have crashed")
@@ -241,24 +241,30 @@ func (sc *ScrcpyConnection) Connect() (net.Conn, error) {
 	return conn, nil
 }
 
+// device returns the adb device of the connection
+func (sc *ScrcpyConnection) device() *adbserver.Device {
+	return sc.adb.Device(sc.deviceSerial)
+}
+
 // pushServerFile pushes scrcpy-server.jar to device
 func (sc *ScrcpyConnection) pushServerFile() error {
+	ctx := context.Background()
+
 	// Check if local server file exists
 	if sc.serverPath != "" && sc.serverPath != "/data/local/tmp/scrcpy-server.jar" {
 		// Check if file exists locally
-		if _, err := os.Stat(sc.serverPath); err == nil {
+		if f, err := os.Open(sc.serverPath); err == nil {
+			defer f.Close()
 			log.Printf("Pushing scrcpy-server.jar to device...")
-			cmd := exec.Command(sc.adbPath, "-s", sc.deviceSerial, "push", sc.serverPath, "/data/local/tmp/scrcpy-server.jar")
-			if output, err := cmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to push server: %s", output)
+			if err := sc.device().Push(ctx, f, "/data/local/tmp/scrcpy-server.jar", 0644, time.Time{}); err != nil {
+				return fmt.Errorf("failed to push server: %w", err)
 			}
 			log.Printf("Server file pushed successfully")
 		}
 	}
 
 	// Verify server exists on device
-	cmd := exec.Command(sc.adbPath, "-s", sc.deviceSerial, "shell", "ls", "/data/local/tmp/scrcpy-server.jar")
-	if err := cmd.Run(); err != nil {
+	if _, err := sc.device().Stat(ctx, "/data/local/tmp/scrcpy-server.jar"); err != nil {
 		return fmt.Errorf("scrcpy-server.jar not found on device")
 	}
 
@@ -267,18 +273,16 @@ func (sc *ScrcpyConnection) pushServerFile() error {
 
 // setupReversePortForward sets up adb reverse port forwarding
 func (sc *ScrcpyConnection) setupReversePortForward() error {
+	ctx := context.Background()
+	remote := fmt.Sprintf("localabstract:scrcpy_%08x", sc.scid)
+
 	// Clean up any existing reverse forward
-	cleanCmd := exec.Command(sc.adbPath, "-s", sc.deviceSerial, "reverse", "--remove", fmt.Sprintf("localabstract:scrcpy_%08x", sc.scid))
-	cleanCmd.Run() // Ignore error if doesn't exist
+	sc.device().ReverseRemove(ctx, remote) // Ignore error if doesn't exist
 
 	// Setup new reverse forward
 	log.Printf("Setting up reverse port forward: scrcpy_%08x -> tcp:%d", sc.scid, sc.scid)
-	cmd := exec.Command(sc.adbPath, "-s", sc.deviceSerial, "reverse",
-		fmt.Sprintf("localabstract:scrcpy_%08x", sc.scid),
-		fmt.Sprintf("tcp:%d", sc.scid))
-
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to setup reverse forward: %s", output)
+	if _, err := sc.device().Reverse(ctx, remote, fmt.Sprintf("tcp:%d", sc.scid)); err != nil {
+		return fmt.Errorf("failed to setup reverse forward: %w", err)
 	}
 
 	return nil
@@ -295,7 +299,6 @@ func (sc *ScrcpyConnection) startScrcpyServer() error {
 
 	// Build command arguments, codec selection depends on streaming mode
 	args := []string{
-		"-s", sc.deviceSerial, "shell",
 		"CLASSPATH=/data/local/tmp/scrcpy-server.jar",
 		"app_process", "/", "com.genymobile.scrcpy.Server",
 		"3.3.1", // Server version - must match the downloaded jar
@@ -309,6 +312,9 @@ func (sc *ScrcpyConnection) startScrcpyServer() error {
 		"video_codec=h264",
 		fmt.Sprintf("video_encoder=%s", sc.videoEncoder),
 	}
+	if !sc.adb.Endpoint().IsLocal() {
+		args = append(args, "tunnel_forward=true")
+	}
 
 	// Select audio codec by mode:
 	// - separated (webm) and webrtc modes: use Opus
@@ -334,20 +340,23 @@ func (sc *ScrcpyConnection) startScrcpyServer() error {
 		)
 	}
 
-	cmd := exec.Command(sc.adbPath, args...)
-
-	log.Printf("Starting scrcpy server with command: %s", cmd.String())
-
-	// Start the command
-	sc.serverCmd = cmd
-
-	// Capture output for debugging
-	cmd.Stdout = util.NewPrefixLogWriter("[scrcpy-out]")
-	cmd.Stderr = util.NewPrefixLogWriter("[scrcpy-err]")
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start scrcpy server: %w", err)
-	}
+	cmd := adbserver.Quote(args...)
+
+	log.Printf("Starting scrcpy server with command: %s", cmd)
+
+	// Run the server in the background until killScrcpyServer cancels it,
+	// capturing output for debugging
+	ctx, cancel := context.WithCancel(context.Background())
+	sc.stopServer = cancel
+	dev := sc.device()
+	go func() {
+		code, err := dev.Shell(ctx, cmd, nil, util.NewPrefixLogWriter("[scrcpy-out]"), util.NewPrefixLogWriter("[scrcpy-err]"))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Scrcpy server on %s failed: %v", dev.Serial(), err)
+		} else if err == nil {
+			log.Printf("Scrcpy server on %s exited with status %d", dev.Serial(), code)
+		}
+	}()
 
 	// Give server time to start
 	time.Sleep(500 * time.Millisecond)
@@ -358,13 +367,12 @@ func (sc *ScrcpyConnection) startScrcpyServer() error {
 // killScrcpyServer kills any running scrcpy server on device
 func (sc *ScrcpyConnection) killScrcpyServer() {
 	// Kill by process name
-	cmd := exec.Command(sc.adbPath, "-s", sc.deviceSerial, "shell", "pkill", "-f", "scrcpy.Server")
-	cmd.Run()
+	sc.device().Output(context.Background(), "pkill -f scrcpy.Server")
 
-	// Also kill our tracked process if exists
-	if sc.serverCmd != nil && sc.serverCmd.Process != nil {
-		sc.serverCmd.Process.Kill()
-		sc.serverCmd = nil
+	// Also stop our tracked shell if exists
+	if sc.stopServer != nil {
+		sc.stopServer()
+		sc.stopServer = nil
 	}
 }
 
@@ -385,9 +393,12 @@ func (sc *ScrcpyConnection) Close() error {
 	// Kill server process
 	sc.killScrcpyServer()
 
-	// Clean up reverse forward
-	cmd := exec.Command(sc.adbPath, "-s", sc.deviceSerial, "reverse", "--remove", fmt.Sprintf("localabstract:scrcpy_%08x", sc.scid))
-	cmd.Run()
+	// Clean up forward or reverse forward
+	if !sc.adb.Endpoint().IsLocal() {
+		sc.removeForward()
+		return nil
+	}
+	sc.device().ReverseRemove(context.Background(), fmt.Sprintf("localabstract:scrcpy_%08x", sc.scid))
 
 	return nil
 }
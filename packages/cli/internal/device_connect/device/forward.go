@@ -0,0 +1,138 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A device behind a remote adb server cannot reach gbox through adb reverse,
+// so the scrcpy server is started with tunnel_forward=true and gbox connects
+// to it through an adb forward instead. The server accepts the video, audio
+// and control sockets in that order and writes a dummy byte on the first one
+// once it is ready.
+
+// setupForward forwards a free port of the adb server host to the scrcpy
+// socket on the device and returns the address to dial
+func (sc *ScrcpyConnection) setupForward() (string, error) {
+	output, err := sc.device().Forward(context.Background(), "tcp:0", fmt.Sprintf("localabstract:scrcpy_%08x", sc.scid))
+	if err != nil {
+		return "", fmt.Errorf("failed to setup forward: %w", err)
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil {
+		return "", fmt.Errorf("unexpected adb forward port: %q", output)
+	}
+	sc.forwardPort = port
+	return net.JoinHostPort(sc.adb.Endpoint().HostOrLocal(), strconv.Itoa(port)), nil
+}
+
+// removeForward removes the adb forward of setupForward
+func (sc *ScrcpyConnection) removeForward() {
+	if sc.forwardPort == 0 {
+		return
+	}
+	sc.device().ForwardRemove(context.Background(), fmt.Sprintf("tcp:%d", sc.forwardPort))
+	sc.forwardPort = 0
+}
+
+// dialForwardVideo connects the video socket. adb accepts the connection
+// before the scrcpy server listens and closes it right away, so it retries
+// until the dummy byte arrives or the deadline passes.
+func dialForwardVideo(addr string, deadline time.Time) (net.Conn, error) {
+	var lastErr error
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, time.Until(deadline))
+		if err != nil {
+			lastErr = err
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		conn.SetReadDeadline(deadline)
+		var dummy [1]byte
+		if _, err = io.ReadFull(conn, dummy[:]); err == nil {
+			conn.SetReadDeadline(time.Time{})
+			return conn, nil
+		}
+		conn.Close()
+		lastErr = err
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("timeout connecting to scrcpy server through %s: %v", addr, lastErr)
+}
+
+// forwardListener hands out the audio and control sockets of a forward
+// tunnel, so callers accept them as with adb reverse
+type forwardListener struct {
+	addr string
+
+	mu      sync.Mutex
+	pending int // sockets left to dial
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newForwardListener(addr string, sockets int) *forwardListener {
+	return &forwardListener{addr: addr, pending: sockets, closed: make(chan struct{})}
+}
+
+// Accept dials the next socket, then blocks until the listener is closed
+func (l *forwardListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.pending > 0 {
+		l.pending--
+		l.mu.Unlock()
+		return net.Dial("tcp", l.addr)
+	}
+	l.mu.Unlock()
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *forwardListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *forwardListener) Addr() net.Addr {
+	return forwardAddr(l.addr)
+}
+
+type forwardAddr string
+
+func (a forwardAddr) Network() string { return "tcp" }
+func (a forwardAddr) String() string  { return string(a) }
+
+// connectForward starts the scrcpy server behind an adb forward and connects
+// its video socket
+func (sc *ScrcpyConnection) connectForward() (net.Conn, error) {
+	addr, err := sc.setupForward()
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup port forward: %w", err)
+	}
+
+	if err := sc.startScrcpyServer(); err != nil {
+		sc.removeForward()
+		return nil, fmt.Errorf("failed to start scrcpy server: %w", err)
+	}
+
+	log.Printf("Connecting to scrcpy server through adb forward %s...", addr)
+	conn, err := dialForwardVideo(addr, time.Now().Add(20*time.Second))
+	if err != nil {
+		sc.killScrcpyServer()
+		sc.removeForward()
+		return nil, err
+	}
+
+	log.Printf("Scrcpy server connected successfully")
+	sc.Listener = newForwardListener(addr, 2)
+	sc.conn = conn
+	return conn, nil
+}
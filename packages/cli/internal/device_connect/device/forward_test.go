@@ -0,0 +1,64 @@
+package device
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardTunnel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// Like adb before the scrcpy server listens, drop the first connection,
+	// then send the dummy byte and accept the audio and control sockets
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+		for i := 0; i < 3; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if i == 0 {
+				conn.Write([]byte{0})
+			}
+			defer conn.Close()
+		}
+		time.Sleep(time.Second)
+	}()
+
+	addr := ln.Addr().String()
+	video, err := dialForwardVideo(addr, time.Now().Add(5*time.Second))
+	require.NoError(t, err)
+	defer video.Close()
+
+	l := newForwardListener(addr, 2)
+	for i := 0; i < 2; i++ {
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		conn.Close()
+	}
+
+	// Accept blocks once the sockets are handed out, until Close
+	done := make(chan error)
+	go func() {
+		_, err := l.Accept()
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("Accept returned before Close")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.Close()
+	assert.ErrorIs(t, <-done, net.ErrClosed)
+	assert.Equal(t, addr, l.Addr().String())
+}
@@ -0,0 +1,88 @@
+package scrcpytest
+
+import (
+	"bytes"
+	_ "embed"
+)
+
+// The canned video is testdata/video.h264, ten frames of a 320x180 H.264
+// High profile clip encoded by x264, taken from the sample.mp4 test file of
+// github.com/abema/go-mp4 (MIT, see testdata/LICENSE.go-mp4) and converted
+// to Annex B. Every frame is a single slice.
+//
+// The canned audio is 20ms stereo Opus frames of silence, the frame encoders
+// emit for digital silence.
+
+// VideoWidth and VideoHeight are the size of the canned video
+const (
+	VideoWidth  = 320
+	VideoHeight = 180
+)
+
+//go:embed testdata/video.h264
+var h264Stream []byte
+
+var (
+	// OpusHead of a 48kHz stereo stream with 312 samples of pre-skip
+	opusHead = []byte{
+		'O', 'p', 'u', 's', 'H', 'e', 'a', 'd',
+		0x01, 0x02, 0x38, 0x01, 0x80, 0xbb, 0x00, 0x00,
+		0x00, 0x00, 0x00,
+	}
+	// opusSilence is a CELT fullband 20ms stereo frame of silence
+	opusSilence = []byte{0xfc, 0xff, 0xfe}
+)
+
+// annexB joins NAL units with 4-byte start codes
+func annexB(nals ...[]byte) []byte {
+	var b []byte
+	for _, nal := range nals {
+		b = append(b, 0x00, 0x00, 0x00, 0x01)
+		b = append(b, nal...)
+	}
+	return b
+}
+
+// splitNALs returns the NAL units of an Annex B stream with 4-byte start codes
+func splitNALs(stream []byte) [][]byte {
+	startCode := []byte{0x00, 0x00, 0x00, 0x01}
+	var nals [][]byte
+	for _, nal := range bytes.Split(stream, startCode) {
+		if len(nal) > 0 {
+			nals = append(nals, nal)
+		}
+	}
+	return nals
+}
+
+// H264Packets returns the SPS/PPS config packet followed by the frames of the
+// canned video, the first a key frame, in Annex B like the packets of the
+// scrcpy server
+func H264Packets() []Packet {
+	var config, frame [][]byte
+	var packets []Packet
+	key := false
+	for _, nal := range splitNALs(h264Stream) {
+		switch nal[0] & 0x1f {
+		case 7, 8: // SPS, PPS
+			config = append(config, nal)
+			continue
+		case 5: // IDR slice
+			key = true
+		}
+		frame = append(frame, nal)
+		if t := nal[0] & 0x1f; t == 1 || t == 5 {
+			packets = append(packets, Packet{Key: key, Data: annexB(frame...)})
+			frame, key = nil, false
+		}
+	}
+	return append([]Packet{{Config: true, Data: annexB(config...)}}, packets...)
+}
+
+// OpusPackets returns the OpusHead config packet and a frame of silence
+func OpusPackets() []Packet {
+	return []Packet{
+		{Config: true, Data: opusHead},
+		{Data: opusSilence},
+	}
+}
@@ -0,0 +1,334 @@
+// Package scrcpytest runs a fake scrcpy server on an adbtest device. When gbox
+// starts scrcpy-server.jar through the device shell, the fake connects its
+// video, audio and control sockets back through the adb reverse forward and
+// streams canned H.264 and Opus packets with the metadata headers of scrcpy
+// 3.x, so streaming can be tested without a phone.
+package scrcpytest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/protocol"
+)
+
+// ServerPath is where gbox pushes scrcpy-server.jar on the device
+const ServerPath = "/data/local/tmp/scrcpy-server.jar"
+
+// Packet is a media packet of the scrcpy stream. PTS is in microseconds.
+type Packet struct {
+	PTS    uint64
+	Config bool
+	Key    bool
+	Data   []byte
+}
+
+// Server is a fake scrcpy server. Its exported fields may be changed before
+// it is installed.
+type Server struct {
+	DeviceName string
+	Width      int
+	Height     int
+
+	// Video is sent once in order, then its non-config packets are repeated
+	// with advancing PTS, one every FrameInterval, until the session ends
+	Video         []Packet
+	FrameInterval time.Duration
+	// AudioCodec is reported whatever audio_codec gbox asks for
+	AudioCodec    uint32
+	Audio         []Packet
+	AudioInterval time.Duration
+
+	mu       sync.Mutex
+	device   *adbtest.Device
+	sessions []*session
+	started  int
+	options  map[string]string
+	control  []byte
+}
+
+// NewServer returns a fake server streaming the canned H.264 video and Opus
+func NewServer() *Server {
+	return &Server{
+		DeviceName:    "gbox_fake",
+		Width:         VideoWidth,
+		Height:        VideoHeight,
+		Video:         H264Packets(),
+		FrameInterval: 33 * time.Millisecond,
+		AudioCodec:    protocol.CodecIDOPUS,
+		Audio:         OpusPackets(),
+		AudioInterval: 20 * time.Millisecond,
+	}
+}
+
+// Install makes d run the server for app_process scrcpy commands and stop
+// it for pkill, and puts a placeholder scrcpy-server.jar on it
+func (s *Server) Install(d *adbtest.Device) {
+	s.mu.Lock()
+	s.device = d
+	s.mu.Unlock()
+	d.WriteFile(ServerPath, []byte("scrcpy-server"), 0o644)
+	d.HandleShell("CLASSPATH="+ServerPath, s.run)
+	d.HandleShell("pkill", func(cmd string, _ io.Reader, _, _ io.Writer) int {
+		if !strings.Contains(cmd, "scrcpy") || s.stopAll() == 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+// Started returns how many sessions were started
+func (s *Server) Started() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// Running returns how many sessions are streaming
+func (s *Server) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Options returns the key=value options of the last session, such as scid
+// and video_encoder
+func (s *Server) Options() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	options := make(map[string]string, len(s.options))
+	for k, v := range s.options {
+		options[k] = v
+	}
+	return options
+}
+
+// Control returns the bytes received on the control sockets
+func (s *Server) Control() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.control...)
+}
+
+// session is one run of the server
+type session struct {
+	conns []net.Conn
+	stop  chan struct{}
+	once  sync.Once
+}
+
+func (ss *session) close() {
+	ss.once.Do(func() {
+		close(ss.stop)
+		for _, conn := range ss.conns {
+			conn.Close()
+		}
+	})
+}
+
+// run is the shell handler of the app_process command line
+func (s *Server) run(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	options := parseOptions(cmd)
+	if options["tunnel_forward"] == "true" {
+		fmt.Fprintln(stderr, "scrcpytest: tunnel_forward is not supported")
+		return 1
+	}
+
+	s.mu.Lock()
+	d := s.device
+	s.started++
+	s.options = options
+	s.mu.Unlock()
+
+	// Like scrcpy, connect the enabled sockets in order: video, audio, control
+	socket := "localabstract:scrcpy_" + options["scid"]
+	ss := &session{stop: make(chan struct{})}
+	conns := make(map[string]net.Conn)
+	for _, name := range []string{"video", "audio", "control"} {
+		if options[name] == "false" {
+			continue
+		}
+		conn, err := d.DialReverse(socket)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			ss.close()
+			return 1
+		}
+		ss.conns = append(ss.conns, conn)
+		conns[name] = conn
+	}
+	fmt.Fprintf(stdout, "[server] INFO: Device: %s\n", s.DeviceName)
+
+	s.mu.Lock()
+	s.sessions = append(s.sessions, ss)
+	s.mu.Unlock()
+	defer s.remove(ss)
+
+	// adbd kills the server when its shell connection goes away
+	go func() {
+		if _, err := io.Copy(io.Discard, stdin); err != nil {
+			ss.close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	if conn, ok := conns["audio"]; ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.streamAudio(ss, conn)
+		}()
+	}
+	if conn, ok := conns["control"]; ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.readControl(conn)
+		}()
+	}
+	if conn, ok := conns["video"]; ok {
+		s.streamVideo(ss, conn)
+	} else {
+		<-ss.stop
+	}
+
+	// The server exits once its video socket is closed
+	ss.close()
+	wg.Wait()
+	return 0
+}
+
+func (s *Server) remove(ss *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.sessions {
+		if other == ss {
+			s.sessions = append(s.sessions[:i], s.sessions[i+1:]...)
+			return
+		}
+	}
+}
+
+// stopAll ends the running sessions and returns how many there were
+func (s *Server) stopAll() int {
+	s.mu.Lock()
+	sessions := append([]*session(nil), s.sessions...)
+	s.mu.Unlock()
+	for _, ss := range sessions {
+		ss.close()
+	}
+	return len(sessions)
+}
+
+func (s *Server) streamVideo(ss *session, conn net.Conn) {
+	header := make([]byte, 64+12)
+	copy(header, s.DeviceName)
+	binary.BigEndian.PutUint32(header[64:], protocol.CodecIDH264)
+	binary.BigEndian.PutUint32(header[68:], uint32(s.Width))
+	binary.BigEndian.PutUint32(header[72:], uint32(s.Height))
+	if _, err := conn.Write(header); err != nil {
+		return
+	}
+	s.stream(ss, conn, s.Video, s.FrameInterval)
+}
+
+func (s *Server) streamAudio(ss *session, conn net.Conn) {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, s.AudioCodec)
+	if _, err := conn.Write(header); err != nil {
+		return
+	}
+	s.stream(ss, conn, s.Audio, s.AudioInterval)
+}
+
+// stream writes packets, then repeats the media packets until the session
+// ends or the socket breaks
+func (s *Server) stream(ss *session, conn net.Conn, packets []Packet, interval time.Duration) {
+	var media []Packet
+	for _, p := range packets {
+		if !p.Config {
+			media = append(media, p)
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pts uint64
+	for i := 0; ; i++ {
+		var p Packet
+		if i < len(packets) {
+			p = packets[i]
+		} else if len(media) > 0 {
+			p = media[(i-len(packets))%len(media)]
+		} else {
+			<-ss.stop
+			return
+		}
+		if !p.Config {
+			p.PTS = pts
+			pts += uint64(interval / time.Microsecond)
+		}
+		if _, err := conn.Write(encodePacket(p)); err != nil {
+			return
+		}
+		if p.Config {
+			continue
+		}
+		select {
+		case <-ticker.C:
+		case <-ss.stop:
+			return
+		}
+	}
+}
+
+func (s *Server) readControl(conn net.Conn) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			s.control = append(s.control, buf[:n]...)
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// encodePacket frames p with the 12-byte scrcpy packet header
+func encodePacket(p Packet) []byte {
+	flags := p.PTS & protocol.PacketPTSMask
+	if p.Config {
+		flags = protocol.PacketFlagConfig
+	}
+	if p.Key {
+		flags |= protocol.PacketFlagKeyFrame
+	}
+	buf := make([]byte, protocol.PacketHeaderSize+len(p.Data))
+	binary.BigEndian.PutUint64(buf, flags)
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(p.Data)))
+	copy(buf[protocol.PacketHeaderSize:], p.Data)
+	return buf
+}
+
+// parseOptions returns the key=value arguments after the server class
+func parseOptions(cmd string) map[string]string {
+	options := make(map[string]string)
+	for _, field := range strings.Fields(cmd) {
+		if strings.HasPrefix(field, "CLASSPATH=") {
+			continue
+		}
+		if k, v, ok := strings.Cut(strings.Trim(field, "'"), "="); ok {
+			options[k] = v
+		}
+	}
+	return options
+}
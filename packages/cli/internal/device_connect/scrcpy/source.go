@@ -14,6 +14,7 @@ import (
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/device"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/pipeline"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/protocol"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
 	"github.com/babelcloud/gbox/packages/cli/internal/util"
 )
 
@@ -93,22 +94,37 @@ func (s *Source) Stop() error {
 
 // SubscribeVideo implements core.Source
 func (s *Source) SubscribeVideo(subscriberID string, bufferSize int) <-chan core.VideoSample {
-	return s.pipeline.SubscribeVideo(subscriberID, bufferSize)
+	ch := s.pipeline.SubscribeVideo(subscriberID, bufferSize)
+	s.publishSubscriber(events.StreamSubscriberJoined, "video", subscriberID)
+	return ch
 }
 
 // UnsubscribeVideo implements core.Source
 func (s *Source) UnsubscribeVideo(subscriberID string) {
 	s.pipeline.UnsubscribeVideo(subscriberID)
+	s.publishSubscriber(events.StreamSubscriberLeft, "video", subscriberID)
 }
 
 // SubscribeAudio implements core.Source
 func (s *Source) SubscribeAudio(subscriberID string, bufferSize int) <-chan core.AudioSample {
-	return s.pipeline.SubscribeAudio(subscriberID, bufferSize)
+	ch := s.pipeline.SubscribeAudio(subscriberID, bufferSize)
+	s.publishSubscriber(events.StreamSubscriberJoined, "audio", subscriberID)
+	return ch
 }
 
 // UnsubscribeAudio implements core.Source
 func (s *Source) UnsubscribeAudio(subscriberID string) {
 	s.pipeline.UnsubscribeAudio(subscriberID)
+	s.publishSubscriber(events.StreamSubscriberLeft, "audio", subscriberID)
+}
+
+// publishSubscriber announces a stream subscriber joining or leaving the device
+func (s *Source) publishSubscriber(t events.Type, kind, subscriberID string) {
+	events.Publish(t, s.deviceSerial, map[string]interface{}{
+		"kind":          kind,
+		"subscriber_id": subscriberID,
+		"mode":          s.streamingMode,
+	})
 }
 
 // SubscribeControl implements core.Source
@@ -254,7 +270,9 @@ func (s *Source) handleStreamConnections(ctx context.Context, listener net.Liste
 
 		connectionCount++
 		logger.Info("New stream connection received", "device", s.deviceSerial, "connection_number", connectionCount)
-		go s.handleStreamConnection(ctx, conn)
+		// Assign the stream before accepting the next connection, the order
+		// tells audio from control
+		s.handleStreamConnection(ctx, conn)
 	}
 }
 
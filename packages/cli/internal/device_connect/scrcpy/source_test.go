@@ -0,0 +1,69 @@
+package scrcpy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/core"
+	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/protocol"
+	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/scrcpy/scrcpytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceStreamsFromDevice(t *testing.T) {
+	adb := adbtest.NewServer(t)
+	adb.Setenv(t)
+	d := adb.AddDevice("emulator-5554")
+	d.ShellOutput("cat", `<MediaCodecs><Encoders><MediaCodec name="c2.qti.avc.encoder" type="video/avc"/></Encoders></MediaCodecs>`)
+	fake := scrcpytest.NewServer()
+	fake.Install(d)
+
+	src := NewSourceWithMode("emulator-5554", "webrtc")
+	video := src.SubscribeVideo("test", 100)
+	audio := src.SubscribeAudio("test", 100)
+	require.NoError(t, src.Start(context.Background(), "emulator-5554"))
+
+	// The config packet is cached, the key frame is published first
+	select {
+	case sample := <-video:
+		assert.True(t, sample.IsKey)
+		assert.Equal(t, scrcpytest.H264Packets()[1].Data, sample.Data)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no video sample")
+	}
+	assert.Equal(t, scrcpytest.H264Packets()[0].Data, src.GetSpsPps())
+	serial, width, height := src.GetConnectionInfo()
+	assert.Equal(t, "emulator-5554", serial)
+	assert.Equal(t, scrcpytest.VideoWidth, width)
+	assert.Equal(t, scrcpytest.VideoHeight, height)
+
+	select {
+	case sample := <-audio:
+		assert.Equal(t, scrcpytest.OpusPackets()[1].Data, sample.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no audio sample")
+	}
+
+	options := fake.Options()
+	assert.Equal(t, "c2.qti.avc.encoder", options["video_encoder"])
+	assert.Equal(t, "opus", options["audio_codec"])
+
+	// Control messages reach the control socket once it is connected
+	require.Eventually(t, func() bool {
+		src.mu.RLock()
+		defer src.mu.RUnlock()
+		return src.controlConn != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, src.SendControl(core.ControlMessage{Type: protocol.ControlMsgTypeResetVideo}))
+	assert.Eventually(t, func() bool {
+		return len(fake.Control()) > 0 && fake.Control()[0] == protocol.ControlMsgTypeResetVideo
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The server session ends once the source closes its sockets
+	require.NoError(t, src.Stop())
+	assert.Eventually(t, func() bool { return fake.Running() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, fake.Started())
+}
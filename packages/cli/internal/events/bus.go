@@ -0,0 +1,247 @@
+// Package events is the event bus of the gbox server. Device, access point,
+// stream and adb-expose changes are published here and served to clients on
+// /api/events, so they no longer need to poll /api/devices.
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type names what happened, types are grouped by the prefix before the first dot
+type Type string
+
+const (
+	// DeviceState is an adb device state change, e.g. device -> offline
+	DeviceState Type = "device.state"
+	// DeviceQuarantined and DeviceReleased follow the health checks: a device
+	// breaching a health threshold is quarantined until it recovers
+	DeviceQuarantined Type = "device.quarantined"
+	DeviceReleased    Type = "device.released"
+
+	// Lease events follow the leases of shared devices. A lease that was not
+	// renewed in time expires.
+	LeaseAcquired Type = "lease.acquired"
+	LeaseReleased Type = "lease.released"
+	LeaseExpired  Type = "lease.expired"
+
+	// APConnected and APDisconnected track the access point session of a device
+	APConnected    Type = "ap.connected"
+	APDisconnected Type = "ap.disconnected"
+
+	// Reconnect events follow a lost access point session
+	ReconnectAttempt   Type = "reconnect.attempt"
+	ReconnectSucceeded Type = "reconnect.succeeded"
+	ReconnectGaveUp    Type = "reconnect.gave_up"
+	// ReconnectCooldown follows too many failed attempts in a row, the next
+	// attempt waits for the cooldown of the reconnect policy
+	ReconnectCooldown Type = "reconnect.cooldown"
+	// ReconnectCancelled means reconnecting stopped because the device went
+	// offline or was unregistered
+	ReconnectCancelled Type = "reconnect.cancelled"
+
+	// Stream subscribers are live-view, WebRTC and recording clients of a device
+	StreamSubscriberJoined Type = "stream.subscriber_joined"
+	StreamSubscriberLeft   Type = "stream.subscriber_left"
+
+	// ForwardStatus is a status change of an adb-expose port forward
+	ForwardStatus Type = "adb_expose.forward"
+)
+
+// Types lists all event types, for help and validation
+var Types = []Type{
+	DeviceState, DeviceQuarantined, DeviceReleased,
+	LeaseAcquired, LeaseReleased, LeaseExpired,
+	APConnected, APDisconnected,
+	ReconnectAttempt, ReconnectSucceeded, ReconnectGaveUp, ReconnectCooldown, ReconnectCancelled,
+	StreamSubscriberJoined, StreamSubscriberLeft,
+	ForwardStatus,
+}
+
+// Event is a published event
+type Event struct {
+	// ID increases with every event, clients resume after the last ID they saw
+	ID   uint64    `json:"id"`
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	// Subject is the device serial or box ID the event is about
+	Subject string                 `json:"subject,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// Filter selects events. Empty fields match everything.
+type Filter struct {
+	// Types are event types or type groups such as "reconnect"
+	Types   []string
+	Subject string
+}
+
+// Match reports whether the filter selects e
+func (f Filter) Match(e Event) bool {
+	if f.Subject != "" && f.Subject != e.Subject {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if string(e.Type) == t || strings.HasPrefix(string(e.Type), t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// DefaultHistory is the number of events kept for resumption
+	DefaultHistory = 1024
+
+	subscriberBuffer = 256
+)
+
+// Bus fans published events out to subscribers and keeps the latest events
+// so clients can resume after a reconnect
+type Bus struct {
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event
+	size    int
+	subs    map[*Subscription]struct{}
+	now     func() time.Time
+}
+
+// NewBus creates a bus keeping the last size events
+func NewBus(size int) *Bus {
+	if size <= 0 {
+		size = DefaultHistory
+	}
+	return &Bus{
+		size: size,
+		subs: make(map[*Subscription]struct{}),
+		now:  time.Now,
+	}
+}
+
+// Default is the bus of the server process
+var Default = NewBus(DefaultHistory)
+
+// Publish publishes an event on the default bus
+func Publish(t Type, subject string, data map[string]interface{}) Event {
+	return Default.Publish(t, subject, data)
+}
+
+// Publish assigns the next ID to an event and delivers it to all subscribers.
+// A subscriber too slow to keep up is closed with ErrLagged, it can resume
+// from the last event it received.
+func (b *Bus) Publish(t Type, subject string, data map[string]interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e := Event{ID: b.lastID, Type: t, Time: b.now(), Subject: subject, Data: data}
+	b.history = append(b.history, e)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			sub.lagged = true
+			b.closeLocked(sub)
+		}
+	}
+	return e
+}
+
+// LastID returns the ID of the latest event
+func (b *Bus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastID
+}
+
+// Subscribe returns a subscription receiving the events matching filter.
+// Retained events after afterID are delivered first; afterID 0 starts with
+// new events only. An afterID from before a server restart replays all
+// retained events.
+func (b *Bus) Subscribe(afterID uint64, filter Filter) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []Event
+	if afterID > b.lastID {
+		afterID = 0
+		replay = b.history
+	} else if afterID > 0 {
+		for i, e := range b.history {
+			if e.ID > afterID {
+				replay = b.history[i:]
+				break
+			}
+		}
+	}
+
+	sub := &Subscription{bus: b, filter: filter}
+	var matched []Event
+	for _, e := range replay {
+		if filter.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	sub.c = make(chan Event, len(matched)+subscriberBuffer)
+	for _, e := range matched {
+		sub.c <- e
+	}
+	// Events between afterID and the oldest retained event are lost
+	if afterID > 0 && len(b.history) > 0 && b.history[0].ID > afterID+1 {
+		sub.Missed = b.history[0].ID - afterID - 1
+	}
+
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *Bus) closeLocked(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.c)
+}
+
+// Subscription receives events from a bus
+type Subscription struct {
+	// Missed is the number of events requested for replay that were no longer retained
+	Missed uint64
+
+	bus    *Bus
+	filter Filter
+	c      chan Event
+	lagged bool
+}
+
+// C returns the channel events are delivered on. It is closed when the
+// subscription is closed.
+func (s *Subscription) C() <-chan Event {
+	return s.c
+}
+
+// Lagged reports whether the subscription was closed because it fell behind
+func (s *Subscription) Lagged() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.lagged
+}
+
+// Close stops delivery and closes the channel
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.closeLocked(s)
+}
@@ -0,0 +1,131 @@
+package events
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drain(sub *Subscription) []Event {
+	var got []Event
+	for {
+		select {
+		case e, ok := <-sub.C():
+			if !ok {
+				return got
+			}
+			got = append(got, e)
+		default:
+			return got
+		}
+	}
+}
+
+func TestBusPublishAndFilter(t *testing.T) {
+	bus := NewBus(10)
+	all := bus.Subscribe(0, Filter{})
+	reconnects := bus.Subscribe(0, Filter{Types: []string{"reconnect"}})
+	device := bus.Subscribe(0, Filter{Types: []string{string(DeviceState)}, Subject: "emulator-5554"})
+
+	bus.Publish(DeviceState, "emulator-5554", map[string]interface{}{"new_state": "device"})
+	bus.Publish(DeviceState, "R58M", nil)
+	bus.Publish(ReconnectAttempt, "emulator-5554", map[string]interface{}{"attempt": 1})
+	bus.Publish(ReconnectGaveUp, "emulator-5554", nil)
+
+	got := drain(all)
+	require.Len(t, got, 4)
+	assert.Equal(t, []uint64{1, 2, 3, 4}, []uint64{got[0].ID, got[1].ID, got[2].ID, got[3].ID})
+	assert.Equal(t, "device", got[0].Data["new_state"])
+
+	got = drain(reconnects)
+	require.Len(t, got, 2)
+	assert.Equal(t, ReconnectAttempt, got[0].Type)
+	assert.Equal(t, ReconnectGaveUp, got[1].Type)
+
+	got = drain(device)
+	require.Len(t, got, 1)
+	assert.Equal(t, uint64(1), got[0].ID)
+
+	// "re" is not a group of reconnect events
+	assert.False(t, Filter{Types: []string{"re"}}.Match(got[0]))
+}
+
+func TestBusResume(t *testing.T) {
+	bus := NewBus(3)
+	for i := 0; i < 5; i++ {
+		bus.Publish(APConnected, "dev", nil)
+	}
+	assert.Equal(t, uint64(5), bus.LastID())
+
+	// Events after 3 are still retained
+	sub := bus.Subscribe(3, Filter{})
+	got := drain(sub)
+	require.Len(t, got, 2)
+	assert.Equal(t, uint64(4), got[0].ID)
+	assert.Zero(t, sub.Missed)
+
+	// Event 2 was dropped from the history of 3
+	sub = bus.Subscribe(1, Filter{})
+	assert.Len(t, drain(sub), 3)
+	assert.Equal(t, uint64(1), sub.Missed)
+
+	// An ID from before a server restart replays everything retained
+	sub = bus.Subscribe(100, Filter{})
+	assert.Len(t, drain(sub), 3)
+
+	// Live events follow the replay
+	sub = bus.Subscribe(5, Filter{})
+	bus.Publish(APDisconnected, "dev", nil)
+	got = drain(sub)
+	require.Len(t, got, 1)
+	assert.Equal(t, uint64(6), got[0].ID)
+}
+
+func TestBusClosesLaggingSubscriber(t *testing.T) {
+	bus := NewBus(10)
+	slow := bus.Subscribe(0, Filter{})
+	for i := 0; i < subscriberBuffer+1; i++ {
+		bus.Publish(StreamSubscriberJoined, "dev", nil)
+	}
+	assert.Len(t, drain(slow), subscriberBuffer)
+	_, ok := <-slow.C()
+	assert.False(t, ok)
+	assert.True(t, slow.Lagged())
+
+	// Closing twice is harmless
+	slow.Close()
+
+	sub := bus.Subscribe(0, Filter{})
+	sub.Close()
+	_, ok = <-sub.C()
+	assert.False(t, ok)
+	assert.False(t, sub.Lagged())
+}
+
+func TestSSERoundTrip(t *testing.T) {
+	bus := NewBus(10)
+	sent := []Event{
+		bus.Publish(ForwardStatus, "box-1", map[string]interface{}{"status": "running"}),
+		bus.Publish(DeviceState, "emulator-5554", nil),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("retry: 2000\n\n: keep-alive\n\n")
+	for _, e := range sent {
+		require.NoError(t, WriteSSE(&buf, e))
+	}
+	assert.Contains(t, buf.String(), "id: 1\nevent: adb_expose.forward\ndata: {")
+
+	var got []Event
+	require.NoError(t, ReadSSE(&buf, func(e Event) error {
+		got = append(got, e)
+		return nil
+	}))
+	require.Len(t, got, 2)
+	assert.Equal(t, sent[0].ID, got[0].ID)
+	assert.Equal(t, "box-1", got[0].Subject)
+	assert.Equal(t, "running", got[0].Data["status"])
+	assert.True(t, sent[1].Time.Equal(got[1].Time))
+}
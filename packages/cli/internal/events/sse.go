@@ -0,0 +1,68 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteSSE writes an event in the text/event-stream format
+func WriteSSE(w io.Writer, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// ReadSSE reads a text/event-stream of events written by WriteSSE and calls fn
+// for each of them until the stream ends or fn returns an error
+func ReadSSE(r io.Reader, fn func(Event) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data strings.Builder
+	var id string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() == 0 {
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(data.String()), &e); err != nil {
+				return fmt.Errorf("invalid event: %v", err)
+			}
+			if e.ID == 0 && id != "" {
+				e.ID, _ = strconv.ParseUint(id, 10, 64)
+			}
+			data.Reset()
+			id = ""
+			if err := fn(e); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment, used as keep-alive
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		case "id":
+			id = value
+		}
+	}
+	return scanner.Err()
+}
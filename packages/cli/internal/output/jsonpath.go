@@ -0,0 +1,402 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The JSONPath templates follow kubectl: text outside braces is printed as is,
+// {.path} prints the values at path separated by spaces, {range .path}...{end}
+// repeats its body for every value with paths relative to that value, and
+// {"\n"} prints a quoted string. Paths support .field, ['field'], [n], [*],
+// .* and [?(@.field == "value")] filters.
+
+type jsonPathNode interface{}
+
+type jsonPathText string
+
+type jsonPathRange struct {
+	path jsonPathExpr
+	body []jsonPathNode
+}
+
+type jsonPathExpr struct {
+	// root makes the path start at the document instead of the current value
+	root  bool
+	steps []jsonPathStep
+}
+
+type jsonPathStep struct {
+	field    string
+	index    *int
+	wildcard bool
+	filter   *jsonPathFilter
+}
+
+type jsonPathFilter struct {
+	path jsonPathExpr
+	// op is empty when the filter only checks the path exists
+	op    string
+	value string
+}
+
+// JSONPath is a parsed JSONPath template
+type JSONPath struct {
+	nodes []jsonPathNode
+}
+
+// ParseJSONPath parses a JSONPath template. A template without braces is
+// treated as a single expression.
+func ParseJSONPath(template string) (*JSONPath, error) {
+	if !strings.Contains(template, "{") {
+		template = "{" + template + "}"
+	}
+
+	var stack [][]jsonPathNode
+	var ranges []*jsonPathRange
+	var nodes []jsonPathNode
+
+	for len(template) > 0 {
+		open := strings.Index(template, "{")
+		if open < 0 {
+			nodes = append(nodes, jsonPathText(template))
+			break
+		}
+		if open > 0 {
+			nodes = append(nodes, jsonPathText(template[:open]))
+		}
+		end := closingBrace(template, open)
+		if end < 0 {
+			return nil, fmt.Errorf("invalid jsonpath: unclosed '{' in %q", template)
+		}
+		expr := strings.TrimSpace(template[open+1 : end])
+		template = template[end+1:]
+
+		switch {
+		case expr == "end":
+			if len(ranges) == 0 {
+				return nil, fmt.Errorf("invalid jsonpath: {end} without {range}")
+			}
+			r := ranges[len(ranges)-1]
+			r.body = nodes
+			ranges = ranges[:len(ranges)-1]
+			nodes = append(stack[len(stack)-1], r)
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(expr, "range "):
+			path, err := parseJSONPathExpr(strings.TrimSpace(strings.TrimPrefix(expr, "range ")))
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, &jsonPathRange{path: path})
+			stack = append(stack, nodes)
+			nodes = nil
+		case strings.HasPrefix(expr, `"`) || strings.HasPrefix(expr, "'"):
+			text, err := unquote(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonpath string %s: %v", expr, err)
+			}
+			nodes = append(nodes, jsonPathText(text))
+		default:
+			path, err := parseJSONPathExpr(expr)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, path)
+		}
+	}
+
+	if len(ranges) > 0 {
+		return nil, fmt.Errorf("invalid jsonpath: {range} without {end}")
+	}
+	return &JSONPath{nodes: nodes}, nil
+}
+
+// Execute writes the template evaluated against data, which must consist of
+// the types encoding/json decodes into
+func (p *JSONPath) Execute(w io.Writer, data interface{}) error {
+	return executeJSONPath(w, p.nodes, data, data)
+}
+
+func executeJSONPath(w io.Writer, nodes []jsonPathNode, root, current interface{}) error {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case jsonPathText:
+			if _, err := io.WriteString(w, string(n)); err != nil {
+				return err
+			}
+		case jsonPathExpr:
+			values := n.eval(root, current)
+			parts := make([]string, len(values))
+			for i, v := range values {
+				parts[i] = formatJSONValue(v)
+			}
+			if _, err := io.WriteString(w, strings.Join(parts, " ")); err != nil {
+				return err
+			}
+		case *jsonPathRange:
+			for _, v := range n.path.eval(root, current) {
+				if err := executeJSONPath(w, n.body, root, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// eval returns the values the path selects
+func (e jsonPathExpr) eval(root, current interface{}) []interface{} {
+	values := []interface{}{current}
+	if e.root {
+		values = []interface{}{root}
+	}
+
+	for _, step := range e.steps {
+		var next []interface{}
+		for _, v := range values {
+			switch {
+			case step.wildcard:
+				next = append(next, children(v)...)
+			case step.index != nil:
+				if list, ok := v.([]interface{}); ok {
+					i := *step.index
+					if i < 0 {
+						i += len(list)
+					}
+					if i >= 0 && i < len(list) {
+						next = append(next, list[i])
+					}
+				}
+			case step.filter != nil:
+				for _, child := range children(v) {
+					if step.filter.match(root, child) {
+						next = append(next, child)
+					}
+				}
+			default:
+				if m, ok := v.(map[string]interface{}); ok {
+					if child, exists := m[step.field]; exists {
+						next = append(next, child)
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func (f *jsonPathFilter) match(root, current interface{}) bool {
+	values := f.path.eval(root, current)
+	if f.op == "" {
+		return len(values) > 0
+	}
+	for _, v := range values {
+		if (formatJSONValue(v) == f.value) == (f.op == "==") {
+			return true
+		}
+	}
+	return len(values) == 0 && f.op == "!="
+}
+
+// children returns the elements of a list or the values of a map in key order
+func children(v interface{}) []interface{} {
+	switch c := v.(type) {
+	case []interface{}:
+		return c
+	case map[string]interface{}:
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, len(keys))
+		for i, k := range keys {
+			values[i] = c[k]
+		}
+		return values
+	}
+	return nil
+}
+
+func parseJSONPathExpr(s string) (jsonPathExpr, error) {
+	expr := jsonPathExpr{}
+	orig := s
+	switch {
+	case strings.HasPrefix(s, "$"):
+		expr.root = true
+		s = s[1:]
+	case strings.HasPrefix(s, "@"):
+		s = s[1:]
+	}
+	if s == "." {
+		return expr, nil
+	}
+
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if strings.HasPrefix(s, "*") {
+				expr.steps = append(expr.steps, jsonPathStep{wildcard: true})
+				s = s[1:]
+				continue
+			}
+			n := strings.IndexAny(s, ".[")
+			if n < 0 {
+				n = len(s)
+			}
+			if n == 0 {
+				return expr, fmt.Errorf("invalid jsonpath %q: empty field name", orig)
+			}
+			expr.steps = append(expr.steps, jsonPathStep{field: s[:n]})
+			s = s[n:]
+		case '[':
+			end := closingBracket(s)
+			if end < 0 {
+				return expr, fmt.Errorf("invalid jsonpath %q: unclosed '['", orig)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			step, err := parseBracket(inner)
+			if err != nil {
+				return expr, fmt.Errorf("invalid jsonpath %q: %v", orig, err)
+			}
+			expr.steps = append(expr.steps, step)
+		default:
+			return expr, fmt.Errorf("invalid jsonpath %q: expected '.' or '[' at %q", orig, s)
+		}
+	}
+	return expr, nil
+}
+
+func parseBracket(inner string) (jsonPathStep, error) {
+	switch {
+	case inner == "*":
+		return jsonPathStep{wildcard: true}, nil
+	case strings.HasPrefix(inner, "'") || strings.HasPrefix(inner, `"`):
+		field, err := unquote(inner)
+		if err != nil {
+			return jsonPathStep{}, err
+		}
+		return jsonPathStep{field: field}, nil
+	case strings.HasPrefix(inner, "?(") && strings.HasSuffix(inner, ")"):
+		filter, err := parseFilter(strings.TrimSpace(inner[2 : len(inner)-1]))
+		if err != nil {
+			return jsonPathStep{}, err
+		}
+		return jsonPathStep{filter: filter}, nil
+	default:
+		i, err := strconv.Atoi(inner)
+		if err != nil {
+			return jsonPathStep{}, fmt.Errorf("unsupported subscript [%s]", inner)
+		}
+		return jsonPathStep{index: &i}, nil
+	}
+}
+
+func parseFilter(s string) (*jsonPathFilter, error) {
+	filter := &jsonPathFilter{}
+	path := s
+	for _, op := range []string{"==", "!="} {
+		if i := strings.Index(s, op); i >= 0 {
+			filter.op = op
+			path = strings.TrimSpace(s[:i])
+			value := strings.TrimSpace(s[i+len(op):])
+			if strings.HasPrefix(value, "'") || strings.HasPrefix(value, `"`) {
+				var err error
+				if value, err = unquote(value); err != nil {
+					return nil, err
+				}
+			}
+			filter.value = value
+			break
+		}
+	}
+	if !strings.HasPrefix(path, "@") {
+		return nil, fmt.Errorf("filter must start with '@': %s", s)
+	}
+	expr, err := parseJSONPathExpr(path)
+	if err != nil {
+		return nil, err
+	}
+	filter.path = expr
+	return filter, nil
+}
+
+// closingBrace returns the index of the brace closing the one at open,
+// skipping braces in quoted strings
+func closingBrace(s string, open int) int {
+	var quote byte
+	for i := open + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// closingBracket returns the index of the bracket closing s[0], allowing
+// nested brackets and quoted strings in filters
+func closingBracket(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func unquote(s string) (string, error) {
+	if strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") && len(s) >= 2 {
+		return s[1 : len(s)-1], nil
+	}
+	return strconv.Unquote(s)
+}
+
+// formatJSONValue formats a decoded JSON value for template output
+func formatJSONValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		data, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprintf("%v", t)
+		}
+		return string(data)
+	}
+}
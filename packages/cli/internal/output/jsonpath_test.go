@@ -0,0 +1,68 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPath(t *testing.T) {
+	var data interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"data": [
+			{"id": "a", "status": "running", "cpu": 2, "labels": {"env": "test", "team": "qa"}},
+			{"id": "b", "status": "stopped", "cpu": 1.5, "labels": {"env": "prod"}},
+			{"id": "c", "status": "running", "ok": true}
+		],
+		"total": 3
+	}`), &data))
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{.total}", "3"},
+		{".total", "3"},
+		{"{.data[*].id}", "a b c"},
+		{"{.data[0].labels}", `{"env":"test","team":"qa"}`},
+		{"{.data[-1].ok}", "true"},
+		{"{.data[1].cpu}", "1.5"},
+		{"{.data[0].labels.*}", "test qa"},
+		{"{.data[0]['labels']['env']}", "test"},
+		{"{.data[*].missing}", ""},
+		{`{.data[?(@.status=="running")].id}`, "a c"},
+		{`{.data[?(@.status!='running')].id}`, "b"},
+		{"{.data[?(@.ok)].id}", "c"},
+		{`{range .data[*]}{.id}={.status}{"\n"}{end}`, "a=running\nb=stopped\nc=running\n"},
+		{`{range .data[*]}{range .labels.*}{$.total}:{@}{" "}{end}{end}`, "3:test 3:qa 3:prod "},
+		{`total: {.total} {"{}"}`, "total: 3 {}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			path, err := ParseJSONPath(tt.template)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, path.Execute(&buf, data))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestJSONPathErrors(t *testing.T) {
+	for template, want := range map[string]string{
+		"{.a":              "unclosed '{'",
+		"{range .a}{.b}":   "{range} without {end}",
+		"{.a}{end}":        "{end} without {range}",
+		"{.a[}":            "unclosed '['",
+		"{.a[x]}":          "unsupported subscript",
+		"{.a..b}":          "empty field name",
+		"{a}":              "expected '.' or '['",
+		`{.a[?(.b=="c")]}`: "filter must start with '@'",
+	} {
+		_, err := ParseJSONPath(template)
+		assert.ErrorContains(t, err, want, template)
+	}
+}
@@ -0,0 +1,357 @@
+// Package output renders command results in the formats selected with -o:
+// tables built on util.RenderTable, JSON, YAML, JSONPath and Go templates.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+	FormatTable      = "table"
+	FormatWide       = "wide"
+	FormatJSON       = "json"
+	FormatYAML       = "yaml"
+	FormatJSONPath   = "jsonpath"
+	FormatGoTemplate = "go-template"
+)
+
+// Formats lists the values accepted by -o, for help and completion
+var Formats = []string{FormatTable, FormatWide, FormatJSON, FormatYAML, FormatJSONPath + "=", FormatGoTemplate + "="}
+
+// Options holds the output flags of a command
+type Options struct {
+	// Format is the value of -o, e.g. json or jsonpath={.id}
+	Format    string
+	Columns   []string
+	SortBy    string
+	NoHeaders bool
+}
+
+// Column is a table column
+type Column struct {
+	Header string
+	// Key selects the cell of a row, and names the column for --columns and --sort-by
+	Key string
+	// Wide columns are only shown with -o wide
+	Wide bool
+}
+
+// Row is a table row and the object it stands for in structured formats
+type Row struct {
+	Cells map[string]interface{}
+	Item  interface{}
+}
+
+// Table is a list of objects
+type Table struct {
+	Columns []Column
+	Rows    []Row
+	// Empty is printed instead of a table without rows
+	Empty string
+	// Wrap builds the document structured formats render from the items of the
+	// rows, e.g. {"data": items}. Without it the items are rendered as a list.
+	Wrap func(items []interface{}) interface{}
+}
+
+// Kind returns the format name without its argument, "text" is accepted as a
+// synonym of table
+func (o *Options) Kind() string {
+	kind, _, _ := strings.Cut(o.Format, "=")
+	if kind == "" || kind == "text" {
+		return FormatTable
+	}
+	return kind
+}
+
+// IsStructured reports whether the format renders objects rather than text
+func (o *Options) IsStructured() bool {
+	switch o.Kind() {
+	case FormatTable, FormatWide:
+		return false
+	}
+	return true
+}
+
+// Validate checks the format and its argument
+func (o *Options) Validate() error {
+	kind, arg, hasArg := strings.Cut(o.Format, "=")
+	switch o.Kind() {
+	case FormatTable, FormatWide, FormatJSON, FormatYAML:
+		if hasArg {
+			return fmt.Errorf("output format %s takes no argument", kind)
+		}
+	case FormatJSONPath:
+		if arg == "" {
+			return fmt.Errorf("output format jsonpath requires a template, e.g. -o jsonpath='{.id}'")
+		}
+		if _, err := ParseJSONPath(arg); err != nil {
+			return err
+		}
+	case FormatGoTemplate:
+		if arg == "" {
+			return fmt.Errorf("output format go-template requires a template, e.g. -o go-template='{{.id}}'")
+		}
+		if _, err := newTemplate(arg); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid output format: %s (must be one of %s)", o.Format, strings.Join(Formats, ", "))
+	}
+	return nil
+}
+
+// PrintTable writes a list in the selected format
+func (o *Options) PrintTable(w io.Writer, t *Table) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	columns, err := o.selectColumns(t.Columns)
+	if err != nil {
+		return err
+	}
+	rows, err := o.sortRows(t.Columns, t.Rows)
+	if err != nil {
+		return err
+	}
+
+	if o.IsStructured() {
+		items := make([]interface{}, len(rows))
+		for i, row := range rows {
+			items[i] = row.Item
+		}
+		var doc interface{} = items
+		if t.Wrap != nil {
+			doc = t.Wrap(items)
+		}
+		return o.printStructured(w, doc)
+	}
+
+	if len(rows) == 0 {
+		if t.Empty != "" && !o.NoHeaders {
+			fmt.Fprintln(w, t.Empty)
+		}
+		return nil
+	}
+
+	tableColumns := make([]util.TableColumn, len(columns))
+	for i, col := range columns {
+		tableColumns[i] = util.TableColumn{Header: col.Header, Key: col.Key}
+	}
+	data := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		data[i] = row.Cells
+	}
+	util.WriteTable(w, tableColumns, data, o.NoHeaders)
+	return nil
+}
+
+// PrintObject writes a single object in the selected format. text writes the
+// human readable form used by the table formats.
+func (o *Options) PrintObject(w io.Writer, obj interface{}, text func(w io.Writer) error) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	if !o.IsStructured() {
+		return text(w)
+	}
+	return o.printStructured(w, obj)
+}
+
+// PrintStreamItem writes one object of a stream in the selected format. JSON
+// is written compactly, one object per line, and YAML as separate documents.
+func (o *Options) PrintStreamItem(w io.Writer, obj interface{}, text func(w io.Writer) error) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	switch o.Kind() {
+	case FormatTable, FormatWide:
+		return text(w)
+	case FormatJSON:
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal output: %v", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case FormatYAML:
+		if _, err := fmt.Fprintln(w, "---"); err != nil {
+			return err
+		}
+	}
+	return o.printStructured(w, obj)
+}
+
+func (o *Options) printStructured(w io.Writer, doc interface{}) error {
+	_, arg, _ := strings.Cut(o.Format, "=")
+	switch o.Kind() {
+	case FormatJSON:
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal output: %v", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case FormatYAML:
+		generic, err := toGeneric(doc)
+		if err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(generic); err != nil {
+			return fmt.Errorf("failed to marshal output: %v", err)
+		}
+		return enc.Close()
+	case FormatJSONPath:
+		generic, err := toGeneric(doc)
+		if err != nil {
+			return err
+		}
+		path, err := ParseJSONPath(arg)
+		if err != nil {
+			return err
+		}
+		if err := path.Execute(w, generic); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w)
+		return err
+	case FormatGoTemplate:
+		generic, err := toGeneric(doc)
+		if err != nil {
+			return err
+		}
+		tmpl, err := newTemplate(arg)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(w, generic); err != nil {
+			return fmt.Errorf("failed to execute template: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid output format: %s", o.Format)
+}
+
+// selectColumns returns the columns to show: those named with --columns in
+// that order, otherwise all columns, wide ones only with -o wide
+func (o *Options) selectColumns(columns []Column) ([]Column, error) {
+	if len(o.Columns) == 0 {
+		var selected []Column
+		for _, col := range columns {
+			if !col.Wide || o.Kind() == FormatWide {
+				selected = append(selected, col)
+			}
+		}
+		return selected, nil
+	}
+
+	var selected []Column
+	for _, name := range o.Columns {
+		col, err := findColumn(columns, name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, col)
+	}
+	return selected, nil
+}
+
+// sortRows sorts the rows by the --sort-by column, numbers numerically and
+// everything else as text
+func (o *Options) sortRows(columns []Column, rows []Row) ([]Row, error) {
+	if o.SortBy == "" {
+		return rows, nil
+	}
+	col, err := findColumn(columns, o.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]Row, len(rows))
+	copy(sorted, rows)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a := cellText(sorted[i].Cells[col.Key])
+		b := cellText(sorted[j].Cells[col.Key])
+		fa, errA := strconv.ParseFloat(a, 64)
+		fb, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			return fa < fb
+		}
+		return a < b
+	})
+	return sorted, nil
+}
+
+// findColumn looks up a column by key or header, ignoring case
+func findColumn(columns []Column, name string) (Column, error) {
+	normalized := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "-", "_")
+	for _, col := range columns {
+		header := strings.ReplaceAll(strings.ToLower(col.Header), " ", "_")
+		if strings.ToLower(col.Key) == normalized || header == normalized {
+			return col, nil
+		}
+	}
+
+	names := make([]string, 0, len(columns))
+	for _, col := range columns {
+		if strings.TrimSpace(col.Header) != "" {
+			names = append(names, col.Key)
+		}
+	}
+	return Column{}, fmt.Errorf("unknown column %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// cellText returns the text of a cell without ANSI color codes
+func cellText(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return strings.TrimSpace(util.StripANSI(fmt.Sprintf("%v", v)))
+}
+
+// toGeneric converts v to the maps and slices encoding/json decodes into, so
+// templates and YAML see the same field names as JSON
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal output: %v", err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("failed to marshal output: %v", err)
+	}
+	return generic, nil
+}
+
+func newTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"join": func(list []interface{}, sep string) string {
+			parts := make([]string, len(list))
+			for i, item := range list {
+				parts[i] = formatJSONValue(item)
+			}
+			return strings.Join(parts, sep)
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid go-template: %v", err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,138 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBox struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	CPU    int    `json:"cpu"`
+}
+
+func testTable() *Table {
+	boxes := []testBox{
+		{ID: "box-b", Status: "running", CPU: 10},
+		{ID: "box-a", Status: "\x1b[32mstopped\x1b[0m", CPU: 2},
+	}
+	table := &Table{
+		Columns: []Column{
+			{Header: "ID", Key: "id"},
+			{Header: "STATUS", Key: "status"},
+			{Header: "CPU COUNT", Key: "cpu", Wide: true},
+		},
+		Empty: "No boxes found",
+	}
+	for _, b := range boxes {
+		table.Rows = append(table.Rows, Row{
+			Cells: map[string]interface{}{"id": b.ID, "status": b.Status, "cpu": b.CPU},
+			Item:  b,
+		})
+	}
+	return table
+}
+
+func render(t *testing.T, opts Options, table *Table) string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, opts.PrintTable(&buf, table))
+	return buf.String()
+}
+
+func TestPrintTableFormats(t *testing.T) {
+	assert.Equal(t, "ID    STATUS \n----- -------\nbox-b running\nbox-a \x1b[32mstopped\x1b[0m\n",
+		render(t, Options{Format: "table"}, testTable()))
+	assert.Equal(t, "ID    STATUS  CPU COUNT\n----- ------- ---------\nbox-b running 10       \nbox-a \x1b[32mstopped\x1b[0m 2        \n",
+		render(t, Options{Format: "wide"}, testTable()))
+	assert.Equal(t, "box-a\nbox-b\n",
+		render(t, Options{Format: "text", Columns: []string{"id"}, SortBy: "id", NoHeaders: true}, testTable()))
+
+	// Numbers sort numerically and ANSI colors are ignored
+	assert.Equal(t, "2  box-a\n10 box-b\n",
+		render(t, Options{Columns: []string{"cpu-count", "ID"}, SortBy: "cpu", NoHeaders: true}, testTable()))
+	assert.Equal(t, "box-b\nbox-a\n",
+		render(t, Options{Columns: []string{"id"}, SortBy: "status", NoHeaders: true}, testTable()))
+
+	assert.Equal(t, "No boxes found\n", render(t, Options{}, &Table{Empty: "No boxes found"}))
+	assert.Equal(t, "[]\n", render(t, Options{Format: "json"}, &Table{}))
+}
+
+func TestPrintTableStructured(t *testing.T) {
+	assert.Equal(t, "[\n  {\n    \"id\": \"box-a\",\n    \"status\": \"\\u001b[32mstopped\\u001b[0m\",\n    \"cpu\": 2\n  },\n  {\n    \"id\": \"box-b\",\n    \"status\": \"running\",\n    \"cpu\": 10\n  }\n]\n",
+		render(t, Options{Format: "json", SortBy: "id"}, testTable()))
+
+	table := testTable()
+	table.Wrap = func(items []interface{}) interface{} {
+		return map[string]interface{}{"data": items}
+	}
+	assert.Equal(t, "data:\n  - cpu: 10\n    id: box-b\n    status: running\n  - cpu: 2\n    id: box-a\n    status: \"\\e[32mstopped\\e[0m\"\n",
+		render(t, Options{Format: "yaml"}, table))
+	assert.Equal(t, "box-b box-a\n", render(t, Options{Format: "jsonpath={.data[*].id}"}, table))
+	assert.Equal(t, "box-b:10,box-a:2,", render(t, Options{Format: "go-template={{range .data}}{{.id}}:{{.cpu}},{{end}}"}, table))
+}
+
+func TestPrintObject(t *testing.T) {
+	box := testBox{ID: "box-a", Status: "running"}
+	text := func(w io.Writer) error {
+		_, err := io.WriteString(w, "Box box-a\n")
+		return err
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, (&Options{}).PrintObject(&buf, box, text))
+	assert.Equal(t, "Box box-a\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, (&Options{Format: "go-template={{.status | upper}}"}).PrintObject(&buf, box, text))
+	assert.Equal(t, "RUNNING", buf.String())
+}
+
+func TestPrintStreamItem(t *testing.T) {
+	box := testBox{ID: "box-a", Status: "running"}
+	text := func(w io.Writer) error {
+		_, err := io.WriteString(w, "box-a running\n")
+		return err
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, (&Options{Format: "text"}).PrintStreamItem(&buf, box, text))
+	assert.Equal(t, "box-a running\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, (&Options{Format: "json"}).PrintStreamItem(&buf, box, text))
+	require.NoError(t, (&Options{Format: "json"}).PrintStreamItem(&buf, box, text))
+	assert.Equal(t, "{\"id\":\"box-a\",\"status\":\"running\",\"cpu\":0}\n{\"id\":\"box-a\",\"status\":\"running\",\"cpu\":0}\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, (&Options{Format: "yaml"}).PrintStreamItem(&buf, box, text))
+	assert.Equal(t, "---\ncpu: 0\nid: box-a\nstatus: running\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, (&Options{Format: "jsonpath={.id}"}).PrintStreamItem(&buf, box, text))
+	assert.Equal(t, "box-a\n", buf.String())
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for _, format := range []string{"", "text", "table", "wide", "json", "yaml", "jsonpath={.id}", "go-template={{.id}}"} {
+		assert.NoError(t, (&Options{Format: format}).Validate(), format)
+	}
+
+	tests := map[string]string{
+		"xml":              "invalid output format",
+		"json=x":           "takes no argument",
+		"jsonpath=":        "requires a template",
+		"jsonpath={.id":    "unclosed",
+		"go-template={{.x": "invalid go-template",
+	}
+	for format, want := range tests {
+		assert.ErrorContains(t, (&Options{Format: format}).Validate(), want, format)
+	}
+
+	var buf bytes.Buffer
+	assert.ErrorContains(t, (&Options{Columns: []string{"name"}}).PrintTable(&buf, testTable()), `unknown column "name" (available: id, status, cpu)`)
+}
@@ -10,9 +10,12 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/output"
 	"github.com/babelcloud/gbox/packages/cli/internal/util"
 	"github.com/pelletier/go-toml/v2"
 	"github.com/pkg/errors"
@@ -43,6 +46,15 @@ type Profile struct {
 	APIKey  string `toml:"key"`
 	BaseURL string `toml:"base_url,omitempty"`
 	Rack    string `toml:"rack,omtiempty"`
+	// KeyStore names the credential store holding the key, empty when the key
+	// is kept base64 encoded in the profile file itself
+	KeyStore string `toml:"key_store,omitempty"`
+	// KeyID and KeyExpiresAt describe keys created by 'gbox login', so they can
+	// be revoked on logout and reported once expired
+	KeyID        string `toml:"key_id,omitempty"`
+	KeyExpiresAt string `toml:"key_expires_at,omitempty"`
+	// Box holds defaults for 'gbox box create'
+	Box BoxDefaults `toml:"box,omitempty"`
 }
 
 // ProfileDefaults represents global defaults
@@ -65,6 +77,23 @@ type RackInfo struct {
 type ProfileManager struct {
 	config ProfileConfig
 	path   string
+
+	// API keys are held base64 encoded in config like they used to be stored,
+	// and moved to the credential store on save
+	store         SecretStore
+	storeSelected bool
+	// storedKeys holds what each credential store contained on load
+	storedKeys map[string]map[string]string
+	// keysLoaded is set once the stores have been read, which happens the
+	// first time a key is needed rather than on every Load
+	keysLoaded bool
+	// keysErr is set when stored keys could not be loaded; saving is refused
+	// then so the keys are not lost
+	keysErr error
+
+	// project is the .gbox.toml found from the working directory, if any
+	project     *ProjectConfig
+	projectPath string
 }
 
 // Default is the default ProfileManager instance for package-level operations
@@ -106,6 +135,10 @@ func NewProfileManager() *ProfileManager {
 
 // Load loads profiles from file
 func (pm *ProfileManager) Load() error {
+	if err := pm.loadProject(); err != nil {
+		return err
+	}
+
 	if _, err := os.Stat(pm.path); os.IsNotExist(err) {
 		// File doesn't exist, create empty file
 		return pm.Save()
@@ -135,6 +168,10 @@ func (pm *ProfileManager) Load() error {
 		pm.config.Profiles = make(map[string]Profile)
 	}
 
+	// Keys held by credential stores are loaded on first use
+	pm.keysLoaded = false
+	pm.keysErr = nil
+
 	// Set default base URL if not set
 	if pm.config.Defaults.BaseURL == "" {
 		pm.config.Defaults.BaseURL = config.GetBaseURL()
@@ -150,6 +187,12 @@ func (pm *ProfileManager) Load() error {
 
 // Save saves profiles to file
 func (pm *ProfileManager) Save() error {
+	// All keys must be known, the stores are rewritten as a whole
+	pm.loadKeys()
+	if pm.keysErr != nil {
+		return fmt.Errorf("refusing to save profiles, stored API keys could not be loaded: %v", pm.keysErr)
+	}
+
 	if err := os.MkdirAll(filepath.Dir(pm.path), 0o755); err != nil {
 		return fmt.Errorf("failed to create config directory: %v", err)
 	}
@@ -157,6 +200,11 @@ func (pm *ProfileManager) Save() error {
 	// Create a clean config for saving (omit base_url when it matches defaults)
 	cleanConfig := pm.createCleanConfigForSaving()
 
+	// Store keys before writing the profile file so it never refers to missing keys
+	if err := pm.saveStoredKeys(&cleanConfig); err != nil {
+		return err
+	}
+
 	data, err := toml.Marshal(cleanConfig)
 	if err != nil {
 		return fmt.Errorf("failed to serialize profile data: %v", err)
@@ -166,9 +214,182 @@ func (pm *ProfileManager) Save() error {
 		return fmt.Errorf("failed to write profile file: %v", err)
 	}
 
+	pm.clearStaleStores()
 	return nil
 }
 
+// secretStore returns the credential store new keys are saved to, nil for plain storage
+func (pm *ProfileManager) secretStore() (SecretStore, error) {
+	if !pm.storeSelected {
+		store, err := newSecretStore(pm.path)
+		if err != nil {
+			return nil, err
+		}
+		pm.store = store
+		pm.storeSelected = true
+	}
+	return pm.store, nil
+}
+
+// secretStoreName returns the key_store value for keys saved now
+func (pm *ProfileManager) secretStoreName() string {
+	if store, err := pm.secretStore(); err == nil && store != nil {
+		return store.Name()
+	}
+	return ""
+}
+
+// loadKeys loads the keys held by credential stores the first time one is
+// needed, so commands not using a key never touch the system keyring. A store
+// that cannot be read leaves its profiles without a key.
+func (pm *ProfileManager) loadKeys() {
+	if pm.keysLoaded {
+		return
+	}
+	pm.keysLoaded = true
+
+	pm.loadStoredKeys()
+	if pm.keysErr == nil && pm.needsKeyMigration() {
+		pm.performMigration()
+	}
+}
+
+// loadStoredKeys fills in the keys of profiles whose key lives in a credential store
+func (pm *ProfileManager) loadStoredKeys() {
+	pm.storedKeys = make(map[string]map[string]string)
+	pm.keysErr = nil
+	failed := make(map[string]bool)
+
+	for id, profile := range pm.config.Profiles {
+		if profile.KeyStore == "" {
+			continue
+		}
+
+		keys, loaded := pm.storedKeys[profile.KeyStore]
+		if !loaded && !failed[profile.KeyStore] {
+			store, err := secretStoreByName(profile.KeyStore, pm.path)
+			if err == nil {
+				keys, err = store.Load()
+			}
+			if err != nil {
+				pm.keysErr = err
+				failed[profile.KeyStore] = true
+				fmt.Fprintf(os.Stderr, "Warning: failed to load API keys from the %s credential store: %v\n", profile.KeyStore, err)
+			} else {
+				pm.storedKeys[profile.KeyStore] = keys
+			}
+		}
+		if failed[profile.KeyStore] {
+			profile.APIKey = ""
+			pm.config.Profiles[id] = profile
+			continue
+		}
+
+		if key, ok := keys[id]; ok {
+			profile.APIKey = base64.StdEncoding.EncodeToString([]byte(key))
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: API key of profile '%s' is missing from the %s credential store\n", id, profile.KeyStore)
+			profile.APIKey = ""
+		}
+		pm.config.Profiles[id] = profile
+	}
+}
+
+// saveStoredKeys moves the profile keys of cleanConfig into the credential store.
+// If the system keyring cannot be written the encrypted file is used instead.
+func (pm *ProfileManager) saveStoredKeys(cleanConfig *ProfileConfig) error {
+	store, err := pm.secretStore()
+	if err != nil {
+		return err
+	}
+
+	name := ""
+	if store != nil {
+		keys := make(map[string]string)
+		for id, profile := range pm.config.Profiles {
+			if profile.APIKey == "" {
+				continue
+			}
+			key, err := pm.DecodeAPIKey(profile.APIKey)
+			if err != nil {
+				return fmt.Errorf("profile '%s': %v", id, err)
+			}
+			keys[id] = key
+		}
+
+		if !equalKeys(keys, pm.storedKeys[store.Name()]) {
+			if err := store.Save(keys); err != nil {
+				if store.Name() != SecretStoreKeyring {
+					return fmt.Errorf("failed to save API keys: %v", err)
+				}
+				fmt.Fprintf(os.Stderr, "Warning: %v, using the encrypted credentials file instead\n", err)
+				store = newFileSecretStore(pm.path)
+				pm.store = store
+				if err := store.Save(keys); err != nil {
+					return fmt.Errorf("failed to save API keys: %v", err)
+				}
+			}
+			pm.storedKeys[store.Name()] = keys
+		}
+		name = store.Name()
+	}
+
+	for id, profile := range cleanConfig.Profiles {
+		if profile.APIKey != "" && name != "" {
+			profile.APIKey = ""
+			profile.KeyStore = name
+		}
+		cleanConfig.Profiles[id] = profile
+
+		current := pm.config.Profiles[id]
+		current.KeyStore = profile.KeyStore
+		pm.config.Profiles[id] = current
+	}
+	return nil
+}
+
+// clearStaleStores removes keys left in credential stores no longer in use
+func (pm *ProfileManager) clearStaleStores() {
+	current := pm.secretStoreName()
+	for name, keys := range pm.storedKeys {
+		if name == current || len(keys) == 0 {
+			continue
+		}
+		store, err := secretStoreByName(name, pm.path)
+		if err == nil {
+			err = store.Clear()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove API keys from the %s credential store: %v\n", name, err)
+			continue
+		}
+		pm.storedKeys[name] = nil
+	}
+}
+
+// needsKeyMigration checks if any key is not held by the selected credential store
+func (pm *ProfileManager) needsKeyMigration() bool {
+	name := pm.secretStoreName()
+	for _, profile := range pm.config.Profiles {
+		if profile.APIKey != "" && profile.KeyStore != name {
+			return true
+		}
+	}
+	return false
+}
+
+func equalKeys(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
 // createCleanConfigForSaving creates a clean config structure for saving
 // that omits base_url fields when they match the default value
 func (pm *ProfileManager) createCleanConfigForSaving() ProfileConfig {
@@ -185,6 +406,15 @@ func (pm *ProfileManager) createCleanConfigForSaving() ProfileConfig {
 			Org:     profile.Org,
 			OrgSlug: profile.OrgSlug,
 			APIKey:  profile.APIKey,
+			Box:     profile.Box,
+
+			KeyID:        profile.KeyID,
+			KeyExpiresAt: profile.KeyExpiresAt,
+		}
+
+		// Keys of profiles whose key could not be loaded stay where they are
+		if profile.APIKey == "" {
+			cleanProfile.KeyStore = profile.KeyStore
 		}
 
 		// Only include base_url if it's different from defaults
@@ -198,29 +428,10 @@ func (pm *ProfileManager) createCleanConfigForSaving() ProfileConfig {
 	return cleanConfig
 }
 
-// List lists all profiles
-func (pm *ProfileManager) List(format string) {
-	if len(pm.config.Profiles) == 0 {
-		if format == "json" {
-			fmt.Println("[]")
-		} else {
-			fmt.Println("No profiles found")
-		}
-		return
-	}
+// List displays profiles in the selected output format
+func (pm *ProfileManager) List(opts *output.Options) error {
+	pm.loadKeys()
 
-	// Handle JSON format
-	if format == "json" {
-		pm.listJSON()
-		return
-	}
-
-	// Default to table format
-	pm.listTable()
-}
-
-// listTable displays profiles in table format
-func (pm *ProfileManager) listTable() {
 	// Check if any profile has a non-default base URL
 	showBaseURL := false
 	for _, profile := range pm.config.Profiles {
@@ -230,25 +441,28 @@ func (pm *ProfileManager) listTable() {
 		}
 	}
 
-	// Prepare data for RenderTable with sorted order
-	profileIDs := make([]string, 0, len(pm.config.Profiles))
-	for id := range pm.config.Profiles {
-		profileIDs = append(profileIDs, id)
+	table := &output.Table{
+		Columns: []output.Column{
+			{Header: " ", Key: "arrow"},
+			{Header: "ID", Key: "id"},
+			{Header: "Key", Key: "key"},
+			{Header: "Organization", Key: "org"},
+			{Header: "Base URL", Key: "base_url", Wide: !showBaseURL},
+			{Header: "Org Slug", Key: "org_slug", Wide: true},
+		},
+		Empty: "No profiles found",
 	}
 
 	// Sort profile IDs to maintain consistent order
-	for i := 0; i < len(profileIDs); i++ {
-		for j := i + 1; j < len(profileIDs); j++ {
-			if profileIDs[i] > profileIDs[j] {
-				profileIDs[i], profileIDs[j] = profileIDs[j], profileIDs[i]
-			}
-		}
+	profileIDs := make([]string, 0, len(pm.config.Profiles))
+	for id := range pm.config.Profiles {
+		profileIDs = append(profileIDs, id)
 	}
+	sort.Strings(profileIDs)
 
-	tableData := make([]map[string]interface{}, len(profileIDs))
-	for i, id := range profileIDs {
+	for _, id := range profileIDs {
 		profile := pm.config.Profiles[id]
-		isCurrent := id == pm.config.Current
+		isCurrent := id == pm.GetCurrentProfileID()
 		maskedKey := pm.GetMaskedAPIKey(profile.APIKey)
 
 		// Format arrow and ID separately
@@ -257,50 +471,46 @@ func (pm *ProfileManager) listTable() {
 			arrow = "\033[32m→\033[0m" // Just the arrow
 		}
 
-		row := map[string]interface{}{
-			"arrow": arrow,
-			"id":    id,
-			"key":   maskedKey,
-			"org":   profile.GetOrgName(),
+		baseURL := profile.BaseURL
+		if baseURL == "" {
+			baseURL = pm.config.Defaults.BaseURL + " (default)"
 		}
 
-		if showBaseURL {
-			baseURL := profile.BaseURL
-			if baseURL == "" {
-				baseURL = pm.config.Defaults.BaseURL + " (default)"
-			}
-			row["base_url"] = baseURL
+		item := map[string]interface{}{
+			"id":      id,
+			"org":     profile.GetOrgName(),
+			"key":     maskedKey,
+			"current": isCurrent,
 		}
-
-		tableData[i] = row
-	}
-
-	// Define table columns
-	var columns []util.TableColumn
-	if showBaseURL {
-		columns = []util.TableColumn{
-			{Header: " ", Key: "arrow"},
-			{Header: "ID", Key: "id"},
-			{Header: "Key", Key: "key"},
-			{Header: "Organization", Key: "org"},
-			{Header: "Base URL", Key: "base_url"},
+		// Include org_slug if available
+		if profile.OrgSlug != "" {
+			item["org_slug"] = profile.OrgSlug
 		}
-	} else {
-		columns = []util.TableColumn{
-			{Header: " ", Key: "arrow"},
-			{Header: "ID", Key: "id"},
-			{Header: "Key", Key: "key"},
-			{Header: "Organization", Key: "org"},
+		// Only include base_url if it's different from default
+		if profile.BaseURL != "" && profile.BaseURL != pm.config.Defaults.BaseURL {
+			item["base_url"] = profile.BaseURL
 		}
+
+		table.Rows = append(table.Rows, output.Row{
+			Cells: map[string]interface{}{
+				"arrow":    arrow,
+				"id":       id,
+				"key":      maskedKey,
+				"org":      profile.GetOrgName(),
+				"base_url": baseURL,
+				"org_slug": profile.OrgSlug,
+			},
+			Item: item,
+		})
 	}
 
-	// Add indentation prefix
-	fmt.Print("  ")
-	util.RenderTable(columns, tableData)
+	return opts.PrintTable(os.Stdout, table)
 }
 
 // ListTableForSelection displays profiles in table format for selection (used in profile use command)
 func (pm *ProfileManager) ListTableForSelection() {
+	pm.loadKeys()
+
 	// Prepare data for RenderTable with sorted order
 	profileIDs := make([]string, 0, len(pm.config.Profiles))
 	for id := range pm.config.Profiles {
@@ -319,7 +529,7 @@ func (pm *ProfileManager) ListTableForSelection() {
 	tableData := make([]map[string]interface{}, len(profileIDs))
 	for i, id := range profileIDs {
 		profile := pm.config.Profiles[id]
-		isCurrent := id == pm.config.Current
+		isCurrent := id == pm.GetCurrentProfileID()
 		maskedKey := pm.GetMaskedAPIKey(profile.APIKey)
 
 		// Format arrow and ID separately
@@ -351,6 +561,8 @@ func (pm *ProfileManager) ListTableForSelection() {
 
 // Add adds a new profile
 func (pm *ProfileManager) Add(id, org, key, baseURL string) error {
+	pm.loadKeys()
+
 	// Determine base URL with priority: provided baseURL > config default
 	if baseURL == "" {
 		baseURL = config.GetBaseURL()
@@ -456,6 +668,8 @@ func (pm *ProfileManager) Add(id, org, key, baseURL string) error {
 
 	// Override existing profile if same org and base URL combination exists
 	if existingProfileID != "" {
+		// Keep the box defaults the user set for the profile
+		profile.Box = pm.config.Profiles[existingProfileID].Box
 		pm.config.Profiles[existingProfileID] = profile
 		// Always set as current when overriding
 		pm.config.Current = existingProfileID
@@ -529,13 +743,42 @@ func (pm *ProfileManager) Remove(id string) error {
 	return pm.Save()
 }
 
-// GetCurrent gets the current profile with default values filled in
+// RemoveAndSwitch removes a profile. If it is the current profile, another
+// profile becomes current.
+func (pm *ProfileManager) RemoveAndSwitch(id string) error {
+	if _, exists := pm.config.Profiles[id]; !exists {
+		return fmt.Errorf(ErrProfileNotFound, id)
+	}
+
+	delete(pm.config.Profiles, id)
+	if pm.config.Current == id {
+		pm.config.Current = ""
+		ids := pm.GetProfileIDs()
+		sort.Strings(ids)
+		if len(ids) > 0 {
+			pm.config.Current = ids[0]
+		}
+	}
+
+	return pm.Save()
+}
+
+// GetCurrent gets the profile in effect with default values filled in. It is
+// selected by GBOX_PROFILE, the project file or the current profile, see Selection.
 func (pm *ProfileManager) GetCurrent() *Profile {
-	if pm.config.Current == "" {
+	pm.loadKeys()
+	return pm.current()
+}
+
+// current is GetCurrent without loading keys from the credential stores, for
+// callers that only need the other profile settings
+func (pm *ProfileManager) current() *Profile {
+	id := pm.GetCurrentProfileID()
+	if id == "" {
 		return nil
 	}
 
-	if profile, exists := pm.config.Profiles[pm.config.Current]; exists {
+	if profile, exists := pm.config.Profiles[id]; exists {
 		// Create a copy to prevent external modification
 		profileCopy := profile
 		// Fill in default values if not set
@@ -549,6 +792,7 @@ func (pm *ProfileManager) GetCurrent() *Profile {
 
 // GetProfile gets a specific profile by ID
 func (pm *ProfileManager) GetProfile(id string) *Profile {
+	pm.loadKeys()
 	if profile, exists := pm.config.Profiles[id]; exists {
 		// Return a copy to prevent external modification
 		profileCopy := profile
@@ -568,6 +812,7 @@ func (p *Profile) GetOrgName() string {
 
 // GetProfiles returns a copy of all profiles to prevent external modification
 func (pm *ProfileManager) GetProfiles() map[string]Profile {
+	pm.loadKeys()
 	profiles := make(map[string]Profile, len(pm.config.Profiles))
 	for id, profile := range pm.config.Profiles {
 		profiles[id] = profile
@@ -579,12 +824,15 @@ func (pm *ProfileManager) GetProfiles() map[string]Profile {
 func (pm *ProfileManager) GetCurrentAPIKey() (string, error) {
 	current := pm.GetCurrent()
 	if current == nil {
-		return "", errors.New(ErrNoCurrentProfile)
+		return "", pm.noCurrentProfileError()
 	}
 
 	if current.APIKey == "" {
 		return "", errors.New(ErrNoAPIKey)
 	}
+	if err := pm.checkKeyExpiry(current); err != nil {
+		return "", err
+	}
 
 	return pm.DecodeAPIKey(current.APIKey)
 }
@@ -617,14 +865,56 @@ func (pm *ProfileManager) GetMaskedAPIKey(encodedKey string) string {
 	return maskAPIKey(decodedKey)
 }
 
-// GetCurrentProfileID gets the current profile ID
+// noCurrentProfileError explains why no profile is in effect
+func (pm *ProfileManager) noCurrentProfileError() error {
+	if sel := pm.Selection(); sel.ID != "" {
+		return fmt.Errorf("profile '%s' selected by %s not found", sel.ID, sel.Describe())
+	}
+	return errors.New(ErrNoCurrentProfile)
+}
+
+// checkKeyExpiry returns an error telling how to re-authenticate when the key
+// of a profile has expired
+func (pm *ProfileManager) checkKeyExpiry(p *Profile) error {
+	if p.KeyExpiresAt == "" {
+		return nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, p.KeyExpiresAt)
+	if err != nil || time.Now().Before(expiresAt) {
+		return nil
+	}
+	return fmt.Errorf("the API key of profile '%s' expired at %s, run 'gbox login' or 'gbox profile add' to authenticate again",
+		pm.GetCurrentProfileID(), expiresAt.Local().Format(time.RFC1123))
+}
+
+// RecordAPIKey stores the ID and expiry of a key created by login on the
+// profile holding it, and returns the ID of that profile
+func (pm *ProfileManager) RecordAPIKey(key, keyID string, expiresAt time.Time) (string, error) {
+	pm.loadKeys()
+	encodedKey := base64.StdEncoding.EncodeToString([]byte(key))
+	for id, profile := range pm.config.Profiles {
+		if profile.APIKey != encodedKey {
+			continue
+		}
+		profile.KeyID = keyID
+		profile.KeyExpiresAt = ""
+		if !expiresAt.IsZero() {
+			profile.KeyExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		}
+		pm.config.Profiles[id] = profile
+		return id, pm.Save()
+	}
+	return "", fmt.Errorf("no profile holds the API key")
+}
+
+// GetCurrentProfileID gets the ID of the profile in effect
 func (pm *ProfileManager) GetCurrentProfileID() string {
-	return pm.config.Current
+	return pm.Selection().ID
 }
 
 // HasCurrentProfile checks if a current profile is set
 func (pm *ProfileManager) HasCurrentProfile() bool {
-	return pm.config.Current != "" && pm.GetCurrent() != nil
+	return pm.current() != nil
 }
 
 // GetProfileCount returns the number of profiles
@@ -663,7 +953,7 @@ func (pm *ProfileManager) checkConfigurationMismatch() {
 		return
 	}
 
-	current := pm.GetCurrent()
+	current := pm.current()
 	if current == nil {
 		return
 	}
@@ -701,7 +991,7 @@ func (pm *ProfileManager) GetEffectiveBaseURL() string {
 	} else {
 		// Second priority: current profile's base URL
 		// Get effective base URL from current profile (includes profile defaults)
-		current := pm.GetCurrent()
+		current := pm.current()
 		if current != nil {
 			baseURL = current.BaseURL
 		} else {
@@ -725,12 +1015,15 @@ func (pm *ProfileManager) GetEffectiveAPIKey() (string, error) {
 	// Second priority: current profile's API key
 	current := pm.GetCurrent()
 	if current == nil {
-		return "", errors.New(ErrNoCurrentProfile)
+		return "", pm.noCurrentProfileError()
 	}
 
 	if current.APIKey == "" {
 		return "", errors.New(ErrNoAPIKey)
 	}
+	if err := pm.checkKeyExpiry(current); err != nil {
+		return "", err
+	}
 
 	// Decode profile API key (it's base64-encoded at rest)
 	return pm.DecodeAPIKey(current.APIKey)
@@ -761,36 +1054,6 @@ func normalizeID(id string) string {
 	return normalized
 }
 
-// listJSON displays profiles in JSON format
-func (pm *ProfileManager) listJSON() {
-	// Create a slice to hold profile data
-	profiles := make([]map[string]interface{}, 0, len(pm.config.Profiles))
-
-	for id, profile := range pm.config.Profiles {
-		profileData := map[string]interface{}{
-			"id":      id,
-			"org":     profile.GetOrgName(),
-			"key":     pm.GetMaskedAPIKey(profile.APIKey),
-			"current": id == pm.config.Current,
-		}
-
-		// Include org_slug if available
-		if profile.OrgSlug != "" {
-			profileData["org_slug"] = profile.OrgSlug
-		}
-
-		// Only include base_url if it's different from default
-		if profile.BaseURL != "" && profile.BaseURL != pm.config.Defaults.BaseURL {
-			profileData["base_url"] = profile.BaseURL
-		}
-
-		profiles = append(profiles, profileData)
-	}
-
-	// Output JSON
-	fmt.Printf("%s\n", toJSON(profiles))
-}
-
 // maskAPIKey masks an API key for display
 func maskAPIKey(key string) string {
 	if len(key) <= 8 {
@@ -799,15 +1062,6 @@ func maskAPIKey(key string) string {
 	return key[:10] + "****" + key[len(key)-4:]
 }
 
-// toJSON converts data to JSON string
-func toJSON(data interface{}) string {
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return "{}"
-	}
-	return string(jsonData)
-}
-
 // getOrgInfoFromAPI tries to get organization info from API using the provided API key
 // Returns OrgInfo and error. If error is nil, the API key is valid.
 func (pm *ProfileManager) getOrgInfoFromAPI(apiKey, baseURL string) (*OrgInfo, error) {
@@ -924,9 +1178,9 @@ func (pm *ProfileManager) getRackInfoFromAPI(apiKey, baseURL string) (*RackInfo,
 
 // GetDevicesURL returns the devices URL for the current profile
 func (pm *ProfileManager) GetDevicesURL() (string, error) {
-	current := pm.GetCurrent()
+	current := pm.current()
 	if current == nil {
-		return "", errors.New(ErrNoCurrentProfile)
+		return "", pm.noCurrentProfileError()
 	}
 
 	devicesURL := pm.buildDevicesURL(current)
@@ -939,12 +1193,12 @@ func (pm *ProfileManager) GetDevicesURL() (string, error) {
 
 // GetDevicesURLByID returns the devices URL for a specific profile by ID
 func (pm *ProfileManager) GetDevicesURLByID(id string) (string, error) {
-	profile := pm.GetProfile(id)
-	if profile == nil {
+	profile, exists := pm.config.Profiles[id]
+	if !exists {
 		return "", fmt.Errorf(ErrProfileNotFound, id)
 	}
 
-	devicesURL := pm.buildDevicesURL(profile)
+	devicesURL := pm.buildDevicesURL(&profile)
 	if devicesURL == "" {
 		return "", fmt.Errorf("profile '%s' does not have org_slug. Please run 'gbox profile add' to update your profile", id)
 	}
@@ -973,8 +1227,13 @@ func (pm *ProfileManager) buildDevicesURL(profile *Profile) string {
 	return ""
 }
 
-// needsMigration checks if any base URLs need to be migrated to the new format
+// needsMigration checks if any base URLs need to be migrated to the new format,
+// or API keys need to be moved to the credential store
 func (pm *ProfileManager) needsMigration() bool {
+	if pm.needsKeyMigration() {
+		return true
+	}
+
 	// Check defaults.base_url
 	if pm.needsURLMigration(pm.config.Defaults.BaseURL) {
 		return true
@@ -1003,9 +1262,13 @@ func (pm *ProfileManager) needsURLMigration(url string) bool {
 	return !strings.HasSuffix(cleanURL, "/api/v1")
 }
 
-// performMigration migrates all base URLs from old format to new format
+// performMigration migrates all base URLs from old format to new format and
+// moves API keys into the selected credential store
 func (pm *ProfileManager) performMigration() {
+	// Saving needs all keys, which may complete a key migration on its own
+	pm.loadKeys()
 	migrated := false
+	keysMigrated := pm.needsKeyMigration()
 
 	// Migrate defaults.base_url
 	if pm.needsURLMigration(pm.config.Defaults.BaseURL) {
@@ -1023,12 +1286,21 @@ func (pm *ProfileManager) performMigration() {
 	}
 
 	// Save the migrated configuration
-	if migrated {
+	if migrated || keysMigrated {
 		if err := pm.Save(); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to save migrated configuration: %v\n", err)
-		} else {
+			return
+		}
+		if migrated {
 			fmt.Fprintf(os.Stderr, "Info: migrated base URLs to new format\n")
 		}
+		if keysMigrated {
+			if name := pm.secretStoreName(); name != "" {
+				fmt.Fprintf(os.Stderr, "Info: moved API keys to the %s credential store\n", name)
+			} else {
+				fmt.Fprintf(os.Stderr, "Info: moved API keys back into %s\n", pm.path)
+			}
+		}
 	}
 }
 
@@ -0,0 +1,63 @@
+package profile
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyExpiry(t *testing.T) {
+	t.Setenv("GBOX_PROFILE", "")
+	t.Setenv("GBOX_CREDENTIAL_STORE", "plain")
+	t.Chdir(t.TempDir())
+	path := filepath.Join(t.TempDir(), "profiles.toml")
+	encode := func(key string) string { return base64.StdEncoding.EncodeToString([]byte(key)) }
+	config := "current = 'ci'\n\n" +
+		"[profiles.ci]\norg_name = 'acme'\nkey = '" + encode("gbox_ci_key") + "'\nbase_url = 'https://example.com/api/v1'\n\n" +
+		"[profiles.dev]\norg_name = 'acme-dev'\nkey = '" + encode("gbox_dev_key") + "'\nbase_url = 'https://example.com/api/v1'\n"
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+
+	load := func() *ProfileManager {
+		pm := NewProfileManager()
+		pm.path = path
+		require.NoError(t, pm.Load())
+		return pm
+	}
+
+	pm := load()
+	id, err := pm.RecordAPIKey("gbox_ci_key", "key_123", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "ci", id)
+	_, err = pm.RecordAPIKey("unknown", "key_456", time.Time{})
+	assert.Error(t, err)
+
+	pm = load()
+	assert.Equal(t, "key_123", pm.GetCurrent().KeyID)
+	key, err := pm.GetCurrentAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "gbox_ci_key", key)
+
+	// An expired key asks the user to authenticate again
+	_, err = pm.RecordAPIKey("gbox_ci_key", "key_123", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	pm = load()
+	_, err = pm.GetCurrentAPIKey()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "API key of profile 'ci' expired")
+	assert.Contains(t, err.Error(), "gbox login")
+	_, err = pm.GetEffectiveAPIKey()
+	assert.Error(t, err)
+
+	// Removing the current profile switches to another one
+	require.NoError(t, pm.RemoveAndSwitch("ci"))
+	pm = load()
+	assert.Equal(t, "dev", pm.GetCurrentProfileID())
+	assert.False(t, pm.ProfileExists("ci"))
+	require.NoError(t, pm.RemoveAndSwitch("dev"))
+	assert.Equal(t, 0, load().GetProfileCount())
+}
@@ -0,0 +1,161 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ProjectFileName is the project file selecting a profile for a directory tree
+const ProjectFileName = ".gbox.toml"
+
+// Sources a profile can be selected by, in order of precedence
+const (
+	SourceEnv     = "env"     // GBOX_PROFILE environment variable
+	SourceProject = "project" // profile in the nearest .gbox.toml
+	SourceCurrent = "current" // current in profiles.toml, set by 'gbox profile use'
+)
+
+// BoxDefaults are default values for 'gbox box create', set per profile and
+// optionally overlaid by the project file
+type BoxDefaults struct {
+	Labels     map[string]string `toml:"labels,omitempty"`
+	ExpiresIn  string            `toml:"expires_in,omitempty"`
+	DeviceType string            `toml:"device_type,omitempty"`
+}
+
+// IsEmpty reports whether no default is set
+func (d BoxDefaults) IsEmpty() bool {
+	return len(d.Labels) == 0 && d.ExpiresIn == "" && d.DeviceType == ""
+}
+
+// overlay returns d with the values set in o taking precedence
+func (d BoxDefaults) overlay(o BoxDefaults) BoxDefaults {
+	merged := BoxDefaults{
+		ExpiresIn:  d.ExpiresIn,
+		DeviceType: d.DeviceType,
+	}
+	if o.ExpiresIn != "" {
+		merged.ExpiresIn = o.ExpiresIn
+	}
+	if o.DeviceType != "" {
+		merged.DeviceType = o.DeviceType
+	}
+	if len(d.Labels)+len(o.Labels) > 0 {
+		merged.Labels = make(map[string]string, len(d.Labels)+len(o.Labels))
+		for k, v := range d.Labels {
+			merged.Labels[k] = v
+		}
+		for k, v := range o.Labels {
+			merged.Labels[k] = v
+		}
+	}
+	return merged
+}
+
+// ProjectConfig is the content of a .gbox.toml project file
+type ProjectConfig struct {
+	Profile string      `toml:"profile,omitempty"`
+	Box     BoxDefaults `toml:"box,omitempty"`
+}
+
+// Selection describes which profile is in effect and what selected it
+type Selection struct {
+	ID     string
+	Source string
+	// Path of the project file when selected by it
+	Path string
+}
+
+// Describe explains the selection for display
+func (s Selection) Describe() string {
+	switch s.Source {
+	case SourceEnv:
+		return "GBOX_PROFILE environment variable"
+	case SourceProject:
+		return fmt.Sprintf("project file %s", s.Path)
+	default:
+		return "current profile in profiles.toml (gbox profile use)"
+	}
+}
+
+// findProjectFile looks for a project file in dir and its parents
+func findProjectFile(dir string) string {
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadProject loads the project file for the working directory, if any
+func (pm *ProfileManager) loadProject() error {
+	pm.project = nil
+	pm.projectPath = ""
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	path := findProjectFile(wd)
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read project file: %v", err)
+	}
+	var project ProjectConfig
+	if err := toml.Unmarshal(data, &project); err != nil {
+		return fmt.Errorf("failed to parse project file %s: %v", path, err)
+	}
+
+	pm.project = &project
+	pm.projectPath = path
+	return nil
+}
+
+// Selection returns the profile in effect with precedence
+// GBOX_PROFILE > project file > current
+func (pm *ProfileManager) Selection() Selection {
+	if id := os.Getenv("GBOX_PROFILE"); id != "" {
+		return Selection{ID: id, Source: SourceEnv}
+	}
+	if pm.project != nil && pm.project.Profile != "" {
+		return Selection{ID: pm.project.Profile, Source: SourceProject, Path: pm.projectPath}
+	}
+	return Selection{ID: pm.config.Current, Source: SourceCurrent}
+}
+
+// GetBoxDefaults returns the box defaults of the current profile overlaid by
+// the project file
+func (pm *ProfileManager) GetBoxDefaults() BoxDefaults {
+	var defaults BoxDefaults
+	if current := pm.current(); current != nil {
+		defaults = current.Box
+	}
+	if pm.project != nil {
+		defaults = defaults.overlay(pm.project.Box)
+	}
+	return defaults
+}
+
+// SetBoxDefaults replaces the box defaults of a profile
+func (pm *ProfileManager) SetBoxDefaults(id string, defaults BoxDefaults) error {
+	profile, exists := pm.config.Profiles[id]
+	if !exists {
+		return fmt.Errorf(ErrProfileNotFound, id)
+	}
+	profile.Box = defaults
+	pm.config.Profiles[id] = profile
+	return pm.Save()
+}
@@ -0,0 +1,109 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileSelection(t *testing.T) {
+	t.Setenv("GBOX_PROFILE", "")
+	t.Setenv("GBOX_CREDENTIAL_STORE", "plain")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profiles.toml")
+	config := `current = 'default'
+
+[profiles.default]
+org_name = 'acme'
+base_url = 'https://example.com/api/v1'
+
+[profiles.default.box]
+expires_in = '30m'
+labels = { team = 'qa', owner = 'ci' }
+
+[profiles.staging]
+org_name = 'acme-staging'
+base_url = 'https://example.com/api/v1'
+`
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+
+	project := filepath.Join(dir, "project")
+	nested := filepath.Join(project, "src", "app")
+	require.NoError(t, os.MkdirAll(nested, 0o755))
+	t.Chdir(nested)
+
+	load := func() *ProfileManager {
+		pm := NewProfileManager()
+		pm.path = path
+		require.NoError(t, pm.Load())
+		return pm
+	}
+
+	// Without project file or env the current profile is used
+	pm := load()
+	assert.Equal(t, Selection{ID: "default", Source: SourceCurrent}, pm.Selection())
+	assert.Equal(t, BoxDefaults{ExpiresIn: "30m", Labels: map[string]string{"team": "qa", "owner": "ci"}}, pm.GetBoxDefaults())
+
+	// The nearest project file in a parent directory takes precedence
+	projectFile := filepath.Join(project, ProjectFileName)
+	require.NoError(t, os.WriteFile(projectFile, []byte("profile = 'staging'\n"), 0o644))
+	pm = load()
+	sel := pm.Selection()
+	assert.Equal(t, "staging", sel.ID)
+	assert.Equal(t, SourceProject, sel.Source)
+	assert.Contains(t, sel.Describe(), ProjectFileName)
+	assert.Equal(t, "acme-staging", pm.GetCurrent().GetOrgName())
+	assert.True(t, pm.GetBoxDefaults().IsEmpty())
+
+	// GBOX_PROFILE overrides the project file
+	t.Setenv("GBOX_PROFILE", "default")
+	pm = load()
+	assert.Equal(t, Selection{ID: "default", Source: SourceEnv}, pm.Selection())
+
+	// Unknown profiles are reported with their source
+	t.Setenv("GBOX_PROFILE", "missing")
+	pm = load()
+	assert.Nil(t, pm.GetCurrent())
+	_, err := pm.GetCurrentAPIKey()
+	assert.ErrorContains(t, err, "GBOX_PROFILE")
+}
+
+func TestProjectBoxDefaultsOverlay(t *testing.T) {
+	t.Setenv("GBOX_PROFILE", "")
+	t.Setenv("GBOX_CREDENTIAL_STORE", "plain")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profiles.toml")
+	config := `current = 'default'
+
+[profiles.default]
+org_name = 'acme'
+
+[profiles.default.box]
+expires_in = '30m'
+device_type = 'virtual'
+labels = { team = 'qa', owner = 'ci' }
+`
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ProjectFileName), []byte("[box]\nexpires_in = '2h'\nlabels = { team = 'dev' }\n"), 0o644))
+	t.Chdir(dir)
+
+	pm := NewProfileManager()
+	pm.path = path
+	require.NoError(t, pm.Load())
+
+	assert.Equal(t, SourceCurrent, pm.Selection().Source)
+	assert.Equal(t, BoxDefaults{
+		ExpiresIn:  "2h",
+		DeviceType: "virtual",
+		Labels:     map[string]string{"team": "dev", "owner": "ci"},
+	}, pm.GetBoxDefaults())
+
+	// Clearing the defaults leaves no empty box table behind
+	require.NoError(t, pm.SetBoxDefaults("default", BoxDefaults{}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "[profiles.default.box]")
+}
@@ -0,0 +1,76 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credential store names, also recorded per profile in profiles.toml as key_store
+const (
+	SecretStoreKeyring = "keyring"
+	SecretStoreFile    = "file"
+	// SecretStorePlain keeps base64 encoded keys in profiles.toml (legacy behaviour)
+	SecretStorePlain = "plain"
+)
+
+// SecretStore persists the API keys of all profiles outside of profiles.toml.
+// Keys are loaded and saved as a whole, mapping profile ID to the plain API key,
+// so a command touches the backend at most once.
+type SecretStore interface {
+	// Name returns the name recorded in profiles.toml for keys held by this store
+	Name() string
+	// Load returns all stored keys, an empty map if nothing has been stored yet
+	Load() (map[string]string, error)
+	// Save replaces all stored keys
+	Save(keys map[string]string) error
+	// Clear removes all stored keys
+	Clear() error
+}
+
+// newSecretStore selects the credential store for the profile file at
+// profilePath. GBOX_CREDENTIAL_STORE selects a store explicitly, otherwise the
+// system keyring is used when available with the encrypted file as fallback.
+// A nil store means keys are kept in profiles.toml.
+func newSecretStore(profilePath string) (SecretStore, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("GBOX_CREDENTIAL_STORE")))
+	switch name {
+	case "":
+		if keyring := newKeyringSecretStore(profilePath); keyring != nil {
+			return keyring, nil
+		}
+		return newFileSecretStore(profilePath), nil
+	case SecretStoreKeyring:
+		if keyring := newKeyringSecretStore(profilePath); keyring != nil {
+			return keyring, nil
+		}
+		return nil, fmt.Errorf("no system keyring available (needs secret-tool with a D-Bus session on Linux or security on macOS)")
+	case SecretStoreFile:
+		return newFileSecretStore(profilePath), nil
+	case SecretStorePlain:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown credential store %q (must be keyring, file or plain)", name)
+	}
+}
+
+// secretStoreByName returns the store a profile's key was saved to
+func secretStoreByName(name, profilePath string) (SecretStore, error) {
+	switch name {
+	case SecretStoreKeyring:
+		if keyring := newKeyringSecretStore(profilePath); keyring != nil {
+			return keyring, nil
+		}
+		return nil, fmt.Errorf("API keys are stored in the system keyring, but no keyring is available")
+	case SecretStoreFile:
+		return newFileSecretStore(profilePath), nil
+	default:
+		return nil, fmt.Errorf("unknown credential store %q", name)
+	}
+}
+
+// credentialsPath returns the path of a credentials file next to the profile file
+func credentialsPath(profilePath, name string) string {
+	return filepath.Join(filepath.Dir(profilePath), name)
+}
@@ -0,0 +1,253 @@
+package profile
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/util"
+)
+
+const (
+	credentialsFileName    = "credentials.enc"
+	credentialsKeyFileName = "credentials.key"
+	credentialsFileVersion = 1
+	credentialsIterations  = 100000
+
+	// Key sources recorded in the credentials file
+	keySourcePassphrase = "passphrase"
+	keySourceMachine    = "machine"
+)
+
+// credentialsAAD binds the ciphertext to this file format
+var credentialsAAD = []byte("gbox-credentials-v1")
+
+// fileSecretStore keeps the keys in an AES-GCM encrypted file next to
+// profiles.toml. The encryption key is derived from GBOX_CREDENTIALS_PASSPHRASE
+// when set, otherwise from the machine ID and user name, so the file is useless
+// when copied elsewhere, e.g. into a dotfile repo.
+type fileSecretStore struct {
+	path    string
+	keyPath string
+}
+
+// credentialsFile is the on-disk format of the encrypted credentials
+type credentialsFile struct {
+	Version    int    `json:"version"`
+	KeySource  string `json:"key_source"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func newFileSecretStore(profilePath string) *fileSecretStore {
+	return &fileSecretStore{
+		path:    credentialsPath(profilePath, credentialsFileName),
+		keyPath: credentialsPath(profilePath, credentialsKeyFileName),
+	}
+}
+
+func (s *fileSecretStore) Name() string {
+	return SecretStoreFile
+}
+
+func (s *fileSecretStore) Load() (map[string]string, error) {
+	raw, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %v", err)
+	}
+
+	var file credentialsFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file %s: %v", s.path, err)
+	}
+	if file.Version != credentialsFileVersion {
+		return nil, fmt.Errorf("unsupported credentials file version %d", file.Version)
+	}
+
+	secret, err := s.keyMaterial(file.KeySource, false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newCredentialsCipher(secret, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, credentialsAAD)
+	if err != nil {
+		if file.KeySource == keySourcePassphrase {
+			return nil, fmt.Errorf("failed to decrypt credentials: wrong GBOX_CREDENTIALS_PASSPHRASE")
+		}
+		return nil, fmt.Errorf("failed to decrypt credentials: the file was created on another machine or by another user")
+	}
+
+	keys := map[string]string{}
+	if err := json.Unmarshal(plain, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode credentials: %v", err)
+	}
+	return keys, nil
+}
+
+func (s *fileSecretStore) Save(keys map[string]string) error {
+	if len(keys) == 0 {
+		return s.Clear()
+	}
+
+	plain, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %v", err)
+	}
+
+	source := keySourceMachine
+	if os.Getenv("GBOX_CREDENTIALS_PASSPHRASE") != "" {
+		source = keySourcePassphrase
+	}
+	secret, err := s.keyMaterial(source, true)
+	if err != nil {
+		return err
+	}
+
+	file := credentialsFile{
+		Version:    credentialsFileVersion,
+		KeySource:  source,
+		KDF:        "pbkdf2-sha256",
+		Iterations: credentialsIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %v", err)
+	}
+	gcm, err := newCredentialsCipher(secret, file.Salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, credentialsAAD)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials file: %v", err)
+	}
+	return util.WriteFileAtomic(s.path, data)
+}
+
+func (s *fileSecretStore) Clear() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove credentials file: %v", err)
+	}
+	return nil
+}
+
+// keyMaterial returns the secret the encryption key is derived from
+func (s *fileSecretStore) keyMaterial(source string, create bool) (string, error) {
+	switch source {
+	case keySourcePassphrase:
+		passphrase := os.Getenv("GBOX_CREDENTIALS_PASSPHRASE")
+		if passphrase == "" {
+			return "", fmt.Errorf("credentials are protected by a passphrase, set GBOX_CREDENTIALS_PASSPHRASE")
+		}
+		return passphrase, nil
+	case keySourceMachine:
+		id, err := s.machineID(create)
+		if err != nil {
+			return "", err
+		}
+		username := ""
+		if u, err := user.Current(); err == nil {
+			username = u.Uid + ":" + u.Username
+		}
+		return id + "\x00" + username, nil
+	default:
+		return "", fmt.Errorf("unknown credentials key source %q", source)
+	}
+}
+
+// machineID returns a stable identifier of this machine. Without one a random
+// key file readable only by the user is used instead.
+func (s *fileSecretStore) machineID(create bool) (string, error) {
+	if id := systemMachineID(); id != "" {
+		return id, nil
+	}
+
+	data, err := os.ReadFile(s.keyPath)
+	if err == nil && len(data) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !create {
+		return "", fmt.Errorf("failed to read credentials key %s: %v", s.keyPath, err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate credentials key: %v", err)
+	}
+	id := fmt.Sprintf("%x", key)
+	if err := util.WriteFileAtomic(s.keyPath, []byte(id)); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+var ioregUUIDPattern = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+
+// systemMachineID reads the operating system's machine identifier
+func systemMachineID() string {
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err != nil {
+			return ""
+		}
+		if m := ioregUUIDPattern.FindSubmatch(out); m != nil {
+			return string(m[1])
+		}
+	case "windows":
+		out, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+		if err != nil {
+			return ""
+		}
+		fields := strings.Fields(string(out))
+		if len(fields) > 0 {
+			return fields[len(fields)-1]
+		}
+	default:
+		for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+			if data, err := os.ReadFile(path); err == nil {
+				if id := strings.TrimSpace(string(data)); id != "" {
+					return id
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func newCredentialsCipher(secret string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, secret, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive credentials key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
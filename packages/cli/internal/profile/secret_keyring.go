@@ -0,0 +1,149 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keyringService is the service name gbox items are stored under
+const keyringService = "gbox-cli"
+
+// keyringSecretStore keeps all keys in a single system keyring item. It drives
+// the platform tools (secret-tool for the Secret Service on Linux, security for
+// the macOS keychain) so no cgo or D-Bus bindings are needed.
+type keyringSecretStore struct {
+	// account distinguishes items of different profile files
+	account string
+}
+
+// newKeyringSecretStore returns nil when no supported keyring is available
+func newKeyringSecretStore(profilePath string) *keyringSecretStore {
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		// secret-tool needs a session bus to reach the Secret Service
+		if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+			return nil
+		}
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return nil
+		}
+	case "darwin":
+		if _, err := exec.LookPath("security"); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &keyringSecretStore{account: profilePath}
+}
+
+func (s *keyringSecretStore) Name() string {
+	return SecretStoreKeyring
+}
+
+func (s *keyringSecretStore) Load() (map[string]string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", s.account, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", s.account)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if isKeyringNotFound(err, stderr.String()) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read keyring: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return decodeKeyringPayload(strings.TrimSpace(string(out)))
+}
+
+func (s *keyringSecretStore) Save(keys map[string]string) error {
+	if len(keys) == 0 {
+		return s.Clear()
+	}
+
+	payload, err := encodeKeyringPayload(keys)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// Use the interactive mode so the secret does not show up in the process list
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %q -l %q -w %s\n",
+			keyringService, s.account, "gbox CLI credentials", payload))
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label=gbox CLI credentials", "service", keyringService, "account", s.account)
+		cmd.Stdin = strings.NewReader(payload)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write keyring: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (s *keyringSecretStore) Clear() error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", s.account)
+	} else {
+		cmd = exec.Command("secret-tool", "clear", "service", keyringService, "account", s.account)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil && !isKeyringNotFound(err, string(out)) {
+		return fmt.Errorf("failed to clear keyring: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// isKeyringNotFound reports whether the keyring tool failed because the item does not exist
+func isKeyringNotFound(err error, output string) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	if runtime.GOOS == "darwin" {
+		// security exits with errSecItemNotFound (44) for missing items
+		return exitErr.ExitCode() == 44
+	}
+	// secret-tool exits with 1 and no output when nothing matches
+	return exitErr.ExitCode() == 1 && strings.TrimSpace(output) == ""
+}
+
+// The item holds the keys as base64 encoded JSON, which needs no quoting on
+// the security command line
+func encodeKeyringPayload(keys map[string]string) (string, error) {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode credentials: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func decodeKeyringPayload(payload string) (map[string]string, error) {
+	keys := map[string]string{}
+	if payload == "" {
+		return keys, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode keyring item: %v", err)
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode keyring item: %v", err)
+	}
+	return keys, nil
+}
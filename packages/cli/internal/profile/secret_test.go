@@ -0,0 +1,129 @@
+package profile
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSecretStoreRoundTrip(t *testing.T) {
+	t.Setenv("GBOX_CREDENTIALS_PASSPHRASE", "")
+	store := newFileSecretStore(filepath.Join(t.TempDir(), "profiles.toml"))
+
+	keys, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	require.NoError(t, store.Save(map[string]string{"default": "gbox_secret_key"}))
+	raw, err := os.ReadFile(store.path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "gbox_secret_key")
+
+	info, err := os.Stat(store.path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	keys, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"default": "gbox_secret_key"}, keys)
+
+	require.NoError(t, store.Clear())
+	_, err = os.Stat(store.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileSecretStorePassphrase(t *testing.T) {
+	store := newFileSecretStore(filepath.Join(t.TempDir(), "profiles.toml"))
+
+	t.Setenv("GBOX_CREDENTIALS_PASSPHRASE", "correct horse")
+	require.NoError(t, store.Save(map[string]string{"default": "gbox_secret_key"}))
+	keys, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "gbox_secret_key", keys["default"])
+
+	t.Setenv("GBOX_CREDENTIALS_PASSPHRASE", "wrong")
+	_, err = store.Load()
+	assert.ErrorContains(t, err, "wrong GBOX_CREDENTIALS_PASSPHRASE")
+
+	t.Setenv("GBOX_CREDENTIALS_PASSPHRASE", "")
+	_, err = store.Load()
+	assert.ErrorContains(t, err, "set GBOX_CREDENTIALS_PASSPHRASE")
+}
+
+func TestProfileKeyMigration(t *testing.T) {
+	t.Setenv("GBOX_CREDENTIALS_PASSPHRASE", "")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profiles.toml")
+	encoded := base64.StdEncoding.EncodeToString([]byte("gbox_secret_key"))
+	legacy := "current = 'default'\n\n[profiles.default]\norg_name = 'acme'\nkey = '" + encoded + "'\nbase_url = 'https://example.com/api/v1'\n"
+	require.NoError(t, os.WriteFile(path, []byte(legacy), 0o600))
+
+	load := func() *ProfileManager {
+		pm := NewProfileManager()
+		pm.path = path
+		require.NoError(t, pm.Load())
+		return pm
+	}
+
+	// Legacy base64 keys move to the encrypted file on load
+	t.Setenv("GBOX_CREDENTIAL_STORE", "file")
+	pm := load()
+	key, err := pm.GetCurrentAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "gbox_secret_key", key)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), encoded)
+	assert.Contains(t, string(data), "key_store = 'file'")
+	assert.FileExists(t, filepath.Join(dir, credentialsFileName))
+
+	// Keys are read back transparently and profile commands keep working
+	pm = load()
+	key, err = pm.GetCurrentAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "gbox_secret_key", key)
+	assert.Equal(t, "gbox_secre****_key", pm.GetMaskedAPIKey(pm.GetCurrent().APIKey))
+	require.NoError(t, pm.Use("default"))
+
+	// Switching back to plain storage restores the legacy format
+	t.Setenv("GBOX_CREDENTIAL_STORE", "plain")
+	pm = load()
+	key, err = pm.GetCurrentAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "gbox_secret_key", key)
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), encoded))
+	assert.NoFileExists(t, filepath.Join(dir, credentialsFileName))
+}
+
+func TestProfileKeysLoadedLazily(t *testing.T) {
+	t.Setenv("GBOX_PROFILE", "")
+	t.Setenv("GBOX_CREDENTIAL_STORE", "file")
+	t.Chdir(t.TempDir())
+	path := filepath.Join(t.TempDir(), "profiles.toml")
+	config := "current = 'default'\n\n[profiles.default]\norg_name = 'acme'\nkey = ''\nkey_store = 'vault'\nbase_url = 'https://example.com/api/v1'\n"
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+
+	// An unreadable store does not fail loading, nor is it read for settings
+	pm := NewProfileManager()
+	pm.path = path
+	require.NoError(t, pm.Load())
+	assert.False(t, pm.keysLoaded)
+	assert.Equal(t, "https://example.com/api/v1", pm.GetEffectiveBaseURL())
+	assert.True(t, pm.HasCurrentProfile())
+	assert.False(t, pm.keysLoaded)
+
+	// Needing the key degrades to a missing key, and saving is refused
+	_, err := pm.GetCurrentAPIKey()
+	assert.EqualError(t, err, ErrNoAPIKey)
+	assert.True(t, pm.keysLoaded)
+	assert.Error(t, pm.Save())
+}
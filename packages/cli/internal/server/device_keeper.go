@@ -2,20 +2,27 @@ package server
 
 import (
 	"crypto/tls"
+	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
 	"github.com/babelcloud/gbox/packages/cli/internal/cloud"
 	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
 	"github.com/babelcloud/gbox/packages/cli/internal/server/handlers"
 	adb "github.com/basiooo/goadb"
 	"github.com/dchest/uniuri"
@@ -37,18 +44,9 @@ type deviceInfo struct {
 	ExpiresAt time.Time           // Expiration time
 }
 
-// reconnectState tracks the reconnection state for a device
-type reconnectState struct {
-	IsReconnecting bool
-	Attempt        int
-	MaxRetry       int
-	Serial         string
-	DeviceId       string
-	DisconnectedAt time.Time // When the device was disconnected
-}
-
 type DeviceKeeper struct {
 	adbClient     *adb.Adb
+	adbServer     adbserver.Endpoint
 	deviceWatcher *adb.DeviceWatcher
 
 	adbDeviceBiMap *bimap.BiMap[string, string]
@@ -67,40 +65,124 @@ type DeviceKeeper struct {
 	reconnectStates map[string]*reconnectState
 	reconnectMu     sync.RWMutex
 
+	// Global reconnect policy, devices may override it in the registry
+	policy device.ReconnectPolicy
+	// Time source, jitter and connect call of reconnect loops, replaced in tests
+	clock     clock
+	jitter    func() float64
+	reconnect func(serial, deviceId, deviceType, osType string) error
+
+	// Registered devices and their last-known state, kept across restarts
+	registry *device.Registry
+
+	// Health checks of Android devices, keyed by adb serial. Reading the
+	// vitals and marking devices unavailable in the cloud are replaced in tests.
+	adb          *adbserver.Client
+	thresholds   device.HealthThresholds
+	readHealth   func(serial string) (*device.Health, error)
+	setAvailable func(deviceId string, available bool, reason string) error
+	healthStates map[string]*healthState
+	healthMu     sync.RWMutex
+
+	// setLabels pushes the labels of a device to the cloud, replaced in tests
+	setLabels func(deviceId string, labels map[string]string) error
+
+	// Leases of shared devices, swept when they expire
+	leases *device.Leases
+
+	// Wireless debugging devices found with mDNS, keyed by instance name
+	wirelessStates map[string]*wirelessState
+	wirelessMu     sync.Mutex
+
+	// localOnly keeps devices away from the cloud: they are served locally but
+	// never registered or connected to access points
+	localOnly bool
+
+	// done is closed when the keeper is closed
+	done chan struct{}
+
+	// Devices connected to the local adb server through adb-expose
+	// Key is adb serial (host:port), value is box ID
+	exposedDevices map[string]string
+	exposedMu      sync.RWMutex
+
 	mu         sync.RWMutex
 	deviceLock keymutex.KeyMutex
 }
 
 func NewDeviceKeeper() (*DeviceKeeper, error) {
-	adbClient, err := adb.NewWithConfig(adb.ServerConfig{
-		Port: adb.AdbPort,
-	})
+	adbServer := adbserver.Default()
+	adbClient, err := adb.NewWithConfig(adbServer.ServerConfig())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create adb client for %s", adbServer.Addr())
+	}
+	registry, err := device.OpenRegistry(device.DefaultRegistryPath(config.GetGboxHome()))
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	leases, err := device.OpenLeases(device.DefaultLeasesPath(config.GetGboxHome()), time.Now)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to create adb client on port %d", adb.AdbPort)
+		log.Printf("Warning: %v", err)
 	}
-	return &DeviceKeeper{
+	android := device.NewManager("android").(*device.AndroidManager)
+	deviceAPI := cloud.NewDeviceAPI()
+	dm := &DeviceKeeper{
 		adbClient:       adbClient,
+		adbServer:       adbServer,
 		adbDeviceBiMap:  bimap.NewBiMap[string, string](),
 		deviceSessions:  NewDeviceMap(),
-		deviceAPI:       cloud.NewDeviceAPI(),
+		deviceAPI:       deviceAPI,
 		apAPI:           cloud.NewAccessPointAPI(),
 		deviceInfoCache: make(map[string]*deviceInfo),
 		reconnectStates: make(map[string]*reconnectState),
+		policy:          globalReconnectPolicy(),
+		clock:           realClock{},
+		jitter:          rand.Float64,
+		registry:        registry,
+		adb:             adbserver.NewClient(adbServer),
+		thresholds:      globalHealthThresholds(),
+		readHealth:      android.GetHealth,
+		setAvailable:    deviceAPI.SetAvailable,
+		healthStates:    make(map[string]*healthState),
+		setLabels:       deviceAPI.SetLabels,
+		leases:          leases,
+		wirelessStates:  make(map[string]*wirelessState),
+		localOnly:       config.GetLocalOnly(),
+		done:            make(chan struct{}),
+		exposedDevices:  make(map[string]string),
 		deviceLock:      keymutex.NewHashed(10000),
-	}, nil
+	}
+	dm.reconnect = dm.connectAPUsingDeviceId
+	return dm, nil
 }
 
 func (dm *DeviceKeeper) Start() error {
-	if err := dm.adbClient.StartServer(); err != nil {
-		return errors.Wrapf(err, "failed to start ")
+	// A remote adb server is run by its host, gbox can only start a local one
+	if dm.adbServer.IsLocal() {
+		if err := dm.adbClient.StartServer(); err != nil {
+			return errors.Wrapf(err, "failed to start ")
+		}
+	} else {
+		log.Printf("Using remote adb server at %s", dm.adbServer.Addr())
+	}
+	if dm.localOnly {
+		log.Print("Running in local-only mode, devices are not connected to the cloud")
 	}
 
 	dm.deviceWatcher = dm.adbClient.NewDeviceWatcher()
 	go func() {
 		for event := range dm.deviceWatcher.C() {
 			log.Printf("device event: %s %s -> %s", event.Serial, event.OldState, event.NewState)
+			events.Publish(events.DeviceState, event.Serial, map[string]interface{}{
+				"old_state": event.OldState.String(),
+				"new_state": event.NewState.String(),
+			})
 			switch event.NewState {
 			case adb.StateOnline:
+				// A local-only server has no access point to connect to
+				if dm.localOnly {
+					break
+				}
 				go func() {
 					defer func() {
 						if r := recover(); r != nil {
@@ -124,6 +206,11 @@ func (dm *DeviceKeeper) Start() error {
 						log.Print(errors.Wrapf(err, "failed to disconnect device %s from access point", event.Serial))
 					}
 				}()
+
+			case adb.StateDisconnected:
+				if strings.HasPrefix(event.Serial, "emulator-") {
+					go dm.forgetEmulator(event.Serial)
+				}
 			}
 		}
 		if dm.deviceWatcher.Err() != nil {
@@ -132,24 +219,86 @@ func (dm *DeviceKeeper) Start() error {
 	}()
 
 	// Reconnect all registered devices (both Android and desktop)
-	go func() {
-		// Give adb watcher some time to detect online devices first
-		time.Sleep(2 * time.Second)
-		if err := dm.ReconnectRegisteredDevices(); err != nil {
-			log.Printf("Failed to reconnect registered devices: %v", err)
-		}
-	}()
+	if !dm.localOnly {
+		go func() {
+			// Give adb watcher some time to detect online devices first
+			time.Sleep(2 * time.Second)
+			if err := dm.ReconnectRegisteredDevices(); err != nil {
+				log.Printf("Failed to reconnect registered devices: %v", err)
+			}
+		}()
+	}
 
 	// Start periodic cleanup and health check tasks
 	go dm.startPeriodicCleanup()
+	go dm.startHealthChecks(config.GetHealthInterval())
+	go dm.startWirelessDiscovery(config.GetWirelessInterval())
+	go dm.startLeaseExpiry(leaseExpiryInterval)
 
 	return nil
 }
 
 func (dm *DeviceKeeper) Close() {
+	select {
+	case <-dm.done:
+	default:
+		close(dm.done)
+	}
 	if dm.deviceWatcher != nil {
 		dm.deviceWatcher.Shutdown()
 	}
+	if dm.registry != nil {
+		dm.registry.Flush()
+	}
+}
+
+// ConnectExposedDevice runs `adb connect host:port` against the local adb server
+// and records the resulting device as belonging to the given box.
+// Returns the adb serial of the connected device.
+func (dm *DeviceKeeper) ConnectExposedDevice(boxID, host string, port int) (string, error) {
+	serial := net.JoinHostPort(host, strconv.Itoa(port))
+
+	conn, err := dm.adbClient.Dial()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to dial adb server")
+	}
+	defer conn.Close()
+
+	// adb replies OKAY even when the connection fails, the reason is in the payload
+	resp, err := conn.RoundTripSingleResponse([]byte(fmt.Sprintf("host:connect:%s", serial)))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to connect adb to %s", serial)
+	}
+	msg := strings.TrimSpace(string(resp))
+	if strings.HasPrefix(msg, "failed") || strings.HasPrefix(msg, "cannot") || strings.HasPrefix(msg, "unable") {
+		return "", errors.Errorf("failed to connect adb to %s: %s", serial, msg)
+	}
+
+	dm.exposedMu.Lock()
+	dm.exposedDevices[serial] = boxID
+	dm.exposedMu.Unlock()
+
+	log.Printf("box %s: adb connected to %s (%s)", boxID, serial, msg)
+	return serial, nil
+}
+
+// DisconnectExposedDevice runs `adb disconnect serial` and forgets the box association
+func (dm *DeviceKeeper) DisconnectExposedDevice(serial string) error {
+	dm.exposedMu.Lock()
+	delete(dm.exposedDevices, serial)
+	dm.exposedMu.Unlock()
+
+	if err := dm.adbClient.Disconnect(serial); err != nil {
+		return errors.Wrapf(err, "failed to disconnect adb from %s", serial)
+	}
+	return nil
+}
+
+// GetExposedBoxID returns the box ID of a device connected through adb-expose, or empty string
+func (dm *DeviceKeeper) GetExposedBoxID(serial string) string {
+	dm.exposedMu.RLock()
+	defer dm.exposedMu.RUnlock()
+	return dm.exposedDevices[serial]
 }
 
 // deviceToReconnect represents a device that needs to be reconnected
@@ -192,7 +341,9 @@ func (dm *DeviceKeeper) startPeriodicCleanup() {
 			dm.cleanupDisconnectedDevices()
 			dm.CleanupExpiredDeviceInfos()
 		case <-healthCheckTicker.C:
-			dm.healthCheckAndReconnect()
+			if !dm.localOnly {
+				dm.healthCheckAndReconnect()
+			}
 		}
 	}
 }
@@ -250,6 +401,11 @@ func (dm *DeviceKeeper) collectDevicesToReconnect(checkReconnecting bool) ([]dev
 				continue
 			}
 
+			// Quarantined devices are reconnected once they recover
+			if dm.IsQuarantined(adbDev.ID) {
+				continue
+			}
+
 			// Check if device is currently reconnecting (only if checkReconnecting is true)
 			if checkReconnecting {
 				dm.reconnectMu.RLock()
@@ -371,7 +527,7 @@ func (dm *DeviceKeeper) checkConnectedDevicesHealth() {
 
 			// Trigger reconnection if we have deviceId
 			if deviceId != "" {
-				go dm.reconnectDeviceWithBackoff(serial, session, deviceId)
+				go dm.reconnectDevice(serial, deviceId, session.DeviceType, session.OsType, false)
 			}
 			continue
 		}
@@ -385,7 +541,7 @@ func (dm *DeviceKeeper) checkConnectedDevicesHealth() {
 
 			// Trigger reconnection
 			if deviceId != "" {
-				go dm.reconnectDeviceWithBackoff(serial, session, deviceId)
+				go dm.reconnectDevice(serial, deviceId, session.DeviceType, session.OsType, false)
 			}
 		}
 	}
@@ -486,6 +642,9 @@ func (dm *DeviceKeeper) getAdbSerialByGboxDeviceId(deviceId string) string {
 }
 
 func (dm *DeviceKeeper) connectAP(serial string) error {
+	if dm.localOnly {
+		return errors.Wrapf(device.ErrLocalOnly, "failed to connect device %s", serial)
+	}
 	devMgr := device.NewManager("android")
 	ids, err := devMgr.GetIdentifiers(serial)
 	var deviceList *cloud.DeviceList
@@ -554,11 +713,18 @@ func (dm *DeviceKeeper) resolveAndroidSessionKey(key string) string {
 // For Android (mobile), the session key is resolved to the ADB server device id (e.g. emulator-5554) so deviceSessions and adbDeviceBiMap use the same id as adb.
 // deviceType and osType are stored for device type-specific handling.
 func (dm *DeviceKeeper) connectAPUsingDeviceId(key string, deviceId string, deviceType string, osType string) error {
+	if dm.localOnly {
+		return errors.Wrapf(device.ErrLocalOnly, "failed to connect device %s", key)
+	}
 	sessionKey := key
 	if deviceType == "mobile" {
 		sessionKey = dm.resolveAndroidSessionKey(key)
 	}
 
+	if dm.IsQuarantined(sessionKey) {
+		return errors.Wrapf(device.ErrQuarantined, "failed to connect device %s", sessionKey)
+	}
+
 	dm.deviceLock.LockKey(sessionKey)
 	defer dm.deviceLock.UnlockKey(sessionKey)
 
@@ -592,7 +758,6 @@ func (dm *DeviceKeeper) connectAPUsingDeviceId(key string, deviceId string, devi
 		DeviceType:       deviceType,
 		OsType:           osType,
 		ReconnectAttempt: 0,
-		MaxReconnect:     5, // Maximum 5 reconnection attempts
 		LastError:        nil,
 	}, deviceId)
 
@@ -607,6 +772,27 @@ func (dm *DeviceKeeper) connectAPUsingDeviceId(key string, deviceId string, devi
 	}
 	dm.updateDeviceInfo(dto)
 
+	entry := device.RegistryEntry{
+		DeviceID:      deviceId,
+		Serial:        sessionKey,
+		DeviceType:    deviceType,
+		OsType:        osType,
+		Profile:       profile.Default.GetCurrentProfileID(),
+		State:         device.StateConnected,
+		LastConnected: time.Now(),
+	}
+	if deviceType != "mobile" {
+		// Desktop sessions are always this machine
+		entry.RegID = dm.getLocalRegId()
+	}
+	dm.registry.Put(entry)
+
+	events.Publish(events.APConnected, sessionKey, map[string]interface{}{
+		"device_id":   deviceId,
+		"device_type": deviceType,
+		"os_type":     osType,
+	})
+
 	go dm.processDeviceSession(session, sessionKey)
 	return nil
 }
@@ -631,20 +817,26 @@ func (dm *DeviceKeeper) disconnectAPForce(serial string) error {
 			if session.Mux != nil {
 				session.Mux.Close()
 			}
-			dm.delDevice(session)
+			if dm.delDevice(session) {
+				events.Publish(events.APDisconnected, serial, map[string]interface{}{
+					"reason": "disconnected",
+				})
+			}
 		}
 	}
 
+	dm.registry.SetState(serial, device.StateDisconnected)
+
 	// For physical disconnection (device offline), clean up immediately
 	// This is different from connection loss which triggers reconnection
 	dm.mu.Lock()
 	dm.adbDeviceBiMap.Delete(serial)
 	dm.mu.Unlock()
 
-	// Clean up reconnect state if exists
-	dm.reconnectMu.Lock()
-	delete(dm.reconnectStates, serial)
-	dm.reconnectMu.Unlock()
+	// Stop reconnecting unless the policy keeps retrying offline devices
+	if dm.ReconnectPolicy(serial).CancelOnOffline {
+		dm.cancelReconnect(serial, "device offline")
+	}
 
 	return nil
 }
@@ -657,15 +849,29 @@ func (dm *DeviceKeeper) unregisterDevice(serial string) error {
 		return err
 	}
 
+	dm.cancelReconnect(serial, "unregistered")
+
 	// Clean up device info cache
 	dm.infoCacheMu.Lock()
 	delete(dm.deviceInfoCache, serial)
 	dm.infoCacheMu.Unlock()
 
+	dm.registry.Remove(serial)
+
 	log.Printf("device %s: unregistered and cleaned up all mappings", serial)
 	return nil
 }
 
+// forgetEmulator cleans up after an emulator that left adb, stopped or
+// crashed. Its serial goes to whichever AVD boots on the port next, so it
+// is dropped from the registry; the emulator stays registered in the cloud
+// and is connected again when it boots.
+func (dm *DeviceKeeper) forgetEmulator(serial string) {
+	if err := dm.unregisterDevice(serial); err != nil {
+		log.Print(errors.Wrapf(err, "failed to clean up emulator %s", serial))
+	}
+}
+
 func (dm *DeviceKeeper) getDevice(serial string) (*DeviceSession, bool) {
 	dm.mu.RLock()
 	defer dm.mu.RUnlock()
@@ -785,11 +991,26 @@ func (dm *DeviceKeeper) CleanupExpiredDeviceInfos() {
 func (dm *DeviceKeeper) ReconnectRegisteredDevices() error {
 	log.Printf("Attempting to reconnect registered device(s) with matching reg_id")
 
+	// Devices known from the registry reconnect right away, without listing
+	// devices in the cloud or reading reg_ids over adb
+	restored := dm.restoreFromRegistry()
+
 	// Collect devices that need to be reconnected (don't check reconnecting state on startup)
 	devicesToReconnect, err := dm.collectDevicesToReconnect(false)
 	if err != nil {
+		if len(restored) > 0 {
+			log.Printf("Failed to list registered devices, restored %d device(s) from the registry: %v", len(restored), err)
+			return nil
+		}
 		return errors.Wrap(err, "failed to collect devices to reconnect")
 	}
+	pending := devicesToReconnect[:0]
+	for _, dev := range devicesToReconnect {
+		if !restored[dev.serialno] {
+			pending = append(pending, dev)
+		}
+	}
+	devicesToReconnect = pending
 
 	if len(devicesToReconnect) == 0 {
 		log.Printf("No devices to reconnect")
@@ -811,6 +1032,69 @@ func (dm *DeviceKeeper) ReconnectRegisteredDevices() error {
 	return nil
 }
 
+// restoreFromRegistry reconnects the registered devices of the current profile
+// that are present now: Android devices the adb server lists and this
+// machine. It returns the session keys being reconnected.
+func (dm *DeviceKeeper) restoreFromRegistry() map[string]bool {
+	restored := make(map[string]bool)
+	entries := dm.registry.List()
+	if len(entries) == 0 {
+		return restored
+	}
+
+	online := make(map[string]bool)
+	if serials, err := dm.adbClient.ListDeviceSerials(); err == nil {
+		for _, serial := range serials {
+			online[serial] = true
+		}
+	}
+	localRegId := dm.getLocalRegId()
+	currentProfile := profile.Default.GetCurrentProfileID()
+
+	for _, e := range entries {
+		if e.Profile != "" && currentProfile != "" && e.Profile != currentProfile {
+			continue
+		}
+		if dm.IsDeviceConnected(e.Serial) {
+			continue
+		}
+		if e.DeviceType == "mobile" {
+			if !online[e.Serial] {
+				continue
+			}
+		} else if e.RegID == "" || e.RegID != localRegId {
+			continue
+		}
+
+		restored[e.Serial] = true
+		log.Printf("Restoring device %s (%s) from the registry", e.DeviceID, e.Serial)
+		go func(e device.RegistryEntry) {
+			if err := dm.connectAPUsingDeviceId(e.Serial, e.DeviceID, e.DeviceType, e.OsType); err != nil {
+				log.Printf("Failed to restore device %s: %v", e.DeviceID, err)
+			}
+		}(e)
+	}
+	return restored
+}
+
+// RegisteredDevices returns the devices in the registry
+func (dm *DeviceKeeper) RegisteredDevices() []device.RegistryEntry {
+	return dm.registry.List()
+}
+
+// RecordRegisteredDevice adds what the cloud reports about a registered device to the registry
+func (dm *DeviceKeeper) RecordRegisteredDevice(entry device.RegistryEntry) {
+	if entry.Profile == "" {
+		entry.Profile = profile.Default.GetCurrentProfileID()
+	}
+	dm.registry.Put(entry)
+}
+
+// ForgetDevice removes an unregistered device from the registry
+func (dm *DeviceKeeper) ForgetDevice(key string) {
+	dm.registry.Remove(key)
+}
+
 func connectAP(url, token, protocol, serial string) (*smux.Session, error) {
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
@@ -876,8 +1160,14 @@ func (dm *DeviceKeeper) processDeviceSession(session *DeviceSession, serial stri
 					return
 				}
 
-				// Start reconnection with exponential backoff
-				go dm.reconnectDeviceWithBackoff(serial, session, deviceId)
+				events.Publish(events.APDisconnected, serial, map[string]interface{}{
+					"device_id": deviceId,
+					"reason":    "session closed",
+					"error":     err.Error(),
+				})
+
+				// Start reconnection under the device's reconnect policy
+				go dm.reconnectDevice(serial, deviceId, session.DeviceType, session.OsType, false)
 				return
 			} else {
 				log.Printf("device %s: session closed and device not registered, stopping", serial)
@@ -889,141 +1179,6 @@ func (dm *DeviceKeeper) processDeviceSession(session *DeviceSession, serial stri
 	}
 }
 
-// reconnectDeviceWithBackoff attempts to reconnect a device with exponential backoff
-// deviceId is passed in to avoid race condition with bimap
-func (dm *DeviceKeeper) reconnectDeviceWithBackoff(serial string, oldSession *DeviceSession, deviceId string) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("recovered from reconnectDeviceWithBackoff for device %s: %v", serial, r)
-		}
-	}()
-
-	if deviceId == "" {
-		log.Printf("device %s: empty device ID for reconnection", serial)
-		return
-	}
-
-	maxAttempts := oldSession.MaxReconnect
-	if maxAttempts <= 0 {
-		maxAttempts = 5
-	}
-
-	// Create and store reconnection state
-	dm.setReconnectState(serial, &reconnectState{
-		IsReconnecting: true,
-		Attempt:        0,
-		MaxRetry:       maxAttempts,
-		Serial:         serial,
-		DeviceId:       deviceId,
-		DisconnectedAt: time.Now(),
-	})
-	defer dm.removeReconnectState(serial)
-
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		// Update reconnection attempt count
-		dm.updateReconnectAttempt(serial, attempt)
-
-		// Calculate backoff delay: 2^attempt seconds, capped at 60 seconds
-		backoffSeconds := 1 << uint(attempt) // 2, 4, 8, 16, 32...
-		if backoffSeconds > 60 {
-			backoffSeconds = 60
-		}
-		backoffDuration := time.Duration(backoffSeconds) * time.Second
-
-		log.Printf("device %s: reconnection attempt %d/%d (waiting %v)...", serial, attempt, maxAttempts, backoffDuration)
-		time.Sleep(backoffDuration)
-
-		// Try to reconnect
-		err := dm.connectAPUsingDeviceId(serial, deviceId, oldSession.DeviceType, oldSession.OsType)
-		if err == nil {
-			log.Printf("device %s: reconnection successful on attempt %d", serial, attempt)
-			return
-		}
-
-		log.Printf("device %s: reconnection attempt %d/%d failed: %v", serial, attempt, maxAttempts, err)
-	}
-
-	// Max attempts reached - mark as disconnected permanently
-	log.Printf("device %s: max reconnection attempts (%d) reached, marking as disconnected", serial, maxAttempts)
-
-	// Keep the state to show "Disconnected" status, don't remove it
-	dm.reconnectMu.Lock()
-	if state, ok := dm.reconnectStates[serial]; ok {
-		state.IsReconnecting = false
-		state.Attempt = maxAttempts
-	}
-	dm.reconnectMu.Unlock()
-
-	// Schedule cleanup of bimap entry after a grace period (5 minutes)
-	// This allows user to see "Disconnected" status for a while
-	go func() {
-		gracePeriod := 5 * time.Minute
-		log.Printf("device %s: will clean up mapping after %v grace period", serial, gracePeriod)
-		time.Sleep(gracePeriod)
-
-		// Check if device has reconnected during grace period
-		if !dm.IsDeviceConnected(serial) {
-			dm.mu.Lock()
-			dm.adbDeviceBiMap.Delete(serial)
-			dm.mu.Unlock()
-
-			// Also clean up reconnect state
-			dm.reconnectMu.Lock()
-			delete(dm.reconnectStates, serial)
-			dm.reconnectMu.Unlock()
-
-			log.Printf("device %s: cleaned up mapping and reconnect state after grace period", serial)
-		}
-	}()
-}
-
-// setReconnectState sets the reconnection state for a device
-func (dm *DeviceKeeper) setReconnectState(serial string, state *reconnectState) {
-	dm.reconnectMu.Lock()
-	defer dm.reconnectMu.Unlock()
-	dm.reconnectStates[serial] = state
-}
-
-// updateReconnectAttempt updates the current reconnection attempt count
-func (dm *DeviceKeeper) updateReconnectAttempt(serial string, attempt int) {
-	dm.reconnectMu.Lock()
-	defer dm.reconnectMu.Unlock()
-	if state, ok := dm.reconnectStates[serial]; ok {
-		state.Attempt = attempt
-	}
-}
-
-// removeReconnectState removes the reconnection state for a device
-// Only call this when reconnection succeeds
-func (dm *DeviceKeeper) removeReconnectState(serial string) {
-	dm.reconnectMu.Lock()
-	defer dm.reconnectMu.Unlock()
-	// Only remove if not at max retries (success case)
-	if state, ok := dm.reconnectStates[serial]; ok && state.Attempt < state.MaxRetry {
-		delete(dm.reconnectStates, serial)
-	}
-}
-
-// getReconnectState gets the reconnection state for a device
-// Returns a map to avoid exposing internal reconnectState struct
-func (dm *DeviceKeeper) getReconnectState(serial string) map[string]interface{} {
-	dm.reconnectMu.RLock()
-	defer dm.reconnectMu.RUnlock()
-
-	state, ok := dm.reconnectStates[serial]
-	if !ok {
-		return nil
-	}
-
-	return map[string]interface{}{
-		"isReconnecting": state.IsReconnecting,
-		"attempt":        state.Attempt,
-		"maxRetry":       state.MaxRetry,
-		"serial":         state.Serial,
-		"deviceId":       state.DeviceId,
-	}
-}
-
 func processSessionStream(stream *smux.Stream, serial string) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -1094,7 +1249,6 @@ type DeviceSession struct {
 	DeviceType       string // mobile or desktop
 	OsType           string // android, linux, windows, macos
 	ReconnectAttempt int    // Current reconnection attempt count
-	MaxReconnect     int    // Maximum reconnection attempts (default: 5)
 	LastError        error  // Last connection error
 }
 
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// drainTracker counts in-flight requests so that a server being replaced can
+// let device streams and control sessions finish before it exits
+type drainTracker struct {
+	mu       sync.Mutex
+	active   int
+	draining bool
+}
+
+// untracked reports whether a request neither counts as activity nor is
+// refused while draining: lifecycle and health probes, and the event stream
+// which clients resume on their own
+func untracked(path string) bool {
+	return strings.HasPrefix(path, "/api/server/") ||
+		path == "/api/health" ||
+		path == "/api/events"
+}
+
+func (d *drainTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if untracked(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		d.mu.Lock()
+		if d.draining {
+			d.mu.Unlock()
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		d.active++
+		d.mu.Unlock()
+
+		defer func() {
+			d.mu.Lock()
+			d.active--
+			d.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Active returns the number of in-flight requests
+func (d *drainTracker) Active() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active
+}
+
+// Draining reports whether new requests are refused
+func (d *drainTracker) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// Drain refuses new requests and waits up to timeout for in-flight ones to
+// finish, returning how many are still running
+func (d *drainTracker) Drain(timeout time.Duration) int {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		active := d.Active()
+		if active == 0 || !time.Now().Before(deadline) {
+			return active
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
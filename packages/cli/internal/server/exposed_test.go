@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	adb "github.com/basiooo/goadb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExposedDeviceConnectAndDisconnect(t *testing.T) {
+	adbServer := adbtest.NewServer(t)
+	adbServer.Setenv(t)
+	client := adbServer.Client()
+
+	// The box listens on the local port of the forward
+	box := adbServer.AddWirelessDevice("box-1")
+	box.Listen("127.0.0.1:5555")
+	box.StartPairing("127.0.0.1:37099", "482913")
+	_, err := client.Pair(context.Background(), "127.0.0.1:37099", "482913")
+	require.NoError(t, err)
+
+	adbClient, err := adb.NewWithConfig(adbserver.Default().ServerConfig())
+	require.NoError(t, err)
+	dm := &DeviceKeeper{adbClient: adbClient, exposedDevices: make(map[string]string)}
+
+	// adb replies OKAY to a failed connect, the failure is in the message
+	_, err = dm.ConnectExposedDevice("box-1", "127.0.0.1", 5556)
+	assert.ErrorContains(t, err, "Connection refused")
+	assert.Empty(t, dm.GetExposedBoxID("127.0.0.1:5556"))
+
+	serial, err := dm.ConnectExposedDevice("box-1", "127.0.0.1", 5555)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:5555", serial)
+	assert.Equal(t, "box-1", dm.GetExposedBoxID(serial))
+	assert.Equal(t, map[string]string{serial: "device"}, adbSerials(t, client))
+
+	require.NoError(t, dm.DisconnectExposedDevice(serial))
+	assert.Empty(t, dm.GetExposedBoxID(serial))
+	assert.Empty(t, adbSerials(t, client))
+}
@@ -10,24 +10,20 @@ import (
 	"time"
 
 	adb_expose "github.com/babelcloud/gbox/packages/cli/internal/adb_expose"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
 	"github.com/babelcloud/gbox/packages/cli/internal/profile"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 )
 
 // ADBExposeHandlers contains handlers for ADB expose functionality
 type ADBExposeHandlers struct {
+	serverService  ServerService
 	portManager    *PortManager
 	connectionPool *ConnectionPool
 }
 
 // BoxPortForward represents an active port forward for a remote box
-type BoxPortForward struct {
-	BoxID       string    `json:"box_id"`
-	LocalPorts  []int     `json:"local_ports"`
-	RemotePorts []int     `json:"remote_ports"`
-	Status      string    `json:"status"` // "running", "stopped", "error"
-	StartedAt   time.Time `json:"started_at"`
-	Error       string    `json:"error,omitempty"`
-}
+type BoxPortForward = serverclient.PortForward
 
 // PortForward manages a single port forwarding session
 type PortForward struct {
@@ -37,6 +33,7 @@ type PortForward struct {
 	StartedAt   time.Time `json:"started_at"`
 	Status      string    `json:"status"`
 	Error       string    `json:"error,omitempty"`
+	AdbSerial   string    `json:"adb_serial,omitempty"`
 	client      *adb_expose.MultiplexClient
 	listeners   []net.Listener
 	mu          sync.RWMutex
@@ -53,6 +50,25 @@ func (pf *PortForward) Stop() {
 	}
 }
 
+// publishStatus publishes the current status of the port forward on the event bus
+func (pf *PortForward) publishStatus() {
+	pf.mu.RLock()
+	data := map[string]interface{}{
+		"status":       pf.Status,
+		"local_ports":  pf.LocalPorts,
+		"remote_ports": pf.RemotePorts,
+	}
+	if pf.Error != "" {
+		data["error"] = pf.Error
+	}
+	if pf.AdbSerial != "" {
+		data["adb_serial"] = pf.AdbSerial
+	}
+	pf.mu.RUnlock()
+
+	events.Publish(events.ForwardStatus, pf.BoxID, data)
+}
+
 // PortManager manages multiple port forwards
 type PortManager struct {
 	forwards map[string]*PortForward
@@ -70,12 +86,14 @@ type StartRequest struct {
 	BoxID       string            `json:"box_id"`
 	LocalPorts  []int             `json:"local_ports"`
 	RemotePorts []int             `json:"remote_ports"`
+	AdbConnect  bool              `json:"adb_connect"`
 	Config      adb_expose.Config `json:"config"`
 }
 
 // NewADBExposeHandlers creates a new ADB expose handlers instance
-func NewADBExposeHandlers() *ADBExposeHandlers {
+func NewADBExposeHandlers(serverSvc ServerService) *ADBExposeHandlers {
 	return &ADBExposeHandlers{
+		serverService: serverSvc,
 		portManager: &PortManager{
 			forwards: make(map[string]*PortForward),
 		},
@@ -92,11 +110,7 @@ func (h *ADBExposeHandlers) HandleADBExposeStart(w http.ResponseWriter, r *http.
 		return
 	}
 
-	var req struct {
-		BoxID       string `json:"box_id"`
-		LocalPorts  []int  `json:"local_ports"`
-		RemotePorts []int  `json:"remote_ports"`
-	}
+	var req serverclient.ExposeStartRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		RespondJSON(w, http.StatusBadRequest, map[string]string{
@@ -132,6 +146,7 @@ func (h *ADBExposeHandlers) HandleADBExposeStart(w http.ResponseWriter, r *http.
 		BoxID:       req.BoxID,
 		LocalPorts:  req.LocalPorts,
 		RemotePorts: req.RemotePorts,
+		AdbConnect:  req.AdbConnect,
 	}
 
 	// Call the ADB expose server's start method
@@ -221,9 +236,7 @@ func (h *ADBExposeHandlers) HandleADBExposeStop(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	var req struct {
-		BoxID string `json:"box_id"`
-	}
+	var req serverclient.ExposeStopRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		// If no body, stop all forwards
@@ -252,22 +265,19 @@ func (h *ADBExposeHandlers) HandleADBExposeStop(w http.ResponseWriter, r *http.R
 	}
 	log.Printf("ADB port forward stopped for box %s", req.BoxID)
 
-	RespondJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"message": fmt.Sprintf("ADB port expose stopped for box %s", req.BoxID),
+	RespondJSON(w, http.StatusOK, serverclient.ExposeStopResponse{
+		Success: true,
+		Message: fmt.Sprintf("ADB port expose stopped for box %s", req.BoxID),
 	})
 }
 
 // HandleADBExposeStatus handles ADB expose status requests
 func (h *ADBExposeHandlers) HandleADBExposeStatus(w http.ResponseWriter, r *http.Request) {
-	status := map[string]interface{}{
-		"running": true, // Always running as part of main server
+	status := serverclient.ExposeStatus{
+		Running:  true, // Always running as part of main server
+		Forwards: h.listPortForwards(),
 	}
 
-	// Get box port forwards
-	forwards := h.listPortForwards()
-	status["forwards"] = forwards
-
 	RespondJSON(w, http.StatusOK, status)
 }
 
@@ -276,9 +286,9 @@ func (h *ADBExposeHandlers) HandleADBExposeList(w http.ResponseWriter, r *http.R
 	// Get port forwards directly from port manager
 	forwards := h.listPortForwards()
 
-	RespondJSON(w, http.StatusOK, map[string]interface{}{
-		"forwards": forwards,
-		"count":    len(forwards),
+	RespondJSON(w, http.StatusOK, serverclient.ExposeList{
+		Forwards: forwards,
+		Count:    len(forwards),
 	})
 }
 
@@ -311,10 +321,57 @@ func (h *ADBExposeHandlers) startPortForward(req StartRequest) (*PortForward, er
 		go h.startLocalListener(forward, localPort, remotePort)
 	}
 
+	forward.mu.Lock()
 	forward.Status = "running"
+	forward.mu.Unlock()
+	forward.publishStatus()
+
+	// Connect the local adb server to the first exposed port so the box shows up in `adb devices`
+	if req.AdbConnect && h.serverService != nil {
+		localPort := req.LocalPorts[0]
+		if err := waitForLocalPort(localPort, 3*time.Second); err != nil {
+			log.Printf("Skipping adb connect for box %s: %v", req.BoxID, err)
+			forward.mu.Lock()
+			forward.Error = err.Error()
+			forward.mu.Unlock()
+			forward.publishStatus()
+			return forward, nil
+		}
+		serial, err := h.serverService.ConnectExposedDevice(req.BoxID, "127.0.0.1", localPort)
+		if err != nil {
+			log.Printf("Failed to adb connect box %s: %v", req.BoxID, err)
+			forward.mu.Lock()
+			forward.Error = err.Error()
+			forward.mu.Unlock()
+			forward.publishStatus()
+			return forward, nil
+		}
+		forward.mu.Lock()
+		forward.AdbSerial = serial
+		forward.mu.Unlock()
+		forward.publishStatus()
+	}
+
 	return forward, nil
 }
 
+// waitForLocalPort waits until the local listener for an exposed port accepts connections
+func waitForLocalPort(port int, timeout time.Duration) error {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("local port %d is not listening: %v", port, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 // stopPortForward stops port forwarding for a box
 func (h *ADBExposeHandlers) stopPortForward(boxID string) error {
 	h.portManager.mu.Lock()
@@ -325,8 +382,19 @@ func (h *ADBExposeHandlers) stopPortForward(boxID string) error {
 		return fmt.Errorf("port forward not found for box %s", boxID)
 	}
 
+	// Disconnect adb before the listener goes away so the device does not linger as offline
+	forward.mu.RLock()
+	serial := forward.AdbSerial
+	forward.mu.RUnlock()
+	if serial != "" && h.serverService != nil {
+		if err := h.serverService.DisconnectExposedDevice(serial); err != nil {
+			log.Printf("Failed to adb disconnect %s for box %s: %v", serial, boxID, err)
+		}
+	}
+
 	// Stop the port forward
 	forward.Stop()
+	forward.publishStatus()
 
 	// Close the client connection if it exists
 	if forward.client != nil {
@@ -340,20 +408,23 @@ func (h *ADBExposeHandlers) stopPortForward(boxID string) error {
 }
 
 // listPortForwards returns all active port forwards
-func (h *ADBExposeHandlers) listPortForwards() []*BoxPortForward {
+func (h *ADBExposeHandlers) listPortForwards() []BoxPortForward {
 	h.portManager.mu.RLock()
 	defer h.portManager.mu.RUnlock()
 
-	boxForwards := make([]*BoxPortForward, 0, len(h.portManager.forwards))
+	boxForwards := make([]BoxPortForward, 0, len(h.portManager.forwards))
 	for _, forward := range h.portManager.forwards {
-		boxForward := &BoxPortForward{
+		forward.mu.RLock()
+		boxForward := BoxPortForward{
 			BoxID:       forward.BoxID,
 			LocalPorts:  forward.LocalPorts,
 			RemotePorts: forward.RemotePorts,
 			Status:      forward.Status,
 			StartedAt:   forward.StartedAt,
 			Error:       forward.Error,
+			AdbSerial:   forward.AdbSerial,
 		}
+		forward.mu.RUnlock()
 		boxForwards = append(boxForwards, boxForward)
 	}
 
@@ -399,6 +470,7 @@ func (h *ADBExposeHandlers) startLocalListener(forward *PortForward, localPort,
 		forward.Status = "error"
 		forward.Error = fmt.Sprintf("Failed to listen on port %d: %v", localPort, err)
 		forward.mu.Unlock()
+		forward.publishStatus()
 		return
 	}
 	defer listener.Close()
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exposeServer records the adb disconnects of stopped forwards
+type exposeServer struct {
+	ServerService
+	disconnected []string
+}
+
+func (s *exposeServer) DisconnectExposedDevice(serial string) error {
+	s.disconnected = append(s.disconnected, serial)
+	return nil
+}
+
+func TestStopPortForwardDisconnectsAdb(t *testing.T) {
+	srv := &exposeServer{}
+	h := NewADBExposeHandlers(srv)
+	h.portManager.forwards["box-1"] = &PortForward{
+		BoxID:       "box-1",
+		LocalPorts:  []int{5555},
+		RemotePorts: []int{5555},
+		StartedAt:   time.Now(),
+		Status:      "running",
+		AdbSerial:   "127.0.0.1:5555",
+	}
+
+	forwards := h.listPortForwards()
+	require.Len(t, forwards, 1)
+	assert.Equal(t, "127.0.0.1:5555", forwards[0].AdbSerial)
+
+	require.NoError(t, h.stopPortForward("box-1"))
+	assert.Equal(t, []string{"127.0.0.1:5555"}, srv.disconnected)
+	assert.Empty(t, h.listPortForwards())
+	assert.Error(t, h.stopPortForward("box-1"))
+}
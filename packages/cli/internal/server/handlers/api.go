@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 )
 
 // APIHandlers contains handlers for general API routes (health, status, server management)
@@ -35,16 +40,16 @@ func (h *APIHandlers) HandleStatus(w http.ResponseWriter, req *http.Request) {
 
 	uptime := h.serverService.GetUptime()
 
-	status := map[string]interface{}{
-		"running": h.serverService.IsRunning(),
-		"port":    h.serverService.GetPort(),
-		"uptime":  uptime.String(),
-		"services": map[string]interface{}{
-			"device_connect": true,
-			"adb_expose":     h.serverService.IsADBExposeRunning(),
+	status := serverclient.Status{
+		Running: h.serverService.IsRunning(),
+		Port:    h.serverService.GetPort(),
+		Uptime:  uptime.String(),
+		Services: serverclient.StatusServices{
+			DeviceConnect: true,
+			ADBExpose:     h.serverService.IsADBExposeRunning(),
 		},
-		"version":  h.serverService.GetVersion(),
-		"build_id": h.serverService.GetBuildID(),
+		Version: h.serverService.GetVersion(),
+		BuildID: h.serverService.GetBuildID(),
 	}
 
 	RespondJSON(w, http.StatusOK, status)
@@ -67,13 +72,29 @@ func (h *APIHandlers) HandleServerShutdown(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	RespondJSON(w, http.StatusOK, map[string]string{
-		"message": "Server shutting down",
+	// Active streams may finish for up to drain before the server exits
+	var drain time.Duration
+	if value := req.URL.Query().Get("drain"); value != "" {
+		var err error
+		if drain, err = time.ParseDuration(value); err != nil || drain < 0 {
+			RespondJSON(w, http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("invalid drain duration %q", value),
+			})
+			return
+		}
+	}
+
+	RespondJSON(w, http.StatusOK, serverclient.ShutdownResponse{
+		Message:       "Server shutting down",
+		ActiveStreams: h.serverService.ActiveStreams(),
 	})
 
 	// Shutdown after response
 	go func() {
 		time.Sleep(100 * time.Millisecond)
+		if remaining := h.serverService.Drain(drain); remaining > 0 {
+			log.Printf("Shutting down with %d active streams", remaining)
+		}
 		h.serverService.Stop()
 		os.Exit(0)
 	}()
@@ -89,15 +110,20 @@ func (h *APIHandlers) HandleServerInfo(w http.ResponseWriter, req *http.Request)
 
 	uptime := h.serverService.GetUptime()
 
-	info := map[string]interface{}{
-		"version":  h.serverService.GetVersion(),
-		"build_id": h.serverService.GetBuildID(),
-		"port":     h.serverService.GetPort(),
-		"uptime":   uptime.String(),
-		"services": []string{
+	info := serverclient.ServerInfo{
+		Version:       h.serverService.GetVersion(),
+		BuildID:       h.serverService.GetBuildID(),
+		Port:          h.serverService.GetPort(),
+		Uptime:        uptime.String(),
+		PID:           os.Getpid(),
+		ActiveStreams: h.serverService.ActiveStreams(),
+		Draining:      h.serverService.IsDraining(),
+		Supervisor:    daemon.Supervisor(),
+		Services: []string{
 			"device-connect",
 			"adb-expose",
 		},
+		LocalOnly: h.serverService.IsLocalOnly(),
 	}
 
 	// Set CORS headers for debugging
@@ -111,3 +137,15 @@ func (h *APIHandlers) HandleServerInfo(w http.ResponseWriter, req *http.Request)
 
 	RespondJSON(w, http.StatusOK, info)
 }
+
+// HandleOpenAPI serves the OpenAPI document of the server API
+func (h *APIHandlers) HandleOpenAPI(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	w.Write(serverclient.Spec())
+}
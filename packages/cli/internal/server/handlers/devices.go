@@ -22,14 +22,17 @@ import (
 	"strings"
 	"time"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
 	"github.com/babelcloud/gbox/packages/cli/internal/cloud"
 	"github.com/babelcloud/gbox/packages/cli/internal/device"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/control"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/transport/audio"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/transport/h264"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/transport/stream"
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
 	serverScripts "github.com/babelcloud/gbox/packages/cli/internal/server/scripts"
 	"github.com/babelcloud/gbox/packages/cli/internal/util"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 )
@@ -47,23 +50,9 @@ func pathParam(r *http.Request, key string) string {
 	return ""
 }
 
-// DeviceDTO is a strong-typed representation of a device for API responses
-type DeviceDTO struct {
-	ID                string                 `json:"id"`
-	TransportID       string                 `json:"transportId"`
-	Serialno          string                 `json:"serialno"`
-	Platform          string                 `json:"platform"`   // mobile, desktop
-	OS                string                 `json:"os"`         // android, linux, windows, macos
-	DeviceType        string                 `json:"deviceType"` // physical, emulator, vm
-	IsRegistered      bool                   `json:"isRegistered"`
-	IsConnected       bool                   `json:"isConnected"`       // true if device is currently connected to AP
-	IsReconnecting    bool                   `json:"isReconnecting"`    // true if device is attempting to reconnect
-	ReconnectAttempt  int                    `json:"reconnectAttempt"`  // Current reconnection attempt count
-	ReconnectMaxRetry int                    `json:"reconnectMaxRetry"` // Maximum reconnection attempts
-	RegId             string                 `json:"regId"`
-	IsLocal           bool                   `json:"isLocal"`  // true if this is the local desktop device
-	Metadata          map[string]interface{} `json:"metadata"` // Device-specific metadata
-}
+// DeviceDTO is a strong-typed representation of a device for API responses,
+// shared with the CLI through serverclient
+type DeviceDTO = serverclient.Device
 
 // setWebMStreamingHeaders sets HTTP headers for WebM audio streaming
 func setWebMStreamingHeaders(w http.ResponseWriter) {
@@ -127,6 +116,18 @@ func (h *DeviceHandlers) HandleDeviceList(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Devices may be picked by label, and only the free ones
+	selector, err := device.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+			"devices": []interface{}{},
+		})
+		return
+	}
+	free := r.URL.Query().Get("free") == "true"
+
 	// Use unified device manager (reused)
 	devs, err := h.deviceManager.GetDevices()
 	if err != nil {
@@ -138,18 +139,31 @@ func (h *DeviceHandlers) HandleDeviceList(w http.ResponseWriter, r *http.Request
 		})
 		return
 	}
-	deviceAPI := cloud.NewDeviceAPI()
+	localOnly := h.serverService.IsLocalOnly()
 
-	// Get all registered devices from cloud in one call
+	// Get all registered devices from cloud in one call. A local-only server
+	// lists every attached device as unregistered without asking the cloud.
 	registeredDevicesMap := make(map[string]*cloud.Device)
-	allCloudDevices, err := deviceAPI.GetAll()
-	if err != nil {
-		log.Printf("Failed to get all devices from cloud: %v", err)
-	} else {
-		// Build a map of regId -> Device for quick lookup
-		for _, cloudDevice := range allCloudDevices.Data {
-			if cloudDevice.RegId != "" {
-				registeredDevicesMap[cloudDevice.RegId] = cloudDevice
+	var allCloudDevices *cloud.DeviceList
+	cloudReachable := false
+	if !localOnly {
+		deviceAPI := cloud.NewDeviceAPI()
+		allCloudDevices, err = deviceAPI.GetAll()
+		cloudReachable = err == nil
+		if err != nil {
+			// Fall back to the registry so registered devices still show as such
+			log.Printf("Failed to get all devices from cloud, using the device registry: %v", err)
+			for _, entry := range h.currentRegistryEntries() {
+				if entry.RegID != "" {
+					registeredDevicesMap[entry.RegID] = registryCloudDevice(entry)
+				}
+			}
+		} else {
+			// Build a map of regId -> Device for quick lookup
+			for _, cloudDevice := range allCloudDevices.Data {
+				if cloudDevice.RegId != "" {
+					registeredDevicesMap[cloudDevice.RegId] = cloudDevice
+				}
 			}
 		}
 	}
@@ -194,7 +208,9 @@ func (h *DeviceHandlers) HandleDeviceList(w http.ResponseWriter, r *http.Request
 			DeviceType:   util.DetectAndroidDeviceType(d.ID, d.SerialNo),
 			IsRegistered: false,
 			RegId:        d.RegId,
+			BoxID:        h.serverService.GetExposedBoxID(d.ID),
 			Metadata:     metadata,
+			Labels:       h.serverService.DeviceLabels(d.SerialNo),
 		}
 
 		// Check if device is registered by looking up in the map
@@ -209,12 +225,27 @@ func (h *DeviceHandlers) HandleDeviceList(w http.ResponseWriter, r *http.Request
 				if cloudDevice.Metadata.OsType != "" {
 					dto.OS = cloudDevice.Metadata.OsType
 				}
+				if cloudReachable {
+					h.serverService.RecordRegisteredDevice(device.RegistryEntry{
+						DeviceID:   cloudDevice.Id,
+						RegID:      d.RegId,
+						Serial:     d.ID,
+						Serialno:   d.SerialNo,
+						DeviceType: dto.Platform,
+						OsType:     dto.OS,
+						Metadata:   metadata,
+					})
+				}
 			}
 		}
 
 		// Check if device is currently connected to AP
 		dto.IsConnected = h.serverService.IsDeviceConnected(d.SerialNo)
 
+		// Last health check, the server checks online devices periodically
+		dto.Health, _ = h.serverService.DeviceHealth(d.ID, false)
+		dto.Lease = h.serverService.DeviceLease(d.ID)
+
 		// Check reconnection state
 		if reconnectState := h.serverService.GetDeviceReconnectState(d.SerialNo); reconnectState != nil {
 			// Use type assertion with interface{} to avoid circular dependency
@@ -309,6 +340,21 @@ func (h *DeviceHandlers) HandleDeviceList(w http.ResponseWriter, r *http.Request
 			if cloudDevice.Metadata.OsType != "" {
 				desktopDTO.OS = cloudDevice.Metadata.OsType
 			}
+			if cloudReachable {
+				sessionKey := cloudDevice.Metadata.Serialno
+				if sessionKey == "" {
+					sessionKey = localRegId
+				}
+				h.serverService.RecordRegisteredDevice(device.RegistryEntry{
+					DeviceID:   cloudDevice.Id,
+					RegID:      localRegId,
+					Serial:     sessionKey,
+					Serialno:   cloudDevice.Metadata.Serialno,
+					DeviceType: desktopDTO.Platform,
+					OsType:     desktopDTO.OS,
+					Metadata:   metadata,
+				})
+			}
 		} else {
 			// Desktop device exists locally but not registered
 			desktopDTO = DeviceDTO{
@@ -340,6 +386,9 @@ func (h *DeviceHandlers) HandleDeviceList(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	desktopDTO.Labels = h.serverService.DeviceLabels(desktopDTO.Serialno)
+	desktopDTO.Lease = h.serverService.DeviceLease(desktopDTO.TransportID)
+
 	// Check if desktop device is currently connected to AP
 	desktopDTO.IsConnected = h.serverService.IsDeviceConnected(desktopDTO.Serialno)
 
@@ -362,14 +411,107 @@ func (h *DeviceHandlers) HandleDeviceList(w http.ResponseWriter, r *http.Request
 	h.serverService.UpdateDeviceInfo(&desktopDTO)
 
 	dtos = append(dtos, desktopDTO)
+	if !localOnly {
+		dtos = append(dtos, h.offlineRegisteredDevices(dtos, allCloudDevices)...)
+	}
 
 	RespondJSON(w, http.StatusOK, map[string]interface{}{
 		"success":         true,
-		"devices":         dtos,
+		"devices":         selectDevices(dtos, selector, free),
 		"onDemandEnabled": true,
 	})
 }
 
+// selectDevices returns the devices whose labels match selector, only the
+// free ones when free is set
+func selectDevices(dtos []DeviceDTO, selector device.Selector, free bool) []DeviceDTO {
+	if selector.Empty() && !free {
+		return dtos
+	}
+	selected := make([]DeviceDTO, 0, len(dtos))
+	for _, dto := range dtos {
+		if selector.Matches(dto.Labels) && (!free || dto.IsFree()) {
+			selected = append(selected, dto)
+		}
+	}
+	return selected
+}
+
+// currentRegistryEntries returns the registry entries of the current profile
+func (h *DeviceHandlers) currentRegistryEntries() []device.RegistryEntry {
+	current := profile.Default.GetCurrentProfileID()
+	entries := make([]device.RegistryEntry, 0)
+	for _, entry := range h.serverService.RegisteredDevices() {
+		if entry.Profile == "" || current == "" || entry.Profile == current {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// registryCloudDevice stands in for a cloud device while the cloud is unreachable
+func registryCloudDevice(entry device.RegistryEntry) *cloud.Device {
+	dev := &cloud.Device{Id: entry.DeviceID, RegId: entry.RegID}
+	dev.Metadata.DeviceType = entry.DeviceType
+	dev.Metadata.OsType = entry.OsType
+	dev.Metadata.Serialno = entry.Serialno
+	return dev
+}
+
+// offlineRegisteredDevices lists registry devices missing from listed. With a
+// cloud device list at hand, devices no longer registered are forgotten.
+func (h *DeviceHandlers) offlineRegisteredDevices(listed []DeviceDTO, cloudDevices *cloud.DeviceList) []DeviceDTO {
+	seen := make(map[string]bool, len(listed))
+	for _, dto := range listed {
+		if dto.ID != "" {
+			seen[dto.ID] = true
+		}
+	}
+	var inCloud map[string]bool
+	if cloudDevices != nil {
+		inCloud = make(map[string]bool, len(cloudDevices.Data))
+		for _, dev := range cloudDevices.Data {
+			if dev != nil {
+				inCloud[dev.Id] = true
+			}
+		}
+	}
+
+	dtos := make([]DeviceDTO, 0)
+	for _, entry := range h.currentRegistryEntries() {
+		if seen[entry.DeviceID] {
+			continue
+		}
+		if inCloud != nil && !inCloud[entry.DeviceID] {
+			h.serverService.ForgetDevice(entry.DeviceID)
+			continue
+		}
+
+		serialno := entry.Serialno
+		if serialno == "" {
+			serialno = entry.Serial
+		}
+		lastSeen := entry.LastSeen
+		dto := DeviceDTO{
+			ID:           entry.DeviceID,
+			TransportID:  entry.Serial,
+			Serialno:     serialno,
+			Platform:     entry.DeviceType,
+			OS:           entry.OsType,
+			IsRegistered: true,
+			RegId:        entry.RegID,
+			Metadata:     entry.Metadata,
+			IsOffline:    true,
+			LastSeen:     &lastSeen,
+			Labels:       h.serverService.DeviceLabels(serialno),
+		}
+		// A device may still hold an AP session while adb lost sight of it
+		dto.IsConnected = h.serverService.IsDeviceConnected(entry.Serial)
+		dtos = append(dtos, dto)
+	}
+	return dtos
+}
+
 // HandleDeviceAction handles device action requests (connect/disconnect)
 func (h *DeviceHandlers) HandleDeviceAction(w http.ResponseWriter, r *http.Request) {
 	// Extract device serial from path: /api/devices/{serial}
@@ -397,6 +539,257 @@ func (h *DeviceHandlers) HandleDeviceAction(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// HandleDeviceReconnect retries the access point session of a registered
+// device now, after applying the reconnect policy changes of the request
+func (h *DeviceHandlers) HandleDeviceReconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
+			"success": false,
+			"error":   "Method not allowed. Use POST to reconnect",
+		})
+		return
+	}
+
+	// Extract device serial from path: /api/devices/{serial}/reconnect
+	path := strings.TrimPrefix(r.URL.Path, "/api/devices/")
+	deviceID := strings.Split(path, "/")[0]
+	if deviceID == "" {
+		http.Error(w, "Device serial required", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional
+	var req serverclient.ReconnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	if err := h.applyReconnectPolicy(deviceID, req); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, device.ErrNotRegistered) {
+			status = http.StatusNotFound
+		}
+		RespondJSON(w, status, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.serverService.ReconnectDevice(deviceID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, device.ErrNotRegistered) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, device.ErrQuarantined) || errors.Is(err, device.ErrLocalOnly) {
+			status = http.StatusConflict
+		}
+		RespondJSON(w, status, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	policy := h.serverService.ReconnectPolicy(deviceID)
+	RespondJSON(w, http.StatusAccepted, serverclient.ReconnectResponse{
+		Success: true,
+		Message: fmt.Sprintf("Reconnecting device %s", deviceID),
+		Policy: serverclient.ReconnectPolicy{
+			MaxAttempts:      policy.MaxAttempts,
+			BaseDelay:        policy.BaseDelay.String(),
+			MaxDelay:         policy.MaxDelay.String(),
+			BreakerThreshold: policy.BreakerThreshold,
+			Cooldown:         policy.Cooldown.String(),
+			CancelOnOffline:  policy.CancelOnOffline,
+		},
+	})
+}
+
+// HandleDeviceHealth returns the battery, storage, CPU load and screen state
+// of an Android device and whether it is quarantined. The last check is
+// returned unless refresh=true is given or the device was never checked.
+func (h *DeviceHandlers) HandleDeviceHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serial := pathParam(r, "serial")
+	if serial == "" {
+		http.Error(w, "Device serial required", http.StatusBadRequest)
+		return
+	}
+
+	refresh := r.URL.Query().Get("refresh") == "true"
+	health, err := h.serverService.DeviceHealth(serial, refresh)
+	if err == nil && health == nil {
+		health, err = h.serverService.DeviceHealth(serial, true)
+	}
+	if err != nil && health == nil {
+		RespondJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	RespondJSON(w, http.StatusOK, health)
+}
+
+// HandleDeviceLabels returns the labels of a device on GET and sets and
+// removes them on POST. The device is an adb serial, a serialno, a device ID
+// of a registered device, or local for this machine.
+func (h *DeviceHandlers) HandleDeviceLabels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serial := pathParam(r, "serial")
+	if serial == "" {
+		http.Error(w, "Device serial required", http.StatusBadRequest)
+		return
+	}
+	serialno := h.labelSerialno(serial)
+	if serialno == "" {
+		RespondJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("device not found: %s", serial),
+		})
+		return
+	}
+
+	resp := serverclient.DeviceLabels{Serialno: serialno}
+	if r.Method == http.MethodGet {
+		resp.Labels = h.serverService.DeviceLabels(serialno)
+		RespondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	var req serverclient.DeviceLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+		return
+	}
+	for key, value := range req.Labels {
+		if err := device.ValidateLabel(key, value); err != nil {
+			RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	labels, err := h.serverService.SetDeviceLabels(serialno, req.Labels, req.Remove)
+	if err != nil {
+		log.Printf("device %s: %v", serialno, err)
+		resp.Warning = err.Error()
+	}
+	resp.Labels = labels
+	RespondJSON(w, http.StatusOK, resp)
+}
+
+// labelSerialno returns the serialno the labels of a device are kept under,
+// or "" for an unknown device
+func (h *DeviceHandlers) labelSerialno(serial string) string {
+	for _, dto := range h.getLocalDeviceList() {
+		if dto.TransportID == serial || dto.Serialno == serial {
+			return dto.Serialno
+		}
+	}
+	for _, entry := range h.currentRegistryEntries() {
+		if entry.DeviceID == serial || entry.RegID == serial || entry.Serial == serial || entry.Serialno == serial {
+			if entry.Serialno != "" {
+				return entry.Serialno
+			}
+			return entry.Serial
+		}
+	}
+	return ""
+}
+
+// HandleWirelessDevices lists the wireless debugging devices on the LAN
+func (h *DeviceHandlers) HandleWirelessDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	devices, err := h.serverService.WirelessDevices()
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	RespondJSON(w, http.StatusOK, devices)
+}
+
+// HandleDevicePair pairs with a wireless debugging device and connects to it
+func (h *DeviceHandlers) HandleDevicePair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req serverclient.PairRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+		return
+	}
+	if req.Address == "" || req.Code == "" {
+		RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "address and code are required",
+		})
+		return
+	}
+
+	resp, err := h.serverService.PairDevice(req)
+	if err != nil {
+		RespondJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	RespondJSON(w, http.StatusOK, resp)
+}
+
+// applyReconnectPolicy resets and overrides the reconnect policy of a device
+// as the request asks. Policy fields the request leaves out keep their values.
+func (h *DeviceHandlers) applyReconnectPolicy(deviceID string, req serverclient.ReconnectRequest) error {
+	if req.ResetPolicy {
+		if err := h.serverService.SetReconnectPolicy(deviceID, nil); err != nil {
+			return err
+		}
+	}
+	if len(req.Policy) == 0 {
+		return nil
+	}
+
+	policy := h.serverService.ReconnectPolicy(deviceID)
+	data, err := json.Marshal(req.Policy)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("invalid reconnect policy: %v", err)
+	}
+	return h.serverService.SetReconnectPolicy(deviceID, &policy)
+}
+
 // validateDeviceTypeAndOsType validates deviceType and osType parameters and their combination.
 // Returns normalized osType (with default value applied) and error if validation fails.
 func validateDeviceTypeAndOsType(deviceType, osType string) (string, error) {
@@ -435,6 +828,10 @@ func validateDeviceTypeAndOsType(deviceType, osType string) (string, error) {
 
 // HandleDeviceRegister handles device registration requests
 func (h *DeviceHandlers) HandleDeviceRegister(w http.ResponseWriter, r *http.Request) {
+	if h.serverService.IsLocalOnly() {
+		http.Error(w, errors.Wrap(device.ErrLocalOnly, "devices cannot be registered").Error(), http.StatusConflict)
+		return
+	}
 	decoder := json.NewDecoder(r.Body)
 	var reqBody struct {
 		DeviceId   string `json:"deviceId"`
@@ -649,19 +1046,20 @@ func (h *DeviceHandlers) registerDevice(deviceAPI *cloud.DeviceAPI, deviceId, de
 	// Create device in cloud
 	newDevice := &cloud.Device{
 		Metadata: struct {
-			Serialno       string `json:"serialno,omitempty"`
-			AndroidId      string `json:"androidId,omitempty"`
-			Type           string `json:"type,omitempty"`
-			DeviceType     string `json:"deviceType,omitempty"`
-			OsType         string `json:"osType,omitempty"`
-			Resolution     string `json:"resolution,omitempty"`
-			Hostname       string `json:"hostname,omitempty"`
-			Chip           string `json:"chip,omitempty"`
-			OsVersion      string `json:"osVersion,omitempty"`
-			Memory         string `json:"memory,omitempty"`
-			Model          string `json:"model,omitempty"`
-			Manufacturer   string `json:"manufacturer,omitempty"`
-			ConnectionType string `json:"connectionType,omitempty"`
+			Serialno       string            `json:"serialno,omitempty"`
+			AndroidId      string            `json:"androidId,omitempty"`
+			Type           string            `json:"type,omitempty"`
+			DeviceType     string            `json:"deviceType,omitempty"`
+			OsType         string            `json:"osType,omitempty"`
+			Resolution     string            `json:"resolution,omitempty"`
+			Hostname       string            `json:"hostname,omitempty"`
+			Chip           string            `json:"chip,omitempty"`
+			OsVersion      string            `json:"osVersion,omitempty"`
+			Memory         string            `json:"memory,omitempty"`
+			Model          string            `json:"model,omitempty"`
+			Manufacturer   string            `json:"manufacturer,omitempty"`
+			ConnectionType string            `json:"connectionType,omitempty"`
+			Labels         map[string]string `json:"labels,omitempty"`
 		}{
 			Serialno:       serialno,
 			AndroidId:      androidId,
@@ -676,6 +1074,8 @@ func (h *DeviceHandlers) registerDevice(deviceAPI *cloud.DeviceAPI, deviceId, de
 			Model:          model,
 			Manufacturer:   manufacturer,
 			ConnectionType: connectionType,
+			// Labels set before registering are kept
+			Labels: h.serverService.DeviceLabels(serialno),
 		},
 		RegId: regId,
 	}
@@ -703,6 +1103,10 @@ func (h *DeviceHandlers) registerDevice(deviceAPI *cloud.DeviceAPI, deviceId, de
 
 // HandleDeviceUnregister handles device unregistration requests
 func (h *DeviceHandlers) HandleDeviceUnregister(w http.ResponseWriter, r *http.Request) {
+	if h.serverService.IsLocalOnly() {
+		http.Error(w, errors.Wrap(device.ErrLocalOnly, "devices cannot be unregistered").Error(), http.StatusConflict)
+		return
+	}
 	decoder := json.NewDecoder(r.Body)
 	var reqBody struct {
 		DeviceId string `json:"deviceId"`
@@ -724,6 +1128,7 @@ func (h *DeviceHandlers) HandleDeviceUnregister(w http.ResponseWriter, r *http.R
 				http.Error(w, errors.Wrapf(err, "failed to delete device %s", device.Id).Error(), http.StatusInternalServerError)
 				return
 			}
+			h.serverService.ForgetDevice(device.Id)
 		}
 		// Successfully deleted by regId, return early
 		go func() {
@@ -750,6 +1155,7 @@ func (h *DeviceHandlers) HandleDeviceUnregister(w http.ResponseWriter, r *http.R
 					http.Error(w, errors.Wrapf(err, "failed to delete device %s", device.Id).Error(), http.StatusInternalServerError)
 					return
 				}
+				h.serverService.ForgetDevice(device.Id)
 			}
 			go func() {
 				if err := h.serverService.DisconnectAP(reqBody.DeviceId); err != nil {
@@ -785,6 +1191,7 @@ func (h *DeviceHandlers) HandleDeviceUnregister(w http.ResponseWriter, r *http.R
 					http.Error(w, errors.Wrapf(err, "failed to delete device %s", device.Id).Error(), http.StatusInternalServerError)
 					return
 				}
+				h.serverService.ForgetDevice(device.Id)
 			}
 			// Successfully deleted by regId, return early
 			go func() {
@@ -812,6 +1219,7 @@ func (h *DeviceHandlers) HandleDeviceUnregister(w http.ResponseWriter, r *http.R
 				http.Error(w, errors.Wrapf(err, "failed to delete device %s", device.Id).Error(), http.StatusInternalServerError)
 				return
 			}
+			h.serverService.ForgetDevice(device.Id)
 		}
 	} else {
 		// No devices found by serialno/androidId either
@@ -1195,14 +1603,11 @@ func (h *DeviceHandlers) HandleDeviceExec(w http.ResponseWriter, req *http.Reque
 		}
 	}
 
-	var cmd *exec.Cmd
+	var stdoutBuf, stderrBuf bytes.Buffer
+	var duration time.Duration
+	exitCode := 0
 	if devicePlatform == "mobile" {
-		// Execute command on Android device via adb shell
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
-		}
-
+		// Execute command on Android device through the adb shell service
 		// Build command with environment variables if provided
 		shellCmd := payload.Cmd
 		if len(payload.Envs) > 0 {
@@ -1215,9 +1620,17 @@ func (h *DeviceHandlers) HandleDeviceExec(w http.ResponseWriter, req *http.Reque
 
 		// Set working directory and execute command
 		fullCmd := fmt.Sprintf("cd %s && %s", workingDir, shellCmd)
-		cmd = exec.CommandContext(ctx, adbPath, "-s", deviceSerial, "shell", fullCmd)
+		start := time.Now()
+		code, err := adbserver.DefaultClient().Device(deviceSerial).Shell(ctx, fullCmd, nil, &stdoutBuf, &stderrBuf)
+		duration = time.Since(start)
+		if err != nil {
+			fmt.Fprintln(&stderrBuf, err)
+			code = -1
+		}
+		exitCode = code
 	} else {
 		// Execute command locally on desktop device
+		var cmd *exec.Cmd
 		if runtime.GOOS == "windows" {
 			cmd = exec.CommandContext(ctx, "cmd", "/C", payload.Cmd)
 		} else {
@@ -1234,22 +1647,20 @@ func (h *DeviceHandlers) HandleDeviceExec(w http.ResponseWriter, req *http.Reque
 				cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 			}
 		}
-	}
 
-	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
+		cmd.Stdout = &stdoutBuf
+		cmd.Stderr = &stderrBuf
 
-	start := time.Now()
-	runErr := cmd.Run()
-	duration := time.Since(start)
+		start := time.Now()
+		runErr := cmd.Run()
+		duration = time.Since(start)
 
-	exitCode := 0
-	if runErr != nil {
-		if exitErr, ok := runErr.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			exitCode = -1
+		if runErr != nil {
+			if exitErr, ok := runErr.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			} else {
+				exitCode = -1
+			}
 		}
 	}
 
@@ -1556,15 +1967,13 @@ func (h *DeviceHandlers) HandleDeviceScreenshot(w http.ResponseWriter, req *http
 		return
 	}
 
-	adbPath, err := exec.LookPath("adb")
-	if err != nil {
-		adbPath = "adb"
-	}
+	dev := adbserver.DefaultClient().Device(deviceSerial)
 
 	var pngData []byte
+	var err error
 	if scrollOpts == nil {
 		// Single capture
-		pngData, err = runScreencap(adbPath, deviceSerial)
+		pngData, err = runScreencap(req.Context(), dev)
 		if err != nil {
 			log.Printf("[HandleDeviceScreenshot] screencap failed: %v", err)
 			RespondJSON(w, http.StatusInternalServerError, map[string]interface{}{
@@ -1574,7 +1983,7 @@ func (h *DeviceHandlers) HandleDeviceScreenshot(w http.ResponseWriter, req *http
 		}
 	} else {
 		// Scroll capture
-		pngData, err = h.doScrollCapture(adbPath, deviceSerial, maxHeight, scrollBack)
+		pngData, err = h.doScrollCapture(req.Context(), dev, maxHeight, scrollBack)
 		if err != nil {
 			log.Printf("[HandleDeviceScreenshot] scroll capture failed: %v", err)
 			RespondJSON(w, http.StatusInternalServerError, map[string]interface{}{
@@ -1610,13 +2019,12 @@ func (h *DeviceHandlers) HandleDeviceScreenshot(w http.ResponseWriter, req *http
 	})
 }
 
-func runScreencap(adbPath, deviceSerial string) ([]byte, error) {
-	cmd := exec.Command(adbPath, "-s", deviceSerial, "shell", "screencap", "-p")
-	return cmd.Output()
+func runScreencap(ctx context.Context, dev *adbserver.Device) ([]byte, error) {
+	return dev.Output(ctx, "screencap -p")
 }
 
-func (h *DeviceHandlers) doScrollCapture(adbPath, deviceSerial string, maxHeight int, scrollBack bool) ([]byte, error) {
-	width, height, err := h.getDeviceDisplaySize(deviceSerial)
+func (h *DeviceHandlers) doScrollCapture(ctx context.Context, dev *adbserver.Device, maxHeight int, scrollBack bool) ([]byte, error) {
+	width, height, err := h.getDeviceDisplaySize(dev.Serial())
 	if err != nil {
 		return nil, errors.Wrap(err, "get display size")
 	}
@@ -1625,7 +2033,7 @@ func (h *DeviceHandlers) doScrollCapture(adbPath, deviceSerial string, maxHeight
 	yOffset := 0
 
 	for yOffset < maxHeight {
-		data, err := runScreencap(adbPath, deviceSerial)
+		data, err := runScreencap(ctx, dev)
 		if err != nil {
 			return nil, err
 		}
@@ -1638,9 +2046,8 @@ func (h *DeviceHandlers) doScrollCapture(adbPath, deviceSerial string, maxHeight
 		x := width / 2
 		yStart := height * 4 / 5
 		yEnd := height / 5
-		swipeCmd := exec.Command(adbPath, "-s", deviceSerial, "shell", "input", "swipe",
-			strconv.Itoa(x), strconv.Itoa(yStart), strconv.Itoa(x), strconv.Itoa(yEnd), "200")
-		if err := swipeCmd.Run(); err != nil {
+		swipeCmd := fmt.Sprintf("input swipe %d %d %d %d 200", x, yStart, x, yEnd)
+		if _, err := dev.Output(ctx, swipeCmd); err != nil {
 			return nil, errors.Wrap(err, "scroll swipe")
 		}
 		time.Sleep(300 * time.Millisecond)
@@ -1651,9 +2058,8 @@ func (h *DeviceHandlers) doScrollCapture(adbPath, deviceSerial string, maxHeight
 			x := width / 2
 			yEnd := height * 4 / 5
 			yStart := height / 5
-			swipeCmd := exec.Command(adbPath, "-s", deviceSerial, "shell", "input", "swipe",
-				strconv.Itoa(x), strconv.Itoa(yStart), strconv.Itoa(x), strconv.Itoa(yEnd), "200")
-			if err := swipeCmd.Run(); err != nil {
+			swipeCmd := fmt.Sprintf("input swipe %d %d %d %d 200", x, yStart, x, yEnd)
+			if _, err := dev.Output(ctx, swipeCmd); err != nil {
 				log.Printf("[HandleDeviceScreenshot] scroll back swipe failed: %v", err)
 			}
 			time.Sleep(200 * time.Millisecond)
@@ -1939,26 +2345,20 @@ func (h *DeviceHandlers) handleDeviceFilesRead(w http.ResponseWriter, req *http.
 	absPath := h.resolvePath(path, workingDir)
 
 	if devicePlatform == "mobile" {
-		// For Android, use adb pull or cat
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
-		}
-
-		// Use adb shell cat to read file
-		cmd := exec.Command(adbPath, "-s", deviceSerial, "shell", "cat", absPath)
-		var stdoutBuf, stderrBuf bytes.Buffer
-		cmd.Stdout = &stdoutBuf
-		cmd.Stderr = &stderrBuf
-
-		if err := cmd.Run(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to read file: %v, stderr: %s", err, stderrBuf.String()), http.StatusInternalServerError)
+		// For Android, pull the file through the sync service
+		var content bytes.Buffer
+		if err := adbserver.DefaultClient().Device(deviceSerial).Pull(req.Context(), absPath, &content); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "File not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		w.Write(stdoutBuf.Bytes())
+		w.Write(content.Bytes())
 	} else {
 		// For desktop, read file directly
 		content, err := os.ReadFile(absPath)
@@ -1996,35 +2396,10 @@ func (h *DeviceHandlers) handleDeviceFilesWrite(w http.ResponseWriter, req *http
 	}
 
 	if devicePlatform == "mobile" {
-		// For Android, use adb push or echo
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
-		}
-
-		// Create a temporary file locally
-		tmpFile, err := os.CreateTemp("", "gbox-file-*")
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create temp file: %v", err), http.StatusInternalServerError)
-			return
-		}
-		tmpPath := tmpFile.Name()
-		defer os.Remove(tmpPath)
-
-		if _, err := tmpFile.Write(body); err != nil {
-			tmpFile.Close()
-			http.Error(w, fmt.Sprintf("Failed to write temp file: %v", err), http.StatusInternalServerError)
-			return
-		}
-		tmpFile.Close()
-
-		// Push file to device
-		cmd := exec.Command(adbPath, "-s", deviceSerial, "push", tmpPath, absPath)
-		var stderrBuf bytes.Buffer
-		cmd.Stderr = &stderrBuf
-
-		if err := cmd.Run(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to write file: %v, stderr: %s", err, stderrBuf.String()), http.StatusInternalServerError)
+		// For Android, push the content through the sync service
+		dev := adbserver.DefaultClient().Device(deviceSerial)
+		if err := dev.Push(req.Context(), bytes.NewReader(body), absPath, 0644, time.Time{}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write file: %v", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -2059,18 +2434,10 @@ func (h *DeviceHandlers) handleDeviceFilesDelete(w http.ResponseWriter, req *htt
 	absPath := h.resolvePath(path, workingDir)
 
 	if devicePlatform == "mobile" {
-		// For Android, use adb shell rm
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
-		}
-
-		cmd := exec.Command(adbPath, "-s", deviceSerial, "shell", "rm", "-rf", absPath)
-		var stderrBuf bytes.Buffer
-		cmd.Stderr = &stderrBuf
-
-		if err := cmd.Run(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete file: %v, stderr: %s", err, stderrBuf.String()), http.StatusInternalServerError)
+		// For Android, use rm in the device shell
+		dev := adbserver.DefaultClient().Device(deviceSerial)
+		if _, err := dev.Output(req.Context(), adbserver.Quote("rm", "-rf", absPath)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete file: %v", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -2109,57 +2476,16 @@ func (h *DeviceHandlers) handleDeviceFilesList(w http.ResponseWriter, req *http.
 	}
 
 	if devicePlatform == "mobile" {
-		// For Android, use adb shell ls
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
-		}
-
-		// Use find command for recursive listing with depth
-		var cmd *exec.Cmd
-		if depth > 1 {
-			maxDepth := depth
-			cmd = exec.Command(adbPath, "-s", deviceSerial, "shell", "find", absPath, "-maxdepth", strconv.Itoa(maxDepth), "-exec", "ls", "-ld", "{}", ";")
-		} else {
-			cmd = exec.Command(adbPath, "-s", deviceSerial, "shell", "ls", "-la", absPath)
-		}
-
-		var stdoutBuf, stderrBuf bytes.Buffer
-		cmd.Stdout = &stdoutBuf
-		cmd.Stderr = &stderrBuf
-
-		if err := cmd.Run(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to list files: %v, stderr: %s", err, stderrBuf.String()), http.StatusInternalServerError)
-			return
-		}
-
-		// Parse ls output and convert to JSON format
-		// This is a simplified implementation - in production, you'd want more robust parsing
-		lines := strings.Split(strings.TrimSpace(stdoutBuf.String()), "\n")
+		// For Android, list through the sync service, descending depth levels
 		files := make([]map[string]interface{}, 0)
-		for _, line := range lines {
-			if line == "" {
-				continue
-			}
-			// Parse ls -la output (simplified)
-			parts := strings.Fields(line)
-			if len(parts) < 9 {
-				continue
-			}
-			fileInfo := map[string]interface{}{
-				"name":         parts[8],
-				"path":         absPath + "/" + parts[8],
-				"type":         "dir",
-				"mode":         parts[0],
-				"lastModified": time.Now().Format(time.RFC3339), // ls doesn't provide exact time, use current
-			}
-			if strings.HasPrefix(parts[0], "-") {
-				fileInfo["type"] = "file"
-				if size, err := strconv.ParseInt(parts[4], 10, 64); err == nil {
-					fileInfo["size"] = size
-				}
+		dev := adbserver.DefaultClient().Device(deviceSerial)
+		if err := listDeviceDir(req.Context(), dev, absPath, depth, &files); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "Directory not found", http.StatusNotFound)
+				return
 			}
-			files = append(files, fileInfo)
+			http.Error(w, fmt.Sprintf("Failed to list files: %v", err), http.StatusInternalServerError)
+			return
 		}
 
 		RespondJSON(w, http.StatusOK, files)
@@ -2220,47 +2546,31 @@ func (h *DeviceHandlers) handleDeviceFilesInfo(w http.ResponseWriter, req *http.
 	absPath := h.resolvePath(path, workingDir)
 
 	if devicePlatform == "mobile" {
-		// For Android, use adb shell stat
-		adbPath, err := exec.LookPath("adb")
+		// For Android, stat through the sync service
+		info, err := adbserver.DefaultClient().Device(deviceSerial).Stat(req.Context(), absPath)
 		if err != nil {
-			adbPath = "adb"
-		}
-
-		format := "%n\\|%s\\|%f\\|%Y"
-		cmd := exec.Command(adbPath, "-s", deviceSerial, "shell", "stat", "-c", format, absPath)
-		var stdoutBuf, stderrBuf bytes.Buffer
-		cmd.Stdout = &stdoutBuf
-		cmd.Stderr = &stderrBuf
-
-		if err := cmd.Run(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get file info: %v, stderr: %s", err, stderrBuf.String()), http.StatusInternalServerError)
-			return
-		}
-
-		// Parse stat output
-		output := strings.TrimSpace(stdoutBuf.String())
-		parts := strings.Split(output, "|")
-		if len(parts) < 4 {
-			http.Error(w, "Failed to parse file info", http.StatusInternalServerError)
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "File not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to get file info: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		size, _ := strconv.ParseInt(parts[1], 10, 64)
-		mode, _ := strconv.ParseUint(parts[2], 16, 32)
-		mtime, _ := strconv.ParseInt(parts[3], 10, 64)
-
 		fileType := "file"
-		if os.FileMode(mode).IsDir() {
+		mode := 0100000 | uint32(info.Mode.Perm())
+		if info.IsDir() {
 			fileType = "dir"
+			mode = 040000 | uint32(info.Mode.Perm())
 		}
 
 		fileInfo := map[string]interface{}{
-			"name":         parts[0],
+			"name":         info.Name,
 			"path":         absPath,
 			"type":         fileType,
-			"size":         size,
+			"size":         info.Size,
 			"mode":         fmt.Sprintf("%o", mode),
-			"lastModified": time.Unix(mtime, 0).Format(time.RFC3339),
+			"lastModified": info.ModTime.Format(time.RFC3339),
 		}
 
 		RespondJSON(w, http.StatusOK, fileInfo)
@@ -2311,18 +2621,10 @@ func (h *DeviceHandlers) handleDeviceFilesRename(w http.ResponseWriter, req *htt
 	absNewPath := h.resolvePath(newPath, workingDir)
 
 	if devicePlatform == "mobile" {
-		// For Android, use adb shell mv
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
-		}
-
-		cmd := exec.Command(adbPath, "-s", deviceSerial, "shell", "mv", absOldPath, absNewPath)
-		var stderrBuf bytes.Buffer
-		cmd.Stderr = &stderrBuf
-
-		if err := cmd.Run(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to rename file: %v, stderr: %s", err, stderrBuf.String()), http.StatusInternalServerError)
+		// For Android, use mv in the device shell
+		dev := adbserver.DefaultClient().Device(deviceSerial)
+		if _, err := dev.Output(req.Context(), adbserver.Quote("mv", absOldPath, absNewPath)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to rename file: %v", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -2354,22 +2656,18 @@ func (h *DeviceHandlers) handleDeviceFilesExists(w http.ResponseWriter, req *htt
 	absPath := h.resolvePath(path, workingDir)
 
 	if devicePlatform == "mobile" {
-		// For Android, use adb shell test
-		adbPath, err := exec.LookPath("adb")
-		if err != nil {
-			adbPath = "adb"
+		// For Android, stat through the sync service
+		info, err := adbserver.DefaultClient().Device(deviceSerial).Stat(req.Context(), absPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			http.Error(w, fmt.Sprintf("Failed to check file existence: %v", err), http.StatusInternalServerError)
+			return
 		}
-
-		// Test if file exists
-		cmd := exec.Command(adbPath, "-s", deviceSerial, "shell", "test", "-e", absPath)
-		exists := cmd.Run() == nil
+		exists := err == nil
 
 		// Determine type if exists
 		var fileType string
 		if exists {
-			// Check if it's a directory
-			cmdDir := exec.Command(adbPath, "-s", deviceSerial, "shell", "test", "-d", absPath)
-			if cmdDir.Run() == nil {
+			if info.IsDir() {
 				fileType = "dir"
 			} else {
 				fileType = "file"
@@ -2414,6 +2712,54 @@ func (h *DeviceHandlers) handleDeviceFilesExists(w http.ResponseWriter, req *htt
 
 // Helper methods for file operations
 
+// listDeviceDir appends the entries of dir on an Android device to files,
+// and those of its subdirectories down to depth levels
+func listDeviceDir(ctx context.Context, dev *adbserver.Device, dir string, depth int, files *[]map[string]interface{}) error {
+	entries, err := dev.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		// adbd lists a missing directory as empty
+		if _, err := dev.Stat(ctx, dir); err != nil {
+			return err
+		}
+	}
+	appendDeviceEntries(ctx, dev, dir, entries, depth, files)
+	return nil
+}
+
+// appendDeviceEntries appends entries of dir to files. Subdirectories that
+// cannot be listed get an error field instead of failing the whole listing.
+func appendDeviceEntries(ctx context.Context, dev *adbserver.Device, dir string, entries []adbserver.FileInfo, depth int, files *[]map[string]interface{}) {
+	for _, entry := range entries {
+		filePath := strings.TrimSuffix(dir, "/") + "/" + entry.Name
+
+		fileInfo := map[string]interface{}{
+			"name":         entry.Name,
+			"path":         filePath,
+			"type":         "file",
+			"mode":         entry.Mode.String(),
+			"lastModified": entry.ModTime.Format(time.RFC3339),
+		}
+		if entry.IsDir() {
+			fileInfo["type"] = "dir"
+		} else {
+			fileInfo["size"] = entry.Size
+		}
+		*files = append(*files, fileInfo)
+
+		if entry.IsDir() && depth > 1 {
+			children, err := dev.List(ctx, filePath)
+			if err != nil {
+				fileInfo["error"] = err.Error()
+				continue
+			}
+			appendDeviceEntries(ctx, dev, filePath, children, depth-1, files)
+		}
+	}
+}
+
 // resolvePath resolves a path relative to workingDir
 func (h *DeviceHandlers) resolvePath(path, workingDir string) string {
 	if strings.HasPrefix(path, "/") {
@@ -2561,7 +2907,7 @@ func (h *DeviceHandlers) handleDeviceConnect(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *DeviceHandlers) handleDeviceDisconnect(w http.ResponseWriter, r *http.Request, deviceID string) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/gorilla/websocket"
+)
+
+// eventsKeepAlive is how often an idle event stream sends a keep-alive
+const eventsKeepAlive = 15 * time.Second
+
+// EventHandlers serves the event bus on /api/events
+type EventHandlers struct {
+	bus      *events.Bus
+	upgrader websocket.Upgrader
+}
+
+// NewEventHandlers creates event handlers for a bus
+func NewEventHandlers(bus *events.Bus) *EventHandlers {
+	return &EventHandlers{
+		bus: bus,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: localOrigin,
+		},
+	}
+}
+
+// localOrigin accepts WebSocket connections from clients that send no Origin,
+// and from pages served by this server or another local one, so arbitrary
+// websites cannot read the event stream through the user's browser
+func localOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// HandleEvents streams events as server-sent events, or as JSON messages when
+// the request is a WebSocket upgrade.
+//
+// Query parameters: type selects event types or groups (comma separated or
+// repeated), subject selects a device serial or box ID, and since resumes
+// after an event ID. For SSE the Last-Event-ID header resumes as well.
+func (h *EventHandlers) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := events.Filter{Subject: query.Get("subject")}
+	for _, value := range query["type"] {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.Types = append(filter.Types, t)
+			}
+		}
+	}
+
+	since := query.Get("since")
+	if since == "" {
+		since = r.Header.Get("Last-Event-ID")
+	}
+	var afterID uint64
+	if since != "" {
+		var err error
+		if afterID, err = strconv.ParseUint(since, 10, 64); err != nil {
+			http.Error(w, fmt.Sprintf("invalid event ID %q", since), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r, afterID, filter)
+		return
+	}
+	h.serveSSE(w, r, afterID, filter)
+}
+
+func (h *EventHandlers) serveSSE(w http.ResponseWriter, r *http.Request, afterID uint64, filter events.Filter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := h.bus.Subscribe(afterID, filter)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// Tell clients to wait a little before resuming, and when events were lost
+	fmt.Fprintf(w, "retry: 2000\n\n")
+	if sub.Missed > 0 {
+		fmt.Fprintf(w, ": %d events are no longer retained\n\n", sub.Missed)
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C():
+			if !ok {
+				if sub.Lagged() {
+					log.Printf("event stream for %s fell behind, closing it", r.RemoteAddr)
+				}
+				return
+			}
+			if err := events.WriteSSE(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *EventHandlers) serveWebSocket(w http.ResponseWriter, r *http.Request, afterID uint64, filter events.Filter) {
+	// Subscribe first so no event is lost between the handshake and the subscription
+	sub := h.bus.Subscribe(afterID, filter)
+	defer sub.Close()
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Clients only send control frames; reading is required to notice a close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-sub.C():
+			if !ok {
+				reason := "event stream closed"
+				if sub.Lagged() {
+					reason = "client fell behind, resume with since"
+				}
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason), time.Now().Add(time.Second))
+				return
+			}
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
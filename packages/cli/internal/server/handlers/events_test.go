@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleEventsSSE(t *testing.T) {
+	bus := events.NewBus(10)
+	bus.Publish(events.DeviceState, "emulator-5554", nil)
+	bus.Publish(events.ReconnectAttempt, "emulator-5554", nil)
+	srv := httptest.NewServer(http.HandlerFunc(NewEventHandlers(bus).HandleEvents))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?type=reconnect,ap", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	go bus.Publish(events.APConnected, "emulator-5554", map[string]interface{}{"device_id": "d1"})
+
+	var got []events.Event
+	err = events.ReadSSE(resp.Body, func(e events.Event) error {
+		got = append(got, e)
+		if len(got) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	require.Len(t, got, 2)
+	assert.Equal(t, events.ReconnectAttempt, got[0].Type)
+	assert.Equal(t, uint64(3), got[1].ID)
+	assert.Equal(t, "d1", got[1].Data["device_id"])
+
+	resp, err = http.Get(srv.URL + "?since=abc")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandleEventsWebSocket(t *testing.T) {
+	bus := events.NewBus(10)
+	bus.Publish(events.ForwardStatus, "box-1", map[string]interface{}{"status": "running"})
+	srv := httptest.NewServer(http.HandlerFunc(NewEventHandlers(bus).HandleEvents))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?since=0&subject=box-1", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// since=0 starts with new events only
+	bus.Publish(events.ForwardStatus, "box-2", nil)
+	bus.Publish(events.ForwardStatus, "box-1", map[string]interface{}{"status": "stopped"})
+
+	var e events.Event
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.NoError(t, conn.ReadJSON(&e))
+	assert.Equal(t, uint64(3), e.ID)
+	assert.Equal(t, "stopped", e.Data["status"])
+}
+
+func TestHandleEventsWebSocketOrigin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(NewEventHandlers(events.NewBus(10)).HandleEvents))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	for _, origin := range []string{srv.URL, "http://localhost:3000", "http://127.0.0.1:8080"} {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {origin}})
+		require.NoError(t, err, origin)
+		conn.Close()
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {"https://evil.example.com"}})
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
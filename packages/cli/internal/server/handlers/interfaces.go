@@ -3,6 +3,9 @@ package handlers
 import (
 	"io/fs"
 	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 )
 
 // ServerService defines the interface for server operations that handlers need
@@ -16,6 +19,7 @@ type ServerService interface {
 
 	// Services status
 	IsADBExposeRunning() bool
+	IsLocalOnly() bool // Whether devices are served without the cloud, refusing registration and access point sessions
 
 	// Bridge management
 	ListBridges() []string
@@ -28,6 +32,9 @@ type ServerService interface {
 
 	// Server lifecycle
 	Stop() error
+	Drain(timeout time.Duration) int // Refuses new requests and waits for active streams, returns how many remain
+	ActiveStreams() int
+	IsDraining() bool
 
 	// ADB Expose methods
 	StartPortForward(boxID string, localPorts, remotePorts []int) error
@@ -44,6 +51,39 @@ type ServerService interface {
 	IsDeviceConnected(serial string) bool              // Checks if device is currently connected to AP
 	GetDeviceReconnectState(serial string) interface{} // Returns reconnect state (isReconnecting, attempt, maxRetry)
 	ReconnectRegisteredDevices() error                 // Reconnects all registered devices on server start
+
+	// Reconnect policy, global or per device
+	ReconnectDevice(serial string) error                                    // Retries the AP session now, device.ErrNotRegistered for unknown devices
+	ReconnectPolicy(serial string) device.ReconnectPolicy                   // Returns the policy the device reconnects under
+	SetReconnectPolicy(serial string, policy *device.ReconnectPolicy) error // Overrides the policy of a registered device, nil restores the global one
+
+	// Health checks of Android devices
+	DeviceHealth(serial string, refresh bool) (*serverclient.DeviceHealth, error) // Last health check, nil if never checked; refresh reads the vitals now
+
+	// Android 11+ wireless debugging
+	WirelessDevices() ([]serverclient.WirelessDevice, error)                     // Wireless debugging services found with mDNS
+	PairDevice(req serverclient.PairRequest) (*serverclient.PairResponse, error) // Pairs with a device and connects to it
+
+	// Device labels, keyed by serialno
+	DeviceLabels(serialno string) map[string]string                                                     // Labels of a device, registered or not
+	SetDeviceLabels(serialno string, set map[string]string, remove []string) (map[string]string, error) // Changes labels and pushes them to the cloud for registered devices
+
+	// Device leases, keyed by adb serial or serialno
+	AcquireLease(serial, serialno string, req serverclient.LeaseRequest) (*serverclient.DeviceLease, error) // Leases a device, device.ErrLeased when someone else holds it
+	RenewLease(serial, id string) (*serverclient.DeviceLease, error)                                        // Extends a lease by its TTL
+	ReleaseLease(serial, id string, force bool) (*serverclient.DeviceLease, error)                          // Ends a lease, any lease of the device when force is set
+	DeviceLease(serial string) *serverclient.DeviceLease                                                    // Current lease without its ID, nil when not leased
+	CheckLease(serial, id string) error                                                                     // nil when the device is not leased or id holds it
+
+	// Device registry, kept on disk across restarts
+	RegisteredDevices() []device.RegistryEntry         // Registered devices with their last-known state
+	RecordRegisteredDevice(entry device.RegistryEntry) // Records what the cloud reports about a registered device
+	ForgetDevice(key string)                           // Removes a device by device ID, regId or serial after unregistering
+
+	// ADB connections for exposed box ports
+	ConnectExposedDevice(boxID, host string, port int) (string, error) // Runs adb connect and tags the device with the box ID, returns adb serial
+	DisconnectExposedDevice(serial string) error                       // Runs adb disconnect and drops the box tag
+	GetExposedBoxID(serial string) string                              // Returns box ID for an adb serial connected through adb-expose
 }
 
 // Bridge defines the interface for device bridge operations
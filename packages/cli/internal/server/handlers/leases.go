@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+)
+
+// leaseErrorStatus returns the HTTP status of a lease error
+func leaseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, device.ErrLeased):
+		return http.StatusConflict
+	case errors.Is(err, device.ErrNotLeased):
+		return http.StatusNotFound
+	case errors.Is(err, device.ErrLeaseMismatch):
+		return http.StatusForbidden
+	case errors.Is(err, device.ErrInvalidLease):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// requestLeaseID returns the lease ID a request carries in the lease header,
+// or in the lease query parameter for WebSocket clients
+func requestLeaseID(r *http.Request) string {
+	if id := r.Header.Get(serverclient.LeaseHeader); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("lease")
+}
+
+// RequireLease wraps the handler of a route driving a device or reading its
+// screen, refusing requests to a leased device that do not carry its lease ID
+// with 423
+func (h *DeviceHandlers) RequireLease(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serial := pathParam(r, "serial")
+		if strings.Contains(r.Header.Get("via"), "gbox-device-ap") {
+			if resolved := h.serverService.GetSerialByDeviceId(serial); resolved != "" {
+				serial = resolved
+			}
+		}
+		if err := h.serverService.CheckLease(serial, requestLeaseID(r)); err != nil {
+			RespondJSON(w, http.StatusLocked, map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// HandleDeviceLease returns the lease of a device on GET, leases it on POST,
+// renews the lease on PUT and releases it on DELETE. Renewing and releasing
+// need the lease ID in the X-Gbox-Lease header; DELETE with force=true
+// releases any lease of the device.
+func (h *DeviceHandlers) HandleDeviceLease(w http.ResponseWriter, r *http.Request) {
+	serial := pathParam(r, "serial")
+	if serial == "" {
+		http.Error(w, "Device serial required", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		lease *serverclient.DeviceLease
+		err   error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		if lease = h.serverService.DeviceLease(serial); lease == nil {
+			err = device.ErrNotLeased
+		}
+	case http.MethodPost:
+		dto := h.leaseDevice(serial)
+		if dto == nil {
+			RespondJSON(w, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("device not found: %s", serial),
+			})
+			return
+		}
+		var req serverclient.LeaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   "Invalid request body",
+			})
+			return
+		}
+		if req.Cleanup && dto.OS != "android" {
+			err = fmt.Errorf("%w: cleanup is only supported on Android devices", device.ErrInvalidLease)
+			break
+		}
+		lease, err = h.serverService.AcquireLease(dto.TransportID, dto.Serialno, req)
+	case http.MethodPut:
+		lease, err = h.serverService.RenewLease(serial, requestLeaseID(r))
+	case http.MethodDelete:
+		force := r.URL.Query().Get("force") == "true"
+		lease, err = h.serverService.ReleaseLease(serial, requestLeaseID(r), force)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		RespondJSON(w, leaseErrorStatus(err), map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	RespondJSON(w, http.StatusOK, lease)
+}
+
+// HandleLeaseAny leases any free device whose labels match the selector of
+// the request
+func (h *DeviceHandlers) HandleLeaseAny(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req serverclient.LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+		return
+	}
+	selector, err := device.ParseSelector(req.Selector)
+	if err != nil {
+		RespondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// Another request may lease a candidate first, the next one is tried then
+	for _, dto := range selectDevices(h.leasableDevices(), selector, true) {
+		if req.Cleanup && dto.OS != "android" {
+			continue
+		}
+		lease, err := h.serverService.AcquireLease(dto.TransportID, dto.Serialno, req)
+		if errors.Is(err, device.ErrLeased) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to lease device %s: %v", dto.TransportID, err)
+			RespondJSON(w, leaseErrorStatus(err), map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		RespondJSON(w, http.StatusOK, lease)
+		return
+	}
+	RespondJSON(w, http.StatusConflict, map[string]interface{}{
+		"success": false,
+		"error":   fmt.Sprintf("no free device matches selector %q", req.Selector),
+	})
+}
+
+// leaseDevice returns the device with an adb serial, a serialno, or local
+// for this machine. Registered devices may be leased while they are away.
+func (h *DeviceHandlers) leaseDevice(serial string) *DeviceDTO {
+	for _, dto := range h.getLocalDeviceList() {
+		if dto.TransportID == serial || dto.Serialno == serial {
+			return &dto
+		}
+	}
+	for _, entry := range h.currentRegistryEntries() {
+		if entry.Serial == serial || entry.Serialno == serial {
+			return &DeviceDTO{
+				ID:           entry.DeviceID,
+				TransportID:  entry.Serial,
+				Serialno:     entry.Serialno,
+				Platform:     entry.DeviceType,
+				OS:           entry.OsType,
+				IsRegistered: true,
+			}
+		}
+	}
+	return nil
+}
+
+// leasableDevices lists the attached devices with what decides whether they
+// are free: labels, health, lease and adb-expose box, without asking the
+// cloud
+func (h *DeviceHandlers) leasableDevices() []DeviceDTO {
+	dtos := h.getLocalDeviceList()
+	for i := range dtos {
+		dto := &dtos[i]
+		dto.Labels = h.serverService.DeviceLabels(dto.Serialno)
+		dto.Lease = h.serverService.DeviceLease(dto.TransportID)
+		if !dto.IsLocal {
+			dto.BoxID = h.serverService.GetExposedBoxID(dto.TransportID)
+			dto.Health, _ = h.serverService.DeviceHealth(dto.TransportID, false)
+		}
+	}
+	return dtos
+}
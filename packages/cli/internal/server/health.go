@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/pkg/errors"
+)
+
+// healthState is the last health check of a device
+type healthState struct {
+	Health *device.Health
+	// Err is why the last check failed, Health is then the one before
+	Err           string
+	Quarantined   bool
+	Reasons       []string
+	QuarantinedAt time.Time
+	// DeviceId is the cloud device marked unavailable while quarantined
+	DeviceId string
+}
+
+// globalHealthThresholds reads the health thresholds from the config,
+// falling back to the defaults when they are invalid
+func globalHealthThresholds() device.HealthThresholds {
+	thresholds := device.HealthThresholds{
+		Quarantine:     config.GetHealthQuarantine(),
+		MinBattery:     config.GetHealthMinBattery(),
+		MaxTemperature: config.GetHealthMaxTemperature(),
+		MinStorage:     int64(config.GetHealthMinStorageMB()) << 20,
+		MaxCPULoad:     config.GetHealthMaxCPULoad(),
+	}
+	if err := thresholds.Validate(); err != nil {
+		log.Printf("Warning: invalid health thresholds in config, using the defaults: %v", err)
+		return device.DefaultHealthThresholds()
+	}
+	return thresholds
+}
+
+// startHealthChecks reads the vitals of all online Android devices every
+// interval until the keeper is closed
+func (dm *DeviceKeeper) startHealthChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dm.checkDevicesHealth()
+		case <-dm.done:
+			return
+		}
+	}
+}
+
+// checkDevicesHealth checks the online Android devices side by side
+func (dm *DeviceKeeper) checkDevicesHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	entries, err := dm.adb.Devices(ctx)
+	if err != nil {
+		log.Printf("Health check: failed to list adb devices: %v", err)
+		return
+	}
+
+	online := make(map[string]bool)
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		if entry.State != "device" {
+			continue
+		}
+		online[entry.Serial] = true
+		wg.Add(1)
+		go func(serial string) {
+			defer wg.Done()
+			if _, err := dm.CheckDeviceHealth(serial); err != nil {
+				log.Printf("Health check: %v", err)
+			}
+		}(entry.Serial)
+	}
+	wg.Wait()
+
+	// Quarantined devices stay quarantined while they are away, so they are
+	// not connected before their vitals are read again
+	dm.healthMu.Lock()
+	for serial, state := range dm.healthStates {
+		if !online[serial] && !state.Quarantined {
+			delete(dm.healthStates, serial)
+		}
+	}
+	dm.healthMu.Unlock()
+}
+
+// CheckDeviceHealth reads the vitals of a device now, quarantines it when
+// they breach the thresholds and releases it once they recover
+func (dm *DeviceKeeper) CheckDeviceHealth(serial string) (*serverclient.DeviceHealth, error) {
+	health, err := dm.readHealth(serial)
+
+	dm.healthMu.Lock()
+	state, ok := dm.healthStates[serial]
+	if !ok {
+		if err != nil {
+			dm.healthMu.Unlock()
+			return nil, err
+		}
+		state = &healthState{}
+		dm.healthStates[serial] = state
+	}
+	if err != nil {
+		state.Err = err.Error()
+		view := state.view(serial)
+		dm.healthMu.Unlock()
+		return view, err
+	}
+
+	state.Health, state.Err = health, ""
+	violations := dm.thresholds.Violations(*health, state.Quarantined)
+	quarantine := dm.thresholds.Quarantine && !state.Quarantined && len(violations) > 0
+	release := state.Quarantined && len(violations) == 0
+	switch {
+	case quarantine:
+		dm.mu.RLock()
+		deviceId, _ := dm.adbDeviceBiMap.Get(serial)
+		dm.mu.RUnlock()
+		state.Quarantined = true
+		state.Reasons = violations
+		state.QuarantinedAt = health.CheckedAt
+		state.DeviceId = deviceId
+	case release:
+		state.Quarantined = false
+		state.Reasons = nil
+		state.QuarantinedAt = time.Time{}
+	case state.Quarantined:
+		state.Reasons = violations
+	}
+	deviceId := state.DeviceId
+	view := state.view(serial)
+	dm.healthMu.Unlock()
+
+	if quarantine {
+		dm.quarantine(serial, deviceId, violations)
+	}
+	if release {
+		dm.release(serial, deviceId)
+	}
+	return view, nil
+}
+
+// quarantine disconnects a device from the access point and marks it
+// unavailable in the cloud
+func (dm *DeviceKeeper) quarantine(serial, deviceId string, reasons []string) {
+	reason := strings.Join(reasons, "; ")
+	log.Printf("device %s: quarantined: %s", serial, reason)
+
+	dm.cancelReconnect(serial, "quarantined")
+	if session, ok := dm.getDevice(serial); ok {
+		dm.deviceLock.LockKey(serial)
+		// Delete the session first so its closing mux is not taken for a
+		// lost connection and reconnected
+		if dm.delDevice(session) {
+			events.Publish(events.APDisconnected, serial, map[string]interface{}{
+				"device_id": deviceId,
+				"reason":    "quarantined",
+			})
+		}
+		if session.Mux != nil {
+			session.Mux.Close()
+		}
+		dm.deviceLock.UnlockKey(serial)
+		dm.registry.SetState(serial, device.StateDisconnected)
+	}
+
+	if deviceId != "" && !dm.localOnly {
+		if err := dm.setAvailable(deviceId, false, reason); err != nil {
+			log.Printf("device %s: failed to mark device %s unavailable: %v", serial, deviceId, err)
+		}
+	}
+	events.Publish(events.DeviceQuarantined, serial, map[string]interface{}{
+		"device_id": deviceId,
+		"reasons":   reasons,
+	})
+}
+
+// release marks a recovered device available again and reconnects it
+func (dm *DeviceKeeper) release(serial, deviceId string) {
+	log.Printf("device %s: released from quarantine", serial)
+
+	if deviceId != "" && !dm.localOnly {
+		if err := dm.setAvailable(deviceId, true, ""); err != nil {
+			log.Printf("device %s: failed to mark device %s available: %v", serial, deviceId, err)
+		}
+	}
+	events.Publish(events.DeviceReleased, serial, map[string]interface{}{
+		"device_id": deviceId,
+	})
+
+	if err := dm.ReconnectDevice(serial); err != nil && !errors.Is(err, device.ErrNotRegistered) && !errors.Is(err, device.ErrLocalOnly) {
+		log.Printf("device %s: failed to reconnect after quarantine: %v", serial, err)
+	}
+}
+
+// IsQuarantined reports whether the health checks hold a device back
+func (dm *DeviceKeeper) IsQuarantined(serial string) bool {
+	dm.healthMu.RLock()
+	defer dm.healthMu.RUnlock()
+	state, ok := dm.healthStates[serial]
+	return ok && state.Quarantined
+}
+
+// DeviceHealth returns the last health check of a device, nil if it was
+// never checked. refresh reads the vitals now.
+func (dm *DeviceKeeper) DeviceHealth(serial string, refresh bool) (*serverclient.DeviceHealth, error) {
+	if refresh {
+		return dm.CheckDeviceHealth(serial)
+	}
+	dm.healthMu.RLock()
+	defer dm.healthMu.RUnlock()
+	state, ok := dm.healthStates[serial]
+	if !ok {
+		return nil, nil
+	}
+	return state.view(serial), nil
+}
+
+// view returns the API representation of the state, the caller holds healthMu
+func (s *healthState) view(serial string) *serverclient.DeviceHealth {
+	view := &serverclient.DeviceHealth{
+		Serial:            serial,
+		Error:             s.Err,
+		Quarantined:       s.Quarantined,
+		QuarantineReasons: append([]string(nil), s.Reasons...),
+	}
+	if h := s.Health; h != nil {
+		checkedAt := h.CheckedAt
+		view.BatteryLevel = h.BatteryLevel
+		view.BatteryTemperature = h.BatteryTemperature
+		view.Charging = h.Charging
+		view.StorageFree = h.StorageFree
+		view.StorageTotal = h.StorageTotal
+		view.CPULoad = h.CPULoad
+		view.ScreenOn = h.ScreenOn
+		view.CheckedAt = &checkedAt
+		view.Errors = append([]string(nil), h.Errors...)
+	}
+	if s.Quarantined {
+		quarantinedAt := s.QuarantinedAt
+		view.QuarantinedAt = &quarantinedAt
+	}
+	return view
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/keymutex"
+)
+
+// fakeVitals serves the health of the test device and records the cloud
+// availability updates
+type fakeVitals struct {
+	mu        sync.Mutex
+	health    device.Health
+	available []bool
+}
+
+func (f *fakeVitals) set(h device.Health) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.health = h
+}
+
+func (f *fakeVitals) read(serial string) (*device.Health, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h := f.health
+	h.CheckedAt = time.Now()
+	return &h, nil
+}
+
+func (f *fakeVitals) setAvailable(deviceId string, available bool, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.available = append(f.available, available)
+	return nil
+}
+
+func (f *fakeVitals) updates() []bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]bool(nil), f.available...)
+}
+
+func TestHealthQuarantineAndRelease(t *testing.T) {
+	sub := events.Default.Subscribe(0, events.Filter{
+		Types:   []string{string(events.DeviceQuarantined), string(events.DeviceReleased)},
+		Subject: "emulator-5554",
+	})
+	defer sub.Close()
+
+	conn := &fakeConnector{}
+	dm, clk := newReconnectKeeper(t, device.DefaultReconnectPolicy(), conn)
+	vitals := &fakeVitals{health: device.Health{BatteryLevel: 80, BatteryTemperature: 30, StorageFree: 1 << 30}}
+	dm.deviceLock = keymutex.NewHashed(16)
+	dm.healthStates = make(map[string]*healthState)
+	dm.thresholds = device.DefaultHealthThresholds()
+	dm.readHealth = vitals.read
+	dm.setAvailable = vitals.setAvailable
+	dm.adbDeviceBiMap.Insert("emulator-5554", "dev-1")
+
+	next := func() events.Event {
+		select {
+		case event := <-sub.C():
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no health event")
+			return events.Event{}
+		}
+	}
+
+	health, err := dm.CheckDeviceHealth("emulator-5554")
+	require.NoError(t, err)
+	assert.False(t, health.Quarantined)
+	assert.Equal(t, 80, health.BatteryLevel)
+
+	vitals.set(device.Health{BatteryLevel: 80, BatteryTemperature: 55, StorageFree: 1 << 30})
+	health, err = dm.CheckDeviceHealth("emulator-5554")
+	require.NoError(t, err)
+	assert.True(t, health.Quarantined)
+	assert.Equal(t, []string{"temperature 55.0°C is above 50°C"}, health.QuarantineReasons)
+	assert.NotNil(t, health.QuarantinedAt)
+	event := next()
+	assert.Equal(t, events.DeviceQuarantined, event.Type)
+	assert.Equal(t, "dev-1", event.Data["device_id"])
+	assert.Equal(t, []bool{false}, vitals.updates())
+
+	// A quarantined device is not connected
+	assert.True(t, dm.IsQuarantined("emulator-5554"))
+	assert.ErrorIs(t, dm.ReconnectDevice("dev-1"), device.ErrQuarantined)
+	assert.ErrorIs(t, dm.connectAPUsingDeviceId("emulator-5554", "dev-1", "mobile", "android"), device.ErrQuarantined)
+
+	// Below the threshold but within the hysteresis it stays quarantined
+	vitals.set(device.Health{BatteryLevel: 80, BatteryTemperature: 48, StorageFree: 1 << 30})
+	health, err = dm.CheckDeviceHealth("emulator-5554")
+	require.NoError(t, err)
+	assert.True(t, health.Quarantined)
+	assert.Equal(t, []string{"temperature 48.0°C is above 47°C"}, health.QuarantineReasons)
+
+	vitals.set(device.Health{BatteryLevel: 80, BatteryTemperature: 40, StorageFree: 1 << 30})
+	health, err = dm.CheckDeviceHealth("emulator-5554")
+	require.NoError(t, err)
+	assert.False(t, health.Quarantined)
+	assert.Nil(t, health.QuarantinedAt)
+	event = next()
+	assert.Equal(t, events.DeviceReleased, event.Type)
+	assert.Equal(t, []bool{false, true}, vitals.updates())
+
+	// The released device is reconnected right away
+	assert.Equal(t, time.Duration(0), clk.nextWait(t))
+	clk.Advance(0)
+	assert.Eventually(t, func() bool { return conn.count() == 1 }, 5*time.Second, time.Millisecond)
+}
+
+func TestHealthReportOnly(t *testing.T) {
+	dm, _ := newReconnectKeeper(t, device.DefaultReconnectPolicy(), &fakeConnector{})
+	vitals := &fakeVitals{health: device.Health{BatteryLevel: 3}}
+	dm.healthStates = make(map[string]*healthState)
+	dm.thresholds = device.DefaultHealthThresholds()
+	dm.thresholds.Quarantine = false
+	dm.readHealth = vitals.read
+	dm.setAvailable = vitals.setAvailable
+
+	health, err := dm.DeviceHealth("emulator-5554", false)
+	require.NoError(t, err)
+	assert.Nil(t, health, "never checked")
+
+	health, err = dm.DeviceHealth("emulator-5554", true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, health.BatteryLevel)
+	assert.False(t, health.Quarantined)
+	assert.False(t, dm.IsQuarantined("emulator-5554"))
+	assert.Empty(t, vitals.updates())
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DeviceLabels returns the labels of the device with a serialno
+func (dm *DeviceKeeper) DeviceLabels(serialno string) map[string]string {
+	return dm.registry.Labels(serialno)
+}
+
+// SetDeviceLabels sets and removes labels of the device with a serialno and
+// pushes them to the cloud metadata of the device when it is registered,
+// unless the server is local-only. The labels are kept locally even when the
+// push fails, the error says so.
+func (dm *DeviceKeeper) SetDeviceLabels(serialno string, set map[string]string, remove []string) (map[string]string, error) {
+	labels := dm.registry.SetLabels(serialno, set, remove)
+	if dm.localOnly {
+		return labels, nil
+	}
+
+	for _, entry := range dm.registry.List() {
+		if entry.Serialno != serialno && entry.Serial != serialno {
+			continue
+		}
+		if err := dm.setLabels(entry.DeviceID, labels); err != nil {
+			return labels, errors.Wrapf(err, "labels are saved locally but failed to update device %s in the cloud", entry.DeviceID)
+		}
+	}
+	return labels, nil
+}
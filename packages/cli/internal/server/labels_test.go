@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDeviceLabels(t *testing.T) {
+	dm, _ := newReconnectKeeper(t, device.DefaultReconnectPolicy(), &fakeConnector{})
+	dm.registry.Put(device.RegistryEntry{DeviceID: "dev-1", Serialno: "R58N123ABC"})
+	pushed := map[string]map[string]string{}
+	dm.setLabels = func(deviceId string, labels map[string]string) error {
+		pushed[deviceId] = labels
+		return nil
+	}
+
+	labels, err := dm.SetDeviceLabels("R58N123ABC", map[string]string{"team": "qa", "os": "14"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "qa", "os": "14"}, labels)
+	assert.Equal(t, labels, pushed["dev-1"], "labels of registered devices go to the cloud")
+
+	// Devices that are not registered keep their labels locally only
+	_, err = dm.SetDeviceLabels("UNREGISTERED", map[string]string{"team": "dev"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, pushed, 1)
+	assert.Equal(t, map[string]string{"team": "dev"}, dm.DeviceLabels("UNREGISTERED"))
+
+	// A failed push keeps the change
+	dm.setLabels = func(string, map[string]string) error { return errors.New("offline") }
+	labels, err = dm.SetDeviceLabels("R58N123ABC", nil, []string{"os"})
+	assert.ErrorContains(t, err, "offline")
+	assert.Equal(t, map[string]string{"team": "qa"}, labels)
+	assert.Equal(t, labels, dm.DeviceLabels("R58N123ABC"))
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/pkg/errors"
+)
+
+// leaseExpiryInterval is how often expired leases are swept
+const leaseExpiryInterval = 5 * time.Second
+
+// leaseTTL returns the TTL a lease asks for, the configured default when
+// empty, and checks it against the configured maximum
+func leaseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return config.GetLeaseTTL(), nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("%w: TTL %q is not a positive duration such as 30m", device.ErrInvalidLease, s)
+	}
+	if max := config.GetLeaseMaxTTL(); max > 0 && ttl > max {
+		return 0, fmt.Errorf("%w: TTL %s exceeds the maximum of %s", device.ErrInvalidLease, ttl, max)
+	}
+	return ttl, nil
+}
+
+// leaseView returns a lease as the API serves it, without its ID
+func leaseView(lease device.Lease) *serverclient.DeviceLease {
+	return &serverclient.DeviceLease{
+		Serial:     lease.Serial,
+		Serialno:   lease.Serialno,
+		Owner:      lease.Owner,
+		TTL:        lease.TTL.String(),
+		AcquiredAt: lease.AcquiredAt,
+		RenewedAt:  lease.RenewedAt,
+		ExpiresAt:  lease.ExpiresAt,
+		Cleanup:    lease.Cleanup,
+	}
+}
+
+// AcquireLease leases the device with an adb serial and serialno to
+// req.Owner. With req.Cleanup the third-party apps are listed first, the
+// ones installed during the lease are uninstalled when it ends.
+func (dm *DeviceKeeper) AcquireLease(serial, serialno string, req serverclient.LeaseRequest) (*serverclient.DeviceLease, error) {
+	ttl, err := leaseTTL(req.TTL)
+	if err != nil {
+		return nil, err
+	}
+	lease := device.Lease{Serial: serial, Serialno: serialno, Owner: req.Owner, TTL: ttl, Cleanup: req.Cleanup}
+	if req.Cleanup {
+		if lease.Packages, err = dm.thirdPartyPackages(serial); err != nil {
+			return nil, errors.Wrapf(err, "failed to list the apps of device %s to clean up after the lease", serial)
+		}
+	}
+
+	acquired, expired, err := dm.leases.Acquire(lease)
+	if err != nil {
+		return nil, err
+	}
+	if expired != nil {
+		dm.endLease(*expired, events.LeaseExpired)
+	}
+	log.Printf("device %s: leased to %s for %s", serial, acquired.Owner, acquired.TTL)
+	events.Publish(events.LeaseAcquired, serial, map[string]interface{}{
+		"owner":      acquired.Owner,
+		"expires_at": acquired.ExpiresAt,
+	})
+
+	view := leaseView(acquired)
+	view.ID = acquired.ID
+	return view, nil
+}
+
+// RenewLease extends the lease with id on a device by its TTL
+func (dm *DeviceKeeper) RenewLease(serial, id string) (*serverclient.DeviceLease, error) {
+	lease, err := dm.leases.Renew(serial, id)
+	if err != nil {
+		return nil, err
+	}
+	view := leaseView(lease)
+	view.ID = lease.ID
+	return view, nil
+}
+
+// ReleaseLease ends the lease with id on a device, any lease of it when
+// force is set, and cleans up after it
+func (dm *DeviceKeeper) ReleaseLease(serial, id string, force bool) (*serverclient.DeviceLease, error) {
+	lease, err := dm.leases.Release(serial, id, force)
+	if err != nil {
+		return nil, err
+	}
+	dm.endLease(lease, events.LeaseReleased)
+	return leaseView(lease), nil
+}
+
+// DeviceLease returns the current lease of a device, nil when it is not leased
+func (dm *DeviceKeeper) DeviceLease(serial string) *serverclient.DeviceLease {
+	lease, ok := dm.leases.Get(serial)
+	if !ok {
+		return nil
+	}
+	return leaseView(lease)
+}
+
+// CheckLease returns nil when a device is not leased or the lease with id
+// holds it, else device.ErrLeased
+func (dm *DeviceKeeper) CheckLease(serial, id string) error {
+	return dm.leases.Check(serial, id)
+}
+
+// startLeaseExpiry sweeps expired leases every interval until the keeper
+// is closed
+func (dm *DeviceKeeper) startLeaseExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dm.expireLeases()
+		case <-dm.done:
+			return
+		}
+	}
+}
+
+// expireLeases ends the leases that were not renewed in time
+func (dm *DeviceKeeper) expireLeases() {
+	for _, lease := range dm.leases.Expire() {
+		dm.endLease(lease, events.LeaseExpired)
+	}
+}
+
+// endLease uninstalls the apps installed during a lease that asked for
+// cleanup and publishes how the lease ended
+func (dm *DeviceKeeper) endLease(lease device.Lease, how events.Type) {
+	var removed []string
+	if lease.Cleanup {
+		var err error
+		if removed, err = dm.cleanupLease(lease); err != nil {
+			log.Printf("device %s: failed to clean up after the lease of %s: %v", lease.Serial, lease.Owner, err)
+		}
+	}
+	if how == events.LeaseExpired {
+		log.Printf("device %s: lease of %s expired", lease.Serial, lease.Owner)
+	} else {
+		log.Printf("device %s: lease of %s released", lease.Serial, lease.Owner)
+	}
+	data := map[string]interface{}{"owner": lease.Owner}
+	if len(removed) > 0 {
+		data["uninstalled"] = removed
+	}
+	events.Publish(how, lease.Serial, data)
+}
+
+// cleanupLease uninstalls the third-party apps that were not installed when
+// a lease was taken and returns them
+func (dm *DeviceKeeper) cleanupLease(lease device.Lease) ([]string, error) {
+	packages, err := dm.thirdPartyPackages(lease.Serial)
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[string]bool, len(lease.Packages))
+	for _, p := range lease.Packages {
+		before[p] = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var removed []string
+	for _, p := range packages {
+		if before[p] {
+			continue
+		}
+		out, err := dm.adb.Device(lease.Serial).Output(ctx, "pm uninstall "+adbserver.Quote(p))
+		if err != nil {
+			log.Printf("device %s: failed to uninstall %s: %v", lease.Serial, p, err)
+			continue
+		}
+		if !strings.Contains(string(out), "Success") {
+			log.Printf("device %s: failed to uninstall %s: %s", lease.Serial, p, strings.TrimSpace(string(out)))
+			continue
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
+
+// thirdPartyPackages lists the packages installed by users on a device
+func (dm *DeviceKeeper) thirdPartyPackages(serial string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := dm.adb.Device(serial).Output(ctx, "pm list packages -3")
+	if err != nil {
+		return nil, err
+	}
+	var packages []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if p, ok := strings.CutPrefix(strings.TrimSpace(line), "package:"); ok && p != "" {
+			packages = append(packages, p)
+		}
+	}
+	return packages, nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePackages serves pm list packages -3 and pm uninstall of the test device
+type fakePackages struct {
+	mu       sync.Mutex
+	packages []string
+}
+
+func (f *fakePackages) install(p string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.packages = append(f.packages, p)
+}
+
+func (f *fakePackages) serve(d *adbtest.Device) {
+	d.HandleShell("pm list packages -3", func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, p := range f.packages {
+			fmt.Fprintf(stdout, "package:%s\n", p)
+		}
+		return 0
+	})
+	for _, p := range []string{"com.example.app", "com.example.test"} {
+		d.HandleShell("pm uninstall "+p, func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			removed := strings.TrimPrefix(cmd, "pm uninstall ")
+			for i, installed := range f.packages {
+				if installed == removed {
+					f.packages = append(f.packages[:i], f.packages[i+1:]...)
+					fmt.Fprintln(stdout, "Success")
+					return 0
+				}
+			}
+			fmt.Fprintln(stdout, "Failure [DELETE_FAILED_INTERNAL_ERROR]")
+			return 1
+		})
+	}
+}
+
+func TestLeaseExpiryCleansUp(t *testing.T) {
+	sub := events.Default.Subscribe(0, events.Filter{
+		Types:   []string{string(events.LeaseAcquired), string(events.LeaseExpired)},
+		Subject: "emulator-5554",
+	})
+	defer sub.Close()
+
+	adbServer := adbtest.NewServer(t)
+	packages := &fakePackages{packages: []string{"com.example.app"}}
+	packages.serve(adbServer.AddDevice("emulator-5554"))
+
+	dm, clk := newReconnectKeeper(t, device.DefaultReconnectPolicy(), &fakeConnector{})
+	dm.adb = adbServer.Client()
+	dm.leases = device.NewLeases(clk.Now)
+
+	lease, err := dm.AcquireLease("emulator-5554", "EMULATOR35X1", serverclient.LeaseRequest{Owner: "ci-42", TTL: "1m", Cleanup: true})
+	require.NoError(t, err)
+	assert.NotEmpty(t, lease.ID)
+	assert.Equal(t, "1m0s", lease.TTL)
+	assert.ErrorIs(t, dm.CheckLease("EMULATOR35X1", ""), device.ErrLeased)
+	assert.NoError(t, dm.CheckLease("emulator-5554", lease.ID))
+
+	_, err = dm.AcquireLease("emulator-5554", "EMULATOR35X1", serverclient.LeaseRequest{Owner: "ci-42", TTL: "1000h"})
+	assert.ErrorIs(t, err, device.ErrInvalidLease)
+
+	// The test installs an app and stops renewing
+	packages.install("com.example.test")
+	clk.Advance(time.Minute)
+	assert.Nil(t, dm.DeviceLease("emulator-5554"))
+	dm.expireLeases()
+	assert.Equal(t, []string{"com.example.app"}, packages.packages, "apps installed before the lease are kept")
+
+	next := func() events.Event {
+		select {
+		case event := <-sub.C():
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no lease event")
+			return events.Event{}
+		}
+	}
+	assert.Equal(t, events.LeaseAcquired, next().Type)
+	event := next()
+	assert.Equal(t, events.LeaseExpired, event.Type)
+	assert.Equal(t, []string{"com.example.test"}, event.Data["uninstalled"])
+}
+
+func TestLeaseRenewAndRelease(t *testing.T) {
+	dm, clk := newReconnectKeeper(t, device.DefaultReconnectPolicy(), &fakeConnector{})
+	dm.leases = device.NewLeases(clk.Now)
+
+	lease, err := dm.AcquireLease("emulator-5554", "", serverclient.LeaseRequest{Owner: "ci-42", TTL: "1m"})
+	require.NoError(t, err)
+
+	clk.Advance(50 * time.Second)
+	renewed, err := dm.RenewLease("emulator-5554", lease.ID)
+	require.NoError(t, err)
+	assert.Equal(t, clk.Now().Add(time.Minute), renewed.ExpiresAt)
+
+	clk.Advance(50 * time.Second)
+	current := dm.DeviceLease("emulator-5554")
+	require.NotNil(t, current)
+	assert.Empty(t, current.ID)
+	assert.Equal(t, "ci-42", current.Owner)
+
+	_, err = dm.ReleaseLease("emulator-5554", "other", false)
+	assert.ErrorIs(t, err, device.ErrLeaseMismatch)
+	_, err = dm.ReleaseLease("emulator-5554", lease.ID, false)
+	require.NoError(t, err)
+	assert.Nil(t, dm.DeviceLease("emulator-5554"))
+	assert.NoError(t, dm.CheckLease("emulator-5554", ""))
+}
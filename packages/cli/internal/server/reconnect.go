@@ -0,0 +1,338 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/pkg/errors"
+)
+
+// clock is the time source of reconnect loops, tests replace it with a fake
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// reconnectState tracks the reconnection state for a device
+type reconnectState struct {
+	IsReconnecting bool
+	Attempt        int
+	MaxRetry       int // 0 retries forever
+	Serial         string
+	DeviceId       string
+	DisconnectedAt time.Time // When the device was disconnected
+	CoolingDown    bool      // The breaker is open after too many failures in a row
+	NextAttemptAt  time.Time
+
+	cancel chan struct{} // closed when the loop must stop
+	wake   chan struct{} // a manual reconnect skips the current wait
+}
+
+// globalReconnectPolicy reads the reconnect policy from the config, falling
+// back to the default when the configured one is unusable
+func globalReconnectPolicy() device.ReconnectPolicy {
+	policy := device.ReconnectPolicy{
+		MaxAttempts:      config.GetReconnectMaxAttempts(),
+		BaseDelay:        config.GetReconnectBaseDelay(),
+		MaxDelay:         config.GetReconnectMaxDelay(),
+		BreakerThreshold: config.GetReconnectBreakerThreshold(),
+		Cooldown:         config.GetReconnectCooldown(),
+		CancelOnOffline:  config.GetReconnectCancelOnOffline(),
+	}
+	if err := policy.Validate(); err != nil {
+		log.Printf("Warning: invalid reconnect policy in config, using the default: %v", err)
+		return device.DefaultReconnectPolicy()
+	}
+	return policy
+}
+
+// ReconnectPolicy returns the reconnect policy of a device: its own if one
+// was set, the global policy otherwise
+func (dm *DeviceKeeper) ReconnectPolicy(serial string) device.ReconnectPolicy {
+	if e, ok := dm.registry.Get(serial); ok && e.Reconnect != nil {
+		return *e.Reconnect
+	}
+	return dm.policy
+}
+
+// SetReconnectPolicy gives a registered device its own reconnect policy, nil
+// goes back to the global one. A running reconnect loop keeps its policy
+// until the device reconnects or ReconnectDevice restarts it.
+func (dm *DeviceKeeper) SetReconnectPolicy(serial string, policy *device.ReconnectPolicy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return errors.Wrap(err, "invalid reconnect policy")
+		}
+	}
+	if !dm.registry.SetReconnectPolicy(serial, policy) {
+		return device.ErrNotRegistered
+	}
+	return nil
+}
+
+// ReconnectDevice retries the access point session of a registered device
+// now. A running reconnect loop stops waiting and starts over at the base
+// delay; otherwise a new loop starts, also after an earlier one gave up.
+func (dm *DeviceKeeper) ReconnectDevice(key string) error {
+	if dm.localOnly {
+		return errors.Wrapf(device.ErrLocalOnly, "failed to reconnect device %s", key)
+	}
+	serial, deviceId, deviceType, osType := dm.lookupReconnectTarget(key)
+	if deviceId == "" {
+		return device.ErrNotRegistered
+	}
+	if dm.IsQuarantined(serial) {
+		return errors.Wrapf(device.ErrQuarantined, "failed to reconnect device %s", serial)
+	}
+
+	dm.reconnectMu.Lock()
+	state, ok := dm.reconnectStates[serial]
+	if ok && state.IsReconnecting {
+		select {
+		case state.wake <- struct{}{}:
+		default:
+		}
+		dm.reconnectMu.Unlock()
+		log.Printf("device %s: manual reconnect, retrying now", serial)
+		return nil
+	}
+	dm.reconnectMu.Unlock()
+
+	log.Printf("device %s: manual reconnect, starting reconnection", serial)
+	dm.disconnectStale(serial)
+	go dm.reconnectDevice(serial, deviceId, deviceType, osType, true)
+	return nil
+}
+
+// lookupReconnectTarget finds the session key, device ID and type of a device
+// by session key, device ID or regId
+func (dm *DeviceKeeper) lookupReconnectTarget(key string) (serial, deviceId, deviceType, osType string) {
+	if e, ok := dm.registry.Get(key); ok {
+		serial, deviceId, deviceType, osType = e.Serial, e.DeviceID, e.DeviceType, e.OsType
+	}
+	if serial == "" {
+		serial = key
+	}
+	if deviceId == "" {
+		dm.mu.RLock()
+		deviceId, _ = dm.adbDeviceBiMap.Get(serial)
+		dm.mu.RUnlock()
+	}
+	if deviceType == "" {
+		if session, ok := dm.getDevice(serial); ok {
+			deviceType, osType = session.DeviceType, session.OsType
+		} else if info := dm.GetDeviceInfo(serial); info != nil {
+			deviceType, osType = info.Platform, info.OS
+		}
+	}
+	return serial, deviceId, deviceType, osType
+}
+
+// disconnectStale closes a session that is still listed but whose connection
+// is gone, so the reconnect loop does not take it for a live one
+func (dm *DeviceKeeper) disconnectStale(serial string) {
+	if session, ok := dm.getDevice(serial); ok && (session.Mux == nil || session.Mux.IsClosed()) {
+		dm.delDevice(session)
+	}
+}
+
+// reconnectDevice retries the access point session of a device under its
+// reconnect policy until it is connected, the policy gives up or the loop is
+// cancelled. deviceId is passed in to avoid race condition with bimap.
+// immediate skips the wait before the first attempt.
+func (dm *DeviceKeeper) reconnectDevice(serial, deviceId, deviceType, osType string, immediate bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("recovered from reconnectDevice for device %s: %v", serial, r)
+		}
+	}()
+
+	if deviceId == "" {
+		log.Printf("device %s: empty device ID for reconnection", serial)
+		return
+	}
+
+	policy := dm.ReconnectPolicy(serial)
+	state := &reconnectState{
+		IsReconnecting: true,
+		MaxRetry:       policy.MaxAttempts,
+		Serial:         serial,
+		DeviceId:       deviceId,
+		DisconnectedAt: dm.clock.Now(),
+		cancel:         make(chan struct{}),
+		wake:           make(chan struct{}, 1),
+	}
+	if !dm.startReconnect(state) {
+		log.Printf("device %s: already reconnecting", serial)
+		return
+	}
+
+	dm.registry.SetState(serial, device.StateReconnecting)
+
+	// failures counts consecutive failures since the breaker last closed
+	failures := 0
+	for attempt := 1; policy.Forever() || attempt <= policy.MaxAttempts; attempt++ {
+		wait := policy.Delay(failures, dm.jitter())
+		cooldown := policy.BreakerOpen(failures)
+		if cooldown {
+			wait = policy.Cooldown
+			failures = 0
+		}
+		if immediate {
+			wait = 0
+			immediate = false
+		}
+		dm.updateReconnectAttempt(state, attempt, cooldown, dm.clock.Now().Add(wait))
+
+		if cooldown {
+			log.Printf("device %s: %d reconnection attempts failed in a row, pausing for %v", serial, policy.BreakerThreshold, wait)
+			events.Publish(events.ReconnectCooldown, serial, map[string]interface{}{
+				"device_id": deviceId,
+				"attempt":   attempt,
+				"cooldown":  wait.String(),
+			})
+		} else {
+			log.Printf("device %s: reconnection attempt %d/%s (waiting %v)...", serial, attempt, formatMaxAttempts(policy), wait)
+			events.Publish(events.ReconnectAttempt, serial, map[string]interface{}{
+				"device_id":    deviceId,
+				"attempt":      attempt,
+				"max_attempts": policy.MaxAttempts,
+				"delay":        wait.String(),
+			})
+		}
+
+		select {
+		case <-dm.clock.After(wait):
+		case <-state.wake:
+			failures = 0
+		case <-state.cancel:
+			log.Printf("device %s: reconnection cancelled", serial)
+			return
+		}
+
+		// The device may have come back another way, e.g. adb saw it online again
+		if dm.IsDeviceConnected(serial) {
+			log.Printf("device %s: connected while waiting to reconnect", serial)
+			dm.finishReconnect(state)
+			return
+		}
+
+		err := dm.reconnect(serial, deviceId, deviceType, osType)
+		if err == nil {
+			log.Printf("device %s: reconnection successful on attempt %d", serial, attempt)
+			dm.finishReconnect(state)
+			events.Publish(events.ReconnectSucceeded, serial, map[string]interface{}{
+				"device_id": deviceId,
+				"attempt":   attempt,
+			})
+			return
+		}
+		failures++
+
+		log.Printf("device %s: reconnection attempt %d/%s failed: %v", serial, attempt, formatMaxAttempts(policy), err)
+	}
+
+	// Max attempts reached - mark as disconnected. The state stays to show the
+	// "Disconnected" status until the periodic cleanup drops the device.
+	log.Printf("device %s: max reconnection attempts (%d) reached, marking as disconnected", serial, policy.MaxAttempts)
+	dm.registry.SetState(serial, device.StateDisconnected)
+	events.Publish(events.ReconnectGaveUp, serial, map[string]interface{}{
+		"device_id":    deviceId,
+		"max_attempts": policy.MaxAttempts,
+	})
+
+	dm.reconnectMu.Lock()
+	if dm.reconnectStates[serial] == state {
+		state.IsReconnecting = false
+		state.CoolingDown = false
+		state.DisconnectedAt = dm.clock.Now()
+	}
+	dm.reconnectMu.Unlock()
+}
+
+func formatMaxAttempts(policy device.ReconnectPolicy) string {
+	if policy.Forever() {
+		return "∞"
+	}
+	return fmt.Sprint(policy.MaxAttempts)
+}
+
+// startReconnect records the state of a new reconnect loop. It returns false
+// when another loop is already reconnecting the device.
+func (dm *DeviceKeeper) startReconnect(state *reconnectState) bool {
+	dm.reconnectMu.Lock()
+	defer dm.reconnectMu.Unlock()
+	if old, ok := dm.reconnectStates[state.Serial]; ok && old.IsReconnecting {
+		return false
+	}
+	dm.reconnectStates[state.Serial] = state
+	return true
+}
+
+// updateReconnectAttempt updates the current reconnection attempt count
+func (dm *DeviceKeeper) updateReconnectAttempt(state *reconnectState, attempt int, coolingDown bool, next time.Time) {
+	dm.reconnectMu.Lock()
+	defer dm.reconnectMu.Unlock()
+	state.Attempt = attempt
+	state.CoolingDown = coolingDown
+	state.NextAttemptAt = next
+}
+
+// finishReconnect removes the state of a loop whose device is connected again
+func (dm *DeviceKeeper) finishReconnect(state *reconnectState) {
+	dm.reconnectMu.Lock()
+	defer dm.reconnectMu.Unlock()
+	if dm.reconnectStates[state.Serial] == state {
+		delete(dm.reconnectStates, state.Serial)
+	}
+}
+
+// cancelReconnect stops the reconnect loop of a device and forgets its state
+func (dm *DeviceKeeper) cancelReconnect(serial, reason string) {
+	dm.reconnectMu.Lock()
+	state, ok := dm.reconnectStates[serial]
+	running := ok && state.IsReconnecting
+	delete(dm.reconnectStates, serial)
+	dm.reconnectMu.Unlock()
+	if !running {
+		return
+	}
+
+	close(state.cancel)
+	log.Printf("device %s: stopped reconnecting: %s", serial, reason)
+	events.Publish(events.ReconnectCancelled, serial, map[string]interface{}{
+		"device_id": state.DeviceId,
+		"reason":    reason,
+	})
+}
+
+// getReconnectState gets the reconnection state for a device
+// Returns a map to avoid exposing internal reconnectState struct
+func (dm *DeviceKeeper) getReconnectState(serial string) map[string]interface{} {
+	dm.reconnectMu.RLock()
+	defer dm.reconnectMu.RUnlock()
+
+	state, ok := dm.reconnectStates[serial]
+	if !ok {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"isReconnecting": state.IsReconnecting,
+		"attempt":        state.Attempt,
+		"maxRetry":       state.MaxRetry,
+		"serial":         state.Serial,
+		"deviceId":       state.DeviceId,
+		"coolingDown":    state.CoolingDown,
+		"nextAttemptAt":  state.NextAttemptAt,
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishalkuo/bimap"
+)
+
+// fakeClock fires timers only when the test advances it, and reports every
+// wait the reconnect loop starts
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan time.Duration
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0), waiting: make(chan time.Duration, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.mu.Lock()
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	c.mu.Unlock()
+	c.waiting <- d
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// nextWait returns the wait the reconnect loop started next
+func (c *fakeClock) nextWait(t *testing.T) time.Duration {
+	t.Helper()
+	select {
+	case d := <-c.waiting:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconnect loop did not wait")
+		return 0
+	}
+}
+
+// fakeConnector fails the first failures attempts
+type fakeConnector struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (f *fakeConnector) connect(serial, deviceId, deviceType, osType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if f.attempts <= f.failures {
+		return errors.New("access point unreachable")
+	}
+	return nil
+}
+
+func (f *fakeConnector) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempts
+}
+
+func newReconnectKeeper(t *testing.T, policy device.ReconnectPolicy, conn *fakeConnector) (*DeviceKeeper, *fakeClock) {
+	registry, err := device.OpenRegistry("")
+	require.NoError(t, err)
+	registry.Put(device.RegistryEntry{DeviceID: "dev-1", Serial: "emulator-5554", DeviceType: "mobile", OsType: "android"})
+
+	clk := newFakeClock()
+	return &DeviceKeeper{
+		adbDeviceBiMap:  bimap.NewBiMap[string, string](),
+		deviceSessions:  NewDeviceMap(),
+		deviceInfoCache: make(map[string]*deviceInfo),
+		reconnectStates: make(map[string]*reconnectState),
+		registry:        registry,
+		policy:          policy,
+		clock:           clk,
+		jitter:          func() float64 { return 0.5 },
+		reconnect:       conn.connect,
+	}, clk
+}
+
+func runReconnect(dm *DeviceKeeper, immediate bool) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dm.reconnectDevice("emulator-5554", "dev-1", "mobile", "android", immediate)
+	}()
+	return done
+}
+
+func waitDone(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconnect loop did not stop")
+	}
+}
+
+func TestReconnectBackoffAndBreaker(t *testing.T) {
+	policy := device.ReconnectPolicy{BaseDelay: time.Second, MaxDelay: 4 * time.Second, BreakerThreshold: 4, Cooldown: time.Minute}
+	conn := &fakeConnector{failures: 5}
+	dm, clk := newReconnectKeeper(t, policy, conn)
+	done := runReconnect(dm, false)
+
+	// Half of the doubling cap, capped at MaxDelay, then the cooldown after
+	// four failures in a row, then the backoff starts over
+	for _, want := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 2 * time.Second, time.Minute, time.Second} {
+		require.Equal(t, want, clk.nextWait(t))
+		state := dm.getReconnectState("emulator-5554")
+		require.NotNil(t, state)
+		assert.Equal(t, want == time.Minute, state["coolingDown"])
+		assert.Equal(t, 0, state["maxRetry"])
+		clk.Advance(want)
+	}
+	waitDone(t, done)
+
+	assert.Equal(t, 6, conn.count())
+	assert.Nil(t, dm.getReconnectState("emulator-5554"))
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	policy := device.ReconnectPolicy{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Second}
+	conn := &fakeConnector{failures: 10}
+	dm, clk := newReconnectKeeper(t, policy, conn)
+	done := runReconnect(dm, false)
+
+	clk.Advance(clk.nextWait(t))
+	clk.Advance(clk.nextWait(t))
+	waitDone(t, done)
+
+	assert.Equal(t, 2, conn.count())
+	state := dm.getReconnectState("emulator-5554")
+	require.NotNil(t, state)
+	assert.Equal(t, false, state["isReconnecting"])
+	assert.Equal(t, 2, state["attempt"])
+	e, _ := dm.registry.Get("emulator-5554")
+	assert.Equal(t, device.StateDisconnected, e.State)
+
+	// A manual reconnect starts over after giving up, without waiting
+	require.NoError(t, dm.ReconnectDevice("dev-1"))
+	assert.Equal(t, time.Duration(0), clk.nextWait(t))
+	clk.Advance(0)
+	assert.Eventually(t, func() bool { return conn.count() == 3 }, 5*time.Second, time.Millisecond)
+}
+
+func TestReconnectManualAndCancel(t *testing.T) {
+	policy := device.DefaultReconnectPolicy()
+	conn := &fakeConnector{failures: 10}
+	dm, clk := newReconnectKeeper(t, policy, conn)
+	done := runReconnect(dm, false)
+
+	// A manual reconnect skips the wait of a running loop
+	require.Equal(t, time.Second, clk.nextWait(t))
+	require.NoError(t, dm.ReconnectDevice("emulator-5554"))
+	require.Equal(t, 2*time.Second, clk.nextWait(t), "backoff starts over from the manual attempt")
+	assert.Equal(t, 1, conn.count())
+
+	dm.cancelReconnect("emulator-5554", "device offline")
+	waitDone(t, done)
+	assert.Nil(t, dm.getReconnectState("emulator-5554"))
+	assert.Equal(t, 1, conn.count())
+
+	assert.ErrorIs(t, dm.ReconnectDevice("unknown"), device.ErrNotRegistered)
+}
+
+func TestReconnectPolicyOverride(t *testing.T) {
+	dm, _ := newReconnectKeeper(t, device.DefaultReconnectPolicy(), &fakeConnector{})
+
+	custom := device.ReconnectPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second}
+	require.NoError(t, dm.SetReconnectPolicy("emulator-5554", &custom))
+	assert.Equal(t, custom, dm.ReconnectPolicy("dev-1"))
+
+	invalid := device.ReconnectPolicy{BaseDelay: time.Minute, MaxDelay: time.Second}
+	assert.ErrorContains(t, dm.SetReconnectPolicy("emulator-5554", &invalid), "shorter than base delay")
+	assert.ErrorIs(t, dm.SetReconnectPolicy("unknown", &custom), device.ErrNotRegistered)
+
+	require.NoError(t, dm.SetReconnectPolicy("emulator-5554", nil))
+	assert.Equal(t, device.DefaultReconnectPolicy(), dm.ReconnectPolicy("emulator-5554"))
+}
+
+func TestForgetEmulator(t *testing.T) {
+	conn := &fakeConnector{failures: 10}
+	dm, clk := newReconnectKeeper(t, device.DefaultReconnectPolicy(), conn)
+	done := runReconnect(dm, false)
+	require.Equal(t, time.Second, clk.nextWait(t))
+
+	// An emulator that left adb stops reconnecting and leaves the registry
+	dm.forgetEmulator("emulator-5554")
+	waitDone(t, done)
+	assert.Nil(t, dm.getReconnectState("emulator-5554"))
+	_, ok := dm.registry.Get("emulator-5554")
+	assert.False(t, ok)
+	assert.ErrorIs(t, dm.ReconnectDevice("emulator-5554"), device.ErrNotRegistered)
+}
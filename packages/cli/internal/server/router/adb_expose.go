@@ -9,15 +9,23 @@ import (
 // ADBExposeRouter handles all ADB expose routes
 type ADBExposeRouter struct {
 	handlers *handlers.ADBExposeHandlers
+	routes   *PatternRouter
 }
 
 // RegisterRoutes registers all ADB expose routes
 func (r *ADBExposeRouter) RegisterRoutes(mux *http.ServeMux, server interface{}) {
+	// Cast server to ServerService
+	var serverService handlers.ServerService
+	if srv, ok := server.(handlers.ServerService); ok {
+		serverService = srv
+	}
+
 	// Create handlers instance
-	r.handlers = handlers.NewADBExposeHandlers()
+	r.handlers = handlers.NewADBExposeHandlers(serverService)
 
 	// Create pattern router for ADB expose endpoints
 	adbExposeRouter := NewPatternRouter()
+	r.routes = adbExposeRouter
 	adbExposeRouter.HandleFunc("/api/adb-expose/start", r.handlers.HandleADBExposeStart)
 	adbExposeRouter.HandleFunc("/api/adb-expose/stop", r.handlers.HandleADBExposeStop)
 	adbExposeRouter.HandleFunc("/api/adb-expose/status", r.handlers.HandleADBExposeStatus)
@@ -27,6 +35,14 @@ func (r *ADBExposeRouter) RegisterRoutes(mux *http.ServeMux, server interface{})
 	mux.HandleFunc("/api/adb-expose/", adbExposeRouter.ServeHTTP)
 }
 
+// Patterns returns the route patterns registered by RegisterRoutes
+func (r *ADBExposeRouter) Patterns() []string {
+	if r.routes == nil {
+		return nil
+	}
+	return r.routes.Patterns()
+}
+
 // GetPathPrefix returns the path prefix for this router
 func (r *ADBExposeRouter) GetPathPrefix() string {
 	return "/api/adb-expose"
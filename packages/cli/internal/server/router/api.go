@@ -3,12 +3,14 @@ package router
 import (
 	"net/http"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
 	"github.com/babelcloud/gbox/packages/cli/internal/server/handlers"
 )
 
 // APIRouter handles all /api/* routes
 type APIRouter struct {
 	handlers *handlers.APIHandlers
+	routes   *PatternRouter
 }
 
 // RegisterRoutes registers all API routes
@@ -30,6 +32,7 @@ func (r *APIRouter) RegisterRoutes(mux *http.ServeMux, server interface{}) {
 
 	// Create a unified pattern router for all /api/* routes
 	apiRouter := NewPatternRouter()
+	r.routes = apiRouter
 
 	// Health and status endpoints
 	apiRouter.HandleFunc("/api/health", r.handlers.HandleHealth)
@@ -39,22 +42,33 @@ func (r *APIRouter) RegisterRoutes(mux *http.ServeMux, server interface{}) {
 	apiRouter.HandleFunc("/api/devices", deviceHandlers.HandleDeviceList)
 	apiRouter.HandleFunc("/api/devices/register", deviceHandlers.HandleDeviceRegister)
 	apiRouter.HandleFunc("/api/devices/unregister", deviceHandlers.HandleDeviceUnregister)
-
-	// Device-specific endpoints with path parameters
-	apiRouter.HandleFunc("/api/devices/{serial}", deviceHandlers.HandleDeviceAction)
-	apiRouter.HandleFunc("/api/devices/{serial}/video", deviceHandlers.HandleDeviceVideo)
-	apiRouter.HandleFunc("/api/devices/{serial}/audio", deviceHandlers.HandleDeviceAudio)
-	apiRouter.HandleFunc("/api/devices/{serial}/stream", deviceHandlers.HandleDeviceStream)
-	apiRouter.HandleFunc("/api/devices/{serial}/control", deviceHandlers.HandleDeviceControl)
-	apiRouter.HandleFunc("/api/devices/{serial}/adb", deviceHandlers.HandleDeviceAdb)
-	apiRouter.HandleFunc("/api/devices/{serial}/exec", deviceHandlers.HandleDeviceExec)
-	apiRouter.HandleFunc("/api/devices/{serial}/appium", deviceHandlers.HandleDeviceAppium)
-	apiRouter.HandleFunc("/api/devices/{serial}/appium/{path:.*}", deviceHandlers.HandleDeviceAppium)
-	apiRouter.HandleFunc("/api/devices/{serial}/screenshot", deviceHandlers.HandleDeviceScreenshot)
+	apiRouter.HandleFunc("/api/devices/wireless", deviceHandlers.HandleWirelessDevices)
+	apiRouter.HandleFunc("/api/devices/pair", deviceHandlers.HandleDevicePair)
+	apiRouter.HandleFunc("/api/devices/lease", deviceHandlers.HandleLeaseAny)
+
+	// Device-specific endpoints with path parameters. Routes driving a device
+	// or reading its screen need the lease ID while it is leased.
+	apiRouter.HandleFunc("/api/devices/{serial}", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceAction))
+	apiRouter.HandleFunc("/api/devices/{serial}/reconnect", deviceHandlers.HandleDeviceReconnect)
+	apiRouter.HandleFunc("/api/devices/{serial}/health", deviceHandlers.HandleDeviceHealth)
+	apiRouter.HandleFunc("/api/devices/{serial}/labels", deviceHandlers.HandleDeviceLabels)
+	apiRouter.HandleFunc("/api/devices/{serial}/lease", deviceHandlers.HandleDeviceLease)
+	apiRouter.HandleFunc("/api/devices/{serial}/video", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceVideo))
+	apiRouter.HandleFunc("/api/devices/{serial}/audio", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceAudio))
+	apiRouter.HandleFunc("/api/devices/{serial}/stream", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceStream))
+	apiRouter.HandleFunc("/api/devices/{serial}/control", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceControl))
+	apiRouter.HandleFunc("/api/devices/{serial}/adb", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceAdb))
+	apiRouter.HandleFunc("/api/devices/{serial}/exec", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceExec))
+	apiRouter.HandleFunc("/api/devices/{serial}/appium", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceAppium))
+	apiRouter.HandleFunc("/api/devices/{serial}/appium/{path:.*}", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceAppium))
+	apiRouter.HandleFunc("/api/devices/{serial}/screenshot", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceScreenshot))
 
 	// File operations endpoints
-	apiRouter.HandleFunc("/api/devices/{serial}/files", deviceHandlers.HandleDeviceFiles)
-	apiRouter.HandleFunc("/api/devices/{serial}/files/{action}", deviceHandlers.HandleDeviceFiles)
+	apiRouter.HandleFunc("/api/devices/{serial}/files", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceFiles))
+	apiRouter.HandleFunc("/api/devices/{serial}/files/{action}", deviceHandlers.RequireLease(deviceHandlers.HandleDeviceFiles))
+
+	// Event stream (SSE or WebSocket)
+	apiRouter.HandleFunc("/api/events", handlers.NewEventHandlers(events.Default).HandleEvents)
 
 	// Box management endpoints (proxy to remote GBOX API)
 	apiRouter.HandleFunc("/api/boxes", boxHandlers.HandleBoxList)
@@ -63,11 +77,22 @@ func (r *APIRouter) RegisterRoutes(mux *http.ServeMux, server interface{}) {
 	apiRouter.HandleFunc("/api/server/shutdown", r.handlers.HandleServerShutdown)
 	apiRouter.HandleFunc("/api/server/info", r.handlers.HandleServerInfo)
 
+	// OpenAPI document of all /api/* routes, including adb-expose
+	apiRouter.HandleFunc("/api/openapi.json", r.handlers.HandleOpenAPI)
+
 	// Register the unified API router
 	// Note: ADB Expose endpoints are handled separately by ADBExposeRouter
 	mux.HandleFunc("/api/", apiRouter.ServeHTTP)
 }
 
+// Patterns returns the route patterns registered by RegisterRoutes
+func (r *APIRouter) Patterns() []string {
+	if r.routes == nil {
+		return nil
+	}
+	return r.routes.Patterns()
+}
+
 // GetPathPrefix returns the path prefix for this router
 func (r *APIRouter) GetPathPrefix() string {
 	return "/api"
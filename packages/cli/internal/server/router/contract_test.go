@@ -0,0 +1,523 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
+	"github.com/babelcloud/gbox/packages/cli/internal/server/handlers"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer implements the parts of ServerService the contract tests reach
+type fakeServer struct {
+	handlers.ServerService
+	bridges []string
+	policy  *device.ReconnectPolicy
+	labels  map[string]string
+	lease   *serverclient.DeviceLease
+}
+
+func (f *fakeServer) IsRunning() bool          { return true }
+func (f *fakeServer) GetPort() int             { return 29888 }
+func (f *fakeServer) GetUptime() time.Duration { return 90 * time.Second }
+func (f *fakeServer) GetBuildID() string       { return "build-1" }
+func (f *fakeServer) GetVersion() string       { return "v1.2.3" }
+func (f *fakeServer) IsADBExposeRunning() bool { return true }
+func (f *fakeServer) IsLocalOnly() bool        { return false }
+func (f *fakeServer) ActiveStreams() int       { return 2 }
+func (f *fakeServer) IsDraining() bool         { return false }
+func (f *fakeServer) CreateBridge(serial string) error {
+	f.bridges = append(f.bridges, serial)
+	return nil
+}
+func (f *fakeServer) RemoveBridge(serial string) {}
+func (f *fakeServer) ReconnectDevice(serial string) error {
+	if serial != "emulator-5554" {
+		return device.ErrNotRegistered
+	}
+	return nil
+}
+func (f *fakeServer) DeviceHealth(serial string, refresh bool) (*serverclient.DeviceHealth, error) {
+	if serial != "emulator-5554" {
+		return nil, fmt.Errorf("device '%s' not found", serial)
+	}
+	checkedAt := time.Unix(1700000000, 0)
+	return &serverclient.DeviceHealth{
+		Serial:             serial,
+		BatteryLevel:       8,
+		BatteryTemperature: 31.5,
+		StorageFree:        8 << 30,
+		StorageTotal:       64 << 30,
+		CPULoad:            1.25,
+		ScreenOn:           refresh,
+		CheckedAt:          &checkedAt,
+		Quarantined:        true,
+		QuarantineReasons:  []string{"battery 8% is below 10%"},
+		QuarantinedAt:      &checkedAt,
+	}, nil
+}
+func (f *fakeServer) WirelessDevices() ([]serverclient.WirelessDevice, error) {
+	return []serverclient.WirelessDevice{
+		{Name: "adb-R58N123ABC-vWgJpq", Service: "connect", Address: "192.168.1.20:41235", SerialNo: "R58N123ABC", Serial: "192.168.1.20:41235", Connected: true},
+		{Name: "gbox-7fk2", Service: "pairing", Address: "192.168.1.21:37099"},
+	}, nil
+}
+func (f *fakeServer) PairDevice(req serverclient.PairRequest) (*serverclient.PairResponse, error) {
+	if req.Code != "482913" {
+		return nil, fmt.Errorf("failed to pair with %s: Wrong password or connection was dropped.", req.Address)
+	}
+	return &serverclient.PairResponse{Success: true, Message: "Successfully paired to " + req.Address, Serial: "192.168.1.20:41235"}, nil
+}
+func (f *fakeServer) RegisteredDevices() []device.RegistryEntry {
+	return []device.RegistryEntry{{DeviceID: "dev-1", Serial: "emulator-5554", Serialno: "R58N123ABC", DeviceType: "mobile", OsType: "android"}}
+}
+func (f *fakeServer) DeviceLabels(serialno string) map[string]string {
+	return f.labels
+}
+func (f *fakeServer) SetDeviceLabels(serialno string, set map[string]string, remove []string) (map[string]string, error) {
+	if f.labels == nil {
+		f.labels = map[string]string{}
+	}
+	for k, v := range set {
+		f.labels[k] = v
+	}
+	for _, k := range remove {
+		delete(f.labels, k)
+	}
+	return f.labels, fmt.Errorf("labels are saved locally but failed to update device dev-1 in the cloud: offline")
+}
+func (f *fakeServer) AcquireLease(serial, serialno string, req serverclient.LeaseRequest) (*serverclient.DeviceLease, error) {
+	if f.lease != nil {
+		return nil, fmt.Errorf("%w by %s", device.ErrLeased, f.lease.Owner)
+	}
+	if req.Owner == "" {
+		return nil, fmt.Errorf("%w: no owner", device.ErrInvalidLease)
+	}
+	now := time.Unix(1700000000, 0)
+	f.lease = &serverclient.DeviceLease{ID: "lease-1", Serial: serial, Serialno: serialno, Owner: req.Owner, TTL: "10m0s", AcquiredAt: now, RenewedAt: now, ExpiresAt: now.Add(10 * time.Minute), Cleanup: req.Cleanup}
+	lease := *f.lease
+	return &lease, nil
+}
+func (f *fakeServer) RenewLease(serial, id string) (*serverclient.DeviceLease, error) {
+	if f.lease == nil {
+		return nil, device.ErrNotLeased
+	}
+	if id != f.lease.ID {
+		return nil, device.ErrLeaseMismatch
+	}
+	lease := *f.lease
+	return &lease, nil
+}
+func (f *fakeServer) ReleaseLease(serial, id string, force bool) (*serverclient.DeviceLease, error) {
+	if !force {
+		if _, err := f.RenewLease(serial, id); err != nil {
+			return nil, err
+		}
+	}
+	lease := f.DeviceLease(serial)
+	if lease == nil {
+		return nil, device.ErrNotLeased
+	}
+	f.lease = nil
+	return lease, nil
+}
+func (f *fakeServer) DeviceLease(serial string) *serverclient.DeviceLease {
+	if f.lease == nil {
+		return nil
+	}
+	lease := *f.lease
+	lease.ID = ""
+	return &lease
+}
+func (f *fakeServer) CheckLease(serial, id string) error {
+	if f.lease != nil && id != f.lease.ID {
+		return fmt.Errorf("%w by %s", device.ErrLeased, f.lease.Owner)
+	}
+	return nil
+}
+func (f *fakeServer) ReconnectPolicy(serial string) device.ReconnectPolicy {
+	if f.policy != nil {
+		return *f.policy
+	}
+	return device.DefaultReconnectPolicy()
+}
+func (f *fakeServer) SetReconnectPolicy(serial string, policy *device.ReconnectPolicy) error {
+	if err := f.ReconnectDevice(serial); err != nil {
+		return err
+	}
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("invalid reconnect policy: %v", err)
+		}
+	}
+	f.policy = policy
+	return nil
+}
+
+// newContractServer serves the API and adb-expose routes the way GBoxServer does
+func newContractServer(t *testing.T) (*httptest.Server, []string) {
+	mux := http.NewServeMux()
+	api := &APIRouter{}
+	adbExpose := &ADBExposeRouter{}
+	api.RegisterRoutes(mux, &fakeServer{})
+	adbExpose.RegisterRoutes(mux, &fakeServer{})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, append(api.Patterns(), adbExpose.Patterns()...)
+}
+
+func loadSpec(t *testing.T) map[string]interface{} {
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(serverclient.Spec(), &doc))
+	return doc
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	_, patterns := newContractServer(t)
+	doc := loadSpec(t)
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	// {path:.*} is {path} in OpenAPI
+	custom := regexp.MustCompile(`\{([^}:]+):[^}]+\}`)
+	registered := map[string]bool{}
+	for _, p := range patterns {
+		registered[custom.ReplaceAllString(p, "{$1}")] = true
+	}
+
+	paths := doc["paths"].(map[string]interface{})
+	for p := range registered {
+		_, ok := paths[p]
+		assert.True(t, ok, "route %s is not in openapi.json", p)
+	}
+	for p := range paths {
+		assert.True(t, registered[p], "openapi.json documents %s, which is not registered", p)
+	}
+
+	// Every operation has a unique ID for client generators
+	ids := map[string]string{}
+	for p, item := range paths {
+		for method, op := range item.(map[string]interface{}) {
+			if method == "parameters" {
+				continue
+			}
+			id, _ := op.(map[string]interface{})["operationId"].(string)
+			require.NotEmpty(t, id, "%s %s has no operationId", method, p)
+			assert.NotContains(t, ids, id, "operationId of %s %s is not unique", method, p)
+			ids[id] = p
+		}
+	}
+}
+
+func TestServerClientContract(t *testing.T) {
+	srv, _ := newContractServer(t)
+	doc := loadSpec(t)
+	client := serverclient.New(srv.URL)
+
+	health, err := client.Health()
+	require.NoError(t, err)
+	assert.Equal(t, "healthy", health.Status)
+
+	status, err := client.Status()
+	require.NoError(t, err)
+	assert.Equal(t, 29888, status.Port)
+	assert.True(t, status.Services.ADBExpose)
+	assert.Equal(t, "build-1", status.BuildID)
+
+	info, err := client.ServerInfo()
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, 2, info.ActiveStreams)
+	assert.NotZero(t, info.PID)
+
+	forwards, err := client.ADBExposeList()
+	require.NoError(t, err)
+	assert.Empty(t, forwards)
+
+	exposeStatus, err := client.ADBExposeStatus()
+	require.NoError(t, err)
+	assert.True(t, exposeStatus.Running)
+
+	// Errors carry the status and the message of the handler
+	_, err = client.StopADBExpose("")
+	assert.Equal(t, http.StatusBadRequest, serverclient.StatusCode(err))
+	assert.EqualError(t, err, "API error (status 400): box_id is required")
+
+	_, err = client.StartADBExpose(serverclient.ExposeStartRequest{BoxID: "box-1", LocalPorts: []int{5555}})
+	assert.Equal(t, http.StatusBadRequest, serverclient.StatusCode(err))
+
+	reconnect, err := client.ReconnectDevice("emulator-5554", &serverclient.ReconnectRequest{Policy: map[string]interface{}{"max_attempts": 3, "cooldown": "1m"}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, reconnect.Policy.MaxAttempts)
+	assert.Equal(t, "1m0s", reconnect.Policy.Cooldown)
+	assert.Equal(t, "2s", reconnect.Policy.BaseDelay, "fields left out keep their values")
+
+	_, err = client.ReconnectDevice("emulator-5554", &serverclient.ReconnectRequest{Policy: map[string]interface{}{"base_delay": "1h"}})
+	assert.EqualError(t, err, "API error (status 400): invalid reconnect policy: max delay 1m0s is shorter than base delay 1h0m0s")
+	_, err = client.ReconnectDevice("emulator-5556", nil)
+	assert.Equal(t, http.StatusNotFound, serverclient.StatusCode(err))
+
+	deviceHealth, err := client.DeviceHealth("emulator-5554", true)
+	require.NoError(t, err)
+	assert.True(t, deviceHealth.ScreenOn, "refresh reads the vitals now")
+	assert.True(t, deviceHealth.Quarantined)
+	assert.Equal(t, []string{"battery 8% is below 10%"}, deviceHealth.QuarantineReasons)
+	_, err = client.DeviceHealth("emulator-5556", false)
+	assert.Equal(t, http.StatusNotFound, serverclient.StatusCode(err))
+
+	wireless, err := client.WirelessDevices()
+	require.NoError(t, err)
+	require.Len(t, wireless, 2)
+	assert.Equal(t, "R58N123ABC", wireless[0].SerialNo)
+	paired, err := client.PairDevice(serverclient.PairRequest{Address: "192.168.1.20:37099", Code: "482913"})
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.20:41235", paired.Serial)
+	_, err = client.PairDevice(serverclient.PairRequest{Address: "192.168.1.20:37099", Code: "000000"})
+	assert.Equal(t, http.StatusBadGateway, serverclient.StatusCode(err))
+
+	labels, err := client.UpdateDeviceLabels("emulator-5554", serverclient.DeviceLabelsRequest{Labels: map[string]string{"team": "qa", "os": "14"}, Remove: []string{"busy"}})
+	require.NoError(t, err)
+	assert.Equal(t, "R58N123ABC", labels.Serialno)
+	assert.Equal(t, map[string]string{"team": "qa", "os": "14"}, labels.Labels)
+	assert.Contains(t, labels.Warning, "saved locally")
+	labels, err = client.DeviceLabels("dev-1")
+	require.NoError(t, err)
+	assert.Equal(t, "qa", labels.Labels["team"])
+	_, err = client.UpdateDeviceLabels("emulator-5554", serverclient.DeviceLabelsRequest{Labels: map[string]string{"team": "q a"}})
+	assert.Equal(t, http.StatusBadRequest, serverclient.StatusCode(err))
+	_, err = client.DeviceLabels("emulator-5556")
+	assert.Equal(t, http.StatusNotFound, serverclient.StatusCode(err))
+
+	lease, err := client.AcquireLease("emulator-5554", serverclient.LeaseRequest{Owner: "ci-42"})
+	require.NoError(t, err)
+	assert.Equal(t, "lease-1", lease.ID)
+	assert.Equal(t, "R58N123ABC", lease.Serialno, "registered devices may be leased while away")
+	_, err = client.AcquireLease("emulator-5554", serverclient.LeaseRequest{Owner: "dev"})
+	assert.Equal(t, http.StatusConflict, serverclient.StatusCode(err))
+	current, err := client.DeviceLease("emulator-5554")
+	require.NoError(t, err)
+	assert.Equal(t, "ci-42", current.Owner)
+	assert.Empty(t, current.ID, "only the holder gets the lease ID")
+	_, err = client.RenewLease("emulator-5554", "other")
+	assert.Equal(t, http.StatusForbidden, serverclient.StatusCode(err))
+	_, err = client.RenewLease("emulator-5554", lease.ID)
+	require.NoError(t, err)
+	_, err = client.ReleaseLease("emulator-5554", lease.ID, false)
+	require.NoError(t, err)
+	_, err = client.DeviceLease("emulator-5554")
+	assert.Equal(t, http.StatusNotFound, serverclient.StatusCode(err))
+	_, err = client.AcquireLease("emulator-5556", serverclient.LeaseRequest{Owner: "ci-42"})
+	assert.Equal(t, http.StatusNotFound, serverclient.StatusCode(err))
+
+	// Responses match the schemas of openapi.json
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/api/health", "", http.StatusOK},
+		{http.MethodGet, "/api/status", "", http.StatusOK},
+		{http.MethodGet, "/api/server/info", "", http.StatusOK},
+		{http.MethodPost, "/api/server/shutdown?drain=abc", "", http.StatusBadRequest},
+		{http.MethodPost, "/api/devices/emulator-5554", "", http.StatusOK},
+		{http.MethodDelete, "/api/devices/emulator-5554", "", http.StatusOK},
+		{http.MethodPost, "/api/devices/emulator-5554/reconnect", `{"reset_policy":true}`, http.StatusAccepted},
+		{http.MethodPost, "/api/devices/emulator-5556/reconnect", "", http.StatusNotFound},
+		{http.MethodGet, "/api/devices/emulator-5554/health", "", http.StatusOK},
+		{http.MethodGet, "/api/devices/emulator-5556/health?refresh=true", "", http.StatusNotFound},
+		{http.MethodGet, "/api/devices/emulator-5554/labels", "", http.StatusOK},
+		{http.MethodPost, "/api/devices/R58N123ABC/labels", `{"labels":{"rack":"1"},"remove":["os"]}`, http.StatusOK},
+		{http.MethodPost, "/api/devices/R58N123ABC/labels", `{"labels":{"-rack":"1"}}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/devices/emulator-5556/labels", "", http.StatusNotFound},
+		{http.MethodGet, "/api/devices?selector=team%3Dq+a", "", http.StatusBadRequest},
+		{http.MethodPost, "/api/devices/emulator-5554/lease", `{"owner":"ci-42","ttl":"30m"}`, http.StatusOK},
+		{http.MethodPost, "/api/devices/R58N123ABC/lease", `{"owner":"dev"}`, http.StatusConflict},
+		{http.MethodGet, "/api/devices/emulator-5554/lease", "", http.StatusOK},
+		{http.MethodPost, "/api/devices/emulator-5554/exec", `{"cmd":"id"}`, http.StatusLocked},
+		{http.MethodGet, "/api/devices/emulator-5554/files/list", "", http.StatusLocked},
+		{http.MethodPost, "/api/devices/emulator-5554/screenshot", "", http.StatusLocked},
+		{http.MethodPost, "/api/devices/emulator-5554/adb", `{"command":"shell id"}`, http.StatusLocked},
+		{http.MethodGet, "/api/devices/emulator-5554/stream", "", http.StatusLocked},
+		{http.MethodGet, "/api/devices/emulator-5554/video", "", http.StatusLocked},
+		{http.MethodDelete, "/api/devices/emulator-5554", "", http.StatusLocked},
+		{http.MethodPut, "/api/devices/emulator-5554/lease", "", http.StatusForbidden},
+		{http.MethodDelete, "/api/devices/emulator-5554/lease?force=true", "", http.StatusOK},
+		{http.MethodDelete, "/api/devices/emulator-5554/lease", "", http.StatusNotFound},
+		{http.MethodPost, "/api/devices/emulator-5554/lease", `{}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/devices/lease", `{"owner":"ci-42","selector":"team=q a"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/devices/lease", `{"owner":"ci-42","selector":"team=nobody"}`, http.StatusConflict},
+		{http.MethodGet, "/api/devices/wireless", "", http.StatusOK},
+		{http.MethodPost, "/api/devices/pair", `{"address":"192.168.1.20:37099","code":"482913"}`, http.StatusOK},
+		{http.MethodPost, "/api/devices/pair", `{"address":"192.168.1.20:37099"}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/adb-expose/status", "", http.StatusOK},
+		{http.MethodGet, "/api/adb-expose/list", "", http.StatusOK},
+		{http.MethodPost, "/api/adb-expose/start", `{"box_id":"box-1"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/adb-expose/stop", `{}`, http.StatusBadRequest},
+	} {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tc.status, resp.StatusCode)
+
+			data, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			var value interface{}
+			require.NoError(t, json.Unmarshal(data, &value), string(data))
+
+			schema := responseSchema(t, doc, strings.Split(tc.path, "?")[0], tc.method, tc.status)
+			for _, problem := range validate(doc, schema, value, "body") {
+				t.Error(problem)
+			}
+		})
+	}
+
+	// The server serves the embedded document
+	resp, err := http.Get(srv.URL + "/api/openapi.json")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	served, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, serverclient.Spec(), served)
+}
+
+// responseSchema finds the JSON schema of a response in the document,
+// matching path against the templated paths of the document
+func responseSchema(t *testing.T, doc map[string]interface{}, path, method string, status int) map[string]interface{} {
+	t.Helper()
+	var item map[string]interface{}
+	for p, v := range doc["paths"].(map[string]interface{}) {
+		pattern, _ := compilePattern(p)
+		if pattern.MatchString(path) && (item == nil || !strings.Contains(p, "{")) {
+			item = v.(map[string]interface{})
+		}
+	}
+	require.NotNil(t, item, "no path matches %s", path)
+
+	op, ok := item[strings.ToLower(method)].(map[string]interface{})
+	require.True(t, ok, "%s %s is not documented", method, path)
+	response, ok := op["responses"].(map[string]interface{})[strconv.Itoa(status)].(map[string]interface{})
+	require.True(t, ok, "%s %s does not document status %d", method, path, status)
+	response = resolve(doc, response)
+
+	media, ok := response["content"].(map[string]interface{})["application/json"].(map[string]interface{})
+	require.True(t, ok, "%s %s %d is not JSON", method, path, status)
+	return media["schema"].(map[string]interface{})
+}
+
+// resolve follows a local $ref
+func resolve(doc, obj map[string]interface{}) map[string]interface{} {
+	ref, ok := obj["$ref"].(string)
+	if !ok {
+		return obj
+	}
+	node := interface{}(doc)
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node = node.(map[string]interface{})[part]
+	}
+	return resolve(doc, node.(map[string]interface{}))
+}
+
+// validate checks value against the subset of JSON schema used by
+// openapi.json. Unlike plain JSON schema, properties not in the schema are
+// problems unless additionalProperties allows them: every field the server
+// returns must be documented.
+func validate(doc, schema map[string]interface{}, value interface{}, at string) []string {
+	schema = resolve(doc, schema)
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || schema["type"] == nil {
+			return nil
+		}
+		return []string{at + " is null"}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not an object", at, value)}
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, key := range required {
+			if _, ok := obj[key.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is required", at, key))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, validate(doc, prop, obj[key], at+"."+key)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					problems = append(problems, fmt.Sprintf("%s.%s is not documented", at, key))
+				}
+			case map[string]interface{}:
+				problems = append(problems, validate(doc, extra, obj[key], at+"."+key)...)
+			default:
+				if properties != nil {
+					problems = append(problems, fmt.Sprintf("%s.%s is not documented", at, key))
+				}
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not an array", at, value)}
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range list {
+				problems = append(problems, validate(doc, items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not a string", at, value)}
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok && s != "" {
+			found := false
+			for _, e := range enum {
+				found = found || e == s
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("%s is %q, not one of %v", at, s, enum))
+			}
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			problems = append(problems, fmt.Sprintf("%s is %v, not an integer", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s is %T, not a number", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s is %T, not a boolean", at, value))
+		}
+	}
+	return problems
+}
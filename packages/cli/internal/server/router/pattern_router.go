@@ -13,6 +13,7 @@ type PatternRouter struct {
 }
 
 type routeEntry struct {
+	raw     string
 	pattern *regexp.Regexp
 	handler http.HandlerFunc
 	keys    []string
@@ -33,12 +34,22 @@ func NewPatternRouter() *PatternRouter {
 func (pr *PatternRouter) HandleFunc(pattern string, handler http.HandlerFunc) {
 	regexPattern, keys := compilePattern(pattern)
 	pr.routes = append(pr.routes, routeEntry{
+		raw:     pattern,
 		pattern: regexPattern,
 		handler: handler,
 		keys:    keys,
 	})
 }
 
+// Patterns returns the registered patterns in registration order
+func (pr *PatternRouter) Patterns() []string {
+	patterns := make([]string, 0, len(pr.routes))
+	for _, route := range pr.routes {
+		patterns = append(patterns, route.raw)
+	}
+	return patterns
+}
+
 // ServeHTTP implements http.Handler interface
 func (pr *PatternRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	for _, route := range pr.routes {
@@ -12,10 +12,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/babelcloud/gbox/packages/cli/internal/daemon"
+	"github.com/babelcloud/gbox/packages/cli/internal/device"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/control"
 	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/transport/webrtc"
 	"github.com/babelcloud/gbox/packages/cli/internal/server/handlers"
 	"github.com/babelcloud/gbox/packages/cli/internal/server/router"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
 	"github.com/pkg/errors"
 )
 
@@ -32,6 +35,10 @@ type GBoxServer struct {
 	bridgeManager *webrtc.Manager
 	deviceKeeper  *DeviceKeeper
 
+	// Lifecycle
+	drain   drainTracker
+	pidFile string
+
 	// State
 	mu        sync.RWMutex
 	running   bool
@@ -66,19 +73,52 @@ func (s *GBoxServer) Start() error {
 	// Setup routes
 	s.setupRoutes()
 
+	// Bind first so a taken port fails before any device is touched
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on port %d", s.port)
+	}
+
 	if err := s.startDeviceKeeper(); err != nil {
+		listener.Close()
 		return err
 	}
 
+	if s.pidFile != "" {
+		if err := daemon.WritePIDFile(s.pidFile); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
 	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf(":%d", s.port),
-		Handler:      loggingMiddleware(s.mux),
+		Handler:      loggingMiddleware(s.drain.middleware(s.mux)),
 		ReadTimeout:  0, // No read timeout for streaming connections
 		WriteTimeout: 0, // No write timeout for streaming connections
 		IdleTimeout:  0, // No idle timeout for streaming connections
 	}
 
-	return s.httpServer.ListenAndServe()
+	return s.httpServer.Serve(listener)
+}
+
+// SetPIDFile makes the server record its PID in path while it runs
+func (s *GBoxServer) SetPIDFile(path string) {
+	s.pidFile = path
+}
+
+// Drain refuses new requests and waits up to timeout for active streams to
+// finish, returning how many are still open
+func (s *GBoxServer) Drain(timeout time.Duration) int {
+	return s.drain.Drain(timeout)
+}
+
+// ActiveStreams returns the number of open streams and requests
+func (s *GBoxServer) ActiveStreams() int {
+	return s.drain.Active()
+}
+
+// IsDraining reports whether the server is shutting down
+func (s *GBoxServer) IsDraining() bool {
+	return s.drain.Draining()
 }
 
 // Stop stops the server
@@ -102,6 +142,10 @@ func (s *GBoxServer) Stop() error {
 	s.bridgeManager.Close()
 	s.deviceKeeper.Close()
 
+	if s.pidFile != "" {
+		daemon.RemovePIDFile(s.pidFile)
+	}
+
 	log.Println("GBox server stopped")
 	return nil
 }
@@ -170,6 +214,11 @@ func (s *GBoxServer) IsADBExposeRunning() bool {
 	return true // Always available through handlers
 }
 
+// IsLocalOnly reports whether devices are served without the cloud
+func (s *GBoxServer) IsLocalOnly() bool {
+	return s.deviceKeeper.localOnly
+}
+
 // ListBridges returns list of bridge device serials
 func (s *GBoxServer) ListBridges() []string {
 	return s.bridgeManager.ListBridges()
@@ -240,6 +289,13 @@ func (lw *loggingResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Flush lets streaming handlers such as /api/events push data through the middleware
+func (lw *loggingResponseWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (w *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hj, ok := w.ResponseWriter.(http.Hijacker)
 	if !ok {
@@ -271,12 +327,68 @@ func (s *GBoxServer) DisconnectAP(serial string) error {
 	return s.deviceKeeper.disconnectAPForce(serial)
 }
 
+func (s *GBoxServer) RegisteredDevices() []device.RegistryEntry {
+	return s.deviceKeeper.RegisteredDevices()
+}
+
+func (s *GBoxServer) RecordRegisteredDevice(entry device.RegistryEntry) {
+	s.deviceKeeper.RecordRegisteredDevice(entry)
+}
+
+func (s *GBoxServer) ForgetDevice(key string) {
+	s.deviceKeeper.ForgetDevice(key)
+}
+
 func (s *GBoxServer) GetSerialByDeviceId(deviceId string) string {
 	return s.deviceKeeper.getSerialByDeviceId(deviceId)
 }
 
 func (s *GBoxServer) GetDeviceInfo(serial string) interface{} {
-	return s.deviceKeeper.GetDeviceInfo(serial)
+	// A nil *DeviceDTO must not become a non-nil interface
+	if dto := s.deviceKeeper.GetDeviceInfo(serial); dto != nil {
+		return dto
+	}
+	return nil
+}
+
+func (s *GBoxServer) DeviceHealth(serial string, refresh bool) (*serverclient.DeviceHealth, error) {
+	return s.deviceKeeper.DeviceHealth(serial, refresh)
+}
+
+func (s *GBoxServer) DeviceLabels(serialno string) map[string]string {
+	return s.deviceKeeper.DeviceLabels(serialno)
+}
+
+func (s *GBoxServer) SetDeviceLabels(serialno string, set map[string]string, remove []string) (map[string]string, error) {
+	return s.deviceKeeper.SetDeviceLabels(serialno, set, remove)
+}
+
+func (s *GBoxServer) AcquireLease(serial, serialno string, req serverclient.LeaseRequest) (*serverclient.DeviceLease, error) {
+	return s.deviceKeeper.AcquireLease(serial, serialno, req)
+}
+
+func (s *GBoxServer) RenewLease(serial, id string) (*serverclient.DeviceLease, error) {
+	return s.deviceKeeper.RenewLease(serial, id)
+}
+
+func (s *GBoxServer) ReleaseLease(serial, id string, force bool) (*serverclient.DeviceLease, error) {
+	return s.deviceKeeper.ReleaseLease(serial, id, force)
+}
+
+func (s *GBoxServer) DeviceLease(serial string) *serverclient.DeviceLease {
+	return s.deviceKeeper.DeviceLease(serial)
+}
+
+func (s *GBoxServer) CheckLease(serial, id string) error {
+	return s.deviceKeeper.CheckLease(serial, id)
+}
+
+func (s *GBoxServer) WirelessDevices() ([]serverclient.WirelessDevice, error) {
+	return s.deviceKeeper.WirelessDevices()
+}
+
+func (s *GBoxServer) PairDevice(req serverclient.PairRequest) (*serverclient.PairResponse, error) {
+	return s.deviceKeeper.PairDevice(req)
 }
 
 func (s *GBoxServer) UpdateDeviceInfo(device interface{}) {
@@ -296,3 +408,27 @@ func (s *GBoxServer) GetDeviceReconnectState(serial string) interface{} {
 func (s *GBoxServer) ReconnectRegisteredDevices() error {
 	return s.deviceKeeper.ReconnectRegisteredDevices()
 }
+
+func (s *GBoxServer) ReconnectDevice(serial string) error {
+	return s.deviceKeeper.ReconnectDevice(serial)
+}
+
+func (s *GBoxServer) ReconnectPolicy(serial string) device.ReconnectPolicy {
+	return s.deviceKeeper.ReconnectPolicy(serial)
+}
+
+func (s *GBoxServer) SetReconnectPolicy(serial string, policy *device.ReconnectPolicy) error {
+	return s.deviceKeeper.SetReconnectPolicy(serial, policy)
+}
+
+func (s *GBoxServer) ConnectExposedDevice(boxID, host string, port int) (string, error) {
+	return s.deviceKeeper.ConnectExposedDevice(boxID, host, port)
+}
+
+func (s *GBoxServer) DisconnectExposedDevice(serial string) error {
+	return s.deviceKeeper.DisconnectExposedDevice(serial)
+}
+
+func (s *GBoxServer) GetExposedBoxID(serial string) string {
+	return s.deviceKeeper.GetExposedBoxID(serial)
+}
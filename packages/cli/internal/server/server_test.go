@@ -0,0 +1,377 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/babelcloud/gbox/packages/cli/internal/device_connect/scrcpy/scrcpytest"
+	"github.com/babelcloud/gbox/packages/cli/internal/events"
+	"github.com/babelcloud/gbox/packages/cli/internal/profile"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	adb "github.com/basiooo/goadb"
+	"github.com/gorilla/websocket"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Without a current profile the device keeper never reaches the cloud
+	profile.Default = profile.NewProfileManager()
+	os.Exit(m.Run())
+}
+
+// startTestServer runs a GBoxServer against a fake adb server and returns
+// its base URL
+func startTestServer(t *testing.T) (string, *adbtest.Server) {
+	adbServer := adbtest.NewServer(t)
+	adbServer.Setenv(t)
+	t.Setenv("GBOX_HOME", t.TempDir())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	s := NewGBoxServer(port)
+	errc := make(chan error, 1)
+	go func() { errc <- s.Start() }()
+
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+	client := serverclient.New(base)
+	require.Eventually(t, func() bool {
+		select {
+		case err := <-errc:
+			t.Fatalf("server exited: %v", err)
+		default:
+		}
+		_, err := client.Health()
+		return err == nil
+	}, 10*time.Second, 20*time.Millisecond)
+
+	t.Cleanup(func() {
+		s.Stop()
+		<-errc
+	})
+	return base, adbServer
+}
+
+// addAndroidDevice adds an online device answering the identity queries of
+// the device list
+func addAndroidDevice(adbServer *adbtest.Server, serial string) *adbtest.Device {
+	d := adbServer.AddDevice(serial)
+	d.ShellOutput("getprop ro.serialno", serial+"\n")
+	d.ShellOutput("settings get secure android_id", "a1b2c3d4e5f60718\n")
+	d.ShellOutput("settings get global gbox_reg_id", "null\n")
+	return d
+}
+
+func TestServerListsDevices(t *testing.T) {
+	base, adbServer := startTestServer(t)
+	addAndroidDevice(adbServer, "list-5554")
+	adbServer.AddDevice("list-5556").SetState("unauthorized")
+
+	devices, err := serverclient.New(base).Devices()
+	require.NoError(t, err)
+	var android []serverclient.Device
+	for _, d := range devices {
+		if !d.IsLocal {
+			android = append(android, d)
+		}
+	}
+	// The unauthorized device is left out, the local desktop is always listed
+	require.Len(t, android, 1)
+	assert.Equal(t, "list-5554", android[0].TransportID)
+	assert.Equal(t, "list-5554", android[0].Serialno)
+	assert.Equal(t, "android", android[0].OS)
+	assert.Equal(t, "gbox_fake", android[0].MetadataString("model"))
+	assert.False(t, android[0].IsRegistered)
+}
+
+func TestServerLocalOnly(t *testing.T) {
+	t.Setenv("GBOX_LOCAL_ONLY", "true")
+	base, adbServer := startTestServer(t)
+	addAndroidDevice(adbServer, "lab-5554")
+	client := serverclient.New(base)
+
+	info, err := client.ServerInfo()
+	require.NoError(t, err)
+	assert.True(t, info.LocalOnly)
+
+	devices, err := client.Devices()
+	require.NoError(t, err)
+	var found bool
+	for _, d := range devices {
+		if d.TransportID == "lab-5554" {
+			found = true
+			assert.False(t, d.IsRegistered)
+			assert.False(t, d.IsConnected)
+		}
+	}
+	assert.True(t, found, "local devices are listed without the cloud")
+
+	// Registration and access point sessions need the cloud
+	_, err = client.RegisterDevice(serverclient.RegisterDeviceRequest{DeviceID: "lab-5554", DeviceType: "mobile", OsType: "android"})
+	assert.Equal(t, http.StatusConflict, serverclient.StatusCode(err))
+	assert.ErrorContains(t, err, "local-only mode")
+	_, err = client.ReconnectDevice("lab-5554", nil)
+	assert.Equal(t, http.StatusConflict, serverclient.StatusCode(err))
+}
+
+func TestServerPublishesDeviceState(t *testing.T) {
+	sub := events.Default.Subscribe(0, events.Filter{
+		Types:   []string{string(events.DeviceState)},
+		Subject: "state-5554",
+	})
+	defer sub.Close()
+
+	_, adbServer := startTestServer(t)
+	d := addAndroidDevice(adbServer, "state-5554")
+
+	next := func() events.Event {
+		select {
+		case event := <-sub.C():
+			return event
+		case <-time.After(10 * time.Second):
+			t.Fatal("no device state event")
+			return events.Event{}
+		}
+	}
+	event := next()
+	assert.Equal(t, adb.StateOnline.String(), event.Data["new_state"])
+
+	d.SetState("offline")
+	event = next()
+	assert.Equal(t, adb.StateOnline.String(), event.Data["old_state"])
+	assert.Equal(t, adb.StateOffline.String(), event.Data["new_state"])
+}
+
+func TestServerExecOnDevice(t *testing.T) {
+	base, adbServer := startTestServer(t)
+	d := addAndroidDevice(adbServer, "exec-5554")
+	d.HandleShell("cd /data/local/tmp &&", func(cmd string, _ io.Reader, stdout, stderr io.Writer) int {
+		if strings.HasSuffix(cmd, "&& echo hi") {
+			io.WriteString(stdout, "hi\n")
+			return 0
+		}
+		io.WriteString(stderr, "unexpected command\n")
+		return 2
+	})
+
+	exec := func(cmd string) map[string]interface{} {
+		body, _ := json.Marshal(map[string]string{"cmd": cmd})
+		resp, err := http.Post(base+"/api/devices/exec-5554/exec", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var result map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	result := exec("echo hi")
+	assert.Equal(t, "hi\n", result["stdout"])
+	assert.Equal(t, float64(0), result["exitCode"])
+
+	result = exec("false")
+	assert.Equal(t, "unexpected command\n", result["stderr"])
+	assert.Equal(t, float64(2), result["exitCode"])
+}
+
+func TestServerDeviceFiles(t *testing.T) {
+	base, adbServer := startTestServer(t)
+	d := addAndroidDevice(adbServer, "files-5554")
+	files := base + "/api/devices/files-5554/files"
+
+	resp, err := http.Post(files+"?path=/sdcard/notes.txt", "text/plain", strings.NewReader("hello device"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	content, ok := d.ReadFile("/sdcard/notes.txt")
+	require.True(t, ok)
+	assert.Equal(t, "hello device", string(content))
+
+	resp, err = http.Get(files + "?path=/sdcard/notes.txt")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello device", string(body))
+
+	resp, err = http.Get(files + "?path=/sdcard/missing.txt")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(files + "/exists?path=/sdcard/notes.txt")
+	require.NoError(t, err)
+	var exists map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&exists))
+	resp.Body.Close()
+	assert.Equal(t, true, exists["exists"])
+
+	// One unreadable subdirectory does not fail the listing
+	d.WriteFile("/sdcard/DCIM/photo.jpg", []byte("jpeg"), 0o644)
+	d.DenyList("/sdcard/Android")
+	resp, err = http.Get(files + "/list?path=/sdcard&depth=2")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list []map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	entries := map[string]map[string]interface{}{}
+	for _, entry := range list {
+		entries[entry["path"].(string)] = entry
+	}
+	assert.Contains(t, entries, "/sdcard/notes.txt")
+	assert.Contains(t, entries, "/sdcard/DCIM/photo.jpg")
+	require.Contains(t, entries, "/sdcard/Android")
+	assert.Contains(t, entries["/sdcard/Android"]["error"], "Permission denied")
+
+	// Listing a missing directory is not found rather than empty
+	resp, err = http.Get(files + "/list?path=/sdcard/missing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServerStreamsDeviceVideo(t *testing.T) {
+	base, adbServer := startTestServer(t)
+	d := addAndroidDevice(adbServer, "video-5554")
+	fake := scrcpytest.NewServer()
+	fake.Install(d)
+
+	resp, err := http.Get(base + "/api/devices/video-5554/video?codec=h264&format=annexb")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Read until the first IDR slice of the Annex B stream
+	idr := []byte{0, 0, 0, 1, 0x65}
+	var stream []byte
+	buf := make([]byte, 4096)
+	deadline := time.Now().Add(10 * time.Second)
+	for !bytes.Contains(stream, idr) {
+		require.True(t, time.Now().Before(deadline), "no key frame in %d bytes", len(stream))
+		n, err := resp.Body.Read(buf)
+		stream = append(stream, buf[:n]...)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, fake.Started())
+	// The H.264 HTTP stream uses the software encoder for compatibility
+	assert.Equal(t, "OMX.google.h264.encoder", fake.Options()["video_encoder"])
+}
+
+func TestServerStreamsDeviceWebRTC(t *testing.T) {
+	base, adbServer := startTestServer(t)
+	d := addAndroidDevice(adbServer, "webrtc-5554")
+	scrcpytest.NewServer().Install(d)
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		_, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		require.NoError(t, err)
+	}
+
+	// Depacketize the H.264 track until a key frame is complete and keep the
+	// payload of the first Opus packet
+	video := make(chan []byte, 1)
+	audio := make(chan []byte, 1)
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		var depacketizer codecs.H264Packet
+		var stream []byte
+		for {
+			packet, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			switch track.Codec().MimeType {
+			case webrtc.MimeTypeOpus:
+				select {
+				case audio <- packet.Payload:
+				default:
+				}
+			case webrtc.MimeTypeH264:
+				data, err := depacketizer.Unmarshal(packet.Payload)
+				if err != nil {
+					continue
+				}
+				stream = append(stream, data...)
+				if packet.Marker && bytes.Contains(stream, []byte{0, 0, 0, 1, 0x65}) {
+					select {
+					case video <- stream:
+					default:
+					}
+					return
+				}
+			}
+		}
+	})
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+	gathered := webrtc.GatheringCompletePromise(pc)
+	require.NoError(t, pc.SetLocalDescription(offer))
+	<-gathered
+
+	// Signaling runs over the control WebSocket of the device
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(base, "http")+"/api/devices/webrtc-5554/control", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type":  "offer",
+		"offer": map[string]interface{}{"type": "offer", "sdp": pc.LocalDescription().SDP},
+	}))
+	go func() {
+		for {
+			var msg struct {
+				Type      string                    `json:"type"`
+				Error     string                    `json:"error"`
+				Answer    webrtc.SessionDescription `json:"answer"`
+				Candidate webrtc.ICECandidateInit   `json:"candidate"`
+			}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			switch msg.Type {
+			case "answer":
+				if err := pc.SetRemoteDescription(msg.Answer); err != nil {
+					t.Errorf("set answer: %v", err)
+				}
+			case "ice-candidate":
+				pc.AddICECandidate(msg.Candidate)
+			case "error":
+				t.Errorf("signaling error: %s", msg.Error)
+			}
+		}
+	}()
+
+	select {
+	case stream := <-video:
+		// The key frame arrives as sent by the device, after SPS and PPS
+		frame := scrcpytest.H264Packets()[1].Data
+		idr := frame[bytes.Index(frame, []byte{0, 0, 0, 1, 0x65}):]
+		assert.True(t, bytes.Contains(stream, idr), "key frame not in %d bytes of video", len(stream))
+		assert.True(t, bytes.Contains(stream, []byte{0, 0, 0, 1, 0x67}), "no SPS before the key frame")
+	case <-time.After(20 * time.Second):
+		t.Fatalf("no video key frame, connection state %s", pc.ConnectionState())
+	}
+	select {
+	case payload := <-audio:
+		assert.Equal(t, scrcpytest.OpusPackets()[1].Data, payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no audio packet")
+	}
+}
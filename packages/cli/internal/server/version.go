@@ -1,8 +1,6 @@
 package server
 
 import (
-	"fmt"
-	"os"
 	"runtime"
 	"time"
 
@@ -22,24 +20,7 @@ var BuildInfo = struct {
 	GoVersion: runtime.Version(),
 }
 
-// GetBuildID returns a unique build identifier
+// GetBuildID returns a unique build identifier, see version.BuildID
 func GetBuildID() string {
-	// Use build time + git commit + file size as build ID
-	// In production, this would be set by build scripts
-	execPath, err := os.Executable()
-	if err != nil {
-		return BuildInfo.BuildTime + "-" + BuildInfo.GitCommit + "-unknown"
-	}
-
-	info, err := os.Stat(execPath)
-	if err != nil {
-		return BuildInfo.BuildTime + "-" + BuildInfo.GitCommit + "-unknown"
-	}
-
-	// Use the same format as client for consistency
-	buildTime := info.ModTime().Format("2006-01-02T15:04:05") // No timezone, more stable
-	gitCommit := "unknown"
-	fileSize := info.Size()
-
-	return fmt.Sprintf("%s-%s-%d", buildTime, gitCommit, fileSize)
+	return version.BuildID()
 }
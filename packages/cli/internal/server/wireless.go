@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/pkg/errors"
+)
+
+// wirelessState is what discovery knows of a wireless debugging device
+type wirelessState struct {
+	// Addr is where the device was last connected
+	Addr string
+	// FailedAddr is where connecting failed, it is not tried again until the
+	// device moves or is paired
+	FailedAddr string
+	Err        string
+}
+
+// startWirelessDiscovery connects the wireless debugging devices on the LAN
+// every interval until the keeper is closed
+func (dm *DeviceKeeper) startWirelessDiscovery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if config.GetWirelessDiscovery() {
+				dm.discoverWirelessDevices()
+			}
+		case <-dm.done:
+			return
+		}
+	}
+}
+
+// discoverWirelessDevices connects the devices the adb server found with
+// mDNS and follows them to their new port when wireless debugging restarts.
+// A connected device comes online in the adb device watcher, which connects
+// it to the access point like any other.
+func (dm *DeviceKeeper) discoverWirelessDevices() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	services, err := dm.adb.MDNSServices(ctx)
+	if err != nil {
+		log.Printf("Wireless discovery: failed to list mdns services: %v", err)
+		return
+	}
+	online, err := dm.onlineAdbSerials(ctx)
+	if err != nil {
+		log.Printf("Wireless discovery: %v", err)
+		return
+	}
+
+	for _, svc := range services {
+		if svc.Service != adbserver.ServiceTLSConnect {
+			continue
+		}
+		dm.wirelessMu.Lock()
+		state := dm.wirelessState(svc.Name)
+		if online[svc.Addr] {
+			// Remember where it is, to follow it when the port changes
+			state.Addr = svc.Addr
+		}
+		dm.wirelessMu.Unlock()
+		// Connected already, by us, by the adb server itself or over USB
+		if online[svc.Addr] || online[svc.Serial()] || (svc.SerialNo() != "" && online[svc.SerialNo()]) {
+			continue
+		}
+
+		dm.wirelessMu.Lock()
+		failed, oldAddr := state.FailedAddr == svc.Addr, state.Addr
+		dm.wirelessMu.Unlock()
+		if failed {
+			continue
+		}
+
+		// The old port is closed, drop its connection so adb stops retrying it
+		if oldAddr != "" && oldAddr != svc.Addr {
+			log.Printf("device %s: wireless debugging moved from %s to %s", svc.Name, oldAddr, svc.Addr)
+			if err := dm.adb.Disconnect(ctx, oldAddr); err != nil {
+				log.Printf("device %s: failed to disconnect %s: %v", svc.Name, oldAddr, err)
+			}
+		}
+		if _, err := dm.connectWireless(ctx, svc.Name, svc.Addr); err != nil {
+			log.Printf("Wireless discovery: %v", err)
+		}
+	}
+}
+
+// connectWireless connects the adb server to a wireless debugging device
+// and records the outcome for discovery
+func (dm *DeviceKeeper) connectWireless(ctx context.Context, name, addr string) (string, error) {
+	msg, err := dm.adb.Connect(ctx, addr)
+
+	dm.wirelessMu.Lock()
+	defer dm.wirelessMu.Unlock()
+	state := dm.wirelessState(name)
+	if err != nil {
+		state.FailedAddr, state.Err = addr, err.Error()
+		return "", err
+	}
+	log.Printf("device %s: %s", name, msg)
+	state.Addr, state.FailedAddr, state.Err = addr, "", ""
+	return msg, nil
+}
+
+// wirelessState returns the state of a device, the caller holds wirelessMu
+func (dm *DeviceKeeper) wirelessState(name string) *wirelessState {
+	state, ok := dm.wirelessStates[name]
+	if !ok {
+		state = &wirelessState{}
+		dm.wirelessStates[name] = state
+	}
+	return state
+}
+
+// onlineAdbSerials returns the serials of the online devices of the adb server
+func (dm *DeviceKeeper) onlineAdbSerials(ctx context.Context) (map[string]bool, error) {
+	entries, err := dm.adb.Devices(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list adb devices")
+	}
+	online := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.State == "device" {
+			online[entry.Serial] = true
+		}
+	}
+	return online, nil
+}
+
+// WirelessDevices lists the wireless debugging services on the LAN and
+// whether their devices are connected
+func (dm *DeviceKeeper) WirelessDevices() ([]serverclient.WirelessDevice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	services, err := dm.adb.MDNSServices(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list mdns services")
+	}
+	online, err := dm.onlineAdbSerials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dm.wirelessMu.Lock()
+	defer dm.wirelessMu.Unlock()
+	devices := make([]serverclient.WirelessDevice, 0, len(services))
+	for _, svc := range services {
+		d := serverclient.WirelessDevice{
+			Name:     svc.Name,
+			Service:  "connect",
+			Address:  svc.Addr,
+			SerialNo: svc.SerialNo(),
+		}
+		switch svc.Service {
+		case adbserver.ServiceTLSPairing:
+			d.Service = "pairing"
+		case adbserver.ServiceTLSConnect:
+			for _, serial := range []string{svc.Addr, svc.Serial(), svc.SerialNo()} {
+				if serial != "" && online[serial] {
+					d.Serial, d.Connected = serial, true
+					break
+				}
+			}
+			if state, ok := dm.wirelessStates[svc.Name]; ok && !d.Connected && state.FailedAddr == svc.Addr {
+				d.Error = state.Err
+			}
+		default:
+			continue
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// PairDevice pairs the adb server with a device showing a wireless
+// debugging pairing code, or that scanned a pairing QR code, and connects to
+// it. The connect address is found with mDNS when the request leaves it out.
+func (dm *DeviceKeeper) PairDevice(req serverclient.PairRequest) (*serverclient.PairResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	msg, err := dm.adb.Pair(ctx, req.Address, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	resp := &serverclient.PairResponse{Success: true, Message: msg}
+
+	// Connecting to the device failed before it was paired, try again
+	host := hostOf(req.Address)
+	dm.wirelessMu.Lock()
+	for _, state := range dm.wirelessStates {
+		if state.FailedAddr != "" && hostOf(state.FailedAddr) == host {
+			state.FailedAddr, state.Err = "", ""
+		}
+	}
+	dm.wirelessMu.Unlock()
+
+	name, addr := "", req.ConnectAddress
+	if addr == "" {
+		services, err := dm.adb.MDNSServices(ctx)
+		if err != nil {
+			log.Printf("Pairing: failed to list mdns services: %v", err)
+		}
+		for _, svc := range services {
+			if svc.Service == adbserver.ServiceTLSConnect && svc.Host() == host {
+				name, addr = svc.Name, svc.Addr
+			}
+		}
+	}
+	if addr == "" {
+		resp.Message += "; the device is connected once it is found on the LAN"
+		return resp, nil
+	}
+	if name == "" {
+		name = addr
+	}
+
+	connected, err := dm.connectWireless(ctx, name, addr)
+	if err != nil {
+		resp.Message += "; " + err.Error()
+		return resp, nil
+	}
+	resp.Message += "; " + connected
+	resp.Serial = addr
+	return resp, nil
+}
+
+// hostOf returns the host of a host:port address
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver/adbtest"
+	"github.com/babelcloud/gbox/packages/cli/pkg/serverclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func adbSerials(t *testing.T, client *adbserver.Client) map[string]string {
+	t.Helper()
+	entries, err := client.Devices(context.Background())
+	require.NoError(t, err)
+	states := make(map[string]string)
+	for _, e := range entries {
+		states[e.Serial] = e.State
+	}
+	return states
+}
+
+func TestWirelessPairAndFollowPort(t *testing.T) {
+	adbServer := adbtest.NewServer(t)
+	dm := &DeviceKeeper{adb: adbServer.Client(), wirelessStates: make(map[string]*wirelessState)}
+	d := adbServer.AddWirelessDevice("adb-R58N123ABC-vWgJpq")
+	d.Listen("192.168.1.20:41235")
+
+	// Not paired yet, connecting fails and is not retried on every round
+	dm.discoverWirelessDevices()
+	devices, err := dm.WirelessDevices()
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.False(t, devices[0].Connected)
+	assert.Equal(t, "R58N123ABC", devices[0].SerialNo)
+	assert.Contains(t, devices[0].Error, "failed to connect")
+
+	d.StartPairing("192.168.1.20:37099", "482913")
+	devices, err = dm.WirelessDevices()
+	require.NoError(t, err)
+	assert.Len(t, devices, 2)
+
+	_, err = dm.PairDevice(serverclient.PairRequest{Address: "192.168.1.20:37099", Code: "000000"})
+	assert.ErrorContains(t, err, "Wrong password")
+	resp, err := dm.PairDevice(serverclient.PairRequest{Address: "192.168.1.20:37099", Code: "482913"})
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, "192.168.1.20:41235", resp.Serial, "connected to the address found with mDNS")
+	assert.Equal(t, map[string]string{"192.168.1.20:41235": "device"}, adbSerials(t, dm.adb))
+
+	devices, err = dm.WirelessDevices()
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.True(t, devices[0].Connected)
+	assert.Empty(t, devices[0].Error)
+
+	// Wireless debugging restarts on another port
+	d.Listen("192.168.1.20:43001")
+	assert.Equal(t, "offline", adbSerials(t, dm.adb)["192.168.1.20:41235"])
+	dm.discoverWirelessDevices()
+	assert.Equal(t, map[string]string{"192.168.1.20:43001": "device"}, adbSerials(t, dm.adb))
+}
+
+func TestWirelessSkipsConnectedDevices(t *testing.T) {
+	adbServer := adbtest.NewServer(t)
+	dm := &DeviceKeeper{adb: adbServer.Client(), wirelessStates: make(map[string]*wirelessState)}
+	// Attached over USB, and advertising wireless debugging
+	adbServer.AddDevice("R58N123ABC")
+	d := adbServer.AddWirelessDevice("adb-R58N123ABC-vWgJpq")
+	d.StartPairing("192.168.1.20:37099", "482913")
+	_, err := adbServer.Client().Pair(context.Background(), "192.168.1.20:37099", "482913")
+	require.NoError(t, err)
+	d.Listen("192.168.1.20:41235")
+
+	dm.discoverWirelessDevices()
+	assert.Equal(t, map[string]string{"R58N123ABC": "device"}, adbSerials(t, dm.adb))
+	devices, err := dm.WirelessDevices()
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, "R58N123ABC", devices[0].Serial)
+	assert.True(t, devices[0].Connected)
+}
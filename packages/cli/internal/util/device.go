@@ -1,9 +1,12 @@
 package util
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/babelcloud/gbox/packages/cli/internal/adbserver"
 )
 
 // GetDesktopSerialNo gets the serial number for a desktop device based on OS type.
@@ -149,14 +152,11 @@ func DetectAndroidDeviceType(deviceID, serialNo string) string {
 	}
 
 	// Try to detect via ADB properties
-	adbPath, err := exec.LookPath("adb")
-	if err != nil {
-		adbPath = "adb"
-	}
+	dev := adbserver.DefaultClient().Device(deviceID)
+	ctx := context.Background()
 
 	// Check hardware property
-	cmd := exec.Command(adbPath, "-s", deviceID, "shell", "getprop", "ro.hardware")
-	output, err := cmd.Output()
+	output, err := dev.Output(ctx, "getprop ro.hardware")
 	if err == nil {
 		hardware := strings.TrimSpace(string(output))
 		// Common emulator hardware types
@@ -166,8 +166,7 @@ func DetectAndroidDeviceType(deviceID, serialNo string) string {
 	}
 
 	// Check product brand
-	cmd = exec.Command(adbPath, "-s", deviceID, "shell", "getprop", "ro.product.brand")
-	output, err = cmd.Output()
+	output, err = dev.Output(ctx, "getprop ro.product.brand")
 	if err == nil {
 		brand := strings.ToLower(strings.TrimSpace(string(output)))
 		if brand == "generic" || brand == "unknown" {
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressReader wraps a reader and renders a single-line progress bar with byte counts
+type ProgressReader struct {
+	reader io.Reader
+	out    io.Writer
+	label  string
+	total  int64 // -1 or 0 when unknown
+
+	mu        sync.Mutex
+	current   int64
+	lastDraw  time.Time
+	startedAt time.Time
+	finished  bool
+}
+
+// NewProgressReader creates a progress reader. Pass total <= 0 when the size is unknown.
+func NewProgressReader(r io.Reader, out io.Writer, label string, total int64) *ProgressReader {
+	return &ProgressReader{
+		reader:    r,
+		out:       out,
+		label:     label,
+		total:     total,
+		startedAt: time.Now(),
+	}
+}
+
+// Read implements io.Reader
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	if n > 0 {
+		p.mu.Lock()
+		p.current += int64(n)
+		if time.Since(p.lastDraw) >= 100*time.Millisecond {
+			p.draw()
+		}
+		p.mu.Unlock()
+	}
+	return n, err
+}
+
+// Current returns the number of bytes read so far
+func (p *ProgressReader) Current() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current
+}
+
+// Finish draws the final state and terminates the progress line
+func (p *ProgressReader) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return
+	}
+	p.finished = true
+	p.draw()
+	fmt.Fprintln(p.out)
+}
+
+func (p *ProgressReader) draw() {
+	p.lastDraw = time.Now()
+
+	elapsed := time.Since(p.startedAt).Seconds()
+	rate := ""
+	if elapsed > 0 {
+		rate = fmt.Sprintf(" %s/s", FormatBytes(int64(float64(p.current)/elapsed)))
+	}
+
+	if p.total <= 0 {
+		fmt.Fprintf(p.out, "\r%s %s%s   ", p.label, FormatBytes(p.current), rate)
+		return
+	}
+
+	const width = 30
+	ratio := float64(p.current) / float64(p.total)
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * width)
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+	fmt.Fprintf(p.out, "\r%s [%s] %s / %s %3.0f%%%s   ", p.label, bar, FormatBytes(p.current), FormatBytes(p.total), ratio*100, rate)
+}
+
+// FormatBytes formats a byte count using binary units (e.g. 1.5 MiB)
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
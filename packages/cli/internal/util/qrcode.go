@@ -0,0 +1,414 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// QR codes of up to version 5 with low error correction, in byte mode. That
+// is enough for the short texts shown on a terminal, such as the pairing
+// code of Android wireless debugging, and keeps every version a single
+// Reed-Solomon block.
+
+// qrVersions are the data and error correction codewords of versions 1 to 5
+// at error correction level L
+var qrVersions = []struct{ data, ec int }{
+	{19, 7}, {34, 10}, {55, 15}, {80, 20}, {108, 26},
+}
+
+// QRCode returns the modules of a QR code of text, true for dark, indexed
+// by row then column
+func QRCode(text string) ([][]bool, error) {
+	return qrEncode(text, -1)
+}
+
+// qrEncode returns the modules of a QR code of text with mask, or with the
+// mask that is easiest to scan when mask is negative
+func qrEncode(text string, mask int) ([][]bool, error) {
+	version := 0
+	for i, v := range qrVersions {
+		// 4 bits of mode, 8 of length, then the bytes
+		if 12+8*len(text) <= 8*v.data {
+			version = i + 1
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("text of %d bytes is too long for a QR code", len(text))
+	}
+	v := qrVersions[version-1]
+
+	codewords := qrData(text, v.data)
+	codewords = append(codewords, rsRemainder(codewords, v.ec)...)
+
+	q := newQRMatrix(version)
+	q.drawFunctionPatterns()
+	q.drawCodewords(codewords)
+
+	// Pick the mask that is easiest to scan
+	if mask < 0 {
+		bestPenalty := -1
+		for m := 0; m < 8; m++ {
+			q.applyMask(m)
+			q.drawFormat(m)
+			if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+				mask, bestPenalty = m, penalty
+			}
+			q.applyMask(m) // masking twice undoes it
+		}
+	}
+	q.applyMask(mask)
+	q.drawFormat(mask)
+	return q.modules, nil
+}
+
+// WriteQRCode draws a QR code of text on a terminal, two rows of modules per
+// line. The colors are set explicitly, so it scans on dark themes too.
+func WriteQRCode(w io.Writer, text string) error {
+	modules, err := QRCode(text)
+	if err != nil {
+		return err
+	}
+	const quiet = 2
+	size := len(modules)
+	dark := func(row, col int) bool {
+		row, col = row-quiet, col-quiet
+		return row >= 0 && row < size && col >= 0 && col < size && modules[row][col]
+	}
+	color := func(dark bool, fg bool) int {
+		switch {
+		case dark && fg:
+			return 30
+		case dark:
+			return 40
+		case fg:
+			return 97
+		default:
+			return 107
+		}
+	}
+
+	var b strings.Builder
+	for row := 0; row < size+2*quiet; row += 2 {
+		for col := 0; col < size+2*quiet; col++ {
+			// The upper half block is the upper row, its background the lower
+			fmt.Fprintf(&b, "\x1b[%d;%dm▀", color(dark(row, col), true), color(dark(row+1, col), false))
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// qrData encodes text in byte mode and pads it to n codewords
+func qrData(text string, n int) []byte {
+	var bits []bool
+	put := func(value, count int) {
+		for i := count - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+	put(0x4, 4)
+	put(len(text), 8)
+	for i := 0; i < len(text); i++ {
+		put(int(text[i]), 8)
+	}
+	// Terminator, then up to a byte boundary
+	for i := 0; i < 4 && len(bits) < 8*n; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	data := make([]byte, 0, n)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		data = append(data, b)
+	}
+	for pad := byte(0xec); len(data) < n; pad ^= 0xec ^ 0x11 {
+		data = append(data, pad)
+	}
+	return data
+}
+
+// rsRemainder returns the n Reed-Solomon error correction codewords of data
+func rsRemainder(data []byte, n int) []byte {
+	// The generator polynomial, the product of (x - 2^i) for i below n,
+	// without its leading 1
+	divisor := make([]byte, n)
+	divisor[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := range divisor {
+			divisor[j] = gfMultiply(divisor[j], root)
+			if j+1 < n {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMultiply(root, 2)
+	}
+
+	remainder := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[n-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return remainder
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11d)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+type qrMatrix struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool // modules that are not data
+}
+
+func newQRMatrix(version int) *qrMatrix {
+	size := 17 + 4*version
+	q := &qrMatrix{version: version, size: size}
+	q.modules = make([][]bool, size)
+	q.function = make([][]bool, size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	return q
+}
+
+func (q *qrMatrix) set(row, col int, dark bool) {
+	q.modules[row][col] = dark
+	q.function[row][col] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and
+// reserves the format areas
+func (q *qrMatrix) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(3, q.size-4)
+	q.drawFinder(q.size-4, 3)
+	// Versions 2 to 6 have a single alignment pattern
+	if q.version > 1 {
+		center := q.size - 7
+		for dr := -2; dr <= 2; dr++ {
+			for dc := -2; dc <= 2; dc++ {
+				q.set(center+dr, center+dc, max(abs(dr), abs(dc)) != 1)
+			}
+		}
+	}
+	q.drawFormat(0)
+}
+
+// drawFinder draws a finder pattern and its separator around center
+func (q *qrMatrix) drawFinder(row, col int) {
+	for dr := -4; dr <= 4; dr++ {
+		for dc := -4; dc <= 4; dc++ {
+			r, c := row+dr, col+dc
+			if r < 0 || r >= q.size || c < 0 || c >= q.size {
+				continue
+			}
+			dist := max(abs(dr), abs(dc))
+			q.set(r, c, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawFormat draws the error correction level L and mask in both format
+// areas, and the dark module
+func (q *qrMatrix) drawFormat(mask int) {
+	data := 1<<3 | mask // L is 01
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(i, 8, bit(i))
+	}
+	q.set(7, 8, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(8, 7, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(8, 14-i, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(8, q.size-1-i, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(q.size-15+i, 8, bit(i))
+	}
+	q.set(q.size-8, 8, true)
+}
+
+// drawCodewords fills the data modules in the zigzag order of the standard:
+// column pairs from the right, alternately upwards and downwards
+func (q *qrMatrix) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.size; vert++ {
+			row := vert
+			if upward {
+				row = q.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				col := right - j
+				if q.function[row][col] || i >= len(codewords)*8 {
+					continue
+				}
+				q.modules[row][col] = (codewords[i/8]>>(7-i%8))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by mask
+func (q *qrMatrix) applyMask(mask int) {
+	for row := 0; row < q.size; row++ {
+		for col := 0; col < q.size; col++ {
+			if q.function[row][col] {
+				continue
+			}
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (row+col)%2 == 0
+			case 1:
+				flip = row%2 == 0
+			case 2:
+				flip = col%3 == 0
+			case 3:
+				flip = (row+col)%3 == 0
+			case 4:
+				flip = (row/2+col/3)%2 == 0
+			case 5:
+				flip = row*col%2+row*col%3 == 0
+			case 6:
+				flip = (row*col%2+row*col%3)%2 == 0
+			case 7:
+				flip = ((row+col)%2+row*col%3)%2 == 0
+			}
+			if flip {
+				q.modules[row][col] = !q.modules[row][col]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan, by the rules of the standard
+func (q *qrMatrix) penalty() int {
+	penalty := 0
+	at := func(row, col int, transposed bool) bool {
+		if transposed {
+			return q.modules[col][row]
+		}
+		return q.modules[row][col]
+	}
+
+	for _, transposed := range []bool{false, true} {
+		for row := 0; row < q.size; row++ {
+			// Runs of five or more modules of the same color
+			run := 1
+			for col := 1; col < q.size; col++ {
+				if at(row, col, transposed) == at(row, col-1, transposed) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				penalty += run - 2
+			}
+			// Patterns that look like a finder
+			for col := 0; col+7 <= q.size; col++ {
+				if !q.finderLike(row, col, transposed, at) {
+					continue
+				}
+				before, after := true, true
+				for k := 1; k <= 4; k++ {
+					if col-k >= 0 && at(row, col-k, transposed) {
+						before = false
+					}
+					if col+6+k < q.size && at(row, col+6+k, transposed) {
+						after = false
+					}
+				}
+				if before || after {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of the same color
+	dark := 0
+	for row := 0; row < q.size; row++ {
+		for col := 0; col < q.size; col++ {
+			if q.modules[row][col] {
+				dark++
+			}
+			if row+1 < q.size && col+1 < q.size {
+				c := q.modules[row][col]
+				if q.modules[row][col+1] == c && q.modules[row+1][col] == c && q.modules[row+1][col+1] == c {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Dark modules far from half of the code
+	total := q.size * q.size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
+
+// finderLike reports whether the seven modules from col are dark, light,
+// three dark, light, dark
+func (q *qrMatrix) finderLike(row, col int, transposed bool, at func(int, int, bool) bool) bool {
+	for k, dark := range []bool{true, false, true, true, true, false, true} {
+		if at(row, col+k, transposed) != dark {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
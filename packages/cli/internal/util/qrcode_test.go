@@ -0,0 +1,103 @@
+package util
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// qrReference is a QR code of testdata/qrcode.txt
+type qrReference struct {
+	mask int
+	text string
+	rows []string
+}
+
+func readQRReferences(t *testing.T) []qrReference {
+	data, err := os.ReadFile("testdata/qrcode.txt")
+	require.NoError(t, err)
+	var refs []qrReference
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case line == "" || strings.HasPrefix(line, "# "):
+		case strings.HasPrefix(line, "mask "):
+			fields := strings.SplitN(line, " ", 3)
+			mask, err := strconv.Atoi(fields[1])
+			require.NoError(t, err)
+			refs = append(refs, qrReference{mask: mask, text: fields[2]})
+		default:
+			require.NotEmpty(t, refs)
+			refs[len(refs)-1].rows = append(refs[len(refs)-1].rows, line)
+		}
+	}
+	return refs
+}
+
+// qrRows draws modules like testdata/qrcode.txt
+func qrRows(modules [][]bool) []string {
+	rows := make([]string, len(modules))
+	for i, row := range modules {
+		var b strings.Builder
+		for _, dark := range row {
+			if dark {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		rows[i] = b.String()
+	}
+	return rows
+}
+
+func TestRSRemainder(t *testing.T) {
+	// HELLO WORLD at 1-M, the worked example of the standard's tutorials
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, rsRemainder(data, 10))
+}
+
+func TestQRCodeMatchesReference(t *testing.T) {
+	refs := readQRReferences(t)
+	masks := map[int]bool{}
+	versions := map[int]bool{}
+	for _, ref := range refs {
+		modules, err := qrEncode(ref.text, ref.mask)
+		require.NoError(t, err)
+		assert.Equal(t, ref.rows, qrRows(modules), "%q with mask %d", ref.text, ref.mask)
+		masks[ref.mask] = true
+		versions[(len(ref.rows)-17)/4] = true
+	}
+	assert.Len(t, masks, 8, "every mask")
+	assert.Len(t, versions, len(qrVersions), "every version")
+}
+
+func TestQRCode(t *testing.T) {
+	// The mask is chosen by the penalty rules of the standard, so the code
+	// is one of the references but not necessarily the reference encoder's
+	// choice
+	text := "WIFI:T:ADB;S:gbox-7fk2a9;P:ab12cd34ef;;"
+	modules, err := QRCode(text)
+	require.NoError(t, err)
+	require.Len(t, modules, 29, "version 3")
+	masked := 0
+	for mask := 0; mask < 8; mask++ {
+		candidate, err := qrEncode(text, mask)
+		require.NoError(t, err)
+		if assert.ObjectsAreEqual(candidate, modules) {
+			masked++
+		}
+	}
+	assert.Equal(t, 1, masked)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteQRCode(&out, text))
+	assert.Equal(t, (29+4+1)/2, bytes.Count(out.Bytes(), []byte("\n")))
+
+	_, err = QRCode(string(make([]byte, 107)))
+	assert.Error(t, err)
+}
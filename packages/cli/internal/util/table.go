@@ -2,6 +2,8 @@ package util
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 )
 
@@ -18,10 +20,17 @@ func RenderTable(columns []TableColumn, data []map[string]interface{}) {
 		fmt.Println("No data to display")
 		return
 	}
+	WriteTable(os.Stdout, columns, data, false)
+}
 
+// WriteTable writes a table to w, optionally without the header lines
+func WriteTable(w io.Writer, columns []TableColumn, data []map[string]interface{}, noHeaders bool) {
 	// Calculate column widths based on header and data
 	for i := range columns {
-		columns[i].Width = len(columns[i].Header)
+		columns[i].Width = 0
+		if !noHeaders {
+			columns[i].Width = len(columns[i].Header)
+		}
 		for _, row := range data {
 			if value, exists := row[columns[i].Key]; exists {
 				valueStr := fmt.Sprintf("%v", value)
@@ -38,21 +47,23 @@ func RenderTable(columns []TableColumn, data []map[string]interface{}) {
 		}
 	}
 
-	// Print header
-	var headerParts []string
-	for _, col := range columns {
-		headerParts = append(headerParts, fmt.Sprintf("%-*s", col.Width, col.Header))
-	}
-	header := strings.Join(headerParts, " ")
-	fmt.Println(header)
+	if !noHeaders {
+		// Print header
+		var headerParts []string
+		for _, col := range columns {
+			headerParts = append(headerParts, fmt.Sprintf("%-*s", col.Width, col.Header))
+		}
+		header := strings.Join(headerParts, " ")
+		fmt.Fprintln(w, header)
 
-	// Print separator
-	var separatorParts []string
-	for _, col := range columns {
-		separatorParts = append(separatorParts, strings.Repeat("-", col.Width))
+		// Print separator
+		var separatorParts []string
+		for _, col := range columns {
+			separatorParts = append(separatorParts, strings.Repeat("-", col.Width))
+		}
+		separator := strings.Join(separatorParts, " ")
+		fmt.Fprintln(w, separator)
 	}
-	separator := strings.Join(separatorParts, " ")
-	fmt.Println(separator)
 
 	// Print data rows
 	for _, row := range data {
@@ -66,10 +77,15 @@ func RenderTable(columns []TableColumn, data []map[string]interface{}) {
 			paddedValue := padStringToWidth(value, col.Width)
 			rowParts = append(rowParts, paddedValue)
 		}
-		fmt.Println(strings.Join(rowParts, " "))
+		fmt.Fprintln(w, strings.Join(rowParts, " "))
 	}
 }
 
+// StripANSI removes ANSI escape codes from a string
+func StripANSI(s string) string {
+	return removeANSICodes(s)
+}
+
 // removeANSICodes removes ANSI escape codes from a string for width calculation
 func removeANSICodes(s string) string {
 	// Simple ANSI code removal - this could be more sophisticated
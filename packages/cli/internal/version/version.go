@@ -1,6 +1,8 @@
 package version
 
 import (
+	"fmt"
+	"os"
 	"runtime"
 	"time"
 )
@@ -42,3 +44,21 @@ func ClientInfo() map[string]string {
 		"Arch":          runtime.GOARCH,
 	}
 }
+
+// BuildID identifies the binary that is running. A CLI and the server it
+// spawned have the same build ID; a rebuilt or upgraded binary gets a new one,
+// even in development builds without a version.
+func BuildID() string {
+	execPath, err := os.Executable()
+	if err != nil {
+		return BuildTime + "-" + CommitID + "-unknown"
+	}
+
+	info, err := os.Stat(execPath)
+	if err != nil {
+		return BuildTime + "-" + CommitID + "-unknown"
+	}
+
+	// Modification time and size change whenever the binary is rebuilt
+	return fmt.Sprintf("%s-%s-%d", info.ModTime().Format("2006-01-02T15:04:05"), CommitID, info.Size())
+}
@@ -0,0 +1,391 @@
+// Package serverclient is a typed client for the HTTP API of the local gbox
+// server. The API is described by the OpenAPI document returned by Spec and
+// served at /api/openapi.json.
+package serverclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds every request except event streams
+const DefaultTimeout = 10 * time.Second
+
+// APIError is returned when the server answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// StatusCode returns the HTTP status of an APIError, or 0 for other errors
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// Client calls the local gbox server. It does not start the server; the CLI
+// gets a client from daemon.Manager.Client, which does.
+type Client struct {
+	BaseURL string
+	// HTTPClient is used for all requests but event streams, which must not
+	// time out
+	HTTPClient *http.Client
+}
+
+// New creates a client for the server at baseURL, e.g. http://localhost:29888
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// Health checks that the server answers
+func (c *Client) Health() (*Health, error) {
+	var health Health
+	if err := c.do(http.MethodGet, "/api/health", nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Status returns the server status and which services are active
+func (c *Client) Status() (*Status, error) {
+	var status Status
+	if err := c.do(http.MethodGet, "/api/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ServerInfo returns the version, build ID and activity of the server
+func (c *Client) ServerInfo() (*ServerInfo, error) {
+	var info ServerInfo
+	if err := c.do(http.MethodGet, "/api/server/info", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Shutdown asks the server to exit once its active streams have finished or
+// drain has passed
+func (c *Client) Shutdown(drain time.Duration) (*ShutdownResponse, error) {
+	path := "/api/server/shutdown"
+	if drain > 0 {
+		path += "?drain=" + url.QueryEscape(drain.String())
+	}
+	var resp ShutdownResponse
+	if err := c.do(http.MethodPost, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Devices lists local devices and registered devices that are offline
+func (c *Client) Devices() ([]Device, error) {
+	return c.SelectDevices("", false)
+}
+
+// SelectDevices lists the devices whose labels match a selector such as
+// team=qa,!busy, only the free ones when free is set
+func (c *Client) SelectDevices(selector string, free bool) ([]Device, error) {
+	query := url.Values{}
+	if selector != "" {
+		query.Set("selector", selector)
+	}
+	if free {
+		query.Set("free", "true")
+	}
+	path := "/api/devices"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var list DeviceList
+	if err := c.do(http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	if !list.Success {
+		return nil, fmt.Errorf("failed to get devices from server: %s", list.Error)
+	}
+	return list.Devices, nil
+}
+
+// RegisterDevice registers a device for remote access and returns its cloud record
+func (c *Client) RegisterDevice(req RegisterDeviceRequest) (*RegisteredDevice, error) {
+	var resp RegisterDeviceResponse
+	if err := c.do(http.MethodPost, "/api/devices/register", req, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, errors.New("server did not register the device")
+	}
+	return &resp.Data, nil
+}
+
+// UnregisterDevice removes a device by adb serial, transport ID or regId
+func (c *Client) UnregisterDevice(deviceID string) error {
+	return c.do(http.MethodPost, "/api/devices/unregister", UnregisterDeviceRequest{DeviceID: deviceID}, nil)
+}
+
+// ReconnectDevice retries the session of a registered device now. A non-nil
+// req may change the reconnect policy of the device first.
+func (c *Client) ReconnectDevice(serial string, req *ReconnectRequest) (*ReconnectResponse, error) {
+	var body interface{}
+	if req != nil {
+		body = req
+	}
+	var resp ReconnectResponse
+	if err := c.do(http.MethodPost, "/api/devices/"+url.PathEscape(serial)+"/reconnect", body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeviceHealth returns the last health check of an Android device, refresh
+// reads its vitals now
+func (c *Client) DeviceHealth(serial string, refresh bool) (*DeviceHealth, error) {
+	path := "/api/devices/" + url.PathEscape(serial) + "/health"
+	if refresh {
+		path += "?refresh=true"
+	}
+	var health DeviceHealth
+	if err := c.do(http.MethodGet, path, nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// DeviceLabels returns the labels of a device by adb serial, serialno or
+// local for this machine
+func (c *Client) DeviceLabels(serial string) (*DeviceLabels, error) {
+	var labels DeviceLabels
+	if err := c.do(http.MethodGet, "/api/devices/"+url.PathEscape(serial)+"/labels", nil, &labels); err != nil {
+		return nil, err
+	}
+	return &labels, nil
+}
+
+// UpdateDeviceLabels sets and removes labels of a device
+func (c *Client) UpdateDeviceLabels(serial string, req DeviceLabelsRequest) (*DeviceLabels, error) {
+	var labels DeviceLabels
+	if err := c.do(http.MethodPost, "/api/devices/"+url.PathEscape(serial)+"/labels", req, &labels); err != nil {
+		return nil, err
+	}
+	return &labels, nil
+}
+
+// AcquireLease leases a device to req.Owner, any free device matching
+// req.Selector when serial is empty. The returned lease carries the ID to
+// renew and release it with.
+func (c *Client) AcquireLease(serial string, req LeaseRequest) (*DeviceLease, error) {
+	path := "/api/devices/lease"
+	if serial != "" {
+		path = "/api/devices/" + url.PathEscape(serial) + "/lease"
+	}
+	var lease DeviceLease
+	if err := c.do(http.MethodPost, path, req, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// RenewLease extends the lease with id by its TTL
+func (c *Client) RenewLease(serial, id string) (*DeviceLease, error) {
+	var lease DeviceLease
+	header := http.Header{LeaseHeader: {id}}
+	if err := c.doWithHeader(http.MethodPut, "/api/devices/"+url.PathEscape(serial)+"/lease", header, nil, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// ReleaseLease ends the lease with id, or any lease of the device when force
+// is set, and returns the lease that ended
+func (c *Client) ReleaseLease(serial, id string, force bool) (*DeviceLease, error) {
+	path := "/api/devices/" + url.PathEscape(serial) + "/lease"
+	if force {
+		path += "?force=true"
+	}
+	var header http.Header
+	if id != "" {
+		header = http.Header{LeaseHeader: {id}}
+	}
+	var lease DeviceLease
+	if err := c.doWithHeader(http.MethodDelete, path, header, nil, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// DeviceLease returns the current lease of a device, an APIError with status
+// 404 when it is not leased
+func (c *Client) DeviceLease(serial string) (*DeviceLease, error) {
+	var lease DeviceLease
+	if err := c.do(http.MethodGet, "/api/devices/"+url.PathEscape(serial)+"/lease", nil, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// WirelessDevices lists the wireless debugging services found on the LAN
+func (c *Client) WirelessDevices() ([]WirelessDevice, error) {
+	var devices []WirelessDevice
+	if err := c.do(http.MethodGet, "/api/devices/wireless", nil, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// PairDevice pairs the adb server with a device over wireless debugging and
+// connects to it
+func (c *Client) PairDevice(req PairRequest) (*PairResponse, error) {
+	var resp PairResponse
+	if err := c.do(http.MethodPost, "/api/devices/pair", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// StartADBExpose exposes the ports of a box on the local machine
+func (c *Client) StartADBExpose(req ExposeStartRequest) (*ExposeStartResponse, error) {
+	var resp ExposeStartResponse
+	if err := c.do(http.MethodPost, "/api/adb-expose/start", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// StopADBExpose stops exposing the ports of a box
+func (c *Client) StopADBExpose(boxID string) (*ExposeStopResponse, error) {
+	var resp ExposeStopResponse
+	if err := c.do(http.MethodPost, "/api/adb-expose/stop", ExposeStopRequest{BoxID: boxID}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ADBExposeStatus returns whether adb-expose runs and its port forwards
+func (c *Client) ADBExposeStatus() (*ExposeStatus, error) {
+	var status ExposeStatus
+	if err := c.do(http.MethodGet, "/api/adb-expose/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ADBExposeList returns the active port forwards
+func (c *Client) ADBExposeList() ([]PortForward, error) {
+	var list ExposeList
+	if err := c.do(http.MethodGet, "/api/adb-expose/list", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Forwards, nil
+}
+
+// Events opens the server-sent event stream of /api/events, resuming after
+// lastID when it is not 0. query may filter by type and subject. The caller
+// reads and closes the response body; the stream ends with ctx.
+func (c *Client) Events(ctx context.Context, query url.Values, lastID uint64) (*http.Response, error) {
+	path := "/api/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(lastID, 10))
+	}
+
+	// No client timeout, the stream stays open until ctx ends
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, readAPIError(resp)
+	}
+	return resp, nil
+}
+
+// do sends body as JSON and decodes the response into result. Transport
+// errors are returned as they are, so callers can tell a server that is
+// down from one that refused the request.
+func (c *Client) do(method, path string, body, result interface{}) error {
+	return c.doWithHeader(method, path, nil, body, result)
+}
+
+// doWithHeader is do with extra request headers
+func (c *Client) doWithHeader(method, path string, header http.Header, body, result interface{}) error {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %v", err)
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return readAPIError(resp)
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response of %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// readAPIError takes the message from a JSON error body, or the plain text
+// some handlers answer with
+func readAPIError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body ErrorResponse
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		return &APIError{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+}
@@ -0,0 +1,45 @@
+package serverclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/devices/unregister":
+			http.Error(w, "failed to resolve device identifiers", http.StatusInternalServerError)
+		case "/api/devices":
+			w.Write([]byte(`{"success":false,"error":"adb not found","devices":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client := New(srv.URL + "/")
+
+	// Plain text error bodies become the message
+	err := client.UnregisterDevice("serial")
+	assert.Equal(t, http.StatusInternalServerError, StatusCode(err))
+	assert.EqualError(t, err, "API error (status 500): failed to resolve device identifiers")
+
+	_, err = client.Devices()
+	assert.EqualError(t, err, "failed to get devices from server: adb not found")
+	assert.Zero(t, StatusCode(err))
+
+	// A server that is down is a transport error, not an API error
+	srv.Close()
+	client.HTTPClient.Timeout = time.Second
+	_, err = client.Health()
+	var urlErr *url.Error
+	require.True(t, errors.As(err, &urlErr))
+	assert.Zero(t, StatusCode(err))
+}
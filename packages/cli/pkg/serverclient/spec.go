@@ -0,0 +1,12 @@
+package serverclient
+
+import _ "embed"
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the OpenAPI 3 document of the server API. The server serves it
+// at /api/openapi.json; contract tests check it against the registered routes.
+func Spec() []byte {
+	return spec
+}
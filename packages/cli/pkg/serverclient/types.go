@@ -0,0 +1,316 @@
+package serverclient
+
+import "time"
+
+// Health is the response of GET /api/health
+type Health struct {
+	Status  string `json:"status"`
+	Service string `json:"service"`
+}
+
+// Status is the response of GET /api/status
+type Status struct {
+	Running  bool           `json:"running"`
+	Port     int            `json:"port"`
+	Uptime   string         `json:"uptime"`
+	Services StatusServices `json:"services"`
+	Version  string         `json:"version"`
+	BuildID  string         `json:"build_id"`
+}
+
+// StatusServices reports which services of the server are active
+type StatusServices struct {
+	DeviceConnect bool `json:"device_connect"`
+	ADBExpose     bool `json:"adb_expose"`
+}
+
+// ServerInfo is the response of GET /api/server/info
+type ServerInfo struct {
+	Version string `json:"version"`
+	BuildID string `json:"build_id"`
+	Port    int    `json:"port"`
+	PID     int    `json:"pid,omitempty"`
+	Uptime  string `json:"uptime"`
+	// ActiveStreams counts open device streams and control sessions
+	ActiveStreams int  `json:"active_streams"`
+	Draining      bool `json:"draining,omitempty"`
+	// Supervisor is systemd, daemon or foreground
+	Supervisor string   `json:"supervisor,omitempty"`
+	Services   []string `json:"services,omitempty"`
+	// LocalOnly is set when devices are served without the cloud
+	LocalOnly bool `json:"local_only,omitempty"`
+}
+
+// ShutdownResponse is the response of POST /api/server/shutdown
+type ShutdownResponse struct {
+	Message       string `json:"message"`
+	ActiveStreams int    `json:"active_streams"`
+}
+
+// Device is a local or registered device as listed by GET /api/devices
+type Device struct {
+	ID                string                 `json:"id"`
+	TransportID       string                 `json:"transportId"`
+	Serialno          string                 `json:"serialno"`
+	Platform          string                 `json:"platform"`   // mobile, desktop
+	OS                string                 `json:"os"`         // android, linux, windows, macos
+	DeviceType        string                 `json:"deviceType"` // physical, emulator, vm
+	IsRegistered      bool                   `json:"isRegistered"`
+	IsConnected       bool                   `json:"isConnected"`       // true if device is currently connected to AP
+	IsReconnecting    bool                   `json:"isReconnecting"`    // true if device is attempting to reconnect
+	ReconnectAttempt  int                    `json:"reconnectAttempt"`  // Current reconnection attempt count
+	ReconnectMaxRetry int                    `json:"reconnectMaxRetry"` // Maximum reconnection attempts
+	RegId             string                 `json:"regId"`
+	IsLocal           bool                   `json:"isLocal"`         // true if this is the local desktop device
+	BoxID             string                 `json:"boxId,omitempty"` // Set when the device is a box connected through adb-expose
+	Metadata          map[string]interface{} `json:"metadata"`        // Device-specific metadata
+	// IsOffline marks registered devices known only from the device registry:
+	// not attached now, or the cloud could not be reached to confirm them
+	IsOffline bool       `json:"isOffline,omitempty"`
+	LastSeen  *time.Time `json:"lastSeen,omitempty"`
+	// Health is the last health check of an Android device
+	Health *DeviceHealth `json:"health,omitempty"`
+	// Labels are set with gbox device-connect label and matched by selectors
+	Labels map[string]string `json:"labels,omitempty"`
+	// Lease is the current lease of the device, without its ID
+	Lease *DeviceLease `json:"lease,omitempty"`
+}
+
+// MetadataString returns a string metadata field such as model or connectionType
+func (d *Device) MetadataString(key string) string {
+	s, _ := d.Metadata[key].(string)
+	return s
+}
+
+// IsFree reports whether the device can be picked for new work: it is
+// attached, not quarantined, not leased and not a box connected through
+// adb-expose
+func (d *Device) IsFree() bool {
+	if d.IsOffline || d.BoxID != "" || d.Lease != nil {
+		return false
+	}
+	return d.Health == nil || !d.Health.Quarantined
+}
+
+// DeviceList is the response of GET /api/devices
+type DeviceList struct {
+	Success         bool     `json:"success"`
+	Devices         []Device `json:"devices"`
+	OnDemandEnabled bool     `json:"onDemandEnabled,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// DeviceLabelsRequest is the body of POST /api/devices/{serial}/labels
+type DeviceLabelsRequest struct {
+	Labels map[string]string `json:"labels,omitempty"` // Labels to set
+	Remove []string          `json:"remove,omitempty"` // Keys of labels to remove
+}
+
+// DeviceLabels is the response of GET and POST /api/devices/{serial}/labels
+type DeviceLabels struct {
+	Serialno string            `json:"serialno"`
+	Labels   map[string]string `json:"labels"`
+	// Warning tells why the labels of a registered device could not be
+	// pushed to the cloud, they are saved locally nonetheless
+	Warning string `json:"warning,omitempty"`
+}
+
+// LeaseHeader carries the lease ID on requests to a leased device. WebSocket
+// clients that cannot set headers pass it in the lease query parameter.
+const LeaseHeader = "X-Gbox-Lease"
+
+// LeaseRequest is the body of POST /api/devices/{serial}/lease and of
+// POST /api/devices/lease, which leases any free device matching Selector
+type LeaseRequest struct {
+	Owner string `json:"owner"`
+	// TTL is how long the lease lasts unless renewed, e.g. 30m; the server
+	// default when empty
+	TTL string `json:"ttl,omitempty"`
+	// Cleanup uninstalls the apps installed during the lease when it ends
+	Cleanup  bool   `json:"cleanup,omitempty"`
+	Selector string `json:"selector,omitempty"`
+}
+
+// DeviceLease is a lease of a device. The ID is only returned to the holder
+// when the lease is acquired or renewed.
+type DeviceLease struct {
+	ID         string    `json:"id,omitempty"`
+	Serial     string    `json:"serial"`
+	Serialno   string    `json:"serialno,omitempty"`
+	Owner      string    `json:"owner"`
+	TTL        string    `json:"ttl"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	RenewedAt  time.Time `json:"renewedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Cleanup    bool      `json:"cleanup,omitempty"`
+}
+
+// RegisterDeviceRequest is the body of POST /api/devices/register. An empty
+// DeviceID registers the local machine.
+type RegisterDeviceRequest struct {
+	DeviceID   string `json:"deviceId,omitempty"`
+	DeviceType string `json:"deviceType"`       // mobile, desktop
+	OsType     string `json:"osType,omitempty"` // android, linux, windows, macos
+	RegID      string `json:"regId,omitempty"`  // regId of an earlier registration of this machine
+}
+
+// RegisteredDevice is the cloud record returned after registering a device
+type RegisteredDevice struct {
+	ID       string                 `json:"id"`
+	RegID    string                 `json:"regId,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// RegisterDeviceResponse is the response of POST /api/devices/register
+type RegisterDeviceResponse struct {
+	Success bool             `json:"success"`
+	Data    RegisteredDevice `json:"data"`
+}
+
+// UnregisterDeviceRequest is the body of POST /api/devices/unregister.
+// DeviceID is an adb serial, a transport ID or a regId.
+type UnregisterDeviceRequest struct {
+	DeviceID string `json:"deviceId"`
+}
+
+// ReconnectPolicy is how the server retries a lost device session.
+// Durations are Go durations such as 30s or 5m.
+type ReconnectPolicy struct {
+	MaxAttempts      int    `json:"max_attempts"` // 0 retries forever
+	BaseDelay        string `json:"base_delay"`
+	MaxDelay         string `json:"max_delay"`
+	BreakerThreshold int    `json:"breaker_threshold"` // Failures in a row before pausing for Cooldown, 0 never pauses
+	Cooldown         string `json:"cooldown"`
+	CancelOnOffline  bool   `json:"cancel_on_offline"`
+}
+
+// ReconnectRequest is the optional body of POST /api/devices/{serial}/reconnect
+type ReconnectRequest struct {
+	// Policy overrides fields of the device's reconnect policy, keyed like
+	// the JSON fields of ReconnectPolicy, and keeps it for the device
+	Policy map[string]interface{} `json:"policy,omitempty"`
+	// ResetPolicy makes the device use the global policy again
+	ResetPolicy bool `json:"reset_policy,omitempty"`
+}
+
+// ReconnectResponse is the response of POST /api/devices/{serial}/reconnect
+type ReconnectResponse struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Policy  ReconnectPolicy `json:"policy"`
+}
+
+// DeviceHealth is the response of GET /api/devices/{serial}/health: the
+// vitals of an Android device and whether the server quarantined it
+type DeviceHealth struct {
+	Serial             string     `json:"serial"`
+	BatteryLevel       int        `json:"battery_level"`       // Percent
+	BatteryTemperature float64    `json:"battery_temperature"` // Degrees Celsius
+	Charging           bool       `json:"charging"`
+	StorageFree        int64      `json:"storage_free"` // Bytes free on /data
+	StorageTotal       int64      `json:"storage_total"`
+	CPULoad            float64    `json:"cpu_load"` // One minute load average
+	ScreenOn           bool       `json:"screen_on"`
+	CheckedAt          *time.Time `json:"checked_at,omitempty"`
+	// Errors name the vitals that could not be read, Error why the last
+	// check failed altogether
+	Errors []string `json:"errors,omitempty"`
+	Error  string   `json:"error,omitempty"`
+	// A quarantined device is disconnected and marked unavailable until its
+	// vitals recover
+	Quarantined       bool       `json:"quarantined"`
+	QuarantineReasons []string   `json:"quarantine_reasons,omitempty"`
+	QuarantinedAt     *time.Time `json:"quarantined_at,omitempty"`
+}
+
+// WirelessDevice is an Android 11+ wireless debugging service the adb
+// server found on the LAN, listed by GET /api/devices/wireless
+type WirelessDevice struct {
+	Name    string `json:"name"`    // mDNS instance name
+	Service string `json:"service"` // "connect", or "pairing" while a pairing dialog is open
+	Address string `json:"address"` // host:port
+	// SerialNo is the serial number of the device, when the name tells
+	SerialNo string `json:"serialno,omitempty"`
+	// Serial is the adb serial of the device once connected
+	Serial    string `json:"serial,omitempty"`
+	Connected bool   `json:"connected"`
+	// Error is why the server could not connect, usually a device that is
+	// not paired yet
+	Error string `json:"error,omitempty"`
+}
+
+// PairRequest is the body of POST /api/devices/pair
+type PairRequest struct {
+	// Address is the pairing address shown by the device, Code its pairing
+	// code or the password of a pairing QR code
+	Address string `json:"address"`
+	Code    string `json:"code"`
+	// ConnectAddress is the address to connect to after pairing. It is
+	// found with mDNS when left out.
+	ConnectAddress string `json:"connect_address,omitempty"`
+}
+
+// PairResponse is the response of POST /api/devices/pair
+type PairResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	// Serial is the adb serial of the device when it was connected
+	Serial string `json:"serial,omitempty"`
+}
+
+// PortForward is a box port exposed on the local machine by adb-expose
+type PortForward struct {
+	BoxID       string    `json:"box_id"`
+	LocalPorts  []int     `json:"local_ports"`
+	RemotePorts []int     `json:"remote_ports"`
+	Status      string    `json:"status"` // "running", "stopped", "error"
+	StartedAt   time.Time `json:"started_at"`
+	Error       string    `json:"error,omitempty"`
+	AdbSerial   string    `json:"adb_serial,omitempty"` // Set when the local adb server is connected to the exposed port
+}
+
+// ExposeStartRequest is the body of POST /api/adb-expose/start
+type ExposeStartRequest struct {
+	BoxID       string `json:"box_id"`
+	LocalPorts  []int  `json:"local_ports"`
+	RemotePorts []int  `json:"remote_ports"`
+	// AdbConnect asks the server to connect the local adb server to the
+	// first exposed port
+	AdbConnect bool `json:"adb_connect,omitempty"`
+}
+
+// ExposeStartResponse is the response of POST /api/adb-expose/start
+type ExposeStartResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Data    PortForward `json:"data"`
+}
+
+// ExposeStopRequest is the body of POST /api/adb-expose/stop
+type ExposeStopRequest struct {
+	BoxID string `json:"box_id"`
+}
+
+// ExposeStopResponse is the response of POST /api/adb-expose/stop
+type ExposeStopResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// ExposeStatus is the response of GET /api/adb-expose/status
+type ExposeStatus struct {
+	Running  bool          `json:"running"`
+	Forwards []PortForward `json:"forwards"`
+}
+
+// ExposeList is the response of GET /api/adb-expose/list
+type ExposeList struct {
+	Forwards []PortForward `json:"forwards"`
+	Count    int           `json:"count"`
+}
+
+// ErrorResponse is the body of JSON error responses
+type ErrorResponse struct {
+	Success *bool  `json:"success,omitempty"`
+	Error   string `json:"error"`
+}